@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+// agentStatus is the document an agent reports to its source after every
+// fetch of its jobs.
+type agentStatus struct {
+	Host      string    `json:"host"`
+	Version   string    `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+	// ConfigError is why the last fetch failed, while the agent keeps
+	// running the jobs of the one before.
+	ConfigError string          `json:"config_error,omitempty"`
+	Jobs        []profileStatus `json:"jobs"`
+}
+
+// agentJob is a job the agent runs, or failed to start.
+type agentJob struct {
+	def    sync.AgentJob
+	syncer *sync.Syncer
+	err    error
+	stop   context.CancelFunc
+	done   chan struct{}
+}
+
+// close stops the schedule of the job, waiting for its run in progress to
+// abort.
+func (j *agentJob) close() {
+	if j.stop != nil {
+		j.stop()
+		<-j.done
+	}
+}
+
+// agent runs the jobs of host defined at source.
+type agent struct {
+	source *sync.AgentSource
+	host   string
+	// newSyncer builds the Syncer of a job, started unless it fails.
+	newSyncer func(cfg sync.Config) (*sync.Syncer, error)
+
+	jobs      map[string]*agentJob
+	configErr error
+}
+
+func newAgent(source *sync.AgentSource, host string) *agent {
+	return &agent{
+		source: source,
+		host:   host,
+		newSyncer: func(cfg sync.Config) (*sync.Syncer, error) {
+			syncer, err := sync.New(cfg)
+			if err != nil {
+				return nil, err
+			}
+			if err := syncer.PrepareBucket(); err != nil {
+				return nil, err
+			}
+			return syncer, nil
+		},
+		jobs: make(map[string]*agentJob),
+	}
+}
+
+// runAgent implements `gui-sync agent`, which runs the jobs an
+// administrator defines for this machine at a central source.
+func runAgent(args []string) error {
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	source := fs.String("source", "", i18n.T("agent.source"))
+	poll := fs.Duration("poll", 5*time.Minute, i18n.T("agent.poll"))
+	host := fs.String("host", "", i18n.T("agent.host"))
+	languageFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), i18n.T("agent.usage"))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *source == "" {
+		fs.Usage()
+		return i18n.Errorf("agent.required")
+	}
+	src, err := sync.ParseAgentSource(*source)
+	if err != nil {
+		return err
+	}
+	if *poll <= 0 {
+		return i18n.Errorf("agent.invalid_poll", *poll)
+	}
+	if *host == "" {
+		if *host, err = os.Hostname(); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf(i18n.T("agent.started"), *host, *source, *poll)
+	newAgent(src, *host).run(ctx, *poll)
+	return nil
+}
+
+// run fetches the jobs and reports their status every poll until ctx is
+// cancelled, then stops them.
+func (a *agent) run(ctx context.Context, poll time.Duration) {
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		a.refresh(ctx)
+		a.report(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			for name := range a.jobs {
+				a.stopJob(name)
+			}
+			return
+		}
+	}
+}
+
+// refresh fetches the jobs of the agent, stopping those removed or changed
+// and starting the new ones. Jobs that failed to start are tried again. A
+// source that cannot be read leaves the jobs as they are: backups go on
+// while the source is down.
+func (a *agent) refresh(ctx context.Context) {
+	data, err := a.source.Fetch(ctx)
+	var defs []sync.AgentJob
+	if err == nil {
+		defs, err = sync.ParseAgentConfig(data, a.host)
+	}
+	a.configErr = err
+	if err != nil {
+		log.Printf(i18n.T("agent.refresh_failed"), err)
+		return
+	}
+
+	wanted := make(map[string]sync.AgentJob, len(defs))
+	for _, def := range defs {
+		wanted[def.Name] = def
+	}
+	for name, job := range a.jobs {
+		if def, ok := wanted[name]; !ok || job.syncer == nil || !reflect.DeepEqual(def, job.def) {
+			a.stopJob(name)
+		}
+	}
+	for _, def := range defs {
+		if _, ok := a.jobs[def.Name]; !ok {
+			a.jobs[def.Name] = a.startJob(ctx, def)
+		}
+	}
+}
+
+// startJob starts the schedule of def.
+func (a *agent) startJob(ctx context.Context, def sync.AgentJob) *agentJob {
+	job := &agentJob{def: def}
+	cfg, err := def.Config()
+	if err == nil {
+		job.syncer, err = a.newSyncer(cfg)
+	}
+	var release func()
+	if err == nil {
+		release, err = job.syncer.AcquireLock(false)
+	}
+	if err != nil {
+		job.syncer, job.err = nil, err
+		log.Printf(i18n.T("agent.job_failed"), def.Name, err)
+		return job
+	}
+
+	jobCtx, stop := context.WithCancel(ctx)
+	job.stop, job.done = stop, make(chan struct{})
+	go func() {
+		defer close(job.done)
+		defer release()
+		if err := job.syncer.Watch(jobCtx); err != nil && jobCtx.Err() == nil {
+			log.Printf(i18n.T("agent.job_failed"), def.Name, err)
+		}
+	}()
+	fmt.Printf(i18n.T("agent.job_started"), def.Name, def.Dir, def.Bucket)
+	return job
+}
+
+// stopJob stops the job name and forgets it.
+func (a *agent) stopJob(name string) {
+	job := a.jobs[name]
+	delete(a.jobs, name)
+	if job.syncer != nil {
+		job.close()
+		fmt.Printf(i18n.T("agent.job_stopped"), name)
+	}
+}
+
+// status returns the status of the agent and its jobs at now.
+func (a *agent) status(now time.Time) agentStatus {
+	st := agentStatus{Host: a.host, Version: sync.Version, Timestamp: now.UTC(), Jobs: []profileStatus{}}
+	if a.configErr != nil {
+		st.ConfigError = a.configErr.Error()
+	}
+	names := make([]string, 0, len(a.jobs))
+	for name := range a.jobs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		job := a.jobs[name]
+		if job.syncer != nil {
+			st.Jobs = append(st.Jobs, profileStatusOf(name, job.syncer.Status()))
+			continue
+		}
+		st.Jobs = append(st.Jobs, profileStatus{
+			Name:       name,
+			Bucket:     job.def.Bucket,
+			RootDir:    job.def.Dir,
+			Schedule:   job.def.Schedule,
+			LastResult: resultFailure,
+			LastError:  job.err.Error(),
+		})
+	}
+	return st
+}
+
+// report sends the status of the agent to its source. Failures are
+// logged: the next report sends a fresh status anyway.
+func (a *agent) report(ctx context.Context) {
+	if err := a.source.Report(ctx, a.host, a.status(time.Now())); err != nil {
+		log.Printf(i18n.T("agent.report_failed"), err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gui-sync/pkg/sync"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: agent mode
+func TestAgentReportsItsJobs(t *testing.T) {
+	document := `{"jobs": [
+		{"name": "docs", "hosts": ["pc-01"], "bucket": "backup", "region": "sa-east-1", "dir": "/srv/docs", "schedule": "@hourly"},
+		{"name": "fotos", "hosts": ["pc-02"], "bucket": "backup", "region": "sa-east-1", "dir": "/srv/fotos", "schedule": "@daily"}
+	]}`
+	var reports []agentStatus
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			io.WriteString(w, document)
+			return
+		}
+		var status agentStatus
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&status))
+		reports = append(reports, status)
+	}))
+	defer server.Close()
+
+	src, err := sync.ParseAgentSource(server.URL)
+	require.NoError(t, err)
+	a := newAgent(src, "pc-01")
+	var started []string
+	a.newSyncer = func(cfg sync.Config) (*sync.Syncer, error) {
+		started = append(started, cfg.RootDir)
+		return nil, errors.New("access denied")
+	}
+
+	ctx := context.Background()
+	a.refresh(ctx)
+	a.report(ctx)
+	require.Len(t, reports, 1)
+	assert.Equal(t, "pc-01", reports[0].Host)
+	assert.Empty(t, reports[0].ConfigError)
+	require.Len(t, reports[0].Jobs, 1)
+	assert.Equal(t, "docs", reports[0].Jobs[0].Name)
+	assert.Equal(t, resultFailure, reports[0].Jobs[0].LastResult)
+	assert.Equal(t, "access denied", reports[0].Jobs[0].LastError)
+
+	// Jobs that failed to start are tried again; a broken document keeps the
+	// jobs as they are.
+	a.refresh(ctx)
+	assert.Equal(t, []string{"/srv/docs", "/srv/docs"}, started)
+	document = `{"jobs": [`
+	a.refresh(ctx)
+	a.report(ctx)
+	require.Len(t, reports, 2)
+	assert.NotEmpty(t, reports[1].ConfigError)
+	assert.Len(t, reports[1].Jobs, 1)
+	assert.Len(t, started, 2)
+}
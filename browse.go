@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+// runLs implements `gui-sync ls [prefix]`, listing the bucket one level at
+// a time, or the whole tree below prefix with -r.
+func runLs(args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	bucket := fs.String("bucket", "", i18n.T("cli.bucket"))
+	awsRegion := fs.String("region", "", i18n.T("cli.region"))
+	creds := credentialFlags(fs)
+	languageFlag(fs)
+	recursive := fs.Bool("r", false, i18n.T("ls.recursive"))
+	jsonOutput := fs.Bool("json", false, i18n.T("browse.json"))
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), i18n.T("ls.usage"))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *bucket == "" || *awsRegion == "" || fs.NArg() > 1 {
+		fs.Usage()
+		return i18n.Errorf("cli.bucket_region_required")
+	}
+	prefix := strings.TrimPrefix(fs.Arg(0), "/")
+
+	syncer, err := sync.New(sync.Config{Bucket: *bucket, Region: *awsRegion, Credentials: *creds})
+	if err != nil {
+		return err
+	}
+
+	entries, err := syncer.List(prefix, *recursive)
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		if entries == nil {
+			entries = []sync.RemoteEntry{}
+		}
+		return printJSON(entries)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, e := range entries {
+		if e.Dir {
+			fmt.Fprintf(w, "\t\tDIR\t %s\n", e.Key)
+			continue
+		}
+		modified := "-"
+		if e.LastModified != nil {
+			modified = e.LastModified.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t %s\n", modified, e.StorageClass, e.Size, e.Key)
+	}
+	w.Flush()
+	return nil
+}
+
+// runStat implements `gui-sync stat <key>`, describing one object with the
+// file details gui-sync stored in its metadata.
+func runStat(args []string) error {
+	fs := flag.NewFlagSet("stat", flag.ContinueOnError)
+	bucket := fs.String("bucket", "", i18n.T("cli.bucket"))
+	awsRegion := fs.String("region", "", i18n.T("cli.region"))
+	creds := credentialFlags(fs)
+	languageFlag(fs)
+	jsonOutput := fs.Bool("json", false, i18n.T("browse.json"))
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), i18n.T("stat.usage"))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *bucket == "" || *awsRegion == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return i18n.Errorf("stat.required")
+	}
+
+	syncer, err := sync.New(sync.Config{Bucket: *bucket, Region: *awsRegion, Credentials: *creds})
+	if err != nil {
+		return err
+	}
+
+	obj, err := syncer.Stat(strings.TrimPrefix(fs.Arg(0), "/"))
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		return printJSON(obj)
+	}
+	printRemoteObject(obj)
+	return nil
+}
+
+// printRemoteObject prints obj as one "label: value" line per known field.
+func printRemoteObject(obj *sync.RemoteObject) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	field := func(id string, value any) {
+		fmt.Fprintf(w, "%s:\t%v\n", i18n.T(id), value)
+	}
+	optional := func(id, value string) {
+		if value != "" {
+			field(id, value)
+		}
+	}
+
+	field("stat.key", obj.Key)
+	field("stat.size", obj.Size)
+	if obj.ContentLength != obj.Size {
+		field("stat.content_length", obj.ContentLength)
+	}
+	optional("stat.content_type", obj.ContentType)
+	optional("stat.content_encoding", obj.ContentEncoding)
+	field("stat.storage_class", obj.StorageClass)
+	field("stat.last_modified", obj.LastModified.Local().Format(time.RFC3339))
+	field("stat.etag", obj.ETag)
+	optional("stat.version", obj.VersionID)
+	optional("stat.encryption", obj.Encryption)
+	if obj.ModTime != nil {
+		field("stat.mod_time", obj.ModTime.Local().Format(time.RFC3339Nano))
+	}
+	if obj.Mode != 0 {
+		field("stat.mode", obj.Mode)
+	}
+	optional("stat.hash", obj.Hash)
+	optional("stat.symlink", obj.Symlink)
+	optional("stat.hard_link", obj.HardLink)
+
+	keys := make([]string, 0, len(obj.Metadata))
+	for k := range obj.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s:\t%s=%s\n", i18n.T("stat.metadata"), k, obj.Metadata[k])
+	}
+	w.Flush()
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+// runCleanup implements `gui-sync cleanup`, aborting incomplete multipart
+// uploads whose parts would otherwise stay billed indefinitely.
+func runCleanup(args []string) error {
+	fs := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	bucket := fs.String("bucket", "", i18n.T("cli.bucket"))
+	awsRegion := fs.String("region", "", i18n.T("cli.region"))
+	creds := credentialFlags(fs)
+	languageFlag(fs)
+	olderThan := fs.Duration("older-than", 24*time.Hour, i18n.T("cleanup.older_than"))
+	dryRun := fs.Bool("dry-run", false, i18n.T("cleanup.dry_run"))
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), i18n.T("cleanup.usage"))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *bucket == "" || *awsRegion == "" {
+		fs.Usage()
+		return i18n.Errorf("cli.bucket_region_required")
+	}
+
+	syncer, err := sync.New(sync.Config{Bucket: *bucket, Region: *awsRegion, Credentials: *creds})
+	if err != nil {
+		return err
+	}
+
+	uploads, err := syncer.StaleUploads(*olderThan)
+	if err != nil {
+		return err
+	}
+
+	if len(uploads) == 0 {
+		fmt.Println(i18n.T("cleanup.none"))
+		return nil
+	}
+
+	if *dryRun {
+		for _, upload := range uploads {
+			fmt.Printf(i18n.T("cleanup.stale"), aws.StringValue(upload.Key), aws.TimeValue(upload.Initiated).Format(time.RFC3339))
+		}
+		fmt.Printf(i18n.T("cleanup.would_abort"), len(uploads))
+		return nil
+	}
+
+	aborted, err := syncer.AbortUploads(uploads)
+	fmt.Printf(i18n.T("cleanup.done"), aborted)
+	return err
+}
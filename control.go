@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+const defaultControlAddr = "127.0.0.1:7878"
+
+// profileStatus is the JSON document served by the control API for each
+// profile the daemon runs.
+type profileStatus struct {
+	Name           string     `json:"name"`
+	Bucket         string     `json:"bucket"`
+	RootDir        string     `json:"root_dir"`
+	Schedule       string     `json:"schedule"`
+	Running        bool       `json:"running"`
+	Paused         bool       `json:"paused"`
+	Deferred       string     `json:"deferred,omitempty"`
+	WarmUpError    string     `json:"warm_up_error,omitempty"`
+	MassChange     string     `json:"mass_change,omitempty"`
+	LastRunStart   *time.Time `json:"last_run_start,omitempty"`
+	LastRunEnd     *time.Time `json:"last_run_end,omitempty"`
+	LastResult     string     `json:"last_result,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextRun        *time.Time `json:"next_run,omitempty"`
+	PendingUploads int64      `json:"pending_uploads"`
+	BytesPerSecond float64    `json:"bytes_per_second"`
+	// Summary is the statistics of the current run, or of the last one.
+	Summary *sync.RunSummary `json:"summary,omitempty"`
+}
+
+// Values of profileStatus.LastResult. They are part of the API and are not
+// translated; `gui-sync status` translates them for display.
+const (
+	resultSuccess = "ok"
+	resultFailure = "erro"
+)
+
+// profileStatusOf converts the status of the Syncer of profile name into its
+// control API document. The scheduler runs a single profile, named
+// "default"; agents name theirs after their jobs.
+func profileStatusOf(name string, st sync.Status) profileStatus {
+	status := profileStatus{
+		Name:           name,
+		Bucket:         st.Bucket,
+		RootDir:        st.RootDir,
+		Schedule:       st.Schedule,
+		Running:        st.Running,
+		Paused:         st.Paused,
+		Deferred:       st.Deferred,
+		MassChange:     st.MassChange,
+		PendingUploads: st.PendingUploads,
+		BytesPerSecond: st.BytesPerSecond,
+		Summary:        st.Summary,
+	}
+	if !st.LastRunStart.IsZero() {
+		start := st.LastRunStart
+		status.LastRunStart = &start
+	}
+	if !st.LastRunEnd.IsZero() {
+		end := st.LastRunEnd
+		status.LastRunEnd = &end
+		status.LastResult = resultSuccess
+		if st.LastError != nil {
+			status.LastResult = resultFailure
+			status.LastError = st.LastError.Error()
+		}
+	}
+	if st.WarmUpError != nil {
+		status.WarmUpError = st.WarmUpError.Error()
+	}
+	if !st.NextRun.IsZero() {
+		next := st.NextRun
+		status.NextRun = &next
+	}
+	return status
+}
+
+// controlHeader must be sent with every command. Browsers cannot add it to
+// cross-site form posts, so other web pages cannot drive the daemon.
+const controlHeader = "X-Gui-Sync"
+
+// controlHandler routes the control API endpoints for syncer, plus the
+// desktop GUI served at the root.
+func controlHandler(syncer *sync.Syncer) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", guiHandler())
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, i18n.T("control.method"), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]profileStatus{profileStatusOf("default", syncer.Status())})
+	})
+	mux.Handle("/sync", controlCommand(syncer.SyncNow))
+	mux.Handle("/pause", controlCommand(syncer.Pause))
+	mux.Handle("/resume", controlCommand(syncer.Resume))
+	return mux
+}
+
+// controlCommand serves a POST endpoint that calls action.
+func controlCommand(action func()) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, i18n.T("control.method"), http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get(controlHeader) == "" {
+			http.Error(w, fmt.Sprintf(i18n.T("control.missing_header"), controlHeader), http.StatusForbidden)
+			return
+		}
+		action()
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// startControlServer serves the control API on addr in the background and
+// reports whether it is up. Binding failures are logged and leave the
+// scheduler running without it.
+func startControlServer(addr string, syncer *sync.Syncer) bool {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Printf(i18n.T("control.unavailable"), addr, err)
+		return false
+	}
+
+	fmt.Printf(i18n.T("control.listening"), listener.Addr())
+	go func() {
+		if err := http.Serve(listener, controlHandler(syncer)); err != nil {
+			log.Printf(i18n.T("control.stopped"), err)
+		}
+	}()
+	return true
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// debugHandler serves the net/http/pprof profiles under /debug/pprof/. It
+// uses its own mux so the profiles never leak into the control API.
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// startDebugServer serves the profiling endpoints on addr in the
+// background. They have no authentication, so a non-loopback addr is
+// warned about; binding failures are logged and do not stop the daemon.
+func startDebugServer(addr string) {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			log.Printf(i18n.T("debug.exposed"), addr)
+		}
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Printf(i18n.T("debug.unavailable"), addr, err)
+		return
+	}
+
+	fmt.Printf(i18n.T("debug.listening"), listener.Addr())
+	go func() {
+		if err := http.Serve(listener, debugHandler()); err != nil {
+			log.Printf(i18n.T("debug.stopped"), err)
+		}
+	}()
+}
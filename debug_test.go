@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Suite: profiling endpoint
+func TestDebugHandler(t *testing.T) {
+	server := httptest.NewServer(debugHandler())
+	defer server.Close()
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/goroutine?debug=1"} {
+		resp, err := http.Get(server.URL + path)
+		if assert.NoError(t, err, path) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+// diffKinds maps the values of diff -only to the kinds of difference.
+var diffKinds = map[string]string{
+	"local":    sync.DiffOnlyLocal,
+	"remote":   sync.DiffOnlyRemote,
+	"modified": sync.DiffModified,
+}
+
+// runDiff implements `gui-sync diff`, listing the files only in the
+// directory, only in the bucket, or different in both, as the next sync run
+// would find them. With -manifest the directory is compared with the
+// bucket as a past run left it.
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	bucket := fs.String("bucket", "", i18n.T("cli.bucket"))
+	awsRegion := fs.String("region", "", i18n.T("cli.region"))
+	dir := fs.String("dir", "", i18n.T("diff.dir"))
+	prefix := fs.String("prefix", "", i18n.T("diff.prefix"))
+	jsonOutput := fs.Bool("json", false, i18n.T("diff.json"))
+	fast := fs.Bool("fast", false, i18n.T("flag.fast"))
+	cost := fs.Bool("cost", false, i18n.T("diff.cost"))
+	accelerate := fs.Bool("accelerate", false, i18n.T("flag.accelerate"))
+	manifest := fs.String("manifest", "", i18n.T("diff.manifest"))
+	var only stringList
+	fs.Var(&only, "only", i18n.T("diff.only"))
+	creds := credentialFlags(fs)
+	languageFlag(fs)
+	sel := selectionFlags(fs)
+	keyDate := keyDateFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), i18n.T("diff.usage"))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *bucket == "" || *awsRegion == "" || *dir == "" {
+		fs.Usage()
+		return i18n.Errorf("diff.required")
+	}
+	if *manifest != "" && *cost {
+		return i18n.Errorf("diff.manifest_cost")
+	}
+
+	shown := make(map[string]bool)
+	for _, value := range listValues(only) {
+		kind, ok := diffKinds[value]
+		if !ok {
+			return i18n.Errorf("diff.invalid_only", value)
+		}
+		shown[kind] = true
+	}
+
+	// The messages printed while loading the configuration would corrupt
+	// the JSON document, so they go to stderr.
+	stdout := os.Stdout
+	if *jsonOutput {
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = stdout }()
+	}
+
+	cfg := sync.Config{Bucket: *bucket, Region: *awsRegion, RootDir: *dir, Credentials: *creds, Fast: *fast, Accelerate: *accelerate}
+	sel.apply(&cfg)
+	cfg.KeyDate = *keyDate
+	syncer, err := sync.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var entries []sync.DiffEntry
+	var estimate sync.CostEstimate
+	switch {
+	case *cost:
+		entries, estimate, err = syncer.DiffCost(ctx, strings.TrimPrefix(*prefix, "/"))
+	case *manifest != "":
+		entries, err = syncer.DiffManifest(ctx, *manifest, strings.TrimPrefix(*prefix, "/"))
+	default:
+		entries, err = syncer.Diff(ctx, strings.TrimPrefix(*prefix, "/"))
+	}
+	if err != nil {
+		return err
+	}
+	if len(shown) > 0 {
+		filtered := entries[:0]
+		for _, e := range entries {
+			if shown[e.Change] {
+				filtered = append(filtered, e)
+			}
+		}
+		entries = filtered
+	}
+
+	if *jsonOutput {
+		if entries == nil {
+			entries = []sync.DiffEntry{}
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if *cost {
+			return enc.Encode(struct {
+				Entries []sync.DiffEntry  `json:"entries"`
+				Cost    sync.CostEstimate `json:"cost"`
+			}{entries, estimate})
+		}
+		return enc.Encode(entries)
+	}
+	printDiff(entries)
+	if *cost {
+		printCost(estimate)
+	}
+	return nil
+}
+
+// printDiff prints entries one per line, marked + (only local), - (only
+// remote) or ~ (modified), followed by the counts.
+func printDiff(entries []sync.DiffEntry) {
+	if len(entries) == 0 {
+		fmt.Println(i18n.T("diff.none"))
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, e := range entries {
+		counts[e.Change]++
+		switch e.Change {
+		case sync.DiffOnlyLocal:
+			fmt.Printf("+ %s\n", e.Key)
+		case sync.DiffOnlyRemote:
+			fmt.Printf("- %s\n", e.Key)
+		case sync.DiffModified:
+			fmt.Printf("~ %s\n", e.Key)
+		}
+	}
+	fmt.Printf(i18n.T("diff.summary"), counts[sync.DiffOnlyLocal], counts[sync.DiffOnlyRemote], counts[sync.DiffModified])
+}
+
+// printCost prints the requests and cost of the run estimated by -cost.
+func printCost(c sync.CostEstimate) {
+	fmt.Println(i18n.T("diff.cost_title"))
+	fmt.Printf(i18n.T("diff.cost_puts"), c.Puts, c.Multipart)
+	fmt.Printf(i18n.T("diff.cost_lists"), c.Lists)
+	fmt.Printf(i18n.T("diff.cost_deletes"), c.Deletes)
+	fmt.Printf(i18n.T("diff.cost_bytes"), float64(c.Bytes)/(1024*1024))
+	fmt.Printf(i18n.T("diff.cost_total"), c.RequestCost, c.TransferCost, c.Total())
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+// runDoctor implements `gui-sync doctor`, checking credentials and bucket
+// access and detecting upload requirements such as mandatory checksums.
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	bucket := fs.String("bucket", "", i18n.T("cli.bucket"))
+	awsRegion := fs.String("region", "", i18n.T("cli.region"))
+	creds := credentialFlags(fs)
+	languageFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), i18n.T("doctor.usage"))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *bucket == "" || *awsRegion == "" {
+		fs.Usage()
+		return i18n.Errorf("cli.bucket_region_required")
+	}
+
+	sess, err := sync.NewSession(*awsRegion, *creds, sync.RetryPolicy{}, sync.Timeouts{})
+	if err != nil {
+		return i18n.Errorf("s3.session", err)
+	}
+
+	fmt.Println(i18n.T("doctor.title"))
+
+	if _, err := sess.Config.Credentials.Get(); err != nil {
+		fmt.Printf(i18n.T("doctor.credentials_failed"), err)
+		return i18n.Errorf("doctor.no_credentials")
+	}
+	fmt.Println(i18n.T("doctor.credentials"))
+
+	syncer, err := sync.New(sync.Config{Bucket: *bucket, Client: s3.New(sess)})
+	if err != nil {
+		return err
+	}
+
+	if err := syncer.CheckBucket(); err != nil {
+		fmt.Printf(i18n.T("doctor.bucket_failed"), *bucket, err)
+		return i18n.Errorf("doctor.bucket_inaccessible")
+	}
+	fmt.Printf(i18n.T("doctor.bucket"), *bucket)
+
+	if versioning, err := syncer.BucketVersioning(); err != nil {
+		fmt.Printf("⚠ %v\n", err)
+	} else if versioning == s3.BucketVersioningStatusEnabled {
+		fmt.Println(i18n.T("doctor.versioning_on"))
+	} else {
+		fmt.Println(i18n.T("doctor.versioning_off"))
+	}
+
+	algorithm, err := syncer.ProbeChecksumRequirement()
+	if err != nil {
+		fmt.Printf(i18n.T("doctor.probe_failed"), err)
+		return i18n.Errorf("doctor.not_writable")
+	}
+	if algorithm == "" {
+		fmt.Println(i18n.T("doctor.no_checksum"))
+	} else {
+		fmt.Printf(i18n.T("doctor.checksum_required"), algorithm)
+	}
+
+	if err := syncer.SaveChecksumRequirement(algorithm); err != nil {
+		return err
+	}
+
+	fmt.Println(i18n.T("doctor.done"))
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setEcho turns the echo of the terminal on stdin on or off, for typing
+// secrets. It does nothing when stdin is not a terminal.
+func setEcho(on bool) {
+	mode := "echo"
+	if !on {
+		mode = "-echo"
+	}
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = os.Stdin
+	_ = cmd.Run()
+}
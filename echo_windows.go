@@ -0,0 +1,28 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procGetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("GetConsoleMode")
+	procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+)
+
+const enableEchoInput = 0x0004
+
+// setEcho turns the echo of the console on stdin on or off, for typing
+// secrets. It does nothing when stdin is not a console.
+func setEcho(on bool) {
+	var mode uint32
+	if ret, _, _ := procGetConsoleMode.Call(uintptr(syscall.Stdin), uintptr(unsafe.Pointer(&mode))); ret == 0 {
+		return
+	}
+	if on {
+		mode |= enableEchoInput
+	} else {
+		mode &^= enableEchoInput
+	}
+	procSetConsoleMode.Call(uintptr(syscall.Stdin), uintptr(mode))
+}
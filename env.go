@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// envPrefix starts the environment variables standing in for options not
+// given on the command line: GUISYNC_BUCKET for --bucket,
+// GUISYNC_EXCLUDE_FROM for --exclude-from and so on.
+const envPrefix = "GUISYNC_"
+
+// envAliases lists further variables accepted for some options.
+var envAliases = map[string][]string{
+	"schedule": {"GUISYNC_CRON"},
+}
+
+// envNames returns the variables read for the option name.
+func envNames(name string) []string {
+	return append([]string{envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))}, envAliases[name]...)
+}
+
+// parseFlags parses args into fs and then sets the options still unset
+// from the environment, so the command line takes precedence over it and
+// it over the saved settings of the wizard.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return applyEnv(fs)
+}
+
+func applyEnv(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || given[f.Name] {
+			return
+		}
+		for _, name := range envNames(f.Name) {
+			value := os.Getenv(name)
+			if value == "" {
+				continue
+			}
+			// Repeatable options take one value per line.
+			values := []string{value}
+			if _, ok := f.Value.(*stringList); ok {
+				values = strings.Split(strings.TrimSpace(value), "\n")
+			}
+			for _, v := range values {
+				if setErr := fs.Set(f.Name, strings.TrimSpace(v)); setErr != nil {
+					err = i18n.Errorf("env.invalid", name, setErr)
+					return
+				}
+			}
+			return
+		}
+	})
+	return err
+}
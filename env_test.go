@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: environment variables
+func TestEnvNames(t *testing.T) {
+	assert.Equal(t, []string{"GUISYNC_BUCKET"}, envNames("bucket"))
+	assert.Equal(t, []string{"GUISYNC_EXCLUDE_FROM"}, envNames("exclude-from"))
+	assert.Equal(t, []string{"GUISYNC_SCHEDULE", "GUISYNC_CRON"}, envNames("schedule"))
+}
+
+func TestParseFlagsFromEnv(t *testing.T) {
+	newFlags := func() (*flag.FlagSet, *string, *string, *string, *bool, *time.Duration, *stringList) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		bucket := fs.String("bucket", "", "")
+		region := fs.String("region", "", "")
+		schedule := fs.String("schedule", "", "")
+		fast := fs.Bool("fast", false, "")
+		jitter := fs.Duration("jitter", 0, "")
+		var windows stringList
+		fs.Var(&windows, "window", "")
+		return fs, bucket, region, schedule, fast, jitter, &windows
+	}
+
+	t.Setenv("GUISYNC_BUCKET", "from-env")
+	t.Setenv("GUISYNC_REGION", "sa-east-1")
+	t.Setenv("GUISYNC_CRON", "@hourly")
+	t.Setenv("GUISYNC_FAST", "true")
+	t.Setenv("GUISYNC_JITTER", "")
+	t.Setenv("GUISYNC_WINDOW", "22:00-06:00\nsat,sun\n")
+
+	fs, bucket, region, schedule, fast, jitter, windows := newFlags()
+	require.NoError(t, parseFlags(fs, []string{"--bucket", "from-flag"}))
+	assert.Equal(t, "from-flag", *bucket, "flags take precedence")
+	assert.Equal(t, "sa-east-1", *region)
+	assert.Equal(t, "@hourly", *schedule)
+	assert.True(t, *fast)
+	assert.Zero(t, *jitter, "empty variables are ignored")
+	assert.Equal(t, stringList{"22:00-06:00", "sat,sun"}, *windows, "repeatable options take one value per line")
+
+	t.Setenv("GUISYNC_JITTER", "soon")
+	fs, _, _, _, _, _, _ = newFlags()
+	err := parseFlags(fs, nil)
+	assert.Equal(t, "env.invalid", i18n.ID(err))
+	assert.Contains(t, err.Error(), "GUISYNC_JITTER")
+}
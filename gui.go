@@ -0,0 +1,53 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"runtime"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// guiPage is the desktop GUI: a single page polling the control API and
+// driving it with the "Sincronizar agora", "Pausar" and "Configurações"
+// actions.
+//
+//go:embed gui.html
+var guiPage []byte
+
+func guiHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(guiPage)
+	})
+}
+
+// openGUI opens the GUI served by the control API in the default browser.
+func openGUI(addr string) {
+	url := "http://" + addr + "/"
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		cmd = exec.Command("open", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	if err := cmd.Start(); err != nil {
+		log.Printf(i18n.T("gui.browser_failed"), err)
+		fmt.Printf(i18n.T("gui.open_manually"), url)
+		return
+	}
+	go cmd.Wait()
+	fmt.Printf(i18n.T("gui.opened"), url)
+}
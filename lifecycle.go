@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+// runLifecycle implements `gui-sync lifecycle`, which shows, applies or
+// removes the lifecycle rule of gui-sync on the bucket: transitions to
+// cheaper storage classes and the expiration of old versions.
+func runLifecycle(args []string) error {
+	fs := flag.NewFlagSet("lifecycle", flag.ContinueOnError)
+	bucket := fs.String("bucket", "", i18n.T("cli.bucket"))
+	awsRegion := fs.String("region", "", i18n.T("cli.region"))
+	creds := credentialFlags(fs)
+	languageFlag(fs)
+	var policy sync.LifecyclePolicy
+	fs.StringVar(&policy.Prefix, "prefix", "", i18n.T("lifecycle.prefix"))
+	fs.IntVar(&policy.TransitionIA, "ia", 0, i18n.T("lifecycle.ia"))
+	fs.IntVar(&policy.TransitionGlacier, "glacier", 0, i18n.T("lifecycle.glacier"))
+	fs.IntVar(&policy.TransitionDeepArchive, "deep-archive", 0, i18n.T("lifecycle.deep_archive"))
+	fs.IntVar(&policy.ExpireNoncurrent, "expire-noncurrent", 0, i18n.T("lifecycle.expire_noncurrent"))
+	remove := fs.Bool("remove", false, i18n.T("lifecycle.remove"))
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), i18n.T("lifecycle.usage"))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *bucket == "" || *awsRegion == "" {
+		fs.Usage()
+		return i18n.Errorf("lifecycle.required")
+	}
+	if *remove && !policy.Empty() {
+		return i18n.Errorf("lifecycle.remove_with_policy")
+	}
+
+	syncer, err := sync.New(sync.Config{Bucket: *bucket, Region: *awsRegion, Credentials: *creds})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *remove:
+		if err := syncer.ApplyLifecycle(sync.LifecyclePolicy{}); err != nil {
+			return err
+		}
+		fmt.Println(i18n.T("lifecycle.removed"))
+		return nil
+	case !policy.Empty():
+		if err := syncer.ApplyLifecycle(policy); err != nil {
+			return err
+		}
+		fmt.Println(i18n.T("lifecycle.applied"))
+	}
+
+	current, others, err := syncer.Lifecycle()
+	if err != nil {
+		return err
+	}
+	printLifecycle(current, others)
+	return nil
+}
+
+// printLifecycle describes the lifecycle rule of gui-sync.
+func printLifecycle(p *sync.LifecyclePolicy, others int) {
+	if p == nil {
+		fmt.Println(i18n.T("lifecycle.none"))
+	} else {
+		prefix := p.Prefix
+		if prefix == "" {
+			prefix = i18n.T("lifecycle.whole_bucket")
+		}
+		fmt.Printf(i18n.T("lifecycle.title"), prefix)
+		for _, step := range []struct {
+			days  int
+			class string
+		}{{p.TransitionIA, "STANDARD_IA"}, {p.TransitionGlacier, "GLACIER"}, {p.TransitionDeepArchive, "DEEP_ARCHIVE"}} {
+			if step.days > 0 {
+				fmt.Printf(i18n.T("lifecycle.transition"), step.days, step.class)
+			}
+		}
+		if p.ExpireNoncurrent > 0 {
+			fmt.Printf(i18n.T("lifecycle.expiration"), p.ExpireNoncurrent)
+		}
+	}
+	if others > 0 {
+		fmt.Printf(i18n.T("lifecycle.others"), others)
+	}
+}
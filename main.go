@@ -2,458 +2,764 @@ package main
 
 import (
 	"bufio"
-	"crypto/md5"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"runtime"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/request"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3iface"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/robfig/cron/v3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
 )
 
 var (
-	bucketName     = ""
-	region         = ""
-	rootDir        = ""
-	ignorePatterns []string
+	bucketFlag       *string
+	regionFlag       *string
+	dirFlag          *string
+	scheduleFlag     *string
+	everyFlag        *time.Duration
+	credentials      *sync.Credentials
+	filesFromFlag    *string
+	excludeFromFlag  *string
+	gitignoreFlag    *bool
+	oneFileSystem    *bool
+	rulesFlag        *string
+	lowPriorityBW    *string
+	hashFlag         *string
+	sanitizeKeys     *bool
+	keyTemplate      *string
+	fastFlag         *bool
+	scanCacheFlag    *time.Duration
+	journalFlag      *bool
+	headWorkers      *int
+	dedupFlag        *bool
+	detectMoves      *bool
+	hardLinksFlag    *bool
+	xattrsFlag       *bool
+	deltaFlag        *bool
+	verifyUploads    *bool
+	heartbeatEnabled *bool
+	heartbeatEvery   *time.Duration
+	manifestEnabled  *bool
+	objectLockMode   *string
+	objectLockDays   *int
+	massChange       *int
+	massChangePause  *bool
+	deleteFlag       *string
+	maxFilesFlag     *int
+	maxTotalSizeFlag *string
+	metricsNamespace *string
+	healthcheckURL   *string
+	abortStaleAfter  *time.Duration
+	retryAttempts    *int
+	retryBaseDelay   *time.Duration
+	retryMaxDelay    *time.Duration
+	retryOn          *string
+	retryLog         *bool
+	metadataTimeout  *time.Duration
+	transferTimeout  *time.Duration
+	accelerate       *bool
+	dualStack        *bool
+	createBucket     *bool
+	preflight        *bool
+	preflightBW      *string
+	parallelReplicas *bool
+	controlAddr      *string
+	debugAddr        *string
+	reportDir        *string
+	reportFormat     *string
+	reportToBucket   *bool
+	warmUp           *time.Duration
+	preHook          *string
+	postHook         *string
+	snapshotFlag     *string
+	snapshotRelease  *string
+	deferOnBattery   *bool
+	deferOnMetered   *bool
+	pauseOutsideWin  *bool
+	jitter           *time.Duration
+	catchUp          *bool
+	queueOverlapping *bool
+	onceFlag         *bool
+	setupFlag        *bool
+	configName       *string
+	forceLock        *bool
+	guiEnabled       *bool
+
+	notifyAlways  stringList
+	notifyFailure stringList
+	archiveDirs   stringList
+	presets       stringList
+	keepRemote    stringList
+	replicaSpecs  stringList
+	windowSpecs   stringList
+	blackoutSpecs stringList
+
+	// faultInject is a hidden testing aid; see sync.ParseFaults for the spec.
+	faultInject *string
 )
 
-const (
-	multipartThreshold = 100 * 1024 * 1024
-	partSize           = 50 * 1024 * 1024
-	uploadWorkers      = 5
-	partConcurrency    = 3
-)
+// hiddenFlags are accepted but left out of -h.
+var hiddenFlags = map[string]bool{"fault-inject": true}
 
-func main() {
-	fmt.Println("=== Sincronizador S3 ===")
+func init() {
+	flag.Usage = func() { printUsage(flag.CommandLine) }
+}
 
-	execPath, err := os.Executable()
-	if err == nil {
-		execName := filepath.Base(execPath)
-		ignorePatterns = append(ignorePatterns, execName)
-		fmt.Printf("✓ Executável será ignorado: %s\n\n", execName)
-	}
+// defineFlags registers the options of the scheduler on fs. main calls it
+// once the language is selected, so their help texts are in it.
+func defineFlags(fs *flag.FlagSet) {
+	bucketFlag = fs.String("bucket", "", i18n.T("flag.bucket"))
+	regionFlag = fs.String("region", "", i18n.T("flag.region"))
+	dirFlag = fs.String("dir", "", i18n.T("flag.dir"))
+	scheduleFlag = fs.String("schedule", "", i18n.T("flag.schedule"))
+	everyFlag = fs.Duration("every", 0, i18n.T("flag.every"))
+	credentials = credentialFlags(fs)
+	filesFromFlag = fs.String("files-from", "", i18n.T("flag.files_from"))
+	excludeFromFlag = fs.String("exclude-from", "", i18n.T("flag.exclude_from"))
+	gitignoreFlag = fs.Bool("gitignore", false, i18n.T("flag.gitignore"))
+	oneFileSystem = fs.Bool("one-file-system", false, i18n.T("flag.one_file_system"))
+	rulesFlag = fs.String("rules", "", i18n.T("flag.rules"))
+	lowPriorityBW = fs.String("low-priority-bandwidth", "", i18n.T("flag.low_priority_bandwidth"))
+	hashFlag = fs.String("hash", sync.HashMD5, i18n.T("flag.hash"))
+	sanitizeKeys = fs.Bool("sanitize-keys", false, i18n.T("flag.sanitize_keys"))
+	keyTemplate = fs.String("key-template", "", i18n.T("flag.key_template"))
+	fastFlag = fs.Bool("fast", false, i18n.T("flag.fast"))
+	scanCacheFlag = fs.Duration("scan-cache", 0, i18n.T("flag.scan_cache"))
+	journalFlag = fs.Bool("journal", false, i18n.T("flag.journal"))
+	headWorkers = fs.Int("head-workers", 16, i18n.T("flag.head_workers"))
+	dedupFlag = fs.Bool("dedup", false, i18n.T("flag.dedup"))
+	detectMoves = fs.Bool("detect-moves", false, i18n.T("flag.detect_moves"))
+	hardLinksFlag = fs.Bool("hard-links", false, i18n.T("flag.hard_links"))
+	xattrsFlag = fs.Bool("xattrs", false, i18n.T("flag.xattrs"))
+	deltaFlag = fs.Bool("delta", false, i18n.T("flag.delta"))
+	verifyUploads = fs.Bool("verify-uploads", false, i18n.T("flag.verify_uploads"))
+	heartbeatEnabled = fs.Bool("heartbeat", false, i18n.T("flag.heartbeat"))
+	heartbeatEvery = fs.Duration("heartbeat-interval", time.Minute, i18n.T("flag.heartbeat_interval"))
+	manifestEnabled = fs.Bool("manifest", false, i18n.T("flag.manifest"))
+	objectLockMode = fs.String("object-lock-mode", "", i18n.T("flag.object_lock_mode"))
+	objectLockDays = fs.Int("object-lock-days", 0, i18n.T("flag.object_lock_days"))
+	massChange = fs.Int("mass-change", 0, i18n.T("flag.mass_change"))
+	massChangePause = fs.Bool("mass-change-pause", false, i18n.T("flag.mass_change_pause"))
+	deleteFlag = fs.String("delete", "immediate", i18n.T("flag.delete"))
+	maxFilesFlag = fs.Int("max-files", 0, i18n.T("flag.max_files"))
+	maxTotalSizeFlag = fs.String("max-total-size", "", i18n.T("flag.max_total_size"))
+	metricsNamespace = fs.String("metrics-namespace", "", i18n.T("flag.metrics_namespace"))
+	healthcheckURL = fs.String("healthcheck-url", "", i18n.T("flag.healthcheck_url"))
+	abortStaleAfter = fs.Duration("abort-stale-after", 7*24*time.Hour, i18n.T("flag.abort_stale_after"))
+	retryAttempts = fs.Int("retry-max-attempts", 11, i18n.T("flag.retry_max_attempts"))
+	retryBaseDelay = fs.Duration("retry-base-delay", 200*time.Millisecond, i18n.T("flag.retry_base_delay"))
+	retryMaxDelay = fs.Duration("retry-max-delay", 30*time.Second, i18n.T("flag.retry_max_delay"))
+	retryOn = fs.String("retry-on", strings.Join(sync.RetryClasses(), ","), fmt.Sprintf(i18n.T("flag.retry_on"), strings.Join(sync.RetryClasses(), ", ")))
+	retryLog = fs.Bool("retry-log", false, i18n.T("flag.retry_log"))
+	metadataTimeout = fs.Duration("metadata-timeout", 30*time.Second, i18n.T("flag.metadata_timeout"))
+	transferTimeout = fs.Duration("transfer-timeout", 30*time.Minute, i18n.T("flag.transfer_timeout"))
+	accelerate = fs.Bool("accelerate", false, i18n.T("flag.accelerate"))
+	dualStack = fs.Bool("dual-stack", false, i18n.T("flag.dual_stack"))
+	createBucket = fs.Bool("create-bucket", false, i18n.T("flag.create_bucket"))
+	preflight = fs.Bool("preflight", false, i18n.T("flag.preflight"))
+	preflightBW = fs.String("preflight-bandwidth", "", i18n.T("flag.preflight_bandwidth"))
+	parallelReplicas = fs.Bool("parallel-replicas", false, i18n.T("flag.parallel_replicas"))
+	controlAddr = fs.String("control-addr", defaultControlAddr, i18n.T("flag.control_addr"))
+	debugAddr = fs.String("debug-addr", "", i18n.T("flag.debug_addr"))
+	reportDir = fs.String("report-dir", "", i18n.T("flag.report_dir"))
+	reportFormat = fs.String("report-format", "json", i18n.T("flag.report_format"))
+	reportToBucket = fs.Bool("report-to-bucket", false, i18n.T("flag.report_to_bucket"))
+	warmUp = fs.Duration("warm-up", 0, i18n.T("flag.warm_up"))
+	preHook = fs.String("pre-hook", "", i18n.T("flag.pre_hook"))
+	postHook = fs.String("post-hook", "", i18n.T("flag.post_hook"))
+	snapshotFlag = fs.String("snapshot", "", i18n.T("flag.snapshot"))
+	snapshotRelease = fs.String("snapshot-release", "", i18n.T("flag.snapshot_release"))
+	deferOnBattery = fs.Bool("defer-on-battery", false, i18n.T("flag.defer_on_battery"))
+	deferOnMetered = fs.Bool("defer-on-metered", false, i18n.T("flag.defer_on_metered"))
+	pauseOutsideWin = fs.Bool("pause-outside-window", false, i18n.T("flag.pause_outside_window"))
+	jitter = fs.Duration("jitter", 0, i18n.T("flag.jitter"))
+	catchUp = fs.Bool("catch-up", false, i18n.T("flag.catch_up"))
+	queueOverlapping = fs.Bool("queue-overlapping", false, i18n.T("flag.queue_overlapping"))
+	onceFlag = fs.Bool("once", false, i18n.T("flag.once"))
+	setupFlag = fs.Bool("setup", false, i18n.T("flag.setup"))
+	configName = fs.String("config", "", i18n.T("flag.config"))
+	forceLock = fs.Bool("force", false, i18n.T("flag.force"))
+	guiEnabled = fs.Bool("gui", false, i18n.T("flag.gui"))
+
+	fs.Var(&notifyAlways, "notify", i18n.T("flag.notify"))
+	fs.Var(&notifyFailure, "notify-on-failure", i18n.T("flag.notify_on_failure"))
+	fs.Var(&presets, "exclude-preset", fmt.Sprintf(i18n.T("flag.exclude_preset"), strings.Join(sync.PresetNames(), ", ")))
+	fs.Var(&keepRemote, "keep-remote", i18n.T("flag.keep_remote"))
+	fs.Var(&archiveDirs, "archive", i18n.T("flag.archive"))
+	fs.Var(&replicaSpecs, "replica", i18n.T("flag.replica"))
+	fs.Var(&windowSpecs, "window", i18n.T("flag.window"))
+	fs.Var(&blackoutSpecs, "blackout", i18n.T("flag.blackout"))
+
+	faultInject = fs.String("fault-inject", "", i18n.T("flag.fault_inject"))
+	languageFlag(fs)
+}
 
-	reader := bufio.NewReader(os.Stdin)
+// printUsage prints the help of fs, leaving out hiddenFlags.
+func printUsage(fs *flag.FlagSet) {
+	fmt.Fprintf(fs.Output(), i18n.T("main.usage"), fs.Name())
+	visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	visible.SetOutput(fs.Output())
+	fs.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	visible.PrintDefaults()
+}
 
-	fmt.Print("Digite o nome do bucket S3: ")
-	bucketName, _ = reader.ReadString('\n')
-	bucketName = strings.TrimSpace(bucketName)
-	if bucketName == "" {
-		log.Fatalln("Nome do bucket não pode estar vazio.")
-	}
+func main() {
+	selectLanguage(os.Args[1:])
+	defineFlags(flag.CommandLine)
 
-	fmt.Print("Digite a região AWS (ex: us-east-1): ")
-	region, _ = reader.ReadString('\n')
-	region = strings.TrimSpace(region)
-	if region == "" {
-		log.Fatalln("Região não pode estar vazia.")
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatalf("❌ %v", err)
+			}
+			return
+		}
 	}
 
-	fmt.Print("Digite o caminho do diretório a ser sincronizado: ")
-	rootDir, _ = reader.ReadString('\n')
-	rootDir = strings.TrimSpace(rootDir)
-	if rootDir == "" {
-		log.Fatalln("Diretório não pode estar vazio.")
+	if err := parseFlags(flag.CommandLine, os.Args[1:]); err != nil {
+		log.Fatalf("❌ %v", err)
 	}
 
-	if _, err := os.Stat(rootDir); os.IsNotExist(err) {
-		log.Fatalf("Diretório não existe: %s", rootDir)
+	var faults *sync.Faults
+	if *faultInject != "" {
+		f, err := sync.ParseFaults(*faultInject)
+		if err != nil {
+			log.Fatalf("❌ --fault-inject: %v", err)
+		}
+		faults = &f
 	}
 
-	fmt.Print("Digite o agendamento cron (ex: */5 * * * * para cada 5 minutos): ")
-	cronSchedule, _ := reader.ReadString('\n')
-	cronSchedule = strings.TrimSpace(cronSchedule)
-	if cronSchedule == "" {
-		log.Fatalln("Agendamento cron não pode estar vazio.")
+	var lowPriorityBandwidth int64
+	if *lowPriorityBW != "" {
+		rate, err := sync.ParseBandwidth(*lowPriorityBW)
+		if err != nil {
+			log.Fatalf("❌ --low-priority-bandwidth: %v", err)
+		}
+		lowPriorityBandwidth = rate
 	}
 
-	fmt.Println("\n--- Configurações ---")
-	fmt.Printf("Bucket S3: %s\n", bucketName)
-	fmt.Printf("Região AWS: %s\n", region)
-	fmt.Printf("Diretório: %s\n", rootDir)
-	fmt.Printf("Sincronização: %s\n", cronSchedule)
-	fmt.Println("---------------------")
-
-	err = loadSyncIgnoreFile()
-	if err != nil {
-		log.Fatalf("❌ Falha ao carregar arquivo .syncignore: %v", err)
-	}
-
-	fmt.Println("Conectando ao AWS S3...")
-
-	sess, err := session.NewSession(&aws.Config{
-		Region:     aws.String(region),
-		MaxRetries: aws.Int(10),
-		HTTPClient: &http.Client{
-			Timeout: 300 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 100,
-				IdleConnTimeout:     90 * time.Second,
-				DisableKeepAlives:   false,
-			},
-		},
-	})
+	deletePolicy, err := sync.ParseDeletePolicy(*deleteFlag)
 	if err != nil {
-		log.Fatalf("❌ Falha ao criar sessão AWS: %v", err)
+		log.Fatalf("❌ --delete: %v", err)
 	}
 
-	fmt.Println("✓ Conectado ao AWS S3")
-
-	sess.Handlers.Retry.PushBack(func(r *request.Request) {
-		if r.Error != nil && r.RetryCount > 3 {
-			log.Printf("⚠ Tentativa %d para %s", r.RetryCount, r.Operation.Name)
+	var maxTotalSize int64
+	if *maxTotalSizeFlag != "" {
+		size, err := sync.ParseSize(*maxTotalSizeFlag)
+		if err != nil {
+			log.Fatalf("❌ --max-total-size: %v", err)
 		}
-	})
-
-	s3Client := s3.New(sess)
-
-	startScheduler(s3Client, sess, cronSchedule)
-}
-
-func startScheduler(s3Client s3iface.S3API, sess *session.Session, cronSchedule string) {
-	fmt.Println("🔄 Iniciando primeira sincronização...")
-	err := syncDirectoryWithS3(s3Client, sess, rootDir)
-	if err != nil {
-		log.Printf("❌ Sincronização falhou: %v", err)
-	} else {
-		fmt.Println("✓ Sincronização inicial concluída")
+		maxTotalSize = size
 	}
 
-	c := cron.New()
-	_, err = c.AddFunc(cronSchedule, func() {
-		fmt.Printf("\n🔄 [%s] Sincronizando...\n", time.Now().Format("15:04:05"))
-		err := syncDirectoryWithS3(s3Client, sess, rootDir)
+	var preflightBandwidth int64
+	if *preflightBW != "" {
+		rate, err := sync.ParseBandwidth(*preflightBW)
 		if err != nil {
-			log.Printf("❌ Sincronização falhou: %v", err)
-		} else {
-			fmt.Printf("✓ [%s] Sincronização concluída\n", time.Now().Format("15:04:05"))
+			log.Fatalf("❌ --preflight-bandwidth: %v", err)
 		}
-	})
-	if err != nil {
-		log.Fatalf("❌ Agendamento cron inválido: %v", err)
+		preflightBandwidth = rate
 	}
 
-	fmt.Printf("⏰ Agendador ativo (executa %s)\n", cronSchedule)
-	fmt.Println("Pressione Ctrl+C para parar")
-	c.Start()
-
-	select {}
-}
-
-func syncDirectoryWithS3(s3Client s3iface.S3API, sess *session.Session, root string) error {
-	err := uploadDirectoryToS3(s3Client, sess, root)
-	if err != nil {
-		return err
+	retry := sync.RetryPolicy{
+		MaxAttempts: *retryAttempts,
+		BaseDelay:   *retryBaseDelay,
+		MaxDelay:    *retryMaxDelay,
+		Classes:     listValues([]string{*retryOn}),
+		Log:         *retryLog,
 	}
 
-	return deleteRemovedFilesFromS3(s3Client, root)
-}
-
-func uploadDirectoryToS3(s3Client s3iface.S3API, sess *session.Session, root string) error {
-	type uploadTask struct {
-		path     string
-		relPath  string
-		s3Key    string
-		fileSize int64
-	}
-
-	tasks := make(chan uploadTask, 100)
-	var wg sync.WaitGroup
-	var uploadErrors []error
-	var errorMutex sync.Mutex
-
-	// Start worker goroutines
-	for i := 0; i < uploadWorkers; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			for task := range tasks {
-				size, err := uploadFileS3(s3Client, sess, task.s3Key, task.path, task.fileSize)
-				if err != nil {
-					errorMutex.Lock()
-					uploadErrors = append(uploadErrors, fmt.Errorf("falha ao fazer upload de %s: %v", task.path, err))
-					errorMutex.Unlock()
-					log.Printf("  ❌ %s - %v", task.relPath, err)
-				} else {
-					fmt.Printf("  ✓ %s (%d bytes)\n", task.relPath, size)
-				}
+	var notifiers []sync.Notifier
+	for _, specs := range []struct {
+		list          stringList
+		onlyOnFailure bool
+	}{{notifyAlways, false}, {notifyFailure, true}} {
+		for _, spec := range specs.list {
+			n, err := sync.ParseNotifier(spec, specs.onlyOnFailure)
+			if err != nil {
+				log.Fatalf("❌ %v", err)
 			}
-		}(i)
+			notifiers = append(notifiers, n)
+		}
 	}
 
-	// Walk directory and queue upload tasks
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+	var replicas []sync.Replica
+	for _, spec := range replicaSpecs {
+		r, err := sync.ParseReplica(spec)
 		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
+			log.Fatalf("❌ %v", err)
 		}
+		replicas = append(replicas, r)
+	}
 
-		relPath, err := filepath.Rel(root, path)
-		if err != nil {
-			return err
-		}
+	windows := parseWindows("--window", windowSpecs)
+	blackouts := parseWindows("--blackout", blackoutSpecs)
 
-		if runtime.GOOS == "windows" {
-			relPath = strings.ReplaceAll(relPath, "\\", "/")
-		}
+	if err := checkConfigName(*configName); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
 
-		if shouldIgnore(relPath) {
-			return nil
-		}
+	fmt.Println(i18n.T("main.title"))
 
-		s3Key := relPath
+	var ignore []string
+	execPath, err := os.Executable()
+	if err == nil {
+		execName := filepath.Base(execPath)
+		ignore = append(ignore, execName)
+		fmt.Printf(i18n.T("main.exe_ignored"), execName)
+	}
 
-		shouldUpload, err := fileChangedOnS3(s3Client, s3Key, path)
-		if err != nil {
-			return err
+	setupFile, err := setupPath(*configName)
+	var saved setup
+	if err == nil {
+		if saved, err = loadSetup(setupFile); err != nil {
+			log.Printf("⚠ %v", err)
 		}
-
-		if shouldUpload {
-			tasks <- uploadTask{
-				path:     path,
-				relPath:  relPath,
-				s3Key:    s3Key,
-				fileSize: info.Size(),
-			}
-		} else {
-			fmt.Printf("  ⏭ %s (sincronizado)\n", relPath)
+	}
+	// With --setup every answer is asked again, the saved one offered as
+	// the default.
+	given := saved
+	if *setupFlag {
+		given = setup{}
+	}
+	timeouts := sync.Timeouts{Metadata: *metadataTimeout, Transfer: *transferTimeout}
+	w := &wizard{reader: bufio.NewReader(os.Stdin)}
+
+	bucketName := w.value(orDefault(*bucketFlag, given.Bucket), saved.Bucket, i18n.T("cli.prompt_bucket"), i18n.T("cli.empty_bucket"), anyAnswer)
+	region := w.value(orDefault(*regionFlag, given.Region), orDefault(saved.Region, defaultRegion()), i18n.T("cli.prompt_region"), i18n.T("cli.empty_region"), anyAnswer)
+	credentials.KeyStore = orDefault(credentials.KeyStore, saved.KeyStore)
+	if credentials.KeyStore != "" {
+		w.accessKeys(*credentials, region, *setupFlag)
+	}
+	for w.asked {
+		err := checkBucket(sync.Config{
+			Bucket:       bucketName,
+			Region:       region,
+			Credentials:  *credentials,
+			Retry:        retry,
+			Timeouts:     timeouts,
+			Accelerate:   *accelerate,
+			DualStack:    *dualStack,
+			CreateBucket: *createBucket,
+		})
+		if err == nil {
+			break
 		}
-		return nil
-	})
-
-	close(tasks)
-	wg.Wait()
+		w.retry(err)
+		bucketName = w.ask(bucketName, i18n.T("cli.prompt_bucket"), i18n.T("cli.empty_bucket"), anyAnswer)
+		region = w.ask(region, i18n.T("cli.prompt_region"), i18n.T("cli.empty_region"), anyAnswer)
+	}
+	rootDir := w.value(orDefault(*dirFlag, given.Dir), orDefault(saved.Dir, "."), i18n.T("cli.prompt_dir"), i18n.T("cli.empty_dir"), checkDir)
 
+	cronSchedule, err := scheduleFrom(*scheduleFlag, *everyFlag)
 	if err != nil {
-		return err
+		log.Fatalf("❌ %v", err)
 	}
-
-	if len(uploadErrors) > 0 {
-		return fmt.Errorf("erros de upload ocorreram: %v", uploadErrors)
+	var nextRuns []time.Time
+	if !*onceFlag {
+		cronSchedule = w.value(orDefault(cronSchedule, given.Schedule), orDefault(saved.Schedule, "@hourly"), i18n.T("cli.prompt_schedule"), i18n.T("cli.empty_schedule"), checkSchedule)
+		nextRuns, _ = sync.NextRuns(cronSchedule, time.Now(), 3)
 	}
 
-	return nil
-}
-
-func deleteRemovedFilesFromS3(s3Client s3iface.S3API, root string) error {
-	var localFiles = make(map[string]bool)
-
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	if w.asked && setupFile != "" {
+		answers := setup{Bucket: bucketName, Region: region, Dir: rootDir, Schedule: orDefault(cronSchedule, saved.Schedule), KeyStore: credentials.KeyStore}
+		if abs, err := filepath.Abs(rootDir); err == nil {
+			answers.Dir = abs
 		}
-		if !info.IsDir() {
-			relPath, err := filepath.Rel(root, path)
-			if err != nil {
-				return err
-			}
-			if runtime.GOOS == "windows" {
-				relPath = strings.ReplaceAll(relPath, "\\", "/")
-			}
-			localFiles[relPath] = true
+		if err := saveSetup(setupFile, answers); err != nil {
+			log.Printf("⚠ %v", err)
+		} else {
+			fmt.Printf(i18n.T("wizard.saved"), setupFile)
 		}
-		return nil
-	})
-	if err != nil {
-		return err
 	}
 
-	err = s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
-		Bucket: aws.String(bucketName),
-	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
-		for _, obj := range page.Contents {
-			if _, exists := localFiles[*obj.Key]; !exists {
-				_, err := s3Client.DeleteObject(&s3.DeleteObjectInput{
-					Bucket: aws.String(bucketName),
-					Key:    obj.Key,
-				})
-				if err == nil {
-					fmt.Printf("  🗑 %s (removido do S3)\n", *obj.Key)
-				}
-			}
-		}
-		return true
+	fmt.Println(i18n.T("main.settings"))
+	if *configName != "" {
+		fmt.Printf(i18n.T("main.config"), *configName)
+	}
+	fmt.Printf(i18n.T("main.bucket"), bucketName)
+	fmt.Printf(i18n.T("main.region"), region)
+	fmt.Printf(i18n.T("main.dir"), rootDir)
+	if *onceFlag {
+		fmt.Println(i18n.T("main.once"))
+	} else {
+		fmt.Printf(i18n.T("main.schedule"), cronSchedule)
+		fmt.Printf(i18n.T("main.next_runs"), formatRuns(nextRuns))
+	}
+	fmt.Println("---------------------")
+
+	if *filesFromFlag != "" {
+		fmt.Printf(i18n.T("main.files_from"), *filesFromFlag)
+	}
+
+	if *fastFlag {
+		fmt.Println(i18n.T("main.fast"))
+	}
+
+	fmt.Println(i18n.T("main.connecting"))
+
+	syncer, err := sync.New(sync.Config{
+		Bucket:               bucketName,
+		Region:               region,
+		RootDir:              rootDir,
+		Schedule:             cronSchedule,
+		Credentials:          *credentials,
+		Ignore:               ignore,
+		ExcludeFrom:          *excludeFromFlag,
+		GitIgnore:            *gitignoreFlag,
+		ExcludePresets:       listValues(presets),
+		FilesFrom:            *filesFromFlag,
+		OneFileSystem:        *oneFileSystem,
+		RulesFile:            *rulesFlag,
+		KeepRemote:           listValues(keepRemote),
+		LowPriorityBandwidth: lowPriorityBandwidth,
+		ArchiveDirs:          archiveDirs,
+		Fast:                 *fastFlag,
+		Delta:                *deltaFlag,
+		ScanCache:            *scanCacheFlag,
+		Journal:              *journalFlag,
+		HeadWorkers:          *headWorkers,
+		Dedup:                *dedupFlag,
+		DetectMoves:          *detectMoves,
+		HardLinks:            *hardLinksFlag,
+		Xattrs:               *xattrsFlag,
+		VerifyUploads:        *verifyUploads,
+		HashAlgorithm:        *hashFlag,
+		SanitizeKeys:         *sanitizeKeys,
+		KeyTemplate:          *keyTemplate,
+		Heartbeat:            *heartbeatEnabled,
+		HeartbeatInterval:    *heartbeatEvery,
+		Manifest:             *manifestEnabled,
+		ObjectLockMode:       *objectLockMode,
+		ObjectLockDays:       *objectLockDays,
+		MassChangePercent:    *massChange,
+		MassChangePause:      *massChangePause,
+		Delete:               deletePolicy,
+		MaxFiles:             *maxFilesFlag,
+		MaxTotalSize:         maxTotalSize,
+		MetricsNamespace:     *metricsNamespace,
+		AbortStaleAfter:      *abortStaleAfter,
+		Retry:                retry,
+		Timeouts:             timeouts,
+		Accelerate:           *accelerate,
+		DualStack:            *dualStack,
+		CreateBucket:         *createBucket,
+		Replicas:             replicas,
+		ParallelReplicas:     *parallelReplicas,
+		WarmUp:               *warmUp,
+		ReportPath:           *reportDir,
+		ReportFormat:         *reportFormat,
+		ReportToBucket:       *reportToBucket,
+		HealthcheckURL:       *healthcheckURL,
+		Notifiers:            notifiers,
+		PreHook:              *preHook,
+		PostHook:             *postHook,
+		Snapshot:             *snapshotFlag,
+		SnapshotRelease:      *snapshotRelease,
+		DeferOnBattery:       *deferOnBattery,
+		DeferOnMetered:       *deferOnMetered,
+		Windows:              windows,
+		Blackouts:            blackouts,
+		PauseOutsideWindows:  *pauseOutsideWin,
+		Jitter:               *jitter,
+		CatchUp:              *catchUp,
+		QueueOverlapping:     *queueOverlapping,
+		Faults:               faults,
 	})
 	if err != nil {
-		return fmt.Errorf("falha ao deletar arquivos do S3: %v", err)
+		log.Fatalf("❌ %v", err)
+	}
+	if err := syncer.PrepareBucket(); err != nil {
+		log.Fatalf("❌ %v", err)
 	}
 
-	return nil
-}
+	fmt.Println(i18n.T("main.connected"))
 
-func fileChangedOnS3(s3Client s3iface.S3API, s3Key, localPath string) (bool, error) {
-	headObjectOutput, err := s3Client.HeadObject(&s3.HeadObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(s3Key),
-	})
+	release, err := syncer.AcquireLock(*forceLock)
 	if err != nil {
-		if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == http.StatusNotFound {
-			return true, nil
-		}
-		return false, fmt.Errorf("erro ao verificar objeto S3: %v", err)
+		log.Fatalf("❌ %v", err)
 	}
+	defer release()
 
-	fileInfo, err := os.Stat(localPath)
+	versioning, err := syncer.BucketVersioning()
 	if err != nil {
-		return false, fmt.Errorf("falha ao obter informações do arquivo local: %v", err)
+		log.Printf("⚠ %v", err)
+	} else if versioning == s3.BucketVersioningStatusEnabled {
+		fmt.Println(i18n.T("main.versioning_on"))
+	} else {
+		fmt.Println(i18n.T("main.versioning_off"))
 	}
 
-	if *headObjectOutput.ContentLength != fileInfo.Size() {
-		return true, nil
-	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	if headObjectOutput.LastModified == nil {
-		return true, nil
+	if *preflight {
+		if err := printPreflight(ctx, syncer, preflightBandwidth); err != nil {
+			log.Printf(i18n.T("preflight.failed"), err)
+		}
 	}
 
-	if headObjectOutput.LastModified != nil && !fileInfo.ModTime().After(*headObjectOutput.LastModified) {
-		return false, nil
+	if *onceFlag {
+		code := runOnce(ctx, syncer)
+		stop()
+		release()
+		os.Exit(code)
 	}
 
-	if fileInfo.Size() > multipartThreshold {
-		return fileInfo.ModTime().After(*headObjectOutput.LastModified), nil
+	if *controlAddr != "" {
+		if startControlServer(*controlAddr, syncer) && *guiEnabled {
+			openGUI(*controlAddr)
+		}
+	} else if *guiEnabled {
+		log.Print(i18n.T("main.gui_ignored"))
 	}
 
-	localFileHash, err := calculateMD5(localPath)
-	if err != nil {
-		return false, fmt.Errorf("erro ao calcular hash do arquivo local: %v", err)
+	if *debugAddr != "" {
+		startDebugServer(*debugAddr)
 	}
 
-	s3ETag := strings.Trim(*headObjectOutput.ETag, "\"")
+	handlePauseSignals(ctx, syncer)
 
-	if strings.Contains(s3ETag, "-") {
-		return fileInfo.ModTime().After(*headObjectOutput.LastModified), nil
+	fmt.Println(i18n.T("main.press_ctrl_c"))
+	if err := syncer.Watch(ctx); err != nil && ctx.Err() == nil {
+		log.Fatalf("❌ %v", err)
 	}
+}
 
-	return localFileHash != s3ETag, nil
+// Exit codes of --once. A run in which only some files failed exits with
+// exitPartial, so schedulers can tell it from a run that could not sync.
+const (
+	exitFailure = 1
+	exitPartial = 2
+)
+
+// runOnce performs the single run of --once and returns the exit code.
+func runOnce(ctx context.Context, syncer *sync.Syncer) int {
+	fmt.Println(i18n.T("main.syncing"))
+	err := syncer.Run(ctx)
+	code := exitCode(err)
+	switch code {
+	case 0:
+		fmt.Println(i18n.T("main.done"))
+	case exitPartial:
+		log.Printf(i18n.T("main.partial"), err)
+	default:
+		log.Printf(i18n.T("syncer.failed"), err)
+	}
+	return code
 }
 
-func calculateMD5(filePath string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", fmt.Errorf("falha ao abrir arquivo: %v", err)
+// exitCode maps the error of a run to the exit code of --once.
+func exitCode(err error) int {
+	var syncErr *sync.SyncError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &syncErr):
+		return exitPartial
+	default:
+		return exitFailure
 	}
-	defer file.Close()
+}
 
-	hash := md5.New()
-	_, err = io.Copy(hash, file)
-	if err != nil {
-		return "", fmt.Errorf("falha ao gerar hash do arquivo: %v", err)
-	}
+// credentialFlags registers the AWS credential options on fs.
+func credentialFlags(fs *flag.FlagSet) *sync.Credentials {
+	var creds sync.Credentials
+	fs.StringVar(&creds.Profile, "profile", "", i18n.T("flag.profile"))
+	fs.StringVar(&creds.RoleARN, "role-arn", "", i18n.T("flag.role_arn"))
+	fs.StringVar(&creds.ExternalID, "external-id", "", i18n.T("flag.external_id"))
+	fs.StringVar(&creds.KeyStore, "key-store", "", i18n.T("flag.key_store"))
+	return &creds
+}
 
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+// selection holds the options choosing which files of the directory take
+// part in a sync, for the subcommands comparing it with the bucket.
+type selection struct {
+	filesFrom, excludeFrom, rules, hash *string
+	keyTemplate                         *string
+	gitignore, sanitize, oneFileSystem  *bool
+	hardLinks                           *bool
+	presets, archives, keepRemote       stringList
 }
 
-func loadSyncIgnoreFile() error {
-	file, err := os.Open(filepath.Join(rootDir, ".syncignore"))
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
+// selectionFlags registers the selection options of the scheduler on fs.
+func selectionFlags(fs *flag.FlagSet) *selection {
+	sel := &selection{
+		filesFrom:     fs.String("files-from", "", i18n.T("flag.files_from")),
+		excludeFrom:   fs.String("exclude-from", "", i18n.T("flag.exclude_from")),
+		gitignore:     fs.Bool("gitignore", false, i18n.T("flag.gitignore")),
+		rules:         fs.String("rules", "", i18n.T("flag.rules")),
+		hash:          fs.String("hash", sync.HashMD5, i18n.T("flag.hash")),
+		sanitize:      fs.Bool("sanitize-keys", false, i18n.T("flag.sanitize_keys")),
+		keyTemplate:   fs.String("key-template", "", i18n.T("flag.key_template")),
+		oneFileSystem: fs.Bool("one-file-system", false, i18n.T("flag.one_file_system")),
+		hardLinks:     fs.Bool("hard-links", false, i18n.T("flag.hard_links")),
+	}
+	fs.Var(&sel.presets, "exclude-preset", fmt.Sprintf(i18n.T("flag.exclude_preset"), strings.Join(sync.PresetNames(), ", ")))
+	fs.Var(&sel.archives, "archive", i18n.T("flag.archive"))
+	fs.Var(&sel.keepRemote, "keep-remote", i18n.T("flag.keep_remote"))
+	return sel
+}
+
+// apply copies the selection to cfg.
+func (sel *selection) apply(cfg *sync.Config) {
+	cfg.FilesFrom = *sel.filesFrom
+	cfg.ExcludeFrom = *sel.excludeFrom
+	cfg.GitIgnore = *sel.gitignore
+	cfg.ExcludePresets = listValues(sel.presets)
+	cfg.RulesFile = *sel.rules
+	cfg.KeepRemote = listValues(sel.keepRemote)
+	cfg.ArchiveDirs = sel.archives
+	cfg.HashAlgorithm = *sel.hash
+	cfg.SanitizeKeys = *sel.sanitize
+	cfg.KeyTemplate = *sel.keyTemplate
+	cfg.OneFileSystem = *sel.oneFileSystem
+	cfg.HardLinks = *sel.hardLinks
+}
+
+// keyDateFlag registers --key-date on fs, for the subcommands reading the
+// objects a key template placed below the {{date}} of another day.
+func keyDateFlag(fs *flag.FlagSet) *time.Time {
+	date := new(time.Time)
+	fs.Func("key-date", i18n.T("flag.key_date"), func(value string) (err error) {
+		*date, err = sync.ParseAsOf(value)
 		return err
-	}
-	defer file.Close()
+	})
+	return date
+}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+// languageFlag registers --lang on fs. selectLanguage already picked the
+// language from the arguments; parsing the flag reports unsupported ones.
+func languageFlag(fs *flag.FlagSet) {
+	fs.Func("lang", i18n.T("cli.lang"), i18n.Set)
+}
 
-		if line == "" || strings.HasPrefix(line, "#") {
+// selectLanguage selects the language given by --lang in args, or else by
+// GUISYNC_LANG, before any flag set is built: help texts are rendered when
+// their flags are defined, and -h may come before --lang. Unsupported
+// languages are left for the flag to report.
+func selectLanguage(args []string) {
+	lang := os.Getenv(envNames("lang")[0])
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "lang" || !strings.HasPrefix(arg, "-") {
 			continue
 		}
-
-		ignorePatterns = append(ignorePatterns, line)
+		if !hasValue && i+1 < len(args) {
+			value = args[i+1]
+		}
+		lang = value
 	}
-
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("erro ao ler arquivo .syncignore: %v", err)
+	if lang != "" {
+		i18n.Set(lang)
 	}
-
-	fmt.Printf("✓ Arquivo .syncignore carregado (%d padrões)\n", len(ignorePatterns))
-
-	return nil
 }
 
-func shouldIgnore(path string) bool {
-	fileName := filepath.Base(path)
-
-	for _, pattern := range ignorePatterns {
-		if pattern == path {
-			return true
-		}
-
-		if pattern == fileName {
-			return true
+// listValues splits the comma-separated values of repeatable flags such as
+// --exclude-preset and diff -only.
+func listValues(values []string) []string {
+	var names []string
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
 		}
 	}
-
-	return false
+	return names
 }
 
-func uploadFileS3(s3Client s3iface.S3API, sess *session.Session, s3Key string, filePath string, fileSize int64) (int64, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return 0, fmt.Errorf("falha ao abrir arquivo: %v", err)
+// scheduleFrom returns the schedule given by --schedule or, as a
+// shorthand, by --every.
+func scheduleFrom(schedule string, every time.Duration) (string, error) {
+	if every == 0 {
+		return schedule, nil
 	}
-	defer file.Close()
-
-	if fileSize > multipartThreshold {
-		fmt.Printf("  📦 Upload multipart: %s (%.2f MB)\n", filepath.Base(filePath), float64(fileSize)/(1024*1024))
-		return uploadMultipart(sess, s3Key, file, fileSize)
+	if schedule != "" {
+		return "", i18n.Errorf("main.every_conflict")
 	}
+	return sync.EverySchedule(every)
+}
 
-	_, err = s3Client.PutObject(&s3.PutObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(s3Key),
-		Body:   file,
-	})
-	if err != nil {
-		return 0, fmt.Errorf("falha ao fazer upload do arquivo para S3: %v", err)
+// formatRuns lists the run times of a schedule for the user to check.
+func formatRuns(runs []time.Time) string {
+	formatted := make([]string, len(runs))
+	for i, t := range runs {
+		formatted[i] = t.Format("Mon 2006-01-02 15:04")
 	}
-
-	return fileSize, nil
+	return strings.Join(formatted, ", ")
 }
 
-func uploadMultipart(sess *session.Session, s3Key string, file *os.File, fileSize int64) (int64, error) {
-	_, err := file.Seek(0, 0)
-	if err != nil {
-		return 0, fmt.Errorf("falha ao resetar ponteiro do arquivo: %v", err)
+// parseWindows parses the values of the window option name, exiting on
+// invalid ones.
+func parseWindows(name string, specs []string) []sync.Window {
+	var windows []sync.Window
+	for _, spec := range specs {
+		w, err := sync.ParseWindow(spec)
+		if err != nil {
+			log.Fatalf("❌ %s: %v", name, err)
+		}
+		windows = append(windows, w)
 	}
+	return windows
+}
 
-	uploader := s3manager.NewUploader(sess, func(u *s3manager.Uploader) {
-		u.PartSize = partSize
-		u.Concurrency = partConcurrency
-		u.MaxUploadParts = 10000
-		u.LeavePartsOnError = false
-	})
+// stringList is a flag that can be given several times.
+type stringList []string
 
-	_, err = uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(s3Key),
-		Body:   file,
-	})
-	if err != nil {
-		return 0, fmt.Errorf("falha ao fazer upload do arquivo via multipart: %v", err)
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// ask returns value when it was given as a flag and otherwise prompts for
+// it, exiting when the answer is empty.
+func ask(reader *bufio.Reader, value, prompt, emptyMessage string) string {
+	if value != "" {
+		return value
 	}
+	fmt.Print(prompt)
+	answer, _ := reader.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		log.Fatalln(emptyMessage)
+	}
+	return answer
+}
 
-	return fileSize, nil
+// commands maps subcommand names to their handlers. Running the binary
+// without a subcommand starts the interactive scheduler.
+var commands = map[string]func(args []string) error{
+	"agent":             runAgent,
+	"cleanup":           runCleanup,
+	"doctor":            runDoctor,
+	"put":               runPut,
+	"restore":           runRestore,
+	"status":            runStatus,
+	"verify":            runVerify,
+	"diff":              runDiff,
+	"ls":                runLs,
+	"stat":              runStat,
+	"prune":             runPrune,
+	"lifecycle":         runLifecycle,
+	"install-service":   runInstallService,
+	"uninstall-service": runUninstallService,
+	"version":           runVersion,
 }
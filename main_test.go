@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMain runs the tests in English, whatever the locale of the machine.
+func TestMain(m *testing.M) {
+	i18n.Set(i18n.English)
+	os.Exit(m.Run())
+}
+
+// Test Suite: --once
+func TestExitCode(t *testing.T) {
+	partial := &sync.SyncError{Result: &sync.SyncResult{}}
+
+	assert.Equal(t, 0, exitCode(nil))
+	assert.Equal(t, exitPartial, exitCode(partial))
+	assert.Equal(t, exitPartial, exitCode(fmt.Errorf("run: %w", partial)))
+	assert.Equal(t, exitFailure, exitCode(errors.New("hook pré-sincronização falhou")))
+}
+
+// Test Suite: --exclude-preset
+func TestPresetNames(t *testing.T) {
+	assert.Equal(t, []string{"os", "office", "editor"}, listValues([]string{"os, office", "editor,"}))
+	assert.Nil(t, listValues(nil))
+}
+
+// Test Suite: --lang
+func TestHelpFollowsLang(t *testing.T) {
+	defer i18n.Set(i18n.English)
+	help := func(args ...string) string {
+		i18n.Set(i18n.English)
+		selectLanguage(args)
+		fs := flag.NewFlagSet("gui-sync", flag.ContinueOnError)
+		var out strings.Builder
+		fs.SetOutput(&out)
+		fs.Usage = func() { printUsage(fs) }
+		defineFlags(fs)
+		assert.ErrorIs(t, fs.Parse(args), flag.ErrHelp)
+		return out.String()
+	}
+
+	english := help("-h")
+	assert.Contains(t, english, "Usage of gui-sync:")
+	assert.Contains(t, english, "S3 bucket name")
+	assert.NotContains(t, english, "fault-inject", "hidden flags are left out")
+
+	for _, args := range [][]string{{"-h", "--lang", "pt-BR"}, {"-lang=pt_BR.UTF-8", "-h"}} {
+		portuguese := help(args...)
+		assert.Contains(t, portuguese, "Uso de gui-sync:", args)
+		assert.Contains(t, portuguese, "nome do bucket S3", args)
+	}
+
+	t.Setenv("GUISYNC_LANG", "pt-BR")
+	assert.Contains(t, help("-h"), "nome do bucket S3")
+	assert.Contains(t, help("-h", "--lang", "en"), "S3 bucket name", "--lang takes precedence")
+}
@@ -0,0 +1,140 @@
+// Package i18n holds the message catalogs of gui-sync and selects the
+// language they are rendered in.
+//
+// Messages are looked up by stable identifiers ("differ.head_object")
+// rather than by their text, so a message can be reworded or translated
+// without breaking code that checks for it. Errors keep their identifier:
+// see Error and ID.
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Supported languages.
+const (
+	English    = "en"
+	Portuguese = "pt-BR"
+)
+
+// catalogs maps each supported language to its messages.
+var catalogs = map[string]map[string]string{
+	English:    english,
+	Portuguese: portuguese,
+}
+
+// current is the language messages are rendered in.
+var current atomic.Value
+
+func init() {
+	current.Store(FromEnv())
+}
+
+// Set selects the language of the messages. It accepts the names of
+// Languages and locale forms of them, such as "pt_BR.UTF-8" or "en-US".
+func Set(lang string) error {
+	normalized, ok := normalize(lang)
+	if !ok {
+		return Errorf("i18n.unsupported", lang, strings.Join(Languages(), ", "))
+	}
+	current.Store(normalized)
+	return nil
+}
+
+// Current returns the selected language.
+func Current() string {
+	return current.Load().(string)
+}
+
+// Languages lists the supported languages.
+func Languages() []string {
+	return []string{English, Portuguese}
+}
+
+// FromEnv returns the language asked for by the locale variables, in the
+// POSIX order of precedence. Portuguese, the historical language of
+// gui-sync, is kept when no locale is set (or it is C/POSIX); locales of
+// languages without a catalog get English.
+func FromEnv() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" || value == "C" || value == "POSIX" || strings.HasPrefix(value, "C.") {
+			continue
+		}
+		if lang, ok := normalize(value); ok {
+			return lang
+		}
+		return English
+	}
+	return Portuguese
+}
+
+// normalize maps a language or locale name to a supported language.
+func normalize(lang string) (string, bool) {
+	lang, _, _ = strings.Cut(lang, ".")
+	lang, _, _ = strings.Cut(lang, "@")
+	lang = strings.ToLower(strings.ReplaceAll(lang, "_", "-"))
+	base, _, _ := strings.Cut(lang, "-")
+	switch base {
+	case "en":
+		return English, true
+	case "pt":
+		return Portuguese, true
+	}
+	return "", false
+}
+
+// T returns the message id in the selected language, falling back to
+// English and then to the identifier itself.
+func T(id string) string {
+	if msg, ok := catalogs[Current()][id]; ok {
+		return msg
+	}
+	if msg, ok := english[id]; ok {
+		return msg
+	}
+	return id
+}
+
+// Error is an error whose text is the catalog message ID formatted with
+// Args. The text is rendered when the error is printed, in the language
+// selected at that time.
+type Error struct {
+	ID   string
+	Args []any
+}
+
+// Errorf returns an *Error for the message id.
+func Errorf(id string, args ...any) error {
+	return &Error{ID: id, Args: args}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf(T(e.ID), e.Args...)
+}
+
+// Unwrap returns the Args that are errors, so errors.Is and errors.As see
+// through the message to its causes.
+func (e *Error) Unwrap() []error {
+	var errs []error
+	for _, arg := range e.Args {
+		if err, ok := arg.(error); ok {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// ID returns the message identifier of err, or "" when err is not an
+// *Error.
+func ID(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.ID
+	}
+	return ""
+}
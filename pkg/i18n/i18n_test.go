@@ -0,0 +1,106 @@
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: message catalogs
+func TestCatalogsMatch(t *testing.T) {
+	verbs := regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+	for _, lang := range Languages() {
+		catalog := catalogs[lang]
+		require.NotNil(t, catalog, lang)
+		for id, msg := range english {
+			translated, ok := catalog[id]
+			if assert.True(t, ok, "%s: %s has no translation", lang, id) {
+				assert.Equal(t, verbs.FindAllString(msg, -1), verbs.FindAllString(translated, -1), "%s: %s", lang, id)
+			}
+		}
+		assert.Len(t, catalog, len(english), lang)
+	}
+}
+
+func TestSet(t *testing.T) {
+	defer current.Store(Current())
+
+	tests := []struct {
+		lang string
+		want string
+	}{
+		{"en", English},
+		{"en-US", English},
+		{"pt", Portuguese},
+		{"pt-BR", Portuguese},
+		{"pt_BR.UTF-8", Portuguese},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			require.NoError(t, Set(tt.lang))
+			assert.Equal(t, tt.want, Current())
+		})
+	}
+
+	err := Set("de")
+	assert.Equal(t, "i18n.unsupported", ID(err))
+	assert.Equal(t, Portuguese, Current(), "an unsupported language keeps the current one")
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name                    string
+		lcAll, lcMessages, lang string
+		want                    string
+	}{
+		{"no locale", "", "", "", Portuguese},
+		{"C locale", "", "", "C.UTF-8", Portuguese},
+		{"LANG", "", "", "en_US.UTF-8", English},
+		{"LC_MESSAGES over LANG", "", "pt_BR.UTF-8", "en_US.UTF-8", Portuguese},
+		{"LC_ALL over everything", "en_GB.UTF-8", "pt_BR.UTF-8", "pt_BR.UTF-8", English},
+		{"language without a catalog", "", "", "de_DE.UTF-8", English},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LC_ALL", tt.lcAll)
+			t.Setenv("LC_MESSAGES", tt.lcMessages)
+			t.Setenv("LANG", tt.lang)
+			assert.Equal(t, tt.want, FromEnv())
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	defer current.Store(Current())
+
+	err := Errorf("file.open", errors.New("no such file"))
+	require.NoError(t, Set(English))
+	assert.EqualError(t, err, "failed to open file: no such file")
+	require.NoError(t, Set(Portuguese))
+	assert.EqualError(t, err, "falha ao abrir arquivo: no such file")
+
+	assert.Equal(t, "file.open", ID(err))
+	assert.Equal(t, "file.open", ID(fmt.Errorf("upload: %w", err)))
+	assert.Empty(t, ID(errors.New("plain")))
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	cause := errors.New("no such file")
+	err := Errorf("scanner.read_file", "list.txt", cause)
+	assert.ErrorIs(t, err, cause)
+	assert.Equal(t, []error{cause}, err.(*Error).Unwrap(), "arguments that are not errors are left out")
+
+	var target *Error
+	require.ErrorAs(t, Errorf("s3.upload", Errorf("file.open", cause)), &target)
+	assert.Equal(t, "s3.upload", target.ID)
+	assert.ErrorIs(t, Errorf("s3.upload", Errorf("file.open", cause)), cause)
+}
+
+func TestTFallback(t *testing.T) {
+	assert.Equal(t, "no.such.message", T("no.such.message"))
+}
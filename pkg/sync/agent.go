@@ -0,0 +1,258 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// `gui-sync agent` runs the jobs an administrator defines for a fleet of
+// machines in one document, served over HTTP or stored in S3 (the agent
+// source). Every agent fetches it again at intervals, runs the jobs meant
+// for its host and reports their status back to the source.
+
+// agentTimeout bounds every request to an http(s) agent source; those to
+// S3 follow the timeouts of the session.
+const agentTimeout = 30 * time.Second
+
+// AgentConfig is the document of the agent source.
+type AgentConfig struct {
+	formatHeader
+
+	Jobs []AgentJob `json:"jobs"`
+}
+
+// AgentJob is a directory synced by the agents of Hosts, or of every host
+// when Hosts is empty. The other fields are those of Config, as the
+// scheduler options give them.
+type AgentJob struct {
+	Name           string   `json:"name"`
+	Hosts          []string `json:"hosts,omitempty"`
+	Bucket         string   `json:"bucket"`
+	Region         string   `json:"region"`
+	Dir            string   `json:"dir"`
+	Schedule       string   `json:"schedule"`
+	KeyTemplate    string   `json:"key_template,omitempty"`
+	ExcludePresets []string `json:"exclude_presets,omitempty"`
+	KeepRemote     []string `json:"keep_remote,omitempty"`
+	Delete         string   `json:"delete,omitempty"`
+	Heartbeat      bool     `json:"heartbeat,omitempty"`
+	HealthcheckURL string   `json:"healthcheck_url,omitempty"`
+}
+
+// Config returns the Config of the Syncer running job.
+func (job AgentJob) Config() (Config, error) {
+	policy, err := ParseDeletePolicy(job.Delete)
+	if err != nil {
+		return Config{}, err
+	}
+	return Config{
+		Bucket:         job.Bucket,
+		Region:         job.Region,
+		RootDir:        job.Dir,
+		Schedule:       job.Schedule,
+		KeyTemplate:    job.KeyTemplate,
+		ExcludePresets: job.ExcludePresets,
+		KeepRemote:     job.KeepRemote,
+		Delete:         policy,
+		Heartbeat:      job.Heartbeat,
+		HealthcheckURL: job.HealthcheckURL,
+	}, nil
+}
+
+// ParseAgentConfig parses the document of the agent source and returns the
+// jobs of host. A document with an invalid job is refused as a whole, so a
+// mistake of the administrator does not stop the jobs of every machine
+// one by one.
+func ParseAgentConfig(data []byte, host string) ([]AgentJob, error) {
+	if err := checkFormat(i18n.T("agent.document"), data); err != nil {
+		return nil, err
+	}
+	var doc AgentConfig
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, i18n.Errorf("agent.invalid", err)
+	}
+
+	names := make(map[string]bool)
+	var jobs []AgentJob
+	for _, job := range doc.Jobs {
+		if job.Name == "" || job.Bucket == "" || job.Dir == "" {
+			return nil, i18n.Errorf("agent.incomplete_job", job.Name)
+		}
+		if names[job.Name] {
+			return nil, i18n.Errorf("agent.duplicate_job", job.Name)
+		}
+		names[job.Name] = true
+		if _, err := NextRuns(job.Schedule, time.Now(), 1); err != nil {
+			return nil, i18n.Errorf("agent.job", job.Name, err)
+		}
+		if err := ValidateKeyTemplate(job.KeyTemplate); err != nil {
+			return nil, i18n.Errorf("agent.job", job.Name, err)
+		}
+		if _, err := job.Config(); err != nil {
+			return nil, i18n.Errorf("agent.job", job.Name, err)
+		}
+		if len(job.Hosts) == 0 || slices.Contains(job.Hosts, host) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// AgentSource is where the agents fetch their jobs from and report to: an
+// http(s) URL, which they GET and POST their status to, or an S3 object,
+// whose agents write their status next to it, to status/<host>.json.
+type AgentSource struct {
+	URL string
+	// Bucket and Key locate the S3 object of an s3:// source, read with
+	// Region and Credentials or with Client.
+	Bucket      string
+	Key         string
+	Region      string
+	Credentials Credentials
+	Client      s3iface.S3API
+}
+
+// ParseAgentSource parses the source given to `gui-sync agent -source`:
+//
+//	https://admin.example.com/gui-sync/agents
+//	s3://bucket/gui-sync/agents.json?region=sa-east-1&profile=admin
+//
+// s3:// sources take the parameters of --replica.
+func ParseAgentSource(raw string) (*AgentSource, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, i18n.Errorf("agent.invalid_source", raw)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return &AgentSource{URL: raw}, nil
+	case "s3":
+	default:
+		return nil, i18n.Errorf("agent.invalid_source", raw)
+	}
+
+	key := strings.TrimPrefix(u.Path, "/")
+	if key == "" || strings.HasSuffix(key, "/") {
+		return nil, i18n.Errorf("agent.invalid_source", raw)
+	}
+	query := u.Query()
+	for param := range query {
+		switch param {
+		case "region", "profile", "role-arn", "external-id", "key-store":
+		default:
+			return nil, i18n.Errorf("replica.unknown_param", param)
+		}
+	}
+	return &AgentSource{
+		URL:    raw,
+		Bucket: u.Host,
+		Key:    key,
+		Region: query.Get("region"),
+		Credentials: Credentials{
+			Profile:    query.Get("profile"),
+			RoleARN:    query.Get("role-arn"),
+			ExternalID: query.Get("external-id"),
+			KeyStore:   query.Get("key-store"),
+		},
+	}, nil
+}
+
+// s3Client returns the client of an s3:// source, built at the first call.
+func (src *AgentSource) s3Client() (s3iface.S3API, error) {
+	if src.Client != nil {
+		return src.Client, nil
+	}
+	if src.Region == "" {
+		return nil, i18n.Errorf("syncer.empty_region")
+	}
+	sess, err := NewSession(src.Region, src.Credentials, RetryPolicy{}, Timeouts{})
+	if err != nil {
+		return nil, i18n.Errorf("s3.session", err)
+	}
+	src.Client = s3.New(sess)
+	return src.Client, nil
+}
+
+// Fetch returns the document of the source.
+func (src *AgentSource) Fetch(ctx context.Context) ([]byte, error) {
+	if src.Bucket == "" {
+		ctx, cancel := context.WithTimeout(ctx, agentTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, i18n.Errorf("agent.fetch", src.URL, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, i18n.Errorf("agent.fetch", src.URL, resp.Status)
+		}
+		return io.ReadAll(resp.Body)
+	}
+
+	client, err := src.s3Client()
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(src.Bucket),
+		Key:    aws.String(src.Key),
+	})
+	if err != nil {
+		return nil, i18n.Errorf("agent.fetch", src.URL, err)
+	}
+	defer output.Body.Close()
+	return io.ReadAll(output.Body)
+}
+
+// StatusKey returns the key an s3:// source keeps the status of host at.
+func (src *AgentSource) StatusKey(host string) string {
+	return path.Join(path.Dir(src.Key), "status", host+".json")
+}
+
+// Report sends status, the status of the jobs of host, to the source.
+func (src *AgentSource) Report(ctx context.Context, host string, status interface{}) error {
+	if src.Bucket == "" {
+		ctx, cancel := context.WithTimeout(ctx, agentTimeout)
+		defer cancel()
+		if err := postJSON(ctx, src.URL, status); err != nil {
+			return i18n.Errorf("agent.report", src.URL, err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	client, err := src.s3Client()
+	if err != nil {
+		return err
+	}
+	key := src.StatusKey(host)
+	if _, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(src.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	}); err != nil {
+		return i18n.Errorf("s3.put", key, err)
+	}
+	return nil
+}
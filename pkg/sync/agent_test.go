@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const agentDocument = `{
+  "jobs": [
+    {"name": "docs", "bucket": "backup", "region": "sa-east-1", "dir": "/srv/docs", "schedule": "@hourly",
+     "key_template": "{{hostname}}/{{relpath}}"},
+    {"name": "fotos", "hosts": ["pc-02"], "bucket": "backup", "region": "sa-east-1", "dir": "/srv/fotos",
+     "schedule": "0 3 * * *", "delete": "never"}
+  ]
+}`
+
+// Test Suite: agent sources and their job definitions
+func TestParseAgentConfig(t *testing.T) {
+	jobs, err := ParseAgentConfig([]byte(agentDocument), "pc-01")
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "docs", jobs[0].Name)
+
+	jobs, err = ParseAgentConfig([]byte(agentDocument), "pc-02")
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	cfg, err := jobs[1].Config()
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/fotos", cfg.RootDir)
+	assert.True(t, cfg.Delete.Never)
+
+	for name, doc := range map[string]string{
+		"no dir":         `{"jobs": [{"name": "a", "bucket": "b", "schedule": "@hourly"}]}`,
+		"duplicate name": `{"jobs": [{"name": "a", "bucket": "b", "dir": "/a", "schedule": "@hourly"}, {"name": "a", "bucket": "b", "dir": "/b", "schedule": "@daily"}]}`,
+		"bad schedule":   `{"jobs": [{"name": "a", "bucket": "b", "dir": "/a", "schedule": "sempre"}]}`,
+		"bad template":   `{"jobs": [{"name": "a", "bucket": "b", "dir": "/a", "schedule": "@hourly", "key_template": "{{hostname}}"}]}`,
+		"bad delete":     `{"jobs": [{"name": "a", "bucket": "b", "dir": "/a", "schedule": "@hourly", "delete": "later"}]}`,
+		"other host":     `{"jobs": [{"name": "a", "hosts": ["pc-09"], "bucket": "b", "schedule": "@hourly"}]}`,
+		"newer format":   `{"format_version": 99, "jobs": []}`,
+		"not json":       `jobs:`,
+	} {
+		_, err := ParseAgentConfig([]byte(doc), "pc-01")
+		assert.Error(t, err, name)
+	}
+}
+
+func TestParseAgentSource(t *testing.T) {
+	src, err := ParseAgentSource("https://admin.example.com/gui-sync/agents")
+	require.NoError(t, err)
+	assert.Empty(t, src.Bucket)
+
+	src, err = ParseAgentSource("s3://admin/gui-sync/agents.json?region=sa-east-1&profile=admin")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", src.Bucket)
+	assert.Equal(t, "gui-sync/agents.json", src.Key)
+	assert.Equal(t, "sa-east-1", src.Region)
+	assert.Equal(t, "admin", src.Credentials.Profile)
+	assert.Equal(t, "gui-sync/status/pc-01.json", src.StatusKey("pc-01"))
+
+	for _, raw := range []string{"", "admin.example.com/agents", "ftp://admin/agents", "s3://admin", "s3://admin/agents/", "s3://admin/agents.json?user=x"} {
+		_, err := ParseAgentSource(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestAgentSourceOverHTTP(t *testing.T) {
+	var reported map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			io.WriteString(w, agentDocument)
+		case http.MethodPost:
+			json.NewDecoder(r.Body).Decode(&reported)
+		}
+	}))
+	defer server.Close()
+
+	src, err := ParseAgentSource(server.URL)
+	require.NoError(t, err)
+	data, err := src.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.JSONEq(t, agentDocument, string(data))
+
+	require.NoError(t, src.Report(context.Background(), "pc-01", map[string]string{"host": "pc-01"}))
+	assert.Equal(t, "pc-01", reported["host"])
+}
+
+func TestAgentSourceInS3(t *testing.T) {
+	mockClient := new(mockS3Client)
+	mockClient.On("GetObject", &s3.GetObjectInput{
+		Bucket: aws.String("admin"),
+		Key:    aws.String("gui-sync/agents.json"),
+	}).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(agentDocument))}, nil).Once()
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return *input.Bucket == "admin" && *input.Key == "gui-sync/status/pc-01.json"
+	})).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	src, err := ParseAgentSource("s3://admin/gui-sync/agents.json")
+	require.NoError(t, err)
+	src.Client = mockClient
+
+	data, err := src.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.JSONEq(t, agentDocument, string(data))
+	require.NoError(t, src.Report(context.Background(), "pc-01", map[string]string{"host": "pc-01"}))
+	mockClient.AssertExpectations(t)
+}
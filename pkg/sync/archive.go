@@ -0,0 +1,374 @@
+package sync
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Archive mode uploads each top-level directory of RootDir matching
+// Config.ArchiveDirs as a single tar.gz object instead of one object per
+// file, which for trees of many tiny files (node_modules, build caches) is
+// dominated by per-request overhead. An index object next to the archive
+// lists its files, so runs can tell whether the directory changed and
+// restores can tell which archives hold the paths they want, without
+// downloading the archives themselves.
+const (
+	archiveSuffix      = ".gui-sync-archive.tar.gz"
+	archiveIndexSuffix = ".gui-sync-archive.json"
+)
+
+// archiveIndex is the document stored at the index key of an archive.
+type archiveIndex struct {
+	formatHeader
+
+	Dir string `json:"dir"`
+	// Digest identifies the file list below, sizes and modification
+	// times included; the archive is rebuilt whenever it changes.
+	Digest string         `json:"digest"`
+	Files  []archiveEntry `json:"files"`
+}
+
+type archiveEntry struct {
+	Key     string      `json:"key"`
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"mod_time"`
+	Mode    os.FileMode `json:"mode"`
+	Link    string      `json:"link,omitempty"`
+
+	path string // local path, only set while building
+}
+
+func archiveKey(dir string) string      { return dir + archiveSuffix }
+func archiveIndexKey(dir string) string { return dir + archiveIndexSuffix }
+
+// archivedDir returns the archived top-level directory relPath lies in.
+func (s *Syncer) archivedDir(relPath string) (string, bool) {
+	top, _, found := strings.Cut(relPath, "/")
+	if !found {
+		return "", false
+	}
+	for _, pattern := range s.cfg.ArchiveDirs {
+		if matched, _ := path.Match(pattern, top); matched {
+			return top, true
+		}
+	}
+	return "", false
+}
+
+// archiveDirs lists the top-level directories of root to archive.
+func (s *Syncer) archiveDirs(root string) ([]string, error) {
+	if len(s.cfg.ArchiveDirs) == 0 {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, i18n.Errorf("archive.list", root, err)
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, ok := s.archivedDir(entry.Name() + "/"); ok {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	return dirs, nil
+}
+
+// syncArchives brings the archive of every archived directory of root up to
+// date, passing the keys of the archives and their indexes to keep, so the
+// deleter leaves them alone. Directories that fail are added to result.
+func (s *Syncer) syncArchives(root string, result *SyncResult, keep func(key string), unreadable func(relPath string, err error)) error {
+	dirs, err := s.archiveDirs(root)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		s.stats.scanned.Add(1)
+		keep(s.prefixed(archiveKey(dir)))
+		keep(s.prefixed(archiveIndexKey(dir)))
+		if err := s.syncArchive(root, dir, unreadable); err != nil {
+			result.add(FileResult{Key: s.prefixed(archiveKey(dir)), Path: filepath.Join(root, dir), Status: StatusArchiveFailed, Err: err})
+			s.stats.failed.Add(1)
+			log.Printf("  ❌ %s/ - %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// syncArchive uploads the archive of the top-level directory dir of root
+// and its index, unless the index already describes the current files.
+// Unreadable entries are reported to unreadable and left out.
+func (s *Syncer) syncArchive(root, dir string, unreadable func(relPath string, err error)) error {
+	files, err := s.archiveManifest(root, dir, unreadable)
+	if err != nil {
+		return err
+	}
+	index := &archiveIndex{Dir: dir, Files: files, Digest: manifestDigest(files)}
+
+	if current, err := s.readArchiveIndex(s.prefixed(archiveIndexKey(dir))); err != nil {
+		return err
+	} else if current != nil && current.Digest == index.Digest {
+		s.stats.skipped.Add(1)
+		s.report.add(reportAction{Action: actionSkip, Key: s.prefixed(archiveKey(dir))})
+		fmt.Printf(i18n.T("archive.skip"), dir)
+		return nil
+	}
+
+	start := time.Now()
+	tmp, err := os.CreateTemp("", "gui-sync-archive-*")
+	if err != nil {
+		return i18n.Errorf("file.temp", err)
+	}
+	defer os.Remove(tmp.Name())
+	err = writeArchive(tmp, files)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return i18n.Errorf("archive.create", dir, err)
+	}
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return i18n.Errorf("archive.create", dir, err)
+	}
+
+	// The archive goes first: an index never describes an archive that
+	// failed to upload.
+	size, err := s.uploadFileS3(s.prefixed(archiveKey(dir)), tmp.Name(), info.Size())
+	if err == nil {
+		err = s.writeArchiveIndex(s.prefixed(archiveIndexKey(dir)), index)
+	}
+	action := reportAction{Action: actionUpload, Key: s.prefixed(archiveKey(dir)), Size: info.Size(), Duration: time.Since(start).Seconds()}
+	if err != nil {
+		action.Error = err.Error()
+	}
+	s.report.add(action)
+	if err != nil {
+		return err
+	}
+
+	s.stats.uploaded.Add(1)
+	s.stats.bytesUploaded.Add(size)
+	fmt.Printf(i18n.T("archive.uploaded"), dir, s.prefixed(archiveKey(dir)), len(files), size)
+	return nil
+}
+
+func (s *Syncer) archiveManifest(root, dir string, unreadable func(relPath string, err error)) ([]archiveEntry, error) {
+	var files []archiveEntry
+	onError := func(relPath string, err error) {
+		if unreadable != nil {
+			unreadable(dir+"/"+relPath, err)
+		}
+	}
+	err := walkTree(filepath.Join(root, dir), "", func(localPath, relPath string, info os.FileInfo) error {
+		key := dir + "/" + relPath
+		if s.shouldIgnore(key) {
+			return nil
+		}
+		entry := archiveEntry{Key: key, Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode(), path: localPath}
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(localPath)
+			if err != nil {
+				onError(relPath, err)
+				return nil
+			}
+			entry.Size, entry.Link = 0, target
+		}
+		files = append(files, entry)
+		return nil
+	}, onError, s.mountsSkipped(nil))
+	if err != nil {
+		return nil, i18n.Errorf("archive.walk", dir, err)
+	}
+	return files, nil
+}
+
+func manifestDigest(files []archiveEntry) string {
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00%o\x00%s\n", f.Key, f.Size, f.ModTime.UnixNano(), f.Mode, f.Link)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeArchive writes files to w as a gzipped tar. A file that shrank
+// since it was listed fails the archive, which the next run rebuilds.
+func writeArchive(w io.Writer, files []archiveEntry) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		header := &tar.Header{
+			Name:    f.Key,
+			Size:    f.Size,
+			Mode:    int64(f.Mode.Perm()),
+			ModTime: f.ModTime,
+		}
+		if f.Link != "" {
+			header.Typeflag, header.Linkname = tar.TypeSymlink, f.Link
+		} else {
+			header.Typeflag = tar.TypeReg
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if f.Link != "" {
+			continue
+		}
+		file, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(tw, file, f.Size)
+		file.Close()
+		if err != nil {
+			return i18n.Errorf("archive.changed", f.Key, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// readArchiveIndex returns the index stored at key, or nil when there is
+// none yet.
+func (s *Syncer) readArchiveIndex(key string) (*archiveIndex, error) {
+	return s.readArchiveIndexVersion(key, "")
+}
+
+func (s *Syncer) readArchiveIndexVersion(key, versionID string) (*archiveIndex, error) {
+	input := &s3.GetObjectInput{Bucket: aws.String(s.cfg.Bucket), Key: aws.String(key)}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+	output, err := s.client.GetObject(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+			return nil, nil
+		}
+		return nil, i18n.Errorf("archive.read_index", key, err)
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, i18n.Errorf("archive.read_index", key, err)
+	}
+	if err := checkFormat(fmt.Sprintf("s3://%s/%s", s.cfg.Bucket, key), data); err != nil {
+		var formatErr *FormatError
+		if errors.As(err, &formatErr) {
+			return nil, err
+		}
+		return nil, i18n.Errorf("archive.invalid_index", key, err)
+	}
+	var index archiveIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, i18n.Errorf("archive.invalid_index", key, err)
+	}
+	return &index, nil
+}
+
+func (s *Syncer) writeArchiveIndex(key string, index *archiveIndex) error {
+	index.stampFormat()
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.cfg.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	}
+	if err := s.setPutChecksum(input, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	if _, err := s.client.PutObject(input); err != nil {
+		return i18n.Errorf("archive.upload_index", key, err)
+	}
+	return nil
+}
+
+// extractArchive restores the files of the archive obj whose key selected
+// accepts into targetDir, returning how many it wrote.
+func (s *Syncer) extractArchive(obj restoreObject, targetDir string, selected func(key string) bool) (int, error) {
+	input := &s3.GetObjectInput{Bucket: aws.String(s.cfg.Bucket), Key: aws.String(obj.key)}
+	if obj.versionID != "" {
+		input.VersionId = aws.String(obj.versionID)
+	}
+	output, err := s.client.GetObject(input)
+	if err != nil {
+		return 0, i18n.Errorf("s3.download", err)
+	}
+	defer output.Body.Close()
+
+	body, err := decompressedBody(output)
+	if err != nil {
+		return 0, err
+	}
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return 0, i18n.Errorf("archive.invalid", err)
+	}
+	tr := tar.NewReader(gz)
+
+	extracted := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return extracted, nil
+		}
+		if err != nil {
+			return extracted, i18n.Errorf("archive.invalid", err)
+		}
+		if !selected(header.Name) {
+			continue
+		}
+		localPath, err := restorePath(targetDir, header.Name)
+		if err != nil {
+			return extracted, err
+		}
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			return extracted, i18n.Errorf("file.mkdir", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			if err := restoreSymlink(localPath, header.Linkname); err != nil {
+				return extracted, err
+			}
+		case tar.TypeReg:
+			if err := writeRestoredFile(localPath, tr); err != nil {
+				return extracted, err
+			}
+			if err := os.Chmod(localPath, os.FileMode(header.Mode).Perm()); err != nil {
+				return extracted, i18n.Errorf("file.chmod", err)
+			}
+			os.Chtimes(localPath, header.ModTime, header.ModTime)
+		default:
+			continue
+		}
+		extracted++
+	}
+}
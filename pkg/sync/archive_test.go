@@ -0,0 +1,151 @@
+package sync
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: archive mode
+func TestArchivedDir(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.ArchiveDirs = []string{"node_modules", "cache-*"}
+
+	tests := []struct {
+		relPath string
+		dir     string
+		want    bool
+	}{
+		{"node_modules/lodash/index.js", "node_modules", true},
+		{"cache-build/a.o", "cache-build", true},
+		{"node_modules", "", false},
+		{"src/node_modules/a.js", "", false},
+		{"README.md", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.relPath, func(t *testing.T) {
+			dir, ok := s.archivedDir(tt.relPath)
+			assert.Equal(t, tt.want, ok)
+			assert.Equal(t, tt.dir, dir)
+		})
+	}
+}
+
+// uploadTestArchive archives the node_modules directory of root and
+// returns the archive and index bodies sent to S3.
+func uploadTestArchive(t *testing.T, root string) (archive, index []byte) {
+	mockClient := new(mockS3Client)
+	mockClient.On("GetObject", mock.Anything).Return(nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)).Once()
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return *input.Key == archiveKey("node_modules")
+	})).Run(func(args mock.Arguments) {
+		archive, _ = io.ReadAll(args.Get(0).(*s3.PutObjectInput).Body)
+	}).Return(&s3.PutObjectOutput{}, nil).Once()
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return *input.Key == archiveIndexKey("node_modules")
+	})).Run(func(args mock.Arguments) {
+		index, _ = io.ReadAll(args.Get(0).(*s3.PutObjectInput).Body)
+	}).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	s.cfg.ArchiveDirs = []string{"node_modules"}
+	require.NoError(t, s.syncArchive(root, "node_modules", nil))
+	mockClient.AssertExpectations(t)
+	assert.Equal(t, int64(1), s.stats.uploaded.Load())
+	return archive, index
+}
+
+func TestSyncArchive(t *testing.T) {
+	root := t.TempDir()
+	createTempFile(t, root, "node_modules/lodash/index.js", "module.exports = {}")
+	createTempFile(t, root, "node_modules/left-pad/index.js", "module.exports = pad")
+
+	archive, index := uploadTestArchive(t, root)
+	require.NotEmpty(t, archive)
+	assert.Contains(t, string(index), `"node_modules/lodash/index.js"`)
+
+	t.Run("unchanged directory is skipped", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader(index)),
+		}, nil).Once()
+
+		s := newTestSyncer(t, mockClient)
+		require.NoError(t, s.syncArchive(root, "node_modules", nil))
+		assert.Equal(t, int64(1), s.stats.skipped.Load())
+		mockClient.AssertNotCalled(t, "PutObject", mock.Anything)
+	})
+
+	t.Run("changed directory is uploaded again", func(t *testing.T) {
+		createTempFile(t, root, "node_modules/lodash/fp.js", "module.exports = fp")
+
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader(index)),
+		}, nil).Once()
+		mockClient.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Twice()
+
+		s := newTestSyncer(t, mockClient)
+		require.NoError(t, s.syncArchive(root, "node_modules", nil))
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestRestoreArchive(t *testing.T) {
+	root := t.TempDir()
+	createTempFile(t, root, "node_modules/lodash/index.js", "module.exports = {}")
+	createTempFile(t, root, "node_modules/left-pad/index.js", "module.exports = pad")
+	archive, index := uploadTestArchive(t, root)
+
+	newClient := func() *mockS3Client {
+		mockClient := new(mockS3Client)
+		mockClient.On("GetBucketVersioning", mock.Anything).Return(&s3.GetBucketVersioningOutput{}, nil)
+		mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []*s3.Object{
+				{Key: aws.String(archiveKey("node_modules")), Size: aws.Int64(int64(len(archive)))},
+				{Key: aws.String(archiveIndexKey("node_modules")), Size: aws.Int64(int64(len(index)))},
+			},
+		}, nil)
+		mockClient.On("GetObject", mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return *input.Key == archiveIndexKey("node_modules")
+		})).Return(&s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(index))}, nil)
+		return mockClient
+	}
+
+	t.Run("selected paths are extracted", func(t *testing.T) {
+		mockClient := newClient()
+		mockClient.On("GetObject", mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return *input.Key == archiveKey("node_modules")
+		})).Return(&s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(archive))}, nil).Once()
+
+		target := t.TempDir()
+		s := newTestSyncer(t, mockClient)
+		require.NoError(t, s.Restore(target, time.Time{}, RestoreSelection{Paths: []string{"node_modules/lodash"}}))
+
+		content, err := os.ReadFile(filepath.Join(target, "node_modules", "lodash", "index.js"))
+		require.NoError(t, err)
+		assert.Equal(t, "module.exports = {}", string(content))
+		assert.NoFileExists(t, filepath.Join(target, "node_modules", "left-pad", "index.js"))
+	})
+
+	t.Run("archives without selected paths are not downloaded", func(t *testing.T) {
+		mockClient := newClient()
+
+		s := newTestSyncer(t, mockClient)
+		require.NoError(t, s.Restore(t.TempDir(), time.Time{}, RestoreSelection{Paths: []string{"documentos"}}))
+		mockClient.AssertNotCalled(t, "GetObject", mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return *input.Key == archiveKey("node_modules")
+		}))
+	})
+}
@@ -0,0 +1,84 @@
+package sync
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// ParseBandwidth parses a rate in bytes per second such as "2M", "512K",
+// "1.5MB" or "800000"; K, M and G are powers of 1024.
+func ParseBandwidth(value string) (int64, error) {
+	rate, ok := parseBytes(value)
+	if !ok {
+		return 0, i18n.Errorf("bandwidth.invalid", value)
+	}
+	return rate, nil
+}
+
+// parseBytes parses a positive number of bytes such as "2M", "512K",
+// "1.5MB" or "800000"; K, M and G are powers of 1024.
+func parseBytes(value string) (int64, bool) {
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	unit := int64(1)
+	for suffix, size := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if n, ok := strings.CutSuffix(number, suffix); ok {
+			number, unit = n, size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return int64(n * float64(unit)), true
+}
+
+// bandwidthLimiter spreads the bytes of every body sharing it over time so
+// that together they stay under rate bytes per second.
+type bandwidthLimiter struct {
+	rate int64
+
+	mu sync.Mutex
+	// next is when the bytes let through so far are paid for.
+	next time.Time
+}
+
+func newBandwidthLimiter(rate int64) *bandwidthLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{rate: rate}
+}
+
+// wait blocks until n more bytes fit in the rate. A nil limiter never
+// blocks.
+func (l *bandwidthLimiter) wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.rate))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// uploadBody wraps body for the upload to key, counting its progress and
+// pacing it to Config.LowPriorityBandwidth when key is PriorityLow.
+func (s *Syncer) uploadBody(key string, body io.ReadSeeker) *progressReader {
+	r := &progressReader{body: body, stats: s.stats}
+	if s.lowPriority != nil && s.priority(key) == PriorityLow {
+		r.limiter = s.lowPriority
+	}
+	return r
+}
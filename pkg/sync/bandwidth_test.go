@@ -0,0 +1,50 @@
+package sync
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: bandwidth
+func TestParseBandwidth(t *testing.T) {
+	tests := map[string]int64{
+		"800000": 800000,
+		"512K":   512 << 10,
+		"2M":     2 << 20,
+		"1.5MB":  3 << 19,
+		"1g":     1 << 30,
+	}
+	for value, want := range tests {
+		got, err := ParseBandwidth(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+
+	for _, value := range []string{"", "M", "0", "-1K", "fast"} {
+		_, err := ParseBandwidth(value)
+		assert.Equal(t, "bandwidth.invalid", i18n.ID(err), value)
+	}
+}
+
+func TestBandwidthLimiter(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	s.rules = []Rule{{Pattern: "*.mp4", Priority: PriorityLow}}
+	s.lowPriority = newBandwidthLimiter(10000)
+
+	assert.Nil(t, s.uploadBody("a.txt", bytes.NewReader(nil)).limiter, "only low-priority uploads are paced")
+
+	body := s.uploadBody("a.mp4", bytes.NewReader(make([]byte, 3000)))
+	start := time.Now()
+	n, err := io.Copy(io.Discard, body)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3000), n)
+	assert.GreaterOrEqual(t, time.Since(start), 250*time.Millisecond, "3000 bytes at 10000 B/s take 300ms")
+
+	assert.Nil(t, newBandwidthLimiter(0), "no limit without a rate")
+}
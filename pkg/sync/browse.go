@@ -0,0 +1,145 @@
+package sync
+
+import (
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// RemoteEntry is an object or, when listing one level, a common prefix
+// (Dir) of the bucket.
+type RemoteEntry struct {
+	Key          string     `json:"key"`
+	Dir          bool       `json:"dir,omitempty"`
+	Size         int64      `json:"size,omitempty"`
+	StorageClass string     `json:"storage_class,omitempty"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+}
+
+// RemoteObject describes one object, with the file details gui-sync stored
+// in its metadata. Size is that of the original file, which differs from
+// ContentLength for compressed objects; ModTime, Mode, Hash, Symlink and
+// HardLink are empty for objects not uploaded by gui-sync. Metadata holds
+// the remaining, user-defined metadata.
+type RemoteObject struct {
+	Key             string            `json:"key"`
+	Size            int64             `json:"size"`
+	ContentLength   int64             `json:"content_length"`
+	ContentType     string            `json:"content_type,omitempty"`
+	ContentEncoding string            `json:"content_encoding,omitempty"`
+	StorageClass    string            `json:"storage_class"`
+	LastModified    time.Time         `json:"last_modified"`
+	ETag            string            `json:"etag"`
+	VersionID       string            `json:"version_id,omitempty"`
+	Encryption      string            `json:"encryption,omitempty"`
+	ModTime         *time.Time        `json:"mod_time,omitempty"`
+	Mode            os.FileMode       `json:"mode,omitempty"`
+	Hash            string            `json:"hash,omitempty"`
+	Symlink         string            `json:"symlink,omitempty"`
+	HardLink        string            `json:"hard_link,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+}
+
+// List returns the entries of the bucket under prefix. Unless recursive,
+// only one level is listed, as a directory listing would: the keys below
+// it are folded into Dir entries.
+func (s *Syncer) List(prefix string, recursive bool) ([]RemoteEntry, error) {
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(s.cfg.Bucket)}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+	if !recursive {
+		input.Delimiter = aws.String("/")
+	}
+
+	var entries []RemoteEntry
+	err := s.client.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, p := range page.CommonPrefixes {
+			entries = append(entries, RemoteEntry{Key: aws.StringValue(p.Prefix), Dir: true})
+		}
+		for _, obj := range page.Contents {
+			entries = append(entries, RemoteEntry{
+				Key:          aws.StringValue(obj.Key),
+				Size:         aws.Int64Value(obj.Size),
+				StorageClass: storageClass(obj.StorageClass),
+				LastModified: obj.LastModified,
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, i18n.Errorf("s3.list_objects", err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// Stat describes the object at key.
+func (s *Syncer) Stat(key string) (*RemoteObject, error) {
+	head, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == http.StatusNotFound {
+			return nil, i18n.Errorf("browse.not_found", key)
+		}
+		return nil, i18n.Errorf("s3.head", err)
+	}
+
+	contentLength := aws.Int64Value(head.ContentLength)
+	obj := &RemoteObject{
+		Key:             key,
+		Size:            storedSize(head.Metadata, contentLength),
+		ContentLength:   contentLength,
+		ContentType:     aws.StringValue(head.ContentType),
+		ContentEncoding: aws.StringValue(head.ContentEncoding),
+		StorageClass:    storageClass(head.StorageClass),
+		LastModified:    aws.TimeValue(head.LastModified),
+		ETag:            strings.Trim(aws.StringValue(head.ETag), "\""),
+		VersionID:       aws.StringValue(head.VersionId),
+		Encryption:      aws.StringValue(head.ServerSideEncryption),
+	}
+	if modTime, ok := storedModTime(head.Metadata); ok {
+		obj.ModTime = &modTime
+	}
+	if mode, ok := storedMode(head.Metadata); ok {
+		obj.Mode = mode
+	}
+	if algorithm, digest, ok := storedHash(head.Metadata, s.hashAlgorithm()); ok {
+		obj.Hash = algorithm + ":" + digest
+	}
+	if target, ok := storedSymlink(head.Metadata); ok {
+		obj.Symlink = target
+	}
+	if target, ok := storedHardLink(head.Metadata); ok {
+		obj.HardLink = target
+	}
+	for k, v := range head.Metadata {
+		if reservedMetadataKey(k) {
+			continue
+		}
+		if obj.Metadata == nil {
+			obj.Metadata = make(map[string]string)
+		}
+		obj.Metadata[k] = aws.StringValue(v)
+	}
+	return obj, nil
+}
+
+// storageClass names the storage class of an object; S3 leaves it out for
+// STANDARD in HEAD responses.
+func storageClass(class *string) string {
+	if class == nil || *class == "" {
+		return s3.StorageClassStandard
+	}
+	return *class
+}
@@ -0,0 +1,75 @@
+package sync
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: ls and stat
+func TestList(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	client := new(mockS3Client)
+	client.On("ListObjectsV2Pages", mock.MatchedBy(func(input *s3.ListObjectsV2Input) bool {
+		return aws.StringValue(input.Prefix) == "docs/" && aws.StringValue(input.Delimiter) == "/"
+	}), mock.Anything).Return(&s3.ListObjectsV2Output{
+		CommonPrefixes: []*s3.CommonPrefix{{Prefix: aws.String("docs/old/")}},
+		Contents: []*s3.Object{
+			{Key: aws.String("docs/b.txt"), Size: aws.Int64(2), LastModified: aws.Time(modified), StorageClass: aws.String(s3.StorageClassGlacier)},
+			{Key: aws.String("docs/a.txt"), Size: aws.Int64(1), LastModified: aws.Time(modified)},
+		},
+	}, nil).Once()
+
+	entries, err := newTestSyncer(t, client).List("docs/", false)
+	require.NoError(t, err)
+	assert.Equal(t, []RemoteEntry{
+		{Key: "docs/a.txt", Size: 1, StorageClass: s3.StorageClassStandard, LastModified: &modified},
+		{Key: "docs/b.txt", Size: 2, StorageClass: s3.StorageClassGlacier, LastModified: &modified},
+		{Key: "docs/old/", Dir: true},
+	}, entries)
+}
+
+func TestStat(t *testing.T) {
+	path := createTempFile(t, t.TempDir(), "a.txt", "contents")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	t.Run("object uploaded by gui-sync", func(t *testing.T) {
+		metadata := withSyncMetadata(map[string]*string{"Autor": aws.String("ana")}, info, HashMD5, "abc")
+		client := new(mockS3Client)
+		client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+			ContentLength: aws.Int64(8),
+			ETag:          aws.String(`"abc"`),
+			LastModified:  aws.Time(time.Now()),
+			Metadata:      metadata,
+		}, nil).Once()
+
+		obj, err := newTestSyncer(t, client).Stat("a.txt")
+		require.NoError(t, err)
+		assert.Equal(t, int64(8), obj.Size)
+		assert.Equal(t, s3.StorageClassStandard, obj.StorageClass)
+		assert.Equal(t, "abc", obj.ETag)
+		assert.Equal(t, "md5:abc", obj.Hash)
+		assert.Equal(t, info.Mode().Perm(), obj.Mode)
+		require.NotNil(t, obj.ModTime)
+		assert.True(t, obj.ModTime.Equal(info.ModTime()))
+		assert.Equal(t, map[string]string{"Autor": "ana"}, obj.Metadata, "gui-sync entries are decoded, not repeated")
+	})
+
+	t.Run("missing object", func(t *testing.T) {
+		notFound := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")
+		client := new(mockS3Client)
+		client.On("HeadObject", mock.Anything).Return(nil, notFound).Once()
+
+		_, err := newTestSyncer(t, client).Stat("nope.txt")
+		assert.Equal(t, "browse.not_found", i18n.ID(err))
+	})
+}
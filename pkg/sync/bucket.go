@@ -0,0 +1,128 @@
+package sync
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// PrepareBucket checks, before the first run, that the bucket exists in
+// Config.Region and that the credentials can write to it, so a wrong setup
+// fails at startup with a hint instead of at the first upload. A missing
+// bucket is created when Config.CreateBucket is set. Replicas are checked
+// the same way.
+func (s *Syncer) PrepareBucket() error {
+	if err := s.prepareBucket(); err != nil {
+		return err
+	}
+	for _, r := range s.replicas {
+		if err := r.prepareBucket(); err != nil {
+			return i18n.Errorf("replica.failed", r.cfg.Bucket, err)
+		}
+	}
+	return nil
+}
+
+func (s *Syncer) prepareBucket() error {
+	bucket := s.cfg.Bucket
+
+	// GetBucketLocation needs a permission of its own: when it is denied,
+	// HeadBucket below still tells whether the bucket is reachable.
+	location, err := s.client.GetBucketLocation(&s3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+	switch {
+	case isBucketMissing(err):
+		return s.createBucket()
+	case err == nil && s.cfg.Region != "":
+		region := s3.NormalizeBucketLocation(aws.StringValue(location.LocationConstraint))
+		if region != s.cfg.Region {
+			return i18n.Errorf("bucket.wrong_region", bucket, region, s.cfg.Region, region)
+		}
+	}
+
+	if _, err := s.client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)}); err != nil {
+		switch {
+		case isBucketMissing(err):
+			return s.createBucket()
+		case statusCode(err) == http.StatusForbidden:
+			return i18n.Errorf("bucket.forbidden", bucket, err)
+		default:
+			return i18n.Errorf("bucket.check_failed", bucket, err)
+		}
+	}
+
+	if err := s.putProbe(s.checksumAlgorithm); err != nil {
+		return i18n.Errorf("bucket.read_only", bucket, err)
+	}
+	s.deleteProbe()
+	return nil
+}
+
+// createBucket creates the missing bucket in Config.Region with public
+// access blocked and default encryption, when Config.CreateBucket allows.
+func (s *Syncer) createBucket() error {
+	bucket := s.cfg.Bucket
+	if !s.cfg.CreateBucket {
+		return i18n.Errorf("bucket.not_found", bucket)
+	}
+
+	input := &s3.CreateBucketInput{Bucket: aws.String(bucket)}
+	if s.cfg.Region != "" && s.cfg.Region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(s.cfg.Region),
+		}
+	}
+	if _, err := s.client.CreateBucket(input); err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeBucketAlreadyExists {
+			return i18n.Errorf("bucket.name_taken", bucket)
+		}
+		return i18n.Errorf("bucket.create_failed", bucket, err)
+	}
+
+	_, err := s.client.PutPublicAccessBlock(&s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(bucket),
+		PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	})
+	if err == nil {
+		_, err = s.client.PutBucketEncryption(&s3.PutBucketEncryptionInput{
+			Bucket: aws.String(bucket),
+			ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+				Rules: []*s3.ServerSideEncryptionRule{{
+					ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{
+						SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256),
+					},
+				}},
+			},
+		})
+	}
+	if err != nil {
+		return i18n.Errorf("bucket.configure_failed", bucket, err)
+	}
+
+	fmt.Printf(i18n.T("bucket.created"), bucket, s.cfg.Region)
+	return nil
+}
+
+// isBucketMissing reports whether err says the bucket does not exist.
+// HeadBucket answers a bare 404 without an error code.
+func isBucketMissing(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchBucket {
+		return true
+	}
+	return statusCode(err) == http.StatusNotFound
+}
+
+func statusCode(err error) int {
+	if aerr, ok := err.(awserr.RequestFailure); ok {
+		return aerr.StatusCode()
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: bucket checks at startup
+func TestPrepareBucket(t *testing.T) {
+	noSuchBucket := awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist", nil), 404, "id")
+	forbidden := awserr.NewRequestFailure(awserr.New("Forbidden", "Forbidden", nil), 403, "id")
+	accessDenied := awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "id")
+	location := func(constraint string) *s3.GetBucketLocationOutput {
+		return &s3.GetBucketLocationOutput{LocationConstraint: aws.String(constraint)}
+	}
+	newSyncer := func(t *testing.T, client *mockS3Client) *Syncer {
+		s := newTestSyncer(t, client)
+		s.cfg.Region = "eu-west-1"
+		return s
+	}
+
+	t.Run("existing writable bucket", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetBucketLocation", mock.Anything).Return(location("eu-west-1"), nil)
+		client.On("HeadBucket", mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+		client.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil)
+		client.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, nil)
+
+		require.NoError(t, newSyncer(t, client).PrepareBucket())
+		client.AssertCalled(t, "DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+			return *input.Key == doctorProbeKey
+		}))
+	})
+
+	t.Run("bucket in another region", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetBucketLocation", mock.Anything).Return(location(""), nil)
+
+		err := newSyncer(t, client).PrepareBucket()
+		assert.Equal(t, "bucket.wrong_region", i18n.ID(err))
+		assert.Contains(t, err.Error(), "us-east-1")
+		client.AssertNotCalled(t, "PutObject", mock.Anything)
+	})
+
+	t.Run("missing bucket", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetBucketLocation", mock.Anything).Return(nil, noSuchBucket)
+
+		assert.Equal(t, "bucket.not_found", i18n.ID(newSyncer(t, client).PrepareBucket()))
+		client.AssertNotCalled(t, "CreateBucket", mock.Anything)
+	})
+
+	t.Run("missing bucket is created", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetBucketLocation", mock.Anything).Return(nil, noSuchBucket)
+		client.On("CreateBucket", mock.MatchedBy(func(input *s3.CreateBucketInput) bool {
+			return *input.CreateBucketConfiguration.LocationConstraint == "eu-west-1"
+		})).Return(&s3.CreateBucketOutput{}, nil)
+		client.On("PutPublicAccessBlock", mock.MatchedBy(func(input *s3.PutPublicAccessBlockInput) bool {
+			c := input.PublicAccessBlockConfiguration
+			return *c.BlockPublicAcls && *c.BlockPublicPolicy && *c.IgnorePublicAcls && *c.RestrictPublicBuckets
+		})).Return(&s3.PutPublicAccessBlockOutput{}, nil)
+		client.On("PutBucketEncryption", mock.Anything).Return(&s3.PutBucketEncryptionOutput{}, nil)
+
+		s := newSyncer(t, client)
+		s.cfg.CreateBucket = true
+		require.NoError(t, s.PrepareBucket())
+		client.AssertExpectations(t)
+	})
+
+	t.Run("us-east-1 buckets take no location constraint", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("CreateBucket", mock.MatchedBy(func(input *s3.CreateBucketInput) bool {
+			return input.CreateBucketConfiguration == nil
+		})).Return(&s3.CreateBucketOutput{}, nil)
+		client.On("PutPublicAccessBlock", mock.Anything).Return(&s3.PutPublicAccessBlockOutput{}, nil)
+		client.On("PutBucketEncryption", mock.Anything).Return(&s3.PutBucketEncryptionOutput{}, nil)
+
+		s := newSyncer(t, client)
+		s.cfg.Region = "us-east-1"
+		s.cfg.CreateBucket = true
+		require.NoError(t, s.createBucket())
+	})
+
+	t.Run("name taken by another account", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("CreateBucket", mock.Anything).Return(nil, awserr.New(s3.ErrCodeBucketAlreadyExists, "taken", nil))
+
+		s := newSyncer(t, client)
+		s.cfg.CreateBucket = true
+		assert.Equal(t, "bucket.name_taken", i18n.ID(s.createBucket()))
+	})
+
+	t.Run("location denied falls back to HeadBucket", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetBucketLocation", mock.Anything).Return(nil, accessDenied)
+		client.On("HeadBucket", mock.Anything).Return(nil, forbidden)
+
+		assert.Equal(t, "bucket.forbidden", i18n.ID(newSyncer(t, client).PrepareBucket()))
+	})
+
+	t.Run("read-only credentials", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetBucketLocation", mock.Anything).Return(location("EU"), nil)
+		client.On("HeadBucket", mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+		client.On("PutObject", mock.Anything).Return(nil, accessDenied)
+
+		assert.Equal(t, "bucket.read_only", i18n.ID(newSyncer(t, client).PrepareBucket()))
+	})
+
+	t.Run("replicas are checked too", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetBucketLocation", mock.Anything).Return(location("eu-west-1"), nil)
+		client.On("HeadBucket", mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+		client.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil)
+		client.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, nil)
+		replicaClient := new(mockS3Client)
+		replicaClient.On("GetBucketLocation", mock.Anything).Return(nil, noSuchBucket)
+
+		s := newSyncer(t, client)
+		replica := newSyncer(t, replicaClient)
+		replica.cfg.Bucket = "backup"
+		s.replicas = []*Syncer{replica}
+
+		err := s.PrepareBucket()
+		assert.Equal(t, "replica.failed", i18n.ID(err))
+		assert.Contains(t, err.Error(), "backup")
+	})
+}
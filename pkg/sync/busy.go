@@ -0,0 +1,54 @@
+package sync
+
+import (
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// BusyError reports a file that was being written while gui-sync read it:
+// its size changed since the scan or during the upload, or, on Windows,
+// another program held it locked. Such files are left for the next run
+// instead of failing this one.
+type BusyError struct {
+	Path   string
+	Locked bool
+}
+
+func (e *BusyError) Error() string {
+	if e.Locked {
+		return i18n.T("busy.locked")
+	}
+	return i18n.T("busy.changed")
+}
+
+// checkUnchanged returns a *BusyError when file was written to since
+// before was taken from it.
+func checkUnchanged(file *os.File, before os.FileInfo) error {
+	after, err := file.Stat()
+	if err != nil {
+		return i18n.Errorf("file.stat", err)
+	}
+	if after.Size() != before.Size() || !after.ModTime().Equal(before.ModTime()) {
+		return &BusyError{Path: file.Name()}
+	}
+	return nil
+}
+
+// removePartialUpload deletes the object of input, uploaded from a file
+// that changed midway, so it is never taken for a synced copy.
+func (s *Syncer) removePartialUpload(input *s3.PutObjectInput) {
+	if _, err := s.client.DeleteObject(&s3.DeleteObjectInput{Bucket: input.Bucket, Key: input.Key}); err != nil {
+		log.Printf(i18n.T("busy.delete_failed"), *input.Key, err)
+	}
+}
+
+// deferBusy leaves a file that is being written for the next run; the
+// deleter keeps its object, as for unreadable files.
+func (s *Syncer) deferBusy(relPath string, err error) {
+	s.stats.busy.Add(1)
+	s.report.add(reportAction{Action: actionBusy, Key: relPath, Error: err.Error()})
+	log.Printf(i18n.T("busy.deferred"), relPath, err)
+}
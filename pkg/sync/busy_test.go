@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: files being written
+func TestUploadBusyFile(t *testing.T) {
+	t.Run("size changed since the scan", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		path := createTempFile(t, t.TempDir(), "log.txt", "linha 1\nlinha 2\n")
+
+		s := newTestSyncer(t, mockClient)
+		_, err := s.uploadFileS3("log.txt", path, int64(len("linha 1\n")))
+
+		var busyErr *BusyError
+		require.True(t, errors.As(err, &busyErr))
+		assert.Equal(t, path, busyErr.Path)
+		assert.False(t, busyErr.Locked)
+		mockClient.AssertNotCalled(t, "PutObject", mock.Anything)
+	})
+
+	t.Run("written during the upload", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		path := createTempFile(t, t.TempDir(), "log.txt", "linha 1\n")
+		mockClient.On("PutObject", mock.Anything).Run(func(mock.Arguments) {
+			appendTo(t, path, "linha 2\n")
+		}).Return(&s3.PutObjectOutput{}, nil).Once()
+		mockClient.On("DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+			return *input.Key == "log.txt"
+		})).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+		s := newTestSyncer(t, mockClient)
+		_, err := s.uploadFileS3("log.txt", path, int64(len("linha 1\n")))
+
+		var busyErr *BusyError
+		require.True(t, errors.As(err, &busyErr))
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("written during a multipart upload", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		s := newTestSyncer(t, mockClient)
+		size := int64(2*partSize + 1)
+		path := createSparseFile(t, t.TempDir(), "disk.img", size)
+		file, err := os.Open(path)
+		require.NoError(t, err)
+		defer file.Close()
+
+		mockClient.On("CreateMultipartUpload", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("up-1")}, nil).Once()
+		mockClient.On("UploadPart", mock.Anything).Return(&s3.UploadPartOutput{ETag: aws.String(`"etag"`)}, nil).Times(2)
+		mockClient.On("UploadPart", mock.Anything).Run(func(mock.Arguments) {
+			appendTo(t, path, "x")
+		}).Return(&s3.UploadPartOutput{ETag: aws.String(`"etag"`)}, nil).Once()
+		mockClient.On("AbortMultipartUpload", mock.MatchedBy(func(input *s3.AbortMultipartUploadInput) bool {
+			return *input.UploadId == "up-1"
+		})).Return(&s3.AbortMultipartUploadOutput{}, nil).Once()
+
+		_, err = s.uploadMultipart("disk.img", file, size)
+
+		var busyErr *BusyError
+		require.True(t, errors.As(err, &busyErr))
+		assert.NoFileExists(t, s.checkpointPath("disk.img"))
+		mockClient.AssertNotCalled(t, "CompleteMultipartUpload", mock.Anything)
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestCheckUnchanged(t *testing.T) {
+	path := createTempFile(t, t.TempDir(), "log.txt", "linha 1\n")
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	info, err := file.Stat()
+	require.NoError(t, err)
+
+	assert.NoError(t, checkUnchanged(file, info))
+	appendTo(t, path, "linha 2\n")
+	var busyErr *BusyError
+	assert.True(t, errors.As(checkUnchanged(file, info), &busyErr))
+}
+
+func TestTransferDefersBusyFiles(t *testing.T) {
+	mockClient := new(mockS3Client)
+	path := createTempFile(t, t.TempDir(), "log.txt", "linha 1\nlinha 2\n")
+	s := newTestSyncer(t, mockClient)
+	s.report = &runReport{}
+	result := &SyncResult{}
+	engine := &transferEngine{syncer: s, workers: 1, result: result}
+
+	in := make(chan uploadTask, 1)
+	s.stats.pending.Add(1)
+	in <- uploadTask{path: path, relPath: "log.txt", s3Key: "log.txt", fileSize: 8}
+	close(in)
+	engine.run(in)
+
+	summary := s.stats.summary()
+	assert.Equal(t, int64(1), summary.Busy)
+	assert.Zero(t, summary.Failed)
+	assert.Zero(t, s.stats.pending.Load())
+	assert.Empty(t, result.Files, "busy files do not fail the run")
+	require.Len(t, s.report.actions, 1)
+	assert.Equal(t, actionBusy, s.report.actions[0].Action)
+	mockClient.AssertNotCalled(t, "PutObject", mock.Anything)
+}
+
+func appendTo(t *testing.T, path, content string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
@@ -0,0 +1,31 @@
+package sync
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Errors of files opened by another program without sharing them, or with
+// a locked range.
+const (
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+// lockedError reports whether err comes from a file another program holds
+// locked.
+func lockedError(err error) bool {
+	return errors.Is(err, errorSharingViolation) || errors.Is(err, errorLockViolation)
+}
+
+// fileLocked reports whether another program holds the file at path locked,
+// which keeps it from being read.
+func fileLocked(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return lockedError(err)
+	}
+	file.Close()
+	return false
+}
@@ -0,0 +1,78 @@
+package sync
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/robfig/cron/v3"
+)
+
+// runRecord keeps when the last successful run of a directory and bucket
+// pair finished, so Config.CatchUp can tell after a restart whether a
+// scheduled run was missed, and how many files it scanned, the baseline of
+// Config.MassChangePercent.
+type runRecord struct {
+	formatHeader
+
+	LastSuccess time.Time `json:"last_success"`
+	Files       int64     `json:"files,omitempty"`
+}
+
+func (s *Syncer) runRecordPath() string {
+	root, err := filepath.Abs(s.cfg.RootDir)
+	if err != nil {
+		root = s.cfg.RootDir
+	}
+	sum := sha1.Sum([]byte(s.cfg.Bucket + "\x00" + root))
+	return s.statePath("runs", fmt.Sprintf("%x.json", sum))
+}
+
+// lastSuccess returns when the last successful run finished, or the zero
+// time when it is not known.
+func (s *Syncer) lastSuccess() time.Time {
+	return s.lastRun().LastSuccess
+}
+
+// lastRun returns the record of the last successful run, empty when it is
+// not known.
+func (s *Syncer) lastRun() runRecord {
+	var record runRecord
+	if err := readStateFile(s.runRecordPath(), &record); err != nil {
+		return runRecord{}
+	}
+	return record
+}
+
+// recordSuccess saves at as the end of the last successful run, with the
+// files it scanned. Runs limited by Config.FilesFrom or to the changes of
+// the journal keep the previous count, since they do not scan the whole
+// tree.
+func (s *Syncer) recordSuccess(at time.Time) {
+	record := runRecord{LastSuccess: at, Files: s.stats.summary().Scanned}
+	if s.cfg.FilesFrom != "" || s.incremental {
+		record.Files = s.lastRun().Files
+	}
+	if err := writeStateFile(s.runRecordPath(), &record); err != nil {
+		log.Printf(i18n.T("catchup.record_failed"), err)
+	}
+}
+
+// missedRun reports whether schedule had a run due by now that did not
+// start: one after the start of the last run or, before any run of this
+// process, after the last recorded success.
+func (s *Syncer) missedRun(schedule cron.Schedule, now time.Time) bool {
+	s.mu.Lock()
+	since := s.lastStart
+	s.mu.Unlock()
+	if since.IsZero() {
+		since = s.lastSuccess()
+	}
+	if since.IsZero() {
+		return true
+	}
+	return !schedule.Next(since).After(now)
+}
@@ -0,0 +1,51 @@
+package sync
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: scheduler catch-up
+func TestRunRecord(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.RootDir = t.TempDir()
+	assert.True(t, s.lastSuccess().IsZero())
+
+	at := time.Date(2026, 10, 16, 10, 30, 0, 0, time.UTC)
+	s.recordSuccess(at)
+	assert.True(t, at.Equal(s.lastSuccess()))
+
+	other := newTestSyncer(t, new(mockS3Client))
+	other.stateDir = s.stateDir
+	other.cfg.RootDir = t.TempDir()
+	assert.True(t, other.lastSuccess().IsZero(), "records are per directory and bucket")
+
+	require.NoError(t, os.WriteFile(s.runRecordPath(), []byte("{"), 0600))
+	assert.True(t, s.lastSuccess().IsZero(), "unreadable records count as unknown")
+}
+
+func TestMissedRun(t *testing.T) {
+	hourly, err := cron.ParseStandard("0 * * * *")
+	require.NoError(t, err)
+	at := func(hour, minute int) time.Time { return time.Date(2026, 10, 16, hour, minute, 0, 0, time.Local) }
+
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.RootDir = t.TempDir()
+	assert.True(t, s.missedRun(hourly, at(10, 0)), "never ran")
+
+	s.recordSuccess(at(10, 30))
+	assert.False(t, s.missedRun(hourly, at(10, 59)))
+	assert.True(t, s.missedRun(hourly, at(11, 0)))
+	assert.True(t, s.missedRun(hourly, at(15, 0)), "slept through several runs")
+
+	s.mu.Lock()
+	s.lastStart = at(11, 0)
+	s.mu.Unlock()
+	assert.False(t, s.missedRun(hourly, at(11, 30)), "runs of this process count even when they failed")
+	assert.True(t, s.missedRun(hourly, at(12, 1)))
+}
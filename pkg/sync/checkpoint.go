@@ -0,0 +1,401 @@
+package sync
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// uploadCheckpoint records the progress of a multipart upload so a crashed
+// or interrupted run can resume it instead of starting over.
+type uploadCheckpoint struct {
+	formatHeader
+
+	Bucket   string           `json:"bucket"`
+	Key      string           `json:"key"`
+	UploadID string           `json:"upload_id"`
+	Size     int64            `json:"size"`
+	ModTime  time.Time        `json:"mod_time"`
+	PartSize int64            `json:"part_size"`
+	Parts    []checkpointPart `json:"parts"`
+
+	ChecksumAlgorithm string `json:"checksum_algorithm,omitempty"`
+
+	// Delta uploads: the block hashes of the file, the ETag of the object
+	// being replaced and the parts copied from it.
+	Blocks     []string `json:"blocks,omitempty"`
+	CopySource string   `json:"copy_source_etag,omitempty"`
+	Unchanged  []int64  `json:"unchanged_parts,omitempty"`
+
+	copied int64 // bytes copied instead of uploaded in this run
+}
+
+type checkpointPart struct {
+	Number   int64  `json:"number"`
+	ETag     string `json:"etag"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+func (s *Syncer) checkpointPath(key string) string {
+	sum := sha1.Sum([]byte(s.cfg.Bucket + "/" + key))
+	return s.statePath("checkpoints", fmt.Sprintf("%x.json", sum))
+}
+
+// matches reports whether the checkpoint was written for this exact file
+// version, bucket and part layout.
+func (c *uploadCheckpoint) matches(bucket, algorithm string, size int64, modTime time.Time) bool {
+	return c.Bucket == bucket && c.Size == size && c.ModTime.Equal(modTime) &&
+		c.PartSize == partSize && c.ChecksumAlgorithm == algorithm
+}
+
+func (c *uploadCheckpoint) completed() map[int64]bool {
+	done := make(map[int64]bool, len(c.Parts))
+	for _, part := range c.Parts {
+		done[part.Number] = true
+	}
+	return done
+}
+
+// uploadMultipart uploads file in partSize chunks, persisting a checkpoint
+// after every completed part. If a checkpoint for the same file version
+// exists and its upload is still open on S3, only the missing parts are sent.
+func (s *Syncer) uploadMultipart(s3Key string, file *os.File, fileSize int64) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, i18n.Errorf("file.stat", err)
+	}
+
+	path := s.checkpointPath(s3Key)
+	checkpoint, err := s.resumableCheckpoint(path, s3Key, fileSize, info.ModTime())
+	if err != nil {
+		return 0, err
+	}
+
+	if checkpoint == nil {
+		meta, err := s.objectSettings(s3Key, file.Name())
+		if err != nil {
+			return 0, err
+		}
+		createInput := &s3.CreateMultipartUploadInput{
+			Bucket:            aws.String(s.cfg.Bucket),
+			Key:               aws.String(s3Key),
+			ChecksumAlgorithm: optionalString(s.checksumAlgorithm),
+		}
+		meta.applyMultipart(createInput)
+		s.retention(meta).applyMultipart(createInput)
+		hashes, err := s.hashUpload(file, info, false)
+		if err != nil {
+			return 0, err
+		}
+		createInput.Metadata = s.withXattrs(withSyncMetadata(createInput.Metadata, info, s.hashAlgorithm(), hashes.digest), file.Name())
+		var blocks []string
+		if s.cfg.Delta {
+			if blocks, err = fileBlocks(file, fileSize); err != nil {
+				return 0, err
+			}
+			createInput.Metadata[blocksMetaKey] = aws.String(blocksDigest(blocks))
+		}
+		created, err := s.client.CreateMultipartUpload(createInput)
+		if err != nil {
+			return 0, i18n.Errorf("s3.create_multipart", err)
+		}
+		checkpoint = &uploadCheckpoint{
+			Bucket:   s.cfg.Bucket,
+			Key:      s3Key,
+			UploadID: aws.StringValue(created.UploadId),
+			Size:     fileSize,
+			ModTime:  info.ModTime(),
+			PartSize: partSize,
+
+			ChecksumAlgorithm: s.checksumAlgorithm,
+			Blocks:            blocks,
+		}
+		if blocks != nil {
+			checkpoint.CopySource, checkpoint.Unchanged = s.deltaSource(s3Key, blocks)
+			if len(checkpoint.Unchanged) > 0 {
+				fmt.Printf(i18n.T("checkpoint.delta"), s3Key, len(checkpoint.Unchanged), len(blocks))
+			}
+		}
+		if err := writeStateFile(path, checkpoint); err != nil {
+			log.Printf(i18n.T("checkpoint.save_failed"), s3Key, err)
+		}
+	} else {
+		fmt.Printf(i18n.T("checkpoint.resume"), s3Key, len(checkpoint.Parts))
+	}
+
+	if err := s.uploadMissingParts(file, checkpoint, path); err != nil {
+		// S3 lists a corrupted part as uploaded, so the upload cannot be
+		// resumed; the retry starts over.
+		var verifyErr *VerifyError
+		if errors.As(err, &verifyErr) {
+			s.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(s.cfg.Bucket),
+				Key:      aws.String(s3Key),
+				UploadId: aws.String(checkpoint.UploadID),
+			})
+			os.Remove(path)
+		}
+		return 0, err
+	}
+
+	// Parts read while the file was being written do not make up any
+	// version of it.
+	if err := checkUnchanged(file, info); err != nil {
+		s.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.cfg.Bucket),
+			Key:      aws.String(s3Key),
+			UploadId: aws.String(checkpoint.UploadID),
+		})
+		os.Remove(path)
+		return 0, err
+	}
+
+	sort.Slice(checkpoint.Parts, func(i, j int) bool { return checkpoint.Parts[i].Number < checkpoint.Parts[j].Number })
+	parts := make([]*s3.CompletedPart, 0, len(checkpoint.Parts))
+	for _, part := range checkpoint.Parts {
+		completed := &s3.CompletedPart{ETag: aws.String(part.ETag), PartNumber: aws.Int64(part.Number)}
+		newObjectChecksum(checkpoint.ChecksumAlgorithm, part.Checksum).applyCompleted(completed)
+		parts = append(parts, completed)
+	}
+
+	_, err = s.client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.cfg.Bucket),
+		Key:             aws.String(s3Key),
+		UploadId:        aws.String(checkpoint.UploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return 0, i18n.Errorf("checkpoint.multipart", err)
+	}
+
+	if checkpoint.Blocks != nil {
+		s.writeBlockIndex(checkpoint)
+	}
+	os.Remove(path)
+	return fileSize - checkpoint.copied, nil
+}
+
+// resumableCheckpoint loads the checkpoint at path and reconciles it with
+// S3. It returns nil when there is nothing to resume; stale checkpoints for a
+// different file version are discarded and their upload aborted.
+func (s *Syncer) resumableCheckpoint(path, s3Key string, size int64, modTime time.Time) (*uploadCheckpoint, error) {
+	var checkpoint uploadCheckpoint
+	if err := readStateFile(path, &checkpoint); err != nil {
+		var formatErr *FormatError
+		if errors.As(err, &formatErr) {
+			return nil, err
+		}
+		if !os.IsNotExist(err) {
+			log.Printf("  ⚠ %v", err)
+			os.Remove(path)
+		}
+		return nil, nil
+	}
+
+	if !checkpoint.matches(s.cfg.Bucket, s.checksumAlgorithm, size, modTime) {
+		s.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(checkpoint.Bucket),
+			Key:      aws.String(s3Key),
+			UploadId: aws.String(checkpoint.UploadID),
+		})
+		os.Remove(path)
+		return nil, nil
+	}
+
+	open, err := s.multipartUploadOpen(s3Key, checkpoint.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	if !open {
+		os.Remove(path)
+		return nil, nil
+	}
+
+	// The part list on S3 is authoritative: it includes parts that finished
+	// after the last checkpoint write and omits any that never landed.
+	checkpoint.Parts = nil
+	err = s.client.ListPartsPages(&s3.ListPartsInput{
+		Bucket:   aws.String(s.cfg.Bucket),
+		Key:      aws.String(s3Key),
+		UploadId: aws.String(checkpoint.UploadID),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			checkpoint.Parts = append(checkpoint.Parts, checkpointPart{
+				Number:   aws.Int64Value(part.PartNumber),
+				ETag:     aws.StringValue(part.ETag),
+				Checksum: partChecksum(part),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchUpload {
+			os.Remove(path)
+			return nil, nil
+		}
+		return nil, i18n.Errorf("checkpoint.list_parts", err)
+	}
+
+	return &checkpoint, nil
+}
+
+// multipartUploadOpen reports whether uploadID is still an in-progress
+// multipart upload for s3Key.
+func (s *Syncer) multipartUploadOpen(s3Key, uploadID string) (bool, error) {
+	open := false
+	err := s.client.ListMultipartUploadsPages(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Prefix: aws.String(s3Key),
+	}, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		for _, upload := range page.Uploads {
+			if aws.StringValue(upload.Key) == s3Key && aws.StringValue(upload.UploadId) == uploadID {
+				open = true
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return false, i18n.Errorf("s3.list_multipart", err)
+	}
+	return open, nil
+}
+
+// uploadMissingParts sends every part not yet recorded in checkpoint using
+// partConcurrency workers, saving the checkpoint after each part. Parts
+// unchanged since the object being replaced are copied from it instead,
+// unless it was replaced in the meantime.
+func (s *Syncer) uploadMissingParts(file *os.File, checkpoint *uploadCheckpoint, path string) error {
+	done := checkpoint.completed()
+	unchanged := make(map[int64]bool, len(checkpoint.Unchanged))
+	for _, number := range checkpoint.Unchanged {
+		unchanged[number] = true
+	}
+	totalParts := (checkpoint.Size + partSize - 1) / partSize
+	if totalParts > 10000 {
+		return i18n.Errorf("checkpoint.too_many_parts")
+	}
+
+	partNumbers := make(chan int64)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	for i := 0; i < partConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for number := range partNumbers {
+				offset := (number - 1) * partSize
+				length := int64(partSize)
+				if offset+length > checkpoint.Size {
+					length = checkpoint.Size - offset
+				}
+
+				if unchanged[number] {
+					part, err := s.copyPart(checkpoint, number, offset, length)
+					if err != errSourceChanged {
+						mu.Lock()
+						if err != nil {
+							if firstErr == nil {
+								firstErr = i18n.Errorf("checkpoint.copy_part", number, err)
+							}
+						} else {
+							checkpoint.Parts = append(checkpoint.Parts, part)
+							checkpoint.copied += length
+							if err := writeStateFile(path, checkpoint); err != nil {
+								log.Printf(i18n.T("checkpoint.save_failed"), checkpoint.Key, err)
+							}
+						}
+						mu.Unlock()
+						continue
+					}
+				}
+
+				input := &s3.UploadPartInput{
+					Bucket:     aws.String(s.cfg.Bucket),
+					Key:        aws.String(checkpoint.Key),
+					UploadId:   aws.String(checkpoint.UploadID),
+					PartNumber: aws.Int64(number),
+				}
+
+				var checksum string
+				var err error
+				if checkpoint.ChecksumAlgorithm != "" {
+					checksum, err = computeChecksum(checkpoint.ChecksumAlgorithm, io.NewSectionReader(file, offset, length))
+					newObjectChecksum(checkpoint.ChecksumAlgorithm, checksum).applyPart(input)
+				}
+
+				// Parts S3 received corrupted are sent again at once.
+				var output *s3.UploadPartOutput
+				var verifyErr *VerifyError
+				for attempt := 1; err == nil; attempt++ {
+					verifyErr = nil
+					input.Body = s.uploadBody(checkpoint.Key, io.NewSectionReader(file, offset, length))
+					if output, err = s.client.UploadPart(input); err != nil {
+						break
+					}
+					err = s.verifyPart(input, output, io.NewSectionReader(file, offset, length))
+					if !errors.As(err, &verifyErr) || attempt == verifyPartAttempts {
+						break
+					}
+					log.Printf(i18n.T("upload_verify.part_retry"), checkpoint.Key, number, attempt, verifyPartAttempts)
+					err = nil
+				}
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						if verifyErr != nil {
+							firstErr = verifyErr
+						} else {
+							firstErr = i18n.Errorf("s3.upload_part", number, err)
+						}
+					}
+				} else {
+					checkpoint.Parts = append(checkpoint.Parts, checkpointPart{Number: number, ETag: aws.StringValue(output.ETag), Checksum: checksum})
+					if err := writeStateFile(path, checkpoint); err != nil {
+						log.Printf(i18n.T("checkpoint.save_failed"), checkpoint.Key, err)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for number := int64(1); number <= totalParts; number++ {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		if done[number] {
+			continue
+		}
+		if !s.waitWhilePaused() {
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = i18n.Errorf("checkpoint.paused")
+			}
+			mu.Unlock()
+			break
+		}
+		partNumbers <- number
+	}
+	close(partNumbers)
+	wg.Wait()
+
+	return firstErr
+}
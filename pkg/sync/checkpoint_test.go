@@ -0,0 +1,171 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: resumable multipart uploads
+func TestUploadMultipartCheckpoint(t *testing.T) {
+	// Three parts: two full ones and a one-byte tail.
+	openSparse := func(t *testing.T) (*os.File, int64) {
+		size := int64(2*partSize + 1)
+		path := createSparseFile(t, t.TempDir(), "disk.img", size)
+		file, err := os.Open(path)
+		require.NoError(t, err)
+		t.Cleanup(func() { file.Close() })
+		return file, size
+	}
+
+	t.Run("fresh upload removes checkpoint on completion", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		s := newTestSyncer(t, mockClient)
+		file, size := openSparse(t)
+
+		mockClient.On("CreateMultipartUpload", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("up-1")}, nil).Once()
+		mockClient.On("UploadPart", mock.Anything).Return(&s3.UploadPartOutput{ETag: aws.String("\"etag\"")}, nil).Times(3)
+		mockClient.On("CompleteMultipartUpload", mock.MatchedBy(func(input *s3.CompleteMultipartUploadInput) bool {
+			return len(input.MultipartUpload.Parts) == 3
+		})).Return(&s3.CompleteMultipartUploadOutput{}, nil).Once()
+
+		uploaded, err := s.uploadMultipart("disk.img", file, size)
+		assert.NoError(t, err)
+		assert.Equal(t, size, uploaded)
+		assert.NoFileExists(t, s.checkpointPath("disk.img"))
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("failed upload keeps checkpoint", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		s := newTestSyncer(t, mockClient)
+		file, size := openSparse(t)
+
+		mockClient.On("CreateMultipartUpload", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("up-2")}, nil).Once()
+		mockClient.On("UploadPart", mock.Anything).Return(nil, fmt.Errorf("connection reset"))
+
+		_, err := s.uploadMultipart("disk.img", file, size)
+		assert.Error(t, err)
+
+		var checkpoint uploadCheckpoint
+		require.NoError(t, readStateFile(s.checkpointPath("disk.img"), &checkpoint))
+		assert.Equal(t, "up-2", checkpoint.UploadID)
+		mockClient.AssertNotCalled(t, "AbortMultipartUpload", mock.Anything)
+	})
+
+	t.Run("upload stopped while paused keeps checkpoint", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		s := newTestSyncer(t, mockClient)
+		file, size := openSparse(t)
+		s.Pause()
+		s.stopWaiting()
+
+		mockClient.On("CreateMultipartUpload", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("up-3")}, nil).Once()
+
+		_, err := s.uploadMultipart("disk.img", file, size)
+		assert.Error(t, err)
+
+		var checkpoint uploadCheckpoint
+		require.NoError(t, readStateFile(s.checkpointPath("disk.img"), &checkpoint))
+		assert.Equal(t, "up-3", checkpoint.UploadID)
+		mockClient.AssertNotCalled(t, "UploadPart", mock.Anything)
+		mockClient.AssertNotCalled(t, "AbortMultipartUpload", mock.Anything)
+	})
+
+	t.Run("resume uploads only missing parts", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		s := newTestSyncer(t, mockClient)
+		file, size := openSparse(t)
+		info, err := file.Stat()
+		require.NoError(t, err)
+
+		require.NoError(t, writeStateFile(s.checkpointPath("disk.img"), &uploadCheckpoint{
+			Bucket:   "test-bucket",
+			Key:      "disk.img",
+			UploadID: "up-3",
+			Size:     size,
+			ModTime:  info.ModTime(),
+			PartSize: partSize,
+			Parts:    []checkpointPart{{Number: 1, ETag: "\"e1\""}},
+		}))
+
+		mockClient.On("ListMultipartUploadsPages", mock.Anything, mock.Anything).Return(&s3.ListMultipartUploadsOutput{
+			Uploads: []*s3.MultipartUpload{{Key: aws.String("disk.img"), UploadId: aws.String("up-3")}},
+		}, nil).Once()
+		mockClient.On("ListPartsPages", mock.Anything, mock.Anything).Return(&s3.ListPartsOutput{
+			Parts: []*s3.Part{
+				{PartNumber: aws.Int64(1), ETag: aws.String("\"e1\"")},
+				{PartNumber: aws.Int64(2), ETag: aws.String("\"e2\"")},
+			},
+		}, nil).Once()
+		mockClient.On("UploadPart", mock.MatchedBy(func(input *s3.UploadPartInput) bool {
+			return *input.UploadId == "up-3" && *input.PartNumber == 3
+		})).Return(&s3.UploadPartOutput{ETag: aws.String("\"e3\"")}, nil).Once()
+		mockClient.On("CompleteMultipartUpload", mock.MatchedBy(func(input *s3.CompleteMultipartUploadInput) bool {
+			parts := input.MultipartUpload.Parts
+			return *input.UploadId == "up-3" && len(parts) == 3 &&
+				*parts[0].ETag == "\"e1\"" && *parts[1].ETag == "\"e2\"" && *parts[2].ETag == "\"e3\""
+		})).Return(&s3.CompleteMultipartUploadOutput{}, nil).Once()
+
+		_, err = s.uploadMultipart("disk.img", file, size)
+		assert.NoError(t, err)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("checkpoint for a different file version is discarded", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		s := newTestSyncer(t, mockClient)
+		file, size := openSparse(t)
+
+		require.NoError(t, writeStateFile(s.checkpointPath("disk.img"), &uploadCheckpoint{
+			Bucket:   "test-bucket",
+			Key:      "disk.img",
+			UploadID: "old-upload",
+			Size:     size - 1,
+			PartSize: partSize,
+		}))
+
+		mockClient.On("AbortMultipartUpload", mock.MatchedBy(func(input *s3.AbortMultipartUploadInput) bool {
+			return *input.UploadId == "old-upload"
+		})).Return(&s3.AbortMultipartUploadOutput{}, nil).Once()
+		mockClient.On("CreateMultipartUpload", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("new-upload")}, nil).Once()
+		mockClient.On("UploadPart", mock.Anything).Return(&s3.UploadPartOutput{ETag: aws.String("\"etag\"")}, nil).Times(3)
+		mockClient.On("CompleteMultipartUpload", mock.Anything).Return(&s3.CompleteMultipartUploadOutput{}, nil).Once()
+
+		_, err := s.uploadMultipart("disk.img", file, size)
+		assert.NoError(t, err)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("checkpoint whose upload no longer exists starts over", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		s := newTestSyncer(t, mockClient)
+		file, size := openSparse(t)
+		info, err := file.Stat()
+		require.NoError(t, err)
+
+		require.NoError(t, writeStateFile(s.checkpointPath("disk.img"), &uploadCheckpoint{
+			Bucket:   "test-bucket",
+			Key:      "disk.img",
+			UploadID: "aborted-upload",
+			Size:     size,
+			ModTime:  info.ModTime(),
+			PartSize: partSize,
+		}))
+
+		mockClient.On("ListMultipartUploadsPages", mock.Anything, mock.Anything).Return(&s3.ListMultipartUploadsOutput{}, nil).Once()
+		mockClient.On("CreateMultipartUpload", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("new-upload")}, nil).Once()
+		mockClient.On("UploadPart", mock.Anything).Return(&s3.UploadPartOutput{ETag: aws.String("\"etag\"")}, nil).Times(3)
+		mockClient.On("CompleteMultipartUpload", mock.Anything).Return(&s3.CompleteMultipartUploadOutput{}, nil).Once()
+
+		_, err = s.uploadMultipart("disk.img", file, size)
+		assert.NoError(t, err)
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,124 @@
+package sync
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// checksumAlgorithms lists the supported algorithms in the order the doctor
+// probe tries them.
+var checksumAlgorithms = []string{
+	s3.ChecksumAlgorithmSha256,
+	s3.ChecksumAlgorithmCrc32c,
+	s3.ChecksumAlgorithmCrc32,
+	s3.ChecksumAlgorithmSha1,
+}
+
+func newChecksumHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case s3.ChecksumAlgorithmSha256:
+		return sha256.New(), nil
+	case s3.ChecksumAlgorithmSha1:
+		return sha1.New(), nil
+	case s3.ChecksumAlgorithmCrc32:
+		return crc32.NewIEEE(), nil
+	case s3.ChecksumAlgorithmCrc32c:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	}
+	return nil, i18n.Errorf("checksum.unsupported", algorithm)
+}
+
+// computeChecksum returns the base64 digest of r as S3 expects it in the
+// x-amz-checksum-* headers.
+func computeChecksum(algorithm string, r io.Reader) (string, error) {
+	h, err := newChecksumHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return "", i18n.Errorf("checksum.failed", err)
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// objectChecksum holds a digest in the request field matching its algorithm.
+type objectChecksum struct {
+	crc32, crc32c, sha1, sha256 *string
+}
+
+func newObjectChecksum(algorithm, value string) objectChecksum {
+	var c objectChecksum
+	switch algorithm {
+	case s3.ChecksumAlgorithmCrc32:
+		c.crc32 = aws.String(value)
+	case s3.ChecksumAlgorithmCrc32c:
+		c.crc32c = aws.String(value)
+	case s3.ChecksumAlgorithmSha1:
+		c.sha1 = aws.String(value)
+	case s3.ChecksumAlgorithmSha256:
+		c.sha256 = aws.String(value)
+	}
+	return c
+}
+
+func (c objectChecksum) applyPut(input *s3.PutObjectInput) {
+	input.ChecksumCRC32, input.ChecksumCRC32C, input.ChecksumSHA1, input.ChecksumSHA256 = c.crc32, c.crc32c, c.sha1, c.sha256
+}
+
+func (c objectChecksum) applyPart(input *s3.UploadPartInput) {
+	input.ChecksumCRC32, input.ChecksumCRC32C, input.ChecksumSHA1, input.ChecksumSHA256 = c.crc32, c.crc32c, c.sha1, c.sha256
+}
+
+func (c objectChecksum) applyCompleted(part *s3.CompletedPart) {
+	part.ChecksumCRC32, part.ChecksumCRC32C, part.ChecksumSHA1, part.ChecksumSHA256 = c.crc32, c.crc32c, c.sha1, c.sha256
+}
+
+// partChecksum extracts the digest S3 reports for an uploaded part.
+func partChecksum(part *s3.Part) string {
+	for _, value := range []*string{part.ChecksumSHA256, part.ChecksumCRC32C, part.ChecksumCRC32, part.ChecksumSHA1} {
+		if value != nil {
+			return *value
+		}
+	}
+	return ""
+}
+
+// copyPartChecksum extracts the digest S3 reports for a copied part.
+func copyPartChecksum(result *s3.CopyPartResult) string {
+	for _, value := range []*string{result.ChecksumSHA256, result.ChecksumCRC32C, result.ChecksumCRC32, result.ChecksumSHA1} {
+		if value != nil {
+			return *value
+		}
+	}
+	return ""
+}
+
+// setPutChecksum computes the checksum the bucket requires of body and
+// attaches it to input, rewinding body afterwards. Buckets without a
+// requirement recorded by `gui-sync doctor` rely on the default
+// Content-MD5/ETag behaviour instead.
+func (s *Syncer) setPutChecksum(input *s3.PutObjectInput, body io.ReadSeeker) error {
+	if s.checksumAlgorithm == "" {
+		return nil
+	}
+
+	value, err := computeChecksum(s.checksumAlgorithm, body)
+	if err != nil {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return i18n.Errorf("file.rewind", err)
+	}
+
+	input.ChecksumAlgorithm = aws.String(s.checksumAlgorithm)
+	newObjectChecksum(s.checksumAlgorithm, value).applyPut(input)
+	return nil
+}
@@ -0,0 +1,87 @@
+package sync
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// runMaintenance runs the housekeeping tasks that follow every sync run.
+// Failures are only logged: maintenance never fails a sync.
+func (s *Syncer) runMaintenance() {
+	if s.cfg.AbortStaleAfter <= 0 {
+		return
+	}
+
+	uploads, err := s.StaleUploads(s.cfg.AbortStaleAfter)
+	if err != nil {
+		log.Printf(i18n.T("cleanup.warning"), err)
+		return
+	}
+	if len(uploads) == 0 {
+		return
+	}
+
+	aborted, err := s.AbortUploads(uploads)
+	if err != nil {
+		log.Printf(i18n.T("cleanup.warning"), err)
+	}
+	fmt.Printf(i18n.T("cleanup.aborted"), aborted)
+}
+
+// StaleUploads lists incomplete multipart uploads initiated more than maxAge
+// ago.
+func (s *Syncer) StaleUploads(maxAge time.Duration) ([]*s3.MultipartUpload, error) {
+	cutoff := time.Now().Add(-maxAge)
+
+	var uploads []*s3.MultipartUpload
+	err := s.client.ListMultipartUploadsPages(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s.cfg.Bucket),
+	}, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		for _, upload := range page.Uploads {
+			if upload.Initiated != nil && upload.Initiated.Before(cutoff) {
+				uploads = append(uploads, upload)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, i18n.Errorf("s3.list_multipart", err)
+	}
+
+	return uploads, nil
+}
+
+// AbortUploads aborts every upload and drops matching local checkpoints so
+// the next run does not try to resume them. It returns how many succeeded.
+func (s *Syncer) AbortUploads(uploads []*s3.MultipartUpload) (int, error) {
+	aborted := 0
+	var lastErr error
+
+	for _, upload := range uploads {
+		_, err := s.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.cfg.Bucket),
+			Key:      upload.Key,
+			UploadId: upload.UploadId,
+		})
+		if err != nil {
+			lastErr = i18n.Errorf("cleanup.abort_failed", aws.StringValue(upload.Key), err)
+			log.Printf("  ❌ %v", lastErr)
+			continue
+		}
+		aborted++
+
+		path := s.checkpointPath(aws.StringValue(upload.Key))
+		var checkpoint uploadCheckpoint
+		if readStateFile(path, &checkpoint) == nil && checkpoint.UploadID == aws.StringValue(upload.UploadId) {
+			os.Remove(path)
+		}
+	}
+
+	return aborted, lastErr
+}
@@ -0,0 +1,62 @@
+package sync
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: stale multipart upload cleanup
+func TestStaleUploads(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+
+	mockClient := new(mockS3Client)
+	mockClient.On("ListMultipartUploadsPages", mock.Anything, mock.Anything).Return(&s3.ListMultipartUploadsOutput{
+		Uploads: []*s3.MultipartUpload{
+			{Key: aws.String("old.bin"), UploadId: aws.String("u1"), Initiated: &old},
+			{Key: aws.String("recent.bin"), UploadId: aws.String("u2"), Initiated: &recent},
+		},
+	}, nil).Once()
+
+	uploads, err := newTestSyncer(t, mockClient).StaleUploads(24 * time.Hour)
+	require.NoError(t, err)
+	require.Len(t, uploads, 1)
+	assert.Equal(t, "old.bin", *uploads[0].Key)
+	mockClient.AssertExpectations(t)
+}
+
+func TestAbortUploads(t *testing.T) {
+	mockClient := new(mockS3Client)
+	s := newTestSyncer(t, mockClient)
+
+	require.NoError(t, writeStateFile(s.checkpointPath("a.bin"), &uploadCheckpoint{UploadID: "u1"}))
+	require.NoError(t, writeStateFile(s.checkpointPath("b.bin"), &uploadCheckpoint{UploadID: "other"}))
+
+	mockClient.On("AbortMultipartUpload", mock.MatchedBy(func(input *s3.AbortMultipartUploadInput) bool {
+		return *input.UploadId == "u1"
+	})).Return(&s3.AbortMultipartUploadOutput{}, nil).Once()
+	mockClient.On("AbortMultipartUpload", mock.MatchedBy(func(input *s3.AbortMultipartUploadInput) bool {
+		return *input.UploadId == "u2"
+	})).Return(&s3.AbortMultipartUploadOutput{}, nil).Once()
+	mockClient.On("AbortMultipartUpload", mock.MatchedBy(func(input *s3.AbortMultipartUploadInput) bool {
+		return *input.UploadId == "u3"
+	})).Return(nil, fmt.Errorf("access denied")).Once()
+
+	aborted, err := s.AbortUploads([]*s3.MultipartUpload{
+		{Key: aws.String("a.bin"), UploadId: aws.String("u1")},
+		{Key: aws.String("b.bin"), UploadId: aws.String("u2")},
+		{Key: aws.String("c.bin"), UploadId: aws.String("u3")},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 2, aborted)
+	assert.NoFileExists(t, s.checkpointPath("a.bin"))
+	assert.FileExists(t, s.checkpointPath("b.bin"))
+	mockClient.AssertExpectations(t)
+}
@@ -0,0 +1,133 @@
+package sync
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// CompressGzip is the only compression supported by rules and sidecars:
+// the standard library has no zstd encoder. Objects are stored with
+// Content-Encoding: gzip under their usual key, so browsers and HTTP clients
+// decompress them transparently.
+const CompressGzip = "gzip"
+
+// maxCompressedPut is the largest object S3 accepts in a single PutObject.
+// Compressed files are always sent that way, since their size is only known
+// once compressed.
+const maxCompressedPut = 5 * 1024 * 1024 * 1024
+
+func validateCompression(compress string) error {
+	if compress != "" && compress != CompressGzip {
+		return i18n.Errorf("compress.invalid", compress, CompressGzip)
+	}
+	return nil
+}
+
+// uploadCompressed gzips the file at filePath into a temporary file and
+// uploads that. The metadata keeps the size and hash of the original, so
+// change detection and restore work on the uncompressed contents.
+func (s *Syncer) uploadCompressed(s3Key, filePath string, meta *objectMeta) (int64, error) {
+	file, err := os.Open(filePath)
+	if lockedError(err) {
+		return 0, &BusyError{Path: filePath, Locked: true}
+	}
+	if err != nil {
+		return 0, i18n.Errorf("file.open", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, i18n.Errorf("file.stat", err)
+	}
+	// The original is hashed while it is compressed, unless the differ
+	// already hashed it.
+	algorithm := s.hashAlgorithm()
+	digest, cached := s.digests.lookup(filePath, info, algorithm)
+	var source io.Reader = file
+	var h hash.Hash
+	if !cached {
+		if h, err = newContentHash(algorithm); err != nil {
+			return 0, err
+		}
+		source = io.TeeReader(file, h)
+	}
+
+	compressed, err := os.CreateTemp("", "gui-sync-gzip-*")
+	if err != nil {
+		return 0, i18n.Errorf("file.temp", err)
+	}
+	defer os.Remove(compressed.Name())
+	defer compressed.Close()
+
+	gz := gzip.NewWriter(compressed)
+	if _, err := io.Copy(gz, source); err != nil {
+		return 0, i18n.Errorf("compress.failed", err)
+	}
+	if err := gz.Close(); err != nil {
+		return 0, i18n.Errorf("compress.failed", err)
+	}
+	if err := checkUnchanged(file, info); err != nil {
+		return 0, err
+	}
+	if h != nil {
+		digest = hex.EncodeToString(h.Sum(nil))
+	}
+	size, err := compressed.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, i18n.Errorf("compress.failed", err)
+	}
+	if size > maxCompressedPut {
+		return 0, i18n.Errorf("compress.too_large")
+	}
+	if _, err := compressed.Seek(0, io.SeekStart); err != nil {
+		return 0, i18n.Errorf("file.rewind", err)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(s3Key),
+		Body:   s.uploadBody(s3Key, compressed),
+	}
+	meta.applyPut(input)
+	s.retention(meta).applyPut(input)
+	input.ContentEncoding = aws.String(CompressGzip)
+	input.Metadata = s.withXattrs(withSyncMetadata(input.Metadata, info, algorithm, digest), filePath)
+	input.Metadata[sizeMetaKey] = aws.String(strconv.FormatInt(info.Size(), 10))
+	input.Metadata[compressionMetaKey] = aws.String(CompressGzip)
+	if err := s.setPutChecksum(input, compressed); err != nil {
+		return 0, err
+	}
+
+	output, err := s.client.PutObject(input)
+	if err != nil {
+		return 0, i18n.Errorf("s3.upload", err)
+	}
+	if err := s.verifyPut(input, output, compressed, "", ""); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// decompressedBody undoes the compression of an object uploaded by
+// uploadCompressed. Go's HTTP client may already have decompressed it, in
+// which case the response has no Content-Encoding left.
+func decompressedBody(output *s3.GetObjectOutput) (io.Reader, error) {
+	compression, _ := metadataValue(output.Metadata, compressionMetaKey)
+	if compression != CompressGzip || aws.StringValue(output.ContentEncoding) != CompressGzip {
+		return output.Body, nil
+	}
+	gz, err := gzip.NewReader(output.Body)
+	if err != nil {
+		return nil, i18n.Errorf("compress.decompress", err)
+	}
+	return gz, nil
+}
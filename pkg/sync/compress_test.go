@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: compressed uploads
+func TestCompressedRoundTrip(t *testing.T) {
+	content := strings.Repeat("<p>gui-sync</p>\n", 1000)
+	tempDir := t.TempDir()
+	path := createTempFile(t, tempDir, "site/index.html", content)
+
+	var uploaded []byte
+	var metadata map[string]*string
+	mockClient := new(mockS3Client)
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return aws.StringValue(input.ContentEncoding) == CompressGzip &&
+			aws.StringValue(input.CacheControl) == "no-cache"
+	})).Run(func(args mock.Arguments) {
+		input := args.Get(0).(*s3.PutObjectInput)
+		uploaded, _ = io.ReadAll(input.Body)
+		metadata = input.Metadata
+	}).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	s.rules = []Rule{{Pattern: "*.html", Compress: CompressGzip, CacheControl: "no-cache"}}
+
+	size, err := s.uploadFileS3("site/index.html", path, int64(len(content)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(uploaded)), size, "the compressed size is reported")
+	assert.Less(t, len(uploaded), len(content))
+	mockClient.AssertExpectations(t)
+
+	t.Run("unchanged file is not uploaded again", func(t *testing.T) {
+		mockClient.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+			ContentLength: aws.Int64(int64(len(uploaded))),
+			LastModified:  aws.Time(time.Now().Add(-time.Hour)),
+			ETag:          aws.String(`"compressed"`),
+			Metadata:      metadata,
+		}, nil).Once()
+
+		changed, err := s.fileChangedOnS3("site/index.html", path)
+		require.NoError(t, err)
+		assert.False(t, changed)
+	})
+
+	for name, encoding := range map[string]*string{
+		"restore decompresses":                 aws.String(CompressGzip),
+		"restore keeps a body already decoded": nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			body := uploaded
+			if encoding == nil {
+				// Go's HTTP client decodes gzip itself and drops the header.
+				body = []byte(content)
+			}
+			mockClient := new(mockS3Client)
+			mockClient.On("GetObject", mock.Anything).Return(&s3.GetObjectOutput{
+				Body:            io.NopCloser(bytes.NewReader(body)),
+				ContentEncoding: encoding,
+				Metadata:        metadata,
+			}, nil).Once()
+
+			target := t.TempDir()
+			require.NoError(t, newTestSyncer(t, mockClient).downloadObject(restoreObject{key: "site/index.html"}, target))
+			restored, err := os.ReadFile(filepath.Join(target, "site", "index.html"))
+			require.NoError(t, err)
+			assert.Equal(t, content, string(restored))
+		})
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	assert.NoError(t, validateCompression(""))
+	assert.NoError(t, validateCompression(CompressGzip))
+	assert.Error(t, validateCompression("zstd"))
+}
@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"context"
+)
+
+// S3 prices of us-east-1, in USD, used by CostEstimate. Uploads into S3 and
+// DELETE requests are free.
+const (
+	putRequestPrice = 0.005 / 1000 // PUT, COPY, POST and LIST requests
+	acceleratePrice = 0.04         // per GB through Transfer Acceleration
+	listPageSize    = 1000
+)
+
+// CostEstimate counts the S3 requests and the data a sync run would send
+// to apply a diff, with their approximate cost. Comparisons (HEAD
+// requests), deduplication and delta uploads are not accounted for.
+type CostEstimate struct {
+	// Puts counts the PUT requests, including every call of a multipart
+	// upload; Multipart is how many files are uploaded in parts.
+	Puts      int64 `json:"puts"`
+	Multipart int64 `json:"multipart"`
+	Lists     int64 `json:"lists"`
+	Deletes   int64 `json:"deletes"`
+	Bytes     int64 `json:"bytes"`
+
+	// RequestCost is the cost of the requests and TransferCost that of
+	// Transfer Acceleration, when enabled.
+	RequestCost  float64 `json:"request_cost"`
+	TransferCost float64 `json:"transfer_cost"`
+}
+
+// Total returns the whole cost of the run.
+func (c CostEstimate) Total() float64 {
+	return c.RequestCost + c.TransferCost
+}
+
+// DiffCost is Diff, also estimating what applying the differences costs.
+func (s *Syncer) DiffCost(ctx context.Context, prefix string) ([]DiffEntry, CostEstimate, error) {
+	entries, listed, err := s.diff(ctx, prefix, nil)
+	if err != nil {
+		return nil, CostEstimate{}, err
+	}
+	return entries, s.estimateCost(entries, listed), nil
+}
+
+// estimateCost counts the requests of a run applying entries over a bucket
+// listing of listed objects.
+func (s *Syncer) estimateCost(entries []DiffEntry, listed int) CostEstimate {
+	var c CostEstimate
+	// Like the deleter, a --files-from run does not list the bucket.
+	if s.cfg.FilesFrom == "" {
+		c.Lists = int64(max(1, (listed+listPageSize-1)/listPageSize))
+	}
+
+	for _, e := range entries {
+		switch e.Change {
+		case DiffOnlyRemote:
+			c.Deletes++
+		case DiffOnlyLocal, DiffModified:
+			c.Bytes += e.LocalSize
+			if e.LocalSize <= multipartThreshold {
+				c.Puts++
+				continue
+			}
+			// CreateMultipartUpload, the parts and CompleteMultipartUpload.
+			c.Multipart++
+			c.Puts += 2 + (e.LocalSize+partSize-1)/partSize
+		}
+	}
+
+	c.RequestCost = float64(c.Puts+c.Lists) * putRequestPrice
+	if s.cfg.Accelerate {
+		c.TransferCost = float64(c.Bytes) / (1 << 30) * acceleratePrice
+	}
+	return c
+}
@@ -0,0 +1,68 @@
+package sync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: run cost estimate
+func TestEstimateCost(t *testing.T) {
+	entries := []DiffEntry{
+		{Key: "new.txt", Change: DiffOnlyLocal, LocalSize: 10},
+		{Key: "changed.txt", Change: DiffModified, LocalSize: 20, RemoteSize: 5},
+		// 120MB: create, three 50MB parts and complete.
+		{Key: "video.mp4", Change: DiffOnlyLocal, LocalSize: 120 << 20},
+		{Key: "removed.txt", Change: DiffOnlyRemote, RemoteSize: 7},
+	}
+
+	s := newTestSyncer(t, new(mockS3Client))
+	c := s.estimateCost(entries, 2500)
+	assert.Equal(t, int64(7), c.Puts)
+	assert.Equal(t, int64(1), c.Multipart)
+	assert.Equal(t, int64(3), c.Lists)
+	assert.Equal(t, int64(1), c.Deletes)
+	assert.Equal(t, int64(30+120<<20), c.Bytes)
+	assert.InDelta(t, 10*putRequestPrice, c.RequestCost, 1e-12)
+	assert.Zero(t, c.TransferCost)
+
+	t.Run("empty bucket is listed once", func(t *testing.T) {
+		assert.Equal(t, int64(1), s.estimateCost(nil, 0).Lists)
+	})
+
+	t.Run("--files-from runs do not list", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.FilesFrom = "list.txt"
+		assert.Zero(t, s.estimateCost(nil, 0).Lists)
+	})
+
+	t.Run("Transfer Acceleration is charged per GB", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.Accelerate = true
+		c := s.estimateCost([]DiffEntry{{Key: "big.bin", Change: DiffOnlyLocal, LocalSize: 2 << 30}}, 0)
+		assert.InDelta(t, 2*acceleratePrice, c.TransferCost, 1e-12)
+		assert.InDelta(t, c.RequestCost+c.TransferCost, c.Total(), 1e-12)
+	})
+}
+
+func TestDiffCost(t *testing.T) {
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "new.txt", "new")
+
+	client := new(mockS3Client)
+	client.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []*s3.Object{
+		{Key: aws.String("removed.txt"), Size: aws.Int64(7)},
+	}}, nil)
+
+	s := newTestSyncer(t, client)
+	s.cfg.RootDir = tempDir
+	entries, c, err := s.DiffCost(context.Background(), "")
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, CostEstimate{Puts: 1, Lists: 1, Deletes: 1, Bytes: 3, RequestCost: 2 * putRequestPrice}, c)
+}
@@ -0,0 +1,100 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// credentialErrorCodes are the AWS error codes meaning the credentials are
+// missing, expired or no longer accepted, which retrying cannot fix.
+var credentialErrorCodes = []string{
+	"ExpiredToken",
+	"ExpiredTokenException",
+	"InvalidClientTokenId",
+	"InvalidToken",
+	"TokenRefreshRequired",
+	"SSOProviderInvalidToken",
+	"NoCredentialProviders",
+	"SignatureDoesNotMatch",
+}
+
+// CredentialError reports a run that could not authenticate. Its message
+// tells the user how to renew the credentials of the configured source.
+type CredentialError struct {
+	Err         error
+	Credentials Credentials
+}
+
+func (e *CredentialError) Error() string {
+	var hint string
+	switch {
+	case e.Credentials.RoleARN != "":
+		hint = fmt.Sprintf(i18n.T("credentials.hint_role"), e.Credentials.RoleARN)
+	case e.Credentials.Profile != "":
+		hint = fmt.Sprintf(i18n.T("credentials.hint_profile"), e.Credentials.Profile)
+	default:
+		hint = i18n.T("credentials.hint_static")
+	}
+	return fmt.Sprintf(i18n.T("credentials.expired"), e.Err, hint)
+}
+
+func (e *CredentialError) Unwrap() error { return e.Err }
+
+// isCredentialError reports whether err was caused by the credentials.
+func isCredentialError(err error) bool {
+	return findAWSError(err, func(aerr awserr.Error) bool {
+		return slices.Contains(credentialErrorCodes, aerr.Code())
+	})
+}
+
+// findAWSError reports whether fn holds for an AWS error in the chain of
+// err, following the original errors the SDK keeps in them, which it does
+// not unwrap.
+func findAWSError(err error, fn func(awserr.Error) bool) bool {
+	var aerr awserr.Error
+	for errors.As(err, &aerr) {
+		if fn(aerr) {
+			return true
+		}
+		err = aerr.OrigErr()
+	}
+	return false
+}
+
+// explainCredentialError turns credential failures into a CredentialError
+// and returns other errors unchanged.
+func (s *Syncer) explainCredentialError(err error) error {
+	if _, ok := err.(*CredentialError); ok || !isCredentialError(err) {
+		return err
+	}
+	return &CredentialError{Err: err, Credentials: s.cfg.Credentials}
+}
+
+// checkCredentials makes sure credentials are available before a run, so
+// an expired login fails once with guidance instead of once per file. The
+// SDK refreshes temporary credentials (STS, SSO) here when they expired.
+func (s *Syncer) checkCredentials(ctx context.Context) error {
+	if s.sess == nil {
+		return nil
+	}
+	if _, err := s.sess.Config.Credentials.GetWithContext(ctx); err != nil {
+		return &CredentialError{Err: err, Credentials: s.cfg.Credentials}
+	}
+	return nil
+}
+
+// retryExpiredCredentials retries once a request rejected for expired
+// credentials. The SDK expires the cached credentials before retrying, so
+// the retry is signed with freshly refreshed ones.
+func retryExpiredCredentials(r *request.Request) {
+	if r.Error != nil && r.IsErrorExpired() && r.RetryCount == 0 {
+		r.Retryable = aws.Bool(true)
+	}
+}
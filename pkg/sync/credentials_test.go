@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type expiredProvider struct{}
+
+func (expiredProvider) Retrieve() (credentials.Value, error) {
+	return credentials.Value{}, awserr.New("SSOProviderInvalidToken", "the SSO session has expired", nil)
+}
+
+func (expiredProvider) IsExpired() bool { return true }
+
+// Test Suite: credential expiry handling
+func TestExplainCredentialError(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.Credentials = Credentials{Profile: "backup"}
+
+	err := s.explainCredentialError(i18n.Errorf("s3.upload", awserr.NewRequestFailure(awserr.New("ExpiredToken", "The provided token has expired.", nil), 400, "id")))
+	var credErr *CredentialError
+	require.True(t, errors.As(err, &credErr))
+	assert.Contains(t, err.Error(), "aws sso login --profile backup")
+
+	assert.Same(t, credErr, s.explainCredentialError(credErr), "already explained errors are kept")
+
+	other := i18n.Errorf("s3.upload", awserr.New("AccessDenied", "Access Denied", nil))
+	assert.Equal(t, other, s.explainCredentialError(other), "unrelated errors are unchanged")
+	text := errors.New("ExpiredToken: status code: 400")
+	assert.Equal(t, text, s.explainCredentialError(text), "codes are not guessed from the text")
+	nested := awserr.New("RequestError", "send request failed", awserr.New("NoCredentialProviders", "no valid providers in chain", nil))
+	assert.IsType(t, &CredentialError{}, s.explainCredentialError(nested), "original errors are followed")
+	assert.Nil(t, s.explainCredentialError(nil))
+}
+
+func TestCheckCredentials(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	assert.NoError(t, s.checkCredentials(context.Background()), "injected clients skip the check")
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewCredentials(expiredProvider{}),
+	})
+	require.NoError(t, err)
+	s.sess = sess
+	s.cfg.Credentials = Credentials{RoleARN: "arn:aws:iam::123456789012:role/backup"}
+
+	err = s.checkCredentials(context.Background())
+	var credErr *CredentialError
+	require.True(t, errors.As(err, &credErr))
+	assert.Contains(t, err.Error(), "SSOProviderInvalidToken")
+	assert.Contains(t, err.Error(), "role/backup")
+}
+
+func TestRetryExpiredCredentials(t *testing.T) {
+	newRequest := func(code string, retries int) *request.Request {
+		r := &request.Request{Error: awserr.New(code, "", nil), RetryCount: retries}
+		retryExpiredCredentials(r)
+		return r
+	}
+
+	assert.True(t, aws.BoolValue(newRequest("ExpiredToken", 0).Retryable), "expired token is retried once")
+	assert.True(t, aws.BoolValue(newRequest("RequestExpired", 0).Retryable))
+	assert.Nil(t, newRequest("ExpiredToken", 1).Retryable, "a second expiry is not retried")
+	assert.Nil(t, newRequest("AccessDenied", 0).Retryable)
+}
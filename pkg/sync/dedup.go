@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// maxCopyObjectSize is the largest object a single CopyObject can copy.
+const maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+
+// contentIndex maps content digests to a key holding that content in the
+// bucket, for Config.Dedup. It is filled during a run by uploads and by
+// the unchanged objects the differ inspects, and emptied between runs. The
+// zero value is ready to use.
+type contentIndex struct {
+	mu   sync.Mutex
+	keys map[string]string
+}
+
+func (c *contentIndex) reset() {
+	c.mu.Lock()
+	c.keys = nil
+	c.mu.Unlock()
+}
+
+func (c *contentIndex) add(algorithm, digest, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		c.keys = make(map[string]string)
+	}
+	if _, ok := c.keys[algorithm+":"+digest]; !ok {
+		c.keys[algorithm+":"+digest] = key
+	}
+}
+
+func (c *contentIndex) lookup(algorithm, digest string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key, ok := c.keys[algorithm+":"+digest]
+	return key, ok
+}
+
+// duplicateOf returns the key of an object holding the contents of the file
+// uploaded to s3Key: one uploaded or found in sync during the run, or else
+// one of the object index, which reports indexed since the object may have
+// been deleted by someone else since.
+func (s *Syncer) duplicateOf(s3Key, digest string, size int64) (source string, indexed, ok bool) {
+	if source, ok := s.contents.lookup(s.hashAlgorithm(), digest); ok {
+		return source, false, source != s3Key
+	}
+	for _, key := range s.objects.lookup(indexedObject{Hash: s.hashAlgorithm() + ":" + digest, Size: size}) {
+		if key != s3Key {
+			return key, true, true
+		}
+	}
+	return "", false, false
+}
+
+// copySource is the x-amz-copy-source value naming key in the bucket.
+func (s *Syncer) copySource(key string) *string {
+	return aws.String((&url.URL{Path: s.cfg.Bucket + "/" + key}).EscapedPath())
+}
+
+// rememberObject adds the object at key, found up to date on S3, to the
+// content index and the object index. Compressed objects and symbolic and
+// hard links do not hold the bytes of a local file and are left out.
+func (s *Syncer) rememberObject(key string, size int64, metadata map[string]*string) {
+	if !s.cfg.Dedup && s.objects == nil {
+		return
+	}
+	if _, ok := metadataValue(metadata, compressionMetaKey); ok {
+		s.objects.remove(key)
+		return
+	}
+	if _, ok := storedSymlink(metadata); ok {
+		s.objects.remove(key)
+		return
+	}
+	if _, ok := storedHardLink(metadata); ok {
+		s.objects.remove(key)
+		return
+	}
+	if algorithm, digest, ok := storedHash(metadata, s.hashAlgorithm()); ok && algorithm == s.hashAlgorithm() {
+		if s.cfg.Dedup {
+			s.contents.add(algorithm, digest, key)
+		}
+		s.indexObject(key, algorithm, digest, size)
+	}
+}
+
+// copyDuplicate creates s3Key as a copy of source, an object with the same
+// contents as the file at path, instead of uploading the file.
+func (s *Syncer) copyDuplicate(s3Key, source, path string, info os.FileInfo, meta *objectMeta, digest string) error {
+	if err := s.copyObjectFrom(s3Key, source, path, info, meta, digest); err != nil {
+		return err
+	}
+	s.stats.deduplicated.Add(1)
+	s.stats.bytesDeduplicated.Add(info.Size())
+	fmt.Printf(i18n.T("dedup.copied"), s3Key, source)
+	return nil
+}
+
+// copyObjectFrom creates s3Key as a copy of source, whose contents are
+// those of the file at path. The copy gets the settings and sync metadata
+// of s3Key, as an upload would.
+func (s *Syncer) copyObjectFrom(s3Key, source, path string, info os.FileInfo, meta *objectMeta, digest string) error {
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(s.cfg.Bucket),
+		Key:               aws.String(s3Key),
+		CopySource:        s.copySource(source),
+		MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+		ChecksumAlgorithm: optionalString(s.checksumAlgorithm),
+	}
+	meta.applyCopy(input)
+	s.retention(meta).applyCopy(input)
+	input.Metadata = s.withXattrs(withSyncMetadata(input.Metadata, info, s.hashAlgorithm(), digest), path)
+
+	if _, err := s.client.CopyObject(input); err != nil {
+		return i18n.Errorf("dedup.copy", source, s3Key, err)
+	}
+	s.indexObject(s3Key, s.hashAlgorithm(), digest, info.Size())
+	return nil
+}
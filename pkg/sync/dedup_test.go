@@ -0,0 +1,155 @@
+package sync
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: deduplication of identical files
+func TestDedupUpload(t *testing.T) {
+	tempDir := t.TempDir()
+	original := createTempFile(t, tempDir, "fotos/praia.jpg", "mesmo conteúdo")
+	duplicate := createTempFile(t, tempDir, "copia de fotos/praia.jpg", "mesmo conteúdo")
+	other := createTempFile(t, tempDir, "fotos/serra.jpg", "outro conteúdo")
+
+	mockClient := new(mockS3Client)
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return *input.Key == "fotos/praia.jpg" || *input.Key == "fotos/serra.jpg"
+	})).Return(&s3.PutObjectOutput{}, nil).Twice()
+	mockClient.On("CopyObject", mock.MatchedBy(func(input *s3.CopyObjectInput) bool {
+		_, hasMtime := metadataValue(input.Metadata, mtimeMetaKey)
+		return *input.Key == "copia de fotos/praia.jpg" &&
+			*input.CopySource == "test-bucket/fotos/praia.jpg" &&
+			aws.StringValue(input.MetadataDirective) == s3.MetadataDirectiveReplace &&
+			hasMtime
+	})).Return(&s3.CopyObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	s.cfg.Dedup = true
+
+	for key, path := range map[string]string{"fotos/praia.jpg": original, "fotos/serra.jpg": other} {
+		size, err := s.uploadFileS3(key, path, 15)
+		require.NoError(t, err)
+		assert.NotZero(t, size)
+	}
+	size, err := s.uploadFileS3("copia de fotos/praia.jpg", duplicate, int64(len("mesmo conteúdo")))
+	require.NoError(t, err)
+	assert.Zero(t, size, "duplicates send no bytes")
+
+	mockClient.AssertExpectations(t)
+	summary := s.stats.summary()
+	assert.Equal(t, int64(1), summary.Deduplicated)
+	assert.Equal(t, int64(len("mesmo conteúdo")), summary.BytesDeduplicated)
+}
+
+func TestDedupFromUnchangedObject(t *testing.T) {
+	tempDir := t.TempDir()
+	synced := createTempFile(t, tempDir, "a.txt", "conteúdo")
+	added := createTempFile(t, tempDir, "b.txt", "conteúdo")
+	info, err := os.Stat(synced)
+	require.NoError(t, err)
+	digest, err := fileContentHash(HashMD5, synced)
+	require.NoError(t, err)
+
+	mockClient := new(mockS3Client)
+	mockClient.On("HeadObject", mock.MatchedBy(func(input *s3.HeadObjectInput) bool {
+		return *input.Key == "a.txt"
+	})).Return(&s3.HeadObjectOutput{
+		ContentLength: aws.Int64(info.Size()),
+		LastModified:  aws.Time(time.Now().Add(time.Hour)),
+		Metadata:      withSyncMetadata(nil, info, HashMD5, digest),
+	}, nil)
+	mockClient.On("CopyObject", mock.MatchedBy(func(input *s3.CopyObjectInput) bool {
+		return *input.Key == "b.txt" && *input.CopySource == "test-bucket/a.txt"
+	})).Return(&s3.CopyObjectOutput{}, nil).Once()
+
+	t.Run("disabled", func(t *testing.T) {
+		s := newTestSyncer(t, mockClient)
+		changed, err := s.fileChangedOnS3("a.txt", synced)
+		require.NoError(t, err)
+		assert.False(t, changed)
+		_, found := s.contents.lookup(HashMD5, digest)
+		assert.False(t, found)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		s := newTestSyncer(t, mockClient)
+		s.cfg.Dedup = true
+		changed, err := s.fileChangedOnS3("a.txt", synced)
+		require.NoError(t, err)
+		assert.False(t, changed)
+
+		_, err = s.uploadFileS3("b.txt", added, info.Size())
+		require.NoError(t, err)
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestDedupCopyFailure(t *testing.T) {
+	tempDir := t.TempDir()
+	original := createTempFile(t, tempDir, "a.txt", "conteúdo")
+	duplicate := createTempFile(t, tempDir, "b.txt", "conteúdo")
+
+	mockClient := new(mockS3Client)
+	mockClient.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+	mockClient.On("CopyObject", mock.Anything).Return(nil, awserr.New("AccessDenied", "Access Denied", nil)).Once()
+
+	s := newTestSyncer(t, mockClient)
+	s.cfg.Dedup = true
+	_, err := s.uploadFileS3("a.txt", original, 9)
+	require.NoError(t, err)
+	_, err = s.uploadFileS3("b.txt", duplicate, 9)
+	assert.Error(t, err)
+	assert.Zero(t, s.stats.summary().Deduplicated)
+}
+
+func TestDedupFromObjectIndex(t *testing.T) {
+	tempDir := t.TempDir()
+	added := createTempFile(t, tempDir, "musicas/faixa.mp3", "conteúdo")
+	digest, err := fileContentHash(HashMD5, added)
+	require.NoError(t, err)
+	object := indexedObject{Hash: HashMD5 + ":" + digest, Size: 9}
+
+	t.Run("copied from an object of an earlier run", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		mockClient.On("CopyObject", mock.MatchedBy(func(input *s3.CopyObjectInput) bool {
+			return *input.Key == "musicas/faixa.mp3" && *input.CopySource == "test-bucket/albuns/faixa.mp3"
+		})).Return(&s3.CopyObjectOutput{}, nil).Once()
+
+		s := newTestSyncer(t, mockClient)
+		s.cfg.Dedup = true
+		s.objects = s.loadObjectIndex(tempDir)
+		s.objects.set("albuns/faixa.mp3", object)
+
+		size, err := s.uploadFileS3("musicas/faixa.mp3", added, 9)
+		require.NoError(t, err)
+		assert.Zero(t, size)
+		mockClient.AssertExpectations(t)
+		assert.Equal(t, int64(1), s.stats.summary().Deduplicated)
+	})
+
+	t.Run("uploaded when the indexed object is gone", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		mockClient.On("CopyObject", mock.Anything).Return(nil, awserr.New(s3.ErrCodeNoSuchKey, "gone", nil)).Once()
+		mockClient.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+
+		s := newTestSyncer(t, mockClient)
+		s.cfg.Dedup = true
+		s.objects = s.loadObjectIndex(tempDir)
+		s.objects.set("albuns/faixa.mp3", object)
+
+		size, err := s.uploadFileS3("musicas/faixa.mp3", added, 9)
+		require.NoError(t, err)
+		assert.Equal(t, int64(9), size)
+		mockClient.AssertExpectations(t)
+		assert.Equal(t, []string{"musicas/faixa.mp3"}, s.objects.lookup(object))
+	})
+}
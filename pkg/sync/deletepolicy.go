@@ -0,0 +1,195 @@
+package sync
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// DeletePolicy says when the objects of files removed locally are deleted.
+// The zero value deletes them at the first run that finds the files gone.
+type DeletePolicy struct {
+	// Never keeps them.
+	Never bool
+	// After, when positive, waits until the files have been missing for
+	// this long, at every run since the first one that found them gone.
+	After time.Duration
+	// Runs, when positive, waits until this many runs in a row found the
+	// files gone.
+	Runs int
+}
+
+// delayed reports whether objects wait before they are deleted.
+func (p DeletePolicy) delayed() bool {
+	return p.After > 0 || p.Runs > 1
+}
+
+// ParseDeletePolicy parses the value of --delete: "immediate", "never",
+// "after=" with a period ParseRetention accepts, such as "after=72h" or
+// "after=3d", or "after=" with a number of runs, such as "after=3runs".
+func ParseDeletePolicy(value string) (DeletePolicy, error) {
+	switch value {
+	case "", "immediate":
+		return DeletePolicy{}, nil
+	case "never":
+		return DeletePolicy{Never: true}, nil
+	}
+	period, ok := strings.CutPrefix(value, "after=")
+	if !ok {
+		return DeletePolicy{}, i18n.Errorf("deleter.invalid_policy", value)
+	}
+	if number, ok := strings.CutSuffix(period, "runs"); ok {
+		runs, err := strconv.Atoi(number)
+		if err != nil || runs < 1 {
+			return DeletePolicy{}, i18n.Errorf("deleter.invalid_policy", value)
+		}
+		return DeletePolicy{Runs: runs}, nil
+	}
+	after, err := ParseRetention(period)
+	if err != nil || after <= 0 {
+		return DeletePolicy{}, i18n.Errorf("deleter.invalid_policy", value)
+	}
+	return DeletePolicy{After: after}, nil
+}
+
+// missingFile is the state file of the objects whose files are missing,
+// with a delayed DeletePolicy.
+type missingFile struct {
+	formatHeader
+
+	Bucket string                   `json:"bucket"`
+	Keys   map[string]*missingEntry `json:"keys"`
+}
+
+// missingEntry tracks an object whose file is missing.
+type missingEntry struct {
+	// Since is when a run first found the file gone, and Runs how many runs
+	// in a row did.
+	Since time.Time `json:"since"`
+	Runs  int       `json:"runs"`
+}
+
+// missingKeys follows the objects whose files are missing during a run of
+// the deleter: those of the previous runs, and the ones this run finds
+// gone, which replace them.
+type missingKeys struct {
+	policy DeletePolicy
+	bucket string
+	path   string
+	now    time.Time
+
+	previous map[string]*missingEntry
+	mu       sync.Mutex
+	next     map[string]*missingEntry
+	// waiting counts the objects this run keeps for later.
+	waiting int
+}
+
+func (s *Syncer) missingKeysPath() string {
+	root, err := filepath.Abs(s.cfg.RootDir)
+	if err != nil {
+		root = s.cfg.RootDir
+	}
+	sum := sha1.Sum([]byte(s.prefixScoped(s.cfg.Bucket + "\x00" + root)))
+	return s.statePath("missing", fmt.Sprintf("%x.json", sum))
+}
+
+// loadMissingKeys returns the objects found missing by earlier runs, or nil
+// unless the policy delays deletions.
+func (s *Syncer) loadMissingKeys() *missingKeys {
+	if !s.cfg.Delete.delayed() {
+		return nil
+	}
+	m := &missingKeys{
+		policy:   s.cfg.Delete,
+		bucket:   s.cfg.Bucket,
+		path:     s.missingKeysPath(),
+		now:      time.Now(),
+		previous: make(map[string]*missingEntry),
+		next:     make(map[string]*missingEntry),
+	}
+	var file missingFile
+	if err := readStateFile(m.path, &file); err == nil && file.Bucket == s.cfg.Bucket && file.Keys != nil {
+		m.previous = file.Keys
+	}
+	return m
+}
+
+// waitingBefore reports whether earlier runs left objects waiting.
+func (m *missingKeys) waitingBefore() bool {
+	return m != nil && len(m.previous) > 0
+}
+
+// tracked reports whether an earlier run found the file of key missing.
+func (m *missingKeys) tracked(key string) bool {
+	if m == nil {
+		return false
+	}
+	_, ok := m.previous[key]
+	return ok
+}
+
+// due records that the file of key is missing in this run and reports
+// whether its object is deleted now. The key stays recorded until deleted
+// drops it, so that an object whose deletion fails is not forgotten.
+func (m *missingKeys) due(key string) bool {
+	if m == nil {
+		return true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := &missingEntry{Since: m.now}
+	if prev, ok := m.previous[key]; ok {
+		entry.Since = prev.Since
+		entry.Runs = prev.Runs
+	}
+	entry.Runs++
+	m.next[key] = entry
+	if (m.policy.After <= 0 || m.now.Sub(entry.Since) >= m.policy.After) && entry.Runs >= m.policy.Runs {
+		return true
+	}
+	m.waiting++
+	return false
+}
+
+// deleted drops key, whose object the deleter removed.
+func (m *missingKeys) deleted(key string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.next, key)
+}
+
+// save records the objects still waiting, dropping those whose files came
+// back.
+func (m *missingKeys) save() {
+	if m == nil {
+		return
+	}
+	if err := writeStateFile(m.path, &missingFile{Bucket: m.bucket, Keys: m.next}); err != nil {
+		log.Printf(i18n.T("deleter.save_failed"), err)
+	}
+	if m.waiting > 0 {
+		fmt.Printf(i18n.T("deleter.waiting"), m.waiting)
+	}
+}
+
+// underAny reports whether key is one of prefixes or below one of them.
+func underAny(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if key == prefix || strings.HasPrefix(key, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
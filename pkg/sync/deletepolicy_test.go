@@ -0,0 +1,186 @@
+package sync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: deletion policy
+func TestParseDeletePolicy(t *testing.T) {
+	cases := map[string]DeletePolicy{
+		"":            {},
+		"immediate":   {},
+		"never":       {Never: true},
+		"after=72h":   {After: 72 * time.Hour},
+		"after=2d":    {After: 48 * time.Hour},
+		"after=3runs": {Runs: 3},
+	}
+	for value, want := range cases {
+		policy, err := ParseDeletePolicy(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, policy, value)
+	}
+
+	for _, value := range []string{"later", "after=", "after=0runs", "after=xruns", "after=-1h", "after=3"} {
+		_, err := ParseDeletePolicy(value)
+		assert.Equal(t, "deleter.invalid_policy", i18n.ID(err), value)
+	}
+
+	assert.False(t, DeletePolicy{Runs: 1}.delayed(), "one run is the same as immediate")
+	assert.True(t, DeletePolicy{Runs: 2}.delayed())
+}
+
+func TestDeleterNeverDeletes(t *testing.T) {
+	mockClient := new(mockS3Client)
+	s := newTestSyncer(t, mockClient)
+	s.cfg.Delete = DeletePolicy{Never: true}
+
+	require.NoError(t, (&deleter{syncer: s}).run(keysOf()))
+	mockClient.AssertNotCalled(t, "ListObjectsV2Pages", mock.Anything, mock.Anything)
+}
+
+func TestDeleterGracePeriod(t *testing.T) {
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		Contents: []*s3.Object{{Key: aws.String("old.txt")}, {Key: aws.String("back.txt")}},
+	}, nil)
+	s := newTestSyncer(t, mockClient)
+	s.cfg.RootDir = t.TempDir()
+	s.cfg.Delete = DeletePolicy{After: 72 * time.Hour}
+
+	require.NoError(t, (&deleter{syncer: s}).run(keysOf()))
+	mockClient.AssertNotCalled(t, "DeleteObject", mock.Anything)
+
+	var file missingFile
+	require.NoError(t, readStateFile(s.missingKeysPath(), &file))
+	require.Contains(t, file.Keys, "old.txt")
+	require.Contains(t, file.Keys, "back.txt")
+	since := file.Keys["old.txt"].Since
+
+	// A run before the end of the period keeps the objects, from the time the
+	// first run found them missing.
+	require.NoError(t, (&deleter{syncer: s}).run(keysOf("back.txt")))
+	mockClient.AssertNotCalled(t, "DeleteObject", mock.Anything)
+	file = missingFile{}
+	require.NoError(t, readStateFile(s.missingKeysPath(), &file))
+	require.Contains(t, file.Keys, "old.txt")
+	assert.True(t, file.Keys["old.txt"].Since.Equal(since))
+	assert.Equal(t, 2, file.Keys["old.txt"].Runs)
+	assert.NotContains(t, file.Keys, "back.txt", "files that came back are dropped")
+
+	file.Keys["old.txt"].Since = time.Now().Add(-73 * time.Hour)
+	require.NoError(t, writeStateFile(s.missingKeysPath(), &file))
+	mockClient.On("DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+		return *input.Key == "old.txt"
+	})).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+	require.NoError(t, (&deleter{syncer: s}).run(keysOf("back.txt")))
+	mockClient.AssertExpectations(t)
+	file = missingFile{}
+	require.NoError(t, readStateFile(s.missingKeysPath(), &file))
+	assert.Empty(t, file.Keys)
+}
+
+func TestDeleterAfterRuns(t *testing.T) {
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		Contents: []*s3.Object{{Key: aws.String("old.txt")}},
+	}, nil)
+	s := newTestSyncer(t, mockClient)
+	s.cfg.RootDir = t.TempDir()
+	s.cfg.Delete = DeletePolicy{Runs: 3}
+
+	for run := 1; run < 3; run++ {
+		require.NoError(t, (&deleter{syncer: s}).run(keysOf()))
+		mockClient.AssertNotCalled(t, "DeleteObject", mock.Anything)
+	}
+
+	mockClient.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, nil).Once()
+	require.NoError(t, (&deleter{syncer: s}).run(keysOf()))
+	mockClient.AssertExpectations(t)
+}
+
+func TestDeleterKeepsWaitingObjectsWhoseDeletionFailed(t *testing.T) {
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		Contents: []*s3.Object{{Key: aws.String("old.txt")}},
+	}, nil)
+	mockClient.On("DeleteObject", mock.Anything).Return(nil, errors.New("connection reset")).Once()
+	s := newTestSyncer(t, mockClient)
+	s.cfg.RootDir = t.TempDir()
+	s.cfg.Delete = DeletePolicy{Runs: 2}
+	require.NoError(t, writeStateFile(s.missingKeysPath(), &missingFile{
+		Bucket: s.cfg.Bucket,
+		Keys:   map[string]*missingEntry{"old.txt": {Since: time.Now(), Runs: 1}},
+	}))
+
+	require.NoError(t, (&deleter{syncer: s}).run(keysOf()))
+	var file missingFile
+	require.NoError(t, readStateFile(s.missingKeysPath(), &file))
+	require.Contains(t, file.Keys, "old.txt", "the deletion is retried by the next run")
+	assert.Equal(t, 2, file.Keys["old.txt"].Runs)
+
+	mockClient.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, nil).Once()
+	require.NoError(t, (&deleter{syncer: s}).run(keysOf()))
+	mockClient.AssertExpectations(t)
+	file = missingFile{}
+	require.NoError(t, readStateFile(s.missingKeysPath(), &file))
+	assert.Empty(t, file.Keys)
+}
+
+func TestMissingKeysPathScopedToThePrefix(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.RootDir = t.TempDir()
+	unscoped := s.missingKeysPath()
+
+	s.cfg.KeyTemplate = "{{date}}/{{relpath}}"
+	require.NoError(t, s.updateKeyPrefix(time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)))
+	first := s.missingKeysPath()
+	require.NoError(t, s.updateKeyPrefix(time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local)))
+
+	assert.NotEqual(t, unscoped, first)
+	assert.NotEqual(t, first, s.missingKeysPath())
+}
+
+func TestDeleterPrefixesWithWaitingObjects(t *testing.T) {
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectsV2Pages", mock.MatchedBy(func(input *s3.ListObjectsV2Input) bool {
+		return input.Prefix == nil
+	}), mock.Anything).Return(&s3.ListObjectsV2Output{
+		Contents: []*s3.Object{
+			{Key: aws.String("dir/new.txt")},
+			{Key: aws.String("waiting.txt")},
+			{Key: aws.String("other.txt")},
+		},
+	}, nil).Once()
+	mockClient.On("DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+		return *input.Key == "waiting.txt"
+	})).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	s.cfg.RootDir = t.TempDir()
+	s.cfg.Delete = DeletePolicy{Runs: 2}
+	require.NoError(t, writeStateFile(s.missingKeysPath(), &missingFile{
+		Bucket: s.cfg.Bucket,
+		Keys:   map[string]*missingEntry{"waiting.txt": {Since: time.Now(), Runs: 1}},
+	}))
+
+	// The bucket is listed whole to find waiting.txt again; other.txt is
+	// outside the prefixes and untracked, so it is left alone.
+	require.NoError(t, (&deleter{syncer: s, prefixes: []string{"dir"}}).run(keysOf()))
+	mockClient.AssertExpectations(t)
+
+	var file missingFile
+	require.NoError(t, readStateFile(s.missingKeysPath(), &file))
+	assert.Contains(t, file.Keys, "dir/new.txt")
+	assert.NotContains(t, file.Keys, "other.txt")
+	assert.NotContains(t, file.Keys, "waiting.txt")
+}
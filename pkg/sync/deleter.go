@@ -0,0 +1,166 @@
+package sync
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// deleter is the last pipeline stage: once uploads are done it removes
+// objects whose local file no longer exists, using a pool of workers fed
+// while the bucket listing is still paging.
+type deleter struct {
+	syncer  *Syncer
+	workers int
+	// unreadable lists local paths the scanner could not read, or did not
+	// enter with Config.OneFileSystem; objects at or below them are kept,
+	// since their files may well still exist.
+	unreadable []string
+	// prefixes, when not nil, limits the deletions to the objects at or
+	// below these keys, for runs that visited the paths of the change
+	// journal only.
+	prefixes []string
+	// result, when set, receives the deletions that failed.
+	result *SyncResult
+	// missing follows the objects a delayed Config.Delete keeps for now.
+	missing *missingKeys
+}
+
+// run deletes every object outside reservedPrefix and reportsPrefix whose
+// key is not in localKeys, listing the whole bucket or the prefixes only,
+// as Config.Delete allows.
+func (d *deleter) run(localKeys *keySet) error {
+	if d.syncer.cfg.Delete.Never {
+		fmt.Println(i18n.T("deleter.never"))
+		return nil
+	}
+
+	local, err := localKeys.cursor()
+	if err != nil {
+		return i18n.Errorf("s3.delete", err)
+	}
+	defer local.close()
+
+	workers := d.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	missing := d.syncer.loadMissingKeys()
+	d.missing = missing
+
+	stale := make(chan *s3.Object, 100)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range stale {
+				if !d.syncer.waitWhilePaused() {
+					continue
+				}
+				d.delete(obj)
+			}
+		}()
+	}
+
+	// Objects waiting since earlier runs are looked at again even when the
+	// run lists prefixes only; one listing of the bucket finds them all.
+	listed := d.prefixes
+	if listed != nil && missing.waitingBefore() {
+		listed = nil
+	}
+
+	consider := func(obj *s3.Object) {
+		if d.prefixes != nil && !underAny(*obj.Key, d.prefixes) && !missing.tracked(*obj.Key) {
+			return
+		}
+		if strings.HasPrefix(*obj.Key, reservedPrefix) || strings.HasPrefix(*obj.Key, reportsPrefix) {
+			return
+		}
+		if !local.has(*obj.Key) && !d.isUnreadable(*obj.Key) && !d.syncer.skipDelete(*obj.Key) && missing.due(*obj.Key) {
+			d.syncer.massChanges.fileRemoved()
+			stale <- obj
+		}
+	}
+
+	if listed == nil {
+		err = d.syncer.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+			Bucket: aws.String(d.syncer.cfg.Bucket),
+			Prefix: optionalString(d.syncer.keyPrefix),
+		}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, obj := range page.Contents {
+				consider(obj)
+			}
+			return true
+		})
+	}
+	// A listing of "a" also returns "ab", which consider leaves out.
+	for _, prefix := range listed {
+		err = d.syncer.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+			Bucket: aws.String(d.syncer.cfg.Bucket),
+			Prefix: aws.String(prefix),
+		}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, obj := range page.Contents {
+				consider(obj)
+			}
+			return true
+		})
+		if err != nil {
+			break
+		}
+	}
+	close(stale)
+	wg.Wait()
+	// Keys the cursor could not read were all taken for local files.
+	if err == nil {
+		err = local.err
+	}
+	if err != nil {
+		return i18n.Errorf("s3.delete", err)
+	}
+	missing.save()
+
+	return nil
+}
+
+func (d *deleter) isUnreadable(key string) bool {
+	for _, path := range d.unreadable {
+		if key == path || strings.HasPrefix(key, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *deleter) delete(obj *s3.Object) {
+	_, err := d.syncer.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(d.syncer.cfg.Bucket),
+		Key:    obj.Key,
+	})
+	action := reportAction{Action: actionDelete, Key: *obj.Key, Size: aws.Int64Value(obj.Size)}
+	if isLockedError(err) {
+		action.Error = err.Error()
+		if d.result != nil {
+			d.result.add(FileResult{Key: *obj.Key, Status: StatusLocked, Err: err})
+		}
+		fmt.Printf(i18n.T("deleter.locked"), *obj.Key)
+	} else if err != nil {
+		action.Error = err.Error()
+		if d.result != nil {
+			d.result.add(FileResult{Key: *obj.Key, Status: StatusDeleteFailed, Err: err})
+		}
+		log.Printf(i18n.T("deleter.failed"), *obj.Key, err)
+	} else {
+		d.syncer.objects.remove(*obj.Key)
+		d.missing.deleted(*obj.Key)
+		d.syncer.stats.deleted.Add(1)
+		fmt.Printf(i18n.T("deleter.deleted"), *obj.Key)
+	}
+	d.syncer.report.add(action)
+}
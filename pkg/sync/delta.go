@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Delta uploads (Config.Delta) keep, for every object uploaded in parts, the
+// SHA-256 of each partSize block of the file. When the file changes, blocks
+// whose hash is unchanged are copied from the current object on S3 with
+// UploadPartCopy instead of being sent again, so a small change to a large
+// disk image only uploads the parts it touched.
+//
+// The block list of a 50 GB file does not fit in the 2 KB of user metadata
+// S3 allows, so it is kept in the state directory and the object carries
+// its digest (blocksMetaKey). The list is only trusted while the digest on
+// the object matches it, which an upload by anyone else clears.
+
+// errSourceChanged reports that the object a delta upload copies parts
+// from was replaced after the upload started.
+var errSourceChanged = i18n.Errorf("delta.source_changed")
+
+// blockIndex is the block list of the object last uploaded to Key.
+type blockIndex struct {
+	formatHeader
+
+	Bucket   string   `json:"bucket"`
+	Key      string   `json:"key"`
+	PartSize int64    `json:"part_size"`
+	Digest   string   `json:"digest"`
+	Blocks   []string `json:"blocks"`
+}
+
+func (s *Syncer) blockIndexPath(key string) string {
+	sum := sha1.Sum([]byte(s.cfg.Bucket + "/" + key))
+	return s.statePath("blocks", fmt.Sprintf("%x.json", sum))
+}
+
+// fileBlocks hashes file in partSize blocks, several at once.
+func fileBlocks(file *os.File, size int64) ([]string, error) {
+	sums, err := hashParts(file, size, partSize, sha256.New)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]string, len(sums))
+	for i, sum := range sums {
+		blocks[i] = hex.EncodeToString(sum)
+	}
+	return blocks, nil
+}
+
+func blocksDigest(blocks []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(blocks, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// deltaSource compares blocks with the block index of the current object at
+// s3Key. It returns the ETag of that object and the numbers of the parts
+// that can be copied from it, or no parts when there is nothing to reuse.
+func (s *Syncer) deltaSource(s3Key string, blocks []string) (string, []int64) {
+	var index blockIndex
+	if err := readStateFile(s.blockIndexPath(s3Key), &index); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("  ⚠ %v", err)
+		}
+		return "", nil
+	}
+	if index.Bucket != s.cfg.Bucket || index.PartSize != partSize {
+		return "", nil
+	}
+
+	// The object is being replaced: this is the last read of it.
+	head, err := s.headObject(s3Key)
+	s.heads.forget(s3Key)
+	if err != nil {
+		return "", nil
+	}
+	if digest, _ := metadataValue(head.Metadata, blocksMetaKey); digest != index.Digest {
+		return "", nil
+	}
+
+	var unchanged []int64
+	for i, block := range blocks {
+		if i < len(index.Blocks) && index.Blocks[i] == block {
+			unchanged = append(unchanged, int64(i+1))
+		}
+	}
+	return aws.StringValue(head.ETag), unchanged
+}
+
+// writeBlockIndex records the blocks of the upload checkpoint describes,
+// just completed.
+func (s *Syncer) writeBlockIndex(checkpoint *uploadCheckpoint) {
+	index := &blockIndex{
+		Bucket:   checkpoint.Bucket,
+		Key:      checkpoint.Key,
+		PartSize: checkpoint.PartSize,
+		Digest:   blocksDigest(checkpoint.Blocks),
+		Blocks:   checkpoint.Blocks,
+	}
+	if err := writeStateFile(s.blockIndexPath(checkpoint.Key), index); err != nil {
+		log.Printf(i18n.T("delta.save_index"), checkpoint.Key, err)
+	}
+}
+
+// copyPart copies the range of part number from the object the upload of
+// checkpoint replaces.
+func (s *Syncer) copyPart(checkpoint *uploadCheckpoint, number, offset, length int64) (checkpointPart, error) {
+	output, err := s.client.UploadPartCopy(&s3.UploadPartCopyInput{
+		Bucket:            aws.String(s.cfg.Bucket),
+		Key:               aws.String(checkpoint.Key),
+		UploadId:          aws.String(checkpoint.UploadID),
+		PartNumber:        aws.Int64(number),
+		CopySource:        s.copySource(checkpoint.Key),
+		CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+		CopySourceIfMatch: aws.String(checkpoint.CopySource),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == http.StatusPreconditionFailed {
+			return checkpointPart{}, errSourceChanged
+		}
+		return checkpointPart{}, err
+	}
+	result := output.CopyPartResult
+	return checkpointPart{Number: number, ETag: aws.StringValue(result.ETag), Checksum: copyPartChecksum(result)}, nil
+}
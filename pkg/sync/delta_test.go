@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: delta uploads
+func TestDeltaUpload(t *testing.T) {
+	// Three parts: two full ones and a one-byte tail.
+	size := int64(2*partSize + 1)
+	path := createSparseFile(t, t.TempDir(), "disk.img", size)
+
+	upload := func(t *testing.T, s *Syncer) int64 {
+		file, err := os.Open(path)
+		require.NoError(t, err)
+		defer file.Close()
+		uploaded, err := s.uploadMultipart("disk.img", file, size)
+		require.NoError(t, err)
+		return uploaded
+	}
+
+	// firstUpload uploads the file whole, leaving its block index behind.
+	firstUpload := func(t *testing.T) (*Syncer, blockIndex) {
+		mockClient := new(mockS3Client)
+		mockClient.On("CreateMultipartUpload", mock.MatchedBy(func(input *s3.CreateMultipartUploadInput) bool {
+			_, ok := metadataValue(input.Metadata, blocksMetaKey)
+			return ok
+		})).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("up-1")}, nil).Once()
+		mockClient.On("UploadPart", mock.Anything).Return(&s3.UploadPartOutput{ETag: aws.String("\"etag\"")}, nil).Times(3)
+		mockClient.On("CompleteMultipartUpload", mock.Anything).Return(&s3.CompleteMultipartUploadOutput{}, nil).Once()
+
+		s := newTestSyncer(t, mockClient)
+		s.cfg.Delta = true
+		assert.Equal(t, size, upload(t, s))
+		mockClient.AssertExpectations(t)
+
+		var index blockIndex
+		require.NoError(t, readStateFile(s.blockIndexPath("disk.img"), &index))
+		require.Len(t, index.Blocks, 3)
+		return s, index
+	}
+
+	// changeMiddlePart rewrites a byte of the second part.
+	var version byte
+	changeMiddlePart := func(t *testing.T) {
+		file, err := os.OpenFile(path, os.O_WRONLY, 0)
+		require.NoError(t, err)
+		version++
+		_, err = file.WriteAt([]byte{version}, partSize+10)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+	}
+
+	t.Run("unchanged parts are copied", func(t *testing.T) {
+		s, index := firstUpload(t)
+		changeMiddlePart(t)
+
+		mockClient := new(mockS3Client)
+		s.client = mockClient
+		mockClient.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+			ETag:     aws.String("\"old\""),
+			Metadata: map[string]*string{blocksMetaKey: aws.String(index.Digest)},
+		}, nil).Once()
+		mockClient.On("CreateMultipartUpload", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("up-2")}, nil).Once()
+		mockClient.On("UploadPartCopy", mock.MatchedBy(func(input *s3.UploadPartCopyInput) bool {
+			return aws.Int64Value(input.PartNumber) == 1 &&
+				aws.StringValue(input.CopySourceRange) == fmt.Sprintf("bytes=0-%d", partSize-1) &&
+				aws.StringValue(input.CopySourceIfMatch) == "\"old\""
+		})).Return(&s3.UploadPartCopyOutput{CopyPartResult: &s3.CopyPartResult{ETag: aws.String("\"copy-1\"")}}, nil).Once()
+		mockClient.On("UploadPartCopy", mock.MatchedBy(func(input *s3.UploadPartCopyInput) bool {
+			return aws.Int64Value(input.PartNumber) == 3 &&
+				aws.StringValue(input.CopySourceRange) == fmt.Sprintf("bytes=%d-%d", 2*partSize, 2*partSize)
+		})).Return(&s3.UploadPartCopyOutput{CopyPartResult: &s3.CopyPartResult{ETag: aws.String("\"copy-3\"")}}, nil).Once()
+		mockClient.On("UploadPart", mock.MatchedBy(func(input *s3.UploadPartInput) bool {
+			return aws.Int64Value(input.PartNumber) == 2
+		})).Return(&s3.UploadPartOutput{ETag: aws.String("\"new-2\"")}, nil).Once()
+		mockClient.On("CompleteMultipartUpload", mock.MatchedBy(func(input *s3.CompleteMultipartUploadInput) bool {
+			parts := input.MultipartUpload.Parts
+			return len(parts) == 3 && aws.StringValue(parts[0].ETag) == "\"copy-1\"" && aws.StringValue(parts[1].ETag) == "\"new-2\""
+		})).Return(&s3.CompleteMultipartUploadOutput{}, nil).Once()
+
+		assert.Equal(t, int64(partSize), upload(t, s))
+		mockClient.AssertExpectations(t)
+
+		var updated blockIndex
+		require.NoError(t, readStateFile(s.blockIndexPath("disk.img"), &updated))
+		assert.Equal(t, index.Blocks[0], updated.Blocks[0])
+		assert.NotEqual(t, index.Blocks[1], updated.Blocks[1])
+	})
+
+	t.Run("object uploaded elsewhere is not reused", func(t *testing.T) {
+		s, _ := firstUpload(t)
+		changeMiddlePart(t)
+
+		mockClient := new(mockS3Client)
+		s.client = mockClient
+		mockClient.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{ETag: aws.String("\"other\"")}, nil).Once()
+		mockClient.On("CreateMultipartUpload", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("up-3")}, nil).Once()
+		mockClient.On("UploadPart", mock.Anything).Return(&s3.UploadPartOutput{ETag: aws.String("\"etag\"")}, nil).Times(3)
+		mockClient.On("CompleteMultipartUpload", mock.Anything).Return(&s3.CompleteMultipartUploadOutput{}, nil).Once()
+
+		assert.Equal(t, size, upload(t, s))
+		mockClient.AssertNotCalled(t, "UploadPartCopy", mock.Anything)
+	})
+
+	t.Run("object replaced during the upload falls back to uploading", func(t *testing.T) {
+		s, index := firstUpload(t)
+		changeMiddlePart(t)
+
+		mockClient := new(mockS3Client)
+		s.client = mockClient
+		mockClient.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+			ETag:     aws.String("\"old\""),
+			Metadata: map[string]*string{blocksMetaKey: aws.String(index.Digest)},
+		}, nil).Once()
+		mockClient.On("CreateMultipartUpload", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("up-4")}, nil).Once()
+		mockClient.On("UploadPartCopy", mock.Anything).Return(nil,
+			awserr.NewRequestFailure(awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil), 412, "id")).Twice()
+		mockClient.On("UploadPart", mock.Anything).Return(&s3.UploadPartOutput{ETag: aws.String("\"etag\"")}, nil).Times(3)
+		mockClient.On("CompleteMultipartUpload", mock.Anything).Return(&s3.CompleteMultipartUploadOutput{}, nil).Once()
+
+		assert.Equal(t, size, upload(t, s))
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package sync
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileDevice returns the device of the file system holding the file of
+// info.
+func fileDevice(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// hardLinkID returns the identity of the regular file of info when it has
+// more than one hard link.
+func hardLinkID(info os.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || !info.Mode().IsRegular() || st.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
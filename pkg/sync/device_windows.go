@@ -0,0 +1,11 @@
+package sync
+
+import "os"
+
+// fileDevice: walks on Windows never enter other volumes, whose mount
+// points, like junctions, are reparse points filepath.Walk does not follow.
+func fileDevice(info os.FileInfo) (uint64, bool) { return 0, false }
+
+// hardLinkID: the file index identifying files on Windows is not part of
+// os.FileInfo, so hard links are uploaded as separate files.
+func hardLinkID(info os.FileInfo) (fileID, bool) { return fileID{}, false }
@@ -0,0 +1,254 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+const diffWorkers = 5
+
+// Kinds of difference, in DiffEntry.Change.
+const (
+	DiffOnlyLocal  = "only-local"
+	DiffOnlyRemote = "only-remote"
+	DiffModified   = "modified"
+)
+
+// DiffEntry is a key that differs between RootDir and the bucket.
+type DiffEntry struct {
+	Key        string `json:"key"`
+	Change     string `json:"change"`
+	LocalSize  int64  `json:"local_size,omitempty"`
+	RemoteSize int64  `json:"remote_size,omitempty"`
+}
+
+// bucketObjects lists the objects under prefix that mirror local files,
+// leaving out gui-sync's own bookkeeping and the run reports.
+func (s *Syncer) bucketObjects(prefix string) (map[string]*s3.Object, error) {
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(s.cfg.Bucket)}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+
+	objects := make(map[string]*s3.Object)
+	err := s.client.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			if strings.HasPrefix(*obj.Key, reservedPrefix) || strings.HasPrefix(*obj.Key, reportsPrefix) {
+				continue
+			}
+			objects[*obj.Key] = obj
+		}
+		return true
+	})
+	if err != nil {
+		return nil, i18n.Errorf("s3.list_objects", err)
+	}
+	return objects, nil
+}
+
+// Diff compares RootDir with the bucket, limited to the keys under prefix
+// when it is set, and returns what a sync run would upload or delete,
+// sorted by key. Files are compared as the differ does, so Config.Fast and
+// the hash algorithm apply; archived directories are compared through
+// their index. Nothing is modified.
+func (s *Syncer) Diff(ctx context.Context, prefix string) ([]DiffEntry, error) {
+	entries, _, err := s.diff(ctx, prefix, nil)
+	return entries, err
+}
+
+// DiffManifest is Diff against the objects of the manifest id instead of
+// the bucket as it is now, showing what changed locally since that run.
+// Files are compared by size and modification time only.
+func (s *Syncer) DiffManifest(ctx context.Context, id, prefix string) ([]DiffEntry, error) {
+	m, err := s.ReadManifest(id)
+	if err != nil {
+		return nil, err
+	}
+	entries, _, err := s.diff(ctx, prefix, m)
+	return entries, err
+}
+
+// diff is Diff, or DiffManifest given m, also returning how many objects
+// the bucket listing found.
+func (s *Syncer) diff(ctx context.Context, prefix string, m *Manifest) ([]DiffEntry, int, error) {
+	root := s.cfg.RootDir
+	if root == "" {
+		return nil, 0, i18n.Errorf("syncer.empty_dir")
+	}
+	if s.cfg.GitIgnore {
+		s.gitignore = newGitignoreMatcher(root)
+	}
+	within := func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	}
+
+	var objects map[string]*s3.Object
+	if m != nil {
+		objects = m.objects(s.prefixed(prefix))
+	} else {
+		var err error
+		if objects, err = s.bucketObjects(s.prefixed(prefix)); err != nil {
+			return nil, 0, err
+		}
+	}
+	listed := len(objects)
+
+	var entries []DiffEntry
+	var mu sync.Mutex
+	add := func(entry DiffEntry) {
+		mu.Lock()
+		entries = append(entries, entry)
+		mu.Unlock()
+	}
+	remoteSize := func(key string) int64 {
+		if obj, ok := objects[key]; ok {
+			return aws.Int64Value(obj.Size)
+		}
+		return 0
+	}
+
+	if s.cfg.FilesFrom == "" {
+		dirs, err := s.archiveDirs(root)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, dir := range dirs {
+			key := s.prefixed(archiveKey(dir))
+			if !within(archiveKey(dir)) && !strings.HasPrefix(prefix, dir+"/") {
+				continue
+			}
+			_, exists := objects[key]
+			size := remoteSize(key)
+			delete(objects, key)
+			delete(objects, s.prefixed(archiveIndexKey(dir)))
+			if !exists {
+				add(DiffEntry{Key: key, Change: DiffOnlyLocal})
+				continue
+			}
+			files, err := s.archiveManifest(root, dir, nil)
+			if err != nil {
+				return nil, 0, err
+			}
+			var versionID string
+			if m != nil {
+				index, _ := m.entry(s.prefixed(archiveIndexKey(dir)))
+				versionID = index.VersionID
+			}
+			current, err := s.readArchiveIndexVersion(s.prefixed(archiveIndexKey(dir)), versionID)
+			if err != nil {
+				return nil, 0, err
+			}
+			if current == nil || current.Digest != manifestDigest(files) {
+				add(DiffEntry{Key: key, Change: DiffModified, RemoteSize: size})
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type diffTask struct {
+		path   string
+		linkTo string
+		entry  DiffEntry
+	}
+	tasks := make(chan diffTask, 100)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i := 0; i < diffWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				if ctx.Err() != nil {
+					continue
+				}
+				var changed bool
+				var err error
+				switch {
+				case m != nil:
+					entry, _ := m.entry(task.entry.Key)
+					changed, err = manifestChanged(entry, task.path)
+				case task.linkTo != "":
+					changed, err = s.hardLinkChanged(task.entry.Key, task.linkTo)
+				default:
+					changed, err = s.fileChangedOnS3(task.entry.Key, task.path)
+				}
+				s.heads.forget(task.entry.Key)
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				if changed {
+					task.entry.Change = DiffModified
+					add(task.entry)
+				}
+			}
+		}()
+	}
+
+	links := s.newHardLinks()
+	walkErr := walkTree(root, s.cfg.FilesFrom, func(path, relPath string, info os.FileInfo) error {
+		if _, archived := s.archivedDir(relPath); archived || !within(relPath) {
+			return nil
+		}
+		key := s.keyOf(relPath)
+		_, exists := objects[key]
+		size := remoteSize(key)
+		delete(objects, key)
+		if s.shouldIgnore(relPath) {
+			return nil
+		}
+		entry := DiffEntry{Key: key, LocalSize: info.Size(), RemoteSize: size}
+		linkTo, _ := links.link(key, info)
+		if !exists {
+			entry.Change = DiffOnlyLocal
+			add(entry)
+			return nil
+		}
+		select {
+		case tasks <- diffTask{path: path, linkTo: linkTo, entry: entry}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, nil, s.mountsSkipped(func(relPath string) {
+		for key := range objects {
+			if strings.HasPrefix(key, s.keyOf(relPath)+"/") {
+				delete(objects, key)
+			}
+		}
+	}))
+	close(tasks)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, 0, firstErr
+	}
+	if walkErr != nil {
+		return nil, 0, walkErr
+	}
+
+	// Like the deleter, a --files-from list does not say which objects
+	// are stale.
+	if s.cfg.FilesFrom == "" {
+		for key, obj := range objects {
+			if !s.skipDelete(key) {
+				add(DiffEntry{Key: key, Change: DiffOnlyRemote, RemoteSize: aws.Int64Value(obj.Size)})
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, listed, nil
+}
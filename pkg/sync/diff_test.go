@@ -0,0 +1,70 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: diff
+func TestDiff(t *testing.T) {
+	tempDir := t.TempDir()
+	same := createTempFile(t, tempDir, "docs/same.txt", "same")
+	modified := createTempFile(t, tempDir, "docs/modified.txt", "v1")
+	createTempFile(t, tempDir, "docs/new.txt", "new")
+	createTempFile(t, tempDir, "other/new.txt", "new")
+
+	sameHead := headFor(t, same)
+	modifiedHead := headFor(t, modified)
+	require.NoError(t, os.WriteFile(modified, []byte("v2 longer"), 0644))
+	require.NoError(t, os.Chtimes(modified, time.Now().Add(time.Hour), time.Now().Add(time.Hour)))
+
+	listing := &s3.ListObjectsV2Output{Contents: []*s3.Object{
+		{Key: aws.String("docs/same.txt"), Size: aws.Int64(4)},
+		{Key: aws.String("docs/modified.txt"), Size: aws.Int64(2)},
+		{Key: aws.String("docs/removed.txt"), Size: aws.Int64(7)},
+		{Key: aws.String(heartbeatKey)},
+	}}
+
+	t.Run("three-way listing", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("ListObjectsV2Pages", mock.MatchedBy(func(input *s3.ListObjectsV2Input) bool {
+			return aws.StringValue(input.Prefix) == "docs/"
+		}), mock.Anything).Return(listing, nil).Once()
+		client.On("HeadObject", headKey("docs/same.txt")).Return(sameHead, nil).Once()
+		client.On("HeadObject", headKey("docs/modified.txt")).Return(modifiedHead, nil).Once()
+
+		s := newTestSyncer(t, client)
+		s.cfg.RootDir = tempDir
+		entries, err := s.Diff(context.Background(), "docs/")
+		require.NoError(t, err)
+		client.AssertExpectations(t)
+
+		assert.Equal(t, []DiffEntry{
+			{Key: "docs/modified.txt", Change: DiffModified, LocalSize: 9, RemoteSize: 2},
+			{Key: "docs/new.txt", Change: DiffOnlyLocal, LocalSize: 3},
+			{Key: "docs/removed.txt", Change: DiffOnlyRemote, RemoteSize: 7},
+		}, entries)
+		client.AssertNotCalled(t, "PutObject", mock.Anything)
+		client.AssertNotCalled(t, "DeleteObject", mock.Anything)
+	})
+
+	t.Run("comparison errors stop the diff", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(listing, nil).Once()
+		client.On("HeadObject", mock.Anything).Return(nil, awserr.New("AccessDenied", "denied", nil))
+
+		s := newTestSyncer(t, client)
+		s.cfg.RootDir = tempDir
+		_, err := s.Diff(context.Background(), "docs/")
+		assert.Error(t, err)
+	})
+}
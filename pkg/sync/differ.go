@@ -0,0 +1,258 @@
+package sync
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// differ is the second pipeline stage: it compares each scanned file with
+// its object on S3 and forwards only the ones that need uploading.
+type differ struct {
+	syncer  *Syncer
+	workers int
+}
+
+// run consumes in until it is closed, sending changed files to out, which
+// it closes on return. The first comparison error stops the stage.
+func (d *differ) run(ctx context.Context, in <-chan fileEntry, out chan<- uploadTask) error {
+	defer close(out)
+
+	workers := d.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range in {
+				if ctx.Err() != nil {
+					continue
+				}
+				d.syncer.stats.scanned.Add(1)
+
+				if entry.cached {
+					d.syncer.stats.skipped.Add(1)
+					d.syncer.report.add(reportAction{Action: actionSkip, Key: entry.key, Size: entry.size})
+					fmt.Printf(i18n.T("differ.skip_cached"), entry.key)
+					continue
+				}
+
+				if entry.linkTo == "" && d.syncer.initial.completed(entry) {
+					d.syncer.stats.skipped.Add(1)
+					d.syncer.report.add(reportAction{Action: actionSkip, Key: entry.key, Size: entry.size})
+					fmt.Printf(i18n.T("initial.skip"), entry.key)
+					continue
+				}
+
+				if fileLocked(entry.path) {
+					d.syncer.deferBusy(entry.key, &BusyError{Path: entry.path, Locked: true})
+					continue
+				}
+
+				var shouldUpload bool
+				var err error
+				if entry.linkTo != "" {
+					shouldUpload, err = d.syncer.hardLinkChanged(entry.key, entry.linkTo)
+				} else {
+					shouldUpload, err = d.syncer.fileChangedOnS3(entry.key, entry.path)
+				}
+				if err != nil {
+					d.syncer.heads.forget(entry.key)
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+
+				// Only uploads read the object again.
+				if !shouldUpload {
+					d.syncer.heads.forget(entry.key)
+					if entry.linkTo == "" {
+						d.syncer.scan.synced(entry.relPath)
+						d.syncer.initial.add(entry.key, entry.size, entry.modTime)
+					}
+					d.syncer.stats.skipped.Add(1)
+					d.syncer.report.add(reportAction{Action: actionSkip, Key: entry.key, Size: entry.size})
+					fmt.Printf(i18n.T("differ.skip"), entry.key)
+					continue
+				}
+
+				if !d.syncer.quota.admit(entry.size) {
+					d.syncer.heads.forget(entry.key)
+					d.syncer.stats.overQuota.Add(1)
+					d.syncer.report.add(reportAction{Action: actionOverQuota, Key: entry.key, Size: entry.size})
+					continue
+				}
+
+				d.syncer.massChanges.fileChanged()
+				d.syncer.stats.pending.Add(1)
+				select {
+				case out <- uploadTask{path: entry.path, relPath: entry.relPath, s3Key: entry.key, fileSize: entry.size, modTime: entry.modTime, linkTo: entry.linkTo}:
+				case <-ctx.Done():
+					d.syncer.heads.forget(entry.key)
+					d.syncer.stats.pending.Add(-1)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+func (s *Syncer) fileChangedOnS3(s3Key, localPath string) (changed bool, err error) {
+	headObjectOutput, err := s.headObject(s3Key)
+	if err != nil {
+		if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == http.StatusNotFound {
+			return true, nil
+		}
+		return false, i18n.Errorf("s3.head", err)
+	}
+	defer func() {
+		if err == nil && !changed {
+			s.rememberObject(s3Key, storedSize(headObjectOutput.Metadata, aws.Int64Value(headObjectOutput.ContentLength)), headObjectOutput.Metadata)
+		}
+	}()
+
+	fileInfo, err := os.Lstat(localPath)
+	if err != nil {
+		return false, i18n.Errorf("file.stat", err)
+	}
+
+	storedTarget, storedIsLink := storedSymlink(headObjectOutput.Metadata)
+	if fileInfo.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(localPath)
+		if err != nil {
+			return false, i18n.Errorf("file.readlink", err)
+		}
+		return !storedIsLink || storedTarget != target, nil
+	}
+	if _, storedIsHardLink := storedHardLink(headObjectOutput.Metadata); storedIsLink || storedIsHardLink {
+		return true, nil
+	}
+
+	if storedSize(headObjectOutput.Metadata, aws.Int64Value(headObjectOutput.ContentLength)) != fileInfo.Size() {
+		return true, nil
+	}
+
+	// Permissions are not comparable across platforms: Windows only reports
+	// the read-only bit.
+	if mode, ok := storedMode(headObjectOutput.Metadata); ok && runtime.GOOS != "windows" && mode != fileInfo.Mode().Perm() {
+		return true, nil
+	}
+	// Changing an attribute does not change the modification time.
+	if s.xattrsChanged(headObjectOutput.Metadata, localPath) {
+		return true, nil
+	}
+
+	if s.cfg.Fast {
+		return fastChanged(headObjectOutput, fileInfo, localPath), nil
+	}
+
+	if headObjectOutput.LastModified == nil {
+		return true, nil
+	}
+
+	if sidecarModified(localPath, *headObjectOutput.LastModified) {
+		return true, nil
+	}
+
+	if headObjectOutput.LastModified != nil && !fileInfo.ModTime().After(*headObjectOutput.LastModified) {
+		return false, nil
+	}
+
+	// Objects uploaded with sync metadata are compared with it, which holds
+	// for every size and encryption; older objects fall back to the ETag.
+	if stored, ok := storedModTime(headObjectOutput.Metadata); ok && stored.Equal(fileInfo.ModTime()) {
+		return false, nil
+	}
+	if algorithm, stored, ok := storedHash(headObjectOutput.Metadata, s.hashAlgorithm()); ok {
+		localFileHash, err := fileContentHash(algorithm, localPath)
+		if err != nil {
+			return false, i18n.Errorf("file.hash_local", err)
+		}
+		if localFileHash == stored {
+			return false, nil
+		}
+		s.digests.add(localPath, fileInfo, algorithm, localFileHash)
+		return true, nil
+	}
+
+	s3ETag := strings.Trim(aws.StringValue(headObjectOutput.ETag), "\"")
+
+	if strings.Contains(s3ETag, "-") {
+		match, ok, err := matchesMultipartETag(localPath, fileInfo.Size(), s3ETag)
+		if err != nil {
+			return false, i18n.Errorf("file.hash_local", err)
+		}
+		if ok {
+			return !match, nil
+		}
+		return fileInfo.ModTime().After(*headObjectOutput.LastModified), nil
+	}
+
+	if fileInfo.Size() > multipartThreshold {
+		return fileInfo.ModTime().After(*headObjectOutput.LastModified), nil
+	}
+
+	localFileHash, err := calculateMD5(localPath)
+	if err != nil {
+		return false, i18n.Errorf("file.hash_local", err)
+	}
+	if localFileHash == s3ETag {
+		return false, nil
+	}
+	s.digests.add(localPath, fileInfo, HashMD5, localFileHash)
+	return true, nil
+}
+
+// fastChanged compares a file with its object without reading the file:
+// the modification time stored at upload must match exactly. Objects
+// uploaded without it fall back to comparing with LastModified.
+func fastChanged(head *s3.HeadObjectOutput, fileInfo os.FileInfo, localPath string) bool {
+	if head.LastModified != nil && sidecarModified(localPath, *head.LastModified) {
+		return true
+	}
+	if stored, ok := storedModTime(head.Metadata); ok {
+		return !stored.Equal(fileInfo.ModTime())
+	}
+	return head.LastModified == nil || fileInfo.ModTime().After(*head.LastModified)
+}
+
+func calculateMD5(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", i18n.Errorf("file.open", err)
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", i18n.Errorf("file.hash", err)
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
@@ -0,0 +1,132 @@
+package sync
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// A file found changed by its hash used to be read by the differ to compare
+// it, again to hash it for the sync metadata of its upload, and once more to
+// send it. The differ now keeps the digests it computes for the upload, and
+// the upload computes every digest it needs in a single read, so a changed
+// file is read once to compare it and once to send it.
+
+// cachedDigest is the digest of a file that had size bytes and was last
+// modified at modTime.
+type cachedDigest struct {
+	algorithm, digest string
+	size              int64
+	modTime           time.Time
+}
+
+// digestCache holds by path the digests of the files hashed during a run,
+// for their uploads. It is emptied between runs. The zero value is ready to
+// use.
+type digestCache struct {
+	mu      sync.Mutex
+	digests map[string]cachedDigest
+}
+
+func (c *digestCache) reset() {
+	c.mu.Lock()
+	c.digests = nil
+	c.mu.Unlock()
+}
+
+func (c *digestCache) add(path string, info os.FileInfo, algorithm, digest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.digests == nil {
+		c.digests = make(map[string]cachedDigest)
+	}
+	c.digests[path] = cachedDigest{algorithm: algorithm, digest: digest, size: info.Size(), modTime: info.ModTime()}
+}
+
+// lookup returns the digest with algorithm of the file at path, if it was
+// computed while the file had the size and modification time of info.
+func (c *digestCache) lookup(path string, info os.FileInfo, algorithm string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.digests[path]
+	if !ok || d.algorithm != algorithm || d.size != info.Size() || !d.modTime.Equal(info.ModTime()) {
+		return "", false
+	}
+	return d.digest, true
+}
+
+// uploadHashes are the digests of a file an upload needs.
+type uploadHashes struct {
+	// digest is the hash with Syncer.hashAlgorithm kept in the sync
+	// metadata.
+	digest string
+	// checksum is the checksum the bucket requires, if any.
+	checksum string
+	// md5 is the MD5 Config.VerifyUploads compares with the ETag.
+	md5 string
+}
+
+// hashUpload returns the digest of file, whose info is given, for the sync
+// metadata and, with put, the other digests a PutObject of it needs. They
+// are computed in a single read, after which file is rewound; the digest
+// is taken from the digest cache when the differ already computed it.
+func (s *Syncer) hashUpload(file *os.File, info os.FileInfo, put bool) (uploadHashes, error) {
+	var hashes uploadHashes
+	algorithm := s.hashAlgorithm()
+	digest, cached := s.digests.lookup(file.Name(), info, algorithm)
+
+	var writers []io.Writer
+	var digestHash, checksumHash, md5Hash hash.Hash
+	if !cached {
+		h, err := newContentHash(algorithm)
+		if err != nil {
+			return hashes, err
+		}
+		digestHash = h
+		writers = append(writers, h)
+	}
+	if put && s.checksumAlgorithm != "" {
+		h, err := newChecksumHash(s.checksumAlgorithm)
+		if err != nil {
+			return hashes, err
+		}
+		checksumHash = h
+		writers = append(writers, h)
+	}
+	if put && s.cfg.VerifyUploads && algorithm != HashMD5 {
+		md5Hash = md5.New()
+		writers = append(writers, md5Hash)
+	}
+
+	if len(writers) > 0 {
+		if _, err := io.Copy(io.MultiWriter(writers...), file); err != nil {
+			return hashes, i18n.Errorf("file.hash", err)
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return hashes, i18n.Errorf("file.rewind", err)
+		}
+	}
+
+	if digestHash != nil {
+		digest = hex.EncodeToString(digestHash.Sum(nil))
+		s.digests.add(file.Name(), info, algorithm, digest)
+	}
+	hashes.digest = digest
+	if checksumHash != nil {
+		hashes.checksum = base64.StdEncoding.EncodeToString(checksumHash.Sum(nil))
+	}
+	switch {
+	case md5Hash != nil:
+		hashes.md5 = hex.EncodeToString(md5Hash.Sum(nil))
+	case put && s.cfg.VerifyUploads:
+		hashes.md5 = digest
+	}
+	return hashes, nil
+}
@@ -0,0 +1,96 @@
+package sync
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: digests computed once per upload
+func TestChangedFileDigestIsReused(t *testing.T) {
+	path := createTempFile(t, t.TempDir(), "a.txt", "conteúdo novo")
+	client := new(mockS3Client)
+	client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len("conteúdo novo"))),
+		LastModified:  aws.Time(time.Now().Add(-time.Hour)),
+		Metadata:      map[string]*string{hashMetaKey(HashMD5): aws.String("digest-antigo")},
+	}, nil).Once()
+
+	s := newTestSyncer(t, client)
+	changed, err := s.fileChangedOnS3("a.txt", path)
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	digest, ok := s.digests.lookup(path, info, HashMD5)
+	require.True(t, ok, "the digest the differ computed is kept for the upload")
+	sum := md5.Sum([]byte("conteúdo novo"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), digest)
+
+	t.Run("the upload does not hash the file again", func(t *testing.T) {
+		s.digests.add(path, info, HashMD5, "digest-do-differ")
+		client.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+			return aws.StringValue(input.Metadata[hashMetaKey(HashMD5)]) == "digest-do-differ"
+		})).Return(&s3.PutObjectOutput{}, nil).Once()
+
+		_, err := s.uploadFileS3("a.txt", path, info.Size())
+		require.NoError(t, err)
+		client.AssertExpectations(t)
+	})
+
+	t.Run("a file modified since is hashed again", func(t *testing.T) {
+		require.NoError(t, os.Chtimes(path, time.Now(), info.ModTime().Add(time.Second)))
+		client.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+			return aws.StringValue(input.Metadata[hashMetaKey(HashMD5)]) == hex.EncodeToString(sum[:])
+		})).Return(&s3.PutObjectOutput{}, nil).Once()
+
+		_, err := s.uploadFileS3("a.txt", path, info.Size())
+		require.NoError(t, err)
+		client.AssertExpectations(t)
+	})
+}
+
+func TestHashUploadSinglePass(t *testing.T) {
+	const content = "lido uma vez só"
+	path := createTempFile(t, t.TempDir(), "a.txt", content)
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	info, err := file.Stat()
+	require.NoError(t, err)
+
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.HashAlgorithm = HashSHA256
+	s.cfg.VerifyUploads = true
+	s.checksumAlgorithm = s3.ChecksumAlgorithmSha256
+
+	hashes, err := s.hashUpload(file, info, true)
+	require.NoError(t, err)
+
+	sha := sha256.Sum256([]byte(content))
+	sum := md5.Sum([]byte(content))
+	assert.Equal(t, hex.EncodeToString(sha[:]), hashes.digest)
+	assert.Equal(t, hex.EncodeToString(sum[:]), hashes.md5)
+	checksum, err := computeChecksum(s3.ChecksumAlgorithmSha256, io.NewSectionReader(file, 0, info.Size()))
+	require.NoError(t, err)
+	assert.Equal(t, checksum, hashes.checksum)
+
+	rest, err := io.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(rest), "the file is rewound for the upload")
+
+	hashes, err = s.hashUpload(file, info, false)
+	require.NoError(t, err)
+	assert.Equal(t, uploadHashes{digest: hex.EncodeToString(sha[:])}, hashes)
+}
@@ -0,0 +1,120 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// bucketSettings caches what `gui-sync doctor` learned about a bucket so
+// later runs can configure uploads without probing again.
+type bucketSettings struct {
+	formatHeader
+
+	ChecksumAlgorithm string `json:"checksum_algorithm,omitempty"`
+}
+
+const doctorProbeKey = reservedPrefix + "doctor-probe"
+
+func (s *Syncer) bucketSettingsPath() string {
+	return s.statePath("buckets", s.cfg.Bucket+".json")
+}
+
+// loadBucketSettings applies the cached settings for the bucket, if any.
+func (s *Syncer) loadBucketSettings() error {
+	var settings bucketSettings
+	if err := readStateFile(s.bucketSettingsPath(), &settings); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	s.checksumAlgorithm = settings.ChecksumAlgorithm
+	if s.checksumAlgorithm != "" {
+		fmt.Printf(i18n.T("doctor.checksum"), s.checksumAlgorithm)
+	}
+	return nil
+}
+
+// CheckBucket reports whether the bucket exists and the credentials in use
+// can reach it.
+func (s *Syncer) CheckBucket() error {
+	_, err := s.client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(s.cfg.Bucket)})
+	return err
+}
+
+// SaveChecksumRequirement records algorithm as the checksum the bucket
+// requires ("" for none) so later runs send it without probing again, and
+// applies it to this Syncer.
+func (s *Syncer) SaveChecksumRequirement(algorithm string) error {
+	if err := writeStateFile(s.bucketSettingsPath(), &bucketSettings{ChecksumAlgorithm: algorithm}); err != nil {
+		return i18n.Errorf("doctor.save_settings", err)
+	}
+	s.checksumAlgorithm = algorithm
+	return nil
+}
+
+// ProbeChecksumRequirement uploads a tiny probe object, first without any
+// additional checksum and then with each supported algorithm, returning the
+// first algorithm the bucket accepts ("" when none is required).
+func (s *Syncer) ProbeChecksumRequirement() (string, error) {
+	defer s.deleteProbe()
+
+	firstErr := s.putProbe("")
+	if firstErr == nil {
+		return "", nil
+	}
+	if !isRequestRejection(firstErr) {
+		return "", firstErr
+	}
+
+	for _, algorithm := range checksumAlgorithms {
+		if s.putProbe(algorithm) == nil {
+			return algorithm, nil
+		}
+	}
+
+	return "", firstErr
+}
+
+// putProbe uploads the tiny probe object, with the additional checksum
+// algorithm unless it is "".
+func (s *Syncer) putProbe(algorithm string) error {
+	body := []byte("gui-sync doctor probe")
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(doctorProbeKey),
+		Body:   bytes.NewReader(body),
+	}
+	if algorithm != "" {
+		value, err := computeChecksum(algorithm, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		input.ChecksumAlgorithm = aws.String(algorithm)
+		newObjectChecksum(algorithm, value).applyPut(input)
+	}
+	_, err := s.client.PutObject(input)
+	return err
+}
+
+func (s *Syncer) deleteProbe() {
+	s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(doctorProbeKey),
+	})
+}
+
+// isRequestRejection reports whether S3 refused the request itself (400 or
+// 403), as bucket policies requiring checksum headers do.
+func isRequestRejection(err error) bool {
+	aerr, ok := err.(awserr.RequestFailure)
+	return ok && (aerr.StatusCode() == http.StatusBadRequest || aerr.StatusCode() == http.StatusForbidden)
+}
@@ -0,0 +1,100 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: doctor checksum probe
+func TestProbeChecksumRequirement(t *testing.T) {
+	rejected := awserr.NewRequestFailure(awserr.New("InvalidRequest", "Missing required header", nil), 400, "request-id")
+	withoutChecksum := mock.MatchedBy(func(input *s3.PutObjectInput) bool { return input.ChecksumAlgorithm == nil })
+	withSHA256 := mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return aws.StringValue(input.ChecksumAlgorithm) == "SHA256" && input.ChecksumSHA256 != nil
+	})
+
+	t.Run("no checksum required", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		mockClient.On("PutObject", withoutChecksum).Return(&s3.PutObjectOutput{}, nil).Once()
+		mockClient.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+		algorithm, err := newTestSyncer(t, mockClient).ProbeChecksumRequirement()
+		assert.NoError(t, err)
+		assert.Empty(t, algorithm)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("bucket requires sha256", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		mockClient.On("PutObject", withoutChecksum).Return(nil, rejected).Once()
+		mockClient.On("PutObject", withSHA256).Return(&s3.PutObjectOutput{}, nil).Once()
+		mockClient.On("DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+			return *input.Key == doctorProbeKey
+		})).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+		algorithm, err := newTestSyncer(t, mockClient).ProbeChecksumRequirement()
+		assert.NoError(t, err)
+		assert.Equal(t, "SHA256", algorithm)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("unrelated error is returned", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		notFound := awserr.NewRequestFailure(awserr.New("NoSuchBucket", "bucket missing", nil), 404, "request-id")
+		mockClient.On("PutObject", withoutChecksum).Return(nil, notFound).Once()
+		mockClient.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+		_, err := newTestSyncer(t, mockClient).ProbeChecksumRequirement()
+		assert.Error(t, err)
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestBucketSettings(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+
+	require.NoError(t, s.loadBucketSettings())
+	assert.Empty(t, s.checksumAlgorithm)
+
+	require.NoError(t, s.SaveChecksumRequirement("SHA256"))
+	s.checksumAlgorithm = ""
+	require.NoError(t, s.loadBucketSettings())
+	assert.Equal(t, "SHA256", s.checksumAlgorithm)
+}
+
+func TestComputeChecksum(t *testing.T) {
+	value, err := computeChecksum("SHA256", strings.NewReader("abc"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=", value)
+
+	for _, algorithm := range checksumAlgorithms {
+		_, err := computeChecksum(algorithm, strings.NewReader("abc"))
+		assert.NoError(t, err, algorithm)
+	}
+
+	_, err = computeChecksum("MD4", strings.NewReader("abc"))
+	assert.Error(t, err)
+}
+
+func TestUploadFileS3WithChecksum(t *testing.T) {
+	mockClient := new(mockS3Client)
+	s := newTestSyncer(t, mockClient)
+	s.checksumAlgorithm = "SHA256"
+	filePath := createTempFile(t, t.TempDir(), "abc.txt", "abc")
+
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return aws.StringValue(input.ChecksumAlgorithm) == "SHA256" &&
+			aws.StringValue(input.ChecksumSHA256) == "ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0="
+	})).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	_, err := s.uploadFileS3("abc.txt", filePath, 3)
+	assert.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
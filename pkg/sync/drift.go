@@ -0,0 +1,126 @@
+package sync
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// ValidateSample checks the percentage of objects VerifyManifestSample
+// downloads.
+func ValidateSample(percent int) error {
+	if percent < 0 || percent > 100 {
+		return i18n.Errorf("verify.invalid_sample", percent)
+	}
+	return nil
+}
+
+// verifyObjectContent downloads the object of key and compares its contents
+// with the hash stored with it and, when the ETag is the MD5 of the
+// contents, with the ETag. Compressed objects are hashed decompressed, as
+// they were uploaded.
+func (s *Syncer) verifyObjectContent(key, versionID string, head *s3.HeadObjectOutput) (string, error) {
+	algorithm, digest, hashed := storedHash(head.Metadata, s.hashAlgorithm())
+	etag := strings.Trim(aws.StringValue(head.ETag), `"`)
+	_, compressed := metadataValue(head.Metadata, compressionMetaKey)
+	etagIsMD5 := etag != "" && !strings.Contains(etag, "-") && !compressed && aws.StringValue(head.ServerSideEncryption) != s3.ServerSideEncryptionAwsKms
+	if !hashed && !etagIsMD5 {
+		return VerifyUnverifiable, nil
+	}
+
+	input := &s3.GetObjectInput{Bucket: aws.String(s.cfg.Bucket), Key: aws.String(key)}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+	output, err := s.client.GetObject(input)
+	if err != nil {
+		return "", i18n.Errorf("s3.download", err)
+	}
+	defer output.Body.Close()
+
+	raw := md5.New()
+	output.Body = io.NopCloser(io.TeeReader(output.Body, raw))
+	body, err := decompressedBody(output)
+	if err != nil {
+		return "", err
+	}
+	if hashed {
+		remote, err := contentHash(algorithm, body)
+		if err != nil {
+			return "", err
+		}
+		if remote != digest {
+			return VerifyCorrupted, i18n.Errorf("verify.hash_mismatch", algorithm)
+		}
+	}
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return "", i18n.Errorf("s3.download", err)
+	}
+	if etagIsMD5 && hex.EncodeToString(raw.Sum(nil)) != etag {
+		return VerifyCorrupted, i18n.Errorf("verify.etag_mismatch")
+	}
+	return "", nil
+}
+
+// WatchManifest verifies the bucket against the manifest id, re-read every
+// time, every interval until ctx is done, downloading sample percent of the
+// objects each time. It never writes to the bucket, so it can watch buckets
+// whose writes another process owns. pass is told the outcome of each
+// verification; the notifiers of Config are alerted when the bucket drifts
+// from the manifest, and again when it matches once more.
+func (s *Syncer) WatchManifest(ctx context.Context, id string, interval time.Duration, sample int, pass func(*VerifyResult, error)) {
+	var alerted string
+	for {
+		result, err := s.VerifyManifestSample(ctx, id, sample)
+		if ctx.Err() != nil {
+			return
+		}
+		pass(result, err)
+
+		drift := driftText(result, err)
+		switch {
+		case drift != "" && drift != alerted:
+			s.sendAlert(ctx, fmt.Sprintf(i18n.T("verify.drift_title"), s.cfg.Bucket), drift)
+		case drift == "" && alerted != "":
+			s.sendAlert(ctx, fmt.Sprintf(i18n.T("verify.resolved_title"), s.cfg.Bucket), fmt.Sprintf(i18n.T("verify.resolved"), result.Manifest))
+		}
+		alerted = drift
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// driftText describes what a verification found wrong, naming the first
+// maxListedFailures objects; it is empty when nothing is.
+func driftText(result *VerifyResult, err error) string {
+	if err != nil {
+		return fmt.Sprintf(i18n.T("verify.watch_failed"), err)
+	}
+	failed := result.Failed()
+	if len(failed) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, i18n.T("verify.drift"), len(failed), result.Checked, result.Manifest)
+	for i, p := range failed {
+		if i == maxListedFailures {
+			fmt.Fprintf(&b, i18n.T("result.more"), len(failed)-maxListedFailures)
+			break
+		}
+		fmt.Fprintf(&b, "\n• %s (%s)", p.Key, p.Status)
+	}
+	return b.String()
+}
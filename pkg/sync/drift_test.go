@@ -0,0 +1,153 @@
+package sync
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: read-only verification daemon
+func TestValidateSample(t *testing.T) {
+	for _, percent := range []int{0, 10, 100} {
+		assert.NoError(t, ValidateSample(percent), percent)
+	}
+	for _, percent := range []int{-1, 101} {
+		assert.Equal(t, "verify.invalid_sample", i18n.ID(ValidateSample(percent)), percent)
+	}
+}
+
+func TestVerifyObjectContent(t *testing.T) {
+	const content = "conteúdo original"
+	sha := sha256.Sum256([]byte(content))
+	sum := md5.Sum([]byte(content))
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	getObject := func(client *mockS3Client, body string) {
+		client.On("GetObject", mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return aws.StringValue(input.Key) == "a.txt" && aws.StringValue(input.VersionId) == "v1"
+		})).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body))}, nil).Once()
+	}
+
+	t.Run("matching contents", func(t *testing.T) {
+		client := new(mockS3Client)
+		getObject(client, content)
+		s := newTestSyncer(t, client)
+
+		head := &s3.HeadObjectOutput{ETag: aws.String(etag), Metadata: map[string]*string{"Sync-Sha256": aws.String(hex.EncodeToString(sha[:]))}}
+		status, err := s.verifyObjectContent("a.txt", "v1", head)
+		require.NoError(t, err)
+		assert.Empty(t, status)
+		client.AssertExpectations(t)
+	})
+
+	t.Run("contents differ from the stored hash", func(t *testing.T) {
+		client := new(mockS3Client)
+		getObject(client, "conteúdo corrompido")
+		s := newTestSyncer(t, client)
+
+		head := &s3.HeadObjectOutput{ETag: aws.String(`"abc-2"`), Metadata: map[string]*string{"Sync-Sha256": aws.String(hex.EncodeToString(sha[:]))}}
+		status, err := s.verifyObjectContent("a.txt", "v1", head)
+		assert.Equal(t, VerifyCorrupted, status)
+		assert.Equal(t, "verify.hash_mismatch", i18n.ID(err))
+	})
+
+	t.Run("contents differ from the ETag", func(t *testing.T) {
+		client := new(mockS3Client)
+		getObject(client, "conteúdo corrompido")
+		s := newTestSyncer(t, client)
+
+		status, err := s.verifyObjectContent("a.txt", "v1", &s3.HeadObjectOutput{ETag: aws.String(etag)})
+		assert.Equal(t, VerifyCorrupted, status)
+		assert.Equal(t, "verify.etag_mismatch", i18n.ID(err))
+	})
+
+	t.Run("nothing to compare with", func(t *testing.T) {
+		client := new(mockS3Client)
+		s := newTestSyncer(t, client)
+
+		status, err := s.verifyObjectContent("a.txt", "v1", &s3.HeadObjectOutput{ETag: aws.String(`"abc-2"`)})
+		require.NoError(t, err)
+		assert.Equal(t, VerifyUnverifiable, status)
+		client.AssertNotCalled(t, "GetObject", mock.Anything)
+	})
+}
+
+func TestVerifyManifestSample(t *testing.T) {
+	client := new(mockS3Client)
+	mockManifest(t, client, manifestKey, &Manifest{ID: "20240501T120000Z", Objects: []ManifestEntry{
+		{Key: "a.txt", Size: 5, ETag: "abc-2", VersionID: "v1"},
+	}})
+	client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+		ContentLength: aws.Int64(5),
+		ETag:          aws.String(`"abc-2"`),
+		Metadata:      map[string]*string{"Sync-Md5": aws.String(hex.EncodeToString(md5.New().Sum(nil)))},
+	}, nil).Once()
+	client.On("GetObject", mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+		return aws.StringValue(input.Key) == "a.txt"
+	})).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("bytes"))}, nil).Once()
+
+	s := newTestSyncer(t, client)
+	result, err := s.VerifyManifestSample(context.Background(), ManifestLatest, 100)
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+
+	assert.Equal(t, "20240501T120000Z", result.Manifest)
+	assert.Equal(t, 1, result.Sampled)
+	require.Len(t, result.Failed(), 1)
+	assert.Equal(t, VerifyCorrupted, result.Problems[0].Status)
+}
+
+func TestWatchManifest(t *testing.T) {
+	var alerts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alerts = append(alerts, r.Header.Get("Title"))
+	}))
+	defer server.Close()
+
+	client := new(mockS3Client)
+	entries := []ManifestEntry{{Key: "a.txt", Size: 1, ETag: "etag-a"}}
+	missing := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")
+	found := &s3.HeadObjectOutput{ContentLength: aws.Int64(1), ETag: aws.String(`"etag-a"`)}
+	for _, head := range []*s3.HeadObjectOutput{nil, nil, found} {
+		mockManifest(t, client, manifestKey, &Manifest{ID: "20240501T120000Z", Objects: entries})
+		if head == nil {
+			client.On("HeadObject", mock.Anything).Return(nil, missing).Once()
+		} else {
+			client.On("HeadObject", mock.Anything).Return(head, nil).Once()
+		}
+	}
+
+	s := newTestSyncer(t, client)
+	s.cfg.Notifiers = []Notifier{{Kind: "ntfy", Target: server.URL}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var failed []int
+	s.WatchManifest(ctx, ManifestLatest, time.Millisecond, 0, func(result *VerifyResult, err error) {
+		require.NoError(t, err)
+		failed = append(failed, len(result.Failed()))
+		if len(failed) == 3 {
+			cancel()
+		}
+	})
+	client.AssertExpectations(t)
+
+	assert.Equal(t, []int{1, 1, 0}, failed)
+	require.Len(t, alerts, 2, "a drift is alerted once, and once more when it clears")
+	assert.Contains(t, alerts[0], "test-bucket")
+}
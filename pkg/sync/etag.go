@@ -0,0 +1,133 @@
+package sync
+
+import (
+	"crypto/md5"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// S3 gives an object uploaded in parts the ETag "<MD5 of the part MD5s>-<parts>"
+// rather than the MD5 of its contents. Objects uploaded by other tools, or
+// by gui-sync before it stored hashes in the metadata, are still compared
+// with their files by computing that ETag. Parts are hashed by several
+// goroutines at once, so a multi-GB file on a fast disk is not bound to
+// the speed of a single MD5.
+
+// hashWorkers is how many parts of a file are hashed at once.
+var hashWorkers = min(runtime.NumCPU(), 8)
+
+// hashParts returns the digests with newHash of the parts of file, of size
+// bytes, partSize bytes each but the last, hashing hashWorkers parts at
+// once.
+func hashParts(file io.ReaderAt, size, partSize int64, newHash func() hash.Hash) ([][]byte, error) {
+	count := int((size + partSize - 1) / partSize)
+	sums := make([][]byte, count)
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	next := make(chan int)
+	failed := make(chan struct{})
+	for i := 0; i < min(hashWorkers, count); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range next {
+				offset := int64(part) * partSize
+				h := newHash()
+				if _, err := io.Copy(h, io.NewSectionReader(file, offset, min(partSize, size-offset))); err != nil {
+					once.Do(func() {
+						firstErr = i18n.Errorf("file.hash", err)
+						close(failed)
+					})
+					continue
+				}
+				sums[part] = h.Sum(nil)
+			}
+		}()
+	}
+
+feed:
+	for part := 0; part < count; part++ {
+		select {
+		case next <- part:
+		case <-failed:
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return sums, nil
+}
+
+// multipartETag returns the ETag S3 gives to file, of size bytes, uploaded
+// in parts of partSize bytes.
+func multipartETag(file io.ReaderAt, size, partSize int64) (string, error) {
+	sums, err := hashParts(file, size, partSize, md5.New)
+	if err != nil {
+		return "", err
+	}
+	h := md5.New()
+	for _, sum := range sums {
+		h.Write(sum)
+	}
+	return fmt.Sprintf("%x-%d", h.Sum(nil), len(sums)), nil
+}
+
+// etagPartSize guesses the part size of an object of size bytes uploaded in
+// parts parts: the one gui-sync uses or else, as most tools pick whole
+// mebibytes, the smallest whole number of MiB giving that many parts.
+func etagPartSize(size int64, parts int) (int64, bool) {
+	if size <= 0 || parts <= 0 {
+		return 0, false
+	}
+	count := func(part int64) int64 { return (size + part - 1) / part }
+	if count(partSize) == int64(parts) {
+		return partSize, true
+	}
+	const mib = 1 << 20
+	part := (count(int64(parts)) + mib - 1) / mib * mib
+	if count(part) != int64(parts) {
+		return 0, false
+	}
+	return part, true
+}
+
+// matchesMultipartETag reports whether the file at path, of size bytes,
+// has the contents of an object with the multipart ETag etag. ok is false
+// when the part size the object was uploaded with cannot be told.
+func matchesMultipartETag(path string, size int64, etag string) (match, ok bool, err error) {
+	_, suffix, _ := strings.Cut(etag, "-")
+	parts, err := strconv.Atoi(suffix)
+	if err != nil {
+		return false, false, nil
+	}
+	part, ok := etagPartSize(size, parts)
+	if !ok {
+		return false, false, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, false, i18n.Errorf("file.open", err)
+	}
+	defer file.Close()
+	local, err := multipartETag(file, size, part)
+	if err != nil {
+		return false, false, err
+	}
+	return local == etag, true, nil
+}
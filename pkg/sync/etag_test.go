@@ -0,0 +1,103 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: multipart ETags hashed in parallel
+func TestHashParts(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	defer func(workers int) { hashWorkers = workers }(hashWorkers)
+	for _, workers := range []int{1, 3, 16} {
+		hashWorkers = workers
+		sums, err := hashParts(bytes.NewReader(content), int64(len(content)), 3000, sha256.New)
+		require.NoError(t, err)
+		require.Len(t, sums, 4)
+		for i, sum := range sums {
+			want := sha256.Sum256(content[i*3000 : min((i+1)*3000, len(content))])
+			assert.Equal(t, want[:], sum, "part %d with %d workers", i, workers)
+		}
+	}
+
+	_, err := hashParts(failingReaderAt{}, 10000, 3000, sha256.New)
+	assert.Error(t, err)
+}
+
+type failingReaderAt struct{}
+
+func (failingReaderAt) ReadAt([]byte, int64) (int, error) { return 0, errors.New("input/output error") }
+
+func TestMultipartETag(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 2500)
+	var sums []byte
+	for offset := 0; offset < len(content); offset += 1000 {
+		sum := md5.Sum(content[offset:min(offset+1000, len(content))])
+		sums = append(sums, sum[:]...)
+	}
+	want := md5.Sum(sums)
+
+	etag, err := multipartETag(bytes.NewReader(content), int64(len(content)), 1000)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(want[:])+"-3", etag)
+}
+
+func TestETagPartSize(t *testing.T) {
+	for _, c := range []struct {
+		size  int64
+		parts int
+		want  int64
+		ok    bool
+	}{
+		{3*partSize + 1, 4, partSize, true},
+		{100 << 20, 13, 8 << 20, true},
+		{(16 << 20) + 1, 2, 9 << 20, true},
+		{10 << 20, 20, 0, false},
+		{0, 1, 0, false},
+	} {
+		part, ok := etagPartSize(c.size, c.parts)
+		assert.Equal(t, c.ok, ok, "%d bytes in %d parts", c.size, c.parts)
+		assert.Equal(t, c.want, part, "%d bytes in %d parts", c.size, c.parts)
+	}
+}
+
+func TestChangedComparesMultipartETag(t *testing.T) {
+	content := bytes.Repeat([]byte("b"), 3<<20+1)
+	path := createTempFile(t, t.TempDir(), "video.mp4", string(content))
+	etag, err := multipartETag(bytes.NewReader(content), int64(len(content)), 1<<20)
+	require.NoError(t, err)
+
+	for name, c := range map[string]struct {
+		etag    string
+		changed bool
+	}{
+		"same contents":      {etag, false},
+		"different contents": {fmt.Sprintf("%x-4", md5.Sum(nil)), true},
+		"unknown part size":  {etag[:len(etag)-2] + "-3000", true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := new(mockS3Client)
+			client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+				ContentLength: aws.Int64(int64(len(content))),
+				LastModified:  aws.Time(time.Now().Add(-time.Hour)),
+				ETag:          aws.String(`"` + c.etag + `"`),
+			}, nil).Once()
+
+			changed, err := newTestSyncer(t, client).fileChangedOnS3("video.mp4", path)
+			require.NoError(t, err)
+			assert.Equal(t, c.changed, changed)
+		})
+	}
+}
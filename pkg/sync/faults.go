@@ -0,0 +1,214 @@
+package sync
+
+import (
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Faults configures the fault injection test mode, which wraps the S3
+// client so the retry, resume and recovery paths can be exercised without
+// a misbehaving network. It is meant for CI and resilience drills, never for
+// real backups.
+type Faults struct {
+	UploadErrorRate float64       // fraction of uploads failing with a 500
+	ThrottleRate    float64       // fraction of requests failing with 503 SlowDown
+	SlowRead        time.Duration // delay added to every read of an upload body
+	CrashAfter      int64         // kill the process after this many uploads (0 never)
+	Seed            int64         // random seed; 0 picks one from the clock
+}
+
+// ParseFaults parses a --fault-inject spec such as
+// "upload-error=0.1,throttle=0.05,slow-read=20ms,crash-after=30,seed=7".
+func ParseFaults(spec string) (Faults, error) {
+	var f Faults
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return f, i18n.Errorf("faults.invalid", item)
+		}
+
+		var err error
+		switch name {
+		case "upload-error":
+			f.UploadErrorRate, err = parseRate(value)
+		case "throttle":
+			f.ThrottleRate, err = parseRate(value)
+		case "slow-read":
+			f.SlowRead, err = time.ParseDuration(value)
+		case "crash-after":
+			f.CrashAfter, err = strconv.ParseInt(value, 10, 64)
+		case "seed":
+			f.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return f, i18n.Errorf("faults.unknown", name)
+		}
+		if err != nil {
+			return f, i18n.Errorf("faults.invalid_value", name, err)
+		}
+	}
+	return f, nil
+}
+
+func parseRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, i18n.Errorf("faults.out_of_range", value)
+	}
+	return rate, nil
+}
+
+// crashProcess ends the process the way a power loss or OOM kill would,
+// skipping deferred cleanup. Tests replace it.
+var crashProcess = func() {
+	log.Print(i18n.T("faults.crash"))
+	os.Exit(86)
+}
+
+// faultyClient is an S3 client decorator injecting the configured faults
+// into the calls the sync engine depends on.
+type faultyClient struct {
+	s3iface.S3API
+	faults Faults
+
+	mu      gosync.Mutex
+	rnd     *rand.Rand
+	uploads atomic.Int64
+}
+
+func newFaultyClient(client s3iface.S3API, faults Faults) *faultyClient {
+	seed := faults.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &faultyClient{S3API: client, faults: faults, rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (c *faultyClient) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rnd.Float64() < rate
+}
+
+// requestFault returns the injected failure for one request, if any.
+func (c *faultyClient) requestFault(upload bool) error {
+	if c.roll(c.faults.ThrottleRate) {
+		return awserr.NewRequestFailure(awserr.New("SlowDown", i18n.T("faults.throttle"), nil), 503, "fault-inject")
+	}
+	if upload && c.roll(c.faults.UploadErrorRate) {
+		return awserr.NewRequestFailure(awserr.New("InternalError", i18n.T("faults.upload"), nil), 500, "fault-inject")
+	}
+	return nil
+}
+
+// uploaded counts a successful upload and crashes once CrashAfter is reached.
+func (c *faultyClient) uploaded() {
+	if c.faults.CrashAfter > 0 && c.uploads.Add(1) >= c.faults.CrashAfter {
+		crashProcess()
+	}
+}
+
+func (c *faultyClient) slowBody(body io.ReadSeeker) io.ReadSeeker {
+	if c.faults.SlowRead <= 0 || body == nil {
+		return body
+	}
+	return &slowReader{ReadSeeker: body, delay: c.faults.SlowRead}
+}
+
+func (c *faultyClient) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	if err := c.requestFault(false); err != nil {
+		return nil, err
+	}
+	return c.S3API.HeadObject(input)
+}
+
+func (c *faultyClient) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	if err := c.requestFault(true); err != nil {
+		return nil, err
+	}
+	input.Body = c.slowBody(input.Body)
+	output, err := c.S3API.PutObject(input)
+	if err == nil {
+		c.uploaded()
+	}
+	return output, err
+}
+
+func (c *faultyClient) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	if err := c.requestFault(false); err != nil {
+		return nil, err
+	}
+	return c.S3API.CreateMultipartUpload(input)
+}
+
+func (c *faultyClient) UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	if err := c.requestFault(true); err != nil {
+		return nil, err
+	}
+	input.Body = c.slowBody(input.Body)
+	output, err := c.S3API.UploadPart(input)
+	if err == nil {
+		c.uploaded()
+	}
+	return output, err
+}
+
+func (c *faultyClient) UploadPartCopy(input *s3.UploadPartCopyInput) (*s3.UploadPartCopyOutput, error) {
+	if err := c.requestFault(false); err != nil {
+		return nil, err
+	}
+	return c.S3API.UploadPartCopy(input)
+}
+
+func (c *faultyClient) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	if err := c.requestFault(false); err != nil {
+		return nil, err
+	}
+	return c.S3API.CopyObject(input)
+}
+
+func (c *faultyClient) CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	if err := c.requestFault(false); err != nil {
+		return nil, err
+	}
+	return c.S3API.CompleteMultipartUpload(input)
+}
+
+func (c *faultyClient) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	if err := c.requestFault(false); err != nil {
+		return nil, err
+	}
+	return c.S3API.DeleteObject(input)
+}
+
+// slowReader delays every read, simulating a congested link or slow disk.
+type slowReader struct {
+	io.ReadSeeker
+	delay time.Duration
+}
+
+func (r *slowReader) Read(b []byte) (int, error) {
+	time.Sleep(r.delay)
+	return r.ReadSeeker.Read(b)
+}
@@ -0,0 +1,93 @@
+package sync
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: fault injection test mode
+func TestParseFaults(t *testing.T) {
+	t.Run("full spec", func(t *testing.T) {
+		f, err := ParseFaults("upload-error=0.1, throttle=0.05,slow-read=20ms,crash-after=30,seed=7")
+		require.NoError(t, err)
+		assert.Equal(t, Faults{UploadErrorRate: 0.1, ThrottleRate: 0.05, SlowRead: 20 * time.Millisecond, CrashAfter: 30, Seed: 7}, f)
+	})
+
+	for _, spec := range []string{"upload-error", "upload-error=2", "throttle=abc", "slow-read=1", "explode=1"} {
+		t.Run("invalid "+spec, func(t *testing.T) {
+			_, err := ParseFaults(spec)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFaultyClient(t *testing.T) {
+	putInput := func() *s3.PutObjectInput {
+		return &s3.PutObjectInput{Bucket: aws.String("test-bucket"), Key: aws.String("a.txt"), Body: strings.NewReader("conteúdo")}
+	}
+
+	t.Run("upload errors are injected before reaching S3", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		client := newFaultyClient(mockClient, Faults{UploadErrorRate: 1})
+
+		_, err := client.PutObject(putInput())
+		var reqErr awserr.RequestFailure
+		require.ErrorAs(t, err, &reqErr)
+		assert.Equal(t, 500, reqErr.StatusCode())
+		mockClient.AssertNotCalled(t, "PutObject", mock.Anything)
+	})
+
+	t.Run("throttling applies to every request", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		client := newFaultyClient(mockClient, Faults{ThrottleRate: 1})
+
+		_, err := client.HeadObject(&s3.HeadObjectInput{Key: aws.String("a.txt")})
+		var reqErr awserr.RequestFailure
+		require.ErrorAs(t, err, &reqErr)
+		assert.Equal(t, "SlowDown", reqErr.Code())
+		assert.Equal(t, 503, reqErr.StatusCode())
+	})
+
+	t.Run("crashes after the configured number of uploads", func(t *testing.T) {
+		crashed := 0
+		original := crashProcess
+		crashProcess = func() { crashed++ }
+		defer func() { crashProcess = original }()
+
+		mockClient := new(mockS3Client)
+		mockClient.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil)
+		client := newFaultyClient(mockClient, Faults{CrashAfter: 2})
+
+		_, err := client.PutObject(putInput())
+		require.NoError(t, err)
+		assert.Equal(t, 0, crashed)
+
+		_, err = client.PutObject(putInput())
+		require.NoError(t, err)
+		assert.Equal(t, 1, crashed)
+	})
+
+	t.Run("slow reads delay the upload body", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		mockClient.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Run(func(args mock.Arguments) {
+			body := args.Get(0).(*s3.PutObjectInput).Body
+			start := time.Now()
+			_, err := io.ReadAll(body)
+			require.NoError(t, err)
+			assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+		})
+		client := newFaultyClient(mockClient, Faults{SlowRead: 10 * time.Millisecond})
+
+		_, err := client.PutObject(putInput())
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,68 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Version identifies the gui-sync build. Release builds set it with
+// -ldflags "-X github.com/gui-sync/pkg/sync.Version=<versão>".
+var Version = "dev"
+
+// FormatVersion is the layout of the documents gui-sync persists, locally
+// (checkpoints, bucket settings) and in the bucket (heartbeat). It only
+// changes when older builds could misread or damage a newer document.
+const FormatVersion = 1
+
+// Features lists the optional capabilities of this build. They are recorded
+// in every persisted document so mixed-version fleets can be diagnosed from
+// the documents alone.
+var Features = []string{"multipart-checkpoints", "checksum-negotiation", "heartbeat", "delta-uploads", "run-manifests"}
+
+// formatHeader makes a persisted document self-describing. Documents written
+// before it existed decode with FormatVersion 0 and are still readable.
+type formatHeader struct {
+	FormatVersion int      `json:"format_version"`
+	WrittenBy     string   `json:"written_by,omitempty"`
+	Features      []string `json:"features,omitempty"`
+}
+
+// versionedDocument is implemented by every type embedding formatHeader.
+type versionedDocument interface {
+	stampFormat()
+}
+
+func (h *formatHeader) stampFormat() {
+	h.FormatVersion = FormatVersion
+	h.WrittenBy = Version
+	h.Features = Features
+}
+
+// FormatError reports a document written in a newer format than this build
+// understands. gui-sync refuses to touch such documents instead of risking
+// overwriting state that a newer version depends on.
+type FormatError struct {
+	Document      string
+	FormatVersion int
+	WrittenBy     string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf(i18n.T("format.too_new"),
+		e.Document, e.FormatVersion, e.WrittenBy, Version, FormatVersion)
+}
+
+// checkFormat decodes the header of data and rejects documents from a newer
+// format. Data without a header is treated as the legacy format.
+func checkFormat(document string, data []byte) error {
+	var header formatHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	if header.FormatVersion > FormatVersion {
+		return &FormatError{Document: document, FormatVersion: header.FormatVersion, WrittenBy: header.WrittenBy}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package sync
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: self-describing state and format compatibility
+func TestStateFileFormat(t *testing.T) {
+	t.Run("written documents are stamped", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "settings.json")
+		require.NoError(t, writeStateFile(path, &bucketSettings{ChecksumAlgorithm: "SHA256"}))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var header formatHeader
+		require.NoError(t, json.Unmarshal(data, &header))
+		assert.Equal(t, FormatVersion, header.FormatVersion)
+		assert.Equal(t, Version, header.WrittenBy)
+		assert.Equal(t, Features, header.Features)
+	})
+
+	t.Run("legacy documents without header are read", func(t *testing.T) {
+		path := createTempFile(t, t.TempDir(), "settings.json", `{"checksum_algorithm": "CRC32"}`)
+
+		var settings bucketSettings
+		require.NoError(t, readStateFile(path, &settings))
+		assert.Equal(t, "CRC32", settings.ChecksumAlgorithm)
+	})
+
+	t.Run("newer format is refused", func(t *testing.T) {
+		path := createTempFile(t, t.TempDir(), "settings.json", `{"format_version": 99, "written_by": "9.0.0"}`)
+
+		var settings bucketSettings
+		err := readStateFile(path, &settings)
+		var formatErr *FormatError
+		require.ErrorAs(t, err, &formatErr)
+		assert.Equal(t, 99, formatErr.FormatVersion)
+		assert.Contains(t, err.Error(), "9.0.0")
+	})
+}
+
+func TestNewerCheckpointIsKept(t *testing.T) {
+	mockClient := new(mockS3Client)
+	s := newTestSyncer(t, mockClient)
+
+	path := createSparseFile(t, t.TempDir(), "disk.img", 2*partSize+1)
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	checkpoint := s.checkpointPath("disk.img")
+	require.NoError(t, os.MkdirAll(filepath.Dir(checkpoint), 0700))
+	require.NoError(t, os.WriteFile(checkpoint, []byte(`{"format_version": 99}`), 0600))
+
+	_, err = s.uploadMultipart("disk.img", file, 2*partSize+1)
+	var formatErr *FormatError
+	assert.ErrorAs(t, err, &formatErr)
+	assert.FileExists(t, checkpoint)
+	mockClient.AssertNotCalled(t, "CreateMultipartUpload", mock.Anything)
+}
+
+func TestCheckRemoteFormat(t *testing.T) {
+	heartbeatWith := func(body string) *s3.GetObjectOutput {
+		return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body))}
+	}
+
+	t.Run("no heartbeat yet", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything).Return(nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)).Once()
+
+		assert.NoError(t, newTestSyncer(t, mockClient).checkRemoteFormat())
+	})
+
+	t.Run("compatible heartbeat", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything).Return(heartbeatWith(`{"format_version": 1, "written_by": "dev"}`), nil).Once()
+
+		assert.NoError(t, newTestSyncer(t, mockClient).checkRemoteFormat())
+	})
+
+	t.Run("heartbeat from a newer format", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything).Return(heartbeatWith(`{"format_version": 2, "written_by": "2.0.0"}`), nil).Once()
+
+		err := newTestSyncer(t, mockClient).checkRemoteFormat()
+		var formatErr *FormatError
+		require.ErrorAs(t, err, &formatErr)
+		assert.Contains(t, err.Error(), heartbeatKey)
+	})
+}
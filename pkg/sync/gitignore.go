@@ -0,0 +1,200 @@
+package sync
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// gitignoreRule is one pattern of a .gitignore file.
+type gitignoreRule struct {
+	// base is the directory of the .gitignore file, relative to the root
+	// ("" for the root itself); the pattern only applies below it.
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+	// anchored patterns contain a slash and match the path relative to
+	// base; the others match the name at any depth.
+	anchored bool
+}
+
+// gitignoreMatcher applies the .gitignore files of a tree (Config.GitIgnore)
+// with git's semantics: patterns are relative to the directory of their
+// file, deeper files and later lines take precedence, ! re-includes, and
+// nothing below an ignored directory can be re-included. Files are read
+// lazily, once per run, as the directories holding them are visited.
+type gitignoreMatcher struct {
+	root string
+
+	mu    sync.Mutex
+	files map[string][]gitignoreRule // by directory
+	dirs  map[string]bool            // ignored state of directories
+}
+
+func newGitignoreMatcher(root string) *gitignoreMatcher {
+	return &gitignoreMatcher{root: root, files: make(map[string][]gitignoreRule), dirs: make(map[string]bool)}
+}
+
+// ignored reports whether the file at relPath, a slash-separated path
+// relative to the root, is excluded by a .gitignore file.
+func (g *gitignoreMatcher) ignored(relPath string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	dir := path.Dir(relPath)
+	if dir != "." && g.dirIgnored(dir) {
+		return true
+	}
+	return g.match(relPath, false)
+}
+
+// dirIgnored reports whether dir or one of its parents is ignored. It is
+// called with mu held.
+func (g *gitignoreMatcher) dirIgnored(dir string) bool {
+	if ignored, ok := g.dirs[dir]; ok {
+		return ignored
+	}
+	ignored := false
+	if parent := path.Dir(dir); parent != "." && g.dirIgnored(parent) {
+		ignored = true
+	} else {
+		ignored = g.match(dir, true)
+	}
+	g.dirs[dir] = ignored
+	return ignored
+}
+
+// match applies the rules of the .gitignore files above relPath, the last
+// matching rule deciding. It is called with mu held.
+func (g *gitignoreMatcher) match(relPath string, isDir bool) bool {
+	ignored := false
+	for _, dir := range ancestors(relPath) {
+		for _, rule := range g.rulesOf(dir) {
+			if rule.matches(relPath, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// ancestors lists the directories containing relPath, from the root ("")
+// down to its parent.
+func ancestors(relPath string) []string {
+	dirs := []string{""}
+	for i, c := range relPath {
+		if c == '/' {
+			dirs = append(dirs, relPath[:i])
+		}
+	}
+	return dirs
+}
+
+func (g *gitignoreMatcher) rulesOf(dir string) []gitignoreRule {
+	if rules, ok := g.files[dir]; ok {
+		return rules
+	}
+	file := filepath.Join(g.root, filepath.FromSlash(dir), ".gitignore")
+	rules, err := readGitignore(file, dir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf(i18n.T("file.read_failed"), file, err)
+	}
+	g.files[dir] = rules
+	return rules
+}
+
+// readGitignore parses the .gitignore file at file, found in the directory
+// base.
+func readGitignore(file, base string) ([]gitignoreRule, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []gitignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseGitignoreLine(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+func parseGitignoreLine(line, base string) (gitignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are dropped unless escaped with a backslash.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return gitignoreRule{}, false
+	}
+
+	rule := gitignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return gitignoreRule{}, false
+	}
+	rule.anchored = strings.Contains(line, "/")
+	rule.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	return rule, true
+}
+
+func (r gitignoreRule) matches(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		rest, ok := strings.CutPrefix(relPath, r.base+"/")
+		if !ok {
+			return false
+		}
+		relPath = rest
+	}
+	if !r.anchored {
+		matched, _ := path.Match(r.segments[0], path.Base(relPath))
+		return matched
+	}
+	return matchSegments(r.segments, strings.Split(relPath, "/"))
+}
+
+// matchSegments matches a path against a pattern, both split on slashes,
+// where a ** segment matches any number of path segments.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], name[0]); !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,98 @@
+package sync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: .gitignore files
+func TestGitignoreMatcher(t *testing.T) {
+	root := t.TempDir()
+	createTempFile(t, root, ".gitignore", "# build output\n*.log\n/dist\nbuild/\n!important.log\ndocs/**/*.tmp\n")
+	createTempFile(t, root, "app/.gitignore", "*.cache\n/local.json\n!keep.cache\n")
+	createTempFile(t, root, "app/vendor/.gitignore", "!*.log\n")
+	createTempFile(t, root, "build/.gitignore", "!keep.txt\n")
+
+	g := newGitignoreMatcher(root)
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"main.go", false},
+		{"debug.log", true},
+		{"app/logs/debug.log", true},
+		{"important.log", false},
+		{"dist/app.js", true},
+		{"app/dist/app.js", false},
+		{"build/out.o", true},
+		{"build/keep.txt", true},
+		{"app/build/out.o", true},
+		{"app/data.cache", true},
+		{"data.cache", false},
+		{"app/keep.cache", false},
+		{"app/local.json", true},
+		{"app/sub/local.json", false},
+		{"app/vendor/lib.log", false},
+		{"docs/a/b/page.tmp", true},
+		{"docs/page.tmp", true},
+		{"src/page.tmp", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, g.ignored(tt.path))
+		})
+	}
+}
+
+func TestParseGitignoreLine(t *testing.T) {
+	tests := []struct {
+		line string
+		ok   bool
+		want gitignoreRule
+	}{
+		{"", false, gitignoreRule{}},
+		{"# comment", false, gitignoreRule{}},
+		{"\\#file", true, gitignoreRule{segments: []string{"#file"}}},
+		{"\\!file", true, gitignoreRule{segments: []string{"!file"}}},
+		{"!keep", true, gitignoreRule{segments: []string{"keep"}, negate: true}},
+		{"tmp/  ", true, gitignoreRule{segments: []string{"tmp"}, dirOnly: true}},
+		{"/root.txt", true, gitignoreRule{segments: []string{"root.txt"}, anchored: true}},
+		{"a/**/b", true, gitignoreRule{segments: []string{"a", "**", "b"}, anchored: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			rule, ok := parseGitignoreLine(tt.line, "")
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, rule)
+		})
+	}
+}
+
+func TestScannerHonorsGitignore(t *testing.T) {
+	root := t.TempDir()
+	createTempFile(t, root, ".gitignore", "node_modules/\n*.o\n")
+	createTempFile(t, root, "main.c", "int main() {}")
+	createTempFile(t, root, "main.o", "\x7fELF")
+	createTempFile(t, root, "node_modules/lib/index.js", "module.exports = {}")
+
+	collect := func(s *Syncer) []string {
+		entries := make(chan fileEntry, 10)
+		require.NoError(t, (&scanner{root: root, ignore: s.shouldIgnore}).run(context.Background(), entries))
+		var keys []string
+		for entry := range entries {
+			keys = append(keys, entry.relPath)
+		}
+		return keys
+	}
+
+	s := newTestSyncer(t, new(mockS3Client))
+	assert.Len(t, collect(s), 4, "without the option .gitignore is not read")
+
+	s.gitignore = newGitignoreMatcher(root)
+	assert.ElementsMatch(t, []string{".gitignore", "main.c"}, collect(s))
+}
@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Objects in GLACIER and DEEP_ARCHIVE must be restored (thawed) before they
+// can be downloaded: RestoreObject makes a temporary readable copy of each
+// one, which takes minutes to hours depending on the tier.
+const (
+	defaultThawDays = 1
+	// errCodeRestoreInProgress is returned by RestoreObject while an earlier
+	// request for the same object is still running.
+	errCodeRestoreInProgress = "RestoreAlreadyInProgress"
+)
+
+// thawPollInterval is how often restore checks whether the objects it
+// asked to thaw can be downloaded yet.
+var thawPollInterval = 5 * time.Minute
+
+// errFrozen is returned by downloadObject for an object that must be
+// thawed first.
+var errFrozen = errors.New("object in an archive storage class")
+
+// glacierTiers maps the values accepted for Config.GlacierTier,
+// case-insensitively, to the retrieval tiers of S3.
+var glacierTiers = map[string]string{
+	"standard":  s3.TierStandard,
+	"bulk":      s3.TierBulk,
+	"expedited": s3.TierExpedited,
+}
+
+// ParseGlacierTier parses the retrieval tier given to `restore
+// -glacier-tier`: standard, bulk or expedited.
+func ParseGlacierTier(value string) (string, error) {
+	tier, ok := glacierTiers[strings.ToLower(value)]
+	if !ok {
+		return "", i18n.Errorf("glacier.invalid_tier", value)
+	}
+	return tier, nil
+}
+
+// frozenClass reports whether objects of the storage class must be thawed
+// before they are read. GLACIER_IR objects are read directly.
+func frozenClass(class string) bool {
+	return class == s3.ObjectStorageClassGlacier || class == s3.ObjectStorageClassDeepArchive
+}
+
+// thawed reports whether the x-amz-restore header of an object says its
+// restored copy is ready.
+func thawed(restore *string) bool {
+	return strings.Contains(aws.StringValue(restore), `ongoing-request="false"`)
+}
+
+// requestThaw asks S3 to make obj readable for Config.GlacierDays days with
+// Config.GlacierTier. A request already running for the object is fine.
+func (s *Syncer) requestThaw(obj restoreObject) error {
+	input := &s3.RestoreObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(obj.key),
+		RestoreRequest: &s3.RestoreRequest{
+			Days:                 aws.Int64(int64(cmp.Or(s.cfg.GlacierDays, defaultThawDays))),
+			GlacierJobParameters: &s3.GlacierJobParameters{Tier: aws.String(cmp.Or(s.cfg.GlacierTier, s3.TierStandard))},
+		},
+	}
+	if obj.versionID != "" {
+		input.VersionId = aws.String(obj.versionID)
+	}
+	if _, err := s.client.RestoreObject(input); err != nil {
+		if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == errCodeRestoreInProgress || aerr.Code() == s3.ErrCodeObjectAlreadyInActiveTierError) {
+			return nil
+		}
+		return i18n.Errorf("glacier.request_failed", err)
+	}
+	return nil
+}
+
+// thaw requests the restore of every object of frozen and waits until they
+// can be downloaded, checking every thawPollInterval. It returns the
+// objects ready to download, reporting the others as failed.
+func (s *Syncer) thaw(frozen []restoreObject, progress *restoreProgress) []restoreObject {
+	if len(frozen) == 0 {
+		return nil
+	}
+	fmt.Printf(i18n.T("glacier.requesting"), len(frozen), cmp.Or(s.cfg.GlacierTier, s3.TierStandard), cmp.Or(s.cfg.GlacierDays, defaultThawDays))
+
+	var pending []restoreObject
+	for _, obj := range frozen {
+		if err := s.requestThaw(obj); err != nil {
+			progress.fail(obj.key, err)
+			continue
+		}
+		pending = append(pending, obj)
+	}
+
+	var ready []restoreObject
+	for {
+		var waiting []restoreObject
+		for _, obj := range pending {
+			input := &s3.HeadObjectInput{Bucket: aws.String(s.cfg.Bucket), Key: aws.String(obj.key)}
+			if obj.versionID != "" {
+				input.VersionId = aws.String(obj.versionID)
+			}
+			head, err := s.client.HeadObject(input)
+			switch {
+			case err != nil:
+				progress.fail(obj.key, i18n.Errorf("s3.head", err))
+			case thawed(head.Restore):
+				ready = append(ready, obj)
+			default:
+				waiting = append(waiting, obj)
+			}
+		}
+		if len(waiting) == 0 {
+			return ready
+		}
+		fmt.Printf(i18n.T("glacier.waiting"), len(waiting), thawPollInterval)
+		time.Sleep(thawPollInterval)
+		pending = waiting
+	}
+}
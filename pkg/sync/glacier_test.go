@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: restores from Glacier
+func TestParseGlacierTier(t *testing.T) {
+	tier, err := ParseGlacierTier("Bulk")
+	require.NoError(t, err)
+	assert.Equal(t, s3.TierBulk, tier)
+
+	_, err = ParseGlacierTier("instant")
+	assert.Equal(t, "glacier.invalid_tier", i18n.ID(err))
+}
+
+func TestRestoreThawsGlacierObjects(t *testing.T) {
+	defer func(interval time.Duration) { thawPollInterval = interval }(thawPollInterval)
+	thawPollInterval = time.Millisecond
+
+	isKey := func(key string) interface{} {
+		return mock.MatchedBy(func(input *s3.GetObjectInput) bool { return *input.Key == key })
+	}
+	headKey := func(key string) interface{} {
+		return mock.MatchedBy(func(input *s3.HeadObjectInput) bool { return *input.Key == key })
+	}
+	body := func(content string) *s3.GetObjectOutput {
+		return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(content))}
+	}
+
+	mockClient := new(mockS3Client)
+	mockClient.On("RestoreObject", mock.MatchedBy(func(input *s3.RestoreObjectInput) bool {
+		return *input.Key == "fotos/antiga.jpg" && *input.VersionId == "v1" &&
+			*input.RestoreRequest.Days == 3 && *input.RestoreRequest.GlacierJobParameters.Tier == s3.TierBulk
+	})).Return(&s3.RestoreObjectOutput{}, nil).Once()
+	mockClient.On("HeadObject", headKey("fotos/antiga.jpg")).Return(&s3.HeadObjectOutput{Restore: aws.String(`ongoing-request="true"`)}, nil).Once()
+	mockClient.On("HeadObject", headKey("fotos/antiga.jpg")).Return(&s3.HeadObjectOutput{Restore: aws.String(`ongoing-request="false", expiry-date="Fri, 03 May 2024 00:00:00 GMT"`)}, nil).Once()
+	mockClient.On("GetObject", isKey("fotos/antiga.jpg")).Return(body("antiga"), nil).Once()
+
+	// Moved to Glacier by a lifecycle rule after it was listed.
+	mockClient.On("GetObject", isKey("fotos/movida.jpg")).Return(nil, awserr.New(s3.ErrCodeInvalidObjectState, "archived", nil)).Once()
+	mockClient.On("RestoreObject", mock.MatchedBy(func(input *s3.RestoreObjectInput) bool {
+		return *input.Key == "fotos/movida.jpg"
+	})).Return(nil, awserr.New(errCodeRestoreInProgress, "in progress", nil)).Once()
+	mockClient.On("HeadObject", headKey("fotos/movida.jpg")).Return(&s3.HeadObjectOutput{Restore: aws.String(`ongoing-request="false"`)}, nil)
+	mockClient.On("GetObject", isKey("fotos/movida.jpg")).Return(body("movida"), nil).Once()
+
+	mockClient.On("GetObject", isKey("fotos/nova.jpg")).Return(body("nova"), nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	s.cfg.GlacierTier = s3.TierBulk
+	s.cfg.GlacierDays = 3
+	target := t.TempDir()
+	require.NoError(t, s.restoreObjects(target, []restoreObject{
+		{key: "fotos/antiga.jpg", versionID: "v1", storageClass: s3.ObjectStorageClassDeepArchive},
+		{key: "fotos/movida.jpg"},
+		{key: "fotos/nova.jpg", storageClass: s3.ObjectStorageClassStandard},
+	}, RestoreSelection{}))
+	mockClient.AssertExpectations(t)
+
+	for name, content := range map[string]string{"antiga.jpg": "antiga", "movida.jpg": "movida", "nova.jpg": "nova"} {
+		data, err := os.ReadFile(filepath.Join(target, "fotos", name))
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+	}
+}
+
+func TestRestoreGlacierRequestFailure(t *testing.T) {
+	mockClient := new(mockS3Client)
+	mockClient.On("RestoreObject", mock.Anything).Return(nil, awserr.New("AccessDenied", "denied", nil)).Once()
+
+	s := newTestSyncer(t, mockClient)
+	err := s.restoreObjects(t.TempDir(), []restoreObject{{key: "a.txt", storageClass: s3.ObjectStorageClassGlacier}}, RestoreSelection{})
+	assert.Equal(t, "restore.failed", i18n.ID(err))
+	mockClient.AssertNotCalled(t, "GetObject", mock.Anything)
+}
@@ -0,0 +1,153 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// With Config.HardLinks, files sharing an inode are uploaded once: the
+// first one a walk meets is uploaded as usual, and the others as empty
+// objects whose metadata names its key, as symbolic links are. Restore
+// links them to it again instead of writing the contents several times.
+
+// fileID identifies a file by its device and inode.
+type fileID struct {
+	dev, ino uint64
+}
+
+// hardLinks maps the files with several hard links a walk met to the key
+// of the first one. A nil hardLinks, when Config.HardLinks is off, links
+// nothing.
+type hardLinks map[fileID]string
+
+func (s *Syncer) newHardLinks() hardLinks {
+	if !s.cfg.HardLinks {
+		return nil
+	}
+	return make(hardLinks)
+}
+
+// link returns the key of the file met earlier in the walk that the file
+// of info, at key, is a hard link to, or "" for the first one. linked
+// reports whether the file has other hard links at all.
+func (l hardLinks) link(key string, info os.FileInfo) (target string, linked bool) {
+	if l == nil {
+		return "", false
+	}
+	id, ok := hardLinkID(info)
+	if !ok {
+		return "", false
+	}
+	if first, seen := l[id]; seen {
+		return first, true
+	}
+	l[id] = key
+	return "", true
+}
+
+// hardLinkChanged reports whether the object at s3Key is not already the
+// hard link to target.
+func (s *Syncer) hardLinkChanged(s3Key, target string) (bool, error) {
+	head, err := s.headObject(s3Key)
+	if err != nil {
+		if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == http.StatusNotFound {
+			return true, nil
+		}
+		return false, i18n.Errorf("s3.head", err)
+	}
+	stored, ok := storedHardLink(head.Metadata)
+	return !ok || stored != target, nil
+}
+
+// uploadHardLink stores the file at path as an empty object whose metadata
+// names target, the key of the file it is a hard link to.
+func (s *Syncer) uploadHardLink(s3Key, target, path string) (int64, error) {
+	s.objects.remove(s3Key)
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, i18n.Errorf("file.stat", err)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(s.cfg.Bucket),
+		Key:      aws.String(s3Key),
+		Body:     bytes.NewReader(nil),
+		Metadata: hardLinkMetadata(info, target),
+	}
+	s.retention(nil).applyPut(input)
+	if err := s.setPutChecksum(input, bytes.NewReader(nil)); err != nil {
+		return 0, err
+	}
+	if _, err := s.client.PutObject(input); err != nil {
+		return 0, i18n.Errorf("s3.upload", err)
+	}
+	return 0, nil
+}
+
+// linkedObject is returned by downloadObject for an object standing for a
+// hard link to the file at target.
+type linkedObject struct {
+	target string
+}
+
+func (e *linkedObject) Error() string {
+	return fmt.Sprintf(i18n.T("restore.hard_link"), e.target)
+}
+
+// pendingLink is a hard link of a restore, recreated once the files are
+// downloaded.
+type pendingLink struct {
+	obj    restoreObject
+	target string
+}
+
+func (p *restoreProgress) link(obj restoreObject, target string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.links = append(p.links, pendingLink{obj: obj, target: target})
+}
+
+// restoreHardLinks recreates the hard links met by downloadFiles. A link to
+// a file left out of the restore, or that the file system cannot link to,
+// gets a copy of its contents instead.
+func (s *Syncer) restoreHardLinks(targetDir string, objects []restoreObject, progress *restoreProgress) {
+	byKey := make(map[string]restoreObject, len(objects))
+	for _, obj := range objects {
+		byKey[obj.key] = obj
+	}
+	for _, link := range progress.links {
+		if err := s.restoreHardLink(targetDir, link, byKey, progress.restored[link.target]); err != nil {
+			progress.fail(link.obj.key, err)
+			continue
+		}
+		progress.succeed(link.obj)
+	}
+}
+
+func (s *Syncer) restoreHardLink(targetDir string, link pendingLink, objects map[string]restoreObject, restored bool) error {
+	localPath, err := restorePath(targetDir, s.localName(link.obj.key))
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+		return i18n.Errorf("restore.replace", localPath, err)
+	}
+	if restored {
+		if targetPath, err := restorePath(targetDir, s.localName(link.target)); err == nil && os.Link(targetPath, localPath) == nil {
+			return nil
+		}
+	}
+
+	source, ok := objects[link.target]
+	if !ok {
+		return i18n.Errorf("restore.link_missing", link.target)
+	}
+	return s.downloadTo(source, localPath)
+}
@@ -0,0 +1,149 @@
+package sync
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// linkedTree creates a.txt and b.txt, hard links to each other, and c.txt.
+func linkedTree(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("hard links are not detected on Windows")
+	}
+	dir := t.TempDir()
+	createTempFile(t, dir, "a.txt", "conteúdo compartilhado")
+	require.NoError(t, os.Link(filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")))
+	createTempFile(t, dir, "c.txt", "sozinho")
+	return dir
+}
+
+// Test Suite: hard links uploaded once
+func TestHardLinksLink(t *testing.T) {
+	dir := linkedTree(t)
+	stat := func(name string) os.FileInfo {
+		info, err := os.Lstat(filepath.Join(dir, name))
+		require.NoError(t, err)
+		return info
+	}
+
+	links := make(hardLinks)
+	target, linked := links.link("a.txt", stat("a.txt"))
+	assert.Equal(t, "", target)
+	assert.True(t, linked)
+	target, linked = links.link("b.txt", stat("b.txt"))
+	assert.Equal(t, "a.txt", target)
+	assert.True(t, linked)
+	target, linked = links.link("c.txt", stat("c.txt"))
+	assert.Equal(t, "", target)
+	assert.False(t, linked)
+
+	var off hardLinks
+	target, linked = off.link("b.txt", stat("b.txt"))
+	assert.Equal(t, "", target)
+	assert.False(t, linked)
+}
+
+func TestSyncUploadsHardLinkOnce(t *testing.T) {
+	dir := linkedTree(t)
+	notFound := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")
+
+	client := new(mockS3Client)
+	client.On("HeadObject", mock.Anything).Return(nil, notFound)
+	client.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{}, nil)
+	for _, key := range []string{"a.txt", "c.txt"} {
+		client.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+			_, link := storedHardLink(input.Metadata)
+			return aws.StringValue(input.Key) == key && !link
+		})).Return(&s3.PutObjectOutput{}, nil).Once()
+	}
+	client.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		target, _ := storedHardLink(input.Metadata)
+		return aws.StringValue(input.Key) == "b.txt" && target == "a.txt"
+	})).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, client)
+	s.cfg.HardLinks = true
+	result, err := s.syncDirectoryWithS3(context.Background(), dir)
+	require.NoError(t, err)
+	assert.NoError(t, result.Err())
+	client.AssertExpectations(t)
+	assert.Equal(t, int64(len("conteúdo compartilhado")+len("sozinho")), s.stats.summary().BytesUploaded)
+
+	t.Run("a link already stored is skipped", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+			Metadata: map[string]*string{hardLinkMetaKey: aws.String("a.txt")},
+		}, nil).Once()
+		s := newTestSyncer(t, client)
+
+		changed, err := s.hardLinkChanged("b.txt", "a.txt")
+		require.NoError(t, err)
+		assert.False(t, changed)
+	})
+
+	t.Run("a file no longer linked is uploaded again", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+			ContentLength: aws.Int64(0),
+			Metadata:      map[string]*string{hardLinkMetaKey: aws.String("a.txt")},
+		}, nil).Once()
+
+		changed, err := newTestSyncer(t, client).fileChangedOnS3("b.txt", filepath.Join(dir, "b.txt"))
+		require.NoError(t, err)
+		assert.True(t, changed)
+	})
+}
+
+func TestRestoreHardLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hard links are not detected on Windows")
+	}
+	newClient := func() *mockS3Client {
+		client := new(mockS3Client)
+		client.On("GetObject", mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return *input.Key == "a.txt"
+		})).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("conteúdo"))}, nil).Once()
+		client.On("GetObject", mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return *input.Key == "links/b.txt"
+		})).Return(&s3.GetObjectOutput{
+			Body:     io.NopCloser(strings.NewReader("")),
+			Metadata: map[string]*string{hardLinkMetaKey: aws.String("a.txt")},
+		}, nil).Once()
+		return client
+	}
+	objects := []restoreObject{{key: "a.txt", size: int64(len("conteúdo"))}, {key: "links/b.txt"}}
+
+	t.Run("the link is recreated", func(t *testing.T) {
+		target := t.TempDir()
+		require.NoError(t, newTestSyncer(t, newClient()).restoreObjects(target, objects, RestoreSelection{}))
+
+		a, err := os.Stat(filepath.Join(target, "a.txt"))
+		require.NoError(t, err)
+		b, err := os.Stat(filepath.Join(target, "links", "b.txt"))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(a, b))
+	})
+
+	t.Run("a link to a file left out gets its contents", func(t *testing.T) {
+		target := t.TempDir()
+		sel := RestoreSelection{Paths: []string{"links/b.txt"}}
+		require.NoError(t, newTestSyncer(t, newClient()).restoreObjects(target, objects, sel))
+
+		content, err := os.ReadFile(filepath.Join(target, "links", "b.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "conteúdo", string(content))
+		assert.NoFileExists(t, filepath.Join(target, "a.txt"))
+	})
+}
@@ -0,0 +1,88 @@
+package sync
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// The differ compares Config.HeadWorkers files at once, so that runs over
+// buckets too large to list are not paced by the round trip of one
+// HeadObject after the other. The HeadObject results go through a cache
+// shared by the workers and the uploads: requests for a key already being
+// read wait for that call, and the upload of a changed file reuses the
+// result of its comparison instead of reading the object again.
+
+// headCache holds the HeadObject results of the keys in flight during a
+// run. Entries are dropped once their file is done with, so the cache
+// holds the files between the differ and the end of their uploads rather
+// than the whole tree. The zero value is ready to use.
+type headCache struct {
+	mu    sync.Mutex
+	calls map[string]*headCall
+}
+
+// headCall is a HeadObject of a key, done once done is closed.
+type headCall struct {
+	done chan struct{}
+	head *s3.HeadObjectOutput
+	err  error
+}
+
+func (c *headCache) reset() {
+	c.mu.Lock()
+	c.calls = nil
+	c.mu.Unlock()
+}
+
+// forget drops the result of key, whose file is done with or whose object
+// is being replaced.
+func (c *headCache) forget(key string) {
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.mu.Unlock()
+}
+
+// headObject returns the HeadObject of the object at key, from the head
+// cache when the run already read it. Errors other than a missing object
+// are not kept, so that retries read the object again.
+func (s *Syncer) headObject(key string) (*s3.HeadObjectOutput, error) {
+	c := &s.heads
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.head, call.err
+	}
+	if c.calls == nil {
+		c.calls = make(map[string]*headCall)
+	}
+	call := &headCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	call.head, call.err = s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(key),
+	})
+	close(call.done)
+	if aerr, ok := call.err.(awserr.RequestFailure); call.err != nil && !(ok && aerr.StatusCode() == http.StatusNotFound) {
+		c.mu.Lock()
+		if c.calls[key] == call {
+			delete(c.calls, key)
+		}
+		c.mu.Unlock()
+	}
+	return call.head, call.err
+}
+
+// headWorkers returns how many files the differ compares at once.
+func (s *Syncer) headWorkers() int {
+	if s.cfg.HeadWorkers < 1 {
+		return 1
+	}
+	return s.cfg.HeadWorkers
+}
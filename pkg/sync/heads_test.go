@@ -0,0 +1,92 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: shared HeadObject results
+func TestHeadObjectShared(t *testing.T) {
+	client := new(mockS3Client)
+	client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{ETag: aws.String(`"abc"`)}, nil).Once().After(20 * time.Millisecond)
+	s := newTestSyncer(t, client)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			head, err := s.headObject("a.txt")
+			assert.NoError(t, err)
+			assert.Equal(t, `"abc"`, aws.StringValue(head.ETag))
+		}()
+	}
+	wg.Wait()
+	client.AssertNumberOfCalls(t, "HeadObject", 1)
+
+	s.heads.forget("a.txt")
+	client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{ETag: aws.String(`"def"`)}, nil).Once()
+	head, err := s.headObject("a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, `"def"`, aws.StringValue(head.ETag), "a forgotten key is read again")
+}
+
+func TestHeadObjectErrorsNotKept(t *testing.T) {
+	notFound := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")
+	client := new(mockS3Client)
+	client.On("HeadObject", mock.Anything).Return(nil, errors.New("connection reset")).Once()
+	client.On("HeadObject", mock.Anything).Return(nil, notFound).Once()
+	s := newTestSyncer(t, client)
+
+	_, err := s.headObject("a.txt")
+	assert.EqualError(t, err, "connection reset")
+	_, err = s.headObject("a.txt")
+	assert.Equal(t, notFound, err)
+	_, err = s.headObject("a.txt")
+	assert.Equal(t, notFound, err, "a missing object is kept")
+	client.AssertNumberOfCalls(t, "HeadObject", 2)
+}
+
+func TestHeadWorkers(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	assert.Equal(t, 1, s.headWorkers())
+	s.cfg.HeadWorkers = -3
+	assert.Equal(t, 1, s.headWorkers())
+	s.cfg.HeadWorkers = 8
+	assert.Equal(t, 8, s.headWorkers())
+}
+
+func TestSyncComparesInParallel(t *testing.T) {
+	notFound := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")
+	tempDir := t.TempDir()
+	for i := 0; i < 12; i++ {
+		createTempFile(t, tempDir, fmt.Sprintf("f%02d.txt", i), "x")
+	}
+
+	client := new(mockS3Client)
+	client.On("HeadObject", mock.Anything).Return(nil, notFound).Times(12)
+	client.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Times(12)
+	client.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{}, nil)
+
+	s := newTestSyncer(t, client)
+	s.cfg.HeadWorkers = 4
+	result, err := s.syncDirectoryWithS3(context.Background(), tempDir)
+	require.NoError(t, err)
+	require.NoError(t, result.Err())
+	client.AssertExpectations(t)
+	assert.Equal(t, int64(12), s.stats.summary().Uploaded)
+	s.heads.mu.Lock()
+	assert.Empty(t, s.heads.calls, "uploaded keys are dropped from the cache")
+	s.heads.mu.Unlock()
+}
@@ -0,0 +1,85 @@
+package sync
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// healthcheckTimeout bounds every ping. A monitoring service that is down
+// must not delay the backup it monitors.
+const healthcheckTimeout = 10 * time.Second
+
+// Healthcheck pings sent around a run, in the healthchecks.io convention
+// also understood by Cronitor and others: the check URL itself reports a
+// success, with /start and /fail appended for the other events.
+const (
+	pingStart   = "start"
+	pingSuccess = ""
+	pingFail    = "fail"
+)
+
+// validateHealthcheckURL checks that raw is an absolute http(s) URL.
+func validateHealthcheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return i18n.Errorf("healthcheck.invalid_url", raw)
+	}
+	return nil
+}
+
+// healthcheckPingURL returns the URL of event for the check at raw, keeping
+// its query string.
+func healthcheckPingURL(raw, event string) string {
+	u, err := url.Parse(raw)
+	if err != nil || event == pingSuccess {
+		return raw
+	}
+	u.Path = path.Join("/", u.Path, event)
+	return u.String()
+}
+
+// pingHealthcheck sends event to Config.HealthcheckURL, with body (the
+// run summary or its error) as the log attached to the ping. Failures are
+// logged: monitoring never fails the run.
+func (s *Syncer) pingHealthcheck(ctx context.Context, event, body string) {
+	if s.cfg.HealthcheckURL == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), healthcheckTimeout)
+	defer cancel()
+
+	target := healthcheckPingURL(s.cfg.HealthcheckURL, event)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, strings.NewReader(body))
+	if err != nil {
+		log.Printf(i18n.T("healthcheck.ping_failed"), err)
+		return
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf(i18n.T("healthcheck.ping_failed"), err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf(i18n.T("healthcheck.ping_failed"), resp.Status)
+	}
+}
+
+// pingHealthcheckResult reports the outcome of the run that just finished.
+func (s *Syncer) pingHealthcheckResult(ctx context.Context, runErr error) {
+	if runErr != nil {
+		s.pingHealthcheck(ctx, pingFail, runErr.Error())
+		return
+	}
+	s.pingHealthcheck(ctx, pingSuccess, s.stats.summary().String())
+}
@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: healthcheck pings
+func TestHealthcheckPingURL(t *testing.T) {
+	tests := []struct {
+		url, event, want string
+	}{
+		{"https://hc-ping.com/uuid", pingStart, "https://hc-ping.com/uuid/start"},
+		{"https://hc-ping.com/uuid", pingSuccess, "https://hc-ping.com/uuid"},
+		{"https://hc-ping.com/uuid/", pingFail, "https://hc-ping.com/uuid/fail"},
+		{"https://hc-ping.com/key/backup?create=1", pingFail, "https://hc-ping.com/key/backup/fail?create=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, healthcheckPingURL(tt.url, tt.event))
+		})
+	}
+}
+
+func TestValidateHealthcheckURL(t *testing.T) {
+	assert.NoError(t, validateHealthcheckURL("https://hc-ping.com/uuid"))
+	assert.Equal(t, "healthcheck.invalid_url", i18n.ID(validateHealthcheckURL("hc-ping.com/uuid")))
+	assert.Equal(t, "healthcheck.invalid_url", i18n.ID(validateHealthcheckURL("ftp://hc-ping.com/uuid")))
+}
+
+func TestPingHealthcheck(t *testing.T) {
+	var paths, bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, string(data))
+	}))
+	defer server.Close()
+
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.HealthcheckURL = server.URL + "/uuid"
+	s.stats.reset()
+	s.stats.uploaded.Store(3)
+
+	t.Run("successful run", func(t *testing.T) {
+		paths, bodies = nil, nil
+		s.pingHealthcheck(context.Background(), pingStart, "")
+		s.pingHealthcheckResult(context.Background(), nil)
+
+		require.Len(t, paths, 2)
+		assert.Equal(t, []string{"/uuid/start", "/uuid"}, paths)
+		assert.Contains(t, bodies[1], "3 uploaded")
+	})
+
+	t.Run("failed run", func(t *testing.T) {
+		paths, bodies = nil, nil
+		s.pingHealthcheckResult(context.Background(), errors.New("access denied"))
+
+		assert.Equal(t, []string{"/uuid/fail"}, paths)
+		assert.Equal(t, []string{"access denied"}, bodies)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		paths = nil
+		s.cfg.HealthcheckURL = ""
+		s.pingHealthcheckResult(context.Background(), nil)
+		assert.Empty(t, paths)
+	})
+}
@@ -0,0 +1,225 @@
+package sync
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+const heartbeatKey = reservedPrefix + "heartbeat.json"
+
+// heartbeat is the document written to heartbeatKey. External monitors can
+// check the object's LastModified, or read it for details of the last run.
+type heartbeat struct {
+	formatHeader
+
+	Timestamp time.Time  `json:"timestamp"`
+	Host      string     `json:"host"`
+	RootDir   string     `json:"root_dir"`
+	Summary   RunSummary `json:"summary"`
+}
+
+func (s *Syncer) writeHeartbeat(summary RunSummary) error {
+	hb := &heartbeat{
+		Timestamp: time.Now().UTC(),
+		Host:      hostname(),
+		RootDir:   s.cfg.RootDir,
+		Summary:   summary,
+	}
+	return s.putDocument(heartbeatKey, hb)
+}
+
+// hostname names the machine in the documents written to the bucket.
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return host
+}
+
+// putDocument writes doc to key as JSON, stamped with its format.
+func (s *Syncer) putDocument(key string, doc versionedDocument) error {
+	doc.stampFormat()
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.cfg.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	}
+	if err := s.setPutChecksum(input, bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	if _, err := s.client.PutObject(input); err != nil {
+		return i18n.Errorf("s3.put", key, err)
+	}
+	return nil
+}
+
+// The heartbeat only moves after successful runs, so its LastModified
+// tells whether the backup is up to date. With Config.Heartbeat each
+// machine also keeps the progress of its runs in the bucket, in a status
+// object per directory below statusPrefix: written when a run starts,
+// every Config.HeartbeatInterval while it goes on and when it ends,
+// whatever its outcome. Fleets sharing a bucket can be followed from the
+// bucket alone.
+const statusPrefix = reservedPrefix + "status/"
+
+// defaultHeartbeatInterval is the Config.HeartbeatInterval of a zero
+// Config.
+const defaultHeartbeatInterval = time.Minute
+
+// Values of runStatus.LastResult, as in the control API.
+const (
+	runResultOK    = "ok"
+	runResultError = "erro"
+)
+
+// runStatus is the document written below statusPrefix.
+type runStatus struct {
+	formatHeader
+
+	Timestamp      time.Time   `json:"timestamp"`
+	Host           string      `json:"host"`
+	RootDir        string      `json:"root_dir"`
+	KeyPrefix      string      `json:"key_prefix,omitempty"`
+	Schedule       string      `json:"schedule,omitempty"`
+	Running        bool        `json:"running"`
+	LastRunStart   *time.Time  `json:"last_run_start,omitempty"`
+	LastRunEnd     *time.Time  `json:"last_run_end,omitempty"`
+	LastResult     string      `json:"last_result,omitempty"`
+	LastError      string      `json:"last_error,omitempty"`
+	LastSuccess    *time.Time  `json:"last_success,omitempty"`
+	NextRun        *time.Time  `json:"next_run,omitempty"`
+	PendingUploads int64       `json:"pending_uploads"`
+	BytesPerSecond float64     `json:"bytes_per_second"`
+	Summary        *RunSummary `json:"summary,omitempty"`
+}
+
+// statusKey returns the key of the status object of RootDir on this
+// machine.
+func (s *Syncer) statusKey() string {
+	root, err := filepath.Abs(s.cfg.RootDir)
+	if err != nil {
+		root = s.cfg.RootDir
+	}
+	sum := sha1.Sum([]byte(root))
+	return fmt.Sprintf("%s%s/%x.json", statusPrefix, hostname(), sum[:4])
+}
+
+// writeStatus writes the status object from the Status of s.
+func (s *Syncer) writeStatus() error {
+	st := s.Status()
+	doc := &runStatus{
+		Timestamp:      time.Now().UTC(),
+		Host:           hostname(),
+		RootDir:        s.cfg.RootDir,
+		KeyPrefix:      s.keyPrefix,
+		Schedule:       st.Schedule,
+		Running:        st.Running,
+		PendingUploads: st.PendingUploads,
+		BytesPerSecond: st.BytesPerSecond,
+		Summary:        st.Summary,
+	}
+	timeOrNil := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		t = t.UTC()
+		return &t
+	}
+	doc.LastRunStart = timeOrNil(st.LastRunStart)
+	doc.LastRunEnd = timeOrNil(st.LastRunEnd)
+	doc.NextRun = timeOrNil(st.NextRun)
+	doc.LastSuccess = timeOrNil(s.lastSuccess())
+	if doc.LastRunEnd != nil {
+		doc.LastResult = runResultOK
+		if st.LastError != nil {
+			doc.LastResult = runResultError
+			doc.LastError = st.LastError.Error()
+		}
+	}
+	return s.putDocument(s.statusKey(), doc)
+}
+
+// reportProgress keeps the status object of the run starting now, with
+// Config.Heartbeat, until the returned function is called at its end.
+// Failures are logged: the heartbeat never fails the run.
+func (s *Syncer) reportProgress() (stop func()) {
+	if !s.cfg.Heartbeat {
+		return func() {}
+	}
+	write := func() {
+		if err := s.writeStatus(); err != nil {
+			log.Printf(i18n.T("syncer.heartbeat_failed"), err)
+		}
+	}
+	write()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(cmp.Or(s.cfg.HeartbeatInterval, defaultHeartbeatInterval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				write()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		write()
+	}
+}
+
+// checkRemoteFormat refuses to run against a bucket whose heartbeat was
+// written by a newer, incompatible gui-sync. A missing heartbeat is fine;
+// other read failures are left for the sync itself to report.
+func (s *Syncer) checkRemoteFormat() error {
+	output, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(heartbeatKey),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || (aerr.Code() != s3.ErrCodeNoSuchKey && aerr.Code() != "NotFound") {
+			log.Printf(i18n.T("heartbeat.read_failed"), heartbeatKey, err)
+		}
+		return nil
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil
+	}
+	var formatErr *FormatError
+	if err := checkFormat(fmt.Sprintf("s3://%s/%s", s.cfg.Bucket, heartbeatKey), data); errors.As(err, &formatErr) {
+		return err
+	}
+	return nil
+}
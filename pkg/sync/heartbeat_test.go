@@ -0,0 +1,97 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: heartbeat object
+func TestWriteHeartbeat(t *testing.T) {
+	var written heartbeat
+	mockClient := new(mockS3Client)
+	s := newTestSyncer(t, mockClient)
+	s.cfg.RootDir = "/data"
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		if *input.Key != heartbeatKey || *input.ContentType != "application/json" {
+			return false
+		}
+		data, err := io.ReadAll(input.Body)
+		require.NoError(t, err)
+		return json.Unmarshal(data, &written) == nil
+	})).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	err := s.writeHeartbeat(RunSummary{Uploaded: 3, BytesUploaded: 1024})
+	assert.NoError(t, err)
+	assert.Equal(t, "/data", written.RootDir)
+	assert.Equal(t, int64(3), written.Summary.Uploaded)
+	assert.Equal(t, int64(1024), written.Summary.BytesUploaded)
+	assert.NotEmpty(t, written.Host)
+	assert.False(t, written.Timestamp.IsZero())
+	mockClient.AssertExpectations(t)
+}
+
+func TestStatusWrittenDuringRun(t *testing.T) {
+	var written []runStatus
+	var mu sync.Mutex
+	mockClient := new(mockS3Client)
+	s := newTestSyncer(t, mockClient)
+	s.cfg.RootDir = "/data"
+	s.cfg.Heartbeat = true
+	s.cfg.HeartbeatInterval = 5 * time.Millisecond
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		if *input.Key != s.statusKey() {
+			return false
+		}
+		var doc runStatus
+		data, err := io.ReadAll(input.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &doc))
+		mu.Lock()
+		written = append(written, doc)
+		mu.Unlock()
+		return true
+	})).Return(&s3.PutObjectOutput{}, nil)
+
+	s.runStarted()
+	stop := s.reportProgress()
+	s.stats.uploaded.Add(2)
+	time.Sleep(30 * time.Millisecond)
+	s.runFinished(errors.New("access denied"))
+	stop()
+
+	require.Greater(t, len(written), 2)
+	first, last := written[0], written[len(written)-1]
+	assert.True(t, first.Running)
+	assert.NotNil(t, first.LastRunStart)
+	assert.Empty(t, first.LastResult)
+	// Run stops the reporter after runFinished, so a tick may already write
+	// the finished run before the final write.
+	progress := slices.IndexFunc(written[1:len(written)-1], func(doc runStatus) bool {
+		return doc.Running && doc.Summary != nil && doc.Summary.Uploaded == 2
+	})
+	assert.GreaterOrEqual(t, progress, 0, "progress is written while the run goes on")
+	assert.False(t, last.Running)
+	assert.Equal(t, runResultError, last.LastResult)
+	assert.Equal(t, "access denied", last.LastError)
+	assert.Equal(t, "/data", last.RootDir)
+	assert.Equal(t, FormatVersion, last.FormatVersion)
+	assert.True(t, strings.HasPrefix(s.statusKey(), statusPrefix+hostname()+"/"))
+}
+
+func TestNoStatusWithoutHeartbeat(t *testing.T) {
+	mockClient := new(mockS3Client)
+	s := newTestSyncer(t, mockClient)
+	s.reportProgress()()
+	mockClient.AssertNotCalled(t, "PutObject", mock.Anything)
+}
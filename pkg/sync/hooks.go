@@ -0,0 +1,141 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// hookTimeout bounds every hook, so a hung command or endpoint cannot stall
+// the schedule.
+const hookTimeout = 10 * time.Minute
+
+const (
+	hookPre  = "pre"
+	hookPost = "post"
+)
+
+// hookEvent is what a hook learns about the run: it is exported to commands
+// as GUI_SYNC_* environment variables and POSTed as JSON to webhooks.
+type hookEvent struct {
+	Hook    string      `json:"hook"`
+	Bucket  string      `json:"bucket"`
+	RootDir string      `json:"root_dir"`
+	Result  string      `json:"result,omitempty"` // post hook only
+	Error   string      `json:"error,omitempty"`
+	Summary *RunSummary `json:"summary,omitempty"`
+}
+
+func (e hookEvent) env() []string {
+	env := []string{
+		"GUI_SYNC_HOOK=" + e.Hook,
+		"GUI_SYNC_BUCKET=" + e.Bucket,
+		"GUI_SYNC_ROOT_DIR=" + e.RootDir,
+	}
+	if e.Result != "" {
+		env = append(env, "GUI_SYNC_RESULT="+e.Result, "GUI_SYNC_ERROR="+e.Error)
+	}
+	if e.Summary != nil {
+		env = append(env,
+			"GUI_SYNC_SCANNED="+strconv.FormatInt(e.Summary.Scanned, 10),
+			"GUI_SYNC_UPLOADED="+strconv.FormatInt(e.Summary.Uploaded, 10),
+			"GUI_SYNC_SKIPPED="+strconv.FormatInt(e.Summary.Skipped, 10),
+			"GUI_SYNC_DELETED="+strconv.FormatInt(e.Summary.Deleted, 10),
+			"GUI_SYNC_FAILED="+strconv.FormatInt(e.Summary.Failed, 10),
+			"GUI_SYNC_UNREADABLE="+strconv.FormatInt(e.Summary.Unreadable, 10),
+			"GUI_SYNC_BYTES_UPLOADED="+strconv.FormatInt(e.Summary.BytesUploaded, 10),
+			"GUI_SYNC_DEDUPLICATED="+strconv.FormatInt(e.Summary.Deduplicated, 10),
+			"GUI_SYNC_BYTES_DEDUPLICATED="+strconv.FormatInt(e.Summary.BytesDeduplicated, 10),
+			"GUI_SYNC_BUSY="+strconv.FormatInt(e.Summary.Busy, 10),
+			"GUI_SYNC_DURATION_SECONDS="+strconv.FormatFloat(e.Summary.DurationSecs, 'f', 1, 64),
+		)
+	}
+	return env
+}
+
+// runHook runs hook, a shell command or an http(s) URL, for event. Empty
+// hooks do nothing.
+func (s *Syncer) runHook(ctx context.Context, hook string, event hookEvent) error {
+	if hook == "" {
+		return nil
+	}
+	event.Bucket = s.cfg.Bucket
+	event.RootDir = s.cfg.RootDir
+
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+
+	if strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://") {
+		return postWebhook(ctx, hook, event)
+	}
+
+	cmd := s.shellCommand(ctx, hook, event.env())
+	cmd.Stdout = os.Stdout
+	if err := cmd.Run(); err != nil {
+		return i18n.Errorf("hooks.command", hook, err)
+	}
+	return nil
+}
+
+// shellCommand prepares command to run with the shell of the system in
+// RootDir, with env added to the environment and its errors shown.
+func (s *Syncer) shellCommand(ctx context.Context, command string, env []string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Dir = s.cfg.RootDir
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+func postWebhook(ctx context.Context, url string, event hookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return i18n.Errorf("hooks.invalid_webhook", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return i18n.Errorf("hooks.webhook_failed", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return i18n.Errorf("hooks.webhook_status", resp.Status)
+	}
+	return nil
+}
+
+// runPostHook reports the outcome of a run to the post hook. Its failures
+// are logged and do not change the result of the run.
+func (s *Syncer) runPostHook(ctx context.Context, runErr error) {
+	summary := s.stats.summary()
+	event := hookEvent{Hook: hookPost, Result: "success", Summary: &summary}
+	if runErr != nil {
+		event.Result = "failure"
+		event.Error = runErr.Error()
+	}
+	// The post hook also runs after cancelled runs, e.g. to resume a
+	// database quiesced by the pre hook.
+	if err := s.runHook(context.WithoutCancel(ctx), s.cfg.PostHook, event); err != nil {
+		log.Printf(i18n.T("hooks.post_failed"), err)
+	}
+}
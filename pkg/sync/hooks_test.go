@@ -0,0 +1,84 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: pre/post sync hooks
+func TestCommandHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks de teste usam sh")
+	}
+
+	t.Run("failing pre hook cancels the run and reaches the post hook", func(t *testing.T) {
+		rootDir := t.TempDir()
+		output := filepath.Join(t.TempDir(), "post.txt")
+
+		mockClient := new(mockS3Client)
+		s := newTestSyncer(t, mockClient)
+		s.cfg.RootDir = rootDir
+		s.cfg.PreHook = "exit 3"
+		s.cfg.PostHook = `echo "$GUI_SYNC_HOOK $GUI_SYNC_RESULT $GUI_SYNC_BUCKET" > ` + output
+
+		err := s.Run(context.Background())
+		assert.Equal(t, "syncer.pre_hook", i18n.ID(err))
+		mockClient.AssertNotCalled(t, "GetObject", mock.Anything)
+
+		data, readErr := os.ReadFile(output)
+		require.NoError(t, readErr)
+		assert.Equal(t, "post failure test-bucket\n", string(data))
+		assert.Equal(t, err, s.Status().LastError)
+	})
+
+	t.Run("post hook failures are only logged", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.PostHook = "exit 1"
+		s.runPostHook(context.Background(), nil)
+	})
+
+	t.Run("commands run in the synced directory", func(t *testing.T) {
+		rootDir := t.TempDir()
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.RootDir = rootDir
+
+		require.NoError(t, s.runHook(context.Background(), "touch marker", hookEvent{Hook: hookPre}))
+		assert.FileExists(t, filepath.Join(rootDir, "marker"))
+	})
+}
+
+func TestWebhookHooks(t *testing.T) {
+	var received hookEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	s := newTestSyncer(t, new(mockS3Client))
+	s.stats.uploaded.Store(2)
+	s.cfg.PostHook = server.URL
+	s.runPostHook(context.Background(), nil)
+
+	assert.Equal(t, hookPost, received.Hook)
+	assert.Equal(t, "success", received.Result)
+	require.NotNil(t, received.Summary)
+	assert.Equal(t, int64(2), received.Summary.Uploaded)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	assert.Error(t, s.runHook(context.Background(), failing.URL, hookEvent{Hook: hookPre}))
+}
@@ -0,0 +1,162 @@
+package sync
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Until a run over a root goes through the whole tree without failures,
+// every file it uploads or finds in sync is appended to a progress log in
+// the state directory. A run restarted halfway through a large initial sync
+// skips the files of the log whose size and modification time are
+// unchanged, without a HeadObject each. The log is removed once a run
+// completes; from then on the scan cache (Config.ScanCache) and the change
+// journal (Config.Journal) take over.
+//
+// The log is appended one line per file rather than rewritten like the
+// other state files, which would cost the whole log for every file. It is
+// only a shortcut: a log that cannot be read is started over.
+
+// initialEntry is a line of the progress log.
+type initialEntry struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// initialProgress is the progress log of the initial sync in progress.
+type initialProgress struct {
+	done map[string]initialEntry
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func (s *Syncer) initialProgressPath() string {
+	root, err := filepath.Abs(s.cfg.RootDir)
+	if err != nil {
+		root = s.cfg.RootDir
+	}
+	sum := sha1.Sum([]byte(s.cfg.Bucket + "\x00" + root))
+	return s.statePath("initial", fmt.Sprintf("%x.log", sum))
+}
+
+// openInitialProgress returns the progress log of the run starting, or nil
+// once a run over the root succeeded.
+func (s *Syncer) openInitialProgress() *initialProgress {
+	if !s.lastSuccess().IsZero() {
+		// Runs limited by Config.FilesFrom never complete the tree; their
+		// log goes with the first success.
+		s.removeInitialProgress()
+		return nil
+	}
+	path := s.initialProgressPath()
+	p := &initialProgress{done: readInitialProgress(path)}
+	if len(p.done) > 0 {
+		fmt.Printf(i18n.T("initial.resuming"), len(p.done))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Printf(i18n.T("initial.log_failed"), err)
+		return p
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		log.Printf(i18n.T("initial.log_failed"), err)
+		return p
+	}
+	p.file = file
+	return p
+}
+
+// readInitialProgress returns the entries of the log at path by key. A line
+// cut short by a crash ends the log.
+func readInitialProgress(path string) map[string]initialEntry {
+	done := make(map[string]initialEntry)
+	file, err := os.Open(path)
+	if err != nil {
+		return done
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry initialEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			break
+		}
+		done[entry.Key] = entry
+	}
+	return done
+}
+
+// finishInitialProgress drops the progress log of the run in progress, which
+// went through the whole tree.
+func (s *Syncer) finishInitialProgress() {
+	if s.initial == nil {
+		return
+	}
+	s.initial.close()
+	s.removeInitialProgress()
+}
+
+func (s *Syncer) removeInitialProgress() {
+	if err := os.Remove(s.initialProgressPath()); err != nil && !os.IsNotExist(err) {
+		log.Printf(i18n.T("initial.log_failed"), err)
+	}
+}
+
+// completed reports whether the file of entry was synced by an earlier
+// attempt at the initial sync and has not changed since.
+func (p *initialProgress) completed(entry fileEntry) bool {
+	if p == nil {
+		return false
+	}
+	done, ok := p.done[entry.key]
+	return ok && done.Size == entry.size && done.ModTime.Equal(entry.modTime)
+}
+
+// add records that the file at key, as scanned, is in sync.
+func (p *initialProgress) add(key string, size int64, modTime time.Time) {
+	if p == nil {
+		return
+	}
+	line, err := json.Marshal(initialEntry{Key: key, Size: size, ModTime: modTime})
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file == nil {
+		return
+	}
+	if _, err := p.file.Write(append(line, '\n')); err != nil {
+		log.Printf(i18n.T("initial.log_failed"), err)
+		p.file.Close()
+		p.file = nil
+	}
+}
+
+// close closes the log at the end of the run.
+func (p *initialProgress) close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file != nil {
+		p.file.Close()
+		p.file = nil
+	}
+}
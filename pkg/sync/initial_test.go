@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: initial sync resumption
+func TestInitialSyncResumes(t *testing.T) {
+	notFound := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "a.txt", "a")
+	changed := createTempFile(t, tempDir, "b.txt", "b")
+	createTempFile(t, tempDir, "c.txt", "c")
+
+	s := newTestSyncer(t, nil)
+	s.cfg.RootDir = tempDir
+
+	// The interrupted run got through a.txt and b.txt.
+	progress := s.openInitialProgress()
+	require.NotNil(t, progress)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		info, err := os.Stat(filepath.Join(tempDir, name))
+		require.NoError(t, err)
+		progress.add(name, info.Size(), info.ModTime())
+	}
+	progress.close()
+	require.NoError(t, os.WriteFile(changed, []byte("b2"), 0644))
+
+	client := new(mockS3Client)
+	client.On("HeadObject", mock.MatchedBy(func(input *s3.HeadObjectInput) bool {
+		return *input.Key == "b.txt" || *input.Key == "c.txt"
+	})).Return(nil, notFound).Twice()
+	client.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Twice()
+	client.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{}, nil)
+	s.client = client
+
+	result, err := s.syncDirectoryWithS3(context.Background(), tempDir)
+	require.NoError(t, err)
+	require.NoError(t, result.Err())
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "HeadObject", mock.MatchedBy(func(input *s3.HeadObjectInput) bool {
+		return *input.Key == "a.txt"
+	}))
+	assert.Equal(t, int64(1), s.stats.summary().Skipped)
+	assert.NoFileExists(t, s.initialProgressPath(), "the log goes once the tree is complete")
+}
+
+func TestReadInitialProgressTornLine(t *testing.T) {
+	s := newTestSyncer(t, nil)
+	progress := s.openInitialProgress()
+	progress.add("a.txt", 1, time.Unix(1700000000, 0))
+	progress.close()
+
+	file, err := os.OpenFile(s.initialProgressPath(), os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"key":"b.t`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	done := readInitialProgress(s.initialProgressPath())
+	assert.Len(t, done, 1)
+	assert.True(t, (&initialProgress{done: done}).completed(fileEntry{key: "a.txt", size: 1, modTime: time.Unix(1700000000, 0)}))
+	assert.False(t, (&initialProgress{done: done}).completed(fileEntry{key: "a.txt", size: 2, modTime: time.Unix(1700000000, 0)}))
+}
+
+func TestInitialProgressAfterSuccess(t *testing.T) {
+	s := newTestSyncer(t, nil)
+	s.openInitialProgress().close()
+	require.FileExists(t, s.initialProgressPath())
+
+	s.recordSuccess(time.Now())
+	assert.Nil(t, s.openInitialProgress())
+	assert.NoFileExists(t, s.initialProgressPath())
+
+	var none *initialProgress
+	none.add("a.txt", 1, time.Now())
+	assert.False(t, none.completed(fileEntry{key: "a.txt"}))
+	none.close()
+}
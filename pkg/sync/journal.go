@@ -0,0 +1,199 @@
+package sync
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// With Config.Journal, runs read what changed in the tree since the last
+// one from the change journal of the operating system instead of walking
+// it: the USN journal of NTFS on Windows, and on Linux the inotify events
+// received while the scheduler waits between runs. Only the paths the
+// journal names are compared with the bucket, and only the objects below
+// the removed ones and the changed directories are considered for
+// deletion. Whenever the journal cannot tell (the first run, a journal
+// reset or events lost), the whole tree is walked.
+
+// changeJournal follows the changes of a tree between runs.
+type changeJournal interface {
+	// changes returns the paths below the root, relative to it and with
+	// forward slashes, created, modified, removed or renamed since the last
+	// commit. ok is false when the journal cannot tell and the tree must be
+	// walked.
+	changes() (paths []string, ok bool)
+	// commit records the changes returned by the last call as synced.
+	commit()
+}
+
+// journalStatePath is where the journal of root keeps its position
+// between runs, for journals that persist one.
+func (s *Syncer) journalStatePath(root string) string {
+	sum := sha1.Sum([]byte(s.prefixScoped(s.cfg.Bucket + "\x00" + root)))
+	return s.statePath("journal", fmt.Sprintf("%x.json", sum))
+}
+
+// journalChanges opens the journal of Config.RootDir on the first run and
+// returns the paths changed since the last successful run. incremental is
+// false when the whole tree must be walked instead.
+func (s *Syncer) journalChanges() (changed []string, incremental bool) {
+	if !s.cfg.Journal || s.cfg.FilesFrom != "" {
+		return nil, false
+	}
+	if !s.journalOpened {
+		s.journalOpened = true
+		journal, err := newChangeJournal(s.cfg.RootDir, s.journalStatePath(s.cfg.RootDir))
+		if err != nil {
+			log.Printf(i18n.T("journal.unavailable"), err)
+			return nil, false
+		}
+		s.journal = journal
+	}
+	if s.journal == nil {
+		return nil, false
+	}
+
+	changed, ok := s.journal.changes()
+	if !ok {
+		fmt.Println(i18n.T("journal.full_walk"))
+		return nil, false
+	}
+	// The objects below another key prefix were not synced by the runs the
+	// journal followed.
+	if s.keyPrefix != s.journalPrefix {
+		fmt.Println(i18n.T("journal.full_walk"))
+		return nil, false
+	}
+	// The rules deciding which files take part apply to the whole tree.
+	for _, relPath := range changed {
+		if name := path.Base(relPath); name == ".syncignore" || name == ".gitignore" {
+			fmt.Println(i18n.T("journal.ignore_changed"))
+			return nil, false
+		}
+	}
+	fmt.Printf(i18n.T("journal.incremental"), len(changed))
+	return changed, true
+}
+
+// journalPrefixes returns the keys of the changed paths that are no longer
+// files: removed ones, whose objects all go, and directories, whose
+// objects go unless the walk of the directory finds their files. Keys
+// below another one of the list are left out.
+func (s *Syncer) journalPrefixes(root string, changed []string) []string {
+	prefixes := []string{}
+	for _, relPath := range changed {
+		info, err := os.Lstat(filepath.Join(root, filepath.FromSlash(relPath)))
+		if err == nil && !info.IsDir() {
+			continue
+		}
+		if err != nil && !os.IsNotExist(err) {
+			continue
+		}
+		prefixes = append(prefixes, s.keyOf(toSlashKey(relPath)))
+	}
+
+	sort.Strings(prefixes)
+	kept := prefixes[:0]
+	for _, prefix := range prefixes {
+		if n := len(kept); n > 0 && (prefix == kept[n-1] || strings.HasPrefix(prefix, kept[n-1]+"/")) {
+			continue
+		}
+		kept = append(kept, prefix)
+	}
+	return kept
+}
+
+// walkChanged is walkTree over the changed paths below root: files are
+// visited, directories walked, and removed paths skipped. A changed sidecar
+// stands for its companion.
+func walkChanged(root string, changed []string, fn func(path, relPath string, info os.FileInfo) error, onError func(relPath string, err error), mounted func(relPath string)) error {
+	var rootDevice uint64
+	if mounted != nil {
+		info, err := os.Lstat(root)
+		if err != nil {
+			return err
+		}
+		rootDevice, _ = fileDevice(info)
+	}
+
+	visited := make(map[string]bool)
+	for _, relPath := range changed {
+		localPath := filepath.Join(root, filepath.FromSlash(relPath))
+		if strings.HasSuffix(relPath, sidecarSuffix) && isSidecar(localPath) {
+			relPath = strings.TrimSuffix(relPath, sidecarSuffix)
+			localPath = strings.TrimSuffix(localPath, sidecarSuffix)
+		}
+		if visited[relPath] {
+			continue
+		}
+		visited[relPath] = true
+
+		info, err := os.Lstat(localPath)
+		if mounted != nil && otherDevice(root, rootDevice, relPath, info) {
+			log.Printf(i18n.T("scanner.other_filesystem"), toSlashKey(relPath))
+			mounted(toSlashKey(relPath))
+			continue
+		}
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			if onError == nil {
+				return err
+			}
+			onError(toSlashKey(relPath), err)
+			continue
+		}
+		if !info.IsDir() {
+			if isSidecar(localPath) {
+				continue
+			}
+			if err := fn(localPath, toSlashKey(relPath), info); err != nil {
+				return err
+			}
+			continue
+		}
+
+		below := func(rel string) string { return toSlashKey(relPath) + "/" + rel }
+		var dirError func(string, error)
+		if onError != nil {
+			dirError = func(rel string, err error) { onError(below(rel), err) }
+		}
+		var dirMounted func(string)
+		if mounted != nil {
+			dirMounted = func(rel string) { mounted(below(rel)) }
+		}
+		err = walkTree(localPath, "", func(path, rel string, info os.FileInfo) error {
+			return fn(path, below(rel), info)
+		}, dirError, dirMounted)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// otherDevice reports whether the path at relPath below root, of info when
+// it exists, lies on another file system than the root on rootDevice:
+// itself when it is a directory, its nearest existing directory otherwise.
+func otherDevice(root string, rootDevice uint64, relPath string, info os.FileInfo) bool {
+	dir := relPath
+	if info == nil || !info.IsDir() {
+		dir = path.Dir(relPath)
+	}
+	for dir != "." && dir != "/" {
+		if info, err := os.Lstat(filepath.Join(root, filepath.FromSlash(dir))); err == nil {
+			device, ok := fileDevice(info)
+			return ok && device != rootDevice
+		}
+		dir = path.Dir(dir)
+	}
+	return false
+}
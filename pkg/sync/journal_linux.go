@@ -0,0 +1,207 @@
+package sync
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// inotifyMask is what the journal watches in every directory of the tree.
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+	syscall.IN_ATTRIB | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_MOVE_SELF |
+	syscall.IN_DONT_FOLLOW | syscall.IN_ONLYDIR
+
+// inotifyJournal collects the inotify events of every directory of the
+// tree while the process runs. Linux keeps no journal across restarts, so
+// the first run of a process walks the tree.
+type inotifyJournal struct {
+	root string
+	fd   int
+	file *os.File
+
+	mu sync.Mutex
+	// watches maps the watch descriptors to their directories, relative to
+	// root ("" for root).
+	watches map[int]string
+	// pending holds the paths changed since the last commit, with the
+	// sequence number of their last event.
+	pending map[string]uint64
+	seq     uint64
+	// lost counts the events the kernel dropped or the journal could not
+	// follow; failed is set once it cannot follow the tree at all.
+	lost   uint64
+	failed bool
+	// trusted is set by the first commit, after a walk of the whole tree.
+	trusted bool
+	// seenSeq and seenLost are what the last changes call returned;
+	// committedLost what the last commit accepted.
+	seenSeq, seenLost uint64
+	committedLost     uint64
+}
+
+// newChangeJournal starts watching every directory below root.
+func newChangeJournal(root, statePath string) (changeJournal, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, i18n.Errorf("journal.init", err)
+	}
+	j := &inotifyJournal{
+		root:    root,
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		watches: make(map[int]string),
+		pending: make(map[string]uint64),
+	}
+	if err := j.watchTree(""); err != nil {
+		j.file.Close()
+		return nil, err
+	}
+	go j.read()
+	return j, nil
+}
+
+func (j *inotifyJournal) changes() ([]string, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.seenSeq, j.seenLost = j.seq, j.lost
+	if !j.trusted || j.failed || j.lost != j.committedLost {
+		return nil, false
+	}
+	paths := make([]string, 0, len(j.pending))
+	for relPath := range j.pending {
+		paths = append(paths, relPath)
+	}
+	sort.Strings(paths)
+	return paths, true
+}
+
+func (j *inotifyJournal) commit() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.trusted = true
+	j.committedLost = j.seenLost
+	for relPath, seq := range j.pending {
+		if seq <= j.seenSeq {
+			delete(j.pending, relPath)
+		}
+	}
+}
+
+// watchTree watches the directory at rel and every directory below it.
+// Directories that cannot be read are left out: the walks of the scanner
+// report them.
+func (j *inotifyJournal) watchTree(rel string) error {
+	return filepath.WalkDir(filepath.Join(j.root, filepath.FromSlash(rel)), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		sub, err := filepath.Rel(j.root, p)
+		if err != nil {
+			return err
+		}
+		if sub == "." {
+			sub = ""
+		}
+		wd, err := syscall.InotifyAddWatch(j.fd, p, inotifyMask)
+		if err == syscall.ENOSPC {
+			return i18n.Errorf("journal.watch_limit", err)
+		}
+		if err != nil {
+			return nil
+		}
+		j.watches[wd] = filepath.ToSlash(sub)
+		return nil
+	})
+}
+
+// unwatch stops watching the directory at rel, moved out of its place,
+// and the directories below it.
+func (j *inotifyJournal) unwatch(rel string) {
+	for wd, dir := range j.watches {
+		if dir == rel || strings.HasPrefix(dir, rel+"/") {
+			syscall.InotifyRmWatch(j.fd, uint32(wd))
+			delete(j.watches, wd)
+		}
+	}
+}
+
+// read records the events of the watches until the descriptor fails.
+func (j *inotifyJournal) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := j.file.Read(buf)
+		if err != nil {
+			j.mu.Lock()
+			j.failed = true
+			j.mu.Unlock()
+			return
+		}
+
+		j.mu.Lock()
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			start := off + syscall.SizeofInotifyEvent
+			off = start + int(event.Len)
+			name := strings.TrimRight(string(buf[start:off]), "\x00")
+			j.handle(int(event.Wd), event.Mask, name)
+		}
+		j.mu.Unlock()
+	}
+}
+
+// handle records one event. It is called with mu held.
+func (j *inotifyJournal) handle(wd int, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		j.lost++
+		return
+	}
+	dir, ok := j.watches[wd]
+	if !ok {
+		return
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(j.watches, wd)
+		if dir == "" {
+			j.failed = true
+		}
+		return
+	}
+	// Other directories moving are seen from their parent.
+	if mask&syscall.IN_MOVE_SELF != 0 {
+		if dir == "" {
+			j.failed = true
+		}
+		return
+	}
+	if name == "" {
+		return
+	}
+
+	relPath := path.Join(dir, name)
+	if mask&syscall.IN_ISDIR != 0 {
+		switch {
+		case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+			// Files created before the watch are found by the walk of the
+			// directory.
+			if err := j.watchTree(relPath); err != nil {
+				j.lost++
+			}
+		case mask&syscall.IN_MOVED_FROM != 0:
+			j.unwatch(relPath)
+		case mask&syscall.IN_DELETE == 0:
+			return
+		}
+	}
+	j.seq++
+	j.pending[relPath] = j.seq
+}
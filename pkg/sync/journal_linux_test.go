@@ -0,0 +1,45 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: inotify change journal
+func TestInotifyJournal(t *testing.T) {
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "docs/a.txt", "a")
+
+	journal, err := newChangeJournal(tempDir, "")
+	require.NoError(t, err)
+	_, ok := journal.changes()
+	assert.False(t, ok, "the first run walks the tree")
+	journal.commit()
+
+	paths, ok := journal.changes()
+	require.True(t, ok)
+	assert.Empty(t, paths)
+
+	createTempFile(t, tempDir, "docs/b.txt", "b")
+	require.NoError(t, os.Remove(filepath.Join(tempDir, "docs", "a.txt")))
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "novo"), 0755))
+	assert.Eventually(t, func() bool {
+		paths, ok = journal.changes()
+		return ok && len(paths) == 3
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, []string{"docs/a.txt", "docs/b.txt", "novo"}, paths)
+
+	// Files in a new directory are seen once it is watched.
+	journal.commit()
+	createTempFile(t, tempDir, "novo/c.txt", "c")
+	assert.Eventually(t, func() bool {
+		paths, ok = journal.changes()
+		return ok && len(paths) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, []string{"novo/c.txt"}, paths)
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+
+package sync
+
+import "github.com/gui-sync/pkg/i18n"
+
+// newChangeJournal reports that this system has no change journal gui-sync
+// reads.
+func newChangeJournal(root, statePath string) (changeJournal, error) {
+	return nil, i18n.Errorf("journal.unsupported")
+}
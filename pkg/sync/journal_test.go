@@ -0,0 +1,129 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeJournal returns paths, or asks for a walk when ok is false.
+type fakeJournal struct {
+	paths   []string
+	ok      bool
+	commits int
+}
+
+func (j *fakeJournal) changes() ([]string, bool) { return j.paths, j.ok }
+func (j *fakeJournal) commit()                   { j.commits++ }
+
+// Test Suite: change journal
+func TestWalkChanged(t *testing.T) {
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "a.txt", "a")
+	createTempFile(t, tempDir, "b.txt", "b")
+	createTempFile(t, tempDir, "docs/c.txt", "c")
+	createTempFile(t, tempDir, "docs/fotos/d.jpg", "d")
+
+	var files []string
+	err := walkChanged(tempDir, []string{"a.txt", "docs", "gone.txt", "a.txt"}, func(path, relPath string, info os.FileInfo) error {
+		files = append(files, relPath)
+		return nil
+	}, nil, nil)
+	require.NoError(t, err)
+	sort.Strings(files)
+	assert.Equal(t, []string{"a.txt", "docs/c.txt", "docs/fotos/d.jpg"}, files, "removed paths are skipped and directories walked")
+}
+
+func TestWalkChangedSidecar(t *testing.T) {
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "a.txt", "a")
+	createTempFile(t, tempDir, "a.txt"+sidecarSuffix, `{"storage_class": "STANDARD_IA"}`)
+
+	var files []string
+	err := walkChanged(tempDir, []string{"a.txt" + sidecarSuffix}, func(path, relPath string, info os.FileInfo) error {
+		files = append(files, relPath)
+		return nil
+	}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt"}, files, "a changed sidecar sends its companion again")
+}
+
+func TestJournalPrefixes(t *testing.T) {
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "a.txt", "a")
+	createTempFile(t, tempDir, "docs/c.txt", "c")
+
+	s := newTestSyncer(t, new(mockS3Client))
+	prefixes := s.journalPrefixes(tempDir, []string{"a.txt", "docs", "docs/c.txt", "old", "old/x.txt"})
+	assert.Equal(t, []string{"docs", "old"}, prefixes)
+	assert.NotNil(t, s.journalPrefixes(tempDir, nil), "no prefix means no deletion, not the whole bucket")
+}
+
+func TestJournalChanges(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	journal := &fakeJournal{paths: []string{"a.txt"}, ok: true}
+	s.journal, s.journalOpened = journal, true
+
+	_, incremental := s.journalChanges()
+	assert.False(t, incremental, "without Config.Journal")
+
+	s.cfg.Journal = true
+	changed, incremental := s.journalChanges()
+	assert.True(t, incremental)
+	assert.Equal(t, []string{"a.txt"}, changed)
+
+	journal.paths = []string{"docs/.gitignore"}
+	_, incremental = s.journalChanges()
+	assert.False(t, incremental, "ignore rules apply to the whole tree")
+
+	journal.ok = false
+	_, incremental = s.journalChanges()
+	assert.False(t, incremental)
+}
+
+func TestSyncVisitsJournalChanges(t *testing.T) {
+	notFound := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "a.txt", "novo")
+	createTempFile(t, tempDir, "b.txt", "igual")
+
+	client := new(mockS3Client)
+	client.On("HeadObject", mock.MatchedBy(func(input *s3.HeadObjectInput) bool {
+		return *input.Key == "a.txt"
+	})).Return(nil, notFound)
+	client.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+	client.On("ListObjectsV2Pages", mock.MatchedBy(func(input *s3.ListObjectsV2Input) bool {
+		return aws.StringValue(input.Prefix) == "old"
+	}), mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []*s3.Object{
+		{Key: aws.String("old/x.txt"), Size: aws.Int64(1)},
+		{Key: aws.String("older.txt"), Size: aws.Int64(1)},
+	}}, nil).Once()
+	client.On("DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+		return *input.Key == "old/x.txt"
+	})).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, client)
+	s.cfg.Journal = true
+	journal := &fakeJournal{paths: []string{"a.txt", "old"}, ok: true}
+	s.journal, s.journalOpened = journal, true
+
+	result, err := s.syncDirectoryWithS3(context.Background(), tempDir)
+	require.NoError(t, err)
+	assert.Empty(t, result.Failed())
+	assert.Equal(t, 1, journal.commits)
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "HeadObject", mock.MatchedBy(func(input *s3.HeadObjectInput) bool {
+		return *input.Key == "b.txt"
+	}))
+	client.AssertNotCalled(t, "DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+		return *input.Key == "older.txt"
+	}))
+}
@@ -0,0 +1,265 @@
+package sync
+
+import (
+	"encoding/binary"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+var (
+	procOpenFileByID              = syscall.NewLazyDLL("kernel32.dll").NewProc("OpenFileById")
+	procGetFinalPathNameByHandleW = syscall.NewLazyDLL("kernel32.dll").NewProc("GetFinalPathNameByHandleW")
+)
+
+const (
+	fsctlQueryUSNJournal   = 0x000900f4
+	fsctlReadUSNJournal    = 0x000900bb
+	fileFlagBackupSemantic = 0x02000000
+
+	usnReasonFileCreate    = 0x00000100
+	usnReasonFileDelete    = 0x00000200
+	usnReasonRenameOldName = 0x00001000
+	usnReasonRenameNewName = 0x00002000
+	fileAttributeDirectory = 0x10
+	errorNotSupported      = syscall.Errno(50)
+)
+
+// usnJournalData is USN_JOURNAL_DATA_V0.
+type usnJournalData struct {
+	UsnJournalID    uint64
+	FirstUsn        int64
+	NextUsn         int64
+	LowestValidUsn  int64
+	MaxUsn          int64
+	MaximumSize     uint64
+	AllocationDelta uint64
+}
+
+// readUSNJournalData is READ_USN_JOURNAL_DATA_V0.
+type readUSNJournalData struct {
+	StartUsn          int64
+	ReasonMask        uint32
+	ReturnOnlyOnClose uint32
+	Timeout           uint64
+	BytesToWaitFor    uint64
+	UsnJournalID      uint64
+}
+
+// fileIDDescriptor is FILE_ID_DESCRIPTOR for a FileIdType id.
+type fileIDDescriptor struct {
+	Size   uint32
+	Type   uint32
+	FileID int64
+	_      [8]byte
+}
+
+// usnState is the position of the journal of a root, saved by the commit
+// of every run.
+type usnState struct {
+	formatHeader
+
+	JournalID uint64 `json:"journal_id"`
+	NextUSN   int64  `json:"next_usn"`
+}
+
+// usnJournal reads the USN journal of the NTFS volume holding the tree.
+// Its position is saved between runs, so that changes made while gui-sync
+// was not running are found too, as long as the journal still holds them.
+type usnJournal struct {
+	// root is the final path of the tree, without the \\?\ prefix.
+	root      string
+	statePath string
+	volume    syscall.Handle
+	// hint is a handle on the root, for OpenFileById.
+	hint syscall.Handle
+	// next is the state the last changes call read up to.
+	next usnState
+}
+
+// newChangeJournal opens the USN journal of the volume of root. Reading it
+// needs administrator rights.
+func newChangeJournal(root, statePath string) (changeJournal, error) {
+	name, err := syscall.UTF16PtrFromString(root)
+	if err != nil {
+		return nil, i18n.Errorf("journal.volume", root, err)
+	}
+	hint, err := syscall.CreateFile(name, 0, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil, syscall.OPEN_EXISTING, fileFlagBackupSemantic, 0)
+	if err != nil {
+		return nil, i18n.Errorf("journal.volume", root, err)
+	}
+	final, err := finalPath(hint)
+	if err != nil {
+		syscall.CloseHandle(hint)
+		return nil, i18n.Errorf("journal.volume", root, err)
+	}
+	volumeName := filepath.VolumeName(final)
+	if len(volumeName) != 2 {
+		syscall.CloseHandle(hint)
+		return nil, i18n.Errorf("journal.volume", root, errorNotSupported)
+	}
+	volumePath, _ := syscall.UTF16PtrFromString(`\\.\` + volumeName)
+	volume, err := syscall.CreateFile(volumePath, syscall.GENERIC_READ, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE, nil, syscall.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		syscall.CloseHandle(hint)
+		return nil, i18n.Errorf("journal.volume", root, err)
+	}
+
+	j := &usnJournal{root: final, statePath: statePath, volume: volume, hint: hint}
+	if _, err := j.query(); err != nil {
+		syscall.CloseHandle(volume)
+		syscall.CloseHandle(hint)
+		return nil, i18n.Errorf("journal.query", root, err)
+	}
+	return j, nil
+}
+
+func (j *usnJournal) query() (usnJournalData, error) {
+	var data usnJournalData
+	var n uint32
+	err := syscall.DeviceIoControl(j.volume, fsctlQueryUSNJournal, nil, 0, (*byte)(unsafe.Pointer(&data)), uint32(unsafe.Sizeof(data)), &n, nil)
+	return data, err
+}
+
+func (j *usnJournal) changes() ([]string, bool) {
+	data, err := j.query()
+	if err != nil {
+		return nil, false
+	}
+	j.next = usnState{JournalID: data.UsnJournalID, NextUSN: data.NextUsn}
+
+	// The journal was recreated, or dropped records not read yet.
+	var state usnState
+	if err := readStateFile(j.statePath, &state); err != nil || state.JournalID != data.UsnJournalID || state.NextUSN < data.LowestValidUsn {
+		return nil, false
+	}
+
+	changed := make(map[string]bool)
+	next, err := j.read(state.NextUSN, data, changed)
+	if err != nil {
+		return nil, false
+	}
+	j.next.NextUSN = next
+
+	paths := make([]string, 0, len(changed))
+	for relPath := range changed {
+		paths = append(paths, relPath)
+	}
+	sort.Strings(paths)
+	return paths, true
+}
+
+func (j *usnJournal) commit() {
+	if j.next.JournalID == 0 {
+		return
+	}
+	if err := writeStateFile(j.statePath, &j.next); err != nil {
+		log.Printf(i18n.T("journal.save_failed"), err)
+	}
+}
+
+// read adds to changed the paths below the root named by the records from
+// start to the end of the journal, and returns where it stopped.
+func (j *usnJournal) read(start int64, data usnJournalData, changed map[string]bool) (int64, error) {
+	in := readUSNJournalData{StartUsn: start, ReasonMask: 0xffffffff, UsnJournalID: data.UsnJournalID}
+	buf := make([]byte, 64*1024)
+	parents := make(map[uint64]string)
+	for in.StartUsn < data.NextUsn {
+		var n uint32
+		err := syscall.DeviceIoControl(j.volume, fsctlReadUSNJournal, (*byte)(unsafe.Pointer(&in)), uint32(unsafe.Sizeof(in)), &buf[0], uint32(len(buf)), &n, nil)
+		if err != nil {
+			return 0, err
+		}
+		if n < 8 {
+			break
+		}
+		next := int64(binary.LittleEndian.Uint64(buf))
+		for off := 8; off+60 <= int(n); {
+			length := int(binary.LittleEndian.Uint32(buf[off:]))
+			if length == 0 || off+length > int(n) {
+				break
+			}
+			if relPath, ok := j.record(buf[off:off+length], parents); ok {
+				changed[relPath] = true
+			}
+			off += length
+		}
+		if next == in.StartUsn {
+			break
+		}
+		in.StartUsn = next
+	}
+	return in.StartUsn, nil
+}
+
+// record returns the path below the root named by the USN_RECORD_V2 rec.
+// Directories only count when created, removed or renamed; records whose
+// directory is gone are skipped, since the removal of the directory is
+// recorded too.
+func (j *usnJournal) record(rec []byte, parents map[uint64]string) (string, bool) {
+	if binary.LittleEndian.Uint16(rec[4:]) != 2 {
+		return "", false
+	}
+	parentRef := binary.LittleEndian.Uint64(rec[16:])
+	reason := binary.LittleEndian.Uint32(rec[40:])
+	attributes := binary.LittleEndian.Uint32(rec[52:])
+	nameLength := int(binary.LittleEndian.Uint16(rec[56:]))
+	nameOffset := int(binary.LittleEndian.Uint16(rec[58:]))
+	if attributes&fileAttributeDirectory != 0 && reason&(usnReasonFileCreate|usnReasonFileDelete|usnReasonRenameOldName|usnReasonRenameNewName) == 0 {
+		return "", false
+	}
+	if nameOffset+nameLength > len(rec) {
+		return "", false
+	}
+	units := make([]uint16, nameLength/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(rec[nameOffset+2*i:])
+	}
+	name := string(utf16.Decode(units))
+
+	parent, ok := parents[parentRef]
+	if !ok {
+		parent, _ = j.resolve(parentRef)
+		parents[parentRef] = parent
+	}
+	if parent == "" {
+		return "", false
+	}
+	var dir string
+	switch {
+	case strings.EqualFold(parent, j.root):
+	case len(parent) > len(j.root) && strings.EqualFold(parent[:len(j.root)], j.root) && parent[len(j.root)] == '\\':
+		dir = parent[len(j.root)+1:] + `\`
+	default:
+		return "", false
+	}
+	return strings.ReplaceAll(dir+name, `\`, "/"), true
+}
+
+// resolve returns the current path of the directory with the file
+// reference ref.
+func (j *usnJournal) resolve(ref uint64) (string, error) {
+	id := fileIDDescriptor{Size: uint32(unsafe.Sizeof(fileIDDescriptor{})), FileID: int64(ref)}
+	h, _, err := procOpenFileByID.Call(uintptr(j.hint), uintptr(unsafe.Pointer(&id)), 0, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, 0, fileFlagBackupSemantic)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		return "", err
+	}
+	defer syscall.CloseHandle(syscall.Handle(h))
+	return finalPath(syscall.Handle(h))
+}
+
+// finalPath returns the path of the file of h, without the \\?\ prefix.
+func finalPath(h syscall.Handle) (string, error) {
+	buf := make([]uint16, syscall.MAX_LONG_PATH)
+	n, _, err := procGetFinalPathNameByHandleW.Call(uintptr(h), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0)
+	if n == 0 || int(n) > len(buf) {
+		return "", err
+	}
+	return strings.TrimPrefix(syscall.UTF16ToString(buf[:n]), `\\?\`), nil
+}
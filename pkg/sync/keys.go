@@ -0,0 +1,135 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// maxKeyLength is the longest key S3 accepts, in bytes.
+const maxKeyLength = 1024
+
+// File names may hold bytes S3 refuses in keys (invalid UTF-8), or accepts
+// but cannot list as XML (control characters). Such files are reported one
+// by one instead of failing inside PutObject; with Config.SanitizeKeys their
+// keys are percent-encoded instead, and decoded back on restore.
+
+// keyError returns why key cannot be the key of an object: S3 refuses it,
+// or it holds characters or empty, . or .. segments that break listings
+// and restores.
+func keyError(key string) error {
+	if !utf8.ValidString(key) {
+		return i18n.Errorf("key.invalid_utf8")
+	}
+	if len(key) > maxKeyLength {
+		return i18n.Errorf("key.too_long", len(key), maxKeyLength)
+	}
+	if i := strings.IndexFunc(key, isControl); i >= 0 {
+		r, _ := utf8.DecodeRuneInString(key[i:])
+		return i18n.Errorf("key.control_char", fmt.Sprintf("U+%04X", r))
+	}
+	for _, name := range strings.Split(key, "/") {
+		if name == "" || name == "." || name == ".." {
+			return i18n.Errorf("key.dot_segment")
+		}
+	}
+	return nil
+}
+
+func isControl(r rune) bool { return r < 0x20 || r == 0x7F }
+
+// encodeKey percent-encodes the bytes of key that are control characters or
+// not valid UTF-8, and every %, so that decodeKey restores it.
+func encodeKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); {
+		r, size := utf8.DecodeRuneInString(key[i:])
+		if r == '%' || isControl(r) || r == utf8.RuneError && size == 1 {
+			fmt.Fprintf(&b, "%%%02X", key[i])
+		} else {
+			b.WriteString(key[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// decodeKey reverses encodeKey.
+func decodeKey(key string) string {
+	if !strings.Contains(key, "%") {
+		return key
+	}
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		if key[i] == '%' && i+2 < len(key) && isHex(key[i+1]) && isHex(key[i+2]) {
+			b.WriteByte(unhex(key[i+1])<<4 | unhex(key[i+2]))
+			i += 2
+			continue
+		}
+		b.WriteByte(key[i])
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
+
+// keyOf returns the key of the local file at relPath.
+func (s *Syncer) keyOf(relPath string) string {
+	if s.cfg.SanitizeKeys {
+		return s.prefixed(encodeKey(relPath))
+	}
+	return s.prefixed(relPath)
+}
+
+// localName returns the path relative to the restore target of the object
+// at key.
+func (s *Syncer) localName(key string) string {
+	if s.cfg.SanitizeKeys {
+		return decodeKey(s.unprefixed(key))
+	}
+	return s.unprefixed(key)
+}
+
+// localKey returns the key of the file at path below root, whose relative
+// path is relPath, or why it cannot be synced: its key is not valid, or its
+// name is another normalization of the name of another file, which has the
+// key.
+func (s *Syncer) localKey(root, path, relPath string) (string, error) {
+	if !isASCII(relPath) {
+		if other := filepath.Join(root, filepath.FromSlash(relPath)); other != path {
+			info, err := os.Lstat(path)
+			otherInfo, otherErr := os.Lstat(other)
+			if err == nil && otherErr == nil && !os.SameFile(info, otherInfo) {
+				return "", i18n.Errorf("key.collision", relPath)
+			}
+		}
+	}
+	// Windows drops trailing spaces and dots from names, so files ending in
+	// them, created through \\?\ paths, could not be restored by name.
+	if runtime.GOOS == "windows" {
+		for _, name := range strings.Split(relPath, "/") {
+			if strings.HasSuffix(name, " ") || strings.HasSuffix(name, ".") {
+				return "", i18n.Errorf("key.trailing_space", name)
+			}
+		}
+	}
+	key := s.keyOf(relPath)
+	return key, keyError(key)
+}
@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: key sanitization
+func TestKeyError(t *testing.T) {
+	for _, key := range []string{"a.txt", "fotos/relatório 2024.pdf", "100%.txt", "a/.oculto", "..txt"} {
+		assert.NoError(t, keyError(key), key)
+	}
+	for key, id := range map[string]string{
+		"a\xff.txt":               "key.invalid_utf8",
+		strings.Repeat("a", 1025): "key.too_long",
+		"linha\nquebrada.txt":     "key.control_char",
+		"sino\x07.txt":            "key.control_char",
+		"./a.txt":                 "key.dot_segment",
+		"/a.txt":                  "key.dot_segment",
+		"a//b.txt":                "key.dot_segment",
+		"a/../b.txt":              "key.dot_segment",
+		"a/":                      "key.dot_segment",
+		"subdir/\x7fdelete.txt":   "key.control_char",
+		strings.Repeat("é", 600):  "key.too_long",
+	} {
+		assert.Equal(t, id, i18n.ID(keyError(key)), "%q", key)
+	}
+}
+
+func TestEncodeKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"a.txt":               "a.txt",
+		"relatório.txt":       "relatório.txt",
+		"100%.txt":            "100%25.txt",
+		"linha\nquebrada.txt": "linha%0Aquebrada.txt",
+		"latin1-\xe9.txt":     "latin1-%E9.txt",
+		"%0A":                 "%250A",
+	} {
+		encoded := encodeKey(key)
+		assert.Equal(t, want, encoded, "%q", key)
+		assert.NoError(t, keyError(encoded), "%q", key)
+		assert.Equal(t, key, decodeKey(encoded), "%q", key)
+	}
+	assert.Equal(t, "sem%código", decodeKey("sem%código"), "stray percent signs are kept")
+}
+
+func TestScannerKeys(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("the file system does not keep these names")
+	}
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "ok.txt", "a")
+	createTempFile(t, tempDir, "linha\nquebrada.txt", "b")
+	createTempFile(t, tempDir, "latin1-\xe9.txt", "c")
+	createTempFile(t, tempDir, "ignorado\n.log", "d")
+	createTempFile(t, tempDir, "ação.txt", "e")
+	createTempFile(t, tempDir, "ac\u0327a\u0303o.txt", "f")
+
+	scan := func(sanitize bool) (keys []string, invalid map[string]string) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.SanitizeKeys = sanitize
+		invalid = make(map[string]string)
+		scan := &scanner{
+			root:    tempDir,
+			ignore:  func(relPath string) bool { return strings.HasSuffix(relPath, ".log") },
+			key:     func(path, relPath string) (string, error) { return s.localKey(tempDir, path, relPath) },
+			invalid: func(relPath string, err error) { invalid[relPath] = i18n.ID(err) },
+		}
+		out := make(chan fileEntry, 10)
+		require.NoError(t, scan.run(context.Background(), out))
+		for entry := range out {
+			keys = append(keys, entry.key)
+		}
+		sort.Strings(keys)
+		return keys, invalid
+	}
+
+	keys, invalid := scan(false)
+	assert.Equal(t, []string{"ação.txt", "ok.txt"}, keys)
+	assert.Equal(t, map[string]string{
+		"linha\nquebrada.txt": "key.control_char",
+		"latin1-\xe9.txt":     "key.invalid_utf8",
+		"ação.txt":            "key.collision",
+	}, invalid, "the decomposed name collides with the composed one")
+
+	keys, invalid = scan(true)
+	assert.Equal(t, []string{"ação.txt", "latin1-%E9.txt", "linha%0Aquebrada.txt", "ok.txt"}, keys)
+	assert.Equal(t, map[string]string{"ação.txt": "key.collision"}, invalid)
+}
+
+func TestPutInvalidKey(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	_, err := s.Put("./backup.sql", strings.NewReader("dados"), UploadOptions{})
+	assert.Equal(t, "key.dot_segment", i18n.ID(err))
+}
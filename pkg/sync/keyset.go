@@ -0,0 +1,272 @@
+package sync
+
+import (
+	"bufio"
+	"container/heap"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// keySetLimit is how many keys a keySet holds in memory before it writes
+// them, sorted, to a run file.
+const keySetLimit = 1 << 18
+
+// keySet holds the keys of the local files a run saw, for the deleter.
+// Trees of millions of files do not fit a map, so the keys spill to sorted
+// runs on disk, merged back in key order: the order of bucket listings,
+// which the deleter walks alongside.
+type keySet struct {
+	// limit is keySetLimit but for tests.
+	limit int
+	// dir is where the runs are written; with ownDir, remove deletes it
+	// too.
+	dir    string
+	ownDir bool
+
+	mu   sync.Mutex
+	keys []string
+	// runs are the files of the keys that spilled.
+	runs []string
+	err  error
+}
+
+func newKeySet(dir string) *keySet {
+	return &keySet{limit: keySetLimit, dir: dir}
+}
+
+func (s *Syncer) keySetDir() string {
+	root, err := filepath.Abs(s.cfg.RootDir)
+	if err != nil {
+		root = s.cfg.RootDir
+	}
+	sum := sha1.Sum([]byte(s.cfg.Bucket + "\x00" + root))
+	return s.statePath("keys", fmt.Sprintf("%x", sum))
+}
+
+// localKeySet returns the keySet of a run, spilling to a directory of its
+// own below keySetDir, so that Syncers of the same pair running side by
+// side keep apart.
+func (s *Syncer) localKeySet() *keySet {
+	parent := s.keySetDir()
+	err := os.MkdirAll(parent, 0700)
+	dir := parent
+	if err == nil {
+		dir, err = os.MkdirTemp(parent, "set-*")
+	}
+	set := newKeySet(dir)
+	if err != nil {
+		set.err = i18n.Errorf("file.temp", err)
+	} else {
+		set.ownDir = true
+	}
+	return set
+}
+
+// removeStaleKeySets removes the key sets that crashed runs left below
+// keySetDir. Only the holder of the lock calls it: the sets of other runs
+// of the pair are in use.
+func (s *Syncer) removeStaleKeySets() {
+	os.RemoveAll(s.keySetDir())
+}
+
+// add records key; it may be added more than once.
+func (k *keySet) add(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = append(k.keys, key)
+	if len(k.keys) >= k.limit && k.err == nil {
+		k.err = k.spill()
+	}
+}
+
+// spill writes the keys in memory to a new run.
+func (k *keySet) spill() error {
+	sort.Strings(k.keys)
+	if err := os.MkdirAll(k.dir, 0700); err != nil {
+		return i18n.Errorf("file.temp", err)
+	}
+	file, err := os.CreateTemp(k.dir, "run-*")
+	if err != nil {
+		return i18n.Errorf("file.temp", err)
+	}
+	k.runs = append(k.runs, file.Name())
+	w := bufio.NewWriter(file)
+	var size [binary.MaxVarintLen64]byte
+	for _, key := range k.keys {
+		w.Write(size[:binary.PutUvarint(size[:], uint64(len(key)))])
+		w.WriteString(key)
+	}
+	err = w.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return i18n.Errorf("file.write", err)
+	}
+	k.keys = k.keys[:0]
+	return nil
+}
+
+// remove deletes the runs.
+func (k *keySet) remove() {
+	for _, run := range k.runs {
+		os.Remove(run)
+	}
+	k.runs = nil
+	if k.ownDir {
+		os.Remove(k.dir)
+	}
+}
+
+// cursor returns a cursor over the keys, once every key was added, or the
+// error that kept a run from being written: without every key, the deleter
+// would take files for removed ones.
+func (k *keySet) cursor() (*keyCursor, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.err != nil {
+		return nil, k.err
+	}
+	sort.Strings(k.keys)
+	return &keyCursor{set: k}, nil
+}
+
+// keyCursor answers whether keys are in a keySet. Asked in ascending order,
+// it reads each run once; a key lower than the previous one starts over
+// from the first key.
+type keyCursor struct {
+	set     *keySet
+	started bool
+	merge   keyMerge
+	current string
+	done    bool
+	last    string
+	err     error
+}
+
+// has reports whether key is in the set.
+func (c *keyCursor) has(key string) bool {
+	if !c.started || key < c.last {
+		c.rewind()
+	}
+	c.last = key
+	for c.err == nil && !c.done && c.current < key {
+		c.next()
+	}
+	return c.err != nil || !c.done && c.current == key
+}
+
+// rewind starts over from the first key.
+func (c *keyCursor) rewind() {
+	c.close()
+	c.started = true
+	c.merge = keyMerge{}
+	if len(c.set.keys) > 0 {
+		c.merge = append(c.merge, &keySource{memory: c.set.keys})
+	}
+	for _, run := range c.set.runs {
+		file, err := os.Open(run)
+		if err != nil {
+			c.fail(i18n.Errorf("file.open", err))
+			return
+		}
+		c.merge = append(c.merge, &keySource{file: file, reader: bufio.NewReader(file)})
+	}
+	sources := c.merge[:0]
+	for _, source := range c.merge {
+		if c.advance(source) {
+			sources = append(sources, source)
+		}
+	}
+	c.merge = sources
+	heap.Init(&c.merge)
+	c.done = false
+	c.next()
+}
+
+// next moves to the next key of the merge.
+func (c *keyCursor) next() {
+	if len(c.merge) == 0 {
+		c.done = true
+		return
+	}
+	source := c.merge[0]
+	c.current = source.key
+	if c.advance(source) {
+		heap.Fix(&c.merge, 0)
+	} else {
+		heap.Pop(&c.merge)
+	}
+}
+
+// advance reads the next key of source, reporting false at its end.
+func (c *keyCursor) advance(source *keySource) bool {
+	if source.file == nil {
+		if len(source.memory) == 0 {
+			return false
+		}
+		source.key, source.memory = source.memory[0], source.memory[1:]
+		return true
+	}
+	size, err := binary.ReadUvarint(source.reader)
+	if err == nil {
+		buf := make([]byte, size)
+		if _, err = io.ReadFull(source.reader, buf); err == nil {
+			source.key = string(buf)
+			return true
+		}
+	}
+	source.file.Close()
+	if err != io.EOF {
+		c.fail(i18n.Errorf("keyset.read", err))
+	}
+	return false
+}
+
+// fail ends the cursor with err, after which has answers true: keeping an
+// object is always safe.
+func (c *keyCursor) fail(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// close closes the runs still open.
+func (c *keyCursor) close() {
+	for _, source := range c.merge {
+		if source.file != nil {
+			source.file.Close()
+		}
+	}
+	c.merge = nil
+}
+
+// keySource is a run, or the keys in memory, being merged.
+type keySource struct {
+	key    string
+	memory []string
+	file   *os.File
+	reader *bufio.Reader
+}
+
+// keyMerge is a heap of the sources by their current key.
+type keyMerge []*keySource
+
+func (m keyMerge) Len() int           { return len(m) }
+func (m keyMerge) Less(i, j int) bool { return m[i].key < m[j].key }
+func (m keyMerge) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m *keyMerge) Push(x any)        { *m = append(*m, x.(*keySource)) }
+func (m *keyMerge) Pop() any {
+	old := *m
+	source := old[len(old)-1]
+	*m = old[:len(old)-1]
+	return source
+}
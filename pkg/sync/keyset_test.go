@@ -0,0 +1,117 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keysOf returns a keySet of keys, for the deleter.
+func keysOf(keys ...string) *keySet {
+	set := newKeySet(os.TempDir())
+	for _, key := range keys {
+		set.add(key)
+	}
+	return set
+}
+
+func TestKeySetSpillsToSortedRuns(t *testing.T) {
+	set := newKeySet(t.TempDir())
+	set.limit = 3
+	for _, key := range []string{"d", "a/b", "a-b", "c", "a", "e/f", "b", "c"} {
+		set.add(key)
+	}
+	require.Len(t, set.runs, 2)
+	runs := set.runs
+	defer set.remove()
+
+	cursor, err := set.cursor()
+	require.NoError(t, err)
+	defer cursor.close()
+	for _, key := range []string{"a", "a-b", "a/b", "b", "c", "d", "e/f"} {
+		assert.True(t, cursor.has(key), key)
+	}
+	assert.False(t, cursor.has("f"))
+
+	set.remove()
+	for _, run := range runs {
+		_, err := os.Stat(run)
+		assert.True(t, os.IsNotExist(err))
+	}
+}
+
+func TestKeyCursorOutOfOrder(t *testing.T) {
+	set := newKeySet(t.TempDir())
+	set.limit = 2
+	for i := 0; i < 10; i++ {
+		set.add(fmt.Sprintf("file%d", i))
+	}
+	defer set.remove()
+
+	cursor, err := set.cursor()
+	require.NoError(t, err)
+	defer cursor.close()
+	// Listings are in key order, but a listing of each prefix starts over.
+	assert.True(t, cursor.has("file7"))
+	assert.False(t, cursor.has("file75"))
+	assert.True(t, cursor.has("file2"))
+	assert.False(t, cursor.has("file"))
+	assert.True(t, cursor.has("file9"))
+	assert.NoError(t, cursor.err)
+}
+
+func TestKeyCursorKeepsEverythingWhenARunIsLost(t *testing.T) {
+	set := newKeySet(t.TempDir())
+	set.limit = 1
+	set.add("a")
+	require.Len(t, set.runs, 1)
+	require.NoError(t, os.Remove(set.runs[0]))
+
+	cursor, err := set.cursor()
+	require.NoError(t, err)
+	assert.True(t, cursor.has("missing"))
+	assert.Error(t, cursor.err)
+}
+
+func TestLocalKeySetsKeepApart(t *testing.T) {
+	s := newTestSyncer(t, nil)
+	s.cfg.RootDir = t.TempDir()
+
+	first, second := s.localKeySet(), s.localKeySet()
+	first.limit, second.limit = 1, 1
+	first.add("a")
+	second.add("b")
+	require.Len(t, first.runs, 1)
+	require.Len(t, second.runs, 1)
+	assert.Equal(t, s.keySetDir(), filepath.Dir(first.dir))
+	assert.NotEqual(t, first.dir, second.dir)
+
+	// A run ending does not take the keys of another one.
+	first.remove()
+	assert.NoDirExists(t, first.dir)
+	cursor, err := second.cursor()
+	require.NoError(t, err)
+	defer cursor.close()
+	assert.True(t, cursor.has("b"))
+	second.remove()
+}
+
+func TestAcquireLockRemovesStaleKeySets(t *testing.T) {
+	s := newTestSyncer(t, nil)
+	s.cfg.RootDir = t.TempDir()
+	leftover := filepath.Join(s.keySetDir(), "set-1", "run-1")
+	require.NoError(t, os.MkdirAll(filepath.Dir(leftover), 0700))
+	require.NoError(t, os.WriteFile(leftover, []byte("\x01a"), 0600))
+
+	s.localKeySet().remove()
+	assert.FileExists(t, leftover, "key sets are only removed by the holder of the lock")
+
+	release, err := s.AcquireLock(false)
+	require.NoError(t, err)
+	defer release()
+	assert.NoDirExists(t, filepath.Dir(leftover))
+}
@@ -0,0 +1,146 @@
+package sync
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// keychainService names the entries gui-sync keeps in the keychain of the
+// system.
+const keychainService = "gui-sync"
+
+// keychainEntryPattern limits the names of keychain entries to ones the
+// keychain tools take as a single argument.
+var keychainEntryPattern = regexp.MustCompile(`^[A-Za-z0-9_.@-]+$`)
+
+// AccessKeys are static AWS access keys.
+type AccessKeys struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+}
+
+// KeyStore keeps AccessKeys out of plain-text files. Load reports with
+// found whether keys were stored.
+type KeyStore interface {
+	Load() (keys AccessKeys, found bool, err error)
+	Save(keys AccessKeys) error
+}
+
+// ParseKeyStore returns the store of spec: "keychain" or "keychain:<entry>"
+// for the keychain of the system (macOS Keychain, Windows Credential
+// Manager, or the Secret Service through secret-tool elsewhere), or
+// "secretsmanager:<secret-id>" for a secret of AWS Secrets Manager, read
+// and written with the profile of creds in region, or in the region of the
+// ARN given as the ID.
+func ParseKeyStore(spec, region string, creds Credentials) (KeyStore, error) {
+	kind, name, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "keychain":
+		if name == "" {
+			name = "default"
+		}
+		if !keychainEntryPattern.MatchString(name) {
+			break
+		}
+		return systemKeychain{account: name}, nil
+	case "secretsmanager":
+		if name == "" {
+			break
+		}
+		if arn := strings.Split(name, ":"); len(arn) > 3 && arn[0] == "arn" {
+			region = arn[3]
+		}
+		sess, err := NewSession(region, Credentials{Profile: creds.Profile}, RetryPolicy{}, Timeouts{})
+		if err != nil {
+			return nil, i18n.Errorf("s3.session", err)
+		}
+		return &secretsManagerStore{client: secretsmanager.New(sess), secretID: name}, nil
+	}
+	return nil, i18n.Errorf("keys.invalid_store", spec)
+}
+
+// loadStoredKeys returns the keys of the store of spec for NewSession.
+func loadStoredKeys(spec, region string, creds Credentials) (AccessKeys, error) {
+	store, err := ParseKeyStore(spec, region, creds)
+	if err != nil {
+		return AccessKeys{}, err
+	}
+	keys, found, err := store.Load()
+	if err != nil {
+		return AccessKeys{}, err
+	}
+	if !found {
+		return AccessKeys{}, i18n.Errorf("keys.not_found", spec)
+	}
+	return keys, nil
+}
+
+// encode and decode keep both keys in a single keychain entry. Secret
+// access keys never contain a colon.
+func (k AccessKeys) encode() string {
+	return k.AccessKeyID + ":" + k.SecretAccessKey
+}
+
+func decodeAccessKeys(value string) (AccessKeys, bool) {
+	id, secret, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok || id == "" || secret == "" {
+		return AccessKeys{}, false
+	}
+	return AccessKeys{AccessKeyID: id, SecretAccessKey: secret}, true
+}
+
+// secretsManagerStore keeps the keys as the JSON of AccessKeys in the
+// string of a secret, created on the first Save.
+type secretsManagerStore struct {
+	client   secretsmanageriface.SecretsManagerAPI
+	secretID string
+}
+
+func (s *secretsManagerStore) Load() (AccessKeys, bool, error) {
+	out, err := s.client.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: aws.String(s.secretID)})
+	if isSecretMissing(err) {
+		return AccessKeys{}, false, nil
+	}
+	if err != nil {
+		return AccessKeys{}, false, i18n.Errorf("keys.load_failed", s.secretID, err)
+	}
+	var keys AccessKeys
+	if err := json.Unmarshal([]byte(aws.StringValue(out.SecretString)), &keys); err != nil || keys.AccessKeyID == "" || keys.SecretAccessKey == "" {
+		return AccessKeys{}, false, i18n.Errorf("keys.malformed", s.secretID)
+	}
+	return keys, true, nil
+}
+
+func (s *secretsManagerStore) Save(keys AccessKeys) error {
+	value, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutSecretValue(&secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(s.secretID),
+		SecretString: aws.String(string(value)),
+	})
+	if isSecretMissing(err) {
+		_, err = s.client.CreateSecret(&secretsmanager.CreateSecretInput{
+			Name:         aws.String(s.secretID),
+			Description:  aws.String("AWS access keys of gui-sync"),
+			SecretString: aws.String(string(value)),
+		})
+	}
+	if err != nil {
+		return i18n.Errorf("keys.save_failed", s.secretID, err)
+	}
+	return nil
+}
+
+func isSecretMissing(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException
+}
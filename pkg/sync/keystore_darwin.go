@@ -0,0 +1,48 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// errSecItemNotFound is the exit status of security when no entry matches.
+const errSecItemNotFound = 44
+
+// systemKeychain keeps the keys in the login keychain through security.
+type systemKeychain struct {
+	account string
+}
+
+func (k systemKeychain) Load() (AccessKeys, bool, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keychainService, "-a", k.account, "-w").Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == errSecItemNotFound {
+		return AccessKeys{}, false, nil
+	}
+	if err != nil {
+		return AccessKeys{}, false, i18n.Errorf("keys.keychain_failed", err)
+	}
+	keys, ok := decodeAccessKeys(string(out))
+	if !ok {
+		return AccessKeys{}, false, i18n.Errorf("keys.malformed", k.account)
+	}
+	return keys, true, nil
+}
+
+func (k systemKeychain) Save(keys AccessKeys) error {
+	// Commands given to the interactive mode keep the secret out of the
+	// arguments of any process.
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", keychainService, k.account, keys.encode()))
+	if out, err := cmd.CombinedOutput(); err != nil || strings.Contains(string(out), "security: ") {
+		if err == nil {
+			err = errors.New(strings.TrimSpace(string(out)))
+		}
+		return i18n.Errorf("keys.keychain_failed", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+//go:build !darwin && !windows
+
+package sync
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// systemKeychain keeps the keys in the Secret Service (GNOME Keyring,
+// KWallet) through secret-tool, from libsecret.
+type systemKeychain struct {
+	account string
+}
+
+func (k systemKeychain) Load() (AccessKeys, bool, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", keychainService, "account", k.account).Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return AccessKeys{}, false, i18n.Errorf("keys.no_keychain")
+	}
+	// secret-tool fails silently when nothing matches.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(out) == 0 && len(exitErr.Stderr) == 0 {
+		return AccessKeys{}, false, nil
+	}
+	if err != nil {
+		return AccessKeys{}, false, i18n.Errorf("keys.keychain_failed", commandError(err))
+	}
+	keys, ok := decodeAccessKeys(string(out))
+	if !ok {
+		return AccessKeys{}, false, i18n.Errorf("keys.malformed", k.account)
+	}
+	return keys, true, nil
+}
+
+func (k systemKeychain) Save(keys AccessKeys) error {
+	cmd := exec.Command("secret-tool", "store", "--label", keychainService+" ("+k.account+")", "service", keychainService, "account", k.account)
+	cmd.Stdin = strings.NewReader(keys.encode())
+	_, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return i18n.Errorf("keys.no_keychain")
+	}
+	if err != nil {
+		return i18n.Errorf("keys.keychain_failed", commandError(err))
+	}
+	return nil
+}
+
+// commandError prefers what a failed command wrote to stderr over its
+// exit status.
+func commandError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+package sync
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+var (
+	advapi32       = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+// credential mirrors CREDENTIALW.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// systemKeychain keeps the keys as a generic credential of the Windows
+// Credential Manager, named gui-sync:<account>.
+type systemKeychain struct {
+	account string
+}
+
+func (k systemKeychain) Load() (AccessKeys, bool, error) {
+	target, err := syscall.UTF16PtrFromString(keychainService + ":" + k.account)
+	if err != nil {
+		return AccessKeys{}, false, err
+	}
+	var cred *credential
+	if ret, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); ret == 0 {
+		if err == errorNotFound {
+			return AccessKeys{}, false, nil
+		}
+		return AccessKeys{}, false, i18n.Errorf("keys.keychain_failed", err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	keys, ok := decodeAccessKeys(string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)))
+	if !ok {
+		return AccessKeys{}, false, i18n.Errorf("keys.malformed", k.account)
+	}
+	return keys, true, nil
+}
+
+func (k systemKeychain) Save(keys AccessKeys) error {
+	target, err := syscall.UTF16PtrFromString(keychainService + ":" + k.account)
+	if err != nil {
+		return err
+	}
+	user, err := syscall.UTF16PtrFromString(keys.AccessKeyID)
+	if err != nil {
+		return err
+	}
+	blob := []byte(keys.encode())
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(blob)),
+		CredentialBlob:     &blob[0],
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	if ret, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); ret == 0 {
+		return i18n.Errorf("keys.keychain_failed", err)
+	}
+	return nil
+}
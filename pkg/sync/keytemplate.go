@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Config.KeyTemplate places the keys of a tree below a prefix naming the
+// machine or the day of the run, such as "{{hostname}}/{{date}}/{{relpath}}",
+// so that a fleet of machines can sync into one bucket. {{relpath}} ends the
+// template: everything before it is the key prefix of the run, and the
+// deleter, diff, verify, restore and prune only look at the objects below
+// it.
+
+// keyTemplateFields are the placeholders a key template may hold, besides
+// {{relpath}}, with their values at now.
+var keyTemplateFields = map[string]func(now time.Time) (string, error){
+	"hostname": func(time.Time) (string, error) { return os.Hostname() },
+	"date":     func(now time.Time) (string, error) { return now.Format("2006-01-02"), nil },
+}
+
+// ValidateKeyTemplate checks that template holds known placeholders only
+// and ends with {{relpath}}.
+func ValidateKeyTemplate(template string) error {
+	if template == "" {
+		return nil
+	}
+	prefix, ok := strings.CutSuffix(template, "{{relpath}}")
+	if !ok || strings.Contains(prefix, "{{relpath}}") {
+		return i18n.Errorf("keytemplate.relpath", template)
+	}
+	rest := prefix
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return i18n.Errorf("keytemplate.unclosed", template)
+		}
+		name := rest[start+2 : start+end]
+		if _, ok := keyTemplateFields[name]; !ok {
+			return i18n.Errorf("keytemplate.unknown", name, template)
+		}
+		rest = rest[start+end+2:]
+	}
+	if strings.HasPrefix(prefix, reservedPrefix) || strings.HasPrefix(prefix, reportsPrefix) {
+		return i18n.Errorf("keytemplate.reserved", template)
+	}
+	return nil
+}
+
+// renderKeyPrefix returns the key prefix of template, a valid key
+// template, at now.
+func renderKeyPrefix(template string, now time.Time) (string, error) {
+	prefix := strings.TrimSuffix(template, "{{relpath}}")
+	for name, value := range keyTemplateFields {
+		placeholder := "{{" + name + "}}"
+		if !strings.Contains(prefix, placeholder) {
+			continue
+		}
+		v, err := value(now)
+		if err != nil {
+			return "", i18n.Errorf("keytemplate.render", name, err)
+		}
+		prefix = strings.ReplaceAll(prefix, placeholder, v)
+	}
+	return prefix, nil
+}
+
+// updateKeyPrefix renders Config.KeyTemplate for a run starting now, or at
+// Config.KeyDate when it is set.
+func (s *Syncer) updateKeyPrefix(now time.Time) error {
+	if s.cfg.KeyTemplate == "" {
+		return nil
+	}
+	if !s.cfg.KeyDate.IsZero() {
+		now = s.cfg.KeyDate
+	}
+	prefix, err := renderKeyPrefix(s.cfg.KeyTemplate, now)
+	if err != nil {
+		return err
+	}
+	s.keyPrefix = prefix
+	return nil
+}
+
+// prefixScoped returns the identity id of a local state file, scoped to the
+// key prefix: what it says of the objects below one prefix does not hold
+// for another. Without a template, id is returned as is.
+func (s *Syncer) prefixScoped(id string) string {
+	if s.keyPrefix == "" {
+		return id
+	}
+	return id + "\x00" + s.keyPrefix
+}
+
+// prefixed returns the key of the object at name below the key prefix.
+func (s *Syncer) prefixed(name string) string {
+	return s.keyPrefix + name
+}
+
+// unprefixed returns key without the key prefix, as rules and patterns
+// see it.
+func (s *Syncer) unprefixed(key string) string {
+	return strings.TrimPrefix(key, s.keyPrefix)
+}
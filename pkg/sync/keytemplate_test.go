@@ -0,0 +1,82 @@
+package sync
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateKeyTemplate(t *testing.T) {
+	for _, template := range []string{"", "{{relpath}}", "backups/{{hostname}}/{{date}}/{{relpath}}", "{{hostname}}-{{relpath}}"} {
+		assert.NoError(t, ValidateKeyTemplate(template), template)
+	}
+	for _, template := range []string{
+		"{{hostname}}/{{date}}",
+		"{{relpath}}/{{hostname}}",
+		"{{relpath}}/{{relpath}}",
+		"{{user}}/{{relpath}}",
+		"{{hostname/{{relpath}}",
+		reservedPrefix + "{{relpath}}",
+	} {
+		assert.Error(t, ValidateKeyTemplate(template), template)
+	}
+}
+
+func TestRenderKeyPrefix(t *testing.T) {
+	host, err := os.Hostname()
+	require.NoError(t, err)
+	now := time.Date(2026, 3, 9, 23, 0, 0, 0, time.Local)
+
+	prefix, err := renderKeyPrefix("backups/{{hostname}}/{{date}}/{{relpath}}", now)
+	require.NoError(t, err)
+	assert.Equal(t, "backups/"+host+"/2026-03-09/", prefix)
+}
+
+func TestKeyDateRendersAnEarlierDay(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.KeyTemplate = "pc-01/{{date}}/{{relpath}}"
+	s.cfg.KeyDate = time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	require.NoError(t, s.updateKeyPrefix(time.Date(2026, 3, 9, 8, 0, 0, 0, time.Local)))
+
+	assert.Equal(t, "pc-01/2026-03-01/readme.txt", s.keyOf("readme.txt"))
+}
+
+func TestKeysBelowThePrefix(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.KeyTemplate = "pc-01/{{relpath}}"
+	s.cfg.SanitizeKeys = true
+	require.NoError(t, s.updateKeyPrefix(time.Now()))
+
+	key := s.keyOf("fotos/100%.jpg")
+	assert.Equal(t, "pc-01/fotos/100%25.jpg", key)
+	assert.Equal(t, "fotos/100%.jpg", s.localName(key))
+}
+
+func TestDeleterScopedToThePrefix(t *testing.T) {
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectsV2Pages", mock.MatchedBy(func(input *s3.ListObjectsV2Input) bool {
+		return aws.StringValue(input.Prefix) == "pc-01/"
+	}), mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []*s3.Object{
+		{Key: aws.String("pc-01/keep.txt")},
+		{Key: aws.String("pc-01/cache/old.tmp")},
+		{Key: aws.String("pc-01/old.txt")},
+	}}, nil).Once()
+	mockClient.On("DeleteObject", &s3.DeleteObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String("pc-01/old.txt"),
+	}).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	s.cfg.KeyTemplate = "pc-01/{{relpath}}"
+	s.keepRemote = []Rule{{Pattern: "cache/**", SkipDelete: true}}
+	require.NoError(t, s.updateKeyPrefix(time.Now()))
+
+	require.NoError(t, (&deleter{syncer: s}).run(keysOf(s.keyOf("keep.txt"))))
+	mockClient.AssertExpectations(t)
+}
@@ -0,0 +1,180 @@
+package sync
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// lifecycleRuleID names the lifecycle rule gui-sync manages; the other
+// rules of the bucket are left alone.
+const lifecycleRuleID = "gui-sync"
+
+// minDaysIA is the minimum age S3 accepts for transitions to STANDARD_IA.
+const minDaysIA = 30
+
+// LifecyclePolicy is the retention applied by the lifecycle rule of
+// gui-sync to the keys under Prefix. Zero days leave that step out.
+type LifecyclePolicy struct {
+	Prefix string
+	// TransitionIA, TransitionGlacier and TransitionDeepArchive move
+	// objects to STANDARD_IA, GLACIER and DEEP_ARCHIVE this many days
+	// after they were uploaded.
+	TransitionIA          int
+	TransitionGlacier     int
+	TransitionDeepArchive int
+	// ExpireNoncurrent deletes the versions replaced or deleted this many
+	// days ago, on versioned buckets.
+	ExpireNoncurrent int
+}
+
+// Empty reports whether the policy has no step at all.
+func (p LifecyclePolicy) Empty() bool {
+	return p.TransitionIA == 0 && p.TransitionGlacier == 0 && p.TransitionDeepArchive == 0 && p.ExpireNoncurrent == 0
+}
+
+// validate checks the rules S3 enforces on transitions, so the mistake is
+// reported before the request.
+func (p LifecyclePolicy) validate() error {
+	for _, days := range []int{p.TransitionIA, p.TransitionGlacier, p.TransitionDeepArchive, p.ExpireNoncurrent} {
+		if days < 0 {
+			return i18n.Errorf("lifecycle.negative_days")
+		}
+	}
+	if p.TransitionIA != 0 && p.TransitionIA < minDaysIA {
+		return i18n.Errorf("lifecycle.ia_too_soon", minDaysIA)
+	}
+	last := 0
+	for _, days := range []int{p.TransitionIA, p.TransitionGlacier, p.TransitionDeepArchive} {
+		if days == 0 {
+			continue
+		}
+		if days <= last {
+			return i18n.Errorf("lifecycle.order")
+		}
+		last = days
+	}
+	return nil
+}
+
+// rule builds the lifecycle rule of p.
+func (p LifecyclePolicy) rule() *s3.LifecycleRule {
+	rule := &s3.LifecycleRule{
+		ID:     aws.String(lifecycleRuleID),
+		Status: aws.String(s3.ExpirationStatusEnabled),
+		Filter: &s3.LifecycleRuleFilter{Prefix: aws.String(p.Prefix)},
+	}
+	for _, t := range []struct {
+		days  int
+		class string
+	}{
+		{p.TransitionIA, s3.TransitionStorageClassStandardIa},
+		{p.TransitionGlacier, s3.TransitionStorageClassGlacier},
+		{p.TransitionDeepArchive, s3.TransitionStorageClassDeepArchive},
+	} {
+		if t.days > 0 {
+			rule.Transitions = append(rule.Transitions, &s3.Transition{Days: aws.Int64(int64(t.days)), StorageClass: aws.String(t.class)})
+		}
+	}
+	if p.ExpireNoncurrent > 0 {
+		rule.NoncurrentVersionExpiration = &s3.NoncurrentVersionExpiration{NoncurrentDays: aws.Int64(int64(p.ExpireNoncurrent))}
+	}
+	return rule
+}
+
+// policyOf reads back the policy of a rule written by rule.
+func policyOf(rule *s3.LifecycleRule) LifecyclePolicy {
+	var p LifecyclePolicy
+	if rule.Filter != nil {
+		p.Prefix = aws.StringValue(rule.Filter.Prefix)
+	}
+	for _, t := range rule.Transitions {
+		days := int(aws.Int64Value(t.Days))
+		switch aws.StringValue(t.StorageClass) {
+		case s3.TransitionStorageClassStandardIa:
+			p.TransitionIA = days
+		case s3.TransitionStorageClassGlacier:
+			p.TransitionGlacier = days
+		case s3.TransitionStorageClassDeepArchive:
+			p.TransitionDeepArchive = days
+		}
+	}
+	if rule.NoncurrentVersionExpiration != nil {
+		p.ExpireNoncurrent = int(aws.Int64Value(rule.NoncurrentVersionExpiration.NoncurrentDays))
+	}
+	return p
+}
+
+// lifecycleRules returns the lifecycle rules of the bucket, none when it
+// has no lifecycle configuration.
+func (s *Syncer) lifecycleRules() ([]*s3.LifecycleRule, error) {
+	output, err := s.client.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(s.cfg.Bucket),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoSuchLifecycleConfiguration" {
+			return nil, nil
+		}
+		return nil, i18n.Errorf("lifecycle.read_failed", err)
+	}
+	return output.Rules, nil
+}
+
+// Lifecycle returns the policy applied by ApplyLifecycle, and how many other
+// lifecycle rules the bucket has. The policy is nil when there is none.
+func (s *Syncer) Lifecycle() (*LifecyclePolicy, int, error) {
+	rules, err := s.lifecycleRules()
+	if err != nil {
+		return nil, 0, err
+	}
+	var policy *LifecyclePolicy
+	others := 0
+	for _, rule := range rules {
+		if aws.StringValue(rule.ID) == lifecycleRuleID {
+			p := policyOf(rule)
+			policy = &p
+		} else {
+			others++
+		}
+	}
+	return policy, others, nil
+}
+
+// ApplyLifecycle writes the lifecycle rule of gui-sync to the bucket,
+// replacing the previous one and keeping every other rule. An empty policy
+// removes the rule.
+func (s *Syncer) ApplyLifecycle(p LifecyclePolicy) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	rules, err := s.lifecycleRules()
+	if err != nil {
+		return err
+	}
+
+	var kept []*s3.LifecycleRule
+	for _, rule := range rules {
+		if aws.StringValue(rule.ID) != lifecycleRuleID {
+			kept = append(kept, rule)
+		}
+	}
+	if !p.Empty() {
+		kept = append(kept, p.rule())
+	}
+
+	if len(kept) == 0 {
+		if _, err := s.client.DeleteBucketLifecycle(&s3.DeleteBucketLifecycleInput{Bucket: aws.String(s.cfg.Bucket)}); err != nil {
+			return i18n.Errorf("lifecycle.write_failed", err)
+		}
+		return nil
+	}
+	_, err = s.client.PutBucketLifecycleConfiguration(&s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(s.cfg.Bucket),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: kept},
+	})
+	if err != nil {
+		return i18n.Errorf("lifecycle.write_failed", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: lifecycle rules
+func TestLifecyclePolicyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy LifecyclePolicy
+		wantID string
+	}{
+		{"full policy", LifecyclePolicy{TransitionIA: 30, TransitionGlacier: 90, TransitionDeepArchive: 180, ExpireNoncurrent: 60}, ""},
+		{"glacier only", LifecyclePolicy{TransitionGlacier: 1}, ""},
+		{"negative days", LifecyclePolicy{ExpireNoncurrent: -1}, "lifecycle.negative_days"},
+		{"IA too soon", LifecyclePolicy{TransitionIA: 7}, "lifecycle.ia_too_soon"},
+		{"out of order", LifecyclePolicy{TransitionIA: 90, TransitionGlacier: 60}, "lifecycle.order"},
+		{"same day", LifecyclePolicy{TransitionGlacier: 90, TransitionDeepArchive: 90}, "lifecycle.order"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.validate()
+			if tt.wantID == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, tt.wantID, i18n.ID(err))
+			}
+		})
+	}
+}
+
+func TestLifecyclePolicyRoundTrip(t *testing.T) {
+	p := LifecyclePolicy{Prefix: "docs/", TransitionIA: 30, TransitionDeepArchive: 365, ExpireNoncurrent: 60}
+	assert.Equal(t, p, policyOf(p.rule()))
+}
+
+func TestApplyLifecycle(t *testing.T) {
+	other := &s3.LifecycleRule{ID: aws.String("logs"), Status: aws.String(s3.ExpirationStatusEnabled)}
+	previous := LifecyclePolicy{TransitionGlacier: 30}.rule()
+
+	t.Run("replaces the rule and keeps the others", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetBucketLifecycleConfiguration", mock.Anything).Return(&s3.GetBucketLifecycleConfigurationOutput{Rules: []*s3.LifecycleRule{other, previous}}, nil).Once()
+		var written []*s3.LifecycleRule
+		client.On("PutBucketLifecycleConfiguration", mock.Anything).Run(func(args mock.Arguments) {
+			written = args.Get(0).(*s3.PutBucketLifecycleConfigurationInput).LifecycleConfiguration.Rules
+		}).Return(&s3.PutBucketLifecycleConfigurationOutput{}, nil).Once()
+
+		s := newTestSyncer(t, client)
+		policy := LifecyclePolicy{Prefix: "docs/", TransitionIA: 30, ExpireNoncurrent: 90}
+		require.NoError(t, s.ApplyLifecycle(policy))
+		client.AssertExpectations(t)
+
+		require.Len(t, written, 2)
+		assert.Equal(t, other, written[0])
+		assert.Equal(t, policy, policyOf(written[1]))
+	})
+
+	t.Run("bucket without lifecycle configuration", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetBucketLifecycleConfiguration", mock.Anything).Return(nil, awserr.New("NoSuchLifecycleConfiguration", "none", nil)).Once()
+
+		s := newTestSyncer(t, client)
+		policy, others, err := s.Lifecycle()
+		require.NoError(t, err)
+		assert.Nil(t, policy)
+		assert.Zero(t, others)
+	})
+
+	t.Run("removing the only rule deletes the configuration", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetBucketLifecycleConfiguration", mock.Anything).Return(&s3.GetBucketLifecycleConfigurationOutput{Rules: []*s3.LifecycleRule{previous}}, nil).Once()
+		client.On("DeleteBucketLifecycle", mock.Anything).Return(&s3.DeleteBucketLifecycleOutput{}, nil).Once()
+
+		s := newTestSyncer(t, client)
+		require.NoError(t, s.ApplyLifecycle(LifecyclePolicy{}))
+		client.AssertExpectations(t)
+		client.AssertNotCalled(t, "PutBucketLifecycleConfiguration", mock.Anything)
+	})
+
+	t.Run("invalid policy is rejected before any request", func(t *testing.T) {
+		client := new(mockS3Client)
+		s := newTestSyncer(t, client)
+		err := s.ApplyLifecycle(LifecyclePolicy{TransitionIA: 10})
+		assert.Equal(t, "lifecycle.ia_too_soon", i18n.ID(err))
+		client.AssertNotCalled(t, "GetBucketLifecycleConfiguration", mock.Anything)
+	})
+}
@@ -0,0 +1,64 @@
+package sync
+
+import (
+	"runtime"
+	"strings"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// S3 keys may hold names no Windows file can have, and keys differing only
+// in case, which Windows and macOS take for the same file. Such keys are
+// reported one by one when restoring instead of failing the whole restore
+// or overwriting each other.
+
+// caseInsensitiveFS is set where the default file system ignores case.
+const caseInsensitiveFS = runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+
+// windowsReserved are the device names Windows reserves in every directory,
+// with or without an extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// windowsNameError returns why key cannot be a path on Windows: one of its
+// names is a reserved device name, holds a character Windows forbids or
+// ends in a dot or space, which Windows silently drops.
+func windowsNameError(key string) error {
+	for _, name := range strings.Split(key, "/") {
+		if name == "" {
+			continue
+		}
+		base, _, _ := strings.Cut(name, ".")
+		if windowsReserved[strings.ToUpper(strings.TrimRight(base, " "))] {
+			return i18n.Errorf("restore.reserved_name", name)
+		}
+		if i := strings.IndexFunc(name, func(r rune) bool { return r < 32 || strings.ContainsRune(`<>:"\|?*`, r) }); i >= 0 {
+			return i18n.Errorf("restore.invalid_char", name, name[i:i+1])
+		}
+		if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+			return i18n.Errorf("restore.trailing_dot", name)
+		}
+	}
+	return nil
+}
+
+// caseCollisions returns, for every key that differs only in case from an
+// earlier one, the earlier key, which is the one restored.
+func caseCollisions(keys []string) map[string]string {
+	first := make(map[string]string)
+	collisions := make(map[string]string)
+	for _, key := range keys {
+		folded := strings.ToLower(key)
+		if other, ok := first[folded]; ok {
+			if other != key {
+				collisions[key] = other
+			}
+			continue
+		}
+		first[folded] = key
+	}
+	return collisions
+}
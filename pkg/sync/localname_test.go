@@ -0,0 +1,38 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Suite: local names of keys
+func TestWindowsNameError(t *testing.T) {
+	for _, key := range []string{"docs/relatório.txt", "CONTRATO.pdf", "console/com10.txt", "a/.b/c", "auxiliar.txt"} {
+		assert.NoError(t, windowsNameError(key), key)
+	}
+	for key, id := range map[string]string{
+		"docs/con":        "restore.reserved_name",
+		"NUL.txt":         "restore.reserved_name",
+		"fotos/Com1.jpg":  "restore.reserved_name",
+		"lpt9 .tar.gz":    "restore.reserved_name",
+		"notas: maio.txt": "restore.invalid_char",
+		"a/por quê?.txt":  "restore.invalid_char",
+		`a\b.txt`:         "restore.invalid_char",
+		"linha\n.txt":     "restore.invalid_char",
+		"pasta./a.txt":    "restore.trailing_dot",
+		"a/arquivo ":      "restore.trailing_dot",
+	} {
+		assert.Equal(t, id, i18n.ID(windowsNameError(key)), key)
+	}
+}
+
+func TestCaseCollisions(t *testing.T) {
+	collisions := caseCollisions([]string{"Fotos/Praia.jpg", "fotos/praia.jpg", "fotos/praia.JPG", "fotos/outra.jpg", "Fotos/Praia.jpg"})
+	assert.Equal(t, map[string]string{
+		"fotos/praia.jpg": "Fotos/Praia.jpg",
+		"fotos/praia.JPG": "Fotos/Praia.jpg",
+	}, collisions)
+	assert.Empty(t, caseCollisions([]string{"a.txt", "b.txt"}))
+}
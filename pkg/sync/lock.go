@@ -0,0 +1,126 @@
+package sync
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// instanceLock is the lock file of the process syncing a RootDir to a
+// bucket, so a second copy pointed at the same pair refuses to start.
+type instanceLock struct {
+	formatHeader
+
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Bucket  string    `json:"bucket"`
+	RootDir string    `json:"root_dir"`
+	Started time.Time `json:"started"`
+}
+
+// LockError is returned by AcquireLock while another process holds the lock.
+type LockError struct {
+	Path   string
+	Holder instanceLock
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf(i18n.T("lock.held"),
+		e.Holder.PID, e.Holder.Host, e.Holder.Started.Local().Format("2006-01-02 15:04:05"), e.Holder.RootDir, e.Holder.Bucket)
+}
+
+func (s *Syncer) lockPath() string {
+	root, err := filepath.Abs(s.cfg.RootDir)
+	if err != nil {
+		root = s.cfg.RootDir
+	}
+	sum := sha1.Sum([]byte(s.cfg.Bucket + "\x00" + root))
+	return s.statePath("locks", fmt.Sprintf("%x.lock", sum))
+}
+
+// AcquireLock takes the lock of the RootDir and bucket pair, failing with a
+// *LockError while another live process holds it. Locks left by processes
+// that died on this host are taken over; force takes over any lock. The
+// returned function releases the lock. Holding it, the key sets crashed
+// runs left behind are removed.
+func (s *Syncer) AcquireLock(force bool) (release func(), err error) {
+	host, _ := os.Hostname()
+	root, _ := filepath.Abs(s.cfg.RootDir)
+	lock := &instanceLock{PID: os.Getpid(), Host: host, Bucket: s.cfg.Bucket, RootDir: root, Started: time.Now()}
+	path := s.lockPath()
+
+	for attempt := 0; ; attempt++ {
+		err := createLockFile(path, lock)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, i18n.Errorf("lock.create", path, err)
+		}
+
+		// Only one takeover is attempted: losing the race for the lock
+		// afterwards means another process just started.
+		var holder instanceLock
+		readErr := readStateFile(path, &holder)
+		switch {
+		case attempt > 0 && readErr != nil:
+			return nil, i18n.Errorf("lock.create", path, readErr)
+		case attempt > 0:
+			return nil, &LockError{Path: path, Holder: holder}
+		case force:
+			log.Printf(i18n.T("lock.forced"), path)
+		case readErr != nil:
+			log.Printf(i18n.T("lock.unreadable"), readErr)
+		case holder.Host == host && !processAlive(holder.PID):
+			log.Printf(i18n.T("lock.stale"), holder.PID)
+		default:
+			return nil, &LockError{Path: path, Holder: holder}
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, i18n.Errorf("lock.remove", path, err)
+		}
+	}
+	s.removeStaleKeySets()
+
+	return func() {
+		var current instanceLock
+		if readStateFile(path, &current) == nil && current.PID == lock.PID && current.Started.Equal(lock.Started) {
+			os.Remove(path)
+		}
+	}, nil
+}
+
+// createLockFile writes lock to path, failing with an os.IsExist error when
+// path exists. The content goes to a temporary file first and is linked in
+// place, so other processes never read a partial lock.
+func createLockFile(path string, lock *instanceLock) error {
+	lock.stampFormat()
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Link(tmp.Name(), path)
+}
@@ -0,0 +1,72 @@
+package sync
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: single-instance lock
+func TestAcquireLock(t *testing.T) {
+	newSyncer := func(t *testing.T, stateDir, rootDir string) *Syncer {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.stateDir = stateDir
+		s.cfg.RootDir = rootDir
+		return s
+	}
+	stateDir, rootDir := t.TempDir(), t.TempDir()
+
+	t.Run("second instance is refused until the first releases", func(t *testing.T) {
+		release, err := newSyncer(t, stateDir, rootDir).AcquireLock(false)
+		require.NoError(t, err)
+
+		_, err = newSyncer(t, stateDir, rootDir).AcquireLock(false)
+		var lockErr *LockError
+		require.True(t, errors.As(err, &lockErr))
+		assert.Equal(t, os.Getpid(), lockErr.Holder.PID)
+		assert.Contains(t, err.Error(), "--force")
+
+		_, err = newSyncer(t, stateDir, t.TempDir()).AcquireLock(false)
+		assert.NoError(t, err, "another directory has its own lock")
+
+		release()
+		release2, err := newSyncer(t, stateDir, rootDir).AcquireLock(false)
+		require.NoError(t, err)
+		release2()
+	})
+
+	t.Run("force takes over a live lock", func(t *testing.T) {
+		release, err := newSyncer(t, stateDir, rootDir).AcquireLock(false)
+		require.NoError(t, err)
+
+		releaseForced, err := newSyncer(t, stateDir, rootDir).AcquireLock(true)
+		require.NoError(t, err)
+		releaseForced()
+		release() // no longer ours: must not fail or remove anything else
+	})
+
+	t.Run("lock of a dead process is taken over", func(t *testing.T) {
+		s := newSyncer(t, stateDir, rootDir)
+		host, _ := os.Hostname()
+		require.NoError(t, createLockFile(s.lockPath(), &instanceLock{PID: 1 << 30, Host: host, Started: time.Now()}))
+
+		release, err := s.AcquireLock(false)
+		require.NoError(t, err)
+		release()
+		assert.NoFileExists(t, s.lockPath())
+	})
+
+	t.Run("lock from another host is respected", func(t *testing.T) {
+		s := newSyncer(t, stateDir, rootDir)
+		require.NoError(t, createLockFile(s.lockPath(), &instanceLock{PID: 1 << 30, Host: "outro-host", Started: time.Now()}))
+		defer os.Remove(s.lockPath())
+
+		_, err := s.AcquireLock(false)
+		var lockErr *LockError
+		assert.True(t, errors.As(err, &lockErr))
+	})
+}
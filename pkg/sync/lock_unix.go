@@ -0,0 +1,19 @@
+//go:build !windows
+
+package sync
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// processAlive reports whether a process with pid exists.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
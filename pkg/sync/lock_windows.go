@@ -0,0 +1,18 @@
+package sync
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// processAlive reports whether a process with pid exists. Opening a
+// process of another user is denied, which still means it exists.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return errors.Is(err, syscall.ERROR_ACCESS_DENIED)
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package sync
+
+// longPath: only Windows limits the length of paths below that of its file
+// systems.
+func longPath(path string) string { return path }
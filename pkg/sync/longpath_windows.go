@@ -0,0 +1,28 @@
+package sync
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxShortPath is the length from which Windows needs the \\?\ prefix: the
+// 260 characters of MAX_PATH, less the 12 reserved for an 8.3 file name
+// when creating directories.
+const maxShortPath = 248
+
+// longPath returns path in the form Windows accepts past MAX_PATH:
+// absolute, so that the os package extends the paths below it as they
+// grow, and with the \\?\ prefix when it is already that long.
+func longPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if len(abs) < maxShortPath || strings.HasPrefix(abs, `\\?\`) {
+		return abs
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
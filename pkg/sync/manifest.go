@@ -0,0 +1,373 @@
+package sync
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Every manifest is kept under manifestPrefix, named by its ID, and the
+// last one is also written to manifestKey.
+const (
+	manifestKey    = reservedPrefix + "manifest.json"
+	manifestPrefix = reservedPrefix + "manifests/"
+	// ManifestLatest selects the manifest of the last successful run.
+	ManifestLatest = "latest"
+	// manifestIDLayout makes IDs sort in the order the runs finished.
+	manifestIDLayout = "20060102T150405Z"
+)
+
+// Manifest lists every object the bucket held at the end of a successful
+// run (Config.Manifest), sorted by key. On versioned buckets it names the
+// version of each one, so the tree can be restored exactly as that run left
+// it.
+type Manifest struct {
+	formatHeader
+
+	ID        string          `json:"id"`
+	Timestamp time.Time       `json:"timestamp"`
+	Host      string          `json:"host"`
+	RootDir   string          `json:"root_dir"`
+	Objects   []ManifestEntry `json:"objects"`
+}
+
+// ManifestEntry is one object of a Manifest. ETag is the one S3 computed,
+// the MD5 of the contents for objects not uploaded in parts or with KMS.
+type ManifestEntry struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	VersionID    string    `json:"version_id,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	StorageClass string    `json:"storage_class,omitempty"`
+}
+
+// writeManifest lists the bucket and writes the manifest of the run that
+// just succeeded, first under its ID and then as the latest one, so a
+// reader never finds a manifest written only in part.
+func (s *Syncer) writeManifest() (*Manifest, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	now := time.Now().UTC()
+	m := &Manifest{
+		ID:        now.Format(manifestIDLayout),
+		Timestamp: now,
+		Host:      host,
+		RootDir:   s.cfg.RootDir,
+	}
+	m.stampFormat()
+	if m.Objects, err = s.manifestObjects(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{manifestPrefix + m.ID + ".json", manifestKey} {
+		input := &s3.PutObjectInput{
+			Bucket:      aws.String(s.cfg.Bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String("application/json"),
+		}
+		if err := s.setPutChecksum(input, bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		if _, err := s.client.PutObject(input); err != nil {
+			return nil, i18n.Errorf("s3.put", key, err)
+		}
+	}
+	return m, nil
+}
+
+// manifestObjects lists the objects mirroring local files, with the
+// current version of each one on versioned buckets.
+func (s *Syncer) manifestObjects() ([]ManifestEntry, error) {
+	versioning, err := s.BucketVersioning()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ManifestEntry
+	if versioning == "" {
+		objects, err := s.bucketObjects(s.keyPrefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objects {
+			entries = append(entries, ManifestEntry{
+				Key:          aws.StringValue(obj.Key),
+				Size:         aws.Int64Value(obj.Size),
+				ETag:         strings.Trim(aws.StringValue(obj.ETag), `"`),
+				LastModified: aws.TimeValue(obj.LastModified).UTC(),
+				StorageClass: aws.StringValue(obj.StorageClass),
+			})
+		}
+	} else {
+		err := s.client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+			Bucket: aws.String(s.cfg.Bucket),
+			Prefix: optionalString(s.keyPrefix),
+		}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+			for _, v := range page.Versions {
+				key := aws.StringValue(v.Key)
+				if !aws.BoolValue(v.IsLatest) || strings.HasPrefix(key, reservedPrefix) || strings.HasPrefix(key, reportsPrefix) {
+					continue
+				}
+				entries = append(entries, ManifestEntry{
+					Key:          key,
+					Size:         aws.Int64Value(v.Size),
+					ETag:         strings.Trim(aws.StringValue(v.ETag), `"`),
+					VersionID:    aws.StringValue(v.VersionId),
+					LastModified: aws.TimeValue(v.LastModified).UTC(),
+					StorageClass: aws.StringValue(v.StorageClass),
+				})
+			}
+			return true
+		})
+		if err != nil {
+			return nil, i18n.Errorf("restore.list_versions", err)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// ReadManifest reads the manifest id, or the latest one for ManifestLatest
+// or an empty id.
+func (s *Syncer) ReadManifest(id string) (*Manifest, error) {
+	key := manifestKey
+	if id != "" && id != ManifestLatest {
+		if _, err := time.Parse(manifestIDLayout, id); err != nil {
+			return nil, i18n.Errorf("manifest.invalid_id", id)
+		}
+		key = manifestPrefix + id + ".json"
+	}
+
+	output, err := s.client.GetObject(&s3.GetObjectInput{Bucket: aws.String(s.cfg.Bucket), Key: aws.String(key)})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+			return nil, i18n.Errorf("manifest.not_found", cmp.Or(id, ManifestLatest))
+		}
+		return nil, i18n.Errorf("manifest.read_failed", key, err)
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, i18n.Errorf("manifest.read_failed", key, err)
+	}
+	if err := checkFormat(fmt.Sprintf("s3://%s/%s", s.cfg.Bucket, key), data); err != nil {
+		var formatErr *FormatError
+		if errors.As(err, &formatErr) {
+			return nil, err
+		}
+		return nil, i18n.Errorf("manifest.read_failed", key, err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, i18n.Errorf("manifest.read_failed", key, err)
+	}
+	return &m, nil
+}
+
+// Versioned reports whether the manifest names the versions of its
+// objects, which is needed to restore or verify objects changed since.
+func (m *Manifest) Versioned() bool {
+	for _, entry := range m.Objects {
+		if entry.VersionID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// objects returns the entries under prefix as bucket listing entries, for
+// diff.
+func (m *Manifest) objects(prefix string) map[string]*s3.Object {
+	objects := make(map[string]*s3.Object)
+	for _, entry := range m.Objects {
+		if strings.HasPrefix(entry.Key, prefix) {
+			objects[entry.Key] = &s3.Object{
+				Key:          aws.String(entry.Key),
+				Size:         aws.Int64(entry.Size),
+				ETag:         aws.String(`"` + entry.ETag + `"`),
+				LastModified: aws.Time(entry.LastModified),
+			}
+		}
+	}
+	return objects
+}
+
+// entry returns the entry of key.
+func (m *Manifest) entry(key string) (ManifestEntry, bool) {
+	i := sort.Search(len(m.Objects), func(i int) bool { return m.Objects[i].Key >= key })
+	if i < len(m.Objects) && m.Objects[i].Key == key {
+		return m.Objects[i], true
+	}
+	return ManifestEntry{}, false
+}
+
+// RestoreManifest downloads the objects of the manifest id into targetDir,
+// as Restore does. Objects of an unversioned bucket may have been changed
+// or deleted since, so only a versioned bucket restores exactly the tree
+// that run left.
+func (s *Syncer) RestoreManifest(targetDir, id string, sel RestoreSelection) error {
+	m, err := s.ReadManifest(id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf(i18n.T("manifest.restoring"), m.ID, m.Timestamp.Local().Format(time.RFC3339))
+	if !m.Versioned() {
+		fmt.Print(i18n.T("manifest.unversioned"))
+	}
+
+	objects := make([]restoreObject, 0, len(m.Objects))
+	for _, entry := range m.Objects {
+		objects = append(objects, restoreObject{
+			key:          entry.Key,
+			versionID:    entry.VersionID,
+			size:         entry.Size,
+			lastModified: entry.LastModified,
+			storageClass: entry.StorageClass,
+		})
+	}
+	return s.restoreObjects(targetDir, objects, sel)
+}
+
+// VerifyManifest checks that the bucket still holds every object of the
+// manifest id as that run left it, without reading any local file. An
+// object whose size or ETag differs is corrupted when the manifest names
+// its version, and changed otherwise.
+func (s *Syncer) VerifyManifest(ctx context.Context, id string) (*VerifyResult, error) {
+	return s.VerifyManifestSample(ctx, id, 0)
+}
+
+// VerifyManifestSample is VerifyManifest that also downloads sample percent
+// of the objects, chosen at random, and compares their contents with the
+// hash stored with them, catching corruption a HEAD cannot see.
+func (s *Syncer) VerifyManifestSample(ctx context.Context, id string, sample int) (*VerifyResult, error) {
+	m, err := s.ReadManifest(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	result := &VerifyResult{Checked: len(m.Objects), Manifest: m.ID}
+	var mu sync.Mutex
+	entries := make(chan ManifestEntry, 100)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i := 0; i < verifyWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range entries {
+				if ctx.Err() != nil {
+					continue
+				}
+				deep := sample > 0 && rand.IntN(100) < sample
+				status, err := s.verifyManifestEntry(entry, deep)
+				if status == "" && err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				mu.Lock()
+				if deep && status != VerifyMissing && status != VerifyChanged {
+					result.Sampled++
+				}
+				if status == "" {
+					result.Verified++
+				} else {
+					result.Problems = append(result.Problems, VerifyProblem{Key: entry.Key, Status: status, Err: err})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, entry := range m.Objects {
+		if ctx.Err() != nil {
+			break
+		}
+		entries <- entry
+	}
+	close(entries)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result.Problems, func(i, j int) bool { return result.Problems[i].Key < result.Problems[j].Key })
+	return result, nil
+}
+
+// verifyManifestEntry compares one entry of a manifest with its object,
+// and with deep its contents, returning an empty status when they match,
+// and an error with an empty status when the object could not be read at
+// all.
+func (s *Syncer) verifyManifestEntry(entry ManifestEntry, deep bool) (string, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(entry.Key),
+	}
+	if entry.VersionID != "" {
+		input.VersionId = aws.String(entry.VersionID)
+	}
+	head, err := s.client.HeadObject(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == http.StatusNotFound {
+			return VerifyMissing, nil
+		}
+		return "", i18n.Errorf("s3.head", err)
+	}
+
+	if aws.Int64Value(head.ContentLength) == entry.Size && strings.Trim(aws.StringValue(head.ETag), `"`) == entry.ETag {
+		if deep {
+			return s.verifyObjectContent(entry.Key, entry.VersionID, head)
+		}
+		return "", nil
+	}
+	if entry.VersionID != "" {
+		return VerifyCorrupted, i18n.Errorf("manifest.mismatch")
+	}
+	return VerifyChanged, nil
+}
+
+// manifestChanged reports whether the file at localPath was modified after
+// the object of entry was uploaded. Sizes are not compared:
+// the manifest holds the size of the object, which differs for compressed
+// files.
+func manifestChanged(entry ManifestEntry, localPath string) (bool, error) {
+	info, err := os.Lstat(localPath)
+	if err != nil {
+		return false, i18n.Errorf("file.stat", err)
+	}
+	return info.ModTime().After(entry.LastModified), nil
+}
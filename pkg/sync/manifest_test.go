@@ -0,0 +1,194 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: run manifests
+func TestWriteManifest(t *testing.T) {
+	uploaded := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("versioned bucket names the current versions", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetBucketVersioning", mock.Anything).Return(&s3.GetBucketVersioningOutput{Status: aws.String("Enabled")}, nil).Once()
+		client.On("ListObjectVersionsPages", mock.Anything, mock.Anything).Return(&s3.ListObjectVersionsOutput{Versions: []*s3.ObjectVersion{
+			{Key: aws.String("docs/b.txt"), VersionId: aws.String("b2"), IsLatest: aws.Bool(true), Size: aws.Int64(2), ETag: aws.String(`"etag-b"`), LastModified: aws.Time(uploaded)},
+			{Key: aws.String("docs/b.txt"), VersionId: aws.String("b1"), IsLatest: aws.Bool(false), Size: aws.Int64(1), LastModified: aws.Time(uploaded.Add(-time.Hour))},
+			{Key: aws.String("a.txt"), VersionId: aws.String("a1"), IsLatest: aws.Bool(true), Size: aws.Int64(1), ETag: aws.String(`"etag-a"`), LastModified: aws.Time(uploaded)},
+			{Key: aws.String(heartbeatKey), VersionId: aws.String("h1"), IsLatest: aws.Bool(true)},
+			{Key: aws.String(reportsPrefix + "report.json"), VersionId: aws.String("r1"), IsLatest: aws.Bool(true)},
+		}}, nil).Once()
+		var bodies [][]byte
+		var keys []string
+		client.On("PutObject", mock.Anything).Run(func(args mock.Arguments) {
+			input := args.Get(0).(*s3.PutObjectInput)
+			data, err := io.ReadAll(input.Body)
+			require.NoError(t, err)
+			keys = append(keys, aws.StringValue(input.Key))
+			bodies = append(bodies, data)
+		}).Return(&s3.PutObjectOutput{}, nil).Twice()
+
+		s := newTestSyncer(t, client)
+		m, err := s.writeManifest()
+		require.NoError(t, err)
+		client.AssertExpectations(t)
+
+		assert.Equal(t, []string{manifestPrefix + m.ID + ".json", manifestKey}, keys, "the latest copy is written last")
+		assert.Equal(t, bodies[0], bodies[1])
+		assert.Equal(t, []ManifestEntry{
+			{Key: "a.txt", Size: 1, ETag: "etag-a", VersionID: "a1", LastModified: uploaded},
+			{Key: "docs/b.txt", Size: 2, ETag: "etag-b", VersionID: "b2", LastModified: uploaded},
+		}, m.Objects)
+		assert.True(t, m.Versioned())
+
+		var written Manifest
+		require.NoError(t, json.Unmarshal(bodies[0], &written))
+		assert.Equal(t, FormatVersion, written.FormatVersion)
+		assert.Equal(t, m.Objects, written.Objects)
+	})
+
+	t.Run("unversioned bucket lists the current objects", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetBucketVersioning", mock.Anything).Return(&s3.GetBucketVersioningOutput{}, nil).Once()
+		client.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []*s3.Object{
+			{Key: aws.String("a.txt"), Size: aws.Int64(1), ETag: aws.String(`"etag-a"`), LastModified: aws.Time(uploaded)},
+			{Key: aws.String(manifestKey)},
+		}}, nil).Once()
+		client.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Twice()
+
+		s := newTestSyncer(t, client)
+		m, err := s.writeManifest()
+		require.NoError(t, err)
+		assert.Equal(t, []ManifestEntry{{Key: "a.txt", Size: 1, ETag: "etag-a", LastModified: uploaded}}, m.Objects)
+		assert.False(t, m.Versioned())
+	})
+}
+
+func TestReadManifest(t *testing.T) {
+	t.Run("latest and by ID", func(t *testing.T) {
+		client := new(mockS3Client)
+		mockManifest(t, client, manifestKey, &Manifest{ID: "20240501T120000Z"})
+		mockManifest(t, client, manifestKey, &Manifest{ID: "20240501T120000Z"})
+		mockManifest(t, client, manifestPrefix+"20240430T120000Z.json", &Manifest{ID: "20240430T120000Z"})
+
+		s := newTestSyncer(t, client)
+		for id, want := range map[string]string{"": "20240501T120000Z", ManifestLatest: "20240501T120000Z", "20240430T120000Z": "20240430T120000Z"} {
+			m, err := s.ReadManifest(id)
+			require.NoError(t, err, id)
+			assert.Equal(t, want, m.ID, id)
+		}
+	})
+
+	t.Run("invalid and missing manifests", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetObject", mock.Anything).Return(nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)).Once()
+		s := newTestSyncer(t, client)
+
+		_, err := s.ReadManifest("../outro")
+		assert.Equal(t, "manifest.invalid_id", i18n.ID(err))
+		_, err = s.ReadManifest("20240501T120000Z")
+		assert.Equal(t, "manifest.not_found", i18n.ID(err))
+	})
+}
+
+func TestVerifyManifest(t *testing.T) {
+	client := new(mockS3Client)
+	mockManifest(t, client, manifestKey, &Manifest{ID: "20240501T120000Z", Objects: []ManifestEntry{
+		{Key: "a.txt", Size: 1, ETag: "etag-a", VersionID: "a1"},
+		{Key: "b.txt", Size: 2, ETag: "etag-b", VersionID: "b1"},
+		{Key: "c.txt", Size: 3, ETag: "etag-c", VersionID: "c1"},
+	}})
+	isVersion := func(key, version string) interface{} {
+		return mock.MatchedBy(func(input *s3.HeadObjectInput) bool {
+			return aws.StringValue(input.Key) == key && aws.StringValue(input.VersionId) == version
+		})
+	}
+	client.On("HeadObject", isVersion("a.txt", "a1")).Return(&s3.HeadObjectOutput{ContentLength: aws.Int64(1), ETag: aws.String(`"etag-a"`)}, nil).Once()
+	client.On("HeadObject", isVersion("b.txt", "b1")).Return(&s3.HeadObjectOutput{ContentLength: aws.Int64(2), ETag: aws.String(`"other"`)}, nil).Once()
+	client.On("HeadObject", isVersion("c.txt", "c1")).Return(nil, awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")).Once()
+
+	s := newTestSyncer(t, client)
+	result, err := s.VerifyManifest(context.Background(), ManifestLatest)
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+
+	assert.Equal(t, 3, result.Checked)
+	assert.Equal(t, 1, result.Verified)
+	require.Len(t, result.Problems, 2)
+	assert.Equal(t, "b.txt", result.Problems[0].Key)
+	assert.Equal(t, VerifyCorrupted, result.Problems[0].Status)
+	assert.Equal(t, VerifyProblem{Key: "c.txt", Status: VerifyMissing}, result.Problems[1])
+}
+
+func TestDiffManifest(t *testing.T) {
+	tempDir := t.TempDir()
+	uploaded := time.Now().Add(-time.Hour)
+	same := createTempFile(t, tempDir, "same.txt", "same")
+	createTempFile(t, tempDir, "modified.txt", "v2")
+	createTempFile(t, tempDir, "new.txt", "new")
+	require.NoError(t, os.Chtimes(same, uploaded.Add(-time.Minute), uploaded.Add(-time.Minute)))
+
+	client := new(mockS3Client)
+	mockManifest(t, client, manifestKey, &Manifest{ID: "20240501T120000Z", Objects: []ManifestEntry{
+		{Key: "modified.txt", Size: 2, LastModified: uploaded},
+		{Key: "removed.txt", Size: 7, LastModified: uploaded},
+		{Key: "same.txt", Size: 4, LastModified: uploaded},
+	}})
+
+	s := newTestSyncer(t, client)
+	s.cfg.RootDir = tempDir
+	entries, err := s.DiffManifest(context.Background(), ManifestLatest, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, []DiffEntry{
+		{Key: "modified.txt", Change: DiffModified, LocalSize: 2, RemoteSize: 2},
+		{Key: "new.txt", Change: DiffOnlyLocal, LocalSize: 3},
+		{Key: "removed.txt", Change: DiffOnlyRemote, RemoteSize: 7},
+	}, entries)
+	client.AssertNotCalled(t, "ListObjectsV2Pages", mock.Anything, mock.Anything)
+	client.AssertNotCalled(t, "HeadObject", mock.Anything)
+}
+
+func TestRestoreManifest(t *testing.T) {
+	client := new(mockS3Client)
+	mockManifest(t, client, manifestKey, &Manifest{ID: "20240501T120000Z", Objects: []ManifestEntry{
+		{Key: "docs/a.txt", Size: 2, VersionID: "a1"},
+	}})
+	client.On("GetObject", mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+		return aws.StringValue(input.Key) == "docs/a.txt" && aws.StringValue(input.VersionId) == "a1"
+	})).Return(&s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader([]byte("v1")))}, nil).Once()
+
+	s := newTestSyncer(t, client)
+	target := t.TempDir()
+	require.NoError(t, s.RestoreManifest(target, ManifestLatest, RestoreSelection{}))
+	client.AssertExpectations(t)
+
+	data, err := os.ReadFile(filepath.Join(target, "docs", "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(data))
+}
+
+// mockManifest serves m at key, once.
+func mockManifest(t *testing.T, client *mockS3Client, key string, m *Manifest) {
+	m.stampFormat()
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+	client.On("GetObject", mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+		return aws.StringValue(input.Key) == key
+	})).Return(&s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil).Once()
+}
@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// massChangeMinFiles is the smallest tree Config.MassChangePercent watches:
+// in smaller ones a few edits are already a large fraction of the files.
+const massChangeMinFiles = 20
+
+// massChangeDetector watches a run for an unusually large fraction of the
+// files of the last successful run being uploaded again or removed, a
+// common sign of ransomware encrypting the tree or of an accidental
+// rm -rf. Its methods do nothing on a nil detector.
+type massChangeDetector struct {
+	syncer *Syncer
+	ctx    context.Context
+	// baseline is the number of files of the last successful run, and
+	// limit how many of them may change or disappear before it alerts.
+	baseline int64
+	limit    int64
+
+	changed atomic.Int64
+	removed atomic.Int64
+	once    sync.Once
+}
+
+// validateMassChange checks Config.MassChangePercent.
+func validateMassChange(percent int) error {
+	if percent < 0 || percent > 100 {
+		return i18n.Errorf("masschange.invalid_percent", percent)
+	}
+	return nil
+}
+
+// newMassChangeDetector returns the detector of a run, or nil when
+// Config.MassChangePercent is off, the run is limited by Config.FilesFrom
+// or the last successful run is unknown or too small to compare with.
+func (s *Syncer) newMassChangeDetector(ctx context.Context) *massChangeDetector {
+	if s.cfg.MassChangePercent == 0 || s.cfg.FilesFrom != "" {
+		return nil
+	}
+	baseline := s.lastRun().Files
+	if baseline < massChangeMinFiles {
+		return nil
+	}
+	return &massChangeDetector{
+		syncer:   s,
+		ctx:      ctx,
+		baseline: baseline,
+		limit:    baseline * int64(s.cfg.MassChangePercent) / 100,
+	}
+}
+
+// fileChanged counts a file queued for upload.
+func (d *massChangeDetector) fileChanged() {
+	if d == nil {
+		return
+	}
+	if n := d.changed.Add(1); n > d.limit {
+		d.trip(n, i18n.T("masschange.changed"))
+	}
+}
+
+// fileRemoved counts an object queued for deletion.
+func (d *massChangeDetector) fileRemoved() {
+	if d == nil {
+		return
+	}
+	if n := d.removed.Add(1); n > d.limit {
+		d.trip(n, i18n.T("masschange.removed"))
+	}
+}
+
+// trip raises the alert, once per run: with Config.MassChangePause the
+// transfers not yet started wait until Resume confirms the changes.
+func (d *massChangeDetector) trip(count int64, what string) {
+	d.once.Do(func() {
+		s := d.syncer
+		if s.cfg.MassChangePause {
+			s.Pause()
+		}
+		detected := fmt.Sprintf(i18n.T("masschange.detected"), count, d.baseline, what, s.cfg.MassChangePercent)
+		s.mu.Lock()
+		s.massChange = detected
+		s.mu.Unlock()
+
+		body := fmt.Sprintf("%s → s3://%s\n%s", s.cfg.RootDir, s.cfg.Bucket, detected)
+		log.Printf("⚠ %s", detected)
+		if s.cfg.MassChangePause {
+			log.Print(i18n.T("masschange.paused"))
+			body += "\n" + i18n.T("masschange.paused")
+		}
+		s.sendAlert(d.ctx, i18n.T("masschange.title"), body)
+	})
+}
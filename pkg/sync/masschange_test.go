@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: mass change detection
+func TestRunRecordFiles(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.RootDir = t.TempDir()
+	s.stats.scanned.Store(120)
+	s.recordSuccess(time.Now())
+	assert.Equal(t, int64(120), s.lastRun().Files)
+
+	s.cfg.FilesFrom = "lista.txt"
+	s.stats.scanned.Store(3)
+	s.recordSuccess(time.Now())
+	assert.Equal(t, int64(120), s.lastRun().Files, "runs of a file list keep the count of the whole tree")
+}
+
+func TestNewMassChangeDetector(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.RootDir = t.TempDir()
+	s.cfg.MassChangePercent = 30
+	assert.Nil(t, s.newMassChangeDetector(context.Background()), "no previous run")
+
+	s.stats.scanned.Store(massChangeMinFiles - 1)
+	s.recordSuccess(time.Now())
+	assert.Nil(t, s.newMassChangeDetector(context.Background()), "tree too small")
+
+	s.stats.scanned.Store(200)
+	s.recordSuccess(time.Now())
+	d := s.newMassChangeDetector(context.Background())
+	require.NotNil(t, d)
+	assert.Equal(t, int64(60), d.limit)
+
+	s.cfg.MassChangePercent = 0
+	assert.Nil(t, s.newMassChangeDetector(context.Background()), "disabled")
+
+	assert.Equal(t, "masschange.invalid_percent", i18n.ID(validateMassChange(101)))
+	assert.NoError(t, validateMassChange(100))
+}
+
+func TestMassChangeDetector(t *testing.T) {
+	var alerts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		alerts = append(alerts, string(data))
+	}))
+	defer server.Close()
+
+	newDetector := func(pause bool) (*Syncer, *massChangeDetector) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.RootDir = "/dados"
+		s.cfg.MassChangePercent = 10
+		s.cfg.MassChangePause = pause
+		s.cfg.Notifiers = []Notifier{{Kind: "ntfy", Target: server.URL, OnlyOnFailure: true}}
+		return s, &massChangeDetector{syncer: s, ctx: context.Background(), baseline: 100, limit: 10}
+	}
+
+	t.Run("alerts once past the limit", func(t *testing.T) {
+		alerts = nil
+		s, d := newDetector(false)
+		for i := 0; i < 10; i++ {
+			d.fileRemoved()
+		}
+		assert.Empty(t, alerts, "up to the limit is fine")
+		assert.Empty(t, s.Status().MassChange)
+
+		d.fileRemoved()
+		d.fileRemoved()
+		d.fileChanged()
+		require.Len(t, alerts, 1, "alerts once per run, even for failure-only channels")
+		assert.Contains(t, alerts[0], "11 of the 100 files of the last run were removed")
+		assert.Contains(t, s.Status().MassChange, "removed")
+		assert.False(t, s.Paused())
+	})
+
+	t.Run("pauses the run when asked to", func(t *testing.T) {
+		alerts = nil
+		s, d := newDetector(true)
+		for i := 0; i <= 10; i++ {
+			d.fileChanged()
+		}
+		assert.True(t, s.Paused())
+		require.Len(t, alerts, 1)
+		assert.Contains(t, alerts[0], "gui-sync resume")
+	})
+
+	t.Run("nil detector", func(t *testing.T) {
+		var d *massChangeDetector
+		d.fileChanged()
+		d.fileRemoved()
+	})
+}
@@ -0,0 +1,79 @@
+package sync
+
+import (
+	"sync"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Multipart uploads of files read each part straight from the file, so
+// only streamed uploads (Put from a pipe) hold parts in memory, partSize
+// bytes each. Config.MemoryLimit bounds those buffers across every upload
+// of a Syncer and its replicas, for NAS boxes and single-board computers
+// with 1GB of memory or less.
+
+// ParseMemoryLimit parses a memory budget such as "256M" or "1G"; K, M and
+// G are powers of 1024. The budget must hold at least one part.
+func ParseMemoryLimit(value string) (int64, error) {
+	limit, ok := parseBytes(value)
+	if !ok {
+		return 0, i18n.Errorf("memory.invalid", value)
+	}
+	if limit < partSize {
+		return 0, i18n.Errorf("memory.too_small", value, partSize>>20)
+	}
+	return limit, nil
+}
+
+// bufferPool hands out the partSize buffers of streamed uploads, reusing
+// the ones given back. With a limit, at most limit/partSize buffers are out
+// at once and get blocks until one is given back.
+type bufferPool struct {
+	// slots holds a token per buffer out; nil without a limit.
+	slots chan struct{}
+
+	mu   sync.Mutex
+	free [][]byte
+}
+
+func newBufferPool(limit int64) *bufferPool {
+	p := &bufferPool{}
+	if limit > 0 {
+		p.slots = make(chan struct{}, max(1, limit/partSize))
+	}
+	return p
+}
+
+// get returns a buffer of partSize bytes. A nil pool allocates a new one.
+func (p *bufferPool) get() []byte {
+	if p == nil {
+		return make([]byte, partSize)
+	}
+	if p.slots != nil {
+		p.slots <- struct{}{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n := len(p.free); n > 0 {
+		buf := p.free[n-1]
+		p.free = p.free[:n-1]
+		return buf
+	}
+	return make([]byte, partSize)
+}
+
+// put gives back a buffer returned by get. Without a limit, only the
+// buffers of one upload are kept for reuse.
+func (p *bufferPool) put(buf []byte) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	if p.slots != nil || len(p.free) < partConcurrency {
+		p.free = append(p.free, buf)
+	}
+	p.mu.Unlock()
+	if p.slots != nil {
+		<-p.slots
+	}
+}
@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: memory budget of streamed uploads
+func TestParseMemoryLimit(t *testing.T) {
+	for value, want := range map[string]int64{"50M": partSize, "256MB": 256 << 20, "1g": 1 << 30} {
+		limit, err := ParseMemoryLimit(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, limit, value)
+	}
+	for value, id := range map[string]string{"": "memory.invalid", "muito": "memory.invalid", "-1G": "memory.invalid", "10M": "memory.too_small"} {
+		_, err := ParseMemoryLimit(value)
+		assert.Equal(t, id, i18n.ID(err), value)
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	pool := newBufferPool(2*partSize + partSize/2)
+	a, b := pool.get(), pool.get()
+	require.Len(t, a, partSize)
+
+	got := make(chan []byte)
+	go func() { got <- pool.get() }()
+	select {
+	case <-got:
+		t.Fatal("a third buffer was handed out beyond the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	pool.put(a)
+	c := <-got
+	assert.Same(t, &a[0], &c[0], "buffers given back are reused")
+	pool.put(b)
+	pool.put(c)
+
+	var unlimited *bufferPool
+	assert.Len(t, unlimited.get(), partSize)
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestStreamUploadMemoryLimit(t *testing.T) {
+	client := new(mockS3Client)
+	client.On("CreateMultipartUpload", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil).Once()
+
+	var uploading, most int32
+	client.On("UploadPart", mock.Anything).Run(func(mock.Arguments) {
+		n := atomic.AddInt32(&uploading, 1)
+		defer atomic.AddInt32(&uploading, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}).Return(&s3.UploadPartOutput{ETag: aws.String(`"etag"`)}, nil).Times(4)
+	client.On("CompleteMultipartUpload", mock.MatchedBy(func(input *s3.CompleteMultipartUploadInput) bool {
+		return len(input.MultipartUpload.Parts) == 4
+	})).Return(&s3.CompleteMultipartUploadOutput{}, nil).Once()
+
+	s := newTestSyncer(t, client)
+	s.buffers = newBufferPool(partSize)
+	size, err := s.streamUpload("big.bin", io.LimitReader(zeroReader{}, 3*partSize+10), UploadOptions{})
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+
+	assert.Equal(t, int64(3*partSize+10), size)
+	assert.Equal(t, int32(1), most, "a budget of one part uploads one part at a time")
+	assert.Len(t, s.buffers.free, 1, "the buffer is given back once the upload ends")
+}
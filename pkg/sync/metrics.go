@@ -0,0 +1,76 @@
+package sync
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// metricsTimeout bounds PutMetricData, so an unreachable CloudWatch does not
+// hold the next run.
+const metricsTimeout = 30 * time.Second
+
+// runMetrics converts the outcome of a run into the CloudWatch metrics
+// published under Config.MetricsNamespace. Every datum carries the Bucket
+// and Host dimensions. LastSuccessTimestamp is only sent by successful runs,
+// so alarms on it (or on Success) catch backups that stopped succeeding.
+func (s *Syncer) runMetrics(summary RunSummary, runErr error, now time.Time) []*cloudwatch.MetricDatum {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	dimensions := []*cloudwatch.Dimension{
+		{Name: aws.String("Bucket"), Value: aws.String(s.cfg.Bucket)},
+		{Name: aws.String("Host"), Value: aws.String(host)},
+	}
+
+	success := 1.0
+	if runErr != nil {
+		success = 0
+	}
+	datum := func(name string, value float64, unit string) *cloudwatch.MetricDatum {
+		return &cloudwatch.MetricDatum{
+			MetricName: aws.String(name),
+			Dimensions: dimensions,
+			Timestamp:  aws.Time(now),
+			Value:      aws.Float64(value),
+			Unit:       aws.String(unit),
+		}
+	}
+
+	data := []*cloudwatch.MetricDatum{
+		datum("BytesUploaded", float64(summary.BytesUploaded), cloudwatch.StandardUnitBytes),
+		datum("FilesUploaded", float64(summary.Uploaded), cloudwatch.StandardUnitCount),
+		datum("Errors", float64(summary.Failed+summary.Unreadable), cloudwatch.StandardUnitCount),
+		datum("Duration", summary.DurationSecs, cloudwatch.StandardUnitSeconds),
+		datum("Success", success, cloudwatch.StandardUnitCount),
+	}
+	if runErr == nil {
+		data = append(data, datum("LastSuccessTimestamp", float64(now.Unix()), cloudwatch.StandardUnitSeconds))
+	}
+	return data
+}
+
+// publishMetrics sends the metrics of the run that just finished. Failures
+// are logged: they never fail the run.
+func (s *Syncer) publishMetrics(ctx context.Context, runErr error) {
+	if s.cfg.MetricsNamespace == "" || s.metrics == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), metricsTimeout)
+	defer cancel()
+
+	_, err := s.metrics.PutMetricDataWithContext(ctx, &cloudwatch.PutMetricDataInput{
+		Namespace:  aws.String(s.cfg.MetricsNamespace),
+		MetricData: s.runMetrics(s.stats.summary(), runErr, time.Now()),
+	})
+	if err != nil {
+		log.Printf(i18n.T("metrics.publish_failed"), s.cfg.MetricsNamespace, err)
+	}
+}
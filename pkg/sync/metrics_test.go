@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockCloudWatchClient struct {
+	cloudwatchiface.CloudWatchAPI
+	mock.Mock
+}
+
+func (m *mockCloudWatchClient) PutMetricDataWithContext(ctx aws.Context, input *cloudwatch.PutMetricDataInput, opts ...request.Option) (*cloudwatch.PutMetricDataOutput, error) {
+	args := m.MethodCalled("PutMetricData", input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*cloudwatch.PutMetricDataOutput), args.Error(1)
+}
+
+// metricValues indexes the data of a PutMetricData call by metric name.
+func metricValues(t *testing.T, input *cloudwatch.PutMetricDataInput) map[string]float64 {
+	values := make(map[string]float64)
+	for _, datum := range input.MetricData {
+		require.Len(t, datum.Dimensions, 2)
+		assert.Equal(t, "Bucket", aws.StringValue(datum.Dimensions[0].Name))
+		assert.Equal(t, "test-bucket", aws.StringValue(datum.Dimensions[0].Value))
+		values[aws.StringValue(datum.MetricName)] = aws.Float64Value(datum.Value)
+	}
+	return values
+}
+
+// Test Suite: CloudWatch metrics
+func TestPublishMetrics(t *testing.T) {
+	client := new(mockCloudWatchClient)
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.MetricsNamespace = "GuiSync"
+	s.metrics = client
+	s.stats.reset()
+	s.stats.uploaded.Store(3)
+	s.stats.bytesUploaded.Store(2048)
+	s.stats.failed.Store(1)
+	s.stats.unreadable.Store(1)
+
+	var input *cloudwatch.PutMetricDataInput
+	client.On("PutMetricData", mock.Anything).Run(func(args mock.Arguments) {
+		input = args.Get(0).(*cloudwatch.PutMetricDataInput)
+	}).Return(&cloudwatch.PutMetricDataOutput{}, nil)
+
+	t.Run("successful run", func(t *testing.T) {
+		s.publishMetrics(context.Background(), nil)
+
+		require.NotNil(t, input)
+		assert.Equal(t, "GuiSync", aws.StringValue(input.Namespace))
+		values := metricValues(t, input)
+		assert.Equal(t, 2048.0, values["BytesUploaded"])
+		assert.Equal(t, 3.0, values["FilesUploaded"])
+		assert.Equal(t, 2.0, values["Errors"])
+		assert.Equal(t, 1.0, values["Success"])
+		assert.Contains(t, values, "Duration")
+		assert.Positive(t, values["LastSuccessTimestamp"])
+	})
+
+	t.Run("failed run has no success timestamp", func(t *testing.T) {
+		input = nil
+		s.publishMetrics(context.Background(), errors.New("access denied"))
+
+		require.NotNil(t, input)
+		values := metricValues(t, input)
+		assert.Equal(t, 0.0, values["Success"])
+		assert.NotContains(t, values, "LastSuccessTimestamp")
+	})
+
+	t.Run("publish failure does not panic", func(t *testing.T) {
+		failing := new(mockCloudWatchClient)
+		failing.On("PutMetricData", mock.Anything).Return(nil, errors.New("throttled")).Once()
+		s.metrics = failing
+		defer func() { s.metrics = client }()
+
+		s.publishMetrics(context.Background(), nil)
+		failing.AssertExpectations(t)
+	})
+}
+
+func TestPublishMetricsDisabled(t *testing.T) {
+	client := new(mockCloudWatchClient)
+	s := newTestSyncer(t, new(mockS3Client))
+	s.metrics = client
+
+	s.publishMetrics(context.Background(), nil)
+	client.AssertNotCalled(t, "PutMetricData", mock.Anything)
+}
+
+func TestNewMetricsClient(t *testing.T) {
+	client := new(mockCloudWatchClient)
+	s, err := New(Config{
+		Bucket:           "test-bucket",
+		Client:           new(mockS3Client),
+		StateDir:         t.TempDir(),
+		MetricsNamespace: "GuiSync",
+		MetricsClient:    client,
+	})
+	require.NoError(t, err)
+	assert.Same(t, client, s.metrics)
+
+	_, err = New(Config{Bucket: "test-bucket", Client: new(mockS3Client), StateDir: t.TempDir(), MetricsNamespace: "GuiSync"})
+	assert.Equal(t, "syncer.empty_region", i18n.ID(err))
+}
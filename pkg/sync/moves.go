@@ -0,0 +1,182 @@
+package sync
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// A file moved or renamed locally used to be uploaded again under its new
+// key, and its old object deleted. With Config.DetectMoves the syncer keeps,
+// between runs, the contents of the objects it synced (the object index).
+// A file whose size and hash match an object whose file is gone from its
+// path is created as a copy of that object within S3; the deleter then
+// removes the old object, as Config.Delete allows. Config.Dedup looks up
+// the index too, for contents synced by earlier runs.
+
+// objectIndexFile is the layout of the object index state file.
+type objectIndexFile struct {
+	formatHeader
+
+	Bucket  string                   `json:"bucket"`
+	Objects map[string]indexedObject `json:"objects"`
+}
+
+// indexedObject is the content of an object: its hash, as
+// "algorithm:digest", and the size of its file.
+type indexedObject struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// objectIndex is the object index during a run. A nil index ignores every
+// call.
+type objectIndex struct {
+	path   string
+	bucket string
+	// root is where the run reads the files, to tell moved files from
+	// copied ones.
+	root string
+
+	mu      sync.Mutex
+	objects map[string]indexedObject
+	// keys lists the keys of each content.
+	keys map[indexedObject][]string
+}
+
+func (s *Syncer) objectIndexPath() string {
+	sum := sha1.Sum([]byte(s.cfg.Bucket))
+	return s.statePath("objects", fmt.Sprintf("%x.json", sum))
+}
+
+// loadObjectIndex returns the object index of the bucket for a run reading
+// the files below root, or nil without Config.DetectMoves and Config.Dedup.
+// A missing or unreadable index starts empty.
+func (s *Syncer) loadObjectIndex(root string) *objectIndex {
+	if !s.cfg.DetectMoves && !s.cfg.Dedup {
+		return nil
+	}
+	x := &objectIndex{
+		path:    s.objectIndexPath(),
+		bucket:  s.cfg.Bucket,
+		root:    root,
+		objects: make(map[string]indexedObject),
+		keys:    make(map[indexedObject][]string),
+	}
+	var file objectIndexFile
+	if err := readStateFile(x.path, &file); err == nil && file.Bucket == s.cfg.Bucket {
+		for key, object := range file.Objects {
+			x.set(key, object)
+		}
+	}
+	return x
+}
+
+// set records that the object at key holds object.
+func (x *objectIndex) set(key string, object indexedObject) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if previous, ok := x.objects[key]; ok {
+		if previous == object {
+			return
+		}
+		x.drop(key, previous)
+	}
+	x.objects[key] = object
+	x.keys[object] = append(x.keys[object], key)
+}
+
+// remove forgets the object at key, deleted or replaced by one whose
+// contents are not indexed.
+func (x *objectIndex) remove(key string) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if previous, ok := x.objects[key]; ok {
+		delete(x.objects, key)
+		x.drop(key, previous)
+	}
+}
+
+func (x *objectIndex) drop(key string, object indexedObject) {
+	keys := slices.DeleteFunc(x.keys[object], func(k string) bool { return k == key })
+	if len(keys) == 0 {
+		delete(x.keys, object)
+	} else {
+		x.keys[object] = keys
+	}
+}
+
+// lookup returns the keys of the objects holding object.
+func (x *objectIndex) lookup(object indexedObject) []string {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return slices.Clone(x.keys[object])
+}
+
+// save writes the index for the next run.
+func (x *objectIndex) save() {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err := writeStateFile(x.path, &objectIndexFile{Bucket: x.bucket, Objects: x.objects}); err != nil {
+		log.Printf(i18n.T("moves.save_failed"), err)
+	}
+}
+
+// indexObject records the content of the object at key, found up to date
+// on S3 or just uploaded.
+func (s *Syncer) indexObject(key, algorithm, digest string, size int64) {
+	if digest == "" {
+		s.objects.remove(key)
+		return
+	}
+	s.objects.set(key, indexedObject{Hash: algorithm + ":" + digest, Size: size})
+}
+
+// movedFrom returns the key of an object with the contents of the file
+// uploaded to s3Key whose own file no longer exists: the file was moved
+// there.
+func (s *Syncer) movedFrom(s3Key, digest string, size int64) (string, bool) {
+	if !s.cfg.DetectMoves || digest == "" {
+		return "", false
+	}
+	for _, key := range s.objects.lookup(indexedObject{Hash: s.hashAlgorithm() + ":" + digest, Size: size}) {
+		if key == s3Key {
+			continue
+		}
+		path := filepath.Join(s.objects.root, filepath.FromSlash(s.localName(key)))
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// copyMoved creates s3Key as a copy of source, the object of the file at
+// path before it was moved.
+func (s *Syncer) copyMoved(s3Key, source, path string, info os.FileInfo, meta *objectMeta, digest string) error {
+	if err := s.copyObjectFrom(s3Key, source, path, info, meta, digest); err != nil {
+		return err
+	}
+	s.stats.moved.Add(1)
+	s.stats.bytesMoved.Add(info.Size())
+	fmt.Printf(i18n.T("moves.copied"), s3Key, source)
+	return nil
+}
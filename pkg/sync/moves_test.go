@@ -0,0 +1,110 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: copies of the objects of moved files
+func TestMovedFileCopiedWithinS3(t *testing.T) {
+	tempDir := t.TempDir()
+	path := createTempFile(t, tempDir, "fotos/praia.jpg", "mesmo conteúdo")
+	size := int64(len("mesmo conteúdo"))
+
+	mockClient := new(mockS3Client)
+	mockClient.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+	mockClient.On("CopyObject", mock.MatchedBy(func(input *s3.CopyObjectInput) bool {
+		return *input.Key == "2024/praia.jpg" && *input.CopySource == "test-bucket/fotos/praia.jpg"
+	})).Return(&s3.CopyObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	s.cfg.DetectMoves = true
+	s.objects = s.loadObjectIndex(tempDir)
+	_, err := s.uploadFileS3("fotos/praia.jpg", path, size)
+	require.NoError(t, err)
+	s.objects.save()
+
+	// The next run finds the file under another name.
+	moved := filepath.Join(tempDir, "2024", "praia.jpg")
+	require.NoError(t, os.MkdirAll(filepath.Dir(moved), 0755))
+	require.NoError(t, os.Rename(path, moved))
+	s.objects = s.loadObjectIndex(tempDir)
+	uploaded, err := s.uploadFileS3("2024/praia.jpg", moved, size)
+	require.NoError(t, err)
+	assert.Zero(t, uploaded, "moved files send no bytes")
+
+	mockClient.AssertExpectations(t)
+	summary := s.stats.summary()
+	assert.Equal(t, int64(1), summary.Moved)
+	assert.Equal(t, size, summary.BytesMoved)
+	assert.ElementsMatch(t, []string{"fotos/praia.jpg", "2024/praia.jpg"}, s.objects.lookup(indexedObject{Hash: HashMD5 + ":" + mustHash(t, moved), Size: size}))
+}
+
+func TestCopiedFileUploaded(t *testing.T) {
+	tempDir := t.TempDir()
+	original := createTempFile(t, tempDir, "a.txt", "conteúdo")
+	copied := createTempFile(t, tempDir, "b.txt", "conteúdo")
+
+	mockClient := new(mockS3Client)
+	mockClient.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Twice()
+
+	s := newTestSyncer(t, mockClient)
+	s.cfg.DetectMoves = true
+	s.objects = s.loadObjectIndex(tempDir)
+	for key, path := range map[string]string{"a.txt": original, "b.txt": copied} {
+		_, err := s.uploadFileS3(key, path, 9)
+		require.NoError(t, err)
+	}
+
+	mockClient.AssertNotCalled(t, "CopyObject", mock.Anything)
+	assert.Zero(t, s.stats.summary().Moved)
+}
+
+func TestMovedFileUploadedWhenCopyFails(t *testing.T) {
+	tempDir := t.TempDir()
+	path := createTempFile(t, tempDir, "b.txt", "conteúdo")
+
+	mockClient := new(mockS3Client)
+	mockClient.On("CopyObject", mock.Anything).Return(nil, awserr.New(s3.ErrCodeNoSuchKey, "gone", nil)).Once()
+	mockClient.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	s.cfg.DetectMoves = true
+	s.objects = s.loadObjectIndex(tempDir)
+	s.objects.set("a.txt", indexedObject{Hash: HashMD5 + ":" + mustHash(t, path), Size: 9})
+
+	uploaded, err := s.uploadFileS3("b.txt", path, 9)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), uploaded)
+	mockClient.AssertExpectations(t)
+}
+
+func TestObjectIndexForgetsDeletedObjects(t *testing.T) {
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(
+		&s3.ListObjectsV2Output{Contents: []*s3.Object{{Key: aws.String("old.txt")}}}, nil).Once()
+	mockClient.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	s.cfg.DetectMoves = true
+	s.objects = s.loadObjectIndex(t.TempDir())
+	object := indexedObject{Hash: "md5:abc", Size: 3}
+	s.objects.set("old.txt", object)
+
+	require.NoError(t, (&deleter{syncer: s}).run(keysOf()))
+	assert.Empty(t, s.objects.lookup(object))
+}
+
+func mustHash(t *testing.T, path string) string {
+	digest, err := fileContentHash(HashMD5, path)
+	require.NoError(t, err)
+	return digest
+}
@@ -0,0 +1,195 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// macOS names files in decomposed form (NFD), "é" being "e" followed by a
+// combining accent, while Windows and Linux use the composed form (NFC).
+// Keys are always NFC, so the same file has the same key whichever system
+// uploads it, instead of looking changed on every run or appearing twice in
+// the bucket. The tables of nfc_tables.go hold the canonical compositions;
+// composition exclusions and singleton decompositions, absent from file
+// names in practice, are left as they are.
+
+// combiningRange is a run of runes with the same canonical combining class.
+type combiningRange struct {
+	lo, hi rune
+	class  uint8
+}
+
+// Hangul syllables compose and decompose algorithmically.
+const (
+	hangulBase   = 0xAC00
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11A7
+	hangulVCount = 21
+	hangulTCount = 28
+	hangulCount  = 19 * hangulVCount * hangulTCount
+)
+
+var (
+	decompositionsOnce sync.Once
+	decompositions     map[rune][2]rune
+)
+
+// nfc returns s in Unicode Normalization Form C. Strings with no rune from
+// U+0300 on, and invalid UTF-8, are returned as they are.
+func nfc(s string) string {
+	if !needsNormalizing(s) {
+		return s
+	}
+
+	runes := decomposed(s)
+	out := make([]rune, 0, len(runes))
+	starter := -1
+	var lastClass uint8
+	for _, r := range runes {
+		class := combiningClass(r)
+		if starter >= 0 {
+			// A rune is blocked from the starter by a rune between them
+			// of the same or a higher class, or by another starter.
+			blocked := len(out)-1 != starter && (lastClass == 0 || lastClass >= class)
+			if composed, ok := compose(out[starter], r); ok && !blocked {
+				out[starter] = composed
+				continue
+			}
+		}
+		if class == 0 {
+			starter = len(out)
+		}
+		out = append(out, r)
+		lastClass = class
+	}
+	return string(out)
+}
+
+// nfd returns s in Unicode Normalization Form D, the form of macOS.
+func nfd(s string) string {
+	if isASCII(s) || !utf8.ValidString(s) {
+		return s
+	}
+	return string(decomposed(s))
+}
+
+// decomposed returns the runes of s decomposed and in canonical order.
+func decomposed(s string) []rune {
+	var runes []rune
+	for _, r := range s {
+		runes = decompose(runes, r)
+	}
+
+	// Canonical ordering: marks after a starter sorted by combining class.
+	for i := 1; i < len(runes); i++ {
+		for j := i; j > 0; j-- {
+			prev, class := combiningClass(runes[j-1]), combiningClass(runes[j])
+			if class == 0 || prev <= class {
+				break
+			}
+			runes[j-1], runes[j] = runes[j], runes[j-1]
+		}
+	}
+	return runes
+}
+
+// needsNormalizing reports whether s holds valid UTF-8 with a rune nfc may
+// change: combining marks start at U+0300.
+func needsNormalizing(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			if !utf8.ValidString(s) {
+				return false
+			}
+			for _, r := range s[i:] {
+				if r >= 0x300 {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
+
+// decompose appends the canonical decomposition of r to runes.
+func decompose(runes []rune, r rune) []rune {
+	if r >= hangulBase && r < hangulBase+hangulCount {
+		index := r - hangulBase
+		runes = append(runes, hangulLBase+index/(hangulVCount*hangulTCount), hangulVBase+(index%(hangulVCount*hangulTCount))/hangulTCount)
+		if t := index % hangulTCount; t != 0 {
+			runes = append(runes, hangulTBase+t)
+		}
+		return runes
+	}
+
+	decompositionsOnce.Do(func() {
+		decompositions = make(map[rune][2]rune, len(nfcCompositions))
+		for pair, composed := range nfcCompositions {
+			decompositions[composed] = pair
+		}
+	})
+	if pair, ok := decompositions[r]; ok {
+		return append(decompose(runes, pair[0]), pair[1])
+	}
+	return append(runes, r)
+}
+
+// compose returns the canonical composition of a and b, if they have one.
+func compose(a, b rune) (rune, bool) {
+	if a >= hangulLBase && a < hangulLBase+19 && b >= hangulVBase && b < hangulVBase+hangulVCount {
+		return hangulBase + ((a-hangulLBase)*hangulVCount+b-hangulVBase)*hangulTCount, true
+	}
+	if a >= hangulBase && a < hangulBase+hangulCount && (a-hangulBase)%hangulTCount == 0 && b > hangulTBase && b < hangulTBase+hangulTCount {
+		return a + b - hangulTBase, true
+	}
+	composed, ok := nfcCompositions[[2]rune{a, b}]
+	return composed, ok
+}
+
+// combiningClass returns the canonical combining class of r, 0 for starters.
+func combiningClass(r rune) uint8 {
+	if r < 0x300 {
+		return 0
+	}
+	i := sort.Search(len(combiningClasses), func(i int) bool { return combiningClasses[i].hi >= r })
+	if i < len(combiningClasses) && combiningClasses[i].lo <= r {
+		return combiningClasses[i].class
+	}
+	return 0
+}
+
+// existingPath returns the path rel names below dir, with each name that
+// is missing there but exists in decomposed form replaced by that form, so
+// that restores write over the files named by macOS on other systems
+// instead of beside them.
+func existingPath(dir, rel string) string {
+	for _, name := range strings.Split(filepath.ToSlash(rel), "/") {
+		path := filepath.Join(dir, name)
+		if !isASCII(name) {
+			if _, err := os.Lstat(path); os.IsNotExist(err) {
+				if other := filepath.Join(dir, nfd(name)); other != path {
+					if _, err := os.Lstat(other); err == nil {
+						path = other
+					}
+				}
+			}
+		}
+		dir = path
+	}
+	return dir
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: Unicode normalization of keys
+func TestNFC(t *testing.T) {
+	for input, want := range map[string]string{
+		"relato\u0301rio.txt":       "relatório.txt",
+		"Ac\u0327a\u0303o/nota.txt": "Ação/nota.txt",
+		"e\u0323\u0302":             "ệ",
+		"e\u0302\u0323":             "ệ",
+		"ê\u0323":                   "ệ",
+		"\u1100\u1161\u11a8":        "각",
+		"か\u3099":                   "が",
+		"j\u0301":                   "j\u0301", // no composed form
+		"plain/ascii.txt":           "plain/ascii.txt",
+		"já composto":               "já composto",
+		"\xff\xfe invalid":          "\xff\xfe invalid",
+	} {
+		assert.Equal(t, want, nfc(input), "%+q", input)
+	}
+
+	assert.Equal(t, "relato\u0301rio.txt", nfd("relatório.txt"))
+	assert.Equal(t, "e\u0323\u0302", nfd("ệ"))
+	assert.Equal(t, "\u1100\u1161\u11a8", nfd("각"))
+	assert.Equal(t, "\xff invalid", nfd("\xff invalid"))
+}
+
+func TestDecomposedNamesKeys(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("APFS and HFS+ may not keep the decomposed name given")
+	}
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "Ac\u0327a\u0303o/relato\u0301rio.txt", "a")
+
+	var keys []string
+	require.NoError(t, walkFiles(tempDir, "", func(path, relPath string, info os.FileInfo) error {
+		keys = append(keys, relPath)
+		return nil
+	}))
+	assert.Equal(t, []string{"Ação/relatório.txt"}, keys)
+
+	t.Run("restores over the decomposed names", func(t *testing.T) {
+		localPath, err := restorePath(tempDir, "Ação/relatório.txt")
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(tempDir, "Ac\u0327a\u0303o", "relato\u0301rio.txt"), localPath)
+
+		localPath, err = restorePath(tempDir, "Ação/nova.txt")
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(tempDir, "Ac\u0327a\u0303o", "nova.txt"), localPath)
+
+		localPath, err = restorePath(tempDir, "Relação/nova.txt")
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(tempDir, "Relação", "nova.txt"), localPath)
+	})
+
+	t.Run("selects decomposed paths", func(t *testing.T) {
+		sel := RestoreSelection{Paths: []string{"Ac\u0327a\u0303o"}}
+		assert.True(t, sel.selects("Ação/relatório.txt"))
+	})
+}
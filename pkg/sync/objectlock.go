@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Buckets created with Object Lock keep every version written with a
+// retention (WORM) until its retain-until date: in COMPLIANCE mode nobody can
+// delete or shorten it, in GOVERNANCE mode only those allowed to bypass it.
+// Deleting a key without a version only adds a delete marker, so the locked
+// versions stay restorable with restore --as-of.
+
+// errCodeObjectLockNotFound is returned by GetObjectLockConfiguration for
+// buckets created without Object Lock.
+const errCodeObjectLockNotFound = "ObjectLockConfigurationNotFoundError"
+
+// validateObjectLock checks a retention mode and period given together:
+// both empty, or a mode of S3 with a positive number of days.
+func validateObjectLock(mode string, days int) error {
+	if mode == "" && days == 0 {
+		return nil
+	}
+	if mode != s3.ObjectLockModeGovernance && mode != s3.ObjectLockModeCompliance {
+		if mode == "" {
+			return i18n.Errorf("objectlock.incomplete")
+		}
+		return i18n.Errorf("objectlock.invalid_mode", mode, s3.ObjectLockModeGovernance, s3.ObjectLockModeCompliance)
+	}
+	if days <= 0 {
+		return i18n.Errorf("objectlock.incomplete")
+	}
+	return nil
+}
+
+// objectRetention is the Object Lock retention given to an upload. The zero
+// value leaves uploads unlocked.
+type objectRetention struct {
+	mode  *string
+	until *time.Time
+}
+
+func newObjectRetention(mode string, days int) objectRetention {
+	if mode == "" || days <= 0 {
+		return objectRetention{}
+	}
+	return objectRetention{mode: aws.String(mode), until: aws.Time(time.Now().AddDate(0, 0, days).UTC())}
+}
+
+// retention returns the retention of an upload with the settings meta:
+// those of its sidecar or rules, or else those of Config.
+func (s *Syncer) retention(meta *objectMeta) objectRetention {
+	if meta != nil && meta.ObjectLockMode != "" {
+		return newObjectRetention(meta.ObjectLockMode, meta.ObjectLockDays)
+	}
+	return newObjectRetention(s.cfg.ObjectLockMode, s.cfg.ObjectLockDays)
+}
+
+func (r objectRetention) applyPut(input *s3.PutObjectInput) {
+	input.ObjectLockMode, input.ObjectLockRetainUntilDate = r.mode, r.until
+}
+
+func (r objectRetention) applyMultipart(input *s3.CreateMultipartUploadInput) {
+	input.ObjectLockMode, input.ObjectLockRetainUntilDate = r.mode, r.until
+}
+
+func (r objectRetention) applyCopy(input *s3.CopyObjectInput) {
+	input.ObjectLockMode, input.ObjectLockRetainUntilDate = r.mode, r.until
+}
+
+// checkObjectLock fails when Config.ObjectLockMode is set on a bucket
+// without Object Lock, whose uploads S3 would refuse one by one.
+func (s *Syncer) checkObjectLock() error {
+	if s.cfg.ObjectLockMode == "" {
+		return nil
+	}
+	output, err := s.client.GetObjectLockConfiguration(&s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(s.cfg.Bucket),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodeObjectLockNotFound {
+			return i18n.Errorf("objectlock.not_enabled", s.cfg.Bucket)
+		}
+		return i18n.Errorf("objectlock.check_failed", err)
+	}
+	if output.ObjectLockConfiguration == nil || aws.StringValue(output.ObjectLockConfiguration.ObjectLockEnabled) != s3.ObjectLockEnabledEnabled {
+		return i18n.Errorf("objectlock.not_enabled", s.cfg.Bucket)
+	}
+	return nil
+}
+
+// isLockedError reports whether a deletion was refused because the version
+// is under an Object Lock retention or legal hold.
+func isLockedError(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == "AccessDenied" && strings.Contains(strings.ToLower(aerr.Message()), "object lock")
+}
+
+// LockedVersion is a version prune could not delete because of Object Lock.
+type LockedVersion struct {
+	ObjectVersion
+	// Mode and RetainUntil are the retention of the version, empty and zero
+	// when it has none or it could not be read; LegalHold is set when a
+	// legal hold keeps it regardless of the retention.
+	Mode        string
+	RetainUntil time.Time
+	LegalHold   bool
+}
+
+// lockOf reads why v is locked. Errors leave the fields empty: the version
+// is reported as locked either way.
+func (s *Syncer) lockOf(v ObjectVersion) LockedVersion {
+	locked := LockedVersion{ObjectVersion: v}
+	retention, err := s.client.GetObjectRetention(&s3.GetObjectRetentionInput{
+		Bucket:    aws.String(s.cfg.Bucket),
+		Key:       aws.String(v.Key),
+		VersionId: aws.String(v.VersionID),
+	})
+	if err == nil && retention.Retention != nil {
+		locked.Mode = aws.StringValue(retention.Retention.Mode)
+		locked.RetainUntil = aws.TimeValue(retention.Retention.RetainUntilDate)
+	}
+	hold, err := s.client.GetObjectLegalHold(&s3.GetObjectLegalHoldInput{
+		Bucket:    aws.String(s.cfg.Bucket),
+		Key:       aws.String(v.Key),
+		VersionId: aws.String(v.VersionID),
+	})
+	if err == nil && hold.LegalHold != nil {
+		locked.LegalHold = aws.StringValue(hold.LegalHold.Status) == s3.ObjectLockLegalHoldStatusOn
+	}
+	return locked
+}
@@ -0,0 +1,140 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// lockedErr is what S3 answers to the deletion of a locked version.
+var lockedErr = awserr.New("AccessDenied", "Access Denied because object protected by object lock.", nil)
+
+// Test Suite: Object Lock
+func TestValidateObjectLock(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		days   int
+		wantID string
+	}{
+		{"disabled", "", 0, ""},
+		{"governance", s3.ObjectLockModeGovernance, 30, ""},
+		{"compliance", s3.ObjectLockModeCompliance, 365, ""},
+		{"unknown mode", "WORM", 30, "objectlock.invalid_mode"},
+		{"mode without days", s3.ObjectLockModeCompliance, 0, "objectlock.incomplete"},
+		{"days without mode", "", 30, "objectlock.incomplete"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateObjectLock(tt.mode, tt.days)
+			if tt.wantID == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, tt.wantID, i18n.ID(err))
+			}
+		})
+	}
+}
+
+func TestUploadWithObjectLock(t *testing.T) {
+	tempDir := t.TempDir()
+	path := createTempFile(t, tempDir, "a.txt", "a")
+	contract := createTempFile(t, tempDir, "contract.pdf", "pdf")
+	createTempFile(t, tempDir, "contract.pdf.meta.json", `{"object_lock_mode": "COMPLIANCE", "object_lock_days": 3650}`)
+
+	lockedFor := func(mode string, days int) interface{} {
+		return mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+			until := time.Now().AddDate(0, 0, days)
+			return aws.StringValue(input.ObjectLockMode) == mode &&
+				input.ObjectLockRetainUntilDate != nil &&
+				input.ObjectLockRetainUntilDate.Sub(until).Abs() < time.Minute
+		})
+	}
+	client := new(mockS3Client)
+	client.On("PutObject", lockedFor(s3.ObjectLockModeGovernance, 30)).Return(&s3.PutObjectOutput{}, nil).Once()
+	client.On("PutObject", lockedFor(s3.ObjectLockModeCompliance, 3650)).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, client)
+	s.cfg.ObjectLockMode, s.cfg.ObjectLockDays = s3.ObjectLockModeGovernance, 30
+	_, err := s.uploadFileS3("a.txt", path, 1)
+	require.NoError(t, err)
+	_, err = s.uploadFileS3("contract.pdf", contract, 3)
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+}
+
+func TestCheckObjectLock(t *testing.T) {
+	t.Run("disabled makes no request", func(t *testing.T) {
+		client := new(mockS3Client)
+		require.NoError(t, newTestSyncer(t, client).checkObjectLock())
+		client.AssertNotCalled(t, "GetObjectLockConfiguration", mock.Anything)
+	})
+
+	t.Run("bucket with Object Lock", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetObjectLockConfiguration", mock.Anything).Return(&s3.GetObjectLockConfigurationOutput{
+			ObjectLockConfiguration: &s3.ObjectLockConfiguration{ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled)},
+		}, nil).Once()
+		s := newTestSyncer(t, client)
+		s.cfg.ObjectLockMode, s.cfg.ObjectLockDays = s3.ObjectLockModeCompliance, 1
+		assert.NoError(t, s.checkObjectLock())
+	})
+
+	t.Run("bucket without Object Lock", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("GetObjectLockConfiguration", mock.Anything).Return(nil, awserr.New(errCodeObjectLockNotFound, "not found", nil)).Once()
+		s := newTestSyncer(t, client)
+		s.cfg.ObjectLockMode, s.cfg.ObjectLockDays = s3.ObjectLockModeCompliance, 1
+		assert.Equal(t, "objectlock.not_enabled", i18n.ID(s.checkObjectLock()))
+	})
+}
+
+func TestDeleterReportsLockedObjects(t *testing.T) {
+	client := new(mockS3Client)
+	client.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		Contents: []*s3.Object{{Key: aws.String("locked.txt")}, {Key: aws.String("old.txt")}},
+	}, nil).Once()
+	client.On("DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+		return *input.Key == "locked.txt"
+	})).Return(nil, lockedErr).Once()
+	client.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, client)
+	result := &SyncResult{}
+	require.NoError(t, (&deleter{syncer: s, result: result}).run(keysOf()))
+	client.AssertExpectations(t)
+
+	require.Len(t, result.Files, 1)
+	assert.Equal(t, StatusLocked, result.Files[0].Status)
+	assert.False(t, result.Files[0].Retriable)
+	assert.NoError(t, result.Err(), "locked objects do not fail the run")
+	assert.Equal(t, int64(1), s.stats.summary().Deleted)
+}
+
+func TestDeleteVersionsReportsLocked(t *testing.T) {
+	until := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	client := new(mockS3Client)
+	client.On("DeleteObject", mock.Anything).Return(nil, lockedErr).Once()
+	client.On("GetObjectRetention", mock.Anything).Return(&s3.GetObjectRetentionOutput{Retention: &s3.ObjectLockRetention{
+		Mode:            aws.String(s3.ObjectLockRetentionModeCompliance),
+		RetainUntilDate: aws.Time(until),
+	}}, nil).Once()
+	client.On("GetObjectLegalHold", mock.Anything).Return(nil, awserr.New("NoSuchObjectLockConfiguration", "no legal hold", nil)).Once()
+
+	deleted, locked, err := newTestSyncer(t, client).DeleteVersions([]ObjectVersion{{Key: "a.txt", VersionID: "a1"}})
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+	assert.Equal(t, []LockedVersion{{
+		ObjectVersion: ObjectVersion{Key: "a.txt", VersionID: "a1"},
+		Mode:          s3.ObjectLockRetentionModeCompliance,
+		RetainUntil:   until,
+	}}, locked)
+	client.AssertExpectations(t)
+}
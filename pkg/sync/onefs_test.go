@@ -0,0 +1,47 @@
+package sync
+
+import (
+	"os"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: walks kept on one file system
+func TestWalkTreeStaysOnFileSystem(t *testing.T) {
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "a.txt", "a")
+	createTempFile(t, tempDir, "docs/b.txt", "b")
+	createTempFile(t, tempDir, "docs/fotos/c.jpg", "c")
+
+	var files, mounts []string
+	err := walkTree(tempDir, "", func(path, relPath string, info os.FileInfo) error {
+		files = append(files, toSlashKey(relPath))
+		return nil
+	}, nil, func(relPath string) { mounts = append(mounts, relPath) })
+	require.NoError(t, err)
+	sort.Strings(files)
+	assert.Equal(t, []string{"a.txt", "docs/b.txt", "docs/fotos/c.jpg"}, files)
+	assert.Empty(t, mounts, "the whole tree is on the file system of the root")
+}
+
+func TestFileDevice(t *testing.T) {
+	info, err := os.Stat(t.TempDir())
+	require.NoError(t, err)
+	_, ok := fileDevice(info)
+	assert.Equal(t, runtime.GOOS != "windows", ok)
+}
+
+func TestMountsSkipped(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	assert.Nil(t, s.mountsSkipped(func(string) {}), "mount points are crossed by default")
+
+	s.cfg.OneFileSystem = true
+	assert.NotNil(t, s.mountsSkipped(nil))
+	var skipped []string
+	s.mountsSkipped(func(relPath string) { skipped = append(skipped, relPath) })("mnt/usb")
+	assert.Equal(t, []string{"mnt/usb"}, skipped)
+}
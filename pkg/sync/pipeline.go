@@ -0,0 +1,197 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// syncDirectoryWithS3 runs the sync pipeline over root:
+//
+//	scanner -> differ -> transfer engine, then deleter
+//
+// The first three stages run concurrently, connected by channels. The
+// deleter runs once uploads finish, using the key set the scanner saw.
+//
+// The returned error is set when a stage could not run at all; files that
+// failed individually are listed in the SyncResult instead.
+func (s *Syncer) syncDirectoryWithS3(ctx context.Context, root string) (*SyncResult, error) {
+	s.stats.reset()
+	if err := s.updateKeyPrefix(time.Now()); err != nil {
+		return &SyncResult{}, err
+	}
+	s.contents.reset()
+	s.digests.reset()
+	s.heads.reset()
+	if s.cfg.GitIgnore {
+		s.gitignore = newGitignoreMatcher(root)
+	}
+	result := &SyncResult{}
+	changed, incremental := s.journalChanges()
+	s.incremental = incremental
+	if incremental && changed == nil {
+		changed = []string{}
+	}
+	s.scan = nil
+	// The scan cache would only learn the directories of the journal.
+	if s.cfg.ScanCache > 0 && s.cfg.FilesFrom == "" && !incremental {
+		cache, err := s.loadScanCache(s.scanCacheKey(root), root)
+		if err != nil {
+			return result, err
+		}
+		s.scan = cache
+	}
+
+	s.objects = s.loadObjectIndex(root)
+	defer s.objects.save()
+
+	s.massChanges = s.newMassChangeDetector(ctx)
+	s.initial = s.openInitialProgress()
+	defer s.initial.close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	scanCtx, stopScan := context.WithCancel(ctx)
+	defer stopScan()
+	s.quota = s.newUploadQuota(ctx, stopScan)
+
+	var keysMu sync.Mutex
+	localKeys := s.localKeySet()
+	defer localKeys.remove()
+	var unreadable, mounts []string
+
+	scan := &scanner{
+		root:      root,
+		filesFrom: s.cfg.FilesFrom,
+		ignore:    s.shouldIgnore,
+		skip: func(relPath string) bool {
+			_, archived := s.archivedDir(relPath)
+			return archived
+		},
+		seen:    localKeys.add,
+		cached:  s.scan.cached,
+		links:   s.newHardLinks(),
+		changed: changed,
+		unreadable: func(relPath string, err error) {
+			keysMu.Lock()
+			unreadable = append(unreadable, relPath)
+			keysMu.Unlock()
+			s.stats.unreadable.Add(1)
+			result.add(FileResult{Key: relPath, Path: filepath.Join(root, filepath.FromSlash(relPath)), Status: StatusUnreadable, Err: err})
+			s.report.add(reportAction{Action: actionUnreadable, Key: relPath, Error: err.Error()})
+			log.Printf(i18n.T("pipeline.unreadable"), relPath, err)
+		},
+		key: func(path, relPath string) (string, error) {
+			return s.localKey(root, path, relPath)
+		},
+		mounted: s.mountsSkipped(func(relPath string) {
+			keysMu.Lock()
+			mounts = append(mounts, s.keyOf(relPath))
+			keysMu.Unlock()
+		}),
+		invalid: func(relPath string, err error) {
+			s.stats.invalidKeys.Add(1)
+			result.add(FileResult{Key: relPath, Path: filepath.Join(root, filepath.FromSlash(relPath)), Status: StatusInvalidKey, Err: err})
+			s.report.add(reportAction{Action: actionInvalidKey, Key: relPath, Error: err.Error()})
+			log.Printf(i18n.T("pipeline.invalid_key"), relPath, err)
+		},
+	}
+	diff := &differ{syncer: s, workers: s.headWorkers()}
+	transfer := &transferEngine{syncer: s, workers: uploadWorkers, result: result}
+
+	entries := make(chan fileEntry, 100)
+	tasks := make(chan uploadTask, 100)
+
+	var wg sync.WaitGroup
+	var scanErr, diffErr error
+
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		scanErr = scan.run(scanCtx, entries)
+		if scanErr != nil {
+			cancel()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		diffErr = diff.run(ctx, entries, tasks)
+		if diffErr != nil {
+			cancel()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		transfer.run(tasks)
+	}()
+	wg.Wait()
+
+	// A failing differ cancels the scanner; report the root cause.
+	if diffErr != nil {
+		return result, diffErr
+	}
+	// A scan ended by the quota is not an error.
+	if scanErr != nil && !(s.quota.tripped() && ctx.Err() == nil) {
+		return result, scanErr
+	}
+
+	if s.cfg.FilesFrom == "" && !s.quota.tripped() {
+		if err := s.syncArchives(root, result, localKeys.add, scan.unreadable); err != nil {
+			return result, err
+		}
+	}
+
+	if s.scan != nil {
+		s.saveScanCache(s.scan)
+	}
+
+	s.retryFailed(ctx, result)
+
+	// Removed files are only deleted once every upload went through.
+	if len(result.Failed()) > 0 {
+		return result, nil
+	}
+
+	if s.cfg.FilesFrom != "" {
+		fmt.Println(i18n.T("pipeline.files_from_no_delete"))
+		return result, nil
+	}
+	// Files the run never saw would be taken for removed ones.
+	if s.quota.tripped() {
+		fmt.Println(i18n.T("pipeline.quota_no_delete"))
+		return result, nil
+	}
+
+	if len(unreadable) > 0 {
+		log.Printf(i18n.T("pipeline.unreadable_kept"), len(unreadable))
+	}
+
+	// Objects of the file systems mounted below root are kept like those of
+	// unreadable directories.
+	kept := mounts
+	for _, relPath := range unreadable {
+		kept = append(kept, s.keyOf(relPath))
+	}
+	var prefixes []string
+	if incremental {
+		prefixes = s.journalPrefixes(root, changed)
+	}
+	if err := (&deleter{syncer: s, workers: deleteWorkers, unreadable: kept, prefixes: prefixes, result: result}).run(localKeys); err != nil {
+		return result, err
+	}
+	s.retryFailed(ctx, result)
+	// The changes are only done with once nothing of them is left to retry.
+	if len(result.Failed()) == 0 {
+		if s.journal != nil {
+			s.journal.commit()
+			s.journalPrefix = s.keyPrefix
+		}
+		s.finishInitialProgress()
+	}
+	return result, nil
+}
@@ -0,0 +1,242 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: pipeline stages
+func TestScannerStage(t *testing.T) {
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "keep.txt", "keep")
+	createTempFile(t, tempDir, "skip.log", "skip")
+	createTempFile(t, tempDir, "sub/nested.txt", "nested")
+
+	var seen []string
+	scan := &scanner{
+		root:   tempDir,
+		ignore: func(relPath string) bool { return relPath == "skip.log" },
+		seen:   func(relPath string) { seen = append(seen, relPath) },
+	}
+
+	out := make(chan fileEntry, 10)
+	require.NoError(t, scan.run(context.Background(), out))
+
+	var emitted []string
+	for entry := range out {
+		emitted = append(emitted, entry.relPath)
+	}
+	sort.Strings(emitted)
+	sort.Strings(seen)
+
+	assert.Equal(t, []string{"keep.txt", "sub/nested.txt"}, emitted)
+	assert.Equal(t, []string{"keep.txt", "skip.log", "sub/nested.txt"}, seen)
+}
+
+func TestScannerStageCancelled(t *testing.T) {
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "a.txt", "a")
+	createTempFile(t, tempDir, "b.txt", "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	out := make(chan fileEntry)
+	err := (&scanner{root: tempDir}).run(ctx, out)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestDifferStage(t *testing.T) {
+	notFound := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")
+
+	t.Run("forward only changed files", func(t *testing.T) {
+		tempDir := t.TempDir()
+		newPath := createTempFile(t, tempDir, "new.txt", "new")
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", mock.Anything).Return(nil, notFound).Once()
+
+		in := make(chan fileEntry, 1)
+		out := make(chan uploadTask, 1)
+		in <- fileEntry{path: newPath, relPath: "new.txt", key: "new.txt", size: 3}
+		close(in)
+
+		err := (&differ{syncer: newTestSyncer(t, mockClient), workers: 2}).run(context.Background(), in, out)
+		require.NoError(t, err)
+
+		task, ok := <-out
+		require.True(t, ok)
+		assert.Equal(t, "new.txt", task.s3Key)
+		_, ok = <-out
+		assert.False(t, ok)
+	})
+
+	t.Run("comparison error stops the stage", func(t *testing.T) {
+		tempDir := t.TempDir()
+		path := createTempFile(t, tempDir, "a.txt", "a")
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", mock.Anything).Return(nil, fmt.Errorf("network down"))
+
+		in := make(chan fileEntry, 2)
+		out := make(chan uploadTask, 2)
+		in <- fileEntry{path: path, relPath: "a.txt", key: "a.txt"}
+		in <- fileEntry{path: path, relPath: "a.txt", key: "a.txt"}
+		close(in)
+
+		err := (&differ{syncer: newTestSyncer(t, mockClient)}).run(context.Background(), in, out)
+		assert.Error(t, err)
+		mockClient.AssertNumberOfCalls(t, "HeadObject", 1)
+	})
+}
+
+func TestTransferSchedule(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	s.rules = []Rule{
+		{Pattern: "*.docx", Priority: PriorityHigh},
+		{Pattern: "*.mp4", Priority: PriorityLow},
+	}
+	engine := &transferEngine{syncer: s}
+
+	in := make(chan uploadTask, 10)
+	for _, key := range []string{"a.mp4", "b.txt", "c.docx", "d.mp4", "e.docx", "f.txt"} {
+		in <- uploadTask{s3Key: key}
+	}
+	close(in)
+
+	out := make(chan uploadTask)
+	go engine.schedule(in, out)
+
+	var order []string
+	for task := range out {
+		order = append(order, task.s3Key)
+	}
+	assert.Equal(t, []string{"c.docx", "e.docx", "b.txt", "f.txt", "a.mp4", "d.mp4"}, order,
+		"queued tasks go out by priority, in arrival order within one")
+}
+
+func TestSyncDirectoryWithS3Pipeline(t *testing.T) {
+	notFound := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")
+
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "new.txt", "new")
+	createTempFile(t, tempDir, "ignored.tmp", "local only")
+
+	mockClient := new(mockS3Client)
+	s := newTestSyncer(t, mockClient)
+	s.ignorePatterns = []string{"ignored.tmp"}
+	mockClient.On("HeadObject", mock.MatchedBy(func(input *s3.HeadObjectInput) bool {
+		return *input.Key == "new.txt"
+	})).Return(nil, notFound).Once()
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return *input.Key == "new.txt"
+	})).Return(&s3.PutObjectOutput{}, nil).Once()
+	mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		Contents: []*s3.Object{
+			{Key: aws.String("new.txt")},
+			{Key: aws.String("ignored.tmp")},
+			{Key: aws.String("gone.txt")},
+		},
+	}, nil).Once()
+	mockClient.On("DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+		return *input.Key == "gone.txt"
+	})).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+	result, err := s.syncDirectoryWithS3(context.Background(), tempDir)
+	assert.NoError(t, err)
+	assert.NoError(t, result.Err())
+	mockClient.AssertExpectations(t)
+
+	summary := s.stats.summary()
+	assert.Equal(t, int64(1), summary.Uploaded)
+	assert.Equal(t, int64(1), summary.Deleted)
+}
+
+func TestDeleterStage(t *testing.T) {
+	var stale []*s3.Object
+	for i := 0; i < 50; i++ {
+		stale = append(stale, &s3.Object{Key: aws.String(fmt.Sprintf("old/%02d.txt", i))})
+	}
+	contents := append([]*s3.Object{{Key: aws.String("keep.txt")}, {Key: aws.String(reservedPrefix + "format")}}, stale...)
+
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{Contents: contents}, nil).Once()
+	mockClient.On("DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+		return *input.Key == "old/07.txt"
+	})).Return(nil, awserr.New("AccessDenied", "Access Denied", nil)).Once()
+	mockClient.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, nil).Times(len(stale) - 1)
+
+	s := newTestSyncer(t, mockClient)
+	s.report = &runReport{}
+	require.NoError(t, (&deleter{syncer: s, workers: 4}).run(keysOf("keep.txt")))
+
+	mockClient.AssertExpectations(t)
+	assert.Equal(t, int64(len(stale)-1), s.stats.summary().Deleted)
+	require.Len(t, s.report.actions, len(stale), "every stale object is reported, including the failed one")
+}
+
+func TestDeleterFailsWhenLocalKeysSpillFailed(t *testing.T) {
+	// A file where the runs go keeps the keys from spilling.
+	blocked := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(blocked, nil, 0600))
+	keys := newKeySet(blocked)
+	keys.limit = 1
+	keys.add("a.txt")
+
+	mockClient := new(mockS3Client)
+	s := newTestSyncer(t, mockClient)
+	goroutines := runtime.NumGoroutine()
+	assert.Error(t, (&deleter{syncer: s, workers: 4}).run(keys))
+	mockClient.AssertNotCalled(t, "ListObjectsV2Pages", mock.Anything, mock.Anything)
+	assert.LessOrEqual(t, runtime.NumGoroutine(), goroutines, "no worker is left waiting for objects")
+}
+
+func TestDeleterKeepsUnreadablePaths(t *testing.T) {
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		Contents: []*s3.Object{
+			{Key: aws.String("locked/a.txt")},
+			{Key: aws.String("locked.txt")},
+			{Key: aws.String("secret.key")},
+		},
+	}, nil).Once()
+	mockClient.On("DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+		return *input.Key == "locked.txt"
+	})).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	d := &deleter{syncer: s, unreadable: []string{"locked", "secret.key"}}
+	require.NoError(t, d.run(keysOf()))
+	mockClient.AssertExpectations(t)
+}
+
+func TestDeleterKeepsIgnoredObjects(t *testing.T) {
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		Contents: []*s3.Object{
+			{Key: aws.String("manual/notes.tmp")},
+			{Key: aws.String("drafts/plan.txt")},
+			{Key: aws.String("old.txt")},
+		},
+	}, nil).Once()
+	mockClient.On("DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+		return *input.Key == "old.txt"
+	})).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	s.ignorePatterns = []string{"notes.tmp", "drafts/plan.txt"}
+	require.NoError(t, (&deleter{syncer: s}).run(keysOf()))
+	mockClient.AssertExpectations(t)
+}
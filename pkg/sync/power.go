@@ -0,0 +1,49 @@
+package sync
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// PowerState describes the power source and network of the machine, as far
+// as the platform lets gui-sync find out. Unknown values are reported as
+// false, so a machine without a battery or metering support never defers.
+type PowerState struct {
+	OnBattery bool
+	Metered   bool
+}
+
+// PowerProbe reads the current PowerState. Config.PowerProbe replaces the
+// platform probe, which is useful in tests and for custom policies.
+type PowerProbe func() (PowerState, error)
+
+// deferReason reports why a scheduled run should wait, or "" when it may
+// start now. Probe failures never block runs.
+func (s *Syncer) deferReason() string {
+	var reasons []string
+	if reason := s.windowReason(time.Now()); reason != "" {
+		reasons = append(reasons, reason)
+	}
+	if !s.cfg.DeferOnBattery && !s.cfg.DeferOnMetered {
+		return strings.Join(reasons, ", ")
+	}
+
+	probe := s.cfg.PowerProbe
+	if probe == nil {
+		probe = detectPowerState
+	}
+	state, err := probe()
+	if err != nil {
+		return strings.Join(reasons, ", ")
+	}
+
+	if s.cfg.DeferOnBattery && state.OnBattery {
+		reasons = append(reasons, i18n.T("power.battery"))
+	}
+	if s.cfg.DeferOnMetered && state.Metered {
+		reasons = append(reasons, i18n.T("power.metered"))
+	}
+	return strings.Join(reasons, ", ")
+}
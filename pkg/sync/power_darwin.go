@@ -0,0 +1,16 @@
+package sync
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// detectPowerState asks pmset for the power source. macOS has no command
+// line view of Low Data Mode, so networks are never reported as metered.
+func detectPowerState() (PowerState, error) {
+	out, err := exec.Command("pmset", "-g", "batt").Output()
+	if err != nil {
+		return PowerState{}, err
+	}
+	return PowerState{OnBattery: strings.Contains(string(out), "'Battery Power'")}, nil
+}
@@ -0,0 +1,49 @@
+package sync
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// detectPowerState reads the power supplies from sysfs and asks
+// NetworkManager, when running, whether the primary connection is metered.
+func detectPowerState() (PowerState, error) {
+	var state PowerState
+
+	supplies, _ := filepath.Glob("/sys/class/power_supply/*")
+	hasBattery, onMains := false, false
+	for _, supply := range supplies {
+		kind := readSysfs(filepath.Join(supply, "type"))
+		switch kind {
+		case "Mains", "USB":
+			if readSysfs(filepath.Join(supply, "online")) == "1" {
+				onMains = true
+			}
+		case "Battery":
+			if readSysfs(filepath.Join(supply, "scope")) != "Device" {
+				hasBattery = true
+			}
+		}
+	}
+	state.OnBattery = hasBattery && !onMains
+
+	// NM_METERED_YES (1) and NM_METERED_GUESS_YES (3) count as metered.
+	out, err := exec.Command("busctl", "get-property", "org.freedesktop.NetworkManager",
+		"/org/freedesktop/NetworkManager", "org.freedesktop.NetworkManager", "Metered").Output()
+	if err == nil {
+		value := strings.TrimSpace(string(out))
+		state.Metered = value == "u 1" || value == "u 3"
+	}
+
+	return state, nil
+}
+
+func readSysfs(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
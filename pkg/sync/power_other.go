@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package sync
+
+// detectPowerState has no probe on this platform and never defers runs.
+func detectPowerState() (PowerState, error) {
+	return PowerState{}, nil
+}
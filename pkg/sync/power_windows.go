@@ -0,0 +1,46 @@
+package sync
+
+import (
+	"os/exec"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var procGetSystemPowerStatus = syscall.NewLazyDLL("kernel32.dll").NewProc("GetSystemPowerStatus")
+
+// systemPowerStatus mirrors SYSTEM_POWER_STATUS.
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+// connectionCostScript prints the NetworkCostType of the internet profile:
+// Unrestricted, Fixed, Variable or Unknown.
+const connectionCostScript = `[Windows.Networking.Connectivity.NetworkInformation,Windows.Networking.Connectivity,ContentType=WindowsRuntime] | Out-Null; ` +
+	`[Windows.Networking.Connectivity.NetworkInformation]::GetInternetConnectionProfile().GetConnectionCost().NetworkCostType`
+
+// detectPowerState uses GetSystemPowerStatus for the power source and the
+// connection cost of the internet profile for metering.
+func detectPowerState() (PowerState, error) {
+	var state PowerState
+
+	var status systemPowerStatus
+	if ret, _, err := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&status))); ret == 0 {
+		return state, err
+	}
+	// ACLineStatus 0 is offline; BatteryFlag 128 means no system battery.
+	state.OnBattery = status.ACLineStatus == 0 && status.BatteryFlag != 128
+
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", connectionCostScript).Output()
+	if err == nil {
+		cost := strings.TrimSpace(string(out))
+		state.Metered = cost == "Fixed" || cost == "Variable"
+	}
+
+	return state, nil
+}
@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"cmp"
+	"context"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Preflight summarises the tree a first run would upload, so the user can
+// see the size, duration and cost of the backup before committing to it.
+type Preflight struct {
+	Files int64
+	Bytes int64
+	// Largest are the largest files, biggest first.
+	Largest []PreflightFile
+	// ClassBytes is how many bytes go to each storage class once the rules
+	// are applied; files without a StorageClass rule count as STANDARD.
+	ClassBytes map[string]int64
+}
+
+// PreflightFile is a file of Preflight.Largest.
+type PreflightFile struct {
+	Key  string
+	Size int64
+}
+
+// StoragePrice is the monthly storage price of a storage class, in USD per
+// GB, as listed for us-east-1. Requests, retrievals and minimum storage
+// durations are not included.
+type StoragePrice struct {
+	Class string
+	PerGB float64
+}
+
+// StoragePrices lists the storage classes a Rule can choose, cheapest last.
+var StoragePrices = []StoragePrice{
+	{Class: s3.StorageClassStandard, PerGB: 0.023},
+	{Class: s3.StorageClassIntelligentTiering, PerGB: 0.023},
+	{Class: s3.StorageClassStandardIa, PerGB: 0.0125},
+	{Class: s3.StorageClassOnezoneIa, PerGB: 0.01},
+	{Class: s3.StorageClassGlacierIr, PerGB: 0.004},
+	{Class: s3.StorageClassGlacier, PerGB: 0.0036},
+	{Class: s3.StorageClassDeepArchive, PerGB: 0.00099},
+}
+
+// MonthlyCost returns the monthly cost in USD of storing bytes in class,
+// and false for a class missing from StoragePrices.
+func MonthlyCost(class string, bytes int64) (float64, bool) {
+	for _, price := range StoragePrices {
+		if price.Class == class {
+			return float64(bytes) / (1 << 30) * price.PerGB, true
+		}
+	}
+	return 0, false
+}
+
+// Preflight walks Config.RootDir as a run would, skipping ignored files,
+// and keeps the largest files found.
+func (s *Syncer) Preflight(ctx context.Context, largest int) (*Preflight, error) {
+	p := &Preflight{ClassBytes: make(map[string]int64)}
+	err := walkTree(s.cfg.RootDir, s.cfg.FilesFrom, func(path, relPath string, info os.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if s.shouldIgnore(relPath) {
+			return nil
+		}
+
+		p.Files++
+		p.Bytes += info.Size()
+		class := s3.StorageClassStandard
+		if meta := s.ruleSettings(relPath); meta != nil && meta.StorageClass != "" {
+			class = meta.StorageClass
+		}
+		p.ClassBytes[class] += info.Size()
+
+		i, _ := slices.BinarySearchFunc(p.Largest, info.Size(), func(f PreflightFile, size int64) int {
+			return cmp.Compare(size, f.Size)
+		})
+		if i < largest {
+			p.Largest = slices.Insert(p.Largest, i, PreflightFile{Key: relPath, Size: info.Size()})
+			p.Largest = p.Largest[:min(len(p.Largest), largest)]
+		}
+		return nil
+	}, func(string, error) {}, s.mountsSkipped(nil))
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// UploadTime estimates how long uploading everything takes at
+// bytesPerSecond.
+func (p *Preflight) UploadTime(bytesPerSecond int64) time.Duration {
+	if bytesPerSecond <= 0 {
+		return 0
+	}
+	return time.Duration(float64(p.Bytes) / float64(bytesPerSecond) * float64(time.Second))
+}
+
+// MonthlyCost returns the monthly storage cost in USD of the tree with the
+// storage classes the rules choose. Classes missing from StoragePrices
+// are left out.
+func (p *Preflight) MonthlyCost() float64 {
+	var total float64
+	for class, bytes := range p.ClassBytes {
+		cost, _ := MonthlyCost(class, bytes)
+		total += cost
+	}
+	return total
+}
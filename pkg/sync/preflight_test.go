@@ -0,0 +1,47 @@
+package sync
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: pre-flight report
+func TestPreflight(t *testing.T) {
+	rootDir := t.TempDir()
+	createTempFile(t, rootDir, "small.txt", "a")
+	createTempFile(t, rootDir, "docs/medium.txt", strings.Repeat("b", 100))
+	createTempFile(t, rootDir, "video/big.mp4", strings.Repeat("c", 1000))
+	createTempFile(t, rootDir, "ignored.tmp", strings.Repeat("d", 5000))
+
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.RootDir = rootDir
+	s.ignorePatterns = []string{"ignored.tmp"}
+	s.rules = []Rule{{Pattern: "*.mp4", StorageClass: "GLACIER_IR"}}
+
+	p, err := s.Preflight(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), p.Files)
+	assert.Equal(t, int64(1101), p.Bytes)
+	assert.Equal(t, []PreflightFile{{Key: "video/big.mp4", Size: 1000}, {Key: "docs/medium.txt", Size: 100}}, p.Largest)
+	assert.Equal(t, map[string]int64{"STANDARD": 101, "GLACIER_IR": 1000}, p.ClassBytes)
+
+	assert.Equal(t, 11*time.Second, p.UploadTime(100).Round(time.Second))
+	assert.Zero(t, p.UploadTime(0))
+}
+
+func TestMonthlyCost(t *testing.T) {
+	cost, ok := MonthlyCost("STANDARD", 100<<30)
+	assert.True(t, ok)
+	assert.InDelta(t, 2.3, cost, 1e-9)
+
+	_, ok = MonthlyCost("REDUCED_REDUNDANCY", 1<<30)
+	assert.False(t, ok)
+
+	p := &Preflight{ClassBytes: map[string]int64{"STANDARD": 10 << 30, "DEEP_ARCHIVE": 1000 << 30}}
+	assert.InDelta(t, 0.23+0.99, p.MonthlyCost(), 1e-9)
+}
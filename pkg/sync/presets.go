@@ -0,0 +1,68 @@
+package sync
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// excludePresets are the built-in exclusion lists Config.ExcludePresets
+// selects by name. Their patterns (path.Match syntax) are compared with
+// every segment of a path, so a matching directory excludes its contents.
+var excludePresets = map[string][]string{
+	// os is the metadata operating systems and file managers leave behind.
+	"os": {
+		".DS_Store", "._*", ".AppleDouble", ".Spotlight-V100", ".Trashes", ".fseventsd", ".TemporaryItems",
+		"Thumbs.db", "ehthumbs.db", "desktop.ini", "$RECYCLE.BIN", "System Volume Information",
+		".directory", ".Trash-*",
+	},
+	// office is the lock and owner files office suites keep next to open
+	// documents.
+	"office": {"~$*", ".~lock.*#"},
+	// editor is swap, backup and lock files of text editors.
+	"editor": {"*.swp", "*.swo", "*~", ".#*", "#*#"},
+	// hidden is every file or directory whose name starts with a dot.
+	"hidden": {".*"},
+}
+
+// presetPatterns returns the patterns of the named presets, failing on
+// unknown names.
+func presetPatterns(names []string) ([]string, error) {
+	var patterns []string
+	for _, name := range names {
+		preset, ok := excludePresets[name]
+		if !ok {
+			return nil, i18n.Errorf("presets.unknown", name, strings.Join(PresetNames(), ", "))
+		}
+		patterns = append(patterns, preset...)
+	}
+	return patterns, nil
+}
+
+// PresetNames lists the names accepted in Config.ExcludePresets.
+func PresetNames() []string {
+	names := make([]string, 0, len(excludePresets))
+	for name := range excludePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// presetExcluded reports whether a segment of relPath matches the patterns
+// of the selected presets.
+func (s *Syncer) presetExcluded(relPath string) bool {
+	if len(s.presetPatterns) == 0 {
+		return false
+	}
+	for _, segment := range strings.Split(relPath, "/") {
+		for _, pattern := range s.presetPatterns {
+			if matched, _ := path.Match(pattern, segment); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: exclusion presets
+func TestPresetExcluded(t *testing.T) {
+	tests := []struct {
+		presets []string
+		path    string
+		want    bool
+	}{
+		{[]string{"os"}, ".DS_Store", true},
+		{[]string{"os"}, "fotos/.DS_Store", true},
+		{[]string{"os"}, "fotos/._praia.jpg", true},
+		{[]string{"os"}, "fotos/Thumbs.db", true},
+		{[]string{"os"}, "desktop.ini", true},
+		{[]string{"os"}, "$RECYCLE.BIN/arquivo.txt", true},
+		{[]string{"os"}, "fotos/praia.jpg", false},
+		{[]string{"os"}, "~$relatorio.docx", false},
+		{[]string{"office"}, "docs/~$relatorio.docx", true},
+		{[]string{"office"}, "docs/.~lock.planilha.ods#", true},
+		{[]string{"office"}, "docs/relatorio.docx", false},
+		{[]string{"editor"}, "src/.main.go.swp", true},
+		{[]string{"editor"}, "src/main.go~", true},
+		{[]string{"editor"}, "src/#main.go#", true},
+		{[]string{"editor"}, "src/.#main.go", true},
+		{[]string{"editor"}, "src/main.go", false},
+		{[]string{"hidden"}, ".config/app.json", true},
+		{[]string{"hidden"}, "src/.env", true},
+		{[]string{"hidden"}, "src/main.go", false},
+		{[]string{"os", "office"}, "docs/~$relatorio.docx", true},
+		{nil, ".DS_Store", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			patterns, err := presetPatterns(tt.presets)
+			require.NoError(t, err)
+			s := newTestSyncer(t, nil)
+			s.presetPatterns = patterns
+			assert.Equal(t, tt.want, s.shouldIgnore(tt.path))
+		})
+	}
+}
+
+func TestPresetPatternsUnknown(t *testing.T) {
+	_, err := presetPatterns([]string{"os", "musica"})
+	assert.ErrorContains(t, err, "musica")
+}
@@ -0,0 +1,135 @@
+package sync
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// ObjectVersion is a version or delete marker of a key in a versioned
+// bucket.
+type ObjectVersion struct {
+	Key          string
+	VersionID    string
+	DeleteMarker bool
+	LastModified time.Time
+	Size         int64
+}
+
+// ParseRetention parses a retention period such as "30d", "2w" or any
+// time.ParseDuration value.
+func ParseRetention(value string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if number, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.Atoi(number)
+			if err != nil || n < 0 {
+				return 0, i18n.Errorf("prune.invalid_retention", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, i18n.Errorf("prune.invalid_retention", value)
+	}
+	return d, nil
+}
+
+// PrunableVersions lists the versions that `restore --as-of` no longer
+// needs to restore any instant of the last keep: noncurrent versions
+// replaced more than keep ago, and keys deleted more than keep ago, delete
+// marker included. Current versions are always kept.
+func (s *Syncer) PrunableVersions(keep time.Duration) ([]ObjectVersion, error) {
+	cutoff := time.Now().Add(-keep)
+
+	byKey := make(map[string][]ObjectVersion)
+	err := s.client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Prefix: optionalString(s.keyPrefix),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		for _, v := range page.Versions {
+			key := aws.StringValue(v.Key)
+			byKey[key] = append(byKey[key], ObjectVersion{
+				Key:          key,
+				VersionID:    aws.StringValue(v.VersionId),
+				LastModified: aws.TimeValue(v.LastModified),
+				Size:         aws.Int64Value(v.Size),
+			})
+		}
+		for _, m := range page.DeleteMarkers {
+			key := aws.StringValue(m.Key)
+			byKey[key] = append(byKey[key], ObjectVersion{
+				Key:          key,
+				VersionID:    aws.StringValue(m.VersionId),
+				DeleteMarker: true,
+				LastModified: aws.TimeValue(m.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, i18n.Errorf("restore.list_versions", err)
+	}
+
+	keys := make([]string, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var prunable []ObjectVersion
+	for _, key := range keys {
+		versions := byKey[key]
+		sort.SliceStable(versions, func(i, j int) bool { return versions[i].LastModified.After(versions[j].LastModified) })
+
+		// A key deleted before the cutoff did not exist at any instant
+		// still restorable: all of its history goes.
+		if latest := versions[0]; latest.DeleteMarker && latest.LastModified.Before(cutoff) {
+			prunable = append(prunable, versions...)
+			continue
+		}
+		// Otherwise a version goes once the one that replaced it is older
+		// than the cutoff.
+		for i := 1; i < len(versions); i++ {
+			if versions[i-1].LastModified.Before(cutoff) {
+				prunable = append(prunable, versions[i])
+			}
+		}
+	}
+	return prunable, nil
+}
+
+// DeleteVersions permanently deletes versions. It returns how many
+// succeeded and the versions Object Lock kept, which are not errors.
+func (s *Syncer) DeleteVersions(versions []ObjectVersion) (int, []LockedVersion, error) {
+	deleted := 0
+	var locked []LockedVersion
+	var lastErr error
+
+	for _, v := range versions {
+		_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket:    aws.String(s.cfg.Bucket),
+			Key:       aws.String(v.Key),
+			VersionId: aws.String(v.VersionID),
+		})
+		if isLockedError(err) {
+			locked = append(locked, s.lockOf(v))
+			continue
+		}
+		if err != nil {
+			lastErr = i18n.Errorf("prune.delete_failed", v.Key, v.VersionID, err)
+			log.Printf("  ❌ %v", lastErr)
+			continue
+		}
+		deleted++
+	}
+
+	return deleted, locked, lastErr
+}
@@ -0,0 +1,97 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: prune
+func TestParseRetention(t *testing.T) {
+	tests := map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+	}
+	for value, want := range tests {
+		got, err := ParseRetention(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+
+	for _, value := range []string{"", "d", "-3d", "1.5d", "thirty"} {
+		_, err := ParseRetention(value)
+		assert.Equal(t, "prune.invalid_retention", i18n.ID(err), value)
+	}
+}
+
+func TestPrunableVersions(t *testing.T) {
+	now := time.Now()
+	daysAgo := func(n int) *time.Time { return aws.Time(now.Add(-time.Duration(n) * 24 * time.Hour)) }
+	version := func(key, id string, days int) *s3.ObjectVersion {
+		return &s3.ObjectVersion{Key: aws.String(key), VersionId: aws.String(id), LastModified: daysAgo(days), Size: aws.Int64(10)}
+	}
+	marker := func(key, id string, days int) *s3.DeleteMarkerEntry {
+		return &s3.DeleteMarkerEntry{Key: aws.String(key), VersionId: aws.String(id), LastModified: daysAgo(days)}
+	}
+
+	client := new(mockS3Client)
+	client.On("ListObjectVersionsPages", mock.Anything, mock.Anything).Return(&s3.ListObjectVersionsOutput{
+		Versions: []*s3.ObjectVersion{
+			// Replaced 40 days ago: v1 goes, v2 is still current at the cutoff.
+			version("a.txt", "a3", 5),
+			version("a.txt", "a2", 40),
+			version("a.txt", "a1", 60),
+			// Deleted 50 days ago: the whole history goes.
+			version("gone.txt", "g1", 90),
+			// Deleted recently: restorable until 10 days ago.
+			version("recent.txt", "r1", 20),
+			// Never replaced.
+			version("b.txt", "b1", 365),
+		},
+		DeleteMarkers: []*s3.DeleteMarkerEntry{
+			marker("gone.txt", "gm", 50),
+			marker("recent.txt", "rm", 10),
+		},
+	}, nil).Once()
+
+	versions, err := newTestSyncer(t, client).PrunableVersions(30 * 24 * time.Hour)
+	require.NoError(t, err)
+
+	var ids []string
+	for _, v := range versions {
+		ids = append(ids, v.VersionID)
+	}
+	assert.Equal(t, []string{"a1", "gm", "g1"}, ids)
+	assert.True(t, versions[1].DeleteMarker)
+}
+
+func TestDeleteVersions(t *testing.T) {
+	client := new(mockS3Client)
+	client.On("DeleteObject", &s3.DeleteObjectInput{
+		Bucket:    aws.String("test-bucket"),
+		Key:       aws.String("a.txt"),
+		VersionId: aws.String("a1"),
+	}).Return(&s3.DeleteObjectOutput{}, nil).Once()
+	client.On("DeleteObject", &s3.DeleteObjectInput{
+		Bucket:    aws.String("test-bucket"),
+		Key:       aws.String("b.txt"),
+		VersionId: aws.String("b1"),
+	}).Return(nil, awserr.New("AccessDenied", "denied", nil)).Once()
+
+	deleted, locked, err := newTestSyncer(t, client).DeleteVersions([]ObjectVersion{
+		{Key: "a.txt", VersionID: "a1"},
+		{Key: "b.txt", VersionID: "b1"},
+	})
+	assert.Equal(t, 1, deleted)
+	assert.Empty(t, locked, "access denied without Object Lock is a failure")
+	assert.Equal(t, "prune.delete_failed", i18n.ID(err))
+	client.AssertExpectations(t)
+}
@@ -0,0 +1,262 @@
+package sync
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// UploadOptions holds the per-object settings applied to uploads that do not
+// come from the directory walk, such as the put subcommand.
+type UploadOptions struct {
+	SSE          string // AES256 or aws:kms
+	KMSKeyID     string
+	StorageClass string
+	Tags         string // key=value&key2=value2
+	// ObjectLockMode and ObjectLockDays lock the object; unset, those of
+	// Config apply.
+	ObjectLockMode string
+	ObjectLockDays int
+}
+
+// Put uploads body to key, streaming it so inputs of unknown length (such
+// as stdin) never need to be staged on disk. It returns the bytes uploaded.
+func (s *Syncer) Put(key string, body io.Reader, opts UploadOptions) (int64, error) {
+	if err := opts.Validate(); err != nil {
+		return 0, err
+	}
+	if err := keyError(key); err != nil {
+		return 0, err
+	}
+	if opts.ObjectLockMode == "" {
+		opts.ObjectLockMode, opts.ObjectLockDays = s.cfg.ObjectLockMode, s.cfg.ObjectLockDays
+	}
+	return s.streamUpload(key, body, opts)
+}
+
+// Validate checks the options against the values S3 accepts.
+func (o UploadOptions) Validate() error {
+	if o.SSE != "" && o.SSE != s3.ServerSideEncryptionAes256 && o.SSE != s3.ServerSideEncryptionAwsKms {
+		return i18n.Errorf("put.invalid_sse", o.SSE, s3.ServerSideEncryptionAes256, s3.ServerSideEncryptionAwsKms)
+	}
+	if o.KMSKeyID != "" && o.SSE != s3.ServerSideEncryptionAwsKms {
+		return i18n.Errorf("put.kms_requires_sse", s3.ServerSideEncryptionAwsKms)
+	}
+	if o.StorageClass != "" {
+		valid := false
+		for _, class := range s3.StorageClass_Values() {
+			if class == o.StorageClass {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return i18n.Errorf("put.invalid_storage_class", o.StorageClass)
+		}
+	}
+	for _, tag := range strings.Split(o.Tags, "&") {
+		if tag != "" && !strings.Contains(tag, "=") {
+			return i18n.Errorf("put.invalid_tag", tag)
+		}
+	}
+	return validateObjectLock(o.ObjectLockMode, o.ObjectLockDays)
+}
+
+// applyPut copies the options onto a single-part upload request.
+func (o UploadOptions) applyPut(input *s3.PutObjectInput) {
+	input.ServerSideEncryption = optionalString(o.SSE)
+	input.SSEKMSKeyId = optionalString(o.KMSKeyID)
+	input.StorageClass = optionalString(o.StorageClass)
+	input.Tagging = optionalString(o.Tags)
+	newObjectRetention(o.ObjectLockMode, o.ObjectLockDays).applyPut(input)
+}
+
+// applyMultipart copies the options onto the request that starts a multipart
+// upload; parts inherit them from there.
+func (o UploadOptions) applyMultipart(input *s3.CreateMultipartUploadInput) {
+	input.ServerSideEncryption = optionalString(o.SSE)
+	input.SSEKMSKeyId = optionalString(o.KMSKeyID)
+	input.StorageClass = optionalString(o.StorageClass)
+	input.Tagging = optionalString(o.Tags)
+	newObjectRetention(o.ObjectLockMode, o.ObjectLockDays).applyMultipart(input)
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
+
+// streamUpload uploads body of unknown length. Streams that fit in a single
+// part are sent with PutObject; anything larger becomes a multipart upload
+// with at most partConcurrency parts buffered at once, so memory use stays
+// bounded regardless of the input size. The buffers come from s.buffers,
+// shared with the other uploads under Config.MemoryLimit.
+func (s *Syncer) streamUpload(s3Key string, body io.Reader, opts UploadOptions) (int64, error) {
+	first := s.buffers.get()
+	n, err := io.ReadFull(body, first)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		defer s.buffers.put(first)
+		input := &s3.PutObjectInput{
+			Bucket: aws.String(s.cfg.Bucket),
+			Key:    aws.String(s3Key),
+			Body:   bytes.NewReader(first[:n]),
+		}
+		opts.applyPut(input)
+		if err := s.setPutChecksum(input, bytes.NewReader(first[:n])); err != nil {
+			return 0, err
+		}
+		if _, err := s.client.PutObject(input); err != nil {
+			return 0, i18n.Errorf("put.stream", err)
+		}
+		return int64(n), nil
+	}
+	if err != nil {
+		s.buffers.put(first)
+		return 0, i18n.Errorf("put.read", err)
+	}
+
+	createInput := &s3.CreateMultipartUploadInput{
+		Bucket:            aws.String(s.cfg.Bucket),
+		Key:               aws.String(s3Key),
+		ChecksumAlgorithm: optionalString(s.checksumAlgorithm),
+	}
+	opts.applyMultipart(createInput)
+	created, err := s.client.CreateMultipartUpload(createInput)
+	if err != nil {
+		s.buffers.put(first)
+		return 0, i18n.Errorf("s3.create_multipart", err)
+	}
+
+	total, parts, err := s.streamParts(s3Key, created.UploadId, first, body)
+	if err != nil {
+		s.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.cfg.Bucket),
+			Key:      aws.String(s3Key),
+			UploadId: created.UploadId,
+		})
+		return 0, err
+	}
+
+	_, err = s.client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.cfg.Bucket),
+		Key:             aws.String(s3Key),
+		UploadId:        created.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return 0, i18n.Errorf("put.complete", err)
+	}
+
+	return total, nil
+}
+
+// streamParts reads body part by part, starting with the already filled
+// first buffer, and uploads up to partConcurrency parts in parallel. It
+// gives first and every other buffer back to s.buffers.
+func (s *Syncer) streamParts(s3Key string, uploadID *string, first []byte, body io.Reader) (int64, []*s3.CompletedPart, error) {
+	// held has a token for every buffer of this upload, the one being read
+	// included.
+	held := make(chan struct{}, partConcurrency)
+	held <- struct{}{}
+	release := func(buf []byte) {
+		s.buffers.put(buf)
+		<-held
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		parts    []*s3.CompletedPart
+		firstErr error
+		total    int64
+	)
+
+	buf, n := first, len(first)
+	for partNumber := int64(1); n > 0; partNumber++ {
+		if partNumber > 10000 {
+			mu.Lock()
+			firstErr = i18n.Errorf("put.too_many_parts")
+			mu.Unlock()
+			break
+		}
+		total += int64(n)
+
+		wg.Add(1)
+		go func(partNumber int64, buf []byte, n int) {
+			defer wg.Done()
+			defer release(buf)
+
+			input := &s3.UploadPartInput{
+				Bucket:     aws.String(s.cfg.Bucket),
+				Key:        aws.String(s3Key),
+				UploadId:   uploadID,
+				PartNumber: aws.Int64(partNumber),
+				Body:       bytes.NewReader(buf[:n]),
+			}
+
+			var checksum objectChecksum
+			var err error
+			if s.checksumAlgorithm != "" {
+				var value string
+				value, err = computeChecksum(s.checksumAlgorithm, bytes.NewReader(buf[:n]))
+				checksum = newObjectChecksum(s.checksumAlgorithm, value)
+				checksum.applyPart(input)
+			}
+
+			var output *s3.UploadPartOutput
+			if err == nil {
+				output, err = s.client.UploadPart(input)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = i18n.Errorf("s3.upload_part", partNumber, err)
+				}
+				return
+			}
+			completed := &s3.CompletedPart{ETag: output.ETag, PartNumber: aws.Int64(partNumber)}
+			checksum.applyCompleted(completed)
+			parts = append(parts, completed)
+		}(partNumber, buf, n)
+
+		held <- struct{}{}
+		buf = s.buffers.get()
+		var err error
+		n, err = io.ReadFull(body, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = i18n.Errorf("put.read", err)
+			}
+			mu.Unlock()
+			break
+		}
+
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+	}
+	// The last buffer read was not handed to a part.
+	release(buf)
+
+	wg.Wait()
+	if firstErr != nil {
+		return 0, nil, firstErr
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return *parts[i].PartNumber < *parts[j].PartNumber })
+	return total, parts, nil
+}
@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Test Suite: put subcommand
+func TestStreamUpload(t *testing.T) {
+	t.Run("stream applies upload options", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		content := "pg_dump output"
+
+		mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+			return *input.Bucket == "test-bucket" &&
+				*input.Key == "backups/db.sql.gz" &&
+				*input.ServerSideEncryption == "AES256" &&
+				*input.StorageClass == "STANDARD_IA" &&
+				*input.Tagging == "env=prod"
+		})).Return(&s3.PutObjectOutput{}, nil).Once()
+
+		opts := UploadOptions{SSE: "AES256", StorageClass: "STANDARD_IA", Tags: "env=prod"}
+		size, err := newTestSyncer(t, mockClient).streamUpload("backups/db.sql.gz", strings.NewReader(content), opts)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(content)), size)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("stream without options", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+
+		mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+			return input.ServerSideEncryption == nil && input.StorageClass == nil && input.Tagging == nil
+		})).Return(&s3.PutObjectOutput{}, nil).Once()
+
+		_, err := newTestSyncer(t, mockClient).streamUpload("key", strings.NewReader("data"), UploadOptions{})
+		assert.NoError(t, err)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("stream larger than one part uses multipart", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		content := bytes.Repeat([]byte("x"), partSize+10)
+
+		mockClient.On("CreateMultipartUpload", mock.MatchedBy(func(input *s3.CreateMultipartUploadInput) bool {
+			return *input.Key == "big.bin" && *input.StorageClass == "GLACIER_IR"
+		})).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil).Once()
+		mockClient.On("UploadPart", mock.MatchedBy(func(input *s3.UploadPartInput) bool {
+			return *input.UploadId == "upload-1"
+		})).Return(&s3.UploadPartOutput{ETag: aws.String("\"etag\"")}, nil).Twice()
+		mockClient.On("CompleteMultipartUpload", mock.MatchedBy(func(input *s3.CompleteMultipartUploadInput) bool {
+			parts := input.MultipartUpload.Parts
+			return len(parts) == 2 && *parts[0].PartNumber == 1 && *parts[1].PartNumber == 2
+		})).Return(&s3.CompleteMultipartUploadOutput{}, nil).Once()
+
+		size, err := newTestSyncer(t, mockClient).streamUpload("big.bin", bytes.NewReader(content), UploadOptions{StorageClass: "GLACIER_IR"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(content)), size)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("failed part aborts the upload", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		content := bytes.Repeat([]byte("x"), partSize+10)
+
+		mockClient.On("CreateMultipartUpload", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-2")}, nil).Once()
+		mockClient.On("UploadPart", mock.Anything).Return(nil, fmt.Errorf("connection reset"))
+		mockClient.On("AbortMultipartUpload", mock.MatchedBy(func(input *s3.AbortMultipartUploadInput) bool {
+			return *input.UploadId == "upload-2"
+		})).Return(&s3.AbortMultipartUploadOutput{}, nil).Once()
+
+		_, err := newTestSyncer(t, mockClient).streamUpload("big.bin", bytes.NewReader(content), UploadOptions{})
+		assert.Error(t, err)
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestUploadOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    UploadOptions
+		wantErr bool
+	}{
+		{"empty options", UploadOptions{}, false},
+		{"kms with key", UploadOptions{SSE: "aws:kms", KMSKeyID: "key-id"}, false},
+		{"invalid sse", UploadOptions{SSE: "rot13"}, true},
+		{"kms key without kms sse", UploadOptions{SSE: "AES256", KMSKeyID: "key-id"}, true},
+		{"valid storage class", UploadOptions{StorageClass: "GLACIER_IR"}, false},
+		{"invalid storage class", UploadOptions{StorageClass: "COLD"}, true},
+		{"valid tags", UploadOptions{Tags: "a=1&b=2"}, false},
+		{"invalid tags", UploadOptions{Tags: "a=1&b"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// ParseSize parses a size in bytes such as "500M", "20G" or "1.5GB"; K, M
+// and G are powers of 1024.
+func ParseSize(value string) (int64, error) {
+	size, ok := parseBytes(value)
+	if !ok {
+		return 0, i18n.Errorf("quota.invalid_size", value)
+	}
+	return size, nil
+}
+
+// validateQuota checks Config.MaxFiles and Config.MaxTotalSize.
+func validateQuota(maxFiles int, maxTotalSize int64) error {
+	if maxFiles < 0 || maxTotalSize < 0 {
+		return i18n.Errorf("quota.negative")
+	}
+	return nil
+}
+
+// uploadQuota stops a run from queuing uploads once they would add up to
+// more than Config.MaxFiles files or Config.MaxTotalSize bytes, as when
+// the tool is pointed at / by mistake or a log file runs away. Its methods
+// do nothing on a nil quota.
+type uploadQuota struct {
+	syncer *Syncer
+	ctx    context.Context
+	// stop ends the scan of the run.
+	stop func()
+
+	mu       sync.Mutex
+	files    int64
+	bytes    int64
+	exceeded bool
+}
+
+// newUploadQuota returns the quota of a run, or nil when neither limit is
+// set. stop is called to end the scan once the quota is exceeded.
+func (s *Syncer) newUploadQuota(ctx context.Context, stop func()) *uploadQuota {
+	if s.cfg.MaxFiles == 0 && s.cfg.MaxTotalSize == 0 {
+		return nil
+	}
+	return &uploadQuota{syncer: s, ctx: ctx, stop: stop}
+}
+
+// admit counts a file of size bytes about to be queued for upload. It
+// returns false, and queues nothing more in the run, once the file would
+// exceed the quota.
+func (q *uploadQuota) admit(size int64) bool {
+	if q == nil {
+		return true
+	}
+	cfg := q.syncer.cfg
+
+	q.mu.Lock()
+	if q.exceeded {
+		q.mu.Unlock()
+		return false
+	}
+	files, bytes := q.files+1, q.bytes+size
+	if cfg.MaxFiles > 0 && files > int64(cfg.MaxFiles) || cfg.MaxTotalSize > 0 && bytes > cfg.MaxTotalSize {
+		q.exceeded = true
+		q.mu.Unlock()
+		q.trip()
+		return false
+	}
+	q.files, q.bytes = files, bytes
+	q.mu.Unlock()
+	return true
+}
+
+// tripped reports whether the quota was exceeded in the run.
+func (q *uploadQuota) tripped() bool {
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.exceeded
+}
+
+// trip ends the scan and reports the quota, in the log and through the
+// notifiers.
+func (q *uploadQuota) trip() {
+	q.stop()
+	s := q.syncer
+
+	var limits []string
+	if s.cfg.MaxFiles > 0 {
+		limits = append(limits, fmt.Sprintf(i18n.T("quota.limit_files"), s.cfg.MaxFiles))
+	}
+	if s.cfg.MaxTotalSize > 0 {
+		limits = append(limits, fmt.Sprintf(i18n.T("quota.limit_size"), float64(s.cfg.MaxTotalSize)/(1024*1024)))
+	}
+	exceeded := fmt.Sprintf(i18n.T("quota.exceeded"), q.files, float64(q.bytes)/(1024*1024), strings.Join(limits, ", "))
+	log.Printf("⛔ %s", exceeded)
+	s.sendAlert(q.ctx, i18n.T("quota.title"), fmt.Sprintf("%s → s3://%s\n%s", s.cfg.RootDir, s.cfg.Bucket, exceeded))
+}
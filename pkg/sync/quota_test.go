@@ -0,0 +1,88 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: upload quotas
+func TestParseSize(t *testing.T) {
+	size, err := ParseSize("20G")
+	require.NoError(t, err)
+	assert.Equal(t, int64(20<<30), size)
+
+	_, err = ParseSize("muito")
+	assert.Equal(t, "quota.invalid_size", i18n.ID(err))
+	assert.Equal(t, "quota.negative", i18n.ID(validateQuota(-1, 0)))
+	assert.NoError(t, validateQuota(0, 0))
+}
+
+func TestUploadQuota(t *testing.T) {
+	var alerts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		alerts = append(alerts, string(data))
+	}))
+	defer server.Close()
+
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.RootDir = "/"
+	s.cfg.Notifiers = []Notifier{{Kind: "ntfy", Target: server.URL, OnlyOnFailure: true}}
+	assert.Nil(t, s.newUploadQuota(context.Background(), func() {}), "no limits")
+
+	s.cfg.MaxFiles = 3
+	s.cfg.MaxTotalSize = 100
+	stops := 0
+	q := s.newUploadQuota(context.Background(), func() { stops++ })
+	require.NotNil(t, q)
+
+	assert.True(t, q.admit(40))
+	assert.True(t, q.admit(60))
+	assert.False(t, q.tripped())
+	assert.False(t, q.admit(1), "the file would go over MaxTotalSize")
+	assert.False(t, q.admit(0), "nothing more is queued once exceeded")
+	assert.True(t, q.tripped())
+	assert.Equal(t, 1, stops)
+	require.Len(t, alerts, 1)
+	assert.Contains(t, alerts[0], "test-bucket")
+
+	var none *uploadQuota
+	assert.True(t, none.admit(1<<40))
+	assert.False(t, none.tripped())
+}
+
+func TestSyncStopsAtQuota(t *testing.T) {
+	notFound := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")
+	tempDir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		createTempFile(t, tempDir, fmt.Sprintf("log-%d.txt", i), "linha")
+	}
+
+	client := new(mockS3Client)
+	client.On("HeadObject", mock.Anything).Return(nil, notFound)
+	client.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Twice()
+
+	s := newTestSyncer(t, client)
+	s.cfg.MaxFiles = 2
+	result, err := s.syncDirectoryWithS3(context.Background(), tempDir)
+	require.NoError(t, err)
+	assert.NoError(t, result.Err())
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "ListObjectsV2Pages", mock.Anything, mock.Anything)
+
+	summary := s.stats.summary()
+	assert.Equal(t, int64(2), summary.Uploaded)
+	assert.Positive(t, summary.OverQuota)
+	assert.Contains(t, summary.String(), "over the upload budget")
+}
@@ -0,0 +1,146 @@
+package sync
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Replica is an extra destination bucket of Config, kept in sync with the
+// same directory as Config.Bucket. Region and Credentials default to those
+// of Config; Client overrides the client built from them.
+type Replica struct {
+	Bucket      string
+	Region      string
+	Credentials Credentials
+	Client      s3iface.S3API
+}
+
+// ParseReplica parses a replica spec, as given to --replica:
+//
+//	bucket
+//	bucket@region
+//	s3://bucket?region=eu-west-1&profile=eu&role-arn=arn:aws:iam::...&external-id=...&key-store=keychain:eu
+func ParseReplica(spec string) (Replica, error) {
+	if !strings.HasPrefix(spec, "s3://") {
+		bucket, region, _ := strings.Cut(spec, "@")
+		if bucket == "" || strings.Contains(bucket, "/") {
+			return Replica{}, i18n.Errorf("replica.invalid", spec)
+		}
+		return Replica{Bucket: bucket, Region: region}, nil
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+		return Replica{}, i18n.Errorf("replica.invalid", spec)
+	}
+	query := u.Query()
+	for param := range query {
+		switch param {
+		case "region", "profile", "role-arn", "external-id", "key-store":
+		default:
+			return Replica{}, i18n.Errorf("replica.unknown_param", param)
+		}
+	}
+	return Replica{
+		Bucket: u.Host,
+		Region: query.Get("region"),
+		Credentials: Credentials{
+			Profile:    query.Get("profile"),
+			RoleARN:    query.Get("role-arn"),
+			ExternalID: query.Get("external-id"),
+			KeyStore:   query.Get("key-store"),
+		},
+	}, nil
+}
+
+// replicaConfig returns the Config of the Syncer that uploads to r: the
+// same tree and upload settings, without the features that concern the
+// run as a whole (hooks, notifications, healthchecks, metrics, reports),
+// which stay with the primary Syncer.
+func (cfg Config) replicaConfig(r Replica) Config {
+	rc := cfg
+	rc.Bucket = r.Bucket
+	rc.Region = cmp.Or(r.Region, cfg.Region)
+	if r.Credentials != (Credentials{}) {
+		rc.Credentials = r.Credentials
+	}
+	rc.Client = r.Client
+	rc.Replicas = nil
+	rc.PreHook, rc.PostHook = "", ""
+	rc.Snapshot, rc.SnapshotRelease = "", ""
+	rc.Notifiers = nil
+	rc.HealthcheckURL = ""
+	rc.MetricsNamespace, rc.MetricsClient = "", nil
+	rc.ReportPath, rc.ReportToBucket = "", false
+	return rc
+}
+
+// newReplicas builds a Syncer for every replica of s.
+func (s *Syncer) newReplicas() error {
+	seen := map[string]bool{s.cfg.Bucket + "@" + s.cfg.Region: true}
+	for _, r := range s.cfg.Replicas {
+		rc := s.cfg.replicaConfig(r)
+		id := rc.Bucket + "@" + rc.Region
+		if seen[id] {
+			return i18n.Errorf("replica.duplicate", rc.Bucket)
+		}
+		seen[id] = true
+		replica, err := New(rc)
+		if err != nil {
+			return i18n.Errorf("replica.failed", rc.Bucket, err)
+		}
+		replica.primary = s
+		replica.buffers = s.buffers
+		s.replicas = append(s.replicas, replica)
+	}
+	return nil
+}
+
+// syncReplicas starts syncing the replicas, all at once with
+// Config.ParallelReplicas or otherwise one after the other once wait is
+// called. wait returns their errors joined.
+func (s *Syncer) syncReplicas(ctx context.Context) (wait func() error) {
+	if len(s.replicas) == 0 {
+		return func() error { return nil }
+	}
+
+	run := func(r *Syncer) error {
+		fmt.Printf(i18n.T("replica.syncing"), r.cfg.Bucket, r.cfg.Region)
+		if err := r.Run(ctx); err != nil {
+			return i18n.Errorf("replica.failed", r.cfg.Bucket, err)
+		}
+		return nil
+	}
+
+	if !s.cfg.ParallelReplicas {
+		return func() error {
+			var errs []error
+			for _, r := range s.replicas {
+				errs = append(errs, run(r))
+			}
+			return errors.Join(errs...)
+		}
+	}
+
+	errs := make([]error, len(s.replicas))
+	var wg sync.WaitGroup
+	for i, r := range s.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = run(r)
+		}()
+	}
+	return func() error {
+		wg.Wait()
+		return errors.Join(errs...)
+	}
+}
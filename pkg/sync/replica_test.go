@@ -0,0 +1,135 @@
+package sync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: replica buckets
+func TestParseReplica(t *testing.T) {
+	valid := map[string]Replica{
+		"backup":           {Bucket: "backup"},
+		"backup@eu-west-1": {Bucket: "backup", Region: "eu-west-1"},
+		"s3://backup":      {Bucket: "backup"},
+		"s3://backup/":     {Bucket: "backup"},
+		"s3://backup?region=eu-west-1&profile=eu": {Bucket: "backup", Region: "eu-west-1", Credentials: Credentials{Profile: "eu"}},
+		"s3://backup?key-store=keychain:eu":       {Bucket: "backup", Credentials: Credentials{KeyStore: "keychain:eu"}},
+		"s3://backup?role-arn=arn:aws:iam::123456789012:role/sync&external-id=x": {
+			Bucket:      "backup",
+			Credentials: Credentials{RoleARN: "arn:aws:iam::123456789012:role/sync", ExternalID: "x"},
+		},
+	}
+	for spec, want := range valid {
+		got, err := ParseReplica(spec)
+		require.NoError(t, err, spec)
+		assert.Equal(t, want, got, spec)
+	}
+
+	invalid := map[string]string{
+		"":                         "replica.invalid",
+		"@eu-west-1":               "replica.invalid",
+		"backup/prefix":            "replica.invalid",
+		"s3://":                    "replica.invalid",
+		"s3://backup/prefix":       "replica.invalid",
+		"s3://backup?bucket=other": "replica.unknown_param",
+	}
+	for spec, id := range invalid {
+		_, err := ParseReplica(spec)
+		assert.Equal(t, id, i18n.ID(err), spec)
+	}
+}
+
+func TestReplicaConfig(t *testing.T) {
+	cfg := Config{
+		Bucket:      "primary",
+		Region:      "us-east-1",
+		RootDir:     "/data",
+		Credentials: Credentials{Profile: "main"},
+		Replicas:    []Replica{{Bucket: "backup"}},
+		PreHook:     "true",
+		PostHook:    "true",
+		ReportPath:  "report.json",
+	}
+
+	rc := cfg.replicaConfig(Replica{Bucket: "backup"})
+	assert.Equal(t, "backup", rc.Bucket)
+	assert.Equal(t, "us-east-1", rc.Region, "region is inherited")
+	assert.Equal(t, "main", rc.Credentials.Profile, "credentials are inherited")
+	assert.Equal(t, "/data", rc.RootDir)
+	assert.Empty(t, rc.Replicas)
+	assert.Empty(t, rc.PreHook)
+	assert.Empty(t, rc.PostHook)
+	assert.Empty(t, rc.ReportPath)
+
+	rc = cfg.replicaConfig(Replica{Bucket: "backup", Region: "eu-west-1", Credentials: Credentials{Profile: "eu"}})
+	assert.Equal(t, "eu-west-1", rc.Region)
+	assert.Equal(t, Credentials{Profile: "eu"}, rc.Credentials)
+}
+
+func TestNewReplicas(t *testing.T) {
+	t.Run("same bucket and region twice is rejected", func(t *testing.T) {
+		_, err := New(Config{
+			Bucket:   "primary",
+			Region:   "us-east-1",
+			Client:   new(mockS3Client),
+			StateDir: t.TempDir(),
+			Replicas: []Replica{{Bucket: "primary", Client: new(mockS3Client)}},
+		})
+		assert.Equal(t, "replica.duplicate", i18n.ID(err))
+	})
+
+	t.Run("replica without a region fails", func(t *testing.T) {
+		_, err := New(Config{
+			Bucket:   "primary",
+			Client:   new(mockS3Client),
+			StateDir: t.TempDir(),
+			Replicas: []Replica{{Bucket: "backup"}},
+		})
+		assert.Equal(t, "replica.failed", i18n.ID(err))
+	})
+}
+
+func TestRunUploadsToReplicas(t *testing.T) {
+	notFound := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")
+	newClient := func() *mockS3Client {
+		client := new(mockS3Client)
+		client.On("GetObject", mock.Anything).Return(nil, notFound)
+		client.On("HeadObject", mock.Anything).Return(nil, notFound)
+		client.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil)
+		client.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{}, nil)
+		return client
+	}
+
+	for _, parallel := range []bool{false, true} {
+		rootDir := t.TempDir()
+		createTempFile(t, rootDir, "a.txt", "a")
+
+		primary, backup, archive := newClient(), newClient(), newClient()
+		s, err := New(Config{
+			Bucket:   "primary",
+			RootDir:  rootDir,
+			Client:   primary,
+			StateDir: t.TempDir(),
+			Replicas: []Replica{
+				{Bucket: "backup", Client: backup},
+				{Bucket: "archive", Client: archive},
+			},
+			ParallelReplicas: parallel,
+		})
+		require.NoError(t, err)
+		require.NoError(t, s.Run(context.Background()))
+
+		for bucket, client := range map[string]*mockS3Client{"primary": primary, "backup": backup, "archive": archive} {
+			client.AssertCalled(t, "PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+				return *input.Bucket == bucket && *input.Key == "a.txt"
+			}))
+		}
+	}
+}
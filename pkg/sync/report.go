@@ -0,0 +1,170 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// reportsPrefix holds the run reports uploaded with Config.ReportToBucket.
+// Like reservedPrefix, it is never treated as removed local files.
+const reportsPrefix = ".sync-reports/"
+
+const (
+	actionUpload = "upload"
+	actionSkip   = "skip"
+	actionDelete = "delete"
+	// actionUnreadable is a file or directory skipped because it could not
+	// be read.
+	actionUnreadable = "unreadable"
+	// actionBusy is a file left for the next run because it was being
+	// written.
+	actionBusy = "busy"
+	// actionInvalidKey is a file skipped because its name cannot be a key.
+	actionInvalidKey = "invalid_key"
+	// actionOverQuota is a file not uploaded because the run exceeded
+	// Config.MaxFiles or Config.MaxTotalSize.
+	actionOverQuota = "over_quota"
+)
+
+// reportAction is one decision taken during a run.
+type reportAction struct {
+	Action   string  `json:"action"`
+	Key      string  `json:"key"`
+	Size     int64   `json:"size"`
+	Duration float64 `json:"duration_seconds,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// runReport collects the actions of a run for the report file. A nil
+// runReport ignores them, so runs without reports keep no per-file state.
+type runReport struct {
+	mu      sync.Mutex
+	actions []reportAction
+}
+
+func (r *runReport) reset() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.actions = nil
+}
+
+func (r *runReport) add(action reportAction) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.actions = append(r.actions, action)
+}
+
+// reportDocument is the JSON report of a run.
+type reportDocument struct {
+	Bucket   string         `json:"bucket"`
+	RootDir  string         `json:"root_dir"`
+	Host     string         `json:"host"`
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Result   string         `json:"result"`
+	Error    string         `json:"error,omitempty"`
+	Summary  RunSummary     `json:"summary"`
+	Actions  []reportAction `json:"actions"`
+}
+
+func (d *reportDocument) encode(format string) ([]byte, error) {
+	if format != "csv" {
+		return json.MarshalIndent(d, "", "  ")
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"action", "key", "size", "duration_seconds", "error"})
+	for _, a := range d.Actions {
+		w.Write([]string{a.Action, a.Key, strconv.FormatInt(a.Size, 10), strconv.FormatFloat(a.Duration, 'f', 3, 64), a.Error})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// writeReport saves the report of the run that just finished to ReportPath
+// and, with ReportToBucket, to reportsPrefix in the bucket.
+func (s *Syncer) writeReport(started time.Time, runErr error) error {
+	if s.report == nil {
+		return nil
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	s.report.mu.Lock()
+	doc := &reportDocument{
+		Bucket:   s.cfg.Bucket,
+		RootDir:  s.cfg.RootDir,
+		Host:     host,
+		Started:  started.UTC(),
+		Finished: time.Now().UTC(),
+		Result:   "success",
+		Summary:  s.stats.summary(),
+		Actions:  append([]reportAction{}, s.report.actions...),
+	}
+	s.report.mu.Unlock()
+	if runErr != nil {
+		doc.Result = "failure"
+		doc.Error = runErr.Error()
+	}
+
+	format := s.cfg.ReportFormat
+	if format == "" {
+		format = "json"
+	}
+	data, err := doc.encode(format)
+	if err != nil {
+		return err
+	}
+	name := started.UTC().Format("20060102T150405Z") + "." + format
+
+	if s.cfg.ReportPath != "" {
+		if err := os.MkdirAll(s.cfg.ReportPath, 0755); err != nil {
+			return i18n.Errorf("file.create", s.cfg.ReportPath, err)
+		}
+		path := filepath.Join(s.cfg.ReportPath, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return i18n.Errorf("report.write", err)
+		}
+		fmt.Printf(i18n.T("report.written"), path)
+	}
+
+	if s.cfg.ReportToBucket {
+		contentType := "application/json"
+		if format == "csv" {
+			contentType = "text/csv"
+		}
+		input := &s3.PutObjectInput{
+			Bucket:      aws.String(s.cfg.Bucket),
+			Key:         aws.String(reportsPrefix + name),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String(contentType),
+		}
+		if err := s.setPutChecksum(input, bytes.NewReader(data)); err != nil {
+			return err
+		}
+		if _, err := s.client.PutObject(input); err != nil {
+			return i18n.Errorf("report.upload", err)
+		}
+	}
+	return nil
+}
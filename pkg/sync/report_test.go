@@ -0,0 +1,100 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: per-run report files
+func TestWriteReport(t *testing.T) {
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	withActions := func(s *Syncer) {
+		s.report = &runReport{}
+		s.report.add(reportAction{Action: actionUpload, Key: "a.txt", Size: 10, Duration: 0.5})
+		s.report.add(reportAction{Action: actionSkip, Key: "b.txt", Size: 20})
+		s.report.add(reportAction{Action: actionDelete, Key: "c.txt", Error: "AccessDenied"})
+	}
+
+	t.Run("JSON report in a local directory", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.ReportPath = t.TempDir()
+		withActions(s)
+
+		require.NoError(t, s.writeReport(started, errors.New("falhou")))
+
+		data, err := os.ReadFile(filepath.Join(s.cfg.ReportPath, "20240501T120000Z.json"))
+		require.NoError(t, err)
+		var doc reportDocument
+		require.NoError(t, json.Unmarshal(data, &doc))
+		assert.Equal(t, "failure", doc.Result)
+		assert.Equal(t, "falhou", doc.Error)
+		require.Len(t, doc.Actions, 3)
+		assert.Equal(t, "AccessDenied", doc.Actions[2].Error)
+	})
+
+	t.Run("CSV report", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.ReportPath = t.TempDir()
+		s.cfg.ReportFormat = "csv"
+		withActions(s)
+
+		require.NoError(t, s.writeReport(started, nil))
+
+		data, err := os.ReadFile(filepath.Join(s.cfg.ReportPath, "20240501T120000Z.csv"))
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		require.Len(t, lines, 4)
+		assert.Equal(t, "action,key,size,duration_seconds,error", lines[0])
+		assert.Equal(t, "upload,a.txt,10,0.500,", lines[1])
+	})
+
+	t.Run("report uploaded to the bucket", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+			return *input.Key == ".sync-reports/20240501T120000Z.json"
+		})).Return(&s3.PutObjectOutput{}, nil).Once()
+		s := newTestSyncer(t, mockClient)
+		s.cfg.ReportToBucket = true
+		withActions(s)
+
+		require.NoError(t, s.writeReport(started, nil))
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("disabled reports record nothing", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.report.add(reportAction{Action: actionSkip, Key: "a.txt"})
+		assert.NoError(t, s.writeReport(started, nil))
+	})
+}
+
+func TestReportsAreNotDeleted(t *testing.T) {
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		Contents: []*s3.Object{
+			{Key: aws.String(".sync-reports/20240501T120000Z.json")},
+			{Key: aws.String("gone.txt"), Size: aws.Int64(5)},
+		},
+	}, nil).Once()
+	mockClient.On("DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+		return *input.Key == "gone.txt"
+	})).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	s.report = &runReport{}
+	require.NoError(t, (&deleter{syncer: s}).run(keysOf()))
+
+	mockClient.AssertExpectations(t)
+	assert.Equal(t, []reportAction{{Action: actionDelete, Key: "gone.txt", Size: 5}}, s.report.actions)
+}
@@ -0,0 +1,589 @@
+package sync
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+const (
+	restoreWorkers = 5
+	// Objects larger than a part are downloaded in parts fetched
+	// concurrently, unless Config.DownloadPartSize and
+	// Config.DownloadConcurrency say otherwise.
+	downloadPartSize    = 16 * 1024 * 1024
+	downloadConcurrency = 5
+)
+
+// RestoreSelection picks the keys to restore: those equal to or below one
+// of Paths, and those starting with one of Prefixes, so the prefix
+// photos/2023 also selects photos/2023-summer/. An empty selection restores
+// every key.
+type RestoreSelection struct {
+	Paths    []string
+	Prefixes []string
+}
+
+// selects reports whether key is selected.
+func (sel RestoreSelection) selects(key string) bool {
+	if sel.empty() {
+		return true
+	}
+	for _, p := range sel.Paths {
+		p = nfc(strings.Trim(filepath.ToSlash(p), "/"))
+		if key == p || strings.HasPrefix(key, p+"/") {
+			return true
+		}
+	}
+	for _, p := range sel.Prefixes {
+		if strings.HasPrefix(key, nfc(strings.TrimPrefix(filepath.ToSlash(p), "/"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (sel RestoreSelection) empty() bool {
+	return len(sel.Paths) == 0 && len(sel.Prefixes) == 0
+}
+
+// restoreObject is a single object version selected for download.
+type restoreObject struct {
+	key          string
+	versionID    string
+	size         int64
+	lastModified time.Time
+	storageClass string
+}
+
+// asOfLayouts are the timestamp formats accepted by `restore --as-of`.
+var asOfLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Restore downloads the bucket into targetDir: the current objects, or when
+// asOf is set, the versions that were current at that point in time, which
+// requires a versioned bucket. Only the keys picked by sel are restored.
+// Archives made by archive mode are extracted; their indexes tell which
+// ones hold the selected keys.
+func (s *Syncer) Restore(targetDir string, asOf time.Time, sel RestoreSelection) error {
+	versioning, err := s.BucketVersioning()
+	if err != nil {
+		return err
+	}
+
+	var objects []restoreObject
+	if asOf.IsZero() {
+		objects, err = s.currentObjects()
+	} else {
+		if versioning == "" {
+			return i18n.Errorf("restore.no_versioning")
+		}
+		fmt.Printf(i18n.T("restore.as_of"), asOf.Format(time.RFC3339))
+		objects, err = s.objectsAsOf(asOf)
+	}
+	if err != nil {
+		return err
+	}
+	return s.restoreObjects(targetDir, objects, sel)
+}
+
+// restoreObjects downloads the selected objects into targetDir, for Restore
+// and RestoreManifest. Files are downloaded by restoreWorkers at a time,
+// each one printed with the progress of the restore; archives are then
+// extracted one by one. Objects in Glacier are thawed first, and downloaded
+// once every other file is.
+func (s *Syncer) restoreObjects(targetDir string, objects []restoreObject, sel RestoreSelection) error {
+	indexes := make(map[string]restoreObject)
+	var archives, files []restoreObject
+	var total int64
+	for _, obj := range objects {
+		switch {
+		case strings.HasPrefix(obj.key, reservedPrefix) || strings.HasPrefix(obj.key, reportsPrefix):
+			// The state of gui-sync itself is not part of the tree.
+		case strings.HasSuffix(obj.key, archiveIndexSuffix):
+			indexes[strings.TrimSuffix(obj.key, archiveIndexSuffix)] = obj
+		case strings.HasSuffix(obj.key, archiveSuffix):
+			archives = append(archives, obj)
+		case sel.selects(s.localName(obj.key)):
+			files = append(files, obj)
+			total += obj.size
+		}
+	}
+
+	fmt.Printf(i18n.T("restore.plan"), len(files), float64(total)/(1024*1024), len(archives), targetDir)
+
+	var selectedArchives, ready, frozen []restoreObject
+	for _, obj := range archives {
+		dir := strings.TrimSuffix(obj.key, archiveSuffix)
+		if s.archiveHasSelected(indexes[dir], !sel.empty(), sel.selects) {
+			selectedArchives = append(selectedArchives, obj)
+		}
+	}
+
+	// Keys differing only in case would overwrite each other's file.
+	var collisions map[string]string
+	if caseInsensitiveFS {
+		keys := make([]string, len(files))
+		for i, obj := range files {
+			keys[i] = s.localName(obj.key)
+		}
+		collisions = caseCollisions(keys)
+	}
+	for _, obj := range append(files, selectedArchives...) {
+		if _, ok := collisions[s.localName(obj.key)]; ok {
+			continue
+		}
+		if frozenClass(obj.storageClass) {
+			frozen = append(frozen, obj)
+		} else if !strings.HasSuffix(obj.key, archiveSuffix) {
+			ready = append(ready, obj)
+		}
+	}
+
+	progress := &restoreProgress{total: len(files)}
+	for _, obj := range files {
+		if other, ok := collisions[s.localName(obj.key)]; ok {
+			progress.fail(obj.key, i18n.Errorf("restore.case_collision", other))
+		}
+	}
+	late := s.downloadFiles(ready, targetDir, progress)
+	thawedObjects := s.thaw(append(frozen, late...), progress)
+	var thawedFiles []restoreObject
+	thawedArchives := make(map[string]bool)
+	for _, obj := range thawedObjects {
+		if strings.HasSuffix(obj.key, archiveSuffix) {
+			thawedArchives[obj.key] = true
+		} else {
+			thawedFiles = append(thawedFiles, obj)
+		}
+	}
+	for _, obj := range s.downloadFiles(thawedFiles, targetDir, progress) {
+		progress.fail(obj.key, errFrozen)
+	}
+	s.restoreHardLinks(targetDir, objects, progress)
+
+	for _, obj := range selectedArchives {
+		if frozenClass(obj.storageClass) && !thawedArchives[obj.key] {
+			continue
+		}
+		count, err := s.extractArchive(obj, targetDir, sel.selects)
+		if err != nil {
+			progress.fail(obj.key, err)
+			continue
+		}
+		fmt.Printf(i18n.T("restore.extracted"), obj.key, count)
+	}
+
+	if progress.failed > 0 {
+		return i18n.Errorf("restore.failed", progress.failed)
+	}
+	return nil
+}
+
+// restoreProgress counts the files of a restore as they are downloaded.
+type restoreProgress struct {
+	mu         sync.Mutex
+	total      int
+	done       int
+	failed     int
+	downloaded int64
+	// restored holds the keys of the files restored, and links the hard
+	// links waiting for them.
+	restored map[string]bool
+	links    []pendingLink
+}
+
+func (p *restoreProgress) fail(key string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failed++
+	fmt.Printf("  ❌ %s - %v\n", key, err)
+}
+
+func (p *restoreProgress) succeed(obj restoreObject) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.downloaded += obj.size
+	if p.restored == nil {
+		p.restored = make(map[string]bool)
+	}
+	p.restored[obj.key] = true
+	fmt.Printf(i18n.T("restore.downloaded"), p.done, p.total, obj.key, obj.size, float64(p.downloaded)/(1024*1024))
+}
+
+// downloadFiles downloads files into targetDir, restoreWorkers at a time,
+// returning those found to be in Glacier. Hard links are left to
+// restoreHardLinks.
+func (s *Syncer) downloadFiles(files []restoreObject, targetDir string, progress *restoreProgress) []restoreObject {
+	var mu sync.Mutex
+	var frozen []restoreObject
+	queue := make(chan restoreObject)
+	var wg sync.WaitGroup
+	for i := 0; i < restoreWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range queue {
+				var link *linkedObject
+				switch err := s.downloadObject(obj, targetDir); {
+				case errors.Is(err, errFrozen):
+					mu.Lock()
+					frozen = append(frozen, obj)
+					mu.Unlock()
+				case errors.As(err, &link):
+					progress.link(obj, link.target)
+				case err != nil:
+					progress.fail(obj.key, err)
+				default:
+					progress.succeed(obj)
+				}
+			}
+		}()
+	}
+	for _, obj := range files {
+		queue <- obj
+	}
+	close(queue)
+	wg.Wait()
+	return frozen
+}
+
+// archiveHasSelected reports whether the archive described by index holds a
+// selected file. Without a path filter, or an index to check, the archive
+// is downloaded anyway.
+func (s *Syncer) archiveHasSelected(index restoreObject, filtered bool, selected func(key string) bool) bool {
+	if !filtered || index.key == "" {
+		return true
+	}
+	contents, err := s.readArchiveIndexVersion(index.key, index.versionID)
+	if err != nil || contents == nil {
+		return true
+	}
+	for _, f := range contents.Files {
+		if selected(f.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAsOf parses a point in time given to `restore --as-of`, in any of
+// the asOfLayouts. Timestamps without a zone are local time.
+func ParseAsOf(value string) (time.Time, error) {
+	for _, layout := range asOfLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, i18n.Errorf("restore.invalid_date", value)
+}
+
+// BucketVersioning returns the bucket versioning status ("Enabled",
+// "Suspended"), or an empty string when versioning was never enabled.
+func (s *Syncer) BucketVersioning() (string, error) {
+	output, err := s.client.GetBucketVersioning(&s3.GetBucketVersioningInput{
+		Bucket: aws.String(s.cfg.Bucket),
+	})
+	if err != nil {
+		return "", i18n.Errorf("restore.versioning", err)
+	}
+	return aws.StringValue(output.Status), nil
+}
+
+func (s *Syncer) currentObjects() ([]restoreObject, error) {
+	var objects []restoreObject
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.cfg.Bucket),
+		Prefix: optionalString(s.keyPrefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			objects = append(objects, restoreObject{
+				key:          aws.StringValue(obj.Key),
+				size:         aws.Int64Value(obj.Size),
+				lastModified: aws.TimeValue(obj.LastModified),
+				storageClass: aws.StringValue(obj.StorageClass),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, i18n.Errorf("s3.list_objects", err)
+	}
+	return objects, nil
+}
+
+// objectsAsOf picks, for every key, the newest version or delete marker
+// created at or before asOf. Keys whose newest entry is a delete marker did
+// not exist at that time and are left out. Listings carry times to the
+// second, so entries created in the same second tie: the one S3 holds as
+// latest wins, and otherwise the version, as restoring a file too many
+// beats losing one.
+func (s *Syncer) objectsAsOf(asOf time.Time) ([]restoreObject, error) {
+	type candidate struct {
+		object  restoreObject
+		deleted bool
+		latest  bool
+	}
+	latest := make(map[string]candidate)
+	var order []string
+
+	newer := func(c, current candidate) bool {
+		if !c.object.lastModified.Equal(current.object.lastModified) {
+			return c.object.lastModified.After(current.object.lastModified)
+		}
+		if c.latest != current.latest {
+			return c.latest
+		}
+		return current.deleted && !c.deleted
+	}
+	consider := func(key string, c candidate) {
+		if c.object.lastModified.After(asOf) {
+			return
+		}
+		current, seen := latest[key]
+		if !seen {
+			order = append(order, key)
+		}
+		if !seen || newer(c, current) {
+			latest[key] = c
+		}
+	}
+
+	err := s.client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Prefix: optionalString(s.keyPrefix),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		for _, v := range page.Versions {
+			consider(aws.StringValue(v.Key), candidate{object: restoreObject{
+				key:          aws.StringValue(v.Key),
+				versionID:    aws.StringValue(v.VersionId),
+				size:         aws.Int64Value(v.Size),
+				lastModified: aws.TimeValue(v.LastModified),
+				storageClass: aws.StringValue(v.StorageClass),
+			}, latest: aws.BoolValue(v.IsLatest)})
+		}
+		for _, m := range page.DeleteMarkers {
+			consider(aws.StringValue(m.Key), candidate{
+				object:  restoreObject{key: aws.StringValue(m.Key), lastModified: aws.TimeValue(m.LastModified)},
+				deleted: true,
+				latest:  aws.BoolValue(m.IsLatest),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, i18n.Errorf("restore.list_versions", err)
+	}
+
+	var objects []restoreObject
+	for _, key := range order {
+		if c := latest[key]; !c.deleted {
+			objects = append(objects, c.object)
+		}
+	}
+	return objects, nil
+}
+
+// downloadObject writes obj below targetDir, going through a temporary file
+// so an interrupted download never leaves a truncated file behind. Objects
+// larger than a download part are fetched in parts, except compressed
+// ones, which are decompressed as a single stream.
+func (s *Syncer) downloadObject(obj restoreObject, targetDir string) error {
+	localPath, err := restorePath(targetDir, s.localName(obj.key))
+	if err != nil {
+		return err
+	}
+	return s.downloadTo(obj, localPath)
+}
+
+// downloadTo writes obj to localPath, for downloadObject. An object
+// standing for a hard link is not written: a *linkedObject names the file
+// to link to.
+func (s *Syncer) downloadTo(obj restoreObject, localPath string) error {
+	if obj.size > s.downloadPartSize() {
+		head := &s3.HeadObjectInput{Bucket: aws.String(s.cfg.Bucket), Key: aws.String(obj.key)}
+		if obj.versionID != "" {
+			head.VersionId = aws.String(obj.versionID)
+		}
+		output, err := s.client.HeadObject(head)
+		if err != nil {
+			return i18n.Errorf("s3.head", err)
+		}
+		if frozenClass(aws.StringValue(output.StorageClass)) && !thawed(output.Restore) {
+			return errFrozen
+		}
+		if _, compressed := metadataValue(output.Metadata, compressionMetaKey); !compressed {
+			if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+				return i18n.Errorf("file.mkdir", err)
+			}
+			if err := s.downloadParts(obj, localPath); err != nil {
+				return err
+			}
+			return restoreAttributes(localPath, obj, output.Metadata)
+		}
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(obj.key),
+	}
+	if obj.versionID != "" {
+		input.VersionId = aws.String(obj.versionID)
+	}
+	output, err := s.client.GetObject(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeInvalidObjectState {
+			return errFrozen
+		}
+		return i18n.Errorf("s3.download", err)
+	}
+	defer output.Body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return i18n.Errorf("file.mkdir", err)
+	}
+
+	if target, ok := storedSymlink(output.Metadata); ok {
+		return restoreSymlink(localPath, target)
+	}
+	if target, ok := storedHardLink(output.Metadata); ok {
+		return &linkedObject{target: target}
+	}
+
+	body, err := decompressedBody(output)
+	if err != nil {
+		return err
+	}
+	if err := writeRestoredFile(localPath, body); err != nil {
+		return err
+	}
+	return restoreAttributes(localPath, obj, output.Metadata)
+}
+
+// restoreAttributes applies the permissions, extended attributes and
+// modification time stored with obj to the file restored at localPath.
+// Objects uploaded by the syncer carry the original ones; others get the
+// upload time.
+func restoreAttributes(localPath string, obj restoreObject, metadata map[string]*string) error {
+	if mode, ok := storedMode(metadata); ok {
+		if err := os.Chmod(localPath, mode); err != nil {
+			return i18n.Errorf("file.chmod", err)
+		}
+	}
+	restoreXattrs(localPath, metadata)
+	modTime := obj.lastModified
+	if stored, ok := storedModTime(metadata); ok {
+		modTime = stored
+	}
+	if !modTime.IsZero() {
+		os.Chtimes(localPath, modTime, modTime)
+	}
+	return nil
+}
+
+// downloadParts writes obj to localPath through a temporary file, with
+// s3manager fetching its parts concurrently.
+func (s *Syncer) downloadParts(obj restoreObject, localPath string) error {
+	input := &s3.GetObjectInput{Bucket: aws.String(s.cfg.Bucket), Key: aws.String(obj.key)}
+	if obj.versionID != "" {
+		input.VersionId = aws.String(obj.versionID)
+	}
+	downloader := s3manager.NewDownloaderWithClient(s.client, func(d *s3manager.Downloader) {
+		d.PartSize = s.downloadPartSize()
+		d.Concurrency = cmp.Or(s.cfg.DownloadConcurrency, downloadConcurrency)
+	})
+
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), ".gui-sync-restore-*")
+	if err != nil {
+		return i18n.Errorf("file.temp", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := downloader.Download(tmp, input); err != nil {
+		tmp.Close()
+		return i18n.Errorf("s3.download", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return i18n.Errorf("file.write", err)
+	}
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		return i18n.Errorf("restore.move", err)
+	}
+	return nil
+}
+
+func (s *Syncer) downloadPartSize() int64 {
+	return cmp.Or(s.cfg.DownloadPartSize, downloadPartSize)
+}
+
+// writeRestoredFile writes body to localPath through a temporary file in
+// the same directory.
+func writeRestoredFile(localPath string, body io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), ".gui-sync-restore-*")
+	if err != nil {
+		return i18n.Errorf("file.temp", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return i18n.Errorf("file.write", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return i18n.Errorf("file.write", err)
+	}
+
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		return i18n.Errorf("restore.move", err)
+	}
+	return nil
+}
+
+// restoreSymlink recreates at localPath a symbolic link to target,
+// replacing whatever is there.
+func restoreSymlink(localPath, target string) error {
+	if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+		return i18n.Errorf("restore.replace", localPath, err)
+	}
+	if err := os.Symlink(target, localPath); err != nil {
+		return i18n.Errorf("restore.symlink", err)
+	}
+	return nil
+}
+
+// restorePath maps an S3 key to a path inside targetDir, rejecting keys that
+// would escape it or that name no file Windows can create. Names already
+// restored in decomposed form are reused, and on Windows the path is
+// extended past MAX_PATH.
+func restorePath(targetDir, key string) (string, error) {
+	if runtime.GOOS == "windows" {
+		if err := windowsNameError(key); err != nil {
+			return "", err
+		}
+	}
+	localPath := filepath.Join(targetDir, filepath.FromSlash(key))
+	rel, err := filepath.Rel(targetDir, localPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", i18n.Errorf("restore.invalid_key", key)
+	}
+	return longPath(existingPath(targetDir, rel)), nil
+}
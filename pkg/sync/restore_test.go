@@ -0,0 +1,262 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: restore subcommand
+func TestObjectsAsOf(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(hours int) *time.Time {
+		ts := base.Add(time.Duration(hours) * time.Hour)
+		return &ts
+	}
+
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectVersionsPages", mock.Anything, mock.Anything).Return(
+		&s3.ListObjectVersionsOutput{
+			Versions: []*s3.ObjectVersion{
+				{Key: aws.String("a.txt"), VersionId: aws.String("a1"), LastModified: at(-2), Size: aws.Int64(1)},
+				{Key: aws.String("a.txt"), VersionId: aws.String("a2"), LastModified: at(-1), Size: aws.Int64(2)},
+				{Key: aws.String("a.txt"), VersionId: aws.String("a3"), LastModified: at(1), Size: aws.Int64(3)},
+				{Key: aws.String("b.txt"), VersionId: aws.String("b1"), LastModified: at(-3), Size: aws.Int64(1)},
+				{Key: aws.String("c.txt"), VersionId: aws.String("c1"), LastModified: at(2), Size: aws.Int64(1)},
+				{Key: aws.String("d.txt"), VersionId: aws.String("d1"), LastModified: at(-5), Size: aws.Int64(1)},
+			},
+			DeleteMarkers: []*s3.DeleteMarkerEntry{
+				{Key: aws.String("b.txt"), VersionId: aws.String("b2"), LastModified: at(-2)},
+				{Key: aws.String("d.txt"), VersionId: aws.String("d2"), LastModified: at(3)},
+			},
+		},
+		nil,
+	).Once()
+
+	objects, err := newTestSyncer(t, mockClient).objectsAsOf(base)
+	require.NoError(t, err)
+
+	versions := map[string]string{}
+	for _, obj := range objects {
+		versions[obj.key] = obj.versionID
+	}
+
+	assert.Equal(t, map[string]string{"a.txt": "a2", "d.txt": "d1"}, versions)
+	mockClient.AssertExpectations(t)
+}
+
+func TestObjectsAsOfEqualTimes(t *testing.T) {
+	second := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectVersionsPages", mock.Anything, mock.Anything).Return(
+		&s3.ListObjectVersionsOutput{
+			Versions: []*s3.ObjectVersion{
+				{Key: aws.String("deleted.txt"), VersionId: aws.String("d1"), LastModified: &second, IsLatest: aws.Bool(false)},
+				{Key: aws.String("rewritten.txt"), VersionId: aws.String("r2"), LastModified: &second, IsLatest: aws.Bool(true)},
+				{Key: aws.String("older.txt"), VersionId: aws.String("o1"), LastModified: &second, IsLatest: aws.Bool(false)},
+			},
+			DeleteMarkers: []*s3.DeleteMarkerEntry{
+				{Key: aws.String("deleted.txt"), VersionId: aws.String("d2"), LastModified: &second, IsLatest: aws.Bool(true)},
+				{Key: aws.String("rewritten.txt"), VersionId: aws.String("r1"), LastModified: &second, IsLatest: aws.Bool(false)},
+				{Key: aws.String("older.txt"), VersionId: aws.String("o2"), LastModified: &second, IsLatest: aws.Bool(false)},
+			},
+		},
+		nil,
+	).Once()
+
+	objects, err := newTestSyncer(t, mockClient).objectsAsOf(second)
+	require.NoError(t, err)
+
+	versions := map[string]string{}
+	for _, obj := range objects {
+		versions[obj.key] = obj.versionID
+	}
+	// The latest entry wins a tie; without one, the version is restored.
+	assert.Equal(t, map[string]string{"rewritten.txt": "r2", "older.txt": "o1"}, versions)
+}
+
+func TestDownloadObject(t *testing.T) {
+	t.Run("download specific version", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		tempDir := t.TempDir()
+		modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+		mockClient.On("GetObject", mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return *input.Key == "dir/file.txt" && *input.VersionId == "v1"
+		})).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("old content"))}, nil).Once()
+
+		err := newTestSyncer(t, mockClient).downloadObject(restoreObject{key: "dir/file.txt", versionID: "v1", lastModified: modified}, tempDir)
+		require.NoError(t, err)
+
+		localPath := filepath.Join(tempDir, "dir", "file.txt")
+		content, err := os.ReadFile(localPath)
+		require.NoError(t, err)
+		assert.Equal(t, "old content", string(content))
+
+		info, err := os.Stat(localPath)
+		require.NoError(t, err)
+		assert.True(t, info.ModTime().Equal(modified))
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("restore permissions, mtime and symlinks from metadata", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		tempDir := t.TempDir()
+		original := time.Date(2023, 1, 2, 3, 4, 5, 6, time.UTC)
+
+		mockClient.On("GetObject", mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return *input.Key == "bin/run.sh"
+		})).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(strings.NewReader("#!/bin/sh")),
+			Metadata: map[string]*string{
+				"Gui-Sync-Mode":  aws.String("750"),
+				"Gui-Sync-Mtime": aws.String(strconv.FormatInt(original.UnixNano(), 10)),
+			},
+		}, nil).Once()
+		mockClient.On("GetObject", mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return *input.Key == "bin/current"
+		})).Return(&s3.GetObjectOutput{
+			Body:     io.NopCloser(strings.NewReader("")),
+			Metadata: map[string]*string{"Gui-Sync-Symlink": aws.String("run%20old.sh")},
+		}, nil).Once()
+
+		s := newTestSyncer(t, mockClient)
+		require.NoError(t, s.downloadObject(restoreObject{key: "bin/run.sh", lastModified: time.Now()}, tempDir))
+		require.NoError(t, s.downloadObject(restoreObject{key: "bin/current"}, tempDir))
+
+		info, err := os.Stat(filepath.Join(tempDir, "bin", "run.sh"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+		assert.True(t, info.ModTime().Equal(original))
+
+		target, err := os.Readlink(filepath.Join(tempDir, "bin", "current"))
+		require.NoError(t, err)
+		assert.Equal(t, "run old.sh", target)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("large objects are downloaded in parts", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		data := bytes.Repeat([]byte("0123456789"), 300)
+		mockClient.On("HeadObject", mock.MatchedBy(func(input *s3.HeadObjectInput) bool {
+			return *input.Key == "disk.img" && *input.VersionId == "v2"
+		})).Return(&s3.HeadObjectOutput{Metadata: map[string]*string{"Gui-Sync-Mode": aws.String("600")}}, nil).Once()
+		client := &rangeClient{mockS3Client: mockClient, data: data}
+
+		s := newTestSyncer(t, client)
+		s.cfg.DownloadPartSize = 1024
+		tempDir := t.TempDir()
+		require.NoError(t, s.downloadObject(restoreObject{key: "disk.img", versionID: "v2", size: int64(len(data))}, tempDir))
+
+		content, err := os.ReadFile(filepath.Join(tempDir, "disk.img"))
+		require.NoError(t, err)
+		assert.Equal(t, data, content)
+		assert.Equal(t, []string{"v2", "v2", "v2"}, client.versions)
+		info, err := os.Stat(filepath.Join(tempDir, "disk.img"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		mockClient.AssertNotCalled(t, "GetObject", mock.Anything)
+	})
+
+	t.Run("reject keys escaping the target directory", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		err := newTestSyncer(t, mockClient).downloadObject(restoreObject{key: "../outside.txt"}, t.TempDir())
+		assert.Error(t, err)
+		mockClient.AssertNotCalled(t, "GetObject", mock.Anything)
+	})
+}
+
+// rangeClient serves the byte ranges of data that s3manager asks for,
+// recording the version of each request.
+type rangeClient struct {
+	*mockS3Client
+	data []byte
+
+	mu       sync.Mutex
+	versions []string
+}
+
+func (c *rangeClient) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	var start, end int
+	if _, err := fmt.Sscanf(aws.StringValue(input.Range), "bytes=%d-%d", &start, &end); err != nil {
+		return nil, err
+	}
+	end = min(end, len(c.data)-1)
+	c.mu.Lock()
+	c.versions = append(c.versions, aws.StringValue(input.VersionId))
+	c.mu.Unlock()
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(c.data[start : end+1])),
+		ContentLength: aws.Int64(int64(end - start + 1)),
+		ContentRange:  aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, len(c.data))),
+	}, nil
+}
+
+func TestParseAsOf(t *testing.T) {
+	ts, err := ParseAsOf("2024-05-01T12:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), ts.UTC())
+
+	_, err = ParseAsOf("2024-05-01")
+	assert.NoError(t, err)
+
+	_, err = ParseAsOf("ontem")
+	assert.Error(t, err)
+}
+
+func TestRestoreSelection(t *testing.T) {
+	sel := RestoreSelection{Paths: []string{"/documentos/"}, Prefixes: []string{"fotos/2023"}}
+	for key, want := range map[string]bool{
+		"documentos":              true,
+		"documentos/a.txt":        true,
+		"documentos-velhos/a.txt": false,
+		"fotos/2023/praia.jpg":    true,
+		"fotos/2023-ferias/a.jpg": true,
+		"fotos/2022/praia.jpg":    false,
+	} {
+		assert.Equal(t, want, sel.selects(key), key)
+	}
+	assert.True(t, RestoreSelection{}.selects("qualquer/chave"))
+}
+
+func TestRestoreObjects(t *testing.T) {
+	mockClient := new(mockS3Client)
+	var objects []restoreObject
+	for i := 0; i < 2*restoreWorkers; i++ {
+		key := "fotos/2023/" + strconv.Itoa(i) + ".jpg"
+		objects = append(objects, restoreObject{key: key, size: 1})
+		mockClient.On("GetObject", mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return *input.Key == key
+		})).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("x"))}, nil).Once()
+	}
+	objects = append(objects,
+		restoreObject{key: "fotos/2022/antiga.jpg", size: 1},
+		restoreObject{key: manifestKey, size: 1},
+		restoreObject{key: reportsPrefix + "relatorio.json", size: 1},
+	)
+
+	s := newTestSyncer(t, mockClient)
+	target := t.TempDir()
+	require.NoError(t, s.restoreObjects(target, objects, RestoreSelection{Prefixes: []string{"fotos/2023"}}))
+	mockClient.AssertExpectations(t)
+
+	restored, err := filepath.Glob(filepath.Join(target, "fotos", "2023", "*.jpg"))
+	require.NoError(t, err)
+	assert.Len(t, restored, 2*restoreWorkers)
+	assert.NoDirExists(t, filepath.Join(target, "fotos", "2022"))
+	assert.NoDirExists(t, filepath.Join(target, "_gui-sync"), "the state of gui-sync is not restored")
+}
@@ -0,0 +1,168 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// FileStatus tells what went wrong with a file in a run.
+type FileStatus string
+
+const (
+	StatusUploadFailed FileStatus = "upload_failed"
+	StatusDeleteFailed FileStatus = "delete_failed"
+	// StatusArchiveFailed is a directory of archive mode whose archive
+	// could not be built or uploaded; Path is the directory.
+	StatusArchiveFailed FileStatus = "archive_failed"
+	// StatusUnreadable is a local file or directory the scanner skipped.
+	// It is reported but does not fail the run.
+	StatusUnreadable FileStatus = "unreadable"
+	// StatusLocked is an object whose deletion Object Lock refused. It is
+	// reported but does not fail the run.
+	StatusLocked FileStatus = "locked"
+	// StatusInvalidKey is a local file whose name cannot be a key. It is
+	// reported but does not fail the run.
+	StatusInvalidKey FileStatus = "invalid_key"
+)
+
+// reported tells the statuses that are reported without failing the run.
+func (s FileStatus) reported() bool {
+	return s == StatusUnreadable || s == StatusLocked || s == StatusInvalidKey
+}
+
+// FileResult is the outcome of one file that could not be synced.
+type FileResult struct {
+	Key string
+	// Path is the local path; empty for deletions.
+	Path   string
+	Status FileStatus
+	Err    error
+	// Retriable is set when the error looks transient (throttling, server
+	// or network errors), so syncing the file again may succeed.
+	Retriable bool
+}
+
+// SyncResult collects the files a run could not sync. Files that were
+// uploaded, skipped or deleted are only counted in the run statistics.
+type SyncResult struct {
+	mu    sync.Mutex
+	Files []FileResult
+}
+
+func (r *SyncResult) add(file FileResult) {
+	file.Retriable = !file.Status.reported() && isRetriable(file.Err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Files = append(r.Files, file)
+}
+
+// Failed returns the files whose upload or deletion failed.
+func (r *SyncResult) Failed() []FileResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var failed []FileResult
+	for _, f := range r.Files {
+		if !f.Status.reported() {
+			failed = append(failed, f)
+		}
+	}
+	return failed
+}
+
+// takeRetriable removes the retriable failures from r and returns them.
+func (r *SyncResult) takeRetriable() []FileResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var retriable, kept []FileResult
+	for _, f := range r.Files {
+		if f.Retriable {
+			retriable = append(retriable, f)
+		} else {
+			kept = append(kept, f)
+		}
+	}
+	r.Files = kept
+	return retriable
+}
+
+// Err returns a *SyncError when any upload or deletion failed.
+func (r *SyncResult) Err() error {
+	if len(r.Failed()) == 0 {
+		return nil
+	}
+	return &SyncError{Result: r}
+}
+
+// SyncError is returned by runs in which some files failed while the rest
+// were synced. Result lists the failures.
+type SyncError struct {
+	Result *SyncResult
+}
+
+// maxListedFailures caps how many files SyncError.Error names.
+const maxListedFailures = 5
+
+func (e *SyncError) Error() string {
+	failed := e.Result.Failed()
+	var b strings.Builder
+	fmt.Fprintf(&b, i18n.T("result.failed"), len(failed))
+	for i, f := range failed {
+		if i == maxListedFailures {
+			fmt.Fprintf(&b, i18n.T("result.more"), len(failed)-maxListedFailures)
+			break
+		}
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "%s: %v", f.Key, f.Err)
+	}
+	return b.String()
+}
+
+// retriableErrorCodes are the AWS error codes of transient failures.
+var retriableErrorCodes = []string{
+	"RequestError",
+	"RequestTimeout",
+	"SlowDown",
+	"Throttling",
+	"ThrottlingException",
+	"InternalError",
+	"ServiceUnavailable",
+}
+
+// isRetriable reports whether err is transient: a failed verification, an
+// AWS error with one of retriableErrorCodes or a 5xx or 429 status, or a
+// connection reset or timeout.
+func isRetriable(err error) bool {
+	if err == nil || isCredentialError(err) {
+		return false
+	}
+	var verifyErr *VerifyError
+	if errors.As(err, &verifyErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.Is(err, syscall.ECONNRESET) || errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return findAWSError(err, func(aerr awserr.Error) bool {
+		if slices.Contains(retriableErrorCodes, aerr.Code()) {
+			return true
+		}
+		var failure awserr.RequestFailure
+		if errors.As(aerr, &failure) {
+			status := failure.StatusCode()
+			return status >= 500 || status == http.StatusTooManyRequests
+		}
+		return false
+	})
+}
@@ -0,0 +1,113 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: typed run results
+func TestIsRetriable(t *testing.T) {
+	assert.True(t, isRetriable(i18n.Errorf("s3.upload", awserr.NewRequestFailure(awserr.New("InternalError", "boom", nil), 500, "id"))))
+	assert.True(t, isRetriable(i18n.Errorf("s3.upload", awserr.NewRequestFailure(awserr.New("SlowDown", "slow", nil), 503, "id"))))
+	assert.True(t, isRetriable(i18n.Errorf("s3.upload", awserr.NewRequestFailure(awserr.New("Unknown", "", nil), 429, "id"))), "decided by the status")
+	assert.True(t, isRetriable(awserr.New("RequestError", "send request failed", syscall.ECONNRESET)))
+	assert.True(t, isRetriable(i18n.Errorf("s3.upload", &net.OpError{Op: "read", Err: syscall.ECONNRESET})))
+	assert.False(t, isRetriable(i18n.Errorf("s3.upload", awserr.NewRequestFailure(awserr.New("AccessDenied", "denied", nil), 403, "id"))))
+	assert.False(t, isRetriable(awserr.NewRequestFailure(awserr.New("ExpiredToken", "expired", nil), 500, "id")), "credential errors need re-authentication")
+	assert.False(t, isRetriable(i18n.Errorf("file.open", os.ErrPermission)))
+	assert.False(t, isRetriable(errors.New("InternalError: status code: 500")), "codes are not guessed from the text")
+}
+
+func TestSyncResult(t *testing.T) {
+	result := &SyncResult{}
+	assert.NoError(t, result.Err())
+
+	result.add(FileResult{Key: "locked", Status: StatusUnreadable, Err: errors.New("permission denied")})
+	assert.NoError(t, result.Err(), "unreadable entries do not fail the run")
+
+	unavailable := awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "Service Unavailable", nil), 503, "id")
+	for i := 0; i < 7; i++ {
+		result.add(FileResult{Key: fmt.Sprintf("f%d.txt", i), Status: StatusUploadFailed, Err: unavailable})
+	}
+	err := result.Err()
+	var syncErr *SyncError
+	require.True(t, errors.As(err, &syncErr))
+	assert.Len(t, syncErr.Result.Failed(), 7)
+	assert.True(t, syncErr.Result.Failed()[0].Retriable)
+	assert.Contains(t, err.Error(), "7 files")
+	assert.Contains(t, err.Error(), "and 2 more")
+	assert.NotContains(t, err.Error(), "f6.txt")
+}
+
+func TestSyncDirectoryReportsFailedFiles(t *testing.T) {
+	notFound := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "ok.txt", "ok")
+	createTempFile(t, tempDir, "bad.txt", "bad")
+
+	mockClient := new(mockS3Client)
+	mockClient.On("HeadObject", mock.Anything).Return(nil, notFound)
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return *input.Key == "bad.txt"
+	})).Return(nil, awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "id")).Once()
+	mockClient.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	result, err := s.syncDirectoryWithS3(context.Background(), tempDir)
+	require.NoError(t, err)
+
+	failed := result.Failed()
+	require.Len(t, failed, 1)
+	assert.Equal(t, "bad.txt", failed[0].Key)
+	assert.Equal(t, StatusUploadFailed, failed[0].Status)
+	assert.False(t, failed[0].Retriable)
+	mockClient.AssertNotCalled(t, "ListObjectsV2Pages", mock.Anything, mock.Anything)
+}
+
+func TestRetryFailedFiles(t *testing.T) {
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	notFound := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")
+	slowDown := awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate", nil), 503, "id")
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "flaky.txt", "flaky")
+	createTempFile(t, tempDir, "down.txt", "down")
+
+	mockClient := new(mockS3Client)
+	mockClient.On("HeadObject", mock.Anything).Return(nil, notFound)
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return *input.Key == "flaky.txt"
+	})).Return(nil, slowDown).Twice()
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return *input.Key == "flaky.txt"
+	})).Return(&s3.PutObjectOutput{}, nil).Once()
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return *input.Key == "down.txt"
+	})).Return(nil, slowDown).Times(1 + endOfRunRetries)
+
+	s := newTestSyncer(t, mockClient)
+	result, err := s.syncDirectoryWithS3(context.Background(), tempDir)
+	require.NoError(t, err)
+
+	failed := result.Failed()
+	require.Len(t, failed, 1, "only the file failing every pass is left")
+	assert.Equal(t, "down.txt", failed[0].Key)
+	summary := s.stats.summary()
+	assert.Equal(t, int64(1), summary.Uploaded)
+	assert.Equal(t, int64(1), summary.Failed)
+	mockClient.AssertExpectations(t)
+}
@@ -0,0 +1,251 @@
+package sync
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// endOfRunRetries bounds the retry passes over transient failures at the
+// end of a run; the wait before pass n is retryBackoff * 2^(n-1).
+const endOfRunRetries = 3
+
+// retryBackoff is a variable so tests can shorten it.
+var retryBackoff = 2 * time.Second
+
+// retryFailed syncs again the files of result whose failure looked
+// transient, instead of leaving them for the next scheduled run. Files
+// that still fail stay in result.
+func (s *Syncer) retryFailed(ctx context.Context, result *SyncResult) {
+	wait := retryBackoff
+	for pass := 1; pass <= endOfRunRetries; pass++ {
+		files := result.takeRetriable()
+		if len(files) == 0 {
+			return
+		}
+
+		log.Printf(i18n.T("retry.retrying"), len(files), wait, pass, endOfRunRetries)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			for _, f := range files {
+				result.add(f)
+			}
+			return
+		}
+		wait *= 2
+
+		for _, f := range files {
+			if err := s.retryFile(f); err != nil {
+				f.Err = err
+				result.add(f)
+			}
+		}
+	}
+}
+
+// retryFile repeats the operation that failed for f.
+func (s *Syncer) retryFile(f FileResult) error {
+	switch f.Status {
+	case StatusUploadFailed:
+		info, err := os.Stat(f.Path)
+		if err != nil {
+			return i18n.Errorf("file.stat", err)
+		}
+		start := time.Now()
+		size, err := s.uploadFileS3(f.Key, f.Path, info.Size())
+		// A file being written is no longer a failure, only left for the
+		// next run.
+		var busyErr *BusyError
+		if errors.As(err, &busyErr) {
+			s.stats.failed.Add(-1)
+			s.deferBusy(f.Key, err)
+			return nil
+		}
+		action := reportAction{Action: actionUpload, Key: f.Key, Size: info.Size(), Duration: time.Since(start).Seconds()}
+		if err != nil {
+			action.Error = err.Error()
+			s.report.add(action)
+			return err
+		}
+		s.report.add(action)
+		s.stats.failed.Add(-1)
+		s.stats.uploaded.Add(1)
+		s.stats.bytesUploaded.Add(size)
+		fmt.Printf(i18n.T("retry.uploaded"), f.Key, size)
+		return nil
+
+	case StatusArchiveFailed:
+		if err := s.syncArchive(filepath.Dir(f.Path), filepath.Base(f.Path), nil); err != nil {
+			return err
+		}
+		s.stats.failed.Add(-1)
+		return nil
+
+	case StatusDeleteFailed:
+		_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(s.cfg.Bucket),
+			Key:    aws.String(f.Key),
+		})
+		action := reportAction{Action: actionDelete, Key: f.Key}
+		if err != nil {
+			action.Error = err.Error()
+			s.report.add(action)
+			return err
+		}
+		s.report.add(action)
+		s.stats.deleted.Add(1)
+		fmt.Printf(i18n.T("retry.deleted"), f.Key)
+		return nil
+	}
+	return f.Err
+}
+
+// Error classes of RetryPolicy.Classes.
+const (
+	// RetryThrottle covers S3 asking to slow down: SlowDown, 429 and 503.
+	RetryThrottle = "throttle"
+	// RetryServer covers the other server errors (5xx).
+	RetryServer = "server"
+	// RetryNetwork covers failed connections and timeouts.
+	RetryNetwork = "network"
+)
+
+// RetryClasses lists the error classes a RetryPolicy may retry.
+func RetryClasses() []string {
+	return []string{RetryThrottle, RetryServer, RetryNetwork}
+}
+
+// Defaults of the zero RetryPolicy.
+const (
+	defaultMaxAttempts = 11
+	defaultBaseDelay   = 200 * time.Millisecond
+	defaultMaxDelay    = 30 * time.Second
+	// minThrottleDelay is the least base delay of throttled requests, which
+	// S3 only serves again once the request rate drops.
+	minThrottleDelay = time.Second
+)
+
+// RetryPolicy sets how each S3 request is retried. The wait before retry
+// n is drawn at random between zero and BaseDelay * 2^(n-1), capped at
+// MaxDelay (exponential backoff with full jitter); throttled requests
+// start from at least one second. Zero fields take the defaults: 11
+// attempts, 200ms and 30s.
+type RetryPolicy struct {
+	// MaxAttempts bounds the attempts of a request, the first included;
+	// 1 disables retries.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Classes lists the error classes retried (see RetryClasses); empty
+	// means all of them. Expired credentials are always retried once.
+	Classes []string
+	// Log reports every retry; otherwise only from the fourth attempt on.
+	Log bool
+}
+
+// Validate checks p.
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 || p.BaseDelay < 0 || p.MaxDelay < 0 {
+		return i18n.Errorf("retry.negative")
+	}
+	if p.BaseDelay > 0 && p.MaxDelay > 0 && p.BaseDelay > p.MaxDelay {
+		return i18n.Errorf("retry.base_over_max", p.BaseDelay, p.MaxDelay)
+	}
+	for _, class := range p.Classes {
+		if !slices.Contains(RetryClasses(), class) {
+			return i18n.Errorf("retry.invalid_class", class, strings.Join(RetryClasses(), ", "))
+		}
+	}
+	return nil
+}
+
+// retryer applies a RetryPolicy to the requests of an AWS session.
+type retryer struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	classes     []string
+	log         bool
+}
+
+func newRetryer(p RetryPolicy) *retryer {
+	r := &retryer{
+		maxAttempts: cmp.Or(p.MaxAttempts, defaultMaxAttempts),
+		baseDelay:   cmp.Or(p.BaseDelay, defaultBaseDelay),
+		maxDelay:    cmp.Or(p.MaxDelay, defaultMaxDelay),
+		classes:     p.Classes,
+		log:         p.Log,
+	}
+	if len(r.classes) == 0 {
+		r.classes = RetryClasses()
+	}
+	r.maxDelay = max(r.maxDelay, r.baseDelay)
+	return r
+}
+
+func (r *retryer) MaxRetries() int {
+	return r.maxAttempts - 1
+}
+
+func (r *retryer) ShouldRetry(req *request.Request) bool {
+	if req.Retryable != nil {
+		return *req.Retryable
+	}
+	class := retryClass(req)
+	return class != "" && slices.Contains(r.classes, class)
+}
+
+func (r *retryer) RetryRules(req *request.Request) time.Duration {
+	base := r.baseDelay
+	class := retryClass(req)
+	if class == RetryThrottle {
+		base = max(base, minThrottleDelay)
+	}
+	ceiling := r.maxDelay
+	if shift := req.RetryCount; shift < 32 && base<<shift < ceiling && base<<shift > 0 {
+		ceiling = base << shift
+	}
+	delay := time.Duration(rand.Int64N(int64(ceiling) + 1))
+
+	if r.log || req.RetryCount >= 2 {
+		log.Printf(i18n.T("session.retry"), req.RetryCount+2, r.maxAttempts, req.Operation.Name, cmp.Or(class, "-"), delay.Round(time.Millisecond))
+	}
+	return delay
+}
+
+// retryClass names the class of the error of req, or "" when it is not
+// worth retrying.
+func retryClass(req *request.Request) string {
+	if req.Error == nil || req.IsErrorExpired() {
+		return ""
+	}
+	if aerr, ok := req.Error.(awserr.Error); ok && aerr.Code() == "SlowDown" {
+		return RetryThrottle
+	}
+	if req.IsErrorThrottle() {
+		return RetryThrottle
+	}
+	if req.HTTPResponse != nil && req.HTTPResponse.StatusCode >= 500 && req.HTTPResponse.StatusCode != http.StatusNotImplemented {
+		return RetryServer
+	}
+	if req.IsErrorRetryable() {
+		return RetryNetwork
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package sync
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Suite: retry policy
+func failedRequest(code string, status int) *request.Request {
+	return &request.Request{
+		Operation:    &request.Operation{Name: "PutObject"},
+		Error:        awserr.New(code, "failed", nil),
+		HTTPResponse: &http.Response{StatusCode: status},
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	assert.NoError(t, RetryPolicy{}.Validate())
+	assert.NoError(t, RetryPolicy{MaxAttempts: 1, Classes: []string{RetryThrottle}}.Validate())
+
+	assert.Equal(t, "retry.negative", i18n.ID(RetryPolicy{MaxAttempts: -1}.Validate()))
+	assert.Equal(t, "retry.base_over_max", i18n.ID(RetryPolicy{BaseDelay: time.Minute, MaxDelay: time.Second}.Validate()))
+	assert.Equal(t, "retry.invalid_class", i18n.ID(RetryPolicy{Classes: []string{"client"}}.Validate()))
+}
+
+func TestRetryClass(t *testing.T) {
+	tests := map[string]struct {
+		req  *request.Request
+		want string
+	}{
+		"SlowDown":          {failedRequest("SlowDown", 503), RetryThrottle},
+		"too many requests": {failedRequest("TooManyRequests", 429), RetryThrottle},
+		"internal error":    {failedRequest("InternalError", 500), RetryServer},
+		"not implemented":   {failedRequest("NotImplemented", 501), ""},
+		"connection reset":  {&request.Request{Error: awserr.New(request.ErrCodeRequestError, "send request failed", errors.New("connection reset"))}, RetryNetwork},
+		"access denied":     {failedRequest("AccessDenied", 403), ""},
+		"expired token":     {failedRequest("ExpiredToken", 400), ""},
+	}
+	for name, tt := range tests {
+		assert.Equal(t, tt.want, retryClass(tt.req), name)
+	}
+}
+
+func TestRetryer(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		r := newRetryer(RetryPolicy{})
+		assert.Equal(t, 10, r.MaxRetries())
+		assert.True(t, r.ShouldRetry(failedRequest("InternalError", 500)))
+		assert.False(t, r.ShouldRetry(failedRequest("AccessDenied", 403)))
+	})
+
+	t.Run("only the listed classes are retried", func(t *testing.T) {
+		r := newRetryer(RetryPolicy{Classes: []string{RetryThrottle}})
+		assert.True(t, r.ShouldRetry(failedRequest("SlowDown", 503)))
+		assert.False(t, r.ShouldRetry(failedRequest("InternalError", 500)))
+	})
+
+	t.Run("handlers deciding first win", func(t *testing.T) {
+		r := newRetryer(RetryPolicy{Classes: []string{RetryThrottle}})
+		req := failedRequest("ExpiredToken", 400)
+		req.Retryable = aws.Bool(true)
+		assert.True(t, r.ShouldRetry(req))
+	})
+
+	t.Run("jittered exponential backoff", func(t *testing.T) {
+		r := newRetryer(RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+		req := failedRequest("InternalError", 500)
+		for count, ceiling := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+			req.RetryCount = count
+			for i := 0; i < 20; i++ {
+				delay := r.RetryRules(req)
+				assert.GreaterOrEqual(t, delay, time.Duration(0))
+				assert.LessOrEqual(t, delay, ceiling, "retry %d", count)
+			}
+		}
+	})
+
+	t.Run("throttling starts from one second", func(t *testing.T) {
+		r := newRetryer(RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: time.Minute})
+		req := failedRequest("SlowDown", 503)
+		var longest time.Duration
+		for i := 0; i < 50; i++ {
+			longest = max(longest, r.RetryRules(req))
+		}
+		assert.Greater(t, longest, 10*time.Millisecond)
+		assert.LessOrEqual(t, longest, time.Second)
+	})
+}
@@ -0,0 +1,182 @@
+package sync
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Rule sets the upload behavior of the files whose key matches Pattern.
+// Patterns without a slash match the file name anywhere in the tree (*.mp4),
+// others the whole relative key (fotos/*.jpg); a trailing /** matches
+// everything below a directory (arquivo/**).
+type Rule struct {
+	Pattern      string `json:"pattern"`
+	StorageClass string `json:"storage_class"`
+	SSE          string `json:"sse"` // AES256 or aws:kms
+	KMSKeyID     string `json:"kms_key_id"`
+
+	CacheControl       string `json:"cache_control"`
+	ContentType        string `json:"content_type"`
+	ContentDisposition string `json:"content_disposition"`
+	ContentEncoding    string `json:"content_encoding"`
+	ContentLanguage    string `json:"content_language"`
+	// Metadata is stored as x-amz-meta-* headers; keys may be written with
+	// or without that prefix.
+	Metadata map[string]string `json:"metadata"`
+	// Compress is CompressGzip to upload matching files compressed.
+	Compress string `json:"compress"`
+	// SkipDelete keeps matching objects in the bucket after their local
+	// file is removed.
+	SkipDelete bool `json:"skip_delete"`
+	// Priority is PriorityHigh or PriorityLow to upload matching files
+	// before or after the others queued with them; empty means
+	// PriorityNormal.
+	Priority string `json:"priority"`
+	// ObjectLockMode and ObjectLockDays override Config.ObjectLockMode and
+	// Config.ObjectLockDays for matching files.
+	ObjectLockMode string `json:"object_lock_mode"`
+	ObjectLockDays int    `json:"object_lock_days"`
+}
+
+// Upload priorities of Rule.Priority.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// rulesFile is the layout of Config.RulesFile.
+type rulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// readRulesFile loads and validates the rules in path.
+func readRulesFile(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file rulesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, i18n.Errorf("rules.invalid", path, err)
+	}
+	for i := range file.Rules {
+		if err := file.Rules[i].validate(); err != nil {
+			return nil, i18n.Errorf("rules.rule", path, i+1, err)
+		}
+	}
+	return file.Rules, nil
+}
+
+// validate checks r and normalizes its metadata keys.
+func (r *Rule) validate() error {
+	if r.Pattern == "" {
+		return i18n.Errorf("rules.empty_pattern")
+	}
+	if _, err := path.Match(strings.TrimSuffix(r.Pattern, "/**"), ""); err != nil {
+		return i18n.Errorf("rules.invalid_pattern", r.Pattern, err)
+	}
+	var err error
+	if r.Metadata, err = userMetadata(r.Metadata); err != nil {
+		return err
+	}
+	if err := validateCompression(r.Compress); err != nil {
+		return err
+	}
+	switch r.Priority {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+	default:
+		return i18n.Errorf("rules.invalid_priority", r.Priority, PriorityHigh, PriorityNormal, PriorityLow)
+	}
+	return UploadOptions{SSE: r.SSE, KMSKeyID: r.KMSKeyID, StorageClass: r.StorageClass, ObjectLockMode: r.ObjectLockMode, ObjectLockDays: r.ObjectLockDays}.Validate()
+}
+
+func (r Rule) matches(key string) bool {
+	if dir, ok := strings.CutSuffix(r.Pattern, "/**"); ok {
+		for parent := path.Dir(key); parent != "."; parent = path.Dir(parent) {
+			if matched, _ := path.Match(dir, parent); matched {
+				return true
+			}
+		}
+		return false
+	}
+	if !strings.Contains(r.Pattern, "/") {
+		key = path.Base(key)
+	}
+	matched, _ := path.Match(r.Pattern, key)
+	return matched
+}
+
+// ruleSettings merges the settings of every rule matching key, later rules
+// overriding earlier ones. It returns nil when no rule matches.
+func (s *Syncer) ruleSettings(key string) *objectMeta {
+	key = s.unprefixed(key)
+	var meta *objectMeta
+	for _, rule := range s.rules {
+		if !rule.matches(key) {
+			continue
+		}
+		meta = meta.overlay(&objectMeta{
+			Metadata:           rule.Metadata,
+			CacheControl:       rule.CacheControl,
+			ContentType:        rule.ContentType,
+			ContentDisposition: rule.ContentDisposition,
+			ContentEncoding:    rule.ContentEncoding,
+			ContentLanguage:    rule.ContentLanguage,
+			StorageClass:       rule.StorageClass,
+			SSE:                rule.SSE,
+			KMSKeyID:           rule.KMSKeyID,
+			Compress:           rule.Compress,
+			ObjectLockMode:     rule.ObjectLockMode,
+			ObjectLockDays:     rule.ObjectLockDays,
+		})
+	}
+	return meta
+}
+
+// skipDelete reports whether the object at key stays in the bucket when its
+// file is missing: a rule matching key sets SkipDelete, key matches a
+// Config.KeepRemote pattern, or the file is ignored, so the object did not
+// come from the tree.
+func (s *Syncer) skipDelete(key string) bool {
+	key = s.unprefixed(key)
+	if s.shouldIgnore(key) {
+		return true
+	}
+	for _, rules := range [][]Rule{s.rules, s.keepRemote} {
+		for _, rule := range rules {
+			if rule.SkipDelete && rule.matches(key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// priority returns the upload priority of key: that of the last matching
+// rule setting one, PriorityNormal otherwise.
+func (s *Syncer) priority(key string) string {
+	key = s.unprefixed(key)
+	priority := PriorityNormal
+	for _, rule := range s.rules {
+		if rule.Priority != "" && rule.matches(key) {
+			priority = rule.Priority
+		}
+	}
+	return priority
+}
+
+// objectSettings returns the settings of the upload of the file at path to
+// key: those of the matching rules, overridden by its sidecar.
+func (s *Syncer) objectSettings(key, path string) (*objectMeta, error) {
+	sidecar, err := readSidecar(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.ruleSettings(key).overlay(sidecar), nil
+}
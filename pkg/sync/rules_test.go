@@ -0,0 +1,193 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: per-pattern upload rules
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"*.mp4", "video.mp4", true},
+		{"*.mp4", "ferias/2024/video.mp4", true},
+		{"*.mp4", "video.mp4.txt", false},
+		{"fotos/*.jpg", "fotos/a.jpg", true},
+		{"fotos/*.jpg", "outras/fotos/a.jpg", false},
+		{"fotos/*.jpg", "fotos/2024/a.jpg", false},
+		{"arquivo/**", "arquivo/a.txt", true},
+		{"arquivo/**", "arquivo/2020/a.txt", true},
+		{"arquivo/**", "arquivo.txt", false},
+		{"*/cache/**", "site/cache/a.css", true},
+		{"*/cache/**", "cache/a.css", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, Rule{Pattern: tt.pattern}.matches(tt.key))
+		})
+	}
+}
+
+func TestReadRulesFile(t *testing.T) {
+	t.Run("valid rules", func(t *testing.T) {
+		path := createTempFile(t, t.TempDir(), "rules.json", `{"rules": [
+			{"pattern": "*.mp4", "storage_class": "GLACIER_IR"},
+			{"pattern": "backup/**", "skip_delete": true}
+		]}`)
+
+		rules, err := readRulesFile(path)
+		require.NoError(t, err)
+		require.Len(t, rules, 2)
+		assert.Equal(t, "GLACIER_IR", rules[0].StorageClass)
+		assert.True(t, rules[1].SkipDelete)
+	})
+
+	t.Run("metadata header prefix is optional", func(t *testing.T) {
+		path := createTempFile(t, t.TempDir(), "rules.json", `{"rules": [
+			{"pattern": "*.html", "metadata": {"x-amz-meta-autor": "gui", "versao": "2"}}
+		]}`)
+
+		rules, err := readRulesFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"autor": "gui", "versao": "2"}, rules[0].Metadata)
+	})
+
+	for name, content := range map[string]string{
+		"invalid JSON":          `{"rules": [`,
+		"missing pattern":       `{"rules": [{"storage_class": "STANDARD"}]}`,
+		"bad pattern":           `{"rules": [{"pattern": "[a-"}]}`,
+		"invalid storage class": `{"rules": [{"pattern": "*", "storage_class": "CHEAP"}]}`,
+		"KMS key without KMS":   `{"rules": [{"pattern": "*", "sse": "AES256", "kms_key_id": "alias/x"}]}`,
+		"invalid metadata key":  `{"rules": [{"pattern": "*", "metadata": {"minha chave": "x"}}]}`,
+		"reserved metadata key": `{"rules": [{"pattern": "*", "metadata": {"x-amz-meta-Gui-Sync-Mtime": "0"}}]}`,
+		"invalid priority":      `{"rules": [{"pattern": "*", "priority": "urgent"}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := readRulesFile(createTempFile(t, t.TempDir(), "rules.json", content))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRuleSettings(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	s.rules = []Rule{
+		{Pattern: "*", StorageClass: "STANDARD_IA", Metadata: map[string]string{"origem": "gui-sync"}},
+		{Pattern: "*.mp4", StorageClass: "GLACIER_IR"},
+		{Pattern: "privado/**", SSE: s3.ServerSideEncryptionAwsKms, KMSKeyID: "alias/privado", Metadata: map[string]string{"nivel": "restrito"}},
+	}
+
+	t.Run("later rules override earlier ones", func(t *testing.T) {
+		meta := s.ruleSettings("privado/video.mp4")
+		require.NotNil(t, meta)
+		assert.Equal(t, "GLACIER_IR", meta.StorageClass)
+		assert.Equal(t, "alias/privado", meta.KMSKeyID)
+		assert.Equal(t, map[string]string{"origem": "gui-sync", "nivel": "restrito"}, meta.Metadata)
+	})
+
+	t.Run("no matching rule", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.rules = []Rule{{Pattern: "*.mp4", StorageClass: "GLACIER_IR"}}
+		assert.Nil(t, s.ruleSettings("a.txt"))
+	})
+
+	t.Run("sidecar overrides rules", func(t *testing.T) {
+		tempDir := t.TempDir()
+		path := createTempFile(t, tempDir, "privado/video.mp4", "video")
+		createTempFile(t, tempDir, "privado/video.mp4.meta.json", `{"storage_class": "STANDARD", "sse": "AES256"}`)
+
+		meta, err := s.objectSettings("privado/video.mp4", path)
+		require.NoError(t, err)
+		assert.Equal(t, "STANDARD", meta.StorageClass)
+		assert.Equal(t, s3.ServerSideEncryptionAes256, meta.SSE)
+		assert.Empty(t, meta.KMSKeyID, "the KMS key of the rule does not apply to AES256")
+	})
+}
+
+func TestRulePriority(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	s.rules = []Rule{
+		{Pattern: "videos/**", Priority: PriorityLow},
+		{Pattern: "*.docx", Priority: PriorityHigh},
+		{Pattern: "*.mp4", StorageClass: "GLACIER_IR"},
+	}
+
+	assert.Equal(t, PriorityNormal, s.priority("a.txt"))
+	assert.Equal(t, PriorityLow, s.priority("videos/a.mp4"), "rules without a priority keep the earlier one")
+	assert.Equal(t, PriorityHigh, s.priority("videos/roteiro.docx"), "later rules override earlier ones")
+}
+
+func TestUploadWithRules(t *testing.T) {
+	path := createTempFile(t, t.TempDir(), "site/data.json", "{}")
+
+	mockClient := new(mockS3Client)
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return aws.StringValue(input.StorageClass) == "STANDARD" &&
+			aws.StringValue(input.CacheControl) == "no-cache" &&
+			aws.StringValue(input.ContentType) == "application/json" &&
+			aws.StringValue(input.ContentDisposition) == "inline" &&
+			aws.StringValue(input.ContentEncoding) == "identity" &&
+			aws.StringValue(input.ServerSideEncryption) == s3.ServerSideEncryptionAes256 &&
+			aws.StringValue(input.Metadata["setor"]) == "site"
+	})).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	s.rules = []Rule{{
+		Pattern:            "*.json",
+		StorageClass:       "STANDARD",
+		CacheControl:       "no-cache",
+		ContentType:        "application/json",
+		ContentDisposition: "inline",
+		ContentEncoding:    "identity",
+		SSE:                s3.ServerSideEncryptionAes256,
+		Metadata:           map[string]string{"setor": "site"},
+	}}
+	_, err := s.uploadFileS3("site/data.json", path, 2)
+	require.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
+
+func TestDeleterSkipDeleteRule(t *testing.T) {
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		Contents: []*s3.Object{
+			{Key: aws.String("arquivo/2020/a.txt")},
+			{Key: aws.String("b.txt")},
+		},
+	}, nil).Once()
+	mockClient.On("DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+		return *input.Key == "b.txt"
+	})).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	s.rules = []Rule{{Pattern: "arquivo/**", SkipDelete: true}}
+	require.NoError(t, (&deleter{syncer: s, workers: 1}).run(keysOf()))
+	mockClient.AssertExpectations(t)
+}
+
+func TestKeepRemote(t *testing.T) {
+	s, err := New(Config{
+		Bucket:     "test-bucket",
+		Client:     new(mockS3Client),
+		StateDir:   t.TempDir(),
+		KeepRemote: []string{"arquivos/**", "*.pdf"},
+	})
+	require.NoError(t, err)
+	assert.True(t, s.skipDelete("arquivos/2020/a.txt"))
+	assert.True(t, s.skipDelete("docs/contrato.pdf"))
+	assert.False(t, s.skipDelete("docs/contrato.txt"))
+	assert.Nil(t, s.ruleSettings("docs/contrato.pdf"), "keep patterns set nothing on uploads")
+
+	_, err = New(Config{Bucket: "test-bucket", Client: new(mockS3Client), StateDir: t.TempDir(), KeepRemote: []string{"[a"}})
+	assert.Equal(t, "syncer.keep_remote", i18n.ID(err))
+}
@@ -0,0 +1,191 @@
+package sync
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// The scan cache (Config.ScanCache) remembers, for every directory, a
+// fingerprint of its entries and which of its files were found in sync by
+// the last run. While the fingerprint is unchanged, those files skip the
+// differ: no HeadObject and no hashing. The tree is still listed, since a
+// directory's own modification time does not change when a file in it is
+// rewritten.
+
+// scanCacheFile is the layout of the scan cache state file.
+type scanCacheFile struct {
+	formatHeader
+
+	Bucket string                   `json:"bucket"`
+	Root   string                   `json:"root"`
+	Dirs   map[string]*scanCacheDir `json:"dirs"`
+}
+
+// scanCacheDir is the cached state of one directory, by its path relative
+// to the root ("." for the root).
+type scanCacheDir struct {
+	Fingerprint string    `json:"fingerprint"`
+	VerifiedAt  time.Time `json:"verified_at"`
+	Files       []string  `json:"files"`
+}
+
+// scanState is the scan cache during a run: the cache of the previous run
+// and the one being built.
+type scanState struct {
+	// root is where the tree is read, and key the root the cache is kept
+	// for: RootDir when root is a snapshot of it.
+	root   string
+	key    string
+	maxAge time.Duration
+
+	mu       sync.Mutex
+	previous map[string]*scanCacheDir
+	next     map[string]*scanCacheDir
+	// reused records, per directory visited, whether the previous entry
+	// still applies.
+	reused map[string]bool
+	hits   atomic.Int64
+}
+
+func (s *Syncer) scanCachePath(root string) string {
+	sum := sha1.Sum([]byte(s.prefixScoped(s.cfg.Bucket + "\x00" + root)))
+	return s.statePath("scan", fmt.Sprintf("%x.json", sum))
+}
+
+// loadScanCache prepares the scan cache of a run over root, kept for key.
+// A missing or unreadable cache starts empty.
+func (s *Syncer) loadScanCache(key, root string) (*scanState, error) {
+	state := &scanState{
+		root:     root,
+		key:      key,
+		maxAge:   s.cfg.ScanCache,
+		previous: make(map[string]*scanCacheDir),
+		next:     make(map[string]*scanCacheDir),
+		reused:   make(map[string]bool),
+	}
+
+	var file scanCacheFile
+	if err := readStateFile(s.scanCachePath(key), &file); err != nil {
+		var formatErr *FormatError
+		if errors.As(err, &formatErr) {
+			return nil, err
+		}
+		if !os.IsNotExist(err) {
+			log.Printf("  ⚠ %v", err)
+		}
+		return state, nil
+	}
+	if file.Bucket == s.cfg.Bucket && file.Root == key && file.Dirs != nil {
+		state.previous = file.Dirs
+	}
+	return state, nil
+}
+
+// saveScanCache writes the cache built during the run.
+func (s *Syncer) saveScanCache(state *scanState) {
+	state.mu.Lock()
+	file := &scanCacheFile{Bucket: s.cfg.Bucket, Root: state.key, Dirs: state.next}
+	err := writeStateFile(s.scanCachePath(state.key), file)
+	state.mu.Unlock()
+	if err != nil {
+		log.Printf(i18n.T("scancache.save_failed"), err)
+	}
+	if hits := state.hits.Load(); hits > 0 {
+		fmt.Printf(i18n.T("scancache.hits"), hits)
+	}
+}
+
+// cached reports whether the file at relPath was in sync at the last run
+// and its directory has not changed since.
+func (c *scanState) cached(relPath string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dir := path.Dir(relPath)
+	if !c.visit(dir) {
+		return false
+	}
+	name := path.Base(relPath)
+	for _, f := range c.previous[dir].Files {
+		if f == name {
+			c.hits.Add(1)
+			c.next[dir].Files = append(c.next[dir].Files, name)
+			return true
+		}
+	}
+	return false
+}
+
+// synced records that the file at relPath was found in sync or uploaded.
+func (c *scanState) synced(relPath string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dir := path.Dir(relPath)
+	c.visit(dir)
+	if entry, ok := c.next[dir]; ok {
+		entry.Files = append(entry.Files, path.Base(relPath))
+	}
+}
+
+// visit fingerprints dir the first time it is seen in the run, starting
+// its entry in the new cache, and reports whether the previous entry still
+// applies. It is called with mu held.
+func (c *scanState) visit(dir string) bool {
+	if reused, ok := c.reused[dir]; ok {
+		return reused
+	}
+
+	reused := false
+	fingerprint, err := dirFingerprint(filepath.Join(c.root, filepath.FromSlash(dir)))
+	if err == nil {
+		entry := &scanCacheDir{Fingerprint: fingerprint, VerifiedAt: time.Now()}
+		if prev, ok := c.previous[dir]; ok && prev.Fingerprint == fingerprint && time.Since(prev.VerifiedAt) < c.maxAge {
+			reused = true
+			entry.VerifiedAt = prev.VerifiedAt
+		}
+		c.next[dir] = entry
+	}
+	c.reused[dir] = reused
+	return reused
+}
+
+// dirFingerprint hashes the names, sizes, modification times and modes of
+// the entries of dir, sidecar files included.
+func dirFingerprint(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return "", err
+		}
+		if info.IsDir() {
+			fmt.Fprintf(h, "%s/\n", entry.Name())
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00%o\n", entry.Name(), info.Size(), info.ModTime().UnixNano(), info.Mode())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: scan cache
+func TestScanCache(t *testing.T) {
+	notFound := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "request-id")
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "a.txt", "a")
+	changed := createTempFile(t, tempDir, "sub/b.txt", "b")
+
+	listing := &s3.ListObjectsV2Output{Contents: []*s3.Object{{Key: aws.String("a.txt")}, {Key: aws.String("sub/b.txt")}}}
+	s := newTestSyncer(t, nil)
+	s.cfg.ScanCache = time.Hour
+
+	run := func(t *testing.T, client *mockS3Client) RunSummary {
+		s.client = client
+		client.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(listing, nil).Once()
+		result, err := s.syncDirectoryWithS3(context.Background(), tempDir)
+		require.NoError(t, err)
+		require.NoError(t, result.Err())
+		client.AssertExpectations(t)
+		return s.stats.summary()
+	}
+
+	t.Run("first run compares every file", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("HeadObject", mock.Anything).Return(nil, notFound).Twice()
+		client.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Twice()
+
+		summary := run(t, client)
+		assert.Equal(t, int64(2), summary.Scanned)
+		assert.Equal(t, int64(2), summary.Uploaded)
+		assert.FileExists(t, s.scanCachePath(tempDir))
+	})
+
+	t.Run("unchanged directories skip the comparison", func(t *testing.T) {
+		client := new(mockS3Client)
+
+		summary := run(t, client)
+		assert.Equal(t, int64(2), summary.Skipped)
+		client.AssertNotCalled(t, "HeadObject", mock.Anything)
+	})
+
+	t.Run("changed directory is compared again", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(changed, []byte("b2"), 0644))
+		client := new(mockS3Client)
+		client.On("HeadObject", mock.MatchedBy(func(input *s3.HeadObjectInput) bool {
+			return *input.Key == "sub/b.txt"
+		})).Return(nil, notFound).Once()
+		client.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+
+		summary := run(t, client)
+		assert.Equal(t, int64(1), summary.Uploaded)
+		assert.Equal(t, int64(1), summary.Skipped)
+	})
+
+	t.Run("expired entries are compared again", func(t *testing.T) {
+		s.cfg.ScanCache = time.Nanosecond
+		defer func() { s.cfg.ScanCache = time.Hour }()
+		client := new(mockS3Client)
+		client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+			ContentLength: aws.Int64(1),
+			LastModified:  aws.Time(time.Now().Add(time.Hour)),
+		}, nil).Once()
+		client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+			ContentLength: aws.Int64(2),
+			LastModified:  aws.Time(time.Now().Add(time.Hour)),
+		}, nil).Once()
+
+		assert.Equal(t, int64(2), run(t, client).Skipped)
+	})
+}
+
+func TestScanCacheNewFileInCachedDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "a.txt", "a")
+
+	s := newTestSyncer(t, nil)
+	s.cfg.ScanCache = time.Hour
+	cache, err := s.loadScanCache(tempDir, tempDir)
+	require.NoError(t, err)
+	cache.synced("a.txt")
+	s.saveScanCache(cache)
+
+	cache, err = s.loadScanCache(tempDir, tempDir)
+	require.NoError(t, err)
+	assert.True(t, cache.cached("a.txt"))
+
+	// A new file changes the fingerprint of its directory.
+	createTempFile(t, tempDir, "b.txt", "b")
+	cache, err = s.loadScanCache(tempDir, tempDir)
+	require.NoError(t, err)
+	assert.False(t, cache.cached("a.txt"))
+	assert.False(t, cache.cached("b.txt"))
+}
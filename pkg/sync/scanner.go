@@ -0,0 +1,337 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// fileEntry is a local file found by the scanner stage.
+type fileEntry struct {
+	path    string
+	relPath string
+	// key is the key of the file, relPath unless Config.SanitizeKeys
+	// encoded it.
+	key     string
+	size    int64
+	modTime time.Time
+	// cached is set for files the scan cache knows to be in sync.
+	cached bool
+	// linkTo is the key of the file met earlier that the file is a hard
+	// link to, with Config.HardLinks.
+	linkTo string
+}
+
+// scanner is the first pipeline stage: it enumerates the local files that
+// take part in a run, either by walking root or from a --files-from list.
+type scanner struct {
+	root      string
+	filesFrom string
+	ignore    func(relPath string) bool
+	// skip, when set, leaves files out before seen is called, for the
+	// directories archive mode uploads as a whole.
+	skip func(relPath string) bool
+
+	// seen, when set, is called for every local file before the ignore
+	// filter is applied; the deleter uses it to learn which keys exist.
+	seen func(relPath string)
+	// unreadable, when set, is called for every file or directory that
+	// could not be read, which is then skipped instead of aborting the run.
+	unreadable func(relPath string, err error)
+	// key, when set, maps the files to their keys; the files it fails for
+	// are reported to invalid and skipped.
+	key     func(path, relPath string) (string, error)
+	invalid func(relPath string, err error)
+	// cached, when set, reports the files the scan cache knows to be in
+	// sync.
+	cached func(relPath string) bool
+	// mounted, when set, keeps the walk on the file system of root; see
+	// walkTree.
+	mounted func(relPath string)
+	// links, when set, tells the files that are hard links to one met
+	// earlier.
+	links hardLinks
+	// changed, when not nil, lists the paths the change journal reports;
+	// only they are visited instead of the whole tree.
+	changed []string
+}
+
+// run sends every non-ignored file to out and closes it when done or when
+// ctx is cancelled by a later stage.
+func (s *scanner) run(ctx context.Context, out chan<- fileEntry) error {
+	defer close(out)
+
+	walk := func(fn func(path, relPath string, info os.FileInfo) error) error {
+		if s.changed != nil {
+			return walkChanged(s.root, s.changed, fn, s.unreadable, s.mounted)
+		}
+		return walkTree(s.root, s.filesFrom, fn, s.unreadable, s.mounted)
+	}
+	return walk(func(path, relPath string, info os.FileInfo) error {
+		if s.skip != nil && s.skip(relPath) {
+			return nil
+		}
+		ignored := s.ignore != nil && s.ignore(relPath)
+		key := relPath
+		if s.key != nil {
+			var err error
+			if key, err = s.key(path, relPath); err != nil {
+				if !ignored {
+					s.invalid(relPath, err)
+				}
+				return nil
+			}
+		}
+		if s.seen != nil {
+			s.seen(key)
+		}
+		if ignored {
+			return nil
+		}
+
+		entry := fileEntry{path: path, relPath: relPath, key: key, size: info.Size(), modTime: info.ModTime()}
+		// The scan cache cannot tell when another link to a file is
+		// removed, so files with several links are always compared.
+		var linked bool
+		entry.linkTo, linked = s.links.link(key, info)
+		if s.cached != nil && !linked {
+			entry.cached = s.cached(relPath)
+		}
+
+		select {
+		case out <- entry:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// walkFiles calls fn for every regular file that takes part in a sync run.
+// When filesFrom is set the listed paths are visited instead of walking root;
+// the list is re-read on every run so external tooling can change it between
+// scheduled runs. Sidecar files are skipped: they only describe their
+// companion and have no key of their own.
+func walkFiles(root, filesFrom string, fn func(path, relPath string, info os.FileInfo) error) error {
+	return walkFilesSkipping(root, filesFrom, fn, nil)
+}
+
+// walkFilesSkipping is walkFiles, except that entries below root that cannot
+// be read are reported to onError and skipped. With a nil onError the first
+// such error aborts the walk; an unreadable root always does.
+func walkFilesSkipping(root, filesFrom string, fn func(path, relPath string, info os.FileInfo) error, onError func(relPath string, err error)) error {
+	return walkTree(root, filesFrom, fn, onError, nil)
+}
+
+// walkTree is walkFilesSkipping, except that with a mounted function the
+// walk stays on the file system of root: directories on others, such as
+// network shares, pseudo-file systems and external drives mounted below
+// root, are reported to mounted and skipped. Listed files are always
+// visited.
+func walkTree(root, filesFrom string, fn func(path, relPath string, info os.FileInfo) error, onError func(relPath string, err error), mounted func(relPath string)) error {
+	visit := func(path, relPath string, info os.FileInfo) error {
+		if isSidecar(path) {
+			return nil
+		}
+		return fn(path, relPath, info)
+	}
+
+	if filesFrom != "" {
+		return visitListedFiles(root, filesFrom, visit)
+	}
+
+	// Walking from an absolute root lets Windows read paths past MAX_PATH.
+	root = longPath(root)
+	var rootDevice uint64
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			relPath, relErr := filepath.Rel(root, path)
+			if onError == nil || relErr != nil || relPath == "." {
+				return err
+			}
+			onError(toSlashKey(relPath), err)
+			return nil
+		}
+
+		if info.IsDir() {
+			if mounted == nil {
+				return nil
+			}
+			device, ok := fileDevice(info)
+			if path == root {
+				rootDevice = device
+			} else if ok && device != rootDevice {
+				relPath, err := filepath.Rel(root, path)
+				if err != nil {
+					return err
+				}
+				log.Printf(i18n.T("scanner.other_filesystem"), toSlashKey(relPath))
+				mounted(toSlashKey(relPath))
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		return visit(path, toSlashKey(relPath), info)
+	})
+}
+
+// mountsSkipped returns the mounted argument of walkTree for the walks of
+// the tree: nil, crossing mount points, unless Config.OneFileSystem is set.
+// skipped, when not nil, is called for the mount points skipped.
+func (s *Syncer) mountsSkipped(skipped func(relPath string)) func(relPath string) {
+	if !s.cfg.OneFileSystem {
+		return nil
+	}
+	if skipped == nil {
+		return func(string) {}
+	}
+	return skipped
+}
+
+func visitListedFiles(root, listPath string, fn func(path, relPath string, info os.FileInfo) error) error {
+	entries, err := readPatternFile(listPath)
+	if err != nil {
+		return i18n.Errorf("scanner.files_from", err)
+	}
+
+	for _, entry := range entries {
+		path := entry
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, filepath.FromSlash(entry))
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			log.Printf(i18n.T("scanner.outside_root"), entry)
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Printf(i18n.T("scanner.not_found"), entry)
+			continue
+		}
+		if info.IsDir() {
+			log.Printf(i18n.T("scanner.is_dir"), entry)
+			continue
+		}
+
+		if err := fn(path, toSlashKey(relPath), info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// toSlashKey maps a path relative to the root to its key: with forward
+// slashes, and NFC-normalized so that macOS names the same keys as other
+// systems.
+func toSlashKey(relPath string) string {
+	if runtime.GOOS == "windows" {
+		relPath = strings.ReplaceAll(relPath, "\\", "/")
+	}
+	return nfc(relPath)
+}
+
+func (s *Syncer) loadSyncIgnoreFile() error {
+	patterns, err := readPatternFile(filepath.Join(s.cfg.RootDir, ".syncignore"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	s.ignorePatterns = append(s.ignorePatterns, patterns...)
+
+	fmt.Printf(i18n.T("scanner.syncignore_loaded"), len(s.ignorePatterns))
+
+	return nil
+}
+
+// readPatternFile reads one entry per line, skipping blank lines and
+// comments starting with '#'.
+func readPatternFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		patterns = append(patterns, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, i18n.Errorf("scanner.read_file", filepath.Base(path), err)
+	}
+
+	return patterns, nil
+}
+
+func (s *Syncer) shouldIgnore(path string) bool {
+	if s.presetExcluded(path) {
+		return true
+	}
+	if s.gitignore != nil && s.gitignore.ignored(path) {
+		return true
+	}
+
+	return s.patternIgnored(path)
+}
+
+// patternIgnored reports whether relPath, or a directory above it, matches
+// the patterns of Config.Ignore, .syncignore and Config.ExcludeFrom. They
+// follow the .gitignore syntax from the root: patterns without a slash
+// match names at any depth, a trailing slash matches directories only and
+// ** matches any number of directories. A trailing slash on relPath marks
+// a directory.
+func (s *Syncer) patternIgnored(relPath string) bool {
+	if len(s.ignorePatterns) == 0 {
+		return false
+	}
+	var rules []gitignoreRule
+	for _, pattern := range s.ignorePatterns {
+		if rule, ok := parseGitignoreLine(pattern, ""); ok {
+			rules = append(rules, rule)
+		}
+	}
+
+	isDir := strings.HasSuffix(relPath, "/")
+	segments := strings.Split(strings.TrimSuffix(relPath, "/"), "/")
+	for i := range segments {
+		ignored := false
+		for _, rule := range rules {
+			if rule.matches(strings.Join(segments[:i+1], "/"), isDir || i < len(segments)-1) {
+				ignored = !rule.negate
+			}
+		}
+		if ignored {
+			return true
+		}
+	}
+	return false
+}
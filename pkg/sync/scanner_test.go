@@ -0,0 +1,120 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: --files-from / --exclude-from
+func TestWalkFiles(t *testing.T) {
+	collect := func(root, filesFrom string) []string {
+		var visited []string
+		err := walkFiles(root, filesFrom, func(path, relPath string, info os.FileInfo) error {
+			visited = append(visited, relPath)
+			return nil
+		})
+		require.NoError(t, err)
+		sort.Strings(visited)
+		return visited
+	}
+
+	t.Run("walk whole tree by default", func(t *testing.T) {
+		tempDir := t.TempDir()
+		createTempFile(t, tempDir, "a.txt", "a")
+		createTempFile(t, tempDir, "sub/b.txt", "b")
+
+		assert.Equal(t, []string{"a.txt", "sub/b.txt"}, collect(tempDir, ""))
+	})
+
+	t.Run("visit only listed files", func(t *testing.T) {
+		tempDir := t.TempDir()
+		createTempFile(t, tempDir, "a.txt", "a")
+		createTempFile(t, tempDir, "sub/b.txt", "b")
+		createTempFile(t, tempDir, "sub/c.txt", "c")
+
+		listDir := t.TempDir()
+		filesFrom := createTempFile(t, listDir, "list.txt", "# comment\nsub/b.txt\nmissing.txt\n../escape.txt\nsub\n\n"+filepath.Join(tempDir, "a.txt"))
+
+		assert.Equal(t, []string{"a.txt", "sub/b.txt"}, collect(tempDir, filesFrom))
+	})
+
+	t.Run("missing list file is an error", func(t *testing.T) {
+		err := walkFiles(t.TempDir(), filepath.Join(t.TempDir(), "nope.txt"), func(path, relPath string, info os.FileInfo) error {
+			return nil
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestReadPatternFile(t *testing.T) {
+	tempDir := t.TempDir()
+	path := createTempFile(t, tempDir, "patterns.txt", "# comment\n*.iso\n\n  cache/  \n")
+
+	patterns, err := readPatternFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*.iso", "cache/"}, patterns)
+
+	_, err = readPatternFile(filepath.Join(tempDir, "missing.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExcludeFromGlobs(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"keep.txt", "disk.iso", "sub/old.iso", "cache/x.txt", "sub/cache/y.txt", "sub/cache.txt", "build/a/b/main.o", "build/main.c"} {
+		createTempFile(t, root, name, name)
+	}
+	createTempFile(t, root, "docs/cache", "a file, not a directory")
+	excludeFrom := createTempFile(t, t.TempDir(), "exclude.txt", "# comment\n*.iso\n\n  cache/  \nbuild/**/*.o\n")
+
+	s, err := New(Config{Bucket: "test-bucket", RootDir: root, ExcludeFrom: excludeFrom, StateDir: t.TempDir(), Client: new(mockS3Client)})
+	require.NoError(t, err)
+
+	entries := make(chan fileEntry, 20)
+	require.NoError(t, (&scanner{root: root, ignore: s.shouldIgnore}).run(context.Background(), entries))
+	var uploaded []string
+	for entry := range entries {
+		uploaded = append(uploaded, entry.relPath)
+	}
+	assert.ElementsMatch(t, []string{"keep.txt", "sub/cache.txt", "build/main.c", "docs/cache"}, uploaded)
+}
+
+func TestWalkSkipsUnreadableEntries(t *testing.T) {
+	t.Run("unreadable root still aborts", func(t *testing.T) {
+		var skipped []string
+		err := walkFilesSkipping(filepath.Join(t.TempDir(), "missing"), "", func(path, relPath string, info os.FileInfo) error {
+			return nil
+		}, func(relPath string, err error) { skipped = append(skipped, relPath) })
+		assert.Error(t, err)
+		assert.Empty(t, skipped)
+	})
+
+	t.Run("permission-denied directory is skipped", func(t *testing.T) {
+		if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+			t.Skip("directory permissions are not enforced here")
+		}
+		tempDir := t.TempDir()
+		createTempFile(t, tempDir, "a.txt", "a")
+		createTempFile(t, tempDir, "locked/b.txt", "b")
+		require.NoError(t, os.Chmod(filepath.Join(tempDir, "locked"), 0))
+		t.Cleanup(func() { os.Chmod(filepath.Join(tempDir, "locked"), 0755) })
+
+		var visited, skipped []string
+		err := walkFilesSkipping(tempDir, "", func(path, relPath string, info os.FileInfo) error {
+			visited = append(visited, relPath)
+			return nil
+		}, func(relPath string, err error) { skipped = append(skipped, relPath) })
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a.txt"}, visited)
+		assert.Equal(t, []string{"locked"}, skipped)
+
+		assert.Error(t, walkFiles(tempDir, "", func(path, relPath string, info os.FileInfo) error { return nil }),
+			"without a handler the walk still aborts")
+	})
+}
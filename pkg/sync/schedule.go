@@ -0,0 +1,37 @@
+package sync
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/robfig/cron/v3"
+)
+
+// NextRuns validates spec as Watch reads Config.Schedule, a five-field
+// cron expression, a descriptor such as @hourly or @daily, or @every with
+// a duration, and returns the next n times it fires after t.
+func NextRuns(spec string, after time.Time, n int) ([]time.Time, error) {
+	schedule, err := cron.ParseStandard(strings.TrimSpace(spec))
+	if err != nil {
+		return nil, i18n.Errorf("schedule.invalid", spec, err)
+	}
+	runs := make([]time.Time, 0, n)
+	for t := after; len(runs) < n; {
+		t = schedule.Next(t)
+		if t.IsZero() {
+			break
+		}
+		runs = append(runs, t)
+	}
+	return runs, nil
+}
+
+// EverySchedule returns the Schedule of a run every d, which must be at
+// least a second.
+func EverySchedule(d time.Duration) (string, error) {
+	if d < time.Second {
+		return "", i18n.Errorf("schedule.invalid_every", d)
+	}
+	return "@every " + d.String(), nil
+}
@@ -0,0 +1,44 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: schedules
+func TestNextRuns(t *testing.T) {
+	after := time.Date(2026, 10, 16, 10, 7, 0, 0, time.Local)
+	at := func(hour, minute int) time.Time { return time.Date(2026, 10, 16, hour, minute, 0, 0, time.Local) }
+
+	runs, err := NextRuns("*/15 * * * *", after, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{at(10, 15), at(10, 30), at(10, 45)}, runs)
+
+	runs, err = NextRuns(" @hourly ", after, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{at(11, 0), at(12, 0)}, runs)
+
+	runs, err = NextRuns("@every 20m", after, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{at(10, 27), at(10, 47)}, runs)
+
+	for _, spec := range []string{"", "every 15m", "*/15 * * *", "61 * * * *", "@sometimes"} {
+		_, err := NextRuns(spec, after, 1)
+		assert.Equal(t, "schedule.invalid", i18n.ID(err), spec)
+	}
+}
+
+func TestEverySchedule(t *testing.T) {
+	spec, err := EverySchedule(15 * time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "@every 15m0s", spec)
+	_, err = NextRuns(spec, time.Now(), 1)
+	assert.NoError(t, err)
+
+	_, err = EverySchedule(500 * time.Millisecond)
+	assert.Equal(t, "schedule.invalid_every", i18n.ID(err))
+}
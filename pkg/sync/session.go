@@ -0,0 +1,120 @@
+package sync
+
+import (
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+const credentialExpiryWindow = 5 * time.Minute
+
+// Credentials selects where the AWS credentials come from. The zero value
+// uses the default chain (environment, shared files, instance roles).
+type Credentials struct {
+	// Profile names a profile of the shared config and credentials files.
+	Profile string
+	// RoleARN, when set, is assumed through STS with the base credentials;
+	// ExternalID is passed along when the role's trust policy requires it.
+	RoleARN    string
+	ExternalID string
+	// KeyStore, when set, names the KeyStore (see ParseKeyStore) holding
+	// static access keys to use as the base credentials instead.
+	KeyStore string
+}
+
+// NewSession creates the AWS session gui-sync uses for region, with
+// requests retried as retry says and each attempt bounded by timeouts.
+func NewSession(region string, creds Credentials, retry RetryPolicy, timeouts Timeouts) (*session.Session, error) {
+	if err := retry.Validate(); err != nil {
+		return nil, err
+	}
+	if err := timeouts.Validate(); err != nil {
+		return nil, err
+	}
+	var static *credentials.Credentials
+	if creds.KeyStore != "" {
+		keys, err := loadStoredKeys(creds.KeyStore, region, creds)
+		if err != nil {
+			return nil, err
+		}
+		static = credentials.NewStaticCredentials(keys.AccessKeyID, keys.SecretAccessKey, "")
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Profile:           creds.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+		Config: aws.Config{
+			Region:      aws.String(region),
+			Credentials: static,
+			Retryer:     newRetryer(retry),
+			// No overall client timeout: each attempt gets its own
+			// deadline from timeouts.
+			HTTPClient: &http.Client{
+				Transport: &http.Transport{
+					MaxIdleConns:          100,
+					MaxIdleConnsPerHost:   100,
+					IdleConnTimeout:       90 * time.Second,
+					ResponseHeaderTimeout: timeouts.metadata(),
+					DisableKeepAlives:     false,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if creds.RoleARN != "" {
+		sess.Config.Credentials = stscreds.NewCredentials(sess, creds.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = roleSessionName()
+			// Refresh ahead of expiry so long uploads never sign with
+			// credentials about to lapse.
+			p.ExpiryWindow = credentialExpiryWindow
+			if creds.ExternalID != "" {
+				p.ExternalID = aws.String(creds.ExternalID)
+			}
+		})
+	} else if creds.ExternalID != "" {
+		return nil, i18n.Errorf("session.external_id")
+	}
+
+	sess.Handlers.Retry.PushBack(retryExpiredCredentials)
+	timeouts.install(&sess.Handlers)
+
+	return sess, nil
+}
+
+var invalidSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// roleSessionName identifies the machine in CloudTrail entries of the
+// assumed role.
+func roleSessionName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	name := "gui-sync-" + invalidSessionNameChars.ReplaceAllString(host, "-")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// s3Config returns the S3 client settings of cfg on top of its session.
+func (cfg Config) s3Config() *aws.Config {
+	c := &aws.Config{}
+	if cfg.Accelerate {
+		c.S3UseAccelerate = aws.Bool(true)
+	}
+	if cfg.DualStack {
+		c.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+	}
+	return c
+}
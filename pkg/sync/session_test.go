@@ -0,0 +1,74 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: AWS profiles and assumed roles
+func TestNewSession(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", createTempFile(t, dir, "config", "[profile backup]\nregion = sa-east-1\n"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", createTempFile(t, dir, "credentials", "[backup]\naws_access_key_id = AKIDEXAMPLE\naws_secret_access_key = secret\n"))
+
+	t.Run("named profile", func(t *testing.T) {
+		sess, err := NewSession("us-east-1", Credentials{Profile: "backup"}, RetryPolicy{}, Timeouts{})
+		require.NoError(t, err)
+		value, err := sess.Config.Credentials.Get()
+		require.NoError(t, err)
+		assert.Equal(t, "AKIDEXAMPLE", value.AccessKeyID)
+		assert.Equal(t, "us-east-1", aws.StringValue(sess.Config.Region), "the region flag wins over the profile")
+	})
+
+	t.Run("unknown profile has no credentials", func(t *testing.T) {
+		sess, err := NewSession("us-east-1", Credentials{Profile: "nope"}, RetryPolicy{}, Timeouts{})
+		require.NoError(t, err)
+		_, err = sess.Config.Credentials.Get()
+		assert.Error(t, err)
+	})
+
+	t.Run("external ID requires a role", func(t *testing.T) {
+		_, err := NewSession("us-east-1", Credentials{ExternalID: "abc"}, RetryPolicy{}, Timeouts{})
+		assert.Error(t, err)
+	})
+
+	t.Run("role is assumed from the base credentials", func(t *testing.T) {
+		sess, err := NewSession("us-east-1", Credentials{Profile: "backup", RoleARN: "arn:aws:iam::123456789012:role/backup", ExternalID: "abc"}, RetryPolicy{}, Timeouts{})
+		require.NoError(t, err)
+		assert.True(t, sess.Config.Credentials.IsExpired(), "assumed role credentials are fetched on first use")
+	})
+}
+
+func TestRoleSessionName(t *testing.T) {
+	name := roleSessionName()
+	assert.Regexp(t, `^gui-sync-[\w+=,.@-]*$`, name)
+	assert.LessOrEqual(t, len(name), 64)
+}
+
+func TestS3Endpoints(t *testing.T) {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("sa-east-1"),
+		Credentials: credentials.NewStaticCredentials("AKIDEXAMPLE", "secret", ""),
+	})
+	require.NoError(t, err)
+	host := func(cfg Config) string {
+		req, _ := s3.New(sess, cfg.s3Config()).HeadObjectRequest(&s3.HeadObjectInput{Bucket: aws.String("meu-bucket"), Key: aws.String("a.txt")})
+		require.NoError(t, req.Build())
+		return req.HTTPRequest.URL.Host
+	}
+
+	assert.Equal(t, "meu-bucket.s3.sa-east-1.amazonaws.com", host(Config{}))
+	assert.Equal(t, "meu-bucket.s3-accelerate.amazonaws.com", host(Config{Accelerate: true}))
+	assert.Equal(t, "meu-bucket.s3.dualstack.sa-east-1.amazonaws.com", host(Config{DualStack: true}))
+	assert.Equal(t, "meu-bucket.s3-accelerate.dualstack.amazonaws.com", host(Config{Accelerate: true, DualStack: true}))
+
+	_, err = New(Config{Bucket: "meu.bucket", Accelerate: true, Client: new(mockS3Client)})
+	assert.Equal(t, "syncer.accelerate_bucket", i18n.ID(err))
+}
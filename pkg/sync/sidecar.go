@@ -0,0 +1,240 @@
+package sync
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// sidecarSuffix names the optional file holding the object settings of its
+// companion: photo.jpg.meta.json describes photo.jpg. Sidecars are never
+// uploaded themselves.
+const sidecarSuffix = ".meta.json"
+
+// objectMeta is the content of a sidecar file.
+type objectMeta struct {
+	Metadata           map[string]string `json:"metadata"`
+	Tags               map[string]string `json:"tags"`
+	ContentType        string            `json:"content_type"`
+	CacheControl       string            `json:"cache_control"`
+	ContentDisposition string            `json:"content_disposition"`
+	ContentEncoding    string            `json:"content_encoding"`
+	ContentLanguage    string            `json:"content_language"`
+	StorageClass       string            `json:"storage_class"`
+	SSE                string            `json:"sse"`
+	KMSKeyID           string            `json:"kms_key_id"`
+	Compress           string            `json:"compress"`
+	ObjectLockMode     string            `json:"object_lock_mode"`
+	ObjectLockDays     int               `json:"object_lock_days"`
+}
+
+// isSidecar reports whether path is the sidecar of an existing file. A file
+// named like a sidecar without a companion is synced as a regular file.
+func isSidecar(path string) bool {
+	if !strings.HasSuffix(path, sidecarSuffix) {
+		return false
+	}
+	info, err := os.Stat(strings.TrimSuffix(path, sidecarSuffix))
+	return err == nil && !info.IsDir()
+}
+
+// readSidecar loads the sidecar of path, returning nil when it has none.
+func readSidecar(path string) (*objectMeta, error) {
+	data, err := os.ReadFile(path + sidecarSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, i18n.Errorf("sidecar.read", path, sidecarSuffix, err)
+	}
+
+	var meta objectMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, i18n.Errorf("sidecar.invalid", path, sidecarSuffix, err)
+	}
+	if err := (UploadOptions{SSE: meta.SSE, KMSKeyID: meta.KMSKeyID, StorageClass: meta.StorageClass}).Validate(); err != nil {
+		return nil, i18n.Errorf("sidecar.invalid", path, sidecarSuffix, err)
+	}
+	if err := validateObjectLock(meta.ObjectLockMode, meta.ObjectLockDays); err != nil {
+		return nil, i18n.Errorf("sidecar.invalid", path, sidecarSuffix, err)
+	}
+	if meta.Metadata, err = userMetadata(meta.Metadata); err != nil {
+		return nil, i18n.Errorf("sidecar.invalid", path, sidecarSuffix, err)
+	}
+	if err := validateCompression(meta.Compress); err != nil {
+		return nil, i18n.Errorf("sidecar.invalid", path, sidecarSuffix, err)
+	}
+	return &meta, nil
+}
+
+// sidecarModified reports whether the sidecar of path changed after since,
+// so metadata edits are uploaded even when the file itself did not change.
+func sidecarModified(path string, since time.Time) bool {
+	info, err := os.Stat(path + sidecarSuffix)
+	return err == nil && info.ModTime().After(since)
+}
+
+// overlay returns the settings of m with those set in o replacing them.
+// Metadata and tags are merged key by key. Either may be nil.
+func (m *objectMeta) overlay(o *objectMeta) *objectMeta {
+	if m == nil {
+		return o
+	}
+	if o == nil {
+		return m
+	}
+
+	merged := *m
+	merged.Metadata = mergeMaps(m.Metadata, o.Metadata)
+	merged.Tags = mergeMaps(m.Tags, o.Tags)
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&merged.ContentType, o.ContentType},
+		{&merged.CacheControl, o.CacheControl},
+		{&merged.ContentDisposition, o.ContentDisposition},
+		{&merged.ContentEncoding, o.ContentEncoding},
+		{&merged.ContentLanguage, o.ContentLanguage},
+		{&merged.StorageClass, o.StorageClass},
+		{&merged.Compress, o.Compress},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	// A KMS key only goes with the encryption it was given for, and a
+	// retention period with its mode.
+	if o.SSE != "" {
+		merged.SSE = o.SSE
+		merged.KMSKeyID = o.KMSKeyID
+	}
+	if o.ObjectLockMode != "" {
+		merged.ObjectLockMode = o.ObjectLockMode
+		merged.ObjectLockDays = o.ObjectLockDays
+	}
+	return &merged
+}
+
+func mergeMaps(base, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
+
+func (m *objectMeta) tagging() *string {
+	if len(m.Tags) == 0 {
+		return nil
+	}
+	values := url.Values{}
+	for key, value := range m.Tags {
+		values.Set(key, value)
+	}
+	return aws.String(values.Encode())
+}
+
+func (m *objectMeta) metadata() map[string]*string {
+	if len(m.Metadata) == 0 {
+		return nil
+	}
+	return aws.StringMap(m.Metadata)
+}
+
+// userMetadataPrefix is the header prefix of user metadata. Keys may be
+// written with it, as in x-amz-meta-author; the SDK adds it back.
+const userMetadataPrefix = "x-amz-meta-"
+
+// userMetadata returns metadata with the keys stripped of
+// userMetadataPrefix, failing on keys that are not valid header names or
+// that collide with the entries gui-sync stores itself.
+func userMetadata(metadata map[string]string) (map[string]string, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	normalized := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		name := key
+		if len(name) > len(userMetadataPrefix) && strings.EqualFold(name[:len(userMetadataPrefix)], userMetadataPrefix) {
+			name = name[len(userMetadataPrefix):]
+		}
+		if name == "" || strings.IndexFunc(name, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+		}) >= 0 {
+			return nil, i18n.Errorf("sidecar.invalid_key", key)
+		}
+		if reservedMetadataKey(name) {
+			return nil, i18n.Errorf("sidecar.reserved_key", key)
+		}
+		normalized[name] = value
+	}
+	return normalized, nil
+}
+
+// applyPut copies the sidecar settings onto a single-part upload request.
+func (m *objectMeta) applyPut(input *s3.PutObjectInput) {
+	if m == nil {
+		return
+	}
+	input.Metadata = m.metadata()
+	input.Tagging = m.tagging()
+	input.ContentType = optionalString(m.ContentType)
+	input.CacheControl = optionalString(m.CacheControl)
+	input.ContentDisposition = optionalString(m.ContentDisposition)
+	input.ContentEncoding = optionalString(m.ContentEncoding)
+	input.ContentLanguage = optionalString(m.ContentLanguage)
+	input.StorageClass = optionalString(m.StorageClass)
+	input.ServerSideEncryption = optionalString(m.SSE)
+	input.SSEKMSKeyId = optionalString(m.KMSKeyID)
+}
+
+// applyCopy copies the sidecar settings onto a copy request that replaces
+// the metadata of the source.
+func (m *objectMeta) applyCopy(input *s3.CopyObjectInput) {
+	if m == nil {
+		return
+	}
+	input.Metadata = m.metadata()
+	if input.Tagging = m.tagging(); input.Tagging != nil {
+		input.TaggingDirective = aws.String(s3.TaggingDirectiveReplace)
+	}
+	input.ContentType = optionalString(m.ContentType)
+	input.CacheControl = optionalString(m.CacheControl)
+	input.ContentDisposition = optionalString(m.ContentDisposition)
+	input.ContentEncoding = optionalString(m.ContentEncoding)
+	input.ContentLanguage = optionalString(m.ContentLanguage)
+	input.StorageClass = optionalString(m.StorageClass)
+	input.ServerSideEncryption = optionalString(m.SSE)
+	input.SSEKMSKeyId = optionalString(m.KMSKeyID)
+}
+
+// applyMultipart copies the sidecar settings onto the request that starts a
+// multipart upload.
+func (m *objectMeta) applyMultipart(input *s3.CreateMultipartUploadInput) {
+	if m == nil {
+		return
+	}
+	input.Metadata = m.metadata()
+	input.Tagging = m.tagging()
+	input.ContentType = optionalString(m.ContentType)
+	input.CacheControl = optionalString(m.CacheControl)
+	input.ContentDisposition = optionalString(m.ContentDisposition)
+	input.ContentEncoding = optionalString(m.ContentEncoding)
+	input.ContentLanguage = optionalString(m.ContentLanguage)
+	input.StorageClass = optionalString(m.StorageClass)
+	input.ServerSideEncryption = optionalString(m.SSE)
+	input.SSEKMSKeyId = optionalString(m.KMSKeyID)
+}
@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: per-object metadata sidecar files
+func TestSidecarsAreSkipped(t *testing.T) {
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "photo.jpg", "jpeg")
+	createTempFile(t, tempDir, "photo.jpg.meta.json", `{"content_type": "image/jpeg"}`)
+	createTempFile(t, tempDir, "orphan.meta.json", "{}")
+
+	var visited []string
+	err := walkFiles(tempDir, "", func(path, relPath string, info os.FileInfo) error {
+		visited = append(visited, relPath)
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(visited)
+
+	assert.Equal(t, []string{"orphan.meta.json", "photo.jpg"}, visited)
+}
+
+func TestReadSidecar(t *testing.T) {
+	t.Run("no sidecar", func(t *testing.T) {
+		meta, err := readSidecar(createTempFile(t, t.TempDir(), "a.txt", "a"))
+		assert.NoError(t, err)
+		assert.Nil(t, meta)
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		tempDir := t.TempDir()
+		path := createTempFile(t, tempDir, "a.txt", "a")
+		createTempFile(t, tempDir, "a.txt.meta.json", "{")
+
+		_, err := readSidecar(path)
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid storage class", func(t *testing.T) {
+		tempDir := t.TempDir()
+		path := createTempFile(t, tempDir, "a.txt", "a")
+		createTempFile(t, tempDir, "a.txt.meta.json", `{"storage_class": "CHEAP"}`)
+
+		_, err := readSidecar(path)
+		assert.Error(t, err)
+	})
+
+	t.Run("reserved metadata key", func(t *testing.T) {
+		tempDir := t.TempDir()
+		path := createTempFile(t, tempDir, "a.txt", "a")
+		createTempFile(t, tempDir, "a.txt.meta.json", `{"metadata": {"Sync-Md5": "0"}}`)
+
+		_, err := readSidecar(path)
+		assert.Error(t, err)
+	})
+}
+
+func TestUploadWithSidecar(t *testing.T) {
+	tempDir := t.TempDir()
+	path := createTempFile(t, tempDir, "photo.jpg", "jpeg")
+	createTempFile(t, tempDir, "photo.jpg.meta.json", `{
+		"metadata": {"author": "gui"},
+		"tags": {"project": "site", "stage": "final"},
+		"content_type": "image/jpeg",
+		"cache_control": "max-age=3600"
+	}`)
+
+	mockClient := new(mockS3Client)
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return aws.StringValue(input.Metadata["author"]) == "gui" &&
+			aws.StringValue(input.Tagging) == "project=site&stage=final" &&
+			aws.StringValue(input.ContentType) == "image/jpeg" &&
+			aws.StringValue(input.CacheControl) == "max-age=3600"
+	})).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	_, err := newTestSyncer(t, mockClient).uploadFileS3("photo.jpg", path, 4)
+	require.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
+
+func TestSidecarChangeTriggersUpload(t *testing.T) {
+	tempDir := t.TempDir()
+	path := createTempFile(t, tempDir, "photo.jpg", "jpeg")
+	sidecar := createTempFile(t, tempDir, "photo.jpg.meta.json", "{}")
+
+	uploadedAt := time.Now()
+	require.NoError(t, os.Chtimes(path, uploadedAt.Add(-time.Hour), uploadedAt.Add(-time.Hour)))
+	require.NoError(t, os.Chtimes(sidecar, uploadedAt.Add(time.Minute), uploadedAt.Add(time.Minute)))
+
+	mockClient := new(mockS3Client)
+	mockClient.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+		ContentLength: aws.Int64(4),
+		LastModified:  aws.Time(uploadedAt),
+		ETag:          aws.String(`"x"`),
+	}, nil)
+
+	changed, err := newTestSyncer(t, mockClient).fileChangedOnS3("photo.jpg", path)
+	require.NoError(t, err)
+	assert.True(t, changed)
+}
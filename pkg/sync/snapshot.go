@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// SnapshotVSS as Config.Snapshot takes a Volume Shadow Copy of the volume
+// of RootDir, which needs an elevated process on Windows.
+const SnapshotVSS = "vss"
+
+const (
+	hookSnapshot        = "snapshot"
+	hookSnapshotRelease = "snapshot-release"
+)
+
+// takeSnapshot returns the directory a run walks: RootDir itself, or with
+// Config.Snapshot the same tree in a snapshot taken now. release removes
+// the snapshot once the run and its replicas are done; replicas walk the
+// snapshot of their primary.
+func (s *Syncer) takeSnapshot(ctx context.Context) (root string, release func(), err error) {
+	if s.primary != nil && s.primary.snapshotRoot != "" {
+		return s.primary.snapshotRoot, func() {}, nil
+	}
+	if s.cfg.Snapshot == "" {
+		return s.cfg.RootDir, func() {}, nil
+	}
+
+	fmt.Println(i18n.T("snapshot.taking"))
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+
+	var remove func() error
+	if s.cfg.Snapshot == SnapshotVSS {
+		var id string
+		root, id, err = createShadowCopy(ctx, s.cfg.RootDir)
+		remove = func() error { return deleteShadowCopy(id) }
+	} else {
+		root, err = s.snapshotCommand(ctx)
+		remove = func() error { return s.releaseSnapshot(root) }
+	}
+	if err == nil {
+		if info, statErr := os.Stat(root); statErr != nil || !info.IsDir() {
+			err = i18n.Errorf("snapshot.not_dir", root)
+		}
+	}
+
+	release = func() {
+		s.snapshotRoot = ""
+		if err := remove(); err != nil {
+			log.Printf(i18n.T("snapshot.release_failed"), err)
+		}
+	}
+	if err != nil {
+		// The release command also cleans up a snapshot taken only in
+		// part.
+		if s.cfg.Snapshot != SnapshotVSS || root != "" {
+			release()
+		}
+		return "", nil, i18n.Errorf("snapshot.failed", err)
+	}
+	s.snapshotRoot = root
+	fmt.Printf(i18n.T("snapshot.taken"), root)
+	return root, release, nil
+}
+
+// scanCacheKey returns the root whose scan cache a run over root uses:
+// RootDir for a snapshot of it, whose directory may change with every run.
+func (s *Syncer) scanCacheKey(root string) string {
+	if s.primary != nil && root == s.primary.snapshotRoot || root == s.snapshotRoot {
+		return s.cfg.RootDir
+	}
+	return root
+}
+
+// snapshotCommand runs the command of Config.Snapshot and returns the last
+// line it printed, relative to RootDir unless absolute.
+func (s *Syncer) snapshotCommand(ctx context.Context) (string, error) {
+	event := hookEvent{Hook: hookSnapshot, Bucket: s.cfg.Bucket, RootDir: s.cfg.RootDir}
+	cmd := s.shellCommand(ctx, s.cfg.Snapshot, event.env())
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return "", i18n.Errorf("hooks.command", s.cfg.Snapshot, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	dir := strings.TrimSpace(lines[len(lines)-1])
+	if dir == "" {
+		return "", i18n.Errorf("snapshot.no_dir", s.cfg.Snapshot)
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(s.cfg.RootDir, dir)
+	}
+	return dir, nil
+}
+
+// releaseSnapshot runs Config.SnapshotRelease for the snapshot at dir, which
+// is empty when the snapshot command failed.
+func (s *Syncer) releaseSnapshot(dir string) error {
+	if s.cfg.SnapshotRelease == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	event := hookEvent{Hook: hookSnapshotRelease, Bucket: s.cfg.Bucket, RootDir: s.cfg.RootDir}
+	cmd := s.shellCommand(ctx, s.cfg.SnapshotRelease, append(event.env(), "GUI_SYNC_SNAPSHOT_DIR="+dir))
+	cmd.Stdout = os.Stdout
+	if err := cmd.Run(); err != nil {
+		return i18n.Errorf("hooks.command", s.cfg.SnapshotRelease, err)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package sync
+
+import (
+	"context"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// createShadowCopy and deleteShadowCopy: Volume Shadow Copies only exist on
+// Windows, and New rejects SnapshotVSS elsewhere.
+func createShadowCopy(ctx context.Context, dir string) (root, id string, err error) {
+	return "", "", i18n.Errorf("snapshot.vss_unsupported")
+}
+
+func deleteShadowCopy(id string) error { return nil }
@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: snapshots of the synced directory
+func TestTakeSnapshot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("comandos de snapshot de teste usam sh")
+	}
+
+	newSnapshotSyncer := func(t *testing.T) *Syncer {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.RootDir = t.TempDir()
+		createTempFile(t, s.cfg.RootDir, "banco.db", "dados")
+		return s
+	}
+
+	t.Run("without snapshot the directory itself is walked", func(t *testing.T) {
+		s := newSnapshotSyncer(t)
+		root, release, err := s.takeSnapshot(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, s.cfg.RootDir, root)
+		release()
+	})
+
+	t.Run("command creates the snapshot and release removes it", func(t *testing.T) {
+		s := newSnapshotSyncer(t)
+		snapshot := filepath.Join(t.TempDir(), "snap")
+		s.cfg.Snapshot = `cp -R "$GUI_SYNC_ROOT_DIR" ` + snapshot + ` && echo criado >&2 && echo ` + snapshot
+		s.cfg.SnapshotRelease = `rm -rf "$GUI_SYNC_SNAPSHOT_DIR"`
+
+		root, release, err := s.takeSnapshot(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, snapshot, root)
+		assert.FileExists(t, filepath.Join(root, "banco.db"))
+		assert.Equal(t, s.cfg.RootDir, s.scanCacheKey(root), "the scan cache stays with RootDir")
+
+		release()
+		assert.NoDirExists(t, snapshot)
+		assert.Empty(t, s.snapshotRoot)
+	})
+
+	t.Run("relative directories are taken from RootDir", func(t *testing.T) {
+		s := newSnapshotSyncer(t)
+		require.NoError(t, os.Mkdir(filepath.Join(s.cfg.RootDir, ".snap"), 0755))
+		s.cfg.Snapshot = "echo .snap"
+
+		root, release, err := s.takeSnapshot(context.Background())
+		require.NoError(t, err)
+		defer release()
+		assert.Equal(t, filepath.Join(s.cfg.RootDir, ".snap"), root)
+	})
+
+	t.Run("replicas walk the snapshot of their primary", func(t *testing.T) {
+		s := newSnapshotSyncer(t)
+		s.snapshotRoot = t.TempDir()
+		replica := newTestSyncer(t, new(mockS3Client))
+		replica.cfg.RootDir = s.cfg.RootDir
+		replica.primary = s
+
+		root, release, err := replica.takeSnapshot(context.Background())
+		require.NoError(t, err)
+		release()
+		assert.Equal(t, s.snapshotRoot, root)
+		assert.Equal(t, s.cfg.RootDir, replica.scanCacheKey(root))
+	})
+
+	t.Run("failures still run the release command", func(t *testing.T) {
+		marker := filepath.Join(t.TempDir(), "released")
+		for _, command := range []string{"exit 2", "true", "echo " + filepath.Join(t.TempDir(), "missing")} {
+			s := newSnapshotSyncer(t)
+			s.cfg.Snapshot = command
+			s.cfg.SnapshotRelease = "touch " + marker
+
+			_, _, err := s.takeSnapshot(context.Background())
+			assert.Equal(t, "snapshot.failed", i18n.ID(err), command)
+			assert.FileExists(t, marker, command)
+			require.NoError(t, os.Remove(marker))
+		}
+	})
+
+	t.Run("failing snapshot fails the run", func(t *testing.T) {
+		s := newSnapshotSyncer(t)
+		s.client.(*mockS3Client).On("GetObject", mock.Anything).Return(nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)).Once()
+		s.cfg.Snapshot = "exit 1"
+
+		err := s.Run(context.Background())
+		assert.Equal(t, "snapshot.failed", i18n.ID(err))
+	})
+
+	t.Run("vss is only available on Windows", func(t *testing.T) {
+		_, err := New(Config{Bucket: "test-bucket", Client: new(mockS3Client), Snapshot: SnapshotVSS})
+		assert.Equal(t, "snapshot.vss_unsupported", i18n.ID(err))
+	})
+}
@@ -0,0 +1,68 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// shadowCopyIDPattern matches the GUIDs identifying shadow copies, the only
+// values placed in the scripts run to remove them.
+var shadowCopyIDPattern = regexp.MustCompile(`^\{[0-9A-Fa-f-]{36}\}$`)
+
+// createShadowCopy takes a Volume Shadow Copy of the volume of dir through
+// PowerShell and returns dir inside it, along with the ID of the copy.
+func createShadowCopy(ctx context.Context, dir string) (root, id string, err error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	volume := filepath.VolumeName(abs)
+	if len(volume) != 2 || volume[1] != ':' {
+		return "", "", i18n.Errorf("snapshot.vss_volume", abs)
+	}
+
+	script := fmt.Sprintf(`$ErrorActionPreference = 'Stop'
+$r = Invoke-CimMethod -ClassName Win32_ShadowCopy -MethodName Create -Arguments @{Volume = '%s\'; Context = 'ClientAccessible'}
+if ($r.ReturnValue -ne 0) { throw "Win32_ShadowCopy.Create: $($r.ReturnValue)" }
+$c = Get-CimInstance -ClassName Win32_ShadowCopy -Filter "ID = '$($r.ShadowID)'"
+$c.ID
+$c.DeviceObject`, volume)
+	out, err := powershell(ctx, script)
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.Fields(out)
+	if len(lines) != 2 || !shadowCopyIDPattern.MatchString(lines[0]) {
+		return "", "", i18n.Errorf("snapshot.vss_failed", out)
+	}
+	return lines[1] + strings.TrimPrefix(abs, volume), lines[0], nil
+}
+
+// deleteShadowCopy removes the shadow copy id.
+func deleteShadowCopy(id string) error {
+	if !shadowCopyIDPattern.MatchString(id) {
+		return i18n.Errorf("snapshot.vss_failed", id)
+	}
+	script := fmt.Sprintf(`Get-CimInstance -ClassName Win32_ShadowCopy -Filter "ID = '%s'" | Remove-CimInstance`, id)
+	_, err := powershell(context.Background(), script)
+	return err
+}
+
+func powershell(ctx context.Context, script string) (string, error) {
+	out, err := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", script).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return "", i18n.Errorf("snapshot.vss_failed", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	if err != nil {
+		return "", i18n.Errorf("snapshot.vss_failed", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
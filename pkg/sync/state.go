@@ -0,0 +1,67 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// statePath joins elem below the directory where gui-sync keeps local state
+// between runs (checkpoints, cached bucket settings).
+func (s *Syncer) statePath(elem ...string) string {
+	return filepath.Join(append([]string{s.stateDir}, elem...)...)
+}
+
+// readStateFile decodes a JSON state file into v. A missing file is reported
+// through os.IsNotExist on the returned error, and a file written in a newer
+// format through a *FormatError.
+func readStateFile(path string, v versionedDocument) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := checkFormat(path, data); err != nil {
+		var formatErr *FormatError
+		if errors.As(err, &formatErr) {
+			return err
+		}
+		return i18n.Errorf("state.corrupt", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return i18n.Errorf("state.corrupt", path, err)
+	}
+	return nil
+}
+
+// writeStateFile atomically replaces path with the JSON encoding of v,
+// stamped with the format and version of this build.
+func writeStateFile(path string, v versionedDocument) error {
+	v.stampFormat()
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return i18n.Errorf("state.mkdir", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return i18n.Errorf("state.write", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return i18n.Errorf("state.write", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return i18n.Errorf("state.write", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,186 @@
+package sync
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// runStats counts what happened during a sync run. Counters are updated
+// concurrently by the upload workers and read by the control API, so every
+// field is atomic and the value is reset rather than replaced between runs.
+type runStats struct {
+	started       atomic.Int64
+	scanned       atomic.Int64
+	uploaded      atomic.Int64
+	skipped       atomic.Int64
+	deleted       atomic.Int64
+	failed        atomic.Int64
+	unreadable    atomic.Int64
+	bytesUploaded atomic.Int64
+	// deduplicated counts the uploads replaced by copies of identical
+	// contents already in the bucket, and the bytes they did not send.
+	deduplicated      atomic.Int64
+	bytesDeduplicated atomic.Int64
+	// moved counts the uploads replaced by copies of the objects of files
+	// moved locally, and the bytes they did not send.
+	moved      atomic.Int64
+	bytesMoved atomic.Int64
+	// busy counts the files left for the next run because they were being
+	// written.
+	busy atomic.Int64
+	// invalidKeys counts the files skipped because their names cannot be
+	// keys.
+	invalidKeys atomic.Int64
+	// overQuota counts the changed files not uploaded because the run
+	// exceeded its quota.
+	overQuota atomic.Int64
+
+	// pending counts uploads queued but not finished; transferred counts
+	// bytes sent so far, including files still in flight.
+	pending     atomic.Int64
+	transferred atomic.Int64
+}
+
+// RunSummary is a point-in-time copy of runStats. BytesPerSecond is the
+// average upload throughput over the whole run.
+type RunSummary struct {
+	Scanned        int64   `json:"scanned"`
+	Uploaded       int64   `json:"uploaded"`
+	Skipped        int64   `json:"skipped"`
+	Deleted        int64   `json:"deleted"`
+	Failed         int64   `json:"failed"`
+	Unreadable     int64   `json:"unreadable"`
+	BytesUploaded  int64   `json:"bytes_uploaded"`
+	DurationSecs   float64 `json:"duration_seconds"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+
+	Deduplicated      int64 `json:"deduplicated,omitempty"`
+	BytesDeduplicated int64 `json:"bytes_deduplicated,omitempty"`
+	Moved             int64 `json:"moved,omitempty"`
+	BytesMoved        int64 `json:"bytes_moved,omitempty"`
+	Busy              int64 `json:"busy,omitempty"`
+	InvalidKeys       int64 `json:"invalid_keys,omitempty"`
+	OverQuota         int64 `json:"over_quota,omitempty"`
+}
+
+func (s *runStats) reset() {
+	s.scanned.Store(0)
+	s.uploaded.Store(0)
+	s.skipped.Store(0)
+	s.deleted.Store(0)
+	s.failed.Store(0)
+	s.unreadable.Store(0)
+	s.bytesUploaded.Store(0)
+	s.deduplicated.Store(0)
+	s.bytesDeduplicated.Store(0)
+	s.moved.Store(0)
+	s.bytesMoved.Store(0)
+	s.busy.Store(0)
+	s.invalidKeys.Store(0)
+	s.overQuota.Store(0)
+	s.pending.Store(0)
+	s.transferred.Store(0)
+	s.started.Store(time.Now().UnixNano())
+}
+
+func (s *runStats) elapsed() time.Duration {
+	return time.Since(time.Unix(0, s.started.Load()))
+}
+
+func (s *runStats) summary() RunSummary {
+	summary := RunSummary{
+		Scanned:       s.scanned.Load(),
+		Uploaded:      s.uploaded.Load(),
+		Skipped:       s.skipped.Load(),
+		Deleted:       s.deleted.Load(),
+		Failed:        s.failed.Load(),
+		Unreadable:    s.unreadable.Load(),
+		BytesUploaded: s.bytesUploaded.Load(),
+		DurationSecs:  s.elapsed().Seconds(),
+
+		Deduplicated:      s.deduplicated.Load(),
+		BytesDeduplicated: s.bytesDeduplicated.Load(),
+		Moved:             s.moved.Load(),
+		BytesMoved:        s.bytesMoved.Load(),
+		Busy:              s.busy.Load(),
+		InvalidKeys:       s.invalidKeys.Load(),
+		OverQuota:         s.overQuota.Load(),
+	}
+	if summary.DurationSecs > 0 {
+		summary.BytesPerSecond = float64(summary.BytesUploaded) / summary.DurationSecs
+	}
+	return summary
+}
+
+// String renders the summary as the one-line report printed at the end of
+// each run.
+func (r RunSummary) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, i18n.T("stats.summary"),
+		r.Scanned, r.Uploaded, float64(r.BytesUploaded)/(1024*1024), r.Skipped, r.Deleted, r.Failed)
+	if r.Deduplicated > 0 {
+		fmt.Fprintf(&b, i18n.T("stats.deduplicated"), r.Deduplicated)
+	}
+	if r.Moved > 0 {
+		fmt.Fprintf(&b, i18n.T("stats.moved"), r.Moved)
+	}
+	if r.Unreadable > 0 {
+		fmt.Fprintf(&b, i18n.T("stats.unreadable"), r.Unreadable)
+	}
+	if r.Busy > 0 {
+		fmt.Fprintf(&b, i18n.T("stats.busy"), r.Busy)
+	}
+	if r.InvalidKeys > 0 {
+		fmt.Fprintf(&b, i18n.T("stats.invalid_keys"), r.InvalidKeys)
+	}
+	if r.OverQuota > 0 {
+		fmt.Fprintf(&b, i18n.T("stats.over_quota"), r.OverQuota)
+	}
+	fmt.Fprintf(&b, " · %.2f MB/s · %s", r.BytesPerSecond/(1024*1024),
+		time.Duration(r.DurationSecs*float64(time.Second)).Round(time.Second))
+	return b.String()
+}
+
+// transferRate returns the average upload throughput of the run so far in
+// bytes per second.
+func (s *runStats) transferRate() float64 {
+	secs := s.elapsed().Seconds()
+	if secs <= 0 {
+		return 0
+	}
+	return float64(s.transferred.Load()) / secs
+}
+
+// progressReader counts bytes read from an upload body into
+// stats.transferred. Rewinding the body (as the SDK does on retries)
+// takes the bytes back out so they are not counted twice. With a limiter,
+// reads are paced to its rate; this includes the pass the SDK makes to sign
+// the body, so the limit is on the low side.
+type progressReader struct {
+	body    io.ReadSeeker
+	stats   *runStats
+	read    int64
+	limiter *bandwidthLimiter
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.body.Read(b)
+	p.read += int64(n)
+	p.stats.transferred.Add(int64(n))
+	p.limiter.wait(n)
+	return n, err
+}
+
+func (p *progressReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := p.body.Seek(offset, whence)
+	if err == nil {
+		p.stats.transferred.Add(pos - p.read)
+		p.read = pos
+	}
+	return pos, err
+}
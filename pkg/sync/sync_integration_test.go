@@ -1,4 +1,4 @@
-package main
+package sync
 
 import (
 	"crypto/rand"
@@ -116,14 +116,9 @@ func TestIntegrationS3Upload(t *testing.T) {
 		t.Skip("Skipping integration test in short mode")
 	}
 
-	// Save original bucket name
-	originalBucket := bucketName
-	defer func() {
-		bucketName = originalBucket
-	}()
-	bucketName = testBucketName
-
-	client, sess := setupS3Client(t)
+	client, _ := setupS3Client(t)
+	s := newTestSyncer(t, client)
+	s.cfg.Bucket = testBucketName
 	tempDir := t.TempDir()
 
 	testCases := []struct {
@@ -194,7 +189,7 @@ func TestIntegrationS3Upload(t *testing.T) {
 			t.Logf("Uploading %s to S3...", tc.filename)
 			startUpload := time.Now()
 
-			uploadSize, err := uploadFileS3(client, sess, tc.filename, filePath, tc.size)
+			uploadSize, err := s.uploadFileS3(tc.filename, filePath, tc.size)
 			require.NoError(t, err)
 			assert.Equal(t, tc.size, uploadSize)
 
@@ -229,14 +224,9 @@ func TestIntegration50GBUpload(t *testing.T) {
 		t.Skip("Skipping 50GB test. Set RUN_50GB_TEST=true to run this test")
 	}
 
-	// Save original bucket name
-	originalBucket := bucketName
-	defer func() {
-		bucketName = originalBucket
-	}()
-	bucketName = testBucketName
-
-	client, sess := setupS3Client(t)
+	client, _ := setupS3Client(t)
+	s := newTestSyncer(t, client)
+	s.cfg.Bucket = testBucketName
 	tempDir := t.TempDir()
 
 	const (
@@ -259,7 +249,7 @@ func TestIntegration50GBUpload(t *testing.T) {
 	t.Logf("This may take 30+ minutes depending on your connection...")
 	startUpload := time.Now()
 
-	uploadSize, err := uploadFileS3(client, sess, filename, filePath, size50GB)
+	uploadSize, err := s.uploadFileS3(filename, filePath, size50GB)
 	require.NoError(t, err)
 	assert.Equal(t, int64(size50GB), uploadSize)
 
@@ -293,14 +283,9 @@ func TestIntegrationMultipleFilesUpload(t *testing.T) {
 		t.Skip("Skipping integration test in short mode")
 	}
 
-	// Save original bucket name
-	originalBucket := bucketName
-	defer func() {
-		bucketName = originalBucket
-	}()
-	bucketName = testBucketName
-
-	client, sess := setupS3Client(t)
+	client, _ := setupS3Client(t)
+	s := newTestSyncer(t, client)
+	s.cfg.Bucket = testBucketName
 	tempDir := t.TempDir()
 
 	// Create multiple files of different sizes
@@ -325,7 +310,7 @@ func TestIntegrationMultipleFilesUpload(t *testing.T) {
 	for _, f := range files {
 		filePath := createFileWithSize(t, tempDir, f.name, f.size)
 
-		uploadSize, err := uploadFileS3(client, sess, f.name, filePath, f.size)
+		uploadSize, err := s.uploadFileS3(f.name, filePath, f.size)
 		require.NoError(t, err)
 		assert.Equal(t, f.size, uploadSize)
 
@@ -353,14 +338,9 @@ func TestIntegrationFileChangedDetection(t *testing.T) {
 		t.Skip("Skipping integration test in short mode")
 	}
 
-	// Save original bucket name
-	originalBucket := bucketName
-	defer func() {
-		bucketName = originalBucket
-	}()
-	bucketName = testBucketName
-
-	client, sess := setupS3Client(t)
+	client, _ := setupS3Client(t)
+	s := newTestSyncer(t, client)
+	s.cfg.Bucket = testBucketName
 	tempDir := t.TempDir()
 
 	filename := "test-change-detection.txt"
@@ -370,12 +350,12 @@ func TestIntegrationFileChangedDetection(t *testing.T) {
 	defer cleanupS3Objects(t, client, []string{filename})
 
 	// Upload initial file
-	_, err := uploadFileS3(client, sess, filename, filePath, int64(len(content)))
+	_, err := s.uploadFileS3(filename, filePath, int64(len(content)))
 	require.NoError(t, err)
 
 	// Test 1: File hasn't changed
 	t.Run("file unchanged", func(t *testing.T) {
-		changed, err := fileChangedOnS3(client, filename, filePath)
+		changed, err := s.fileChangedOnS3(filename, filePath)
 		require.NoError(t, err)
 		assert.False(t, changed, "File should not be detected as changed")
 	})
@@ -387,7 +367,7 @@ func TestIntegrationFileChangedDetection(t *testing.T) {
 		err := os.WriteFile(filePath, []byte(newContent), 0644)
 		require.NoError(t, err)
 
-		changed, err := fileChangedOnS3(client, filename, filePath)
+		changed, err := s.fileChangedOnS3(filename, filePath)
 		require.NoError(t, err)
 		assert.True(t, changed, "File should be detected as changed")
 	})
@@ -395,7 +375,7 @@ func TestIntegrationFileChangedDetection(t *testing.T) {
 	// Test 3: File doesn't exist on S3
 	t.Run("new file", func(t *testing.T) {
 		newFilePath := createTempFile(t, tempDir, "new-file.txt", "new content")
-		changed, err := fileChangedOnS3(client, "new-file.txt", newFilePath)
+		changed, err := s.fileChangedOnS3("new-file.txt", newFilePath)
 		require.NoError(t, err)
 		assert.True(t, changed, "New file should be detected as changed")
 	})
@@ -1,4 +1,4 @@
-package main
+package sync
 
 import (
 	"fmt"
@@ -12,6 +12,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/gui-sync/pkg/i18n"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -31,6 +32,14 @@ func (m *mockS3Client) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutp
 	return args.Get(0).(*s3.HeadObjectOutput), args.Error(1)
 }
 
+func (m *mockS3Client) HeadBucket(input *s3.HeadBucketInput) (*s3.HeadBucketOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.HeadBucketOutput), args.Error(1)
+}
+
 func (m *mockS3Client) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
 	args := m.Called(input)
 	if args.Get(0) == nil {
@@ -55,7 +64,202 @@ func (m *mockS3Client) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(
 	return args.Error(1)
 }
 
+func (m *mockS3Client) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.CreateMultipartUploadOutput), args.Error(1)
+}
+
+func (m *mockS3Client) UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.UploadPartOutput), args.Error(1)
+}
+
+func (m *mockS3Client) UploadPartCopy(input *s3.UploadPartCopyInput) (*s3.UploadPartCopyOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.UploadPartCopyOutput), args.Error(1)
+}
+
+func (m *mockS3Client) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.CopyObjectOutput), args.Error(1)
+}
+
+func (m *mockS3Client) CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.CompleteMultipartUploadOutput), args.Error(1)
+}
+
+func (m *mockS3Client) AbortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.AbortMultipartUploadOutput), args.Error(1)
+}
+
+func (m *mockS3Client) GetBucketVersioning(input *s3.GetBucketVersioningInput) (*s3.GetBucketVersioningOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.GetBucketVersioningOutput), args.Error(1)
+}
+
+func (m *mockS3Client) GetBucketLocation(input *s3.GetBucketLocationInput) (*s3.GetBucketLocationOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.GetBucketLocationOutput), args.Error(1)
+}
+
+func (m *mockS3Client) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.CreateBucketOutput), args.Error(1)
+}
+
+func (m *mockS3Client) PutPublicAccessBlock(input *s3.PutPublicAccessBlockInput) (*s3.PutPublicAccessBlockOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.PutPublicAccessBlockOutput), args.Error(1)
+}
+
+func (m *mockS3Client) PutBucketEncryption(input *s3.PutBucketEncryptionInput) (*s3.PutBucketEncryptionOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.PutBucketEncryptionOutput), args.Error(1)
+}
+
+func (m *mockS3Client) ListObjectVersionsPages(input *s3.ListObjectVersionsInput, fn func(*s3.ListObjectVersionsOutput, bool) bool) error {
+	args := m.Called(input, mock.Anything)
+	if output := args.Get(0); output != nil {
+		fn(output.(*s3.ListObjectVersionsOutput), true)
+	}
+	return args.Error(1)
+}
+
+func (m *mockS3Client) RestoreObject(input *s3.RestoreObjectInput) (*s3.RestoreObjectOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.RestoreObjectOutput), args.Error(1)
+}
+
+func (m *mockS3Client) GetBucketLifecycleConfiguration(input *s3.GetBucketLifecycleConfigurationInput) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.GetBucketLifecycleConfigurationOutput), args.Error(1)
+}
+
+func (m *mockS3Client) PutBucketLifecycleConfiguration(input *s3.PutBucketLifecycleConfigurationInput) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.PutBucketLifecycleConfigurationOutput), args.Error(1)
+}
+
+func (m *mockS3Client) DeleteBucketLifecycle(input *s3.DeleteBucketLifecycleInput) (*s3.DeleteBucketLifecycleOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.DeleteBucketLifecycleOutput), args.Error(1)
+}
+
+func (m *mockS3Client) GetObjectLockConfiguration(input *s3.GetObjectLockConfigurationInput) (*s3.GetObjectLockConfigurationOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.GetObjectLockConfigurationOutput), args.Error(1)
+}
+
+func (m *mockS3Client) GetObjectRetention(input *s3.GetObjectRetentionInput) (*s3.GetObjectRetentionOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.GetObjectRetentionOutput), args.Error(1)
+}
+
+func (m *mockS3Client) GetObjectLegalHold(input *s3.GetObjectLegalHoldInput) (*s3.GetObjectLegalHoldOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.GetObjectLegalHoldOutput), args.Error(1)
+}
+
+func (m *mockS3Client) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.GetObjectOutput), args.Error(1)
+}
+
+func (m *mockS3Client) ListPartsPages(input *s3.ListPartsInput, fn func(*s3.ListPartsOutput, bool) bool) error {
+	args := m.Called(input, mock.Anything)
+	if output := args.Get(0); output != nil {
+		fn(output.(*s3.ListPartsOutput), true)
+	}
+	return args.Error(1)
+}
+
+func (m *mockS3Client) ListMultipartUploadsPages(input *s3.ListMultipartUploadsInput, fn func(*s3.ListMultipartUploadsOutput, bool) bool) error {
+	args := m.Called(input, mock.Anything)
+	if output := args.Get(0); output != nil {
+		fn(output.(*s3.ListMultipartUploadsOutput), true)
+	}
+	return args.Error(1)
+}
+
 // Test helpers
+
+// TestMain runs the tests in English, whatever the locale of the machine.
+func TestMain(m *testing.M) {
+	i18n.Set(i18n.English)
+	os.Exit(m.Run())
+}
+
+// newTestSyncer returns a Syncer for "test-bucket" backed by client, keeping
+// its local state in a temporary directory.
+func newTestSyncer(t testing.TB, client s3iface.S3API) *Syncer {
+	return &Syncer{
+		cfg:      Config{Bucket: "test-bucket"},
+		client:   client,
+		stateDir: t.TempDir(),
+		stats:    &runStats{},
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
 func createTempFile(t *testing.T, dir, name, content string) string {
 	path := filepath.Join(dir, name)
 	err := os.MkdirAll(filepath.Dir(path), 0755)
@@ -120,18 +324,10 @@ func TestCalculateMD5(t *testing.T) {
 
 // Test Suite: .syncignore Loading
 func TestLoadSyncIgnoreFile(t *testing.T) {
-	// Save original state
-	originalRootDir := rootDir
-	originalPatterns := ignorePatterns
-	defer func() {
-		rootDir = originalRootDir
-		ignorePatterns = originalPatterns
-	}()
-
 	t.Run("load valid syncignore file", func(t *testing.T) {
 		tempDir := t.TempDir()
-		rootDir = tempDir
-		ignorePatterns = nil
+		s := newTestSyncer(t, nil)
+		s.cfg.RootDir = tempDir
 
 		syncignoreContent := `# Comment line
 *.log
@@ -141,29 +337,29 @@ temp/
 node_modules/`
 		createTempFile(t, tempDir, ".syncignore", syncignoreContent)
 
-		err := loadSyncIgnoreFile()
+		err := s.loadSyncIgnoreFile()
 		assert.NoError(t, err)
-		assert.Len(t, ignorePatterns, 4)
-		assert.Contains(t, ignorePatterns, "*.log")
-		assert.Contains(t, ignorePatterns, "temp/")
-		assert.Contains(t, ignorePatterns, ".git/")
-		assert.Contains(t, ignorePatterns, "node_modules/")
+		assert.Len(t, s.ignorePatterns, 4)
+		assert.Contains(t, s.ignorePatterns, "*.log")
+		assert.Contains(t, s.ignorePatterns, "temp/")
+		assert.Contains(t, s.ignorePatterns, ".git/")
+		assert.Contains(t, s.ignorePatterns, "node_modules/")
 	})
 
 	t.Run("handle missing syncignore file", func(t *testing.T) {
 		tempDir := t.TempDir()
-		rootDir = tempDir
-		ignorePatterns = nil
+		s := newTestSyncer(t, nil)
+		s.cfg.RootDir = tempDir
 
-		err := loadSyncIgnoreFile()
+		err := s.loadSyncIgnoreFile()
 		assert.NoError(t, err)
-		assert.Empty(t, ignorePatterns)
+		assert.Empty(t, s.ignorePatterns)
 	})
 
 	t.Run("ignore empty lines and comments", func(t *testing.T) {
 		tempDir := t.TempDir()
-		rootDir = tempDir
-		ignorePatterns = nil
+		s := newTestSyncer(t, nil)
+		s.cfg.RootDir = tempDir
 
 		syncignoreContent := `# This is a comment
 
@@ -173,41 +369,36 @@ node_modules/`
 build/`
 		createTempFile(t, tempDir, ".syncignore", syncignoreContent)
 
-		err := loadSyncIgnoreFile()
+		err := s.loadSyncIgnoreFile()
 		assert.NoError(t, err)
-		assert.Len(t, ignorePatterns, 2)
-		assert.Contains(t, ignorePatterns, "*.tmp")
-		assert.Contains(t, ignorePatterns, "build/")
+		assert.Len(t, s.ignorePatterns, 2)
+		assert.Contains(t, s.ignorePatterns, "*.tmp")
+		assert.Contains(t, s.ignorePatterns, "build/")
 	})
 
 	t.Run("trim whitespace from patterns", func(t *testing.T) {
 		tempDir := t.TempDir()
-		rootDir = tempDir
-		ignorePatterns = nil
+		s := newTestSyncer(t, nil)
+		s.cfg.RootDir = tempDir
 
 		syncignoreContent := `  *.log  
 	temp/	
    .git/   `
 		createTempFile(t, tempDir, ".syncignore", syncignoreContent)
 
-		err := loadSyncIgnoreFile()
+		err := s.loadSyncIgnoreFile()
 		assert.NoError(t, err)
-		assert.Len(t, ignorePatterns, 3)
-		assert.Contains(t, ignorePatterns, "*.log")
-		assert.Contains(t, ignorePatterns, "temp/")
-		assert.Contains(t, ignorePatterns, ".git/")
+		assert.Len(t, s.ignorePatterns, 3)
+		assert.Contains(t, s.ignorePatterns, "*.log")
+		assert.Contains(t, s.ignorePatterns, "temp/")
+		assert.Contains(t, s.ignorePatterns, ".git/")
 	})
 }
 
 // Test Suite: shouldIgnore
 func TestShouldIgnore(t *testing.T) {
-	// Save original state
-	originalPatterns := ignorePatterns
-	defer func() {
-		ignorePatterns = originalPatterns
-	}()
-
-	ignorePatterns = []string{"*.log", "temp/", ".git/", "node_modules/"}
+	s := newTestSyncer(t, nil)
+	s.ignorePatterns = []string{"*.log", "temp/", ".git/", "node_modules/"}
 
 	tests := []struct {
 		name     string
@@ -226,33 +417,25 @@ func TestShouldIgnore(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := shouldIgnore(tt.path)
+			result := s.shouldIgnore(tt.path)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
 
 	t.Run("empty ignore patterns", func(t *testing.T) {
-		ignorePatterns = []string{}
-		assert.False(t, shouldIgnore("anything.txt"))
+		s.ignorePatterns = []string{}
+		assert.False(t, s.shouldIgnore("anything.txt"))
 	})
 
 	t.Run("case sensitive matching", func(t *testing.T) {
-		ignorePatterns = []string{"Test.txt"}
-		assert.True(t, shouldIgnore("Test.txt"))
-		assert.False(t, shouldIgnore("test.txt"))
+		s.ignorePatterns = []string{"Test.txt"}
+		assert.True(t, s.shouldIgnore("Test.txt"))
+		assert.False(t, s.shouldIgnore("test.txt"))
 	})
 }
 
 // Test Suite: fileChangedOnS3
 func TestFileChangedOnS3(t *testing.T) {
-	// Save original state
-	originalBucket := bucketName
-	defer func() {
-		bucketName = originalBucket
-	}()
-
-	bucketName = "test-bucket"
-
 	t.Run("file not found on S3", func(t *testing.T) {
 		mockClient := new(mockS3Client)
 		tempDir := t.TempDir()
@@ -270,7 +453,7 @@ func TestFileChangedOnS3(t *testing.T) {
 			awsErr,
 		).Once()
 
-		changed, err := fileChangedOnS3(mockClient, "new.txt", filePath)
+		changed, err := newTestSyncer(t, mockClient).fileChangedOnS3("new.txt", filePath)
 		assert.NoError(t, err)
 		assert.True(t, changed)
 		mockClient.AssertExpectations(t)
@@ -292,7 +475,7 @@ func TestFileChangedOnS3(t *testing.T) {
 			nil,
 		).Once()
 
-		changed, err := fileChangedOnS3(mockClient, "test.txt", filePath)
+		changed, err := newTestSyncer(t, mockClient).fileChangedOnS3("test.txt", filePath)
 		assert.NoError(t, err)
 		assert.True(t, changed)
 		mockClient.AssertExpectations(t)
@@ -316,7 +499,7 @@ func TestFileChangedOnS3(t *testing.T) {
 			nil,
 		).Once()
 
-		changed, err := fileChangedOnS3(mockClient, "test.txt", filePath)
+		changed, err := newTestSyncer(t, mockClient).fileChangedOnS3("test.txt", filePath)
 		assert.NoError(t, err)
 		assert.False(t, changed)
 		mockClient.AssertExpectations(t)
@@ -341,7 +524,7 @@ func TestFileChangedOnS3(t *testing.T) {
 			nil,
 		).Once()
 
-		changed, err := fileChangedOnS3(mockClient, "large.txt", filePath)
+		changed, err := newTestSyncer(t, mockClient).fileChangedOnS3("large.txt", filePath)
 		assert.NoError(t, err)
 		assert.True(t, changed) // Local file is newer
 		mockClient.AssertExpectations(t)
@@ -365,7 +548,7 @@ func TestFileChangedOnS3(t *testing.T) {
 			nil,
 		).Once()
 
-		changed, err := fileChangedOnS3(mockClient, "test.txt", filePath)
+		changed, err := newTestSyncer(t, mockClient).fileChangedOnS3("test.txt", filePath)
 		assert.NoError(t, err)
 		assert.True(t, changed)
 		mockClient.AssertExpectations(t)
@@ -388,27 +571,17 @@ func TestFileChangedOnS3(t *testing.T) {
 			awsErr,
 		).Once()
 
-		_, err := fileChangedOnS3(mockClient, "test.txt", filePath)
+		_, err := newTestSyncer(t, mockClient).fileChangedOnS3("test.txt", filePath)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "error checking S3 object")
 		mockClient.AssertExpectations(t)
 	})
 }
 
-// Test Suite: deleteRemovedFilesFromS3
-func TestDeleteRemovedFilesFromS3(t *testing.T) {
-	// Save original state
-	originalBucket := bucketName
-	defer func() {
-		bucketName = originalBucket
-	}()
-
-	bucketName = "test-bucket"
-
+// Test Suite: deleter
+func TestDeleterRun(t *testing.T) {
 	t.Run("delete files not in local directory", func(t *testing.T) {
 		mockClient := new(mockS3Client)
-		tempDir := t.TempDir()
-		createTempFile(t, tempDir, "keep.txt", "keep me")
 
 		s3Objects := []*s3.Object{
 			{Key: aws.String("keep.txt")},
@@ -431,16 +604,13 @@ func TestDeleteRemovedFilesFromS3(t *testing.T) {
 			Key:    aws.String("old.txt"),
 		}).Return(&s3.DeleteObjectOutput{}, nil).Once()
 
-		err := deleteRemovedFilesFromS3(mockClient, tempDir)
+		err := (&deleter{syncer: newTestSyncer(t, mockClient), workers: deleteWorkers}).run(keysOf("keep.txt"))
 		assert.NoError(t, err)
 		mockClient.AssertExpectations(t)
 	})
 
 	t.Run("no deletions when all files exist locally", func(t *testing.T) {
 		mockClient := new(mockS3Client)
-		tempDir := t.TempDir()
-		createTempFile(t, tempDir, "file1.txt", "content1")
-		createTempFile(t, tempDir, "file2.txt", "content2")
 
 		s3Objects := []*s3.Object{
 			{Key: aws.String("file1.txt")},
@@ -452,46 +622,73 @@ func TestDeleteRemovedFilesFromS3(t *testing.T) {
 			nil,
 		).Once()
 
-		err := deleteRemovedFilesFromS3(mockClient, tempDir)
+		err := (&deleter{syncer: newTestSyncer(t, mockClient), workers: deleteWorkers}).run(keysOf("file1.txt", "file2.txt"))
 		assert.NoError(t, err)
 		mockClient.AssertExpectations(t)
 	})
 
 	t.Run("handle empty S3 bucket", func(t *testing.T) {
 		mockClient := new(mockS3Client)
-		tempDir := t.TempDir()
-		createTempFile(t, tempDir, "file.txt", "content")
 
 		mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(
 			&s3.ListObjectsV2Output{Contents: []*s3.Object{}},
 			nil,
 		).Once()
 
-		err := deleteRemovedFilesFromS3(mockClient, tempDir)
+		err := (&deleter{syncer: newTestSyncer(t, mockClient), workers: deleteWorkers}).run(keysOf("file.txt"))
 		assert.NoError(t, err)
 		mockClient.AssertExpectations(t)
 	})
 
 	t.Run("handle ListObjects error", func(t *testing.T) {
 		mockClient := new(mockS3Client)
-		tempDir := t.TempDir()
 
 		mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(
 			nil,
 			fmt.Errorf("access denied"),
 		).Once()
 
-		err := deleteRemovedFilesFromS3(mockClient, tempDir)
+		err := (&deleter{syncer: newTestSyncer(t, mockClient), workers: deleteWorkers}).run(keysOf())
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "failed to delete files from S3")
 		mockClient.AssertExpectations(t)
 	})
 
+	t.Run("keep reserved bookkeeping objects", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+
+		mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(
+			&s3.ListObjectsV2Output{Contents: []*s3.Object{{Key: aws.String(reservedPrefix + "doctor-probe")}}},
+			nil,
+		).Once()
+
+		err := (&deleter{syncer: newTestSyncer(t, mockClient), workers: deleteWorkers}).run(keysOf())
+		assert.NoError(t, err)
+		mockClient.AssertNotCalled(t, "DeleteObject", mock.Anything)
+	})
+
+	t.Run("keep ignored and kept objects", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+
+		mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(
+			&s3.ListObjectsV2Output{Contents: []*s3.Object{
+				{Key: aws.String("disk.iso")},
+				{Key: aws.String("archive/2023.zip")},
+				{Key: aws.String(reportsPrefix + "run.json")},
+			}},
+			nil,
+		).Once()
+
+		s := newTestSyncer(t, mockClient)
+		s.ignorePatterns = []string{"*.iso"}
+		s.keepRemote = []Rule{{Pattern: "archive/**", SkipDelete: true}}
+		err := (&deleter{syncer: s, workers: deleteWorkers}).run(keysOf())
+		assert.NoError(t, err)
+		mockClient.AssertNotCalled(t, "DeleteObject", mock.Anything)
+	})
+
 	t.Run("handle nested directories", func(t *testing.T) {
 		mockClient := new(mockS3Client)
-		tempDir := t.TempDir()
-		createTempFile(t, tempDir, "dir1/file1.txt", "content1")
-		createTempFile(t, tempDir, "dir2/subdir/file2.txt", "content2")
 
 		s3Objects := []*s3.Object{
 			{Key: aws.String("dir1/file1.txt")},
@@ -509,7 +706,7 @@ func TestDeleteRemovedFilesFromS3(t *testing.T) {
 			Key:    aws.String("dir3/old.txt"),
 		}).Return(&s3.DeleteObjectOutput{}, nil).Once()
 
-		err := deleteRemovedFilesFromS3(mockClient, tempDir)
+		err := (&deleter{syncer: newTestSyncer(t, mockClient), workers: deleteWorkers}).run(keysOf("dir1/file1.txt", "dir2/subdir/file2.txt"))
 		assert.NoError(t, err)
 		mockClient.AssertExpectations(t)
 	})
@@ -517,14 +714,6 @@ func TestDeleteRemovedFilesFromS3(t *testing.T) {
 
 // Test Suite: uploadFileS3
 func TestUploadFileS3(t *testing.T) {
-	// Save original state
-	originalBucket := bucketName
-	defer func() {
-		bucketName = originalBucket
-	}()
-
-	bucketName = "test-bucket"
-
 	t.Run("upload small file", func(t *testing.T) {
 		mockClient := new(mockS3Client)
 		tempDir := t.TempDir()
@@ -535,7 +724,7 @@ func TestUploadFileS3(t *testing.T) {
 			return *input.Bucket == "test-bucket" && *input.Key == "small.txt"
 		})).Return(&s3.PutObjectOutput{}, nil).Once()
 
-		size, err := uploadFileS3(mockClient, nil, "small.txt", filePath, int64(len(content)))
+		size, err := newTestSyncer(t, mockClient).uploadFileS3("small.txt", filePath, int64(len(content)))
 		assert.NoError(t, err)
 		assert.Equal(t, int64(len(content)), size)
 		mockClient.AssertExpectations(t)
@@ -543,7 +732,7 @@ func TestUploadFileS3(t *testing.T) {
 
 	t.Run("error on non-existent file", func(t *testing.T) {
 		mockClient := new(mockS3Client)
-		_, err := uploadFileS3(mockClient, nil, "test.txt", "/non/existent.txt", 100)
+		_, err := newTestSyncer(t, mockClient).uploadFileS3("test.txt", "/non/existent.txt", 100)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "failed to open file")
 	})
@@ -559,7 +748,7 @@ func TestUploadFileS3(t *testing.T) {
 			fmt.Errorf("upload failed"),
 		).Once()
 
-		_, err := uploadFileS3(mockClient, nil, "test.txt", filePath, int64(len(content)))
+		_, err := newTestSyncer(t, mockClient).uploadFileS3("test.txt", filePath, int64(len(content)))
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "failed to upload file to S3")
 		mockClient.AssertExpectations(t)
@@ -568,17 +757,10 @@ func TestUploadFileS3(t *testing.T) {
 
 // Test Suite: Integration Tests
 func TestIntegration(t *testing.T) {
-	// Save original state
-	originalRootDir := rootDir
-	originalPatterns := ignorePatterns
-	defer func() {
-		rootDir = originalRootDir
-		ignorePatterns = originalPatterns
-	}()
-
 	t.Run("full sync workflow", func(t *testing.T) {
 		tempDir := t.TempDir()
-		rootDir = tempDir
+		s := newTestSyncer(t, nil)
+		s.cfg.RootDir = tempDir
 
 		// Create test structure
 		createTempFile(t, tempDir, "file1.txt", "content1")
@@ -586,8 +768,7 @@ func TestIntegration(t *testing.T) {
 		createTempFile(t, tempDir, ".syncignore", "*.log\ntemp/")
 
 		// Load ignore patterns
-		ignorePatterns = nil
-		err := loadSyncIgnoreFile()
+		err := s.loadSyncIgnoreFile()
 		assert.NoError(t, err)
 
 		// Create ignored files
@@ -595,10 +776,10 @@ func TestIntegration(t *testing.T) {
 		createTempFile(t, tempDir, "temp/cache.txt", "should be ignored")
 
 		// Verify ignore patterns work
-		assert.True(t, shouldIgnore("*.log"))
-		assert.True(t, shouldIgnore("temp/"))
-		assert.False(t, shouldIgnore("file1.txt"))
-		assert.False(t, shouldIgnore("subdir/file2.txt"))
+		assert.True(t, s.shouldIgnore("*.log"))
+		assert.True(t, s.shouldIgnore("temp/"))
+		assert.False(t, s.shouldIgnore("file1.txt"))
+		assert.False(t, s.shouldIgnore("subdir/file2.txt"))
 	})
 
 	t.Run("concurrent file operations", func(t *testing.T) {
@@ -656,19 +837,21 @@ func BenchmarkCalculateMD5Large(b *testing.B) {
 }
 
 func BenchmarkShouldIgnore(b *testing.B) {
-	ignorePatterns = []string{"*.log", "temp/", ".git/", "node_modules/", "build/"}
+	s := newTestSyncer(b, nil)
+	s.ignorePatterns = []string{"*.log", "temp/", ".git/", "node_modules/", "build/"}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		shouldIgnore("src/main.go")
+		s.shouldIgnore("src/main.go")
 	}
 }
 
 func BenchmarkShouldIgnoreMatch(b *testing.B) {
-	ignorePatterns = []string{"*.log", "temp/", ".git/", "node_modules/", "build/"}
+	s := newTestSyncer(b, nil)
+	s.ignorePatterns = []string{"*.log", "temp/", ".git/", "node_modules/", "build/"}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		shouldIgnore("*.log")
+		s.shouldIgnore("*.log")
 	}
 }
@@ -0,0 +1,987 @@
+// Package sync mirrors a local directory into an S3 bucket. It holds the
+// engine behind the gui-sync command so other Go programs can embed it:
+//
+//	s, err := sync.New(sync.Config{Bucket: "backups", Region: "us-east-1", RootDir: "/data", Schedule: "*/5 * * * *"})
+//	if err != nil {
+//		return err
+//	}
+//	return s.Watch(ctx)
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/robfig/cron/v3"
+)
+
+// reservedPrefix holds objects gui-sync writes for its own bookkeeping. Keys
+// under it are never treated as removed local files.
+const reservedPrefix = "_gui-sync/"
+
+const (
+	multipartThreshold = 100 * 1024 * 1024
+	partSize           = 50 * 1024 * 1024
+	uploadWorkers      = 5
+	deleteWorkers      = 10
+	partConcurrency    = 3
+
+	// deferRecheckInterval is how often a deferred run re-checks the power
+	// and network conditions.
+	deferRecheckInterval = time.Minute
+)
+
+// Config describes one sync target. Only Bucket is always required; Region
+// is needed unless Client is set, and RootDir and Schedule only matter to
+// Run and Watch.
+type Config struct {
+	Bucket   string
+	Region   string
+	RootDir  string
+	Schedule string // cron expression used by Watch
+
+	// Credentials selects the AWS profile or role; unused with Client.
+	Credentials Credentials
+
+	// Ignore lists extra file names or relative paths to skip, on top of
+	// RootDir/.syncignore and the patterns read from ExcludeFrom.
+	Ignore      []string
+	ExcludeFrom string
+	// GitIgnore also skips the files excluded by the .gitignore files of
+	// the tree, nested ones included.
+	GitIgnore bool
+	// ScanCache, when positive, lets files in directories unchanged since
+	// the last run skip the comparison with S3 for up to this long after
+	// they were last compared.
+	ScanCache time.Duration
+	// ExcludePresets names built-in exclusion lists (see PresetNames),
+	// such as "os" for .DS_Store, Thumbs.db and desktop.ini.
+	ExcludePresets []string
+	// RulesFile is a JSON file of per-pattern upload rules (storage class,
+	// encryption, cache control, metadata, skip-delete, priority); see Rule.
+	RulesFile string
+	// KeepRemote lists patterns, in the syntax of Rule.Pattern, of objects
+	// never deleted from the bucket when their local file is missing, such
+	// as those uploaded by hand next to the synced files. Unlike Ignore,
+	// matching files present locally are still uploaded.
+	KeepRemote []string
+	// LowPriorityBandwidth, when positive, caps the uploads of the files
+	// whose rules set PriorityLow to this many bytes per second, shared
+	// between them.
+	LowPriorityBandwidth int64
+	// MemoryLimit, when positive, bounds the bytes held in part buffers by
+	// the streamed uploads of Put, together; see ParseMemoryLimit. Uploads
+	// of files read their parts from disk and need no buffers.
+	MemoryLimit int64
+	// FilesFrom, when set, limits runs to the files listed in it and
+	// disables the deletion of removed files.
+	FilesFrom string
+	// HeadWorkers is how many files are compared with their objects at
+	// once; below 1, one at a time.
+	HeadWorkers int
+	// Journal reads the paths changed since the last run from the change
+	// journal of the operating system instead of walking RootDir.
+	Journal bool
+	// OneFileSystem keeps walks of RootDir on its file system: directories
+	// where other file systems are mounted are skipped, and their objects
+	// kept.
+	OneFileSystem bool
+	// SanitizeKeys percent-encodes the control characters, invalid UTF-8
+	// and % of file names in their keys, instead of skipping the files
+	// whose names cannot be keys. Restore decodes them back.
+	SanitizeKeys bool
+	// KeyTemplate, such as "{{hostname}}/{{date}}/{{relpath}}", places the
+	// keys below a prefix rendered at the start of each run; see
+	// ValidateKeyTemplate.
+	KeyTemplate string
+	// KeyDate, when set, is the day {{date}} of KeyTemplate renders to,
+	// instead of the start of each run, for reading the objects an earlier
+	// day placed.
+	KeyDate time.Time
+	// ArchiveDirs names top-level directories of RootDir (path.Match
+	// patterns such as node_modules) uploaded as one tar.gz archive each,
+	// with an index object, instead of one object per file.
+	ArchiveDirs []string
+	// QueueOverlapping makes a scheduled run that comes while another is
+	// still in progress start once it finishes, instead of being skipped.
+	// Several such runs are merged into one.
+	QueueOverlapping bool
+	// DownloadPartSize and DownloadConcurrency set how restore downloads
+	// objects larger than a part: in parts of this many bytes (16 MB by
+	// default), this many at a time (5 by default).
+	DownloadPartSize    int64
+	DownloadConcurrency int
+	// GlacierTier is the retrieval tier (s3.TierStandard, the default,
+	// s3.TierBulk or s3.TierExpedited) with which restore thaws objects in
+	// GLACIER and DEEP_ARCHIVE, and GlacierDays how long their restored
+	// copies stay readable (1 by default).
+	GlacierTier string
+	GlacierDays int
+
+	// Fast compares files by size and modification time only, never
+	// reading their contents to hash them.
+	Fast bool
+	// Delta makes uploads in parts copy the parts whose contents did not
+	// change from the current object on S3 instead of sending them again.
+	Delta bool
+	// Dedup uploads the contents shared by several files once, creating
+	// the other objects as copies inside the bucket, of objects uploaded
+	// during the run or kept in the object index by earlier runs.
+	Dedup bool
+	// DetectMoves creates the objects of files moved or renamed locally as
+	// copies of their old objects within S3, found in an index of the
+	// contents synced by earlier runs.
+	DetectMoves bool
+	// HardLinks uploads the contents of files hard-linked to each other
+	// once; the other links are stored as references restore links again.
+	HardLinks bool
+	// Xattrs stores the extended attributes and ACLs of each file with its
+	// object, for restore to apply back.
+	Xattrs bool
+	// VerifyUploads checks every upload against the ETag or checksum S3
+	// computed for it, deleting and retrying the ones corrupted in transit.
+	VerifyUploads bool
+	// HashAlgorithm is HashMD5 (the default), HashSHA256 or HashXXHash64,
+	// used to hash files for change detection. HashSHA256 also makes
+	// uploads send S3's native SHA-256 checksum.
+	HashAlgorithm string
+	// ObjectLockMode (s3.ObjectLockModeGovernance or
+	// s3.ObjectLockModeCompliance) and ObjectLockDays lock every uploaded
+	// version for this many days, on buckets created with Object Lock.
+	// Sidecars and rules may override them per file.
+	ObjectLockMode string
+	ObjectLockDays int
+	// MassChangePercent alerts, in the log and through Notifiers, when a
+	// run uploads again or removes more than this percentage of the files
+	// of the last successful run; zero disables it. MassChangePause also
+	// pauses the run until Resume confirms the changes.
+	MassChangePercent int
+	MassChangePause   bool
+	// Delete says when the objects of removed files are deleted.
+	Delete DeletePolicy
+	// MaxFiles and MaxTotalSize, when positive, stop a run from queuing
+	// more uploads once they would exceed this many files or bytes. The
+	// rest of the tree is not scanned and removed files are not deleted in
+	// that run.
+	MaxFiles     int
+	MaxTotalSize int64
+
+	// Heartbeat writes _gui-sync/heartbeat.json after every successful run,
+	// and keeps the progress of every run in a status object of the machine,
+	// rewritten every HeartbeatInterval (a minute by default) while it goes
+	// on.
+	Heartbeat         bool
+	HeartbeatInterval time.Duration
+	// Manifest writes the list of every object of the bucket, with its
+	// version, to _gui-sync/manifests/ after every successful run.
+	Manifest bool
+	// MetricsNamespace, when set, publishes the statistics of every run to
+	// CloudWatch under this namespace; MetricsClient overrides the client
+	// built from Region.
+	MetricsNamespace string
+	MetricsClient    cloudwatchiface.CloudWatchAPI
+	// AbortStaleAfter aborts incomplete multipart uploads older than this
+	// after every run; zero disables it.
+	AbortStaleAfter time.Duration
+
+	// StateDir is where checkpoints and cached bucket settings are kept.
+	// Empty means the per-user config directory.
+	StateDir string
+
+	// Client overrides the S3 client built from Region.
+	Client s3iface.S3API
+	// Replicas are further buckets the tree is uploaded to, one after the
+	// other after Bucket, or all at once with ParallelReplicas. Hooks,
+	// notifications, healthchecks, metrics and reports cover them as part
+	// of the run.
+	Replicas         []Replica
+	ParallelReplicas bool
+
+	// Retry sets how the S3 requests of the client built from Region are
+	// retried, and Timeouts how long each attempt may take.
+	Retry    RetryPolicy
+	Timeouts Timeouts
+	// Accelerate sends S3 requests through Transfer Acceleration, which
+	// must be enabled on the bucket; DualStack uses the S3 endpoints that
+	// also answer over IPv6.
+	Accelerate bool
+	DualStack  bool
+
+	// CreateBucket lets PrepareBucket create a missing bucket in Region,
+	// with public access blocked and default encryption.
+	CreateBucket bool
+
+	// Jitter delays every scheduled run by a random duration up to it, so
+	// machines sharing a schedule do not reach the bucket all at once.
+	Jitter time.Duration
+	// CatchUp makes Watch start a run as soon as it notices that a
+	// scheduled one was missed, as when the machine slept through it, and
+	// skip the run at startup unless one was missed since the last success.
+	CatchUp bool
+
+	// WarmUp, when positive, checks credentials, DNS and bucket access this
+	// long before every scheduled run, warning early when the run would fail.
+	WarmUp time.Duration
+
+	// PreHook and PostHook run before and after every run: a shell command,
+	// or an http(s) URL receiving a JSON POST. A failing PreHook cancels the
+	// run; PostHook always runs and gets the result and statistics.
+	PreHook  string
+	PostHook string
+	// Snapshot, when set, makes every run sync a snapshot of RootDir taken
+	// as it starts instead of the live tree, so files written meanwhile,
+	// such as databases, are captured consistently: SnapshotVSS for a
+	// Volume Shadow Copy on Windows, or a shell command that creates the
+	// snapshot (LVM, btrfs, ZFS...) and prints the directory where RootDir
+	// appears in it. SnapshotRelease is the shell command that removes it
+	// after the run, given that directory in GUI_SYNC_SNAPSHOT_DIR; shadow
+	// copies are always removed.
+	Snapshot        string
+	SnapshotRelease string
+
+	// ReportPath, when set, receives a report of every action taken by each
+	// run, in ReportFormat (json or csv); ReportToBucket also uploads it
+	// under .sync-reports/ in the bucket.
+	ReportPath     string
+	ReportFormat   string
+	ReportToBucket bool
+
+	// HealthcheckURL, when set, is pinged around every run for
+	// dead-man's-switch monitoring: /start when it begins, then the URL
+	// itself on success or /fail on failure (healthchecks.io style).
+	HealthcheckURL string
+
+	// Notifiers receive a summary after every run, or only after failures.
+	Notifiers []Notifier
+
+	// DeferOnBattery and DeferOnMetered hold scheduled runs while the
+	// machine runs on battery or uses a metered network; the deferred run
+	// starts as soon as the condition clears. PowerProbe overrides the
+	// platform detection.
+	DeferOnBattery bool
+	DeferOnMetered bool
+	PowerProbe     PowerProbe
+
+	// Windows, when set, limit scheduled runs to the periods they cover,
+	// and no scheduled run starts during Blackouts; a run falling outside
+	// them is deferred until they allow it. With PauseOutsideWindows, a run
+	// in progress also pauses when they stop allowing runs.
+	Windows             []Window
+	Blackouts           []Window
+	PauseOutsideWindows bool
+
+	// Faults, when set, injects failures into every S3 call (test mode).
+	Faults *Faults
+}
+
+// Syncer runs sync operations for one Config. Its methods are safe to call
+// from multiple goroutines, but runs of the same Syncer should not overlap.
+type Syncer struct {
+	cfg    Config
+	client s3iface.S3API
+	// sess is the session client was built from; nil with Config.Client.
+	sess *session.Session
+	// metrics is nil unless Config.MetricsNamespace is set.
+	metrics cloudwatchiface.CloudWatchAPI
+
+	stateDir string
+	// keyPrefix is Config.KeyTemplate rendered for the run in progress, or
+	// when New was called between runs.
+	keyPrefix      string
+	ignorePatterns []string
+	presetPatterns []string
+	// scan is the scan cache of the run in progress, with Config.ScanCache.
+	scan *scanState
+	// gitignore is set at the start of every run with Config.GitIgnore.
+	gitignore         *gitignoreMatcher
+	rules             []Rule
+	keepRemote        []Rule
+	checksumAlgorithm string
+	// replicas upload the tree to Config.Replicas; primary is the Syncer a
+	// replica belongs to.
+	replicas []*Syncer
+	primary  *Syncer
+	// snapshotRoot is the snapshot of Config.Snapshot walked by the run in
+	// progress, which its replicas walk too.
+	snapshotRoot string
+	// lowPriority paces the uploads of PriorityLow files; nil without
+	// Config.LowPriorityBandwidth.
+	lowPriority *bandwidthLimiter
+	// buffers holds the parts of streamed uploads, within
+	// Config.MemoryLimit; replicas share the one of their primary.
+	buffers *bufferPool
+
+	// stats tracks the run in progress; syncDirectoryWithS3 resets it at
+	// the start of every run.
+	stats *runStats
+	// contents indexes the contents known to be in the bucket during a
+	// run, for Config.Dedup.
+	contents contentIndex
+	// objects is the object index of the run in progress, for
+	// Config.DetectMoves and Config.Dedup.
+	objects *objectIndex
+	// digests keeps the digests of the files hashed during a run for their
+	// uploads.
+	digests digestCache
+	// heads shares the HeadObject results of a run between the differ
+	// workers and the uploads.
+	heads headCache
+	// report is nil unless Config asks for run reports.
+	report *runReport
+	// massChanges watches the run in progress for Config.MassChangePercent.
+	massChanges *massChangeDetector
+	// quota limits the uploads of the run in progress to Config.MaxFiles
+	// and Config.MaxTotalSize.
+	quota *uploadQuota
+	// initial is the progress log of the run in progress until a run over
+	// RootDir succeeds.
+	initial *initialProgress
+	// journal follows the changes of RootDir with Config.Journal; it is
+	// opened at the first run, journalOpened set once it was tried.
+	journal       changeJournal
+	journalOpened bool
+	// journalPrefix is the key prefix of the last run the journal was
+	// committed after.
+	journalPrefix string
+	// incremental is set while a run visits the paths of the journal
+	// only.
+	incremental bool
+
+	// runMu serializes scheduled, manual and initial runs under Watch.
+	runMu   sync.Mutex
+	trigger chan struct{}
+
+	mu      sync.Mutex
+	running bool
+	paused  bool
+	// queued is set when a run was requested while another was in
+	// progress and Config.QueueOverlapping asks to run it afterwards.
+	queued bool
+	// resumed is closed to wake the transfers waiting in waitWhilePaused.
+	resumed chan struct{}
+	// manual is set while Watch serves SyncNow, whose run ignores Pause.
+	manual bool
+	// windowClosed is set while Config.PauseOutsideWindows holds the run
+	// in progress.
+	windowClosed bool
+	// stopping is set once Watch's context is done.
+	stopping bool
+	deferred string
+	// massChange describes the mass change detected in the current or last
+	// run, if any.
+	massChange string
+	warmUpErr  error
+	lastStart  time.Time
+	lastEnd    time.Time
+	lastErr    error
+	// lastSummary holds the statistics of the last finished run.
+	lastSummary *RunSummary
+	nextRun     func() time.Time
+}
+
+// New validates cfg and prepares a Syncer: it connects to S3, loads the
+// ignore patterns of RootDir and applies the bucket settings cached by
+// `gui-sync doctor`.
+func New(cfg Config) (*Syncer, error) {
+	if cfg.Bucket == "" {
+		return nil, i18n.Errorf("syncer.empty_bucket")
+	}
+
+	s := &Syncer{
+		cfg:            cfg,
+		client:         cfg.Client,
+		stateDir:       cfg.StateDir,
+		ignorePatterns: append([]string(nil), cfg.Ignore...),
+		stats:          &runStats{},
+		trigger:        make(chan struct{}, 1),
+		lowPriority:    newBandwidthLimiter(cfg.LowPriorityBandwidth),
+		buffers:        newBufferPool(cfg.MemoryLimit),
+	}
+
+	if err := cfg.Retry.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Timeouts.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Accelerate && strings.Contains(cfg.Bucket, ".") {
+		return nil, i18n.Errorf("syncer.accelerate_bucket", cfg.Bucket)
+	}
+
+	if s.client == nil {
+		if cfg.Region == "" {
+			return nil, i18n.Errorf("syncer.empty_region")
+		}
+		sess, err := NewSession(cfg.Region, cfg.Credentials, cfg.Retry, cfg.Timeouts)
+		if err != nil {
+			return nil, i18n.Errorf("s3.session", err)
+		}
+		s.sess = sess
+		s.client = s3.New(sess, cfg.s3Config())
+	}
+
+	if cfg.MetricsNamespace != "" {
+		s.metrics = cfg.MetricsClient
+		if s.metrics == nil {
+			sess := s.sess
+			if sess == nil {
+				if cfg.Region == "" {
+					return nil, i18n.Errorf("syncer.empty_region")
+				}
+				var err error
+				if sess, err = NewSession(cfg.Region, cfg.Credentials, cfg.Retry, cfg.Timeouts); err != nil {
+					return nil, i18n.Errorf("s3.session", err)
+				}
+			}
+			s.metrics = cloudwatch.New(sess)
+		}
+	}
+
+	if cfg.HashAlgorithm != "" && hashMetaKey(cfg.HashAlgorithm) == "" {
+		return nil, i18n.Errorf("syncer.invalid_hash", cfg.HashAlgorithm)
+	}
+
+	if err := validateObjectLock(cfg.ObjectLockMode, cfg.ObjectLockDays); err != nil {
+		return nil, err
+	}
+	if err := validateMassChange(cfg.MassChangePercent); err != nil {
+		return nil, err
+	}
+	if err := validateQuota(cfg.MaxFiles, cfg.MaxTotalSize); err != nil {
+		return nil, err
+	}
+	if err := ValidateKeyTemplate(cfg.KeyTemplate); err != nil {
+		return nil, err
+	}
+	if err := s.updateKeyPrefix(time.Now()); err != nil {
+		return nil, err
+	}
+
+	if cfg.ReportFormat != "" && cfg.ReportFormat != "json" && cfg.ReportFormat != "csv" {
+		return nil, i18n.Errorf("syncer.invalid_report_format", cfg.ReportFormat)
+	}
+	if cfg.Snapshot == SnapshotVSS && runtime.GOOS != "windows" {
+		return nil, i18n.Errorf("snapshot.vss_unsupported")
+	}
+	if cfg.HealthcheckURL != "" {
+		if err := validateHealthcheckURL(cfg.HealthcheckURL); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.ReportPath != "" || cfg.ReportToBucket {
+		s.report = &runReport{}
+	}
+
+	if cfg.Faults != nil {
+		s.client = newFaultyClient(s.client, *cfg.Faults)
+		log.Printf(i18n.T("syncer.faults_active"), *cfg.Faults)
+	}
+
+	if s.stateDir == "" {
+		base, err := os.UserConfigDir()
+		if err != nil {
+			base = os.TempDir()
+		}
+		s.stateDir = filepath.Join(base, "gui-sync")
+	}
+
+	if cfg.RootDir != "" {
+		if err := s.loadSyncIgnoreFile(); err != nil {
+			return nil, i18n.Errorf("syncer.syncignore", err)
+		}
+	}
+
+	if cfg.ExcludeFrom != "" {
+		patterns, err := readPatternFile(cfg.ExcludeFrom)
+		if err != nil {
+			return nil, i18n.Errorf("syncer.exclude_from", err)
+		}
+		s.ignorePatterns = append(s.ignorePatterns, patterns...)
+		fmt.Printf(i18n.T("syncer.exclude_from_loaded"), cfg.ExcludeFrom, len(patterns))
+	}
+
+	if len(cfg.ExcludePresets) > 0 {
+		patterns, err := presetPatterns(cfg.ExcludePresets)
+		if err != nil {
+			return nil, err
+		}
+		s.presetPatterns = patterns
+		fmt.Printf(i18n.T("syncer.presets"), strings.Join(cfg.ExcludePresets, ", "))
+	}
+
+	if cfg.RulesFile != "" {
+		rules, err := readRulesFile(cfg.RulesFile)
+		if err != nil {
+			return nil, i18n.Errorf("syncer.rules", err)
+		}
+		s.rules = rules
+		fmt.Printf(i18n.T("syncer.rules_loaded"), cfg.RulesFile, len(rules))
+	}
+
+	for _, pattern := range cfg.KeepRemote {
+		rule := Rule{Pattern: pattern, SkipDelete: true}
+		if err := rule.validate(); err != nil {
+			return nil, i18n.Errorf("syncer.keep_remote", err)
+		}
+		s.keepRemote = append(s.keepRemote, rule)
+	}
+	if len(s.keepRemote) > 0 {
+		fmt.Printf(i18n.T("syncer.keep_remote_loaded"), strings.Join(cfg.KeepRemote, ", "))
+	}
+
+	if err := s.loadBucketSettings(); err != nil {
+		var formatErr *FormatError
+		if errors.As(err, &formatErr) {
+			return nil, err
+		}
+		log.Printf("⚠ %v", err)
+	}
+	if s.checksumAlgorithm == "" && cfg.HashAlgorithm == HashSHA256 {
+		s.checksumAlgorithm = s3.ChecksumAlgorithmSha256
+	}
+
+	if err := s.newReplicas(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Bucket returns the bucket the Syncer writes to.
+func (s *Syncer) Bucket() string {
+	return s.cfg.Bucket
+}
+
+// Run performs one sync run of RootDir, keeps its progress in the bucket
+// with Config.Heartbeat, records the heartbeat and the manifest when it
+// succeeded and then runs the maintenance tasks, which run even when the
+// sync itself failed. Replicas are synced after it, or alongside it with
+// Config.ParallelReplicas, and their failures fail the run. It refuses to
+// run when the bucket was last written by a newer, incompatible gui-sync.
+// The hooks of Config wrap the whole run, and the healthcheck, notifiers
+// and CloudWatch metrics are told its outcome.
+func (s *Syncer) Run(ctx context.Context) (err error) {
+	if s.cfg.RootDir == "" {
+		return i18n.Errorf("syncer.empty_dir")
+	}
+
+	started := time.Now()
+	s.runStarted()
+	s.stats.reset()
+	s.report.reset()
+	stopProgress := s.reportProgress()
+	s.pingHealthcheck(ctx, pingStart, "")
+	defer func() {
+		stopProgress()
+		s.runPostHook(ctx, err)
+		s.pingHealthcheckResult(ctx, err)
+		s.sendNotifications(ctx, err)
+		s.publishMetrics(ctx, err)
+	}()
+
+	if err := s.runHook(ctx, s.cfg.PreHook, hookEvent{Hook: hookPre}); err != nil {
+		err = i18n.Errorf("syncer.pre_hook", err)
+		s.runFinished(err)
+		return err
+	}
+
+	if err := s.checkCredentials(ctx); err != nil {
+		s.runFinished(err)
+		return err
+	}
+
+	if err := s.checkRemoteFormat(); err != nil {
+		s.runFinished(err)
+		return err
+	}
+
+	if err := s.checkObjectLock(); err != nil {
+		s.runFinished(err)
+		return err
+	}
+
+	root, releaseSnapshot, err := s.takeSnapshot(ctx)
+	if err != nil {
+		s.runFinished(err)
+		return err
+	}
+	defer releaseSnapshot()
+
+	waitReplicas := s.syncReplicas(ctx)
+	result, err := s.syncDirectoryWithS3(ctx, root)
+	if err == nil {
+		err = result.Err()
+	}
+	err = errors.Join(s.explainCredentialError(err), waitReplicas())
+	s.runFinished(err)
+	fmt.Printf(i18n.T("syncer.summary"), s.Status().Summary)
+	if repErr := s.writeReport(started, err); repErr != nil {
+		log.Printf(i18n.T("syncer.report_failed"), repErr)
+	}
+	if err == nil {
+		s.recordSuccess(time.Now())
+	}
+	if err == nil && s.cfg.Heartbeat {
+		if hbErr := s.writeHeartbeat(s.stats.summary()); hbErr != nil {
+			log.Printf(i18n.T("syncer.heartbeat_failed"), hbErr)
+		}
+	}
+	if err == nil && s.cfg.Manifest {
+		if m, mErr := s.writeManifest(); mErr != nil {
+			log.Printf(i18n.T("syncer.manifest_failed"), mErr)
+		} else {
+			fmt.Printf(i18n.T("manifest.written"), m.ID, len(m.Objects))
+		}
+	}
+	s.runMaintenance()
+	return err
+}
+
+// Watch runs immediately and then on every tick of Schedule until ctx is
+// cancelled, plus whenever SyncNow is called; Config.Jitter and
+// Config.CatchUp adjust when scheduled runs start. Failed runs are logged
+// and do not stop the schedule; ticks are skipped while the Syncer is
+// paused or a run is still in progress (or queued, with
+// Config.QueueOverlapping), and deferred while the power or network
+// conditions or the windows of Config do not allow them.
+func (s *Syncer) Watch(ctx context.Context) error {
+	defer context.AfterFunc(ctx, s.stopWaiting)()
+
+	c := cron.New()
+	entryID, err := c.AddFunc(s.cfg.Schedule, func() {
+		if s.cfg.Jitter > 0 {
+			select {
+			case <-time.After(rand.N(s.cfg.Jitter)):
+			case <-ctx.Done():
+				return
+			}
+		}
+		if s.Paused() {
+			fmt.Printf(i18n.T("syncer.paused_skip"), time.Now().Format("15:04:05"))
+			return
+		}
+		if s.deferRun() {
+			return
+		}
+		s.scheduledRun(ctx)
+	})
+	if err != nil {
+		return i18n.Errorf("syncer.invalid_schedule", err)
+	}
+
+	schedule := c.Entry(entryID).Schedule
+	if s.cfg.CatchUp && !s.missedRun(schedule, time.Now()) {
+		fmt.Printf(i18n.T("catchup.first_skipped"), s.lastSuccess().Local().Format("2006-01-02 15:04:05"))
+	} else if !s.deferRun() {
+		fmt.Println(i18n.T("syncer.first_run"))
+		if err := s.Run(ctx); err != nil {
+			log.Printf(i18n.T("syncer.failed"), err)
+		} else {
+			fmt.Println(i18n.T("syncer.first_done"))
+		}
+	}
+
+	s.mu.Lock()
+	s.nextRun = func() time.Time { return c.Entry(entryID).Next }
+	s.mu.Unlock()
+
+	fmt.Printf(i18n.T("syncer.scheduler"), s.cfg.Schedule)
+	c.Start()
+
+	recheck := time.NewTicker(deferRecheckInterval)
+	defer recheck.Stop()
+
+	// warmUp fires s.cfg.WarmUp before warmUpRun, the next scheduled run.
+	var warmUp *time.Timer
+	var warmUpC <-chan time.Time
+	var warmUpRun time.Time
+	if s.cfg.WarmUp > 0 {
+		var at time.Time
+		at, warmUpRun = nextWarmUp(c.Entry(entryID), time.Time{}, s.cfg.WarmUp)
+		warmUp = time.NewTimer(time.Until(at))
+		defer warmUp.Stop()
+		warmUpC = warmUp.C
+	}
+
+	for {
+		select {
+		case <-s.trigger:
+			s.setManual(true)
+			s.scheduledRun(ctx)
+			s.setManual(false)
+		case <-recheck.C:
+			s.pauseOutsideWindows(time.Now())
+			status := s.Status()
+			switch {
+			case status.Deferred != "":
+				if !s.Paused() && s.deferReason() == "" {
+					fmt.Printf(i18n.T("syncer.deferred_run"), time.Now().Format("15:04:05"))
+					s.scheduledRun(ctx)
+				}
+			case s.cfg.CatchUp && !status.Running && !s.Paused():
+				// The grace leaves on-time runs to the cron entry.
+				if s.missedRun(schedule, time.Now().Add(-deferRecheckInterval)) && !s.deferRun() {
+					fmt.Printf(i18n.T("catchup.run"), time.Now().Format("15:04:05"))
+					s.scheduledRun(ctx)
+				}
+			}
+		case <-warmUpC:
+			if !s.Paused() {
+				s.runWarmUp(ctx, warmUpRun)
+			}
+			var at time.Time
+			at, warmUpRun = nextWarmUp(c.Entry(entryID), warmUpRun, s.cfg.WarmUp)
+			warmUp.Reset(time.Until(at))
+		case <-ctx.Done():
+			<-c.Stop().Done()
+			return ctx.Err()
+		}
+	}
+}
+
+// deferRun reports whether a scheduled run must wait for the power or
+// network conditions or for its windows, recording the reason for Status.
+func (s *Syncer) deferRun() bool {
+	reason := s.deferReason()
+	if reason == "" {
+		return false
+	}
+
+	s.mu.Lock()
+	s.deferred = reason
+	s.mu.Unlock()
+
+	fmt.Printf(i18n.T("syncer.deferred"), time.Now().Format("15:04:05"), reason)
+	return true
+}
+
+// scheduledRun performs a run started by Watch. When another one has not
+// finished yet the run is skipped or, with Config.QueueOverlapping, left
+// for the goroutine running it to start once it is done.
+func (s *Syncer) scheduledRun(ctx context.Context) {
+	// runMu is tried and released under mu, so a run queued here is never
+	// missed by the goroutine finishing the current one.
+	s.mu.Lock()
+	if !s.runMu.TryLock() {
+		if s.cfg.QueueOverlapping {
+			s.queued = true
+			s.mu.Unlock()
+			fmt.Printf(i18n.T("syncer.queued"), time.Now().Format("15:04:05"))
+			return
+		}
+		s.mu.Unlock()
+		fmt.Printf(i18n.T("syncer.overlap_skip"), time.Now().Format("15:04:05"))
+		return
+	}
+	s.mu.Unlock()
+
+	for {
+		fmt.Printf(i18n.T("syncer.syncing"), time.Now().Format("15:04:05"))
+		if err := s.Run(ctx); err != nil {
+			log.Printf(i18n.T("syncer.failed"), err)
+		} else {
+			fmt.Printf(i18n.T("syncer.done"), time.Now().Format("15:04:05"))
+		}
+
+		// A queued run is held while paused; Resume starts it.
+		s.mu.Lock()
+		queued := s.queued && ctx.Err() == nil && (!s.paused || s.manual)
+		if queued {
+			s.queued = false
+		} else {
+			s.runMu.Unlock()
+		}
+		s.mu.Unlock()
+		if !queued {
+			return
+		}
+		fmt.Printf(i18n.T("syncer.queued_run"), time.Now().Format("15:04:05"))
+	}
+}
+
+// SyncNow asks Watch to start a run right away, even while paused or
+// deferred. Requests made while one is already queued are merged into it.
+func (s *Syncer) SyncNow() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Pause stops Watch from starting scheduled runs until Resume is called.
+// A run already in progress finishes the uploads and part uploads it has
+// started and then waits; multipart uploads keep their checkpoints, so
+// nothing sent so far is lost even if the process is stopped meanwhile.
+func (s *Syncer) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.paused {
+		fmt.Printf(i18n.T("syncer.paused"), time.Now().Format("15:04:05"))
+	}
+	s.paused = true
+}
+
+// Resume undoes Pause, letting a waiting run continue and starting the run
+// queued meanwhile, if any.
+func (s *Syncer) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.paused {
+		return
+	}
+	fmt.Printf(i18n.T("syncer.resumed"), time.Now().Format("15:04:05"))
+	s.paused = false
+	s.wakeWaiting()
+	if s.queued {
+		s.queued = false
+		s.SyncNow()
+	}
+}
+
+func (s *Syncer) setManual(manual bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.manual = manual
+	s.wakeWaiting()
+}
+
+// stopWaiting makes waitWhilePaused give up, so a paused run does not keep
+// Watch from returning.
+func (s *Syncer) stopWaiting() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopping = true
+	s.wakeWaiting()
+}
+
+// wakeWaiting wakes the goroutines in waitWhilePaused so they check again.
+// It must be called with mu held.
+func (s *Syncer) wakeWaiting() {
+	if s.resumed != nil {
+		close(s.resumed)
+		s.resumed = nil
+	}
+}
+
+// waitWhilePaused blocks the transfers of a run while the Syncer, or the
+// one it is a replica of, is paused or outside its windows.
+// It returns false when Watch stops while paused and the transfer should be
+// abandoned.
+func (s *Syncer) waitWhilePaused() bool {
+	if s.primary != nil {
+		return s.primary.waitWhilePaused()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for (s.paused || s.windowClosed) && !s.manual {
+		if s.stopping {
+			return false
+		}
+		if s.resumed == nil {
+			s.resumed = make(chan struct{})
+		}
+		resumed := s.resumed
+		s.mu.Unlock()
+		<-resumed
+		s.mu.Lock()
+	}
+	return true
+}
+
+// Paused reports whether scheduled runs are paused.
+func (s *Syncer) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// Status is a snapshot of what a Syncer is doing, as reported by the
+// control API. Zero times mean the event has not happened yet.
+type Status struct {
+	Bucket         string
+	RootDir        string
+	Schedule       string
+	Running        bool
+	Paused         bool
+	Deferred       string // why the pending scheduled run waits, if it does
+	WarmUpError    error  // why the next run is expected to fail, if it is
+	MassChange     string // the mass change detected in the current or last run
+	LastRunStart   time.Time
+	LastRunEnd     time.Time
+	LastError      error
+	NextRun        time.Time
+	PendingUploads int64
+	BytesPerSecond float64
+	// Summary holds the statistics of the current run, or of the last one
+	// when none is running; it is nil before the first run.
+	Summary *RunSummary
+}
+
+// Status returns the state of the current or last run.
+func (s *Syncer) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := Status{
+		Bucket:       s.cfg.Bucket,
+		RootDir:      s.cfg.RootDir,
+		Schedule:     s.cfg.Schedule,
+		Running:      s.running,
+		Paused:       s.paused,
+		Deferred:     s.deferred,
+		WarmUpError:  s.warmUpErr,
+		MassChange:   s.massChange,
+		LastRunStart: s.lastStart,
+		LastRunEnd:   s.lastEnd,
+		LastError:    s.lastErr,
+	}
+	if s.nextRun != nil {
+		status.NextRun = s.nextRun()
+	}
+	if s.running {
+		status.PendingUploads = s.stats.pending.Load()
+		status.BytesPerSecond = s.stats.transferRate()
+		summary := s.stats.summary()
+		status.Summary = &summary
+	} else if s.lastSummary != nil {
+		summary := *s.lastSummary
+		status.Summary = &summary
+	}
+	return status
+}
+
+func (s *Syncer) runStarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = true
+	s.deferred = ""
+	s.warmUpErr = nil
+	s.massChange = ""
+	s.lastStart = time.Now()
+}
+
+func (s *Syncer) runFinished(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+	s.lastEnd = time.Now()
+	s.lastErr = err
+	summary := s.stats.summary()
+	s.lastSummary = &summary
+}
@@ -0,0 +1,263 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: library entry points
+func TestNew(t *testing.T) {
+	t.Run("bucket is required", func(t *testing.T) {
+		_, err := New(Config{Region: "us-east-1"})
+		assert.Error(t, err)
+	})
+
+	t.Run("region is required without a client", func(t *testing.T) {
+		_, err := New(Config{Bucket: "test-bucket"})
+		assert.Error(t, err)
+	})
+
+	t.Run("loads ignore patterns and bucket settings", func(t *testing.T) {
+		rootDir := t.TempDir()
+		stateDir := t.TempDir()
+		createTempFile(t, rootDir, ".syncignore", "*.log\n")
+		excludeFrom := createTempFile(t, t.TempDir(), "exclude.txt", "cache/\n")
+		require.NoError(t, writeStateFile((&Syncer{cfg: Config{Bucket: "test-bucket"}, stateDir: stateDir}).bucketSettingsPath(), &bucketSettings{ChecksumAlgorithm: "CRC32"}))
+
+		s, err := New(Config{
+			Bucket:      "test-bucket",
+			RootDir:     rootDir,
+			Ignore:      []string{"gui-sync"},
+			ExcludeFrom: excludeFrom,
+			StateDir:    stateDir,
+			Client:      new(mockS3Client),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"gui-sync", "*.log", "cache/"}, s.ignorePatterns)
+		assert.Equal(t, "CRC32", s.checksumAlgorithm)
+	})
+}
+
+func TestSyncerStatus(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.Schedule = "*/5 * * * *"
+	next := time.Now().Add(5 * time.Minute)
+	s.nextRun = func() time.Time { return next }
+
+	status := s.Status()
+	assert.Equal(t, "test-bucket", status.Bucket)
+	assert.True(t, status.LastRunEnd.IsZero())
+	assert.True(t, status.NextRun.Equal(next))
+	assert.Nil(t, status.Summary)
+
+	s.runStarted()
+	s.stats.reset()
+	s.stats.pending.Store(4)
+	s.stats.uploaded.Store(2)
+	status = s.Status()
+	assert.True(t, status.Running)
+	assert.Equal(t, int64(4), status.PendingUploads)
+	require.NotNil(t, status.Summary)
+	assert.Equal(t, int64(2), status.Summary.Uploaded)
+
+	s.runFinished(errors.New("access denied"))
+	status = s.Status()
+	assert.False(t, status.Running)
+	assert.EqualError(t, status.LastError, "access denied")
+	assert.Zero(t, status.PendingUploads)
+	require.NotNil(t, status.Summary)
+	assert.Equal(t, int64(2), status.Summary.Uploaded)
+
+	// The summary of a finished run no longer changes.
+	s.stats.uploaded.Store(5)
+	assert.Equal(t, int64(2), s.Status().Summary.Uploaded)
+}
+
+func TestRunSummary(t *testing.T) {
+	var stats runStats
+	stats.reset()
+	stats.started.Store(time.Now().Add(-10 * time.Second).UnixNano())
+	stats.scanned.Store(12)
+	stats.uploaded.Store(2)
+	stats.skipped.Store(10)
+	stats.bytesUploaded.Store(20 * 1024 * 1024)
+
+	summary := stats.summary()
+	assert.Equal(t, int64(12), summary.Scanned)
+	assert.InDelta(t, 2*1024*1024, summary.BytesPerSecond, 0.1*1024*1024)
+	assert.Equal(t, "12 checked · 2 uploaded (20.00 MB) · 10 in sync · 0 removed · 0 failed · 2.00 MB/s · 10s", summary.String())
+
+	summary.Deduplicated = 1
+	summary.Unreadable = 3
+	assert.Contains(t, summary.String(), "· 1 deduplicated · 3 unreadable ·")
+}
+
+func TestSyncerPauseAndSyncNow(t *testing.T) {
+	s := newTestSyncer(t, new(mockS3Client))
+
+	s.Pause()
+	assert.True(t, s.Paused())
+	assert.True(t, s.Status().Paused)
+	s.Resume()
+	assert.False(t, s.Paused())
+
+	s.SyncNow()
+	s.SyncNow()
+	assert.Len(t, s.trigger, 1, "pending requests are merged")
+}
+
+func TestDeferReason(t *testing.T) {
+	probe := func(state PowerState, err error) PowerProbe {
+		return func() (PowerState, error) { return state, err }
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.PowerProbe = probe(PowerState{OnBattery: true, Metered: true}, nil)
+		assert.Empty(t, s.deferReason())
+	})
+
+	t.Run("battery and metered network", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.DeferOnBattery = true
+		s.cfg.DeferOnMetered = true
+		s.cfg.PowerProbe = probe(PowerState{OnBattery: true, Metered: true}, nil)
+		assert.Equal(t, "on battery, metered network", s.deferReason())
+
+		s.cfg.PowerProbe = probe(PowerState{}, nil)
+		assert.Empty(t, s.deferReason())
+	})
+
+	t.Run("probe failures never block runs", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.DeferOnBattery = true
+		s.cfg.PowerProbe = probe(PowerState{OnBattery: true}, errors.New("sem acesso"))
+		assert.Empty(t, s.deferReason())
+	})
+
+	t.Run("deferral is reported until the next run", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.DeferOnBattery = true
+		s.cfg.PowerProbe = probe(PowerState{OnBattery: true}, nil)
+
+		assert.True(t, s.deferRun())
+		assert.Equal(t, "on battery", s.Status().Deferred)
+
+		s.runStarted()
+		assert.Empty(t, s.Status().Deferred)
+	})
+}
+
+func TestScheduledRunOverlap(t *testing.T) {
+	newSyncer := func(t *testing.T, runs int) (*Syncer, *mockS3Client) {
+		mockClient := new(mockS3Client)
+		if runs > 0 {
+			mockClient.On("GetObject", mock.Anything).Return(nil, awserr.New(s3.ErrCodeNoSuchKey, "", nil)).Times(runs)
+			mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{}, nil).Times(runs)
+		}
+		s := newTestSyncer(t, mockClient)
+		s.cfg.RootDir = t.TempDir()
+		return s, mockClient
+	}
+
+	t.Run("overlapping run is skipped by default", func(t *testing.T) {
+		s, mockClient := newSyncer(t, 0)
+		s.runMu.Lock()
+		s.scheduledRun(context.Background())
+		s.runMu.Unlock()
+
+		assert.False(t, s.queued)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("overlapping run is queued once", func(t *testing.T) {
+		s, mockClient := newSyncer(t, 2)
+		s.cfg.QueueOverlapping = true
+
+		s.runMu.Lock()
+		s.scheduledRun(context.Background())
+		s.scheduledRun(context.Background())
+		assert.True(t, s.queued)
+		s.runMu.Unlock()
+
+		// The current run then picks the queued one up when it finishes.
+		s.scheduledRun(context.Background())
+		assert.False(t, s.queued)
+		assert.True(t, s.runMu.TryLock(), "the run lock is released")
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestPause(t *testing.T) {
+	t.Run("queued run waits for Resume", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything).Return(nil, awserr.New(s3.ErrCodeNoSuchKey, "", nil)).Once()
+		mockClient.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{}, nil).Once()
+		s := newTestSyncer(t, mockClient)
+		s.cfg.RootDir = t.TempDir()
+		s.cfg.QueueOverlapping = true
+
+		s.runMu.Lock()
+		s.scheduledRun(context.Background())
+		s.runMu.Unlock()
+		s.Pause()
+
+		s.scheduledRun(context.Background())
+		assert.True(t, s.queued, "the queued run is held while paused")
+		assert.True(t, s.runMu.TryLock(), "the run lock is released")
+		s.runMu.Unlock()
+
+		s.Resume()
+		assert.False(t, s.queued)
+		select {
+		case <-s.trigger:
+		default:
+			t.Fatal("Resume should start the queued run")
+		}
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("transfers wait until Resume", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.Pause()
+
+		done := make(chan bool)
+		go func() { done <- s.waitWhilePaused() }()
+		select {
+		case <-done:
+			t.Fatal("waitWhilePaused returned while paused")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		s.Resume()
+		assert.True(t, <-done)
+	})
+
+	t.Run("manual runs ignore Pause", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.Pause()
+
+		done := make(chan bool)
+		go func() { done <- s.waitWhilePaused() }()
+		s.setManual(true)
+		assert.True(t, <-done)
+	})
+
+	t.Run("stopping Watch abandons paused transfers", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.Pause()
+
+		done := make(chan bool)
+		go func() { done <- s.waitWhilePaused() }()
+		s.stopWaiting()
+		assert.False(t, <-done)
+	})
+}
@@ -0,0 +1,252 @@
+package sync
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Hash algorithms for change detection, chosen with Config.HashAlgorithm.
+const (
+	HashMD5      = "md5"
+	HashSHA256   = "sha256"
+	HashXXHash64 = "xxhash64"
+)
+
+// hashMetaKeys maps each hash algorithm to the object metadata entry holding
+// the hex digest of the contents, in the order stored hashes are tried.
+var hashMetaKeys = []struct{ algorithm, key string }{
+	{HashMD5, "Sync-Md5"},
+	{HashSHA256, "Sync-Sha256"},
+	{HashXXHash64, "Sync-Xxhash64"},
+}
+
+// Object metadata entries describing the local file. The modification time
+// and the content hash are written with every upload and change detection
+// compares against them rather than the ETag, which is not an MD5 for
+// multipart or SSE-KMS objects. Restore applies them back to the tree.
+const (
+	// mtimeMetaKey holds the modification time in Unix nanoseconds.
+	mtimeMetaKey = "Gui-Sync-Mtime"
+	// modeMetaKey holds the permission bits in octal.
+	modeMetaKey = "Gui-Sync-Mode"
+	// symlinkMetaKey holds the path-escaped target of a symbolic link,
+	// uploaded as an empty object.
+	symlinkMetaKey = "Gui-Sync-Symlink"
+	// hardLinkMetaKey holds the path-escaped key of the file a hard link,
+	// uploaded as an empty object, shares its contents with.
+	hardLinkMetaKey = "Gui-Sync-Hardlink"
+	// sizeMetaKey and compressionMetaKey are set on compressed objects:
+	// the size of the original file and the compression used.
+	sizeMetaKey        = "Gui-Sync-Size"
+	compressionMetaKey = "Gui-Sync-Compression"
+	// blocksMetaKey holds the digest of the block list of a delta upload.
+	blocksMetaKey = "Gui-Sync-Blocks"
+)
+
+// reservedMetadataKey reports whether key is one of the metadata entries
+// written by gui-sync, which user metadata must not replace.
+func reservedMetadataKey(key string) bool {
+	if strings.HasPrefix(strings.ToLower(key), "gui-sync-") {
+		return true
+	}
+	for _, h := range hashMetaKeys {
+		if strings.EqualFold(h.key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func hashMetaKey(algorithm string) string {
+	for _, h := range hashMetaKeys {
+		if h.algorithm == algorithm {
+			return h.key
+		}
+	}
+	return ""
+}
+
+func newContentHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case HashMD5:
+		return md5.New(), nil
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashXXHash64:
+		return newXXH64(), nil
+	}
+	return nil, i18n.Errorf("syncer.invalid_hash", algorithm)
+}
+
+// contentHash returns the hex digest of r.
+func contentHash(algorithm string, r io.Reader) (string, error) {
+	h, err := newContentHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return "", i18n.Errorf("file.hash", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fileContentHash returns the hex digest of the file at path.
+func fileContentHash(algorithm, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", i18n.Errorf("file.open", err)
+	}
+	defer file.Close()
+	return contentHash(algorithm, file)
+}
+
+// readerContentHash hashes body and rewinds it for the upload that follows.
+func readerContentHash(algorithm string, body io.ReadSeeker) (string, error) {
+	digest, err := contentHash(algorithm, body)
+	if err != nil {
+		return "", err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return "", i18n.Errorf("file.rewind", err)
+	}
+	return digest, nil
+}
+
+// hashAlgorithm is the algorithm new uploads are hashed with.
+func (s *Syncer) hashAlgorithm() string {
+	if s.cfg.HashAlgorithm == "" {
+		return HashMD5
+	}
+	return s.cfg.HashAlgorithm
+}
+
+// withSyncMetadata adds the modification time and permissions of info and
+// the digest of the contents to metadata, which may be nil, without
+// changing the caller's map.
+func withSyncMetadata(metadata map[string]*string, info os.FileInfo, algorithm, digest string) map[string]*string {
+	out := make(map[string]*string, len(metadata)+3)
+	for key, value := range metadata {
+		out[key] = value
+	}
+	out[mtimeMetaKey] = aws.String(strconv.FormatInt(info.ModTime().UnixNano(), 10))
+	out[modeMetaKey] = aws.String(strconv.FormatUint(uint64(info.Mode().Perm()), 8))
+	out[hashMetaKey(algorithm)] = aws.String(digest)
+	return out
+}
+
+// symlinkMetadata describes the symbolic link of info pointing to target.
+func symlinkMetadata(info os.FileInfo, target string) map[string]*string {
+	return map[string]*string{
+		mtimeMetaKey:   aws.String(strconv.FormatInt(info.ModTime().UnixNano(), 10)),
+		symlinkMetaKey: aws.String(url.PathEscape(target)),
+	}
+}
+
+// hardLinkMetadata describes the file of info, a hard link to the file
+// uploaded at target.
+func hardLinkMetadata(info os.FileInfo, target string) map[string]*string {
+	return map[string]*string{
+		mtimeMetaKey:    aws.String(strconv.FormatInt(info.ModTime().UnixNano(), 10)),
+		hardLinkMetaKey: aws.String(url.PathEscape(target)),
+	}
+}
+
+// metadataValue looks key up in object metadata. S3 may return metadata
+// keys in any case.
+func metadataValue(metadata map[string]*string, key string) (string, bool) {
+	for k, value := range metadata {
+		if strings.EqualFold(k, key) {
+			return aws.StringValue(value), true
+		}
+	}
+	return "", false
+}
+
+// storedModTime reads the modification time saved by withSyncMetadata.
+func storedModTime(metadata map[string]*string) (time.Time, bool) {
+	value, ok := metadataValue(metadata, mtimeMetaKey)
+	if !ok {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// storedSize returns the size of the local file an object was uploaded
+// from: the original size of compressed objects, contentLength otherwise.
+func storedSize(metadata map[string]*string, contentLength int64) int64 {
+	if value, ok := metadataValue(metadata, sizeMetaKey); ok {
+		if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return size
+		}
+	}
+	return contentLength
+}
+
+// storedMode reads the permissions saved by withSyncMetadata.
+func storedMode(metadata map[string]*string) (os.FileMode, bool) {
+	value, ok := metadataValue(metadata, modeMetaKey)
+	if !ok {
+		return 0, false
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return 0, false
+	}
+	return os.FileMode(mode).Perm(), true
+}
+
+// storedSymlink reads the link target saved by symlinkMetadata.
+func storedSymlink(metadata map[string]*string) (string, bool) {
+	value, ok := metadataValue(metadata, symlinkMetaKey)
+	if !ok {
+		return "", false
+	}
+	target, err := url.PathUnescape(value)
+	if err != nil {
+		return "", false
+	}
+	return target, true
+}
+
+// storedHardLink reads the key saved by hardLinkMetadata.
+func storedHardLink(metadata map[string]*string) (string, bool) {
+	value, ok := metadataValue(metadata, hardLinkMetaKey)
+	if !ok {
+		return "", false
+	}
+	target, err := url.PathUnescape(value)
+	if err != nil {
+		return "", false
+	}
+	return target, true
+}
+
+// storedHash reads the content digest saved by withSyncMetadata, preferring
+// preferred so objects uploaded before a change of algorithm are still
+// compared without uploading them again.
+func storedHash(metadata map[string]*string, preferred string) (algorithm, digest string, ok bool) {
+	if value, found := metadataValue(metadata, hashMetaKey(preferred)); found && value != "" {
+		return preferred, value, true
+	}
+	for _, h := range hashMetaKeys {
+		if value, found := metadataValue(metadata, h.key); found && value != "" {
+			return h.algorithm, value, true
+		}
+	}
+	return "", "", false
+}
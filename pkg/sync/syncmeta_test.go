@@ -0,0 +1,209 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: sync metadata and fast comparison mode
+func TestFastModeComparison(t *testing.T) {
+	tempDir := t.TempDir()
+	path := createTempFile(t, tempDir, "video.mp4", "frames")
+	modTime := time.Date(2024, 3, 1, 10, 0, 0, 123456789, time.UTC)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	head := func(metadata map[string]*string, lastModified time.Time) *mockS3Client {
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+			ContentLength: aws.Int64(6),
+			LastModified:  aws.Time(lastModified),
+			ETag:          aws.String(`"ffffffffffffffffffffffffffffffff"`),
+			Metadata:      metadata,
+		}, nil).Once()
+		return mockClient
+	}
+	stored := func(tm time.Time) map[string]*string {
+		return map[string]*string{"Gui-Sync-Mtime": aws.String(strconv.FormatInt(tm.UnixNano(), 10))}
+	}
+
+	tests := []struct {
+		name     string
+		client   *mockS3Client
+		expected bool
+	}{
+		{"matching stored mtime", head(stored(modTime), modTime.Add(-time.Hour)), false},
+		{"different stored mtime", head(stored(modTime.Add(-time.Second)), modTime.Add(time.Hour)), true},
+		{"no stored mtime, object newer", head(nil, modTime.Add(time.Hour)), false},
+		{"no stored mtime, file newer", head(nil, modTime.Add(-time.Hour)), true},
+	}
+	// The ETag never matches the file, so hashing it would always report
+	// a change.
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSyncer(t, tt.client)
+			s.cfg.Fast = true
+
+			changed, err := s.fileChangedOnS3("video.mp4", path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, changed)
+			tt.client.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUploadStoresSyncMetadata(t *testing.T) {
+	tempDir := t.TempDir()
+	path := createTempFile(t, tempDir, "a.txt", "content")
+	modTime := time.Date(2024, 3, 1, 10, 0, 0, 5, time.UTC)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+	require.NoError(t, os.Chmod(path, 0640))
+
+	mockClient := new(mockS3Client)
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		got, ok := storedModTime(input.Metadata)
+		algorithm, hash, _ := storedHash(input.Metadata, HashMD5)
+		mode, _ := storedMode(input.Metadata)
+		return ok && got.Equal(modTime) && mode == 0640 &&
+			algorithm == HashMD5 && hash == "9a0364b9e99bb480dd25e1f0284c8555"
+	})).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	s := newTestSyncer(t, mockClient)
+	_, err := s.uploadFileS3("a.txt", filepath.Join(tempDir, "a.txt"), 7)
+	require.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
+
+func TestChangeDetectionUsesStoredMD5(t *testing.T) {
+	tempDir := t.TempDir()
+	path := createTempFile(t, tempDir, "a.txt", "content")
+	modTime := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	// A multipart (or SSE-KMS) ETag is not an MD5 and cannot be compared;
+	// the stored metadata decides instead.
+	tests := []struct {
+		name     string
+		metadata map[string]*string
+		expected bool
+	}{
+		{"same contents, touched file", map[string]*string{"Sync-Md5": aws.String("9a0364b9e99bb480dd25e1f0284c8555")}, false},
+		{"different contents", map[string]*string{"Sync-Md5": aws.String("ffffffffffffffffffffffffffffffff")}, true},
+		{"stored hash of another algorithm", map[string]*string{"Sync-Xxhash64": aws.String("6c5b191a31c5a9fc")}, false},
+		{"matching stored mtime skips hashing", map[string]*string{
+			"Gui-Sync-Mtime": aws.String(strconv.FormatInt(modTime.UnixNano(), 10)),
+			"Sync-Md5":       aws.String("ffffffffffffffffffffffffffffffff"),
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mockS3Client)
+			mockClient.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+				ContentLength: aws.Int64(7),
+				LastModified:  aws.Time(modTime.Add(-time.Hour)),
+				ETag:          aws.String(`"0123456789abcdef0123456789abcdef-3"`),
+				Metadata:      tt.metadata,
+			}, nil).Once()
+
+			changed, err := newTestSyncer(t, mockClient).fileChangedOnS3("a.txt", path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, changed)
+		})
+	}
+}
+
+func TestHashAlgorithmOption(t *testing.T) {
+	_, err := New(Config{Bucket: "b", Client: new(mockS3Client), StateDir: t.TempDir(), HashAlgorithm: "crc64"})
+	assert.Error(t, err)
+
+	s, err := New(Config{Bucket: "b", Client: new(mockS3Client), StateDir: t.TempDir(), HashAlgorithm: HashSHA256})
+	require.NoError(t, err)
+	assert.Equal(t, s3.ChecksumAlgorithmSha256, s.checksumAlgorithm, "SHA-256 enables the native S3 checksum")
+
+	tempDir := t.TempDir()
+	path := createTempFile(t, tempDir, "a.txt", "content")
+	mockClient := new(mockS3Client)
+	mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return aws.StringValue(input.Metadata["Sync-Xxhash64"]) == "6c5b191a31c5a9fc" && input.Metadata["Sync-Md5"] == nil
+	})).Return(&s3.PutObjectOutput{}, nil).Once()
+	s = newTestSyncer(t, mockClient)
+	s.cfg.HashAlgorithm = HashXXHash64
+	_, err = s.uploadFileS3("a.txt", path, 7)
+	require.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
+
+func TestSymlinks(t *testing.T) {
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "real.txt", "content")
+	link := filepath.Join(tempDir, "link.txt")
+	require.NoError(t, os.Symlink("real.txt", link))
+
+	t.Run("uploaded as an empty object with the target", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		mockClient.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+			target, ok := storedSymlink(input.Metadata)
+			return *input.Key == "link.txt" && ok && target == "real.txt"
+		})).Return(&s3.PutObjectOutput{}, nil).Once()
+
+		size, err := newTestSyncer(t, mockClient).uploadFileS3("link.txt", link, 8)
+		require.NoError(t, err)
+		assert.Zero(t, size)
+		mockClient.AssertExpectations(t)
+	})
+
+	tests := []struct {
+		name     string
+		metadata map[string]*string
+		expected bool
+	}{
+		{"same target", map[string]*string{"Gui-Sync-Symlink": aws.String("real.txt")}, false},
+		{"different target", map[string]*string{"Gui-Sync-Symlink": aws.String("other.txt")}, true},
+		{"object is a regular file", map[string]*string{"Sync-Md5": aws.String("9a0364b9e99bb480dd25e1f0284c8555")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mockS3Client)
+			mockClient.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+				ContentLength: aws.Int64(0),
+				LastModified:  aws.Time(time.Now().Add(time.Hour)),
+				ETag:          aws.String(`"d41d8cd98f00b204e9800998ecf8427e"`),
+				Metadata:      tt.metadata,
+			}, nil).Once()
+
+			changed, err := newTestSyncer(t, mockClient).fileChangedOnS3("link.txt", link)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, changed)
+		})
+	}
+}
+
+func TestPermissionChangeIsUploaded(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not compared on Windows")
+	}
+	tempDir := t.TempDir()
+	path := createTempFile(t, tempDir, "a.txt", "content")
+	require.NoError(t, os.Chmod(path, 0600))
+
+	mockClient := new(mockS3Client)
+	mockClient.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+		ContentLength: aws.Int64(7),
+		LastModified:  aws.Time(time.Now().Add(time.Hour)),
+		ETag:          aws.String(`"9a0364b9e99bb480dd25e1f0284c8555"`),
+		Metadata:      map[string]*string{"Gui-Sync-Mode": aws.String("644")},
+	}, nil).Once()
+
+	changed, err := newTestSyncer(t, mockClient).fileChangedOnS3("a.txt", path)
+	require.NoError(t, err)
+	assert.True(t, changed)
+}
@@ -0,0 +1,88 @@
+package sync
+
+import (
+	"cmp"
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Timeouts bounds each attempt of an S3 request, so a stalled attempt is
+// abandoned and retried. Zero fields take the defaults: 30s and 30m.
+type Timeouts struct {
+	// Metadata bounds the calls that carry no object data: HEAD, listings,
+	// deletes, multipart bookkeeping. It also bounds the wait for the
+	// response headers of downloads, whose body is read afterwards.
+	Metadata time.Duration
+	// Transfer bounds the attempts that upload or copy object data: a
+	// whole object or one part.
+	Transfer time.Duration
+}
+
+const (
+	defaultMetadataTimeout = 30 * time.Second
+	defaultTransferTimeout = 30 * time.Minute
+)
+
+// transferOperations send object data, or make S3 copy it.
+var transferOperations = map[string]bool{
+	"PutObject":               true,
+	"UploadPart":              true,
+	"UploadPartCopy":          true,
+	"CopyObject":              true,
+	"CompleteMultipartUpload": true,
+}
+
+// streamingOperations return a body the caller reads after the request
+// completes, which a deadline on the attempt would cut short.
+var streamingOperations = map[string]bool{
+	"GetObject": true,
+}
+
+// Validate checks t.
+func (t Timeouts) Validate() error {
+	if t.Metadata < 0 || t.Transfer < 0 {
+		return i18n.Errorf("timeouts.negative")
+	}
+	return nil
+}
+
+func (t Timeouts) metadata() time.Duration {
+	return cmp.Or(t.Metadata, defaultMetadataTimeout)
+}
+
+// forOperation returns the deadline of each attempt of the operation
+// named name, or zero for none.
+func (t Timeouts) forOperation(name string) time.Duration {
+	switch {
+	case streamingOperations[name]:
+		return 0
+	case transferOperations[name]:
+		return cmp.Or(t.Transfer, defaultTransferTimeout)
+	default:
+		return t.metadata()
+	}
+}
+
+// install makes every request sent through handlers put a deadline on each
+// of its attempts. The request's own context, such as one given to a
+// WithContext method, still applies to the request as a whole.
+func (t Timeouts) install(handlers *request.Handlers) {
+	handlers.Validate.PushBack(func(r *request.Request) {
+		timeout := t.forOperation(r.Operation.Name)
+		if timeout <= 0 {
+			return
+		}
+		cancel := context.CancelFunc(func() {})
+		r.Handlers.Send.PushFront(func(r *request.Request) {
+			var ctx context.Context
+			ctx, cancel = context.WithTimeout(r.Context(), timeout)
+			r.HTTPRequest = r.HTTPRequest.WithContext(ctx)
+		})
+		r.Handlers.CompleteAttempt.PushBack(func(*request.Request) {
+			cancel()
+		})
+	})
+}
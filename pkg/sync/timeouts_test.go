@@ -0,0 +1,57 @@
+package sync
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: request timeouts
+func TestTimeoutsForOperation(t *testing.T) {
+	var zero Timeouts
+	assert.Equal(t, defaultMetadataTimeout, zero.forOperation("HeadObject"))
+	assert.Equal(t, defaultTransferTimeout, zero.forOperation("UploadPart"))
+	assert.Zero(t, zero.forOperation("GetObject"), "downloads are read after the request completes")
+
+	custom := Timeouts{Metadata: 5 * time.Second, Transfer: time.Hour}
+	assert.Equal(t, 5*time.Second, custom.forOperation("ListObjectsV2"))
+	assert.Equal(t, time.Hour, custom.forOperation("PutObject"))
+
+	assert.Equal(t, "timeouts.negative", i18n.ID(Timeouts{Transfer: -time.Second}.Validate()))
+}
+
+func TestTimeoutsPerAttempt(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", createTempFile(t, dir, "config", ""))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", createTempFile(t, dir, "credentials", ""))
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	// Every response takes 300ms.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.Header().Set("ETag", `"abc"`)
+	}))
+	defer server.Close()
+
+	sess, err := NewSession("us-east-1", Credentials{}, RetryPolicy{MaxAttempts: 1}, Timeouts{Metadata: 5 * time.Second, Transfer: 50 * time.Millisecond})
+	require.NoError(t, err)
+	client := s3.New(sess, &aws.Config{Endpoint: aws.String(server.URL), S3ForcePathStyle: aws.Bool(true)})
+
+	_, err = client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("a.txt")})
+	assert.NoError(t, err, "metadata calls get the metadata timeout")
+
+	start := time.Now()
+	_, err = client.PutObject(&s3.PutObjectInput{Bucket: aws.String("bucket"), Key: aws.String("a.txt"), Body: strings.NewReader("data")})
+	require.Error(t, err, "uploads get the transfer timeout")
+	assert.Contains(t, err.Error(), "deadline exceeded")
+	assert.Less(t, time.Since(start), 250*time.Millisecond)
+}
@@ -0,0 +1,292 @@
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// uploadTask is a file the differ decided to upload.
+type uploadTask struct {
+	path     string
+	relPath  string
+	s3Key    string
+	fileSize int64
+	modTime  time.Time
+	// linkTo is the key of the file the file is a hard link to, uploaded
+	// as a reference to it.
+	linkTo string
+}
+
+// transferEngine is the third pipeline stage: a pool of workers uploading
+// the tasks produced by the differ.
+type transferEngine struct {
+	syncer  *Syncer
+	workers int
+	// result receives the uploads that failed.
+	result *SyncResult
+}
+
+// run uploads every task from in until it is closed.
+func (e *transferEngine) run(in <-chan uploadTask) {
+	workers := e.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	queued := make(chan uploadTask)
+	go e.schedule(in, queued)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range queued {
+				if !e.syncer.waitWhilePaused() {
+					e.syncer.heads.forget(task.s3Key)
+					e.syncer.stats.pending.Add(-1)
+					continue
+				}
+				start := time.Now()
+				var size int64
+				var err error
+				if task.linkTo != "" {
+					size, err = e.syncer.uploadHardLink(task.s3Key, task.linkTo, task.path)
+				} else {
+					size, err = e.syncer.uploadFileS3(task.s3Key, task.path, task.fileSize)
+				}
+				e.syncer.stats.pending.Add(-1)
+				e.syncer.heads.forget(task.s3Key)
+				var busyErr *BusyError
+				if errors.As(err, &busyErr) {
+					e.syncer.deferBusy(task.relPath, err)
+					continue
+				}
+				action := reportAction{Action: actionUpload, Key: task.s3Key, Size: task.fileSize, Duration: time.Since(start).Seconds()}
+				if err != nil {
+					action.Error = err.Error()
+				}
+				e.syncer.report.add(action)
+				if err != nil {
+					e.result.add(FileResult{Key: task.s3Key, Path: task.path, Status: StatusUploadFailed, Err: err})
+					e.syncer.stats.failed.Add(1)
+					log.Printf("  ❌ %s - %v", task.relPath, err)
+				} else {
+					if task.linkTo == "" {
+						e.syncer.scan.synced(task.relPath)
+						e.syncer.initial.add(task.s3Key, task.fileSize, task.modTime)
+					}
+					e.syncer.stats.uploaded.Add(1)
+					e.syncer.stats.bytesUploaded.Add(size)
+					fmt.Printf(i18n.T("transfer.uploaded"), task.relPath, size)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// schedule forwards the tasks from in to out, which it closes once in is
+// closed and drained. Tasks wait in one queue per priority while the
+// workers are busy, so a high-priority file queued behind large ones is
+// handed out first.
+func (e *transferEngine) schedule(in <-chan uploadTask, out chan<- uploadTask) {
+	defer close(out)
+
+	rank := map[string]int{PriorityHigh: 0, PriorityNormal: 1, PriorityLow: 2}
+	var queues [3][]uploadTask
+	enqueue := func(task uploadTask) {
+		r := rank[e.syncer.priority(task.s3Key)]
+		queues[r] = append(queues[r], task)
+	}
+
+	for {
+		// Take in everything already waiting before choosing what goes
+		// next.
+		for drained := false; in != nil && !drained; {
+			select {
+			case task, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				enqueue(task)
+			default:
+				drained = true
+			}
+		}
+
+		var next *[]uploadTask
+		for i := range queues {
+			if len(queues[i]) > 0 {
+				next = &queues[i]
+				break
+			}
+		}
+		if next == nil {
+			if in == nil {
+				return
+			}
+			task, ok := <-in
+			if !ok {
+				return
+			}
+			enqueue(task)
+			continue
+		}
+
+		select {
+		case out <- (*next)[0]:
+			*next = (*next)[1:]
+		case task, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			enqueue(task)
+		}
+	}
+}
+
+func (s *Syncer) uploadFileS3(s3Key string, filePath string, fileSize int64) (uploaded int64, err error) {
+	if info, err := os.Lstat(filePath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		s.objects.remove(s3Key)
+		return s.uploadSymlink(s3Key, filePath, info)
+	}
+
+	meta, err := s.objectSettings(s3Key, filePath)
+	if err != nil {
+		return 0, err
+	}
+	if meta != nil && meta.Compress != "" {
+		s.objects.remove(s3Key)
+		return s.uploadCompressed(s3Key, filePath, meta)
+	}
+
+	file, err := os.Open(filePath)
+	if lockedError(err) {
+		return 0, &BusyError{Path: filePath, Locked: true}
+	}
+	if err != nil {
+		return 0, i18n.Errorf("file.open", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, i18n.Errorf("file.stat", err)
+	}
+	// A size different from the one scanned means the file is still being
+	// written.
+	if info.Size() != fileSize {
+		return 0, &BusyError{Path: filePath}
+	}
+
+	multipart := fileSize > multipartThreshold
+	var hashes uploadHashes
+	if s.cfg.Dedup || s.objects != nil || !multipart {
+		if hashes, err = s.hashUpload(file, info, !multipart); err != nil {
+			return 0, err
+		}
+	}
+
+	if fileSize <= maxCopyObjectSize {
+		if source, ok := s.movedFrom(s3Key, hashes.digest, fileSize); ok {
+			err := s.copyMoved(s3Key, source, filePath, info, meta, hashes.digest)
+			if err == nil {
+				return 0, nil
+			}
+			s.objects.remove(source)
+			log.Printf(i18n.T("moves.copy_failed"), s3Key, source, err)
+		}
+	}
+	defer func() {
+		if err == nil {
+			s.indexObject(s3Key, s.hashAlgorithm(), hashes.digest, fileSize)
+		}
+	}()
+
+	if s.cfg.Dedup {
+		if source, indexed, ok := s.duplicateOf(s3Key, hashes.digest, fileSize); ok && fileSize <= maxCopyObjectSize {
+			err := s.copyDuplicate(s3Key, source, filePath, info, meta, hashes.digest)
+			if err == nil || !indexed {
+				return 0, err
+			}
+			s.objects.remove(source)
+			log.Printf(i18n.T("dedup.copy_failed"), s3Key, source, err)
+		}
+		defer func() {
+			if err == nil {
+				s.contents.add(s.hashAlgorithm(), hashes.digest, s3Key)
+			}
+		}()
+	}
+
+	if multipart {
+		fmt.Printf(i18n.T("transfer.multipart"), filepath.Base(filePath), float64(fileSize)/(1024*1024))
+		return s.uploadMultipart(s3Key, file, fileSize)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(s3Key),
+		Body:   s.uploadBody(s3Key, file),
+	}
+	meta.applyPut(input)
+	s.retention(meta).applyPut(input)
+	input.Metadata = s.withXattrs(withSyncMetadata(input.Metadata, info, s.hashAlgorithm(), hashes.digest), filePath)
+	if hashes.checksum != "" {
+		input.ChecksumAlgorithm = aws.String(s.checksumAlgorithm)
+		newObjectChecksum(s.checksumAlgorithm, hashes.checksum).applyPut(input)
+	}
+
+	output, err := s.client.PutObject(input)
+	if err != nil {
+		return 0, i18n.Errorf("s3.upload", err)
+	}
+	if err := checkUnchanged(file, info); err != nil {
+		s.removePartialUpload(input)
+		return 0, err
+	}
+	if err := s.verifyPut(input, output, file, HashMD5, hashes.md5); err != nil {
+		return 0, err
+	}
+
+	return fileSize, nil
+}
+
+// uploadSymlink stores a symbolic link as an empty object whose metadata
+// holds the link target, so restore can recreate the link.
+func (s *Syncer) uploadSymlink(s3Key, path string, info os.FileInfo) (int64, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return 0, i18n.Errorf("file.readlink", err)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(s.cfg.Bucket),
+		Key:      aws.String(s3Key),
+		Body:     bytes.NewReader(nil),
+		Metadata: symlinkMetadata(info, target),
+	}
+	s.retention(nil).applyPut(input)
+	if err := s.setPutChecksum(input, bytes.NewReader(nil)); err != nil {
+		return 0, err
+	}
+	if _, err := s.client.PutObject(input); err != nil {
+		return 0, i18n.Errorf("s3.upload", err)
+	}
+	return 0, nil
+}
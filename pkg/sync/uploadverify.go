@@ -0,0 +1,113 @@
+package sync
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// verifyPartAttempts bounds the uploads of a multipart part whose contents,
+// as S3 computed them, keep differing from the file.
+const verifyPartAttempts = 3
+
+// VerifyError reports an upload whose contents, as S3 computed them,
+// differ from the local file: it was corrupted in transit. Runs retry it
+// like transient failures.
+type VerifyError struct {
+	Key string
+	// Part is the number of the multipart part that differed, or 0.
+	Part   int64
+	Local  string
+	Remote string
+}
+
+func (e *VerifyError) Error() string {
+	if e.Part > 0 {
+		return fmt.Sprintf(i18n.T("upload_verify.part_mismatch"), e.Key, e.Part, e.Remote, e.Local)
+	}
+	return fmt.Sprintf(i18n.T("upload_verify.mismatch"), e.Key, e.Remote, e.Local)
+}
+
+// etagIsMD5 reports whether S3 computed the ETag of an upload as the MD5
+// of its body, which it does not with SSE-KMS or customer keys.
+func etagIsMD5(sse, customerAlgorithm *string) bool {
+	return !strings.HasPrefix(aws.StringValue(sse), "aws:kms") && customerAlgorithm == nil
+}
+
+// firstChecksum returns the first digest set among values.
+func firstChecksum(values ...*string) string {
+	for _, value := range values {
+		if value != nil {
+			return *value
+		}
+	}
+	return ""
+}
+
+// verifyPut checks, with Config.VerifyUploads, the object S3 stored for
+// input against body: the additional checksum sent with it when there is
+// one, or else the ETag against the MD5 of body, which is digest when
+// algorithm is HashMD5. A mismatching object is deleted, so it is never
+// taken for a synced copy, and a *VerifyError returned.
+func (s *Syncer) verifyPut(input *s3.PutObjectInput, output *s3.PutObjectOutput, body io.ReadSeeker, algorithm, digest string) error {
+	if !s.cfg.VerifyUploads || output == nil {
+		return nil
+	}
+
+	var local, remote string
+	if input.ChecksumAlgorithm != nil {
+		local = firstChecksum(input.ChecksumSHA256, input.ChecksumCRC32C, input.ChecksumCRC32, input.ChecksumSHA1)
+		remote = firstChecksum(output.ChecksumSHA256, output.ChecksumCRC32C, output.ChecksumCRC32, output.ChecksumSHA1)
+	} else if etagIsMD5(output.ServerSideEncryption, output.SSECustomerAlgorithm) {
+		if algorithm != HashMD5 {
+			if _, err := body.Seek(0, io.SeekStart); err != nil {
+				return i18n.Errorf("file.rewind", err)
+			}
+			var err error
+			if digest, err = readerContentHash(HashMD5, body); err != nil {
+				return err
+			}
+		}
+		local = digest
+		remote = strings.Trim(aws.StringValue(output.ETag), `"`)
+	}
+	// Storage that reports neither cannot be checked.
+	if remote == "" || local == remote {
+		return nil
+	}
+
+	key := aws.StringValue(input.Key)
+	if _, err := s.client.DeleteObject(&s3.DeleteObjectInput{Bucket: input.Bucket, Key: input.Key}); err != nil {
+		log.Printf(i18n.T("upload_verify.delete_failed"), key, err)
+	}
+	return &VerifyError{Key: key, Local: local, Remote: remote}
+}
+
+// verifyPart checks, with Config.VerifyUploads, a part S3 stored against
+// the checksum sent with it, or else its ETag against the MD5 of body.
+func (s *Syncer) verifyPart(input *s3.UploadPartInput, output *s3.UploadPartOutput, body io.Reader) error {
+	if !s.cfg.VerifyUploads {
+		return nil
+	}
+
+	var local, remote string
+	if sent := firstChecksum(input.ChecksumSHA256, input.ChecksumCRC32C, input.ChecksumCRC32, input.ChecksumSHA1); sent != "" {
+		local = sent
+		remote = firstChecksum(output.ChecksumSHA256, output.ChecksumCRC32C, output.ChecksumCRC32, output.ChecksumSHA1)
+	} else if etagIsMD5(output.ServerSideEncryption, output.SSECustomerAlgorithm) {
+		var err error
+		if local, err = contentHash(HashMD5, body); err != nil {
+			return err
+		}
+		remote = strings.Trim(aws.StringValue(output.ETag), `"`)
+	}
+	if remote == "" || local == remote {
+		return nil
+	}
+	return &VerifyError{Key: aws.StringValue(input.Key), Part: aws.Int64Value(input.PartNumber), Local: local, Remote: remote}
+}
@@ -0,0 +1,185 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: upload verification
+func TestVerifyPut(t *testing.T) {
+	const content = "conteúdo do arquivo"
+	digest, err := contentHash(HashMD5, strings.NewReader(content))
+	require.NoError(t, err)
+
+	t.Run("matching ETag passes", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		path := createTempFile(t, t.TempDir(), "a.txt", content)
+		mockClient.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{ETag: aws.String(`"` + digest + `"`)}, nil).Once()
+
+		s := newTestSyncer(t, mockClient)
+		s.cfg.VerifyUploads = true
+		_, err := s.uploadFileS3("a.txt", path, int64(len(content)))
+		require.NoError(t, err)
+		mockClient.AssertNotCalled(t, "DeleteObject", mock.Anything)
+	})
+
+	t.Run("mismatching ETag removes the object", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		path := createTempFile(t, t.TempDir(), "a.txt", content)
+		mockClient.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{ETag: aws.String(`"0badc0de"`)}, nil).Once()
+		mockClient.On("DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+			return *input.Key == "a.txt"
+		})).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+		s := newTestSyncer(t, mockClient)
+		s.cfg.VerifyUploads = true
+		_, err := s.uploadFileS3("a.txt", path, int64(len(content)))
+
+		var verifyErr *VerifyError
+		require.True(t, errors.As(err, &verifyErr))
+		assert.Equal(t, "a.txt", verifyErr.Key)
+		assert.Equal(t, digest, verifyErr.Local)
+		assert.Equal(t, "0badc0de", verifyErr.Remote)
+		assert.True(t, isRetriable(err))
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("hashes with MD5 when change detection does not", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		path := createTempFile(t, t.TempDir(), "a.txt", content)
+		mockClient.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{ETag: aws.String(`"` + digest + `"`)}, nil).Once()
+
+		s := newTestSyncer(t, mockClient)
+		s.cfg.VerifyUploads = true
+		s.cfg.HashAlgorithm = HashXXHash64
+		_, err := s.uploadFileS3("a.txt", path, int64(len(content)))
+		require.NoError(t, err)
+	})
+
+	t.Run("compares the checksum sent", func(t *testing.T) {
+		input := &s3.PutObjectInput{
+			Key:               aws.String("a.txt"),
+			ChecksumAlgorithm: aws.String(s3.ChecksumAlgorithmSha256),
+			ChecksumSHA256:    aws.String("local"),
+		}
+		mockClient := new(mockS3Client)
+		mockClient.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, nil).Once()
+		s := newTestSyncer(t, mockClient)
+		s.cfg.VerifyUploads = true
+
+		body := strings.NewReader(content)
+		assert.NoError(t, s.verifyPut(input, &s3.PutObjectOutput{ChecksumSHA256: aws.String("local"), ETag: aws.String(`"other"`)}, body, HashSHA256, ""))
+		assert.Error(t, s.verifyPut(input, &s3.PutObjectOutput{ChecksumSHA256: aws.String("remote")}, body, HashSHA256, ""))
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("skips ETags of encrypted objects", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.VerifyUploads = true
+		input := &s3.PutObjectInput{Key: aws.String("a.txt")}
+		body := strings.NewReader(content)
+
+		assert.NoError(t, s.verifyPut(input, &s3.PutObjectOutput{ETag: aws.String(`"x"`), ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms)}, body, HashMD5, digest))
+		assert.NoError(t, s.verifyPut(input, &s3.PutObjectOutput{ETag: aws.String(`"x"`), SSECustomerAlgorithm: aws.String("AES256")}, body, HashMD5, digest))
+		assert.NoError(t, s.verifyPut(input, &s3.PutObjectOutput{}, body, HashMD5, digest), "nothing to compare")
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		input := &s3.PutObjectInput{Key: aws.String("a.txt")}
+		assert.NoError(t, s.verifyPut(input, &s3.PutObjectOutput{ETag: aws.String(`"x"`)}, strings.NewReader(content), HashMD5, digest))
+	})
+}
+
+func TestVerifyMultipartParts(t *testing.T) {
+	openSparse := func(t *testing.T) (*os.File, int64) {
+		size := int64(2*partSize + 1)
+		path := createSparseFile(t, t.TempDir(), "disk.img", size)
+		file, err := os.Open(path)
+		require.NoError(t, err)
+		t.Cleanup(func() { file.Close() })
+		return file, size
+	}
+	fullPart, err := contentHash(HashMD5, strings.NewReader(strings.Repeat("\x00", partSize)))
+	require.NoError(t, err)
+	tail, err := contentHash(HashMD5, strings.NewReader("\x00"))
+	require.NoError(t, err)
+	etag := func(number int64) *string {
+		if number == 3 {
+			return aws.String(`"` + tail + `"`)
+		}
+		return aws.String(`"` + fullPart + `"`)
+	}
+	isPart := func(number int64) interface{} {
+		return mock.MatchedBy(func(input *s3.UploadPartInput) bool { return *input.PartNumber == number })
+	}
+
+	t.Run("corrupted part is sent again", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		s := newTestSyncer(t, mockClient)
+		s.cfg.VerifyUploads = true
+		file, size := openSparse(t)
+
+		mockClient.On("CreateMultipartUpload", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("up-1")}, nil).Once()
+		mockClient.On("UploadPart", isPart(2)).Return(&s3.UploadPartOutput{ETag: aws.String(`"0badc0de"`)}, nil).Once()
+		for number := int64(1); number <= 3; number++ {
+			mockClient.On("UploadPart", isPart(number)).Return(&s3.UploadPartOutput{ETag: etag(number)}, nil).Once()
+		}
+		mockClient.On("CompleteMultipartUpload", mock.Anything).Return(&s3.CompleteMultipartUploadOutput{}, nil).Once()
+
+		uploaded, err := s.uploadMultipart("disk.img", file, size)
+		require.NoError(t, err)
+		assert.Equal(t, size, uploaded)
+		mockClient.AssertNumberOfCalls(t, "UploadPart", 4)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("part corrupted every time aborts the upload", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		s := newTestSyncer(t, mockClient)
+		s.cfg.VerifyUploads = true
+		file, size := openSparse(t)
+
+		mockClient.On("CreateMultipartUpload", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("up-2")}, nil).Once()
+		mockClient.On("UploadPart", isPart(1)).Return(&s3.UploadPartOutput{ETag: aws.String(`"0badc0de"`)}, nil).Times(verifyPartAttempts)
+		mockClient.On("UploadPart", isPart(2)).Return(&s3.UploadPartOutput{ETag: etag(2)}, nil).Maybe()
+		mockClient.On("UploadPart", isPart(3)).Return(&s3.UploadPartOutput{ETag: etag(3)}, nil).Maybe()
+		mockClient.On("AbortMultipartUpload", mock.MatchedBy(func(input *s3.AbortMultipartUploadInput) bool {
+			return *input.UploadId == "up-2"
+		})).Return(&s3.AbortMultipartUploadOutput{}, nil).Once()
+
+		_, err := s.uploadMultipart("disk.img", file, size)
+		var verifyErr *VerifyError
+		require.True(t, errors.As(err, &verifyErr))
+		assert.Equal(t, int64(1), verifyErr.Part)
+		assert.True(t, isRetriable(err))
+		assert.NoFileExists(t, s.checkpointPath("disk.img"))
+		mockClient.AssertNotCalled(t, "CompleteMultipartUpload", mock.Anything)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("other part errors are not retried at once", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		s := newTestSyncer(t, mockClient)
+		s.cfg.VerifyUploads = true
+		file, size := openSparse(t)
+
+		mockClient.On("CreateMultipartUpload", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("up-3")}, nil).Once()
+		mockClient.On("UploadPart", mock.Anything).Return(nil, fmt.Errorf("connection reset"))
+
+		_, err := s.uploadMultipart("disk.img", file, size)
+		require.Error(t, err)
+		var verifyErr *VerifyError
+		assert.False(t, errors.As(err, &verifyErr))
+		assert.FileExists(t, s.checkpointPath("disk.img"))
+	})
+}
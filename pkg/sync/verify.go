@@ -0,0 +1,293 @@
+package sync
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+const verifyWorkers = 5
+
+// Outcomes of the verification of one key, in VerifyProblem.Status.
+const (
+	// VerifyCorrupted is an object whose checksum does not match a local
+	// file unchanged since it was uploaded.
+	VerifyCorrupted = "corrupted"
+	// VerifyMissing is a local file with no object.
+	VerifyMissing = "missing"
+	// VerifyExtra is an object with no local file.
+	VerifyExtra = "extra"
+	// VerifyChanged is a file modified since its last upload; the next run
+	// uploads it again.
+	VerifyChanged = "changed"
+	// VerifyUnverifiable is an object with neither a stored content hash
+	// nor an ETag computed from the MD5 of its contents.
+	VerifyUnverifiable = "unverifiable"
+	// VerifyUnreadable is a local file that could not be read.
+	VerifyUnreadable = "unreadable"
+)
+
+// VerifyProblem is a key that did not verify cleanly.
+type VerifyProblem struct {
+	Key    string
+	Status string
+	Err    error
+}
+
+// VerifyResult is the outcome of Verify. Checked counts the local files
+// and archives compared with the bucket, Verified those whose checksums
+// matched.
+type VerifyResult struct {
+	Checked  int
+	Verified int
+	Problems []VerifyProblem
+	// Manifest is the ID of the manifest compared by VerifyManifest, and
+	// Sampled how many of its objects VerifyManifestSample downloaded.
+	Manifest string
+	Sampled  int
+}
+
+// Failed returns the problems that mean the bucket does not hold a
+// restorable copy of the tree: corrupted, missing and extra objects and
+// unreadable files. Changed and unverifiable files are only reported.
+func (r *VerifyResult) Failed() []VerifyProblem {
+	var failed []VerifyProblem
+	for _, p := range r.Problems {
+		if p.Status != VerifyChanged && p.Status != VerifyUnverifiable {
+			failed = append(failed, p)
+		}
+	}
+	return failed
+}
+
+// Verify audits the bucket against RootDir without modifying either: it
+// re-hashes every local file and compares it with the content hash stored
+// with its object and, when the ETag is the MD5 of the contents, with the
+// ETag computed by S3. Archived directories are only checked for the
+// presence of their archive. Extra objects are not looked for with
+// FilesFrom, which does not describe the whole tree.
+func (s *Syncer) Verify(ctx context.Context) (*VerifyResult, error) {
+	root := s.cfg.RootDir
+	if root == "" {
+		return nil, i18n.Errorf("syncer.empty_dir")
+	}
+	if s.cfg.GitIgnore {
+		s.gitignore = newGitignoreMatcher(root)
+	}
+
+	objects, err := s.bucketObjects(s.keyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VerifyResult{}
+	var mu sync.Mutex
+	record := func(key, status string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if status == "" {
+			result.Verified++
+			return
+		}
+		result.Problems = append(result.Problems, VerifyProblem{Key: key, Status: status, Err: err})
+	}
+
+	if s.cfg.FilesFrom == "" {
+		dirs, err := s.archiveDirs(root)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			result.Checked++
+			_, hasArchive := objects[s.prefixed(archiveKey(dir))]
+			_, hasIndex := objects[s.prefixed(archiveIndexKey(dir))]
+			delete(objects, s.prefixed(archiveKey(dir)))
+			delete(objects, s.prefixed(archiveIndexKey(dir)))
+			if !hasArchive || !hasIndex {
+				record(s.prefixed(archiveKey(dir)), VerifyMissing, nil)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type verifyTask struct{ path, key string }
+	tasks := make(chan verifyTask, 100)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i := 0; i < verifyWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				if ctx.Err() != nil {
+					continue
+				}
+				status, err := s.verifyFile(task.key, task.path)
+				if status == "" && err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				record(task.key, status, err)
+			}
+		}()
+	}
+
+	walkErr := walkTree(root, s.cfg.FilesFrom, func(path, relPath string, info os.FileInfo) error {
+		if _, archived := s.archivedDir(relPath); archived {
+			return nil
+		}
+		key := s.keyOf(relPath)
+		_, exists := objects[key]
+		delete(objects, key)
+		if s.shouldIgnore(relPath) {
+			return nil
+		}
+		result.Checked++
+		if !exists {
+			record(key, VerifyMissing, nil)
+			return nil
+		}
+		select {
+		case tasks <- verifyTask{path: path, key: key}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, func(relPath string, err error) {
+		delete(objects, s.keyOf(relPath))
+		record(s.keyOf(relPath), VerifyUnreadable, err)
+	}, s.mountsSkipped(func(relPath string) {
+		for key := range objects {
+			if strings.HasPrefix(key, s.keyOf(relPath)+"/") {
+				delete(objects, key)
+			}
+		}
+	}))
+	close(tasks)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	if s.cfg.FilesFrom == "" {
+		for key := range objects {
+			if !s.skipDelete(key) {
+				record(key, VerifyExtra, nil)
+			}
+		}
+	}
+
+	sort.Slice(result.Problems, func(i, j int) bool { return result.Problems[i].Key < result.Problems[j].Key })
+	return result, nil
+}
+
+// verifyFile compares the local file at localPath with the object at key.
+// It returns an empty status when the checksums match, and an error with
+// an empty status when the object could not be read at all.
+func (s *Syncer) verifyFile(key, localPath string) (string, error) {
+	head, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == http.StatusNotFound {
+			return VerifyMissing, nil
+		}
+		return "", i18n.Errorf("s3.head", err)
+	}
+
+	info, err := os.Lstat(localPath)
+	if err != nil {
+		return VerifyUnreadable, err
+	}
+
+	// A mismatch is corruption only if the file has not been modified since
+	// it was uploaded.
+	mismatch := VerifyChanged
+	if stored, ok := storedModTime(head.Metadata); ok {
+		if stored.Equal(info.ModTime()) {
+			mismatch = VerifyCorrupted
+		}
+	} else if head.LastModified != nil && !info.ModTime().After(*head.LastModified) {
+		mismatch = VerifyCorrupted
+	}
+
+	storedTarget, storedIsLink := storedSymlink(head.Metadata)
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(localPath)
+		if err != nil {
+			return VerifyUnreadable, i18n.Errorf("file.readlink", err)
+		}
+		if !storedIsLink || storedTarget != target {
+			return mismatch, nil
+		}
+		return "", nil
+	}
+	// A hard link holds the contents of the object of the file it links to.
+	if target, ok := storedHardLink(head.Metadata); ok {
+		return s.verifyFile(target, localPath)
+	}
+	if storedIsLink || storedSize(head.Metadata, aws.Int64Value(head.ContentLength)) != info.Size() {
+		return mismatch, nil
+	}
+
+	verified := false
+	if algorithm, digest, ok := storedHash(head.Metadata, s.hashAlgorithm()); ok {
+		local, err := fileContentHash(algorithm, localPath)
+		if err != nil {
+			return VerifyUnreadable, err
+		}
+		if local != digest {
+			return mismatch, i18n.Errorf("verify.hash_mismatch", algorithm)
+		}
+		verified = true
+	}
+
+	// The ETag is the MD5 of the contents unless the object was uploaded in
+	// parts, compressed or encrypted with KMS; the ETag of parts is computed
+	// from the MD5 of each part.
+	etag := strings.Trim(aws.StringValue(head.ETag), "\"")
+	_, compressed := metadataValue(head.Metadata, compressionMetaKey)
+	if etag != "" && !strings.Contains(etag, "-") && !compressed && aws.StringValue(head.ServerSideEncryption) != s3.ServerSideEncryptionAwsKms {
+		local, err := calculateMD5(localPath)
+		if err != nil {
+			return VerifyUnreadable, err
+		}
+		if local != etag {
+			return mismatch, i18n.Errorf("verify.etag_mismatch")
+		}
+		verified = true
+	}
+	if !verified && strings.Contains(etag, "-") && !compressed && aws.StringValue(head.ServerSideEncryption) != s3.ServerSideEncryptionAwsKms {
+		match, ok, err := matchesMultipartETag(localPath, info.Size(), etag)
+		if err != nil {
+			return VerifyUnreadable, err
+		}
+		if ok && !match {
+			return mismatch, i18n.Errorf("verify.etag_mismatch")
+		}
+		verified = ok
+	}
+
+	if !verified {
+		return VerifyUnverifiable, nil
+	}
+	return "", nil
+}
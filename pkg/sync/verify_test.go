@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// headFor returns HeadObject output describing the upload of the file at
+// path, as withSyncMetadata records it.
+func headFor(t *testing.T, path string) *s3.HeadObjectOutput {
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	digest, err := fileContentHash(HashMD5, path)
+	require.NoError(t, err)
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(info.Size()),
+		LastModified:  aws.Time(time.Now()),
+		ETag:          aws.String(`"` + digest + `"`),
+		Metadata:      withSyncMetadata(nil, info, HashMD5, digest),
+	}
+}
+
+func headKey(key string) interface{} {
+	return mock.MatchedBy(func(input *s3.HeadObjectInput) bool { return *input.Key == key })
+}
+
+// Test Suite: verify
+func TestVerify(t *testing.T) {
+	tempDir := t.TempDir()
+	good := createTempFile(t, tempDir, "good.txt", "good")
+	corrupted := createTempFile(t, tempDir, "corrupted.txt", "original")
+	changed := createTempFile(t, tempDir, "changed.txt", "v1")
+	createTempFile(t, tempDir, "missing.txt", "new")
+
+	goodHead := headFor(t, good)
+	corruptedHead := headFor(t, corrupted)
+	corruptedHead.ETag = aws.String(`"00000000000000000000000000000000"`)
+	changedHead := headFor(t, changed)
+	require.NoError(t, os.WriteFile(changed, []byte("v2"), 0644))
+	require.NoError(t, os.Chtimes(changed, time.Now().Add(time.Hour), time.Now().Add(time.Hour)))
+
+	client := new(mockS3Client)
+	client.On("ListObjectsV2Pages", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []*s3.Object{
+		{Key: aws.String("good.txt")},
+		{Key: aws.String("corrupted.txt")},
+		{Key: aws.String("changed.txt")},
+		{Key: aws.String("removed.txt")},
+		{Key: aws.String(heartbeatKey)},
+	}}, nil).Once()
+	client.On("HeadObject", headKey("good.txt")).Return(goodHead, nil).Once()
+	client.On("HeadObject", headKey("corrupted.txt")).Return(corruptedHead, nil).Once()
+	client.On("HeadObject", headKey("changed.txt")).Return(changedHead, nil).Once()
+
+	s := newTestSyncer(t, client)
+	s.cfg.RootDir = tempDir
+	result, err := s.Verify(context.Background())
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+
+	assert.Equal(t, 4, result.Checked)
+	assert.Equal(t, 1, result.Verified)
+	statuses := make(map[string]string)
+	for _, p := range result.Problems {
+		statuses[p.Key] = p.Status
+	}
+	assert.Equal(t, map[string]string{
+		"corrupted.txt": VerifyCorrupted,
+		"changed.txt":   VerifyChanged,
+		"missing.txt":   VerifyMissing,
+		"removed.txt":   VerifyExtra,
+	}, statuses)
+	assert.Len(t, result.Failed(), 3)
+	client.AssertNotCalled(t, "PutObject", mock.Anything)
+	client.AssertNotCalled(t, "DeleteObject", mock.Anything)
+}
+
+func TestVerifyFile(t *testing.T) {
+	tempDir := t.TempDir()
+	path := createTempFile(t, tempDir, "a.txt", "contents")
+
+	t.Run("stored hash without a comparable ETag", func(t *testing.T) {
+		head := headFor(t, path)
+		head.ETag = aws.String(`"abc-2"`)
+		client := new(mockS3Client)
+		client.On("HeadObject", mock.Anything).Return(head, nil).Once()
+
+		status, err := newTestSyncer(t, client).verifyFile("a.txt", path)
+		require.NoError(t, err)
+		assert.Empty(t, status)
+	})
+
+	t.Run("multipart object without metadata", func(t *testing.T) {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		client := new(mockS3Client)
+		client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+			ContentLength: aws.Int64(info.Size()),
+			LastModified:  aws.Time(time.Now()),
+			ETag:          aws.String(`"abc-2"`),
+		}, nil).Once()
+
+		status, err := newTestSyncer(t, client).verifyFile("a.txt", path)
+		require.NoError(t, err)
+		assert.Equal(t, VerifyUnverifiable, status)
+	})
+
+	t.Run("size differs", func(t *testing.T) {
+		head := headFor(t, path)
+		head.ContentLength = aws.Int64(1)
+		client := new(mockS3Client)
+		client.On("HeadObject", mock.Anything).Return(head, nil).Once()
+
+		status, _ := newTestSyncer(t, client).verifyFile("a.txt", path)
+		assert.Equal(t, VerifyCorrupted, status)
+	})
+
+	t.Run("S3 error aborts", func(t *testing.T) {
+		client := new(mockS3Client)
+		client.On("HeadObject", mock.Anything).Return(nil, awserr.New("AccessDenied", "denied", nil)).Once()
+
+		status, err := newTestSyncer(t, client).verifyFile("a.txt", path)
+		assert.Empty(t, status)
+		assert.Error(t, err)
+	})
+}
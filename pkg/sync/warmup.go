@@ -0,0 +1,86 @@
+package sync
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/robfig/cron/v3"
+)
+
+// warmUp prepares the next scheduled run: it refreshes credentials that
+// would expire before the run, validates them with STS, resolves the bucket
+// endpoint and opens a connection to it with HeadBucket. The returned error
+// is what the run itself would most likely fail with.
+func (s *Syncer) warmUp(ctx context.Context) error {
+	if s.sess != nil {
+		creds := s.sess.Config.Credentials
+		if expiresAt, err := creds.ExpiresAt(); err == nil && time.Until(expiresAt) < 2*s.cfg.WarmUp {
+			creds.Expire()
+		}
+		if _, err := creds.GetWithContext(ctx); err != nil {
+			return i18n.Errorf("warmup.no_credentials", err)
+		}
+
+		if _, err := sts.New(s.sess).GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{}); err != nil {
+			return i18n.Errorf("warmup.credentials_refused", err)
+		}
+
+		if host := s.bucketHost(); host != "" {
+			if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+				return i18n.Errorf("warmup.dns", host, err)
+			}
+		}
+	}
+
+	if _, err := s.client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(s.cfg.Bucket)}); err != nil {
+		return i18n.Errorf("warmup.bucket", s.cfg.Bucket, err)
+	}
+	return nil
+}
+
+// bucketHost returns the virtual-hosted endpoint of the bucket, the host
+// uploads connect to.
+func (s *Syncer) bucketHost() string {
+	if s.cfg.Accelerate {
+		if s.cfg.DualStack {
+			return s.cfg.Bucket + ".s3-accelerate.dualstack.amazonaws.com"
+		}
+		return s.cfg.Bucket + ".s3-accelerate.amazonaws.com"
+	}
+	endpoint, err := url.Parse(s3.New(s.sess, s.cfg.s3Config()).Endpoint)
+	if err != nil || endpoint.Hostname() == "" {
+		return ""
+	}
+	return s.cfg.Bucket + "." + endpoint.Hostname()
+}
+
+// runWarmUp runs warmUp ahead of the run due at next, recording the outcome
+// for Status and warning right away when the run is expected to fail.
+func (s *Syncer) runWarmUp(ctx context.Context, next time.Time) {
+	err := s.warmUp(ctx)
+
+	s.mu.Lock()
+	s.warmUpErr = err
+	s.mu.Unlock()
+
+	if err != nil {
+		log.Printf(i18n.T("warmup.will_fail"), time.Now().Format("15:04:05"), next.Format("15:04:05"), err)
+	}
+}
+
+// nextWarmUp returns when to warm up for the first run of entry that has not
+// been warmed up yet, and that run.
+func nextWarmUp(entry cron.Entry, warmedFor time.Time, lead time.Duration) (at, run time.Time) {
+	run = entry.Next
+	if !run.After(warmedFor) {
+		run = entry.Schedule.Next(run)
+	}
+	return run.Add(-lead), run
+}
@@ -0,0 +1,57 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: warm-up before scheduled runs
+func TestRunWarmUp(t *testing.T) {
+	next := time.Now().Add(time.Minute)
+
+	t.Run("reachable bucket", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadBucket", mock.Anything).Return(&s3.HeadBucketOutput{}, nil).Once()
+		s := newTestSyncer(t, mockClient)
+
+		s.runWarmUp(context.Background(), next)
+		assert.NoError(t, s.Status().WarmUpError)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("failure is reported until the next run starts", func(t *testing.T) {
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadBucket", mock.Anything).Return(nil, errors.New("AccessDenied")).Once()
+		s := newTestSyncer(t, mockClient)
+
+		s.runWarmUp(context.Background(), next)
+		require.Error(t, s.Status().WarmUpError)
+		assert.Contains(t, s.Status().WarmUpError.Error(), "AccessDenied")
+
+		s.runStarted()
+		assert.NoError(t, s.Status().WarmUpError)
+	})
+}
+
+func TestNextWarmUp(t *testing.T) {
+	schedule, err := cron.ParseStandard("0 * * * *")
+	require.NoError(t, err)
+	next := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+	entry := cron.Entry{Schedule: schedule, Next: next}
+
+	at, run := nextWarmUp(entry, time.Time{}, 2*time.Minute)
+	assert.True(t, run.Equal(next))
+	assert.True(t, at.Equal(next.Add(-2*time.Minute)))
+
+	at, run = nextWarmUp(entry, next, 2*time.Minute)
+	assert.True(t, run.Equal(next.Add(time.Hour)), "a run already warmed up is skipped")
+	assert.True(t, at.Equal(next.Add(time.Hour-2*time.Minute)))
+}
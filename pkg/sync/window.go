@@ -0,0 +1,155 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// Window is a period that recurs every week, such as "22:00-06:00",
+// "mon-fri 09:00-18:00" or "sat,sun". A window that ends before it starts
+// crosses midnight and belongs to the day it starts on; one without hours
+// covers its days whole.
+type Window struct {
+	// Days are the weekdays the window starts on, indexed by time.Weekday.
+	Days [7]bool
+	// Start and End are the times of day the window opens and closes;
+	// equal values cover the whole day.
+	Start time.Duration
+	End   time.Duration
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseWindow parses a window: optional days (names, comma-separated, or
+// ranges like mon-fri) followed by an optional HH:MM-HH:MM range.
+func ParseWindow(spec string) (Window, error) {
+	fields := strings.Fields(strings.ToLower(spec))
+	if len(fields) == 0 || len(fields) > 2 {
+		return Window{}, i18n.Errorf("window.invalid", spec)
+	}
+
+	var w Window
+	if hours := fields[len(fields)-1]; strings.Contains(hours, ":") {
+		fields = fields[:len(fields)-1]
+		start, end, _ := strings.Cut(hours, "-")
+		var okStart, okEnd bool
+		w.Start, okStart = parseTimeOfDay(start)
+		w.End, okEnd = parseTimeOfDay(end)
+		if !okStart || !okEnd {
+			return Window{}, i18n.Errorf("window.invalid", spec)
+		}
+	}
+
+	switch {
+	case len(fields) == 0:
+		w.Days = [7]bool{true, true, true, true, true, true, true}
+	case len(fields) > 1 || !parseDays(fields[0], &w.Days):
+		return Window{}, i18n.Errorf("window.invalid", spec)
+	}
+	return w, nil
+}
+
+// parseDays sets in days the weekdays of list, such as "mon-fri" or
+// "sat,sun"; ranges may wrap around the week ("fri-mon").
+func parseDays(list string, days *[7]bool) bool {
+	for _, item := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(item, "-")
+		from, ok := weekdays[first]
+		if !ok {
+			return false
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdays[last]; !ok {
+				return false
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return true
+}
+
+// parseTimeOfDay parses HH:MM, where 24:00 is the end of the day.
+func parseTimeOfDay(value string) (time.Duration, bool) {
+	if value == "24:00" {
+		return 24 * time.Hour, true
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, true
+}
+
+// contains reports whether t, in its own location, falls in w.
+func (w Window) contains(t time.Time) bool {
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+
+	switch {
+	case w.Start == w.End:
+		return w.Days[today]
+	case w.Start < w.End:
+		return w.Days[today] && sinceMidnight >= w.Start && sinceMidnight < w.End
+	default:
+		return (w.Days[today] && sinceMidnight >= w.Start) || (w.Days[yesterday] && sinceMidnight < w.End)
+	}
+}
+
+// windowReason reports why Config.Windows and Config.Blackouts do not
+// allow a scheduled run at now, or "" when they do.
+func (s *Syncer) windowReason(now time.Time) string {
+	for _, w := range s.cfg.Blackouts {
+		if w.contains(now) {
+			return i18n.T("window.blackout")
+		}
+	}
+	if len(s.cfg.Windows) == 0 {
+		return ""
+	}
+	for _, w := range s.cfg.Windows {
+		if w.contains(now) {
+			return ""
+		}
+	}
+	return i18n.T("window.outside")
+}
+
+// pauseOutsideWindows pauses the transfers of the run in progress while
+// the windows do not allow runs, with Config.PauseOutsideWindows, and
+// lets them continue once they do. Watch calls it periodically.
+func (s *Syncer) pauseOutsideWindows(now time.Time) {
+	if !s.cfg.PauseOutsideWindows {
+		return
+	}
+	closed := s.windowReason(now) != ""
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if closed == s.windowClosed {
+		return
+	}
+	s.windowClosed = closed
+	if closed {
+		if s.running {
+			fmt.Printf(i18n.T("window.paused"), now.Format("15:04:05"))
+		}
+		return
+	}
+	if s.running {
+		fmt.Printf(i18n.T("window.resumed"), now.Format("15:04:05"))
+	}
+	s.wakeWaiting()
+}
@@ -0,0 +1,120 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: sync windows and blackouts
+func TestParseWindow(t *testing.T) {
+	w, err := ParseWindow("22:00-06:00")
+	require.NoError(t, err)
+	assert.Equal(t, Window{Days: [7]bool{true, true, true, true, true, true, true}, Start: 22 * time.Hour, End: 6 * time.Hour}, w)
+
+	w, err = ParseWindow("Mon-Fri 09:30-18:00")
+	require.NoError(t, err)
+	assert.Equal(t, [7]bool{false, true, true, true, true, true, false}, w.Days)
+	assert.Equal(t, 9*time.Hour+30*time.Minute, w.Start)
+
+	w, err = ParseWindow("fri-mon,wed")
+	require.NoError(t, err)
+	assert.Equal(t, [7]bool{true, true, false, true, false, true, true}, w.Days)
+	assert.Equal(t, w.Start, w.End, "days alone cover the whole day")
+
+	for _, spec := range []string{"", "22:00", "25:00-06:00", "22:00-6", "someday 10:00-11:00", "mon tue 10:00-11:00", "mon-"} {
+		_, err := ParseWindow(spec)
+		assert.Equal(t, "window.invalid", i18n.ID(err), spec)
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	// 2026-10-16 is a Friday.
+	at := func(day int, clock string) time.Time {
+		tod, err := time.Parse("15:04", clock)
+		require.NoError(t, err)
+		return time.Date(2026, 10, day, tod.Hour(), tod.Minute(), 0, 0, time.Local)
+	}
+
+	night, err := ParseWindow("mon-fri 22:00-06:00")
+	require.NoError(t, err)
+	assert.True(t, night.contains(at(16, "23:00")), "Friday night")
+	assert.True(t, night.contains(at(17, "05:59")), "Friday's window ends on Saturday")
+	assert.False(t, night.contains(at(17, "06:00")))
+	assert.False(t, night.contains(at(17, "23:00")), "no window starts on Saturday")
+	assert.False(t, night.contains(at(16, "12:00")))
+
+	office, err := ParseWindow("09:00-18:00")
+	require.NoError(t, err)
+	assert.True(t, office.contains(at(17, "09:00")))
+	assert.False(t, office.contains(at(17, "18:00")))
+
+	weekend, err := ParseWindow("sat,sun")
+	require.NoError(t, err)
+	assert.True(t, weekend.contains(at(18, "00:00")))
+	assert.False(t, weekend.contains(at(16, "23:59")))
+}
+
+func TestWindowReason(t *testing.T) {
+	// 2026-10-16 is a Friday.
+	friday := func(hour int) time.Time { return time.Date(2026, 10, 16, hour, 0, 0, 0, time.Local) }
+	window := func(spec string) Window {
+		w, err := ParseWindow(spec)
+		require.NoError(t, err)
+		return w
+	}
+
+	s := newTestSyncer(t, new(mockS3Client))
+	assert.Empty(t, s.windowReason(friday(12)), "no windows allow every run")
+
+	s.cfg.Windows = []Window{window("22:00-06:00")}
+	s.cfg.Blackouts = []Window{window("fri 23:00-24:00")}
+	assert.Equal(t, "outside the sync windows", s.windowReason(friday(12)))
+	assert.Empty(t, s.windowReason(friday(22)))
+	assert.Equal(t, "blackout period", s.windowReason(friday(23)))
+
+	t.Run("windows defer scheduled runs", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.Blackouts = []Window{window("00:00-00:00")}
+		assert.True(t, s.deferRun())
+		assert.Equal(t, "blackout period", s.Status().Deferred)
+	})
+}
+
+func TestPauseOutsideWindows(t *testing.T) {
+	friday := func(hour int) time.Time { return time.Date(2026, 10, 16, hour, 0, 0, 0, time.Local) }
+	w, err := ParseWindow("22:00-06:00")
+	require.NoError(t, err)
+
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.Windows = []Window{w}
+	s.cfg.PauseOutsideWindows = true
+	s.runStarted()
+
+	s.pauseOutsideWindows(friday(7))
+	waited := make(chan bool)
+	go func() { waited <- s.waitWhilePaused() }()
+	select {
+	case <-waited:
+		t.Fatal("transfers went on outside the window")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.pauseOutsideWindows(friday(22))
+	select {
+	case ok := <-waited:
+		assert.True(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("transfers did not continue when the window opened")
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		s := newTestSyncer(t, new(mockS3Client))
+		s.cfg.Windows = []Window{w}
+		s.pauseOutsideWindows(friday(7))
+		assert.True(t, s.waitWhilePaused())
+	})
+}
@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// With Config.Xattrs, the extended attributes of each file, which hold the
+// POSIX ACLs on Linux, or the access control list of NTFS on Windows, are
+// stored in the metadata of its object and applied back by restore. They
+// are kept as the JSON of a name to value map, base64-encoded under
+// xattrsMetaKey. Other platforms neither capture nor restore them.
+
+// xattrsMetaKey holds the encoded attributes of the file.
+const xattrsMetaKey = "Gui-Sync-Xattrs"
+
+// maxXattrsSize bounds the encoded attributes: S3 limits the user metadata
+// of an object to 2 KB, and the rest of the sync metadata needs room.
+const maxXattrsSize = 1536
+
+func encodeXattrs(attrs map[string][]byte) string {
+	data, _ := json.Marshal(attrs)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func decodeXattrs(value string) (map[string][]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var attrs map[string][]byte
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// fileXattrs returns the encoded attributes of the file at path, "" when it
+// has none. ok is false, and the reason logged, when they cannot be read
+// or do not fit in the metadata.
+func (s *Syncer) fileXattrs(path string) (value string, ok bool) {
+	attrs, err := readXattrs(path)
+	if err != nil {
+		log.Printf(i18n.T("xattrs.read_failed"), path, err)
+		return "", false
+	}
+	if len(attrs) == 0 {
+		return "", true
+	}
+	value = encodeXattrs(attrs)
+	if len(value) > maxXattrsSize {
+		log.Printf(i18n.T("xattrs.too_large"), path, len(value), maxXattrsSize)
+		return "", false
+	}
+	return value, true
+}
+
+// withXattrs adds the attributes of the file at path to metadata, as
+// returned by withSyncMetadata, with Config.Xattrs.
+func (s *Syncer) withXattrs(metadata map[string]*string, path string) map[string]*string {
+	if !s.cfg.Xattrs {
+		return metadata
+	}
+	if value, ok := s.fileXattrs(path); ok && value != "" {
+		metadata[xattrsMetaKey] = aws.String(value)
+	}
+	return metadata
+}
+
+// xattrsChanged reports whether, with Config.Xattrs, the attributes of the
+// file at path differ from those stored in metadata. Attributes that cannot
+// be stored never make a file change.
+func (s *Syncer) xattrsChanged(metadata map[string]*string, path string) bool {
+	if !s.cfg.Xattrs {
+		return false
+	}
+	value, ok := s.fileXattrs(path)
+	if !ok {
+		return false
+	}
+	stored, _ := metadataValue(metadata, xattrsMetaKey)
+	return stored != value
+}
+
+// restoreXattrs applies the attributes stored in metadata to the file
+// restored at localPath. Attributes this platform or user cannot set, such
+// as another system's, are reported and skipped.
+func restoreXattrs(localPath string, metadata map[string]*string) {
+	value, ok := metadataValue(metadata, xattrsMetaKey)
+	if !ok {
+		return
+	}
+	attrs, err := decodeXattrs(value)
+	if err == nil {
+		err = writeXattrs(localPath, attrs)
+	}
+	if err != nil {
+		log.Printf(i18n.T("xattrs.restore_failed"), localPath, err)
+	}
+}
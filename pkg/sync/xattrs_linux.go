@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+)
+
+// readXattrs lists the extended attributes of the file at path. SELinux
+// labels are left out: they belong to the policy of the machine.
+func readXattrs(path string) (map[string][]byte, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if errors.Is(err, syscall.ENOTSUP) {
+		return nil, nil
+	}
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	names := make([]byte, size)
+	if size, err = syscall.Listxattr(path, names); err != nil {
+		return nil, err
+	}
+
+	attrs := make(map[string][]byte)
+	for _, name := range strings.Split(strings.TrimRight(string(names[:size]), "\x00"), "\x00") {
+		if name == "" || name == "security.selinux" {
+			continue
+		}
+		n, err := syscall.Getxattr(path, name, nil)
+		if errors.Is(err, syscall.ENODATA) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, n)
+		if n, err = syscall.Getxattr(path, name, value); err != nil {
+			return nil, err
+		}
+		attrs[name] = value[:n]
+	}
+	return attrs, nil
+}
+
+// writeXattrs sets attrs on the file at path, skipping the attributes of
+// other platforms. Every attribute is tried; the first failure is returned.
+func writeXattrs(path string, attrs map[string][]byte) error {
+	var firstErr error
+	for name, value := range attrs {
+		if !strings.HasPrefix(name, "user.") && !strings.HasPrefix(name, "system.") && !strings.HasPrefix(name, "trusted.") && !strings.HasPrefix(name, "security.") {
+			continue
+		}
+		if err := syscall.Setxattr(path, name, value, 0); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,95 @@
+package sync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// xattrFile creates a file with the user attribute user.origem, skipping
+// the test where the file system does not support them.
+func xattrFile(t *testing.T) string {
+	path := createTempFile(t, t.TempDir(), "a.txt", "conteúdo")
+	if err := syscall.Setxattr(path, "user.origem", []byte("câmera"), 0); err != nil {
+		if errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EPERM) {
+			t.Skip("the file system does not support user attributes")
+		}
+		require.NoError(t, err)
+	}
+	return path
+}
+
+// Test Suite: extended attributes on Linux
+func TestXattrsUploadedAndCompared(t *testing.T) {
+	path := xattrFile(t)
+	s := newTestSyncer(t, new(mockS3Client))
+
+	metadata := s.withXattrs(map[string]*string{}, path)
+	assert.Empty(t, metadata, "attributes are only stored with --xattrs")
+
+	s.cfg.Xattrs = true
+	metadata = s.withXattrs(map[string]*string{}, path)
+	require.Contains(t, metadata, xattrsMetaKey)
+	attrs, err := decodeXattrs(aws.StringValue(metadata[xattrsMetaKey]))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("câmera"), attrs["user.origem"])
+
+	assert.False(t, s.xattrsChanged(metadata, path))
+	require.NoError(t, syscall.Setxattr(path, "user.origem", []byte("scanner"), 0))
+	assert.True(t, s.xattrsChanged(metadata, path))
+
+	t.Run("a changed attribute makes the file change", func(t *testing.T) {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		client := new(mockS3Client)
+		client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{
+			ContentLength: aws.Int64(info.Size()),
+			LastModified:  aws.Time(time.Now().Add(time.Hour)),
+			Metadata:      metadata,
+		}, nil).Once()
+		s := newTestSyncer(t, client)
+		s.cfg.Xattrs = true
+
+		changed, err := s.fileChangedOnS3("a.txt", path)
+		require.NoError(t, err)
+		assert.True(t, changed)
+	})
+
+	t.Run("attributes too large for the metadata are left out", func(t *testing.T) {
+		require.NoError(t, syscall.Setxattr(path, "user.grande", []byte(strings.Repeat("x", maxXattrsSize)), 0))
+		_, ok := s.fileXattrs(path)
+		assert.False(t, ok)
+		assert.NotContains(t, s.withXattrs(map[string]*string{}, path), xattrsMetaKey)
+		assert.False(t, s.xattrsChanged(map[string]*string{}, path))
+	})
+}
+
+func TestRestoreXattrs(t *testing.T) {
+	source := xattrFile(t)
+	s := newTestSyncer(t, new(mockS3Client))
+	s.cfg.Xattrs = true
+	metadata := s.withXattrs(map[string]*string{}, source)
+	metadata[xattrsMetaKey] = aws.String(encodeXattrs(map[string][]byte{
+		"user.origem": []byte("câmera"),
+		"ntfs.acl":    []byte("D:(A;;FA;;;WD)"),
+	}))
+
+	restored := filepath.Join(filepath.Dir(source), "b.txt")
+	require.NoError(t, os.WriteFile(restored, []byte("conteúdo"), 0644))
+	require.NoError(t, restoreAttributes(restored, restoreObject{key: "b.txt"}, metadata))
+
+	value := make([]byte, 64)
+	n, err := syscall.Getxattr(restored, "user.origem", value)
+	require.NoError(t, err)
+	assert.Equal(t, "câmera", string(value[:n]))
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !windows
+
+package sync
+
+// readXattrs: extended attributes are only captured on Linux and Windows.
+func readXattrs(path string) (map[string][]byte, error) { return nil, nil }
+
+func writeXattrs(path string, attrs map[string][]byte) error { return nil }
@@ -0,0 +1,22 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: extended attributes and ACLs
+func TestEncodeXattrs(t *testing.T) {
+	attrs := map[string][]byte{"user.origem": []byte("https://exemplo.com"), "user.bin": {0, 1, 2}}
+	value := encodeXattrs(attrs)
+	assert.Equal(t, value, encodeXattrs(map[string][]byte{"user.bin": {0, 1, 2}, "user.origem": []byte("https://exemplo.com")}), "the encoding does not depend on the order")
+
+	decoded, err := decodeXattrs(value)
+	require.NoError(t, err)
+	assert.Equal(t, attrs, decoded)
+
+	_, err = decodeXattrs("não é base64")
+	assert.Error(t, err)
+}
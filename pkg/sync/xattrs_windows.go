@@ -0,0 +1,75 @@
+package sync
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procGetFileSecurityW                                     = advapi32.NewProc("GetFileSecurityW")
+	procSetFileSecurityW                                     = advapi32.NewProc("SetFileSecurityW")
+	procConvertSecurityDescriptorToStringSecurityDescriptorW = advapi32.NewProc("ConvertSecurityDescriptorToStringSecurityDescriptorW")
+	procConvertStringSecurityDescriptorToSecurityDescriptorW = advapi32.NewProc("ConvertStringSecurityDescriptorToSecurityDescriptorW")
+	procLocalFree                                            = syscall.NewLazyDLL("kernel32.dll").NewProc("LocalFree")
+)
+
+const (
+	daclSecurityInformation = 4
+	sddlRevision1           = 1
+	errorInsufficientBuffer = syscall.Errno(122)
+)
+
+// ntfsACLName names the access control list of the file, kept in SDDL.
+const ntfsACLName = "ntfs.acl"
+
+// readXattrs returns the access control list of the file at path. Owners
+// are left out: setting them needs privileges restore rarely has.
+func readXattrs(path string) (map[string][]byte, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	var needed uint32
+	ret, _, err := procGetFileSecurityW.Call(uintptr(unsafe.Pointer(name)), daclSecurityInformation, 0, 0, uintptr(unsafe.Pointer(&needed)))
+	if ret == 0 && err != errorInsufficientBuffer {
+		return nil, err
+	}
+	sd := make([]byte, needed)
+	if ret, _, err := procGetFileSecurityW.Call(uintptr(unsafe.Pointer(name)), daclSecurityInformation, uintptr(unsafe.Pointer(&sd[0])), uintptr(needed), uintptr(unsafe.Pointer(&needed))); ret == 0 {
+		return nil, err
+	}
+
+	var sddl *uint16
+	var length uint32
+	if ret, _, err := procConvertSecurityDescriptorToStringSecurityDescriptorW.Call(uintptr(unsafe.Pointer(&sd[0])), sddlRevision1, daclSecurityInformation, uintptr(unsafe.Pointer(&sddl)), uintptr(unsafe.Pointer(&length))); ret == 0 {
+		return nil, err
+	}
+	defer procLocalFree.Call(uintptr(unsafe.Pointer(sddl)))
+	return map[string][]byte{ntfsACLName: []byte(syscall.UTF16ToString(unsafe.Slice(sddl, length)))}, nil
+}
+
+// writeXattrs applies the access control list in attrs to the file at
+// path; the attributes of other platforms are skipped.
+func writeXattrs(path string, attrs map[string][]byte) error {
+	acl, ok := attrs[ntfsACLName]
+	if !ok {
+		return nil
+	}
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	sddl, err := syscall.UTF16PtrFromString(string(acl))
+	if err != nil {
+		return err
+	}
+	var sd uintptr
+	if ret, _, err := procConvertStringSecurityDescriptorToSecurityDescriptorW.Call(uintptr(unsafe.Pointer(sddl)), sddlRevision1, uintptr(unsafe.Pointer(&sd)), 0); ret == 0 {
+		return err
+	}
+	defer procLocalFree.Call(sd)
+	if ret, _, err := procSetFileSecurityW.Call(uintptr(unsafe.Pointer(name)), daclSecurityInformation, sd); ret == 0 {
+		return err
+	}
+	return nil
+}
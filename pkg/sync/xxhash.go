@@ -0,0 +1,126 @@
+package sync
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// xxHash64 (seed 0) as specified at
+// https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md. It is
+// implemented here because the standard library has none.
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+type xxh64 struct {
+	v1, v2, v3, v4 uint64
+	total          uint64
+	buf            [32]byte
+	n              int
+}
+
+func newXXH64() hash.Hash64 {
+	d := &xxh64{}
+	d.Reset()
+	return d
+}
+
+func (d *xxh64) Reset() {
+	// The initial lanes wrap around, which constant arithmetic rejects.
+	prime1 := xxPrime1
+	d.v1 = prime1 + xxPrime2
+	d.v2 = xxPrime2
+	d.v3 = 0
+	d.v4 = -prime1
+	d.total = 0
+	d.n = 0
+}
+
+func (d *xxh64) Size() int      { return 8 }
+func (d *xxh64) BlockSize() int { return 32 }
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func (d *xxh64) stripe(b []byte) {
+	d.v1 = xxRound(d.v1, binary.LittleEndian.Uint64(b[0:8]))
+	d.v2 = xxRound(d.v2, binary.LittleEndian.Uint64(b[8:16]))
+	d.v3 = xxRound(d.v3, binary.LittleEndian.Uint64(b[16:24]))
+	d.v4 = xxRound(d.v4, binary.LittleEndian.Uint64(b[24:32]))
+}
+
+func (d *xxh64) Write(b []byte) (int, error) {
+	written := len(b)
+	d.total += uint64(written)
+
+	if d.n > 0 {
+		copied := copy(d.buf[d.n:], b)
+		d.n += copied
+		b = b[copied:]
+		if d.n < 32 {
+			return written, nil
+		}
+		d.stripe(d.buf[:])
+		d.n = 0
+	}
+	for len(b) >= 32 {
+		d.stripe(b[:32])
+		b = b[32:]
+	}
+	d.n = copy(d.buf[:], b)
+	return written, nil
+}
+
+func (d *xxh64) Sum64() uint64 {
+	var h uint64
+	if d.total >= 32 {
+		h = bits.RotateLeft64(d.v1, 1) + bits.RotateLeft64(d.v2, 7) +
+			bits.RotateLeft64(d.v3, 12) + bits.RotateLeft64(d.v4, 18)
+		h = xxMergeRound(h, d.v1)
+		h = xxMergeRound(h, d.v2)
+		h = xxMergeRound(h, d.v3)
+		h = xxMergeRound(h, d.v4)
+	} else {
+		h = xxPrime5
+	}
+	h += d.total
+
+	b := d.buf[:d.n]
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func (d *xxh64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, d.Sum64())
+}
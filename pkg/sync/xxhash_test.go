@@ -0,0 +1,45 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Suite: xxHash64
+func TestXXH64(t *testing.T) {
+	long := append(bytes.Repeat(func() []byte {
+		b := make([]byte, 256)
+		for i := range b {
+			b[i] = byte(i)
+		}
+		return b
+	}(), 3), "tail"...)
+
+	tests := []struct {
+		input    []byte
+		expected uint64
+	}{
+		{[]byte(""), 0xef46db3751d8e999},
+		{[]byte("abc"), 0x44bc2cf5ad770999},
+		{long, 0x2a74de530bdf2a9f},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d bytes", len(tt.input)), func(t *testing.T) {
+			d := newXXH64()
+			d.Write(tt.input)
+			assert.Equal(t, tt.expected, d.Sum64())
+
+			// Writes split at odd offsets give the same digest.
+			d.Reset()
+			for rest := tt.input; len(rest) > 0; {
+				n := min(len(rest), 7)
+				d.Write(rest[:n])
+				rest = rest[n:]
+			}
+			assert.Equal(t, tt.expected, d.Sum64())
+		})
+	}
+}
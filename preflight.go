@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+// preflightLargest is how many of the largest files --preflight lists.
+const preflightLargest = 10
+
+// preflightRates are the upload rates of the --preflight time estimate when
+// --preflight-bandwidth is not given.
+var preflightRates = []int64{1 << 20, 10 << 20, 100 << 20}
+
+// printPreflight prints the report of --preflight for the tree of syncer,
+// estimating the upload time at bandwidth or, when zero, at preflightRates.
+func printPreflight(ctx context.Context, syncer *sync.Syncer, bandwidth int64) error {
+	fmt.Println(i18n.T("preflight.scanning"))
+	p, err := syncer.Preflight(ctx, preflightLargest)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(i18n.T("preflight.title"))
+	fmt.Printf(i18n.T("preflight.files"), p.Files, float64(p.Bytes)/(1<<30))
+
+	if len(p.Largest) > 0 {
+		fmt.Println(i18n.T("preflight.largest"))
+		for _, f := range p.Largest {
+			fmt.Printf("  %10.2f MB  %s\n", float64(f.Size)/(1<<20), f.Key)
+		}
+	}
+
+	rates := preflightRates
+	if bandwidth > 0 {
+		rates = []int64{bandwidth}
+	}
+	for _, rate := range rates {
+		fmt.Printf(i18n.T("preflight.upload_time"), formatRate(float64(rate)), p.UploadTime(rate).Round(time.Second))
+	}
+
+	fmt.Println(i18n.T("preflight.cost_title"))
+	for _, price := range sync.StoragePrices {
+		cost, _ := sync.MonthlyCost(price.Class, p.Bytes)
+		fmt.Printf("  %-20s $%.2f\n", price.Class, cost)
+	}
+	if len(p.ClassBytes) > 1 || p.ClassBytes[s3.StorageClassStandard] != p.Bytes {
+		fmt.Printf(i18n.T("preflight.cost_rules"), p.MonthlyCost())
+	}
+	fmt.Println("---------------------")
+	return nil
+}
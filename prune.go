@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+// runPrune implements `gui-sync prune`, permanently deleting the old
+// versions of a versioned bucket that fall outside the retention period.
+func runPrune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	bucket := fs.String("bucket", "", i18n.T("cli.bucket"))
+	awsRegion := fs.String("region", "", i18n.T("cli.region"))
+	creds := credentialFlags(fs)
+	languageFlag(fs)
+	var keep time.Duration
+	fs.Func("keep", i18n.T("prune.keep"), func(value string) (err error) {
+		keep, err = sync.ParseRetention(value)
+		return err
+	})
+	dryRun := fs.Bool("dry-run", false, i18n.T("prune.dry_run"))
+	keyTemplate := fs.String("key-template", "", i18n.T("flag.key_template"))
+	keyDate := keyDateFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), i18n.T("prune.usage"))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *bucket == "" || *awsRegion == "" || keep == 0 {
+		fs.Usage()
+		return i18n.Errorf("prune.required")
+	}
+
+	syncer, err := sync.New(sync.Config{Bucket: *bucket, Region: *awsRegion, Credentials: *creds, KeyTemplate: *keyTemplate, KeyDate: *keyDate})
+	if err != nil {
+		return err
+	}
+
+	versions, err := syncer.PrunableVersions(keep)
+	if err != nil {
+		return err
+	}
+
+	if len(versions) == 0 {
+		fmt.Println(i18n.T("prune.none"))
+		return nil
+	}
+
+	if *dryRun {
+		var size int64
+		for _, v := range versions {
+			kind := i18n.T("prune.version")
+			if v.DeleteMarker {
+				kind = i18n.T("prune.delete_marker")
+			}
+			fmt.Printf(i18n.T("prune.stale"), v.Key, kind, v.VersionID, v.LastModified.Format(time.RFC3339))
+			size += v.Size
+		}
+		fmt.Printf(i18n.T("prune.would_delete"), len(versions), size)
+		return nil
+	}
+
+	deleted, locked, err := syncer.DeleteVersions(versions)
+	fmt.Printf(i18n.T("prune.done"), deleted)
+	if len(locked) > 0 {
+		for _, v := range locked {
+			if v.RetainUntil.IsZero() {
+				fmt.Printf(i18n.T("prune.locked"), v.Key, v.VersionID)
+			} else {
+				fmt.Printf(i18n.T("prune.locked_until"), v.Key, v.VersionID, v.Mode, v.RetainUntil.Format(time.RFC3339))
+			}
+			if v.LegalHold {
+				fmt.Print(i18n.T("prune.legal_hold"))
+			}
+		}
+		fmt.Printf(i18n.T("prune.locked_count"), len(locked))
+	}
+	return err
+}
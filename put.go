@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+// runPut implements `gui-sync put -key <key> <file|->`, streaming a single
+// file or stdin straight into S3 without staging it on disk.
+func runPut(args []string) error {
+	fs := flag.NewFlagSet("put", flag.ContinueOnError)
+	bucket := fs.String("bucket", "", i18n.T("cli.bucket"))
+	awsRegion := fs.String("region", "", i18n.T("cli.region"))
+	creds := credentialFlags(fs)
+	languageFlag(fs)
+	key := fs.String("key", "", i18n.T("put.key"))
+	var opts sync.UploadOptions
+	fs.StringVar(&opts.SSE, "sse", "", i18n.T("put.sse"))
+	fs.StringVar(&opts.KMSKeyID, "kms-key-id", "", i18n.T("put.kms_key_id"))
+	fs.StringVar(&opts.StorageClass, "storage-class", "", i18n.T("put.storage_class"))
+	fs.StringVar(&opts.Tags, "tags", "", i18n.T("put.tags"))
+	fs.StringVar(&opts.ObjectLockMode, "object-lock-mode", "", i18n.T("put.object_lock_mode"))
+	fs.IntVar(&opts.ObjectLockDays, "object-lock-days", 0, i18n.T("put.object_lock_days"))
+	memoryLimitFlag := fs.String("memory-limit", "", i18n.T("put.memory_limit"))
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), i18n.T("put.usage"))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *bucket == "" || *awsRegion == "" || *key == "" {
+		fs.Usage()
+		return i18n.Errorf("put.required")
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return i18n.Errorf("put.no_file")
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	var memoryLimit int64
+	if *memoryLimitFlag != "" {
+		limit, err := sync.ParseMemoryLimit(*memoryLimitFlag)
+		if err != nil {
+			return err
+		}
+		memoryLimit = limit
+	}
+
+	var body io.Reader = os.Stdin
+	source := i18n.T("put.stdin")
+	if path := fs.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return i18n.Errorf("file.open", err)
+		}
+		defer file.Close()
+		body = file
+		source = path
+	}
+
+	syncer, err := sync.New(sync.Config{Bucket: *bucket, Region: *awsRegion, Credentials: *creds, MemoryLimit: memoryLimit})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, i18n.T("put.uploading"), source, *bucket, *key)
+	size, err := syncer.Put(*key, body, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✓ %s (%d bytes)\n", *key, size)
+
+	return nil
+}
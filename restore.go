@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+// runRestore implements `gui-sync restore -to <dir> [--as-of <timestamp> |
+// --manifest <id>] [-path <path>...] [-prefix <prefix>...]`, downloading
+// either the current objects or, on versioned buckets, the versions that
+// were current at the given point in time or listed in the manifest of a
+// run.
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	bucket := fs.String("bucket", "", i18n.T("cli.bucket"))
+	awsRegion := fs.String("region", "", i18n.T("cli.region"))
+	creds := credentialFlags(fs)
+	languageFlag(fs)
+	target := fs.String("to", "", i18n.T("restore.to"))
+	asOfValue := fs.String("as-of", "", i18n.T("restore.as_of_flag"))
+	manifest := fs.String("manifest", "", i18n.T("restore.manifest"))
+	var paths stringList
+	fs.Var(&paths, "path", i18n.T("restore.path"))
+	var prefixes stringList
+	fs.Var(&prefixes, "prefix", i18n.T("restore.prefix"))
+	partSizeMB := fs.Int("part-size", 16, i18n.T("restore.part_size"))
+	concurrency := fs.Int("concurrency", 5, i18n.T("restore.concurrency"))
+	glacierTier := fs.String("glacier-tier", "standard", i18n.T("restore.glacier_tier"))
+	glacierDays := fs.Int("glacier-days", 1, i18n.T("restore.glacier_days"))
+	sanitizeKeys := fs.Bool("sanitize-keys", false, i18n.T("restore.sanitize_keys"))
+	keyTemplate := fs.String("key-template", "", i18n.T("flag.key_template"))
+	keyDate := keyDateFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), i18n.T("restore.usage"))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *bucket == "" || *awsRegion == "" || *target == "" {
+		fs.Usage()
+		return i18n.Errorf("restore.required")
+	}
+	if *asOfValue != "" && *manifest != "" {
+		return i18n.Errorf("restore.manifest_as_of")
+	}
+	if *partSizeMB < 1 || *concurrency < 1 {
+		return i18n.Errorf("restore.invalid_parts")
+	}
+	tier, err := sync.ParseGlacierTier(*glacierTier)
+	if err != nil {
+		return err
+	}
+	if *glacierDays < 1 {
+		return i18n.Errorf("restore.invalid_days")
+	}
+
+	var asOf time.Time
+	if *asOfValue != "" {
+		asOf, err = sync.ParseAsOf(*asOfValue)
+		if err != nil {
+			return err
+		}
+		if keyDate.IsZero() {
+			*keyDate = asOf
+		}
+	}
+
+	syncer, err := sync.New(sync.Config{
+		Bucket:              *bucket,
+		Region:              *awsRegion,
+		Credentials:         *creds,
+		DownloadPartSize:    int64(*partSizeMB) * 1024 * 1024,
+		DownloadConcurrency: *concurrency,
+		GlacierTier:         tier,
+		GlacierDays:         *glacierDays,
+		SanitizeKeys:        *sanitizeKeys,
+		KeyTemplate:         *keyTemplate,
+		KeyDate:             *keyDate,
+	})
+	if err != nil {
+		return err
+	}
+
+	sel := sync.RestoreSelection{Paths: paths, Prefixes: prefixes}
+	if *manifest != "" {
+		err = syncer.RestoreManifest(*target, *manifest, sel)
+	} else {
+		err = syncer.Restore(*target, asOf, sel)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(i18n.T("restore.done"))
+	return nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+const defaultServiceName = "gui-sync"
+
+// serviceFlags lists the scheduler flags install-service forwards to the
+// installed service, besides bucket, region, dir and schedule.
+var serviceFlags = []string{
+	"files-from", "exclude-from", "gitignore", "one-file-system", "exclude-preset", "rules", "keep-remote", "low-priority-bandwidth", "archive", "fast", "scan-cache", "journal", "head-workers", "delta", "dedup", "detect-moves", "hard-links", "xattrs", "verify-uploads", "hash", "sanitize-keys", "key-template", "object-lock-mode", "object-lock-days", "mass-change", "mass-change-pause", "delete", "max-files", "max-total-size", "heartbeat", "heartbeat-interval", "manifest", "metrics-namespace", "healthcheck-url", "abort-stale-after",
+	"retry-max-attempts", "retry-base-delay", "retry-max-delay", "retry-on", "retry-log", "metadata-timeout", "transfer-timeout", "accelerate", "dual-stack", "create-bucket",
+	"replica", "parallel-replicas",
+	"profile", "role-arn", "external-id", "key-store",
+	"control-addr", "debug-addr", "warm-up", "pre-hook", "post-hook", "snapshot", "snapshot-release", "defer-on-battery", "defer-on-metered", "window", "blackout", "pause-outside-window", "jitter", "catch-up", "queue-overlapping",
+	"notify", "notify-on-failure", "report-dir", "report-format", "report-to-bucket", "lang",
+}
+
+// runInstallService implements `gui-sync install-service`, registering the
+// scheduler with the current configuration so it starts on boot: a systemd
+// unit on Linux and a startup task on Windows.
+func runInstallService(args []string) error {
+	fs := flag.NewFlagSet("install-service", flag.ContinueOnError)
+	name := fs.String("name", defaultServiceName, i18n.T("service.name"))
+	user := fs.Bool("user", false, i18n.T("service.user"))
+	printOnly := fs.Bool("print", false, i18n.T("service.print"))
+	bucket := fs.String("bucket", "", i18n.T("cli.bucket"))
+	awsRegion := fs.String("region", "", i18n.T("cli.region"))
+	dir := fs.String("dir", "", i18n.T("service.dir"))
+	schedule := fs.String("schedule", "", i18n.T("service.schedule"))
+	every := fs.Duration("every", 0, i18n.T("flag.every"))
+	forwarded := make(map[string]*forwardedFlag)
+	for _, flagName := range serviceFlags {
+		f := flag.Lookup(flagName)
+		_, isBool := f.Value.(interface{ IsBoolFlag() bool })
+		forwarded[flagName] = &forwardedFlag{isBool: isBool}
+		fs.Var(forwarded[flagName], flagName, f.Usage)
+	}
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), i18n.T("service.usage"))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	*bucket = ask(reader, *bucket, i18n.T("cli.prompt_bucket"), i18n.T("cli.empty_bucket"))
+	*awsRegion = ask(reader, *awsRegion, i18n.T("cli.prompt_region"), i18n.T("cli.empty_region"))
+	*dir = ask(reader, *dir, i18n.T("cli.prompt_dir"), i18n.T("cli.empty_dir"))
+	cronSchedule, err := scheduleFrom(*schedule, *every)
+	if err != nil {
+		return err
+	}
+	cronSchedule = ask(reader, cronSchedule, i18n.T("cli.prompt_schedule"), i18n.T("cli.empty_schedule"))
+	if _, err := sync.NextRuns(cronSchedule, time.Now(), 1); err != nil {
+		return err
+	}
+
+	absDir, err := filepath.Abs(*dir)
+	if err != nil {
+		return i18n.Errorf("service.invalid_dir", err)
+	}
+	if _, err := os.Stat(absDir); err != nil {
+		return i18n.Errorf("service.dir_missing", absDir)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return i18n.Errorf("service.executable", err)
+	}
+
+	command := []string{exe, "--bucket", *bucket, "--region", *awsRegion, "--dir", absDir, "--schedule", cronSchedule}
+	for _, flagName := range serviceFlags {
+		for _, value := range forwarded[flagName].values {
+			command = append(command, "--"+flagName+"="+value)
+		}
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		unit := systemdUnit(*name, command, *user)
+		if *printOnly {
+			fmt.Print(unit)
+			return nil
+		}
+		return installSystemdUnit(*name, unit, *user)
+	case "windows":
+		if *printOnly {
+			fmt.Println(windowsCommandLine(command))
+			return nil
+		}
+		return installWindowsTask(*name, command)
+	default:
+		return i18n.Errorf("service.install_unsupported", runtime.GOOS)
+	}
+}
+
+// forwardedFlag records every value of a scheduler flag given to
+// install-service verbatim, leaving its validation to the installed
+// scheduler.
+type forwardedFlag struct {
+	values []string
+	isBool bool
+}
+
+func (f *forwardedFlag) String() string { return strings.Join(f.values, ",") }
+
+func (f *forwardedFlag) Set(value string) error {
+	f.values = append(f.values, value)
+	return nil
+}
+
+func (f *forwardedFlag) IsBoolFlag() bool { return f.isBool }
+
+// runUninstallService implements `gui-sync uninstall-service`.
+func runUninstallService(args []string) error {
+	fs := flag.NewFlagSet("uninstall-service", flag.ContinueOnError)
+	name := fs.String("name", defaultServiceName, i18n.T("service.name"))
+	user := fs.Bool("user", false, i18n.T("service.uninstall_user"))
+	languageFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), i18n.T("service.uninstall_usage"))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		return uninstallSystemdUnit(*name, *user)
+	case "windows":
+		if err := runTool("schtasks", "/Delete", "/TN", *name, "/F"); err != nil {
+			return err
+		}
+		fmt.Printf(i18n.T("service.removed"), *name)
+		return nil
+	default:
+		return i18n.Errorf("service.uninstall_unsupported", runtime.GOOS)
+	}
+}
+
+// systemdUnit renders the unit running command. The scheduler has no
+// terminal as a service, so every prompted setting must be in command.
+func systemdUnit(name string, command []string, user bool) string {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = systemdQuote(arg)
+	}
+
+	// User units are pulled in by default.target, not multi-user.target.
+	wantedBy := "multi-user.target"
+	if user {
+		wantedBy = "default.target"
+	}
+
+	return fmt.Sprintf(`[Unit]
+Description=Sincronização gui-sync (%s)
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=simple
+ExecStart=%s
+Restart=on-failure
+RestartSec=30
+
+[Install]
+WantedBy=%s
+`, name, strings.Join(quoted, " "), wantedBy)
+}
+
+// systemdQuote quotes arg for ExecStart, escaping the specifier and
+// variable expansion characters.
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	return `"` + arg + `"`
+}
+
+func systemdUnitPath(name string, user bool) (string, error) {
+	if !user {
+		return filepath.Join("/etc/systemd/system", name+".service"), nil
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "systemd", "user", name+".service"), nil
+}
+
+func installSystemdUnit(name, unit string, user bool) error {
+	path, err := systemdUnitPath(name, user)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return i18n.Errorf("file.create", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(unit), 0644); err != nil {
+		return i18n.Errorf("service.write_unit", path, err)
+	}
+	fmt.Printf(i18n.T("service.unit_written"), path)
+
+	if err := runTool("systemctl", systemctlArgs(user, "daemon-reload")...); err != nil {
+		return err
+	}
+	if err := runTool("systemctl", systemctlArgs(user, "enable", "--now", name+".service")...); err != nil {
+		return err
+	}
+	fmt.Printf(i18n.T("service.enabled"), name)
+	if user {
+		fmt.Println(i18n.T("service.linger"))
+	}
+	return nil
+}
+
+func uninstallSystemdUnit(name string, user bool) error {
+	path, err := systemdUnitPath(name, user)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return i18n.Errorf("service.not_found", name, path)
+	}
+
+	if err := runTool("systemctl", systemctlArgs(user, "disable", "--now", name+".service")...); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return i18n.Errorf("service.remove", path, err)
+	}
+	if err := runTool("systemctl", systemctlArgs(user, "daemon-reload")...); err != nil {
+		return err
+	}
+	fmt.Printf(i18n.T("service.removed"), name)
+	return nil
+}
+
+func systemctlArgs(user bool, args ...string) []string {
+	if user {
+		return append([]string{"--user"}, args...)
+	}
+	return args
+}
+
+// installWindowsTask registers command as a task started at boot under
+// the SYSTEM account, restarting the scheduler after every reboot.
+func installWindowsTask(name string, command []string) error {
+	err := runTool("schtasks", "/Create", "/TN", name, "/TR", windowsCommandLine(command),
+		"/SC", "ONSTART", "/RU", "SYSTEM", "/RL", "HIGHEST", "/F")
+	if err != nil {
+		return err
+	}
+	if err := runTool("schtasks", "/Run", "/TN", name); err != nil {
+		return err
+	}
+	fmt.Printf(i18n.T("service.registered"), name)
+	return nil
+}
+
+// windowsCommandLine joins command using the Windows argument quoting rules.
+func windowsCommandLine(command []string) string {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		if arg != "" && !strings.ContainsAny(arg, " \t\"") {
+			quoted[i] = arg
+			continue
+		}
+		// Backslashes only escape when followed by a quote, so the trailing
+		// ones are doubled to keep the closing quote.
+		trimmed := strings.TrimRight(arg, `\`)
+		trailing := strings.Repeat(`\`, 2*(len(arg)-len(trimmed)))
+		quoted[i] = `"` + strings.ReplaceAll(trimmed, `"`, `\"`) + trailing + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+func runTool(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return i18n.Errorf("service.tool_failed", name, strings.Join(args, " "), err)
+		}
+		return i18n.Errorf("service.tool_run", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Suite: install-service
+func TestSystemdUnit(t *testing.T) {
+	command := []string{"/usr/local/bin/gui-sync", "--bucket", "b", "--dir", "/srv/meus dados", "--schedule", "*/5 * * * *", "--files-from=/etc/100%.txt"}
+
+	unit := systemdUnit("gui-sync", command, false)
+	assert.Contains(t, unit, `ExecStart=/usr/local/bin/gui-sync --bucket b --dir "/srv/meus dados" --schedule "*/5 * * * *" --files-from=/etc/100%%.txt`)
+	assert.Contains(t, unit, "WantedBy=multi-user.target")
+
+	assert.Contains(t, systemdUnit("gui-sync", command, true), "WantedBy=default.target")
+}
+
+func TestSystemdQuote(t *testing.T) {
+	assert.Equal(t, "plain", systemdQuote("plain"))
+	assert.Equal(t, `""`, systemdQuote(""))
+	assert.Equal(t, `"a \"b\""`, systemdQuote(`a "b"`))
+	assert.Equal(t, "$$HOME", systemdQuote("$HOME"))
+}
+
+func TestWindowsCommandLine(t *testing.T) {
+	assert.Equal(t, `C:\gui-sync.exe --dir "C:\Meus Documentos" --schedule "0 * * * *"`,
+		windowsCommandLine([]string{`C:\gui-sync.exe`, "--dir", `C:\Meus Documentos`, "--schedule", "0 * * * *"}))
+	assert.Equal(t, `"C:\Meus Documentos\\"`, windowsCommandLine([]string{`C:\Meus Documentos\`}))
+}
@@ -0,0 +1,34 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gui-sync/pkg/sync"
+)
+
+// handlePauseSignals pauses syncer on SIGUSR1 and resumes it on SIGUSR2
+// until ctx is done, e.g. `kill -USR1 <pid>` from a script or cron job.
+func handlePauseSignals(ctx context.Context, syncer *sync.Syncer) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case sig := <-signals:
+				if sig == syscall.SIGUSR1 {
+					syncer.Pause()
+				} else {
+					syncer.Resume()
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"context"
+
+	"github.com/gui-sync/pkg/sync"
+)
+
+// handlePauseSignals does nothing: Windows has no SIGUSR1 or SIGUSR2, so
+// pausing is only available through the control API.
+func handlePauseSignals(ctx context.Context, syncer *sync.Syncer) {}
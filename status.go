@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+)
+
+// runStatus implements `gui-sync status`, querying a running scheduler
+// through its control API and printing one line per profile.
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	addr := fs.String("addr", defaultControlAddr, i18n.T("status.addr"))
+	all := fs.Bool("all", false, i18n.T("status.all"))
+	languageFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), i18n.T("status.usage"))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	statuses, err := fetchStatus(*addr)
+	if err != nil {
+		return err
+	}
+	if !*all && len(statuses) > 1 {
+		statuses = statuses[:1]
+	}
+
+	printStatusTable(statuses, time.Now())
+	return nil
+}
+
+// runPause implements `gui-sync pause`.
+func runPause(args []string) error {
+	return runControlCommand("pause", i18n.T("status.paused"), args)
+}
+
+// runResume implements `gui-sync resume`.
+func runResume(args []string) error {
+	return runControlCommand("resume", i18n.T("status.resumed"), args)
+}
+
+// runControlCommand posts to the /<name> endpoint of a running scheduler.
+func runControlCommand(name, done string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	addr := fs.String("addr", defaultControlAddr, i18n.T("status.addr"))
+	languageFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), i18n.T("status.command_usage"), name)
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := postControl(*addr, name); err != nil {
+		return err
+	}
+	fmt.Println(done)
+	return nil
+}
+
+func postControl(addr, name string) error {
+	req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/"+name, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(controlHeader, "1")
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return i18n.Errorf("status.no_scheduler", addr, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return i18n.Errorf("status.http", resp.Status)
+	}
+	return nil
+}
+
+func fetchStatus(addr string) ([]profileStatus, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + addr + "/status")
+	if err != nil {
+		return nil, i18n.Errorf("status.no_scheduler", addr, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, i18n.Errorf("status.http", resp.Status)
+	}
+
+	var statuses []profileStatus
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		return nil, i18n.Errorf("status.invalid_response", err)
+	}
+	return statuses, nil
+}
+
+func printStatusTable(statuses []profileStatus, now time.Time) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, i18n.T("status.header"))
+	for _, s := range statuses {
+		result := "-"
+		switch {
+		case s.Running:
+			result = i18n.T("status.running")
+		case s.LastResult == resultFailure:
+			result = i18n.T("status.failed")
+		case s.LastResult != "":
+			result = s.LastResult
+		}
+
+		next := formatRelative(s.NextRun, now)
+		switch {
+		case s.Paused:
+			next = i18n.T("status.paused_short")
+		case s.Deferred != "":
+			next = fmt.Sprintf(i18n.T("status.deferred"), s.Deferred)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			s.Name,
+			s.Bucket,
+			formatRelative(s.LastRunStart, now),
+			result,
+			next,
+			s.PendingUploads,
+			formatRate(s.BytesPerSecond),
+		)
+	}
+	w.Flush()
+
+	for _, s := range statuses {
+		if s.Summary != nil {
+			label := i18n.T("status.last_run")
+			if s.Running {
+				label = i18n.T("status.current_run")
+			}
+			fmt.Printf("\n%s (%s): %s\n", s.Name, label, s.Summary)
+		}
+		if s.LastError != "" && !s.Running {
+			fmt.Printf("\n%s: %s\n", s.Name, s.LastError)
+		}
+		if s.WarmUpError != "" {
+			fmt.Printf(i18n.T("status.will_fail"), s.Name, s.WarmUpError)
+		}
+		if s.MassChange != "" {
+			fmt.Printf(i18n.T("status.mass_change"), s.Name, s.MassChange)
+		}
+	}
+}
+
+func formatRelative(t *time.Time, now time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	d := t.Sub(now).Round(time.Second)
+	if d < 0 {
+		return fmt.Sprintf(i18n.T("status.ago"), -d)
+	}
+	return fmt.Sprintf(i18n.T("status.in"), d)
+}
+
+func formatRate(bytesPerSecond float64) string {
+	if bytesPerSecond <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f MB/s", bytesPerSecond/(1024*1024))
+}
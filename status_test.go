@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/gui-sync/pkg/sync"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Suite: control API and status command
+func TestControlStatus(t *testing.T) {
+	syncer, err := sync.New(sync.Config{
+		Bucket:   "test-bucket",
+		Schedule: "*/5 * * * *",
+		StateDir: t.TempDir(),
+		Client:   struct{ s3iface.S3API }{},
+	})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(controlHandler(syncer))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	statuses, err := fetchStatus(addr)
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "default", statuses[0].Name)
+	assert.Equal(t, "test-bucket", statuses[0].Bucket)
+	assert.Equal(t, "*/5 * * * *", statuses[0].Schedule)
+	assert.Empty(t, statuses[0].LastResult)
+	assert.Nil(t, statuses[0].NextRun)
+}
+
+func TestControlCommands(t *testing.T) {
+	syncer, err := sync.New(sync.Config{
+		Bucket:   "test-bucket",
+		StateDir: t.TempDir(),
+		Client:   struct{ s3iface.S3API }{},
+	})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(controlHandler(syncer))
+	defer server.Close()
+
+	post := func(path string, withHeader bool) int {
+		req, err := http.NewRequest(http.MethodPost, server.URL+path, nil)
+		require.NoError(t, err)
+		if withHeader {
+			req.Header.Set(controlHeader, "1")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	t.Run("commands require the control header", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, post("/pause", false))
+		assert.False(t, syncer.Paused())
+	})
+
+	t.Run("pause and resume", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, post("/pause", true))
+		assert.True(t, syncer.Paused())
+
+		statuses, err := fetchStatus(strings.TrimPrefix(server.URL, "http://"))
+		require.NoError(t, err)
+		assert.True(t, statuses[0].Paused)
+
+		assert.Equal(t, http.StatusNoContent, post("/resume", true))
+		assert.False(t, syncer.Paused())
+	})
+
+	t.Run("pause and resume subcommands", func(t *testing.T) {
+		addr := strings.TrimPrefix(server.URL, "http://")
+		require.NoError(t, runPause([]string{"-addr", addr}))
+		assert.True(t, syncer.Paused())
+		require.NoError(t, runResume([]string{"-addr", addr}))
+		assert.False(t, syncer.Paused())
+	})
+
+	t.Run("sync now", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, post("/sync", true))
+	})
+
+	t.Run("GUI page is served at the root", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+	})
+}
+
+func TestProfileStatusOf(t *testing.T) {
+	start := time.Now().Add(-time.Minute)
+	end := time.Now()
+	next := end.Add(5 * time.Minute)
+
+	t.Run("failed run is reported", func(t *testing.T) {
+		status := profileStatusOf("default", sync.Status{LastRunStart: start, LastRunEnd: end, LastError: errors.New("access denied"), NextRun: next})
+		assert.Equal(t, resultFailure, status.LastResult)
+		assert.Equal(t, "access denied", status.LastError)
+		assert.False(t, status.Running)
+		require.NotNil(t, status.NextRun)
+		assert.True(t, status.NextRun.Equal(next))
+	})
+
+	t.Run("running profile reports backlog", func(t *testing.T) {
+		status := profileStatusOf("default", sync.Status{Running: true, LastRunStart: start, PendingUploads: 4, Summary: &sync.RunSummary{Scanned: 10}})
+		assert.True(t, status.Running)
+		assert.Equal(t, int64(4), status.PendingUploads)
+		require.NotNil(t, status.Summary)
+		assert.Equal(t, int64(10), status.Summary.Scanned)
+		assert.Empty(t, status.LastResult)
+		assert.Nil(t, status.LastRunEnd)
+	})
+}
+
+func TestFetchStatusWithoutDaemon(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	addr := strings.TrimPrefix(server.URL, "http://")
+	server.Close()
+
+	_, err := fetchStatus(addr)
+	assert.Error(t, err)
+}
+
+func TestFormatRelative(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-90 * time.Second)
+	future := now.Add(time.Hour)
+
+	assert.Equal(t, "-", formatRelative(nil, now))
+	assert.Equal(t, "1m30s ago", formatRelative(&past, now))
+	assert.Equal(t, "in 1h0m0s", formatRelative(&future, now))
+	assert.Equal(t, "-", formatRate(0))
+	assert.Equal(t, "2.00 MB/s", formatRate(2*1024*1024))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+// runVerify implements `gui-sync verify`, comparing the bucket with a local
+// directory without modifying either. The selection options match those of
+// the scheduler, so the same files are expected in the bucket. With
+// -manifest the bucket is compared with the manifest of a run instead, and
+// no directory is needed. With -every it keeps verifying the manifest and
+// alerts the -notify targets when the bucket drifts from it, never writing
+// to the bucket.
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	bucket := fs.String("bucket", "", i18n.T("cli.bucket"))
+	awsRegion := fs.String("region", "", i18n.T("cli.region"))
+	dir := fs.String("dir", "", i18n.T("verify.dir"))
+	manifest := fs.String("manifest", "", i18n.T("verify.manifest"))
+	sample := fs.Int("sample", 0, i18n.T("verify.sample"))
+	every := fs.Duration("every", 0, i18n.T("verify.every"))
+	var notify stringList
+	fs.Var(&notify, "notify", i18n.T("verify.notify"))
+	creds := credentialFlags(fs)
+	languageFlag(fs)
+	sel := selectionFlags(fs)
+	keyDate := keyDateFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), i18n.T("verify.usage"))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *bucket == "" || *awsRegion == "" || (*dir == "" && *manifest == "") {
+		fs.Usage()
+		return i18n.Errorf("verify.required")
+	}
+	if *every > 0 && *manifest == "" {
+		return i18n.Errorf("verify.every_manifest")
+	}
+	if err := sync.ValidateSample(*sample); err != nil {
+		return err
+	}
+
+	cfg := sync.Config{Bucket: *bucket, Region: *awsRegion, RootDir: *dir, Credentials: *creds}
+	sel.apply(&cfg)
+	cfg.KeyDate = *keyDate
+	for _, spec := range notify {
+		n, err := sync.ParseNotifier(spec, false)
+		if err != nil {
+			return err
+		}
+		cfg.Notifiers = append(cfg.Notifiers, n)
+	}
+	syncer, err := sync.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *every > 0 {
+		syncer.WatchManifest(ctx, *manifest, *every, *sample, func(result *sync.VerifyResult, err error) {
+			fmt.Printf(i18n.T("verify.title_manifest"), *bucket, *manifest)
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+			} else {
+				printVerifyResult(result, true)
+			}
+			fmt.Printf(i18n.T("verify.next"), *every)
+		})
+		return nil
+	}
+
+	var result *sync.VerifyResult
+	if *manifest != "" {
+		fmt.Printf(i18n.T("verify.title_manifest"), *bucket, *manifest)
+		result, err = syncer.VerifyManifestSample(ctx, *manifest, *sample)
+	} else {
+		fmt.Printf(i18n.T("verify.title"), *bucket, *dir)
+		result, err = syncer.Verify(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	if failed := printVerifyResult(result, *manifest != ""); failed > 0 {
+		return i18n.Errorf("verify.failed", failed)
+	}
+	if *manifest != "" {
+		fmt.Println(i18n.T("verify.done_manifest"))
+	} else {
+		fmt.Println(i18n.T("verify.done"))
+	}
+	return nil
+}
+
+// printVerifyResult lists the problems of result and its summary, and
+// returns how many of them are failures.
+func printVerifyResult(result *sync.VerifyResult, manifest bool) int {
+	warnings := 0
+	for _, p := range result.Problems {
+		switch p.Status {
+		case sync.VerifyCorrupted:
+			fmt.Printf(i18n.T("verify.corrupted"), p.Key, p.Err)
+		case sync.VerifyMissing:
+			fmt.Printf(i18n.T("verify.missing"), p.Key)
+		case sync.VerifyExtra:
+			fmt.Printf(i18n.T("verify.extra"), p.Key)
+		case sync.VerifyUnreadable:
+			fmt.Printf(i18n.T("verify.unreadable"), p.Key, p.Err)
+		case sync.VerifyChanged:
+			warnings++
+			if manifest {
+				fmt.Printf(i18n.T("verify.replaced"), p.Key)
+			} else {
+				fmt.Printf(i18n.T("verify.changed"), p.Key)
+			}
+		case sync.VerifyUnverifiable:
+			warnings++
+			fmt.Printf(i18n.T("verify.unverifiable"), p.Key)
+		}
+	}
+
+	failed := len(result.Failed())
+	fmt.Printf(i18n.T("verify.summary"), result.Checked, result.Verified, failed, warnings)
+	if result.Sampled > 0 {
+		fmt.Printf(i18n.T("verify.sampled"), result.Sampled)
+	}
+	return failed
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+// runVersion implements `gui-sync version`, printing what is needed to tell
+// apart the builds of a mixed-version fleet.
+func runVersion(args []string) error {
+	fmt.Printf("gui-sync %s\n", sync.Version)
+	fmt.Printf(i18n.T("version.format"), sync.FormatVersion)
+	fmt.Printf(i18n.T("version.features"), strings.Join(sync.Features, ", "))
+	return nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gui-sync/pkg/i18n"
+	"github.com/gui-sync/pkg/sync"
+)
+
+// setup holds the answers of the first-run wizard. They are saved in
+// config.json, in the configuration directory of gui-sync, so later starts
+// do not ask again; options given on the command line take precedence.
+// Named configurations (--config) are saved apart, in configs/<name>.json.
+type setup struct {
+	Bucket   string `json:"bucket"`
+	Region   string `json:"region"`
+	Dir      string `json:"dir"`
+	Schedule string `json:"schedule,omitempty"`
+	KeyStore string `json:"key_store,omitempty"`
+}
+
+// configNamePattern limits configuration names to ones safe as file names.
+var configNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+func checkConfigName(name string) error {
+	if name != "" && !configNamePattern.MatchString(name) {
+		return i18n.Errorf("wizard.invalid_config", name)
+	}
+	return nil
+}
+
+// setupPath returns the file of the configuration name, or of the default
+// one when name is empty.
+func setupPath(name string) (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return filepath.Join(base, "gui-sync", "config.json"), nil
+	}
+	return filepath.Join(base, "gui-sync", "configs", name+".json"), nil
+}
+
+// loadSetup reads the saved answers; a missing file means none were saved.
+func loadSetup(path string) (setup, error) {
+	var saved setup
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return saved, nil
+	}
+	if err != nil {
+		return saved, i18n.Errorf("wizard.load_failed", path, err)
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return saved, i18n.Errorf("wizard.load_failed", path, err)
+	}
+	return saved, nil
+}
+
+func saveSetup(path string, answers setup) error {
+	data, err := json.MarshalIndent(answers, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return i18n.Errorf("wizard.save_failed", path, err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return i18n.Errorf("wizard.save_failed", path, err)
+	}
+	return nil
+}
+
+// wizard asks for the settings missing from the command line, offering
+// the saved answers, or sensible values, as defaults and asking again
+// until an answer passes its check.
+type wizard struct {
+	reader *bufio.Reader
+	// asked records whether any answer was typed, so only then the
+	// answers are saved; closed, that the input ended.
+	asked  bool
+	closed bool
+}
+
+// value returns given when set, checked with check, or else asks for it.
+func (w *wizard) value(given, def, prompt, emptyMessage string, check func(string) error) string {
+	if given != "" {
+		if err := check(given); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		return given
+	}
+	return w.ask(def, prompt, emptyMessage, check)
+}
+
+func (w *wizard) ask(def, prompt, emptyMessage string, check func(string) error) string {
+	if def != "" {
+		prompt = fmt.Sprintf(i18n.T("wizard.with_default"), strings.TrimSuffix(prompt, ": "), def)
+	}
+	return w.read(def, prompt, emptyMessage, check, false)
+}
+
+// askSecret asks like ask without echoing the answer; def is kept on an
+// empty answer but never shown.
+func (w *wizard) askSecret(def, prompt, emptyMessage string, check func(string) error) string {
+	if def != "" {
+		prompt = fmt.Sprintf(i18n.T("wizard.with_default"), strings.TrimSuffix(prompt, ": "), i18n.T("wizard.saved_secret"))
+	}
+	return w.read(def, prompt, emptyMessage, check, true)
+}
+
+func (w *wizard) read(def, prompt, emptyMessage string, check func(string) error, hidden bool) string {
+	w.asked = true
+	for {
+		fmt.Print(prompt)
+		if hidden {
+			setEcho(false)
+		}
+		answer, readErr := w.reader.ReadString('\n')
+		if hidden {
+			setEcho(true)
+			fmt.Println()
+		}
+		w.closed = readErr != nil
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			answer = def
+		}
+		var err error
+		if answer == "" {
+			err = errors.New(emptyMessage)
+		} else {
+			err = check(answer)
+		}
+		if err == nil {
+			return answer
+		}
+		w.retry(err)
+	}
+}
+
+// retry reports an answer that failed its check before it is asked again,
+// which ends the program when there is no more input to ask with.
+func (w *wizard) retry(err error) {
+	if w.closed {
+		log.Fatalf("❌ %v", err)
+	}
+	fmt.Printf(i18n.T("wizard.invalid"), err)
+}
+
+// checkDir makes sure dir is a directory gui-sync can list.
+func checkDir(dir string) error {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return i18n.Errorf("wizard.dir_missing", dir)
+	}
+	if err != nil {
+		return i18n.Errorf("wizard.dir_unreadable", dir, err)
+	}
+	if !info.IsDir() {
+		return i18n.Errorf("wizard.not_dir", dir)
+	}
+	f, err := os.Open(dir)
+	if err == nil {
+		_, err = f.Readdirnames(1)
+		f.Close()
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return i18n.Errorf("wizard.dir_unreadable", dir, err)
+	}
+	return nil
+}
+
+func anyAnswer(string) error { return nil }
+
+var accessKeyIDPattern = regexp.MustCompile(`^[A-Z0-9]{16,128}$`)
+
+func checkAccessKeyID(id string) error {
+	if !accessKeyIDPattern.MatchString(id) {
+		return i18n.Errorf("wizard.invalid_key_id", id)
+	}
+	return nil
+}
+
+func checkSecretKey(secret string) error {
+	if len(secret) < 16 || strings.ContainsAny(secret, ": \t") {
+		return i18n.Errorf("wizard.invalid_secret_key")
+	}
+	return nil
+}
+
+// accessKeys makes sure the key store of creds holds access keys, asking
+// for them when it does not or, with again, to replace the stored ones.
+// The keys are only ever written to the store.
+func (w *wizard) accessKeys(creds sync.Credentials, region string, again bool) {
+	store, err := sync.ParseKeyStore(creds.KeyStore, region, creds)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	stored, found, err := store.Load()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if found && !again {
+		return
+	}
+
+	fmt.Printf(i18n.T("wizard.keys_intro"), creds.KeyStore)
+	keys := sync.AccessKeys{
+		AccessKeyID:     w.ask(stored.AccessKeyID, i18n.T("wizard.prompt_key_id"), i18n.T("wizard.empty_key_id"), checkAccessKeyID),
+		SecretAccessKey: w.askSecret(stored.SecretAccessKey, i18n.T("wizard.prompt_secret_key"), i18n.T("wizard.empty_secret_key"), checkSecretKey),
+	}
+	if keys == stored {
+		return
+	}
+	if err := store.Save(keys); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	fmt.Printf(i18n.T("wizard.keys_saved"), creds.KeyStore)
+}
+
+func checkSchedule(spec string) error {
+	_, err := sync.NextRuns(spec, time.Now(), 1)
+	return err
+}
+
+// checkBucket connects to the bucket of cfg and runs the startup checks
+// of the bucket, so a wrong bucket or region is asked again right away.
+func checkBucket(cfg sync.Config) error {
+	fmt.Println(i18n.T("wizard.checking_bucket"))
+	syncer, err := sync.New(cfg)
+	if err != nil {
+		return err
+	}
+	return syncer.PrepareBucket()
+}
+
+func defaultRegion() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	if region := os.Getenv("AWS_DEFAULT_REGION"); region != "" {
+		return region
+	}
+	return "us-east-1"
+}
+
+func orDefault(value, def string) string {
+	if value != "" {
+		return value
+	}
+	return def
+}